@@ -0,0 +1,121 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ActionImplementations returns the paths, relative to the charm root,
+// of the executables implementing the charm's actions, keyed by action
+// name. An action is implemented by the file of the same name in the
+// actions directory or, failing that, by the charm's dispatch script.
+// Actions with neither are omitted.
+func (dir *CharmDir) ActionImplementations() (map[string]string, error) {
+	return actionImplementations(dir.Actions(), func(p string) (bool, error) {
+		info, err := os.Stat(dir.join(filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return !info.IsDir(), nil
+	})
+}
+
+// ActionImplementations returns the paths, relative to the charm root,
+// of the executables implementing the charm's actions, keyed by action
+// name. An action is implemented by the file of the same name in the
+// actions directory or, failing that, by the charm's dispatch script.
+// Actions with neither are omitted.
+func (a *CharmArchive) ActionImplementations() (map[string]string, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	files := make(map[string]bool)
+	for _, fh := range zipr.File {
+		if !fh.Mode().IsDir() {
+			files[fh.Name] = true
+		}
+	}
+	return actionImplementations(a.Actions(), func(p string) (bool, error) {
+		return files[p], nil
+	})
+}
+
+// actionImplementations returns the implementation of each of
+// the given actions, using exists to find out whether a file
+// is present in the charm.
+func actionImplementations(actions *Actions, exists func(p string) (bool, error)) (map[string]string, error) {
+	impls := make(map[string]string)
+	if actions == nil || len(actions.ActionSpecs) == 0 {
+		return impls, nil
+	}
+	dispatch, err := exists(DispatchFile)
+	if err != nil {
+		return nil, err
+	}
+	for name := range actions.ActionSpecs {
+		ok, err := exists(ActionPath(name))
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case ok:
+			impls[name] = ActionPath(name)
+		case dispatch:
+			impls[name] = DispatchFile
+		}
+	}
+	return impls, nil
+}
+
+// actionNames returns the names of the given actions.
+func actionNames(actions *Actions) map[string]bool {
+	names := make(map[string]bool)
+	if actions != nil {
+		for name := range actions.ActionSpecs {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// CheckActionImplementations checks that every action declared by
+// the given charm, which must be a *CharmDir or a *CharmArchive, has
+// an executable in the actions directory, or that the charm has a
+// dispatch script to run it.
+func CheckActionImplementations(ch Charm) error {
+	var impls map[string]string
+	var err error
+	switch ch := ch.(type) {
+	case *CharmDir:
+		impls, err = ch.ActionImplementations()
+	case *CharmArchive:
+		impls, err = ch.ActionImplementations()
+	default:
+		return fmt.Errorf("unsupported charm type %T", ch)
+	}
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for name := range actionNames(ch.Actions()) {
+		if impls[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("no executable found for actions: %s", strings.Join(missing, ", "))
+}
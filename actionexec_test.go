@@ -0,0 +1,85 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ActionExecSuite struct{}
+
+var _ = gc.Suite(&ActionExecSuite{})
+
+func (s *ActionExecSuite) TestMissingImplementation(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	impls, err := dir.ActionImplementations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(impls, gc.HasLen, 0)
+	err = charm.CheckActionImplementations(dir)
+	c.Assert(err, gc.ErrorMatches, "no executable found for actions: snapshot")
+}
+
+func (s *ActionExecSuite) TestActionExecutable(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	err := os.Mkdir(filepath.Join(dir.Path, "actions"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir.Path, "actions", "snapshot"), []byte("#!/bin/sh\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	impls, err := dir.ActionImplementations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(impls, jc.DeepEquals, map[string]string{"snapshot": "actions/snapshot"})
+	c.Assert(charm.CheckActionImplementations(dir), gc.IsNil)
+
+	var buf bytes.Buffer
+	err = dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	impls, err = archive.ActionImplementations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(impls, jc.DeepEquals, map[string]string{"snapshot": "actions/snapshot"})
+	c.Assert(charm.CheckActionImplementations(archive), gc.IsNil)
+
+	logger := &recordingLogger{}
+	charm.SetLogger(logger)
+	defer charm.SetLogger(nil)
+	expandDir := c.MkDir()
+	err = archive.ExpandTo(expandDir)
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(filepath.Join(expandDir, "actions", "snapshot"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&0100, gc.Equals, os.FileMode(0100))
+	c.Assert(logger.kind(charm.EventActionMadeExecutable), jc.DeepEquals, []charm.Event{{
+		Op:   "expand",
+		Kind: charm.EventActionMadeExecutable,
+		Path: "actions/snapshot",
+	}})
+}
+
+func (s *ActionExecSuite) TestDispatch(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(dir.Path, "dispatch"), []byte("#!/bin/sh\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	impls, err := dir.ActionImplementations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(impls, jc.DeepEquals, map[string]string{"snapshot": "dispatch"})
+	c.Assert(charm.CheckActionImplementations(dir), gc.IsNil)
+}
+
+func (s *ActionExecSuite) TestNoActions(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "mysql")
+	impls, err := archive.ActionImplementations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(impls, gc.HasLen, 0)
+	c.Assert(charm.CheckActionImplementations(archive), gc.IsNil)
+}
@@ -7,12 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"regexp"
 	"strings"
 
 	"github.com/juju/gojsonschema"
-	"gopkg.in/yaml.v1"
 )
 
 var prohibitedSchemaKeys = map[string]bool{"$ref": true, "$schema": true}
@@ -31,6 +29,44 @@ type Actions struct {
 type ActionSpec struct {
 	Description string
 	Params      map[string]interface{}
+
+	// Descriptions holds translations of the description, keyed
+	// by language tag, if the description was given as a map.
+	Descriptions map[string]string `yaml:"-" bson:",omitempty"`
+}
+
+// DescriptionIn returns the action's description in the given
+// language, falling back to English and then to Description if
+// there is no such translation.
+func (spec *ActionSpec) DescriptionIn(lang string) string {
+	return localize(spec.Description, spec.Descriptions, lang)
+}
+
+// actionsDoc holds Actions as written in an actions.yaml file,
+// where action descriptions may be localized.
+type actionsDoc struct {
+	ActionSpecs map[string]actionSpecDoc `yaml:"actions,omitempty"`
+}
+
+type actionSpecDoc struct {
+	Description interface{}
+	Params      map[string]interface{}
+}
+
+// encodeActions returns the contents of an actions.yaml file
+// holding the given actions.
+func encodeActions(actions *Actions) ([]byte, error) {
+	var doc actionsDoc
+	for name, spec := range actions.ActionSpecs {
+		if doc.ActionSpecs == nil {
+			doc.ActionSpecs = make(map[string]actionSpecDoc)
+		}
+		doc.ActionSpecs[name] = actionSpecDoc{
+			Description: encodeDescription(spec.Description, spec.Descriptions),
+			Params:      spec.Params,
+		}
+	}
+	return yamlMarshal(doc)
 }
 
 func NewActions() *Actions {
@@ -59,33 +95,114 @@ func (spec *ActionSpec) ValidateParams(params interface{}) (bool, error) {
 	return false, fmt.Errorf("JSON validation failed: %s", strings.Join(errorStrings, "; "))
 }
 
+// actionsSchemaURI identifies the JSON-Schema draft used by the document
+// returned from Actions.Schema. The "$defs" keyword it relies on was
+// introduced in draft 2019-09.
+const actionsSchemaURI = "https://json-schema.org/draft/2019-09/schema"
+
+// Schema returns a single JSON-Schema document bundling the parameter
+// schemas of all the actions. Each action's Params are held under
+// "$defs", keyed by action name, and the document's properties refer
+// to them, so the whole describes an object mapping action names to
+// their parameters. Each definition is a shallow copy of the action's
+// Params, with the action's description added if the Params do not
+// hold one already.
+func (a *Actions) Schema() map[string]interface{} {
+	defs := make(map[string]interface{})
+	properties := make(map[string]interface{})
+	for name, spec := range a.ActionSpecs {
+		def := make(map[string]interface{})
+		for key, value := range spec.Params {
+			def[key] = value
+		}
+		if _, ok := def["description"]; !ok && spec.Description != "" {
+			def["description"] = spec.Description
+		}
+		defs[name] = def
+		properties[name] = map[string]interface{}{
+			"$ref": "#/$defs/" + name,
+		}
+	}
+	return map[string]interface{}{
+		"$schema":              actionsSchemaURI,
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+		"$defs":                defs,
+	}
+}
+
 // ReadActions builds an Actions spec from a charm's actions.yaml.
 func ReadActionsYaml(r io.Reader) (*Actions, error) {
-	data, err := ioutil.ReadAll(r)
+	return readActionsYaml(r, false)
+}
+
+// ReadActionsYamlStrict is like ReadActionsYaml except that actions
+// holding a byte order mark or CRLF line endings are rejected rather
+// than normalized.
+func ReadActionsYamlStrict(r io.Reader) (*Actions, error) {
+	return readActionsYaml(r, true)
+}
+
+func readActionsYaml(r io.Reader, strict bool) (*Actions, error) {
+	data, release, err := readYAMLSource(r)
 	if err != nil {
 		return nil, err
 	}
-	var unmarshaledActions Actions
-	if err := yaml.Unmarshal(data, &unmarshaledActions); err != nil {
+	defer release()
+	data, perr := normalizeYAML(data, strict)
+	if perr != nil {
+		perr.context = "invalid actions"
+		return nil, perr
+	}
+	if err := checkYAMLFeatures(data); err != nil {
+		err.context = "invalid actions"
+		return nil, err
+	}
+	var doc actionsDoc
+	if err := yamlUnmarshal(data, &doc); err != nil {
+		return nil, yamlDecodeError(data, "invalid actions", err)
+	}
+	if err := checkYAMLExpansion(data, doc); err != nil {
+		err.context = "invalid actions"
 		return nil, err
 	}
+	var unmarshaledActions Actions
+	for name, specDoc := range doc.ActionSpecs {
+		spec := ActionSpec{
+			Params: specDoc.Params,
+		}
+		spec.Description, spec.Descriptions, err = parseDescription(specDoc.Description)
+		if err == nil {
+			err = checkDescriptions(spec.Descriptions)
+		}
+		if err != nil {
+			return nil, newParseError(data, "invalid actions", "actions."+name+".description",
+				fmt.Sprintf("action %q has invalid description: %v", name, err))
+		}
+		if unmarshaledActions.ActionSpecs == nil {
+			unmarshaledActions.ActionSpecs = make(map[string]ActionSpec)
+		}
+		unmarshaledActions.ActionSpecs[name] = spec
+	}
 
 	for name, actionSpec := range unmarshaledActions.ActionSpecs {
 		if valid := actionNameRule.MatchString(name); !valid {
-			return nil, fmt.Errorf("bad action name %s", name)
+			return nil, newParseError(data, "", "actions."+name, "bad action name "+name)
 		}
 
 		// Clean any map[interface{}]interface{}s out so they don't
 		// cause problems with BSON serialization later.
+		paramsPath := "actions." + name + ".params"
 		cleansedParams, err := cleanse(actionSpec.Params)
 		if err != nil {
-			return nil, err
+			return nil, newParseError(data, "", paramsPath, err.Error())
 		}
 
 		// JSON-Schema must be a map
 		cleansedParamsMap, ok := cleansedParams.(map[string]interface{})
 		if !ok {
-			return nil, fmt.Errorf("the params failed to parse as a map")
+			return nil, newParseError(data, "", paramsPath, "the params failed to parse as a map")
 		}
 
 		// Now substitute the cleansed map into the original.
@@ -97,7 +214,8 @@ func ReadActionsYaml(r io.Reader) (*Actions, error) {
 		// Draft 4 (http://json-schema.org/latest/json-schema-core.html)
 		_, err = gojsonschema.NewJsonSchemaDocument(unmarshaledActions.ActionSpecs[name].Params)
 		if err != nil {
-			return nil, fmt.Errorf("invalid params schema for action schema %s: %v", name, err)
+			return nil, newParseError(data, "", paramsPath,
+				fmt.Sprintf("invalid params schema for action schema %s: %v", name, err))
 		}
 
 	}
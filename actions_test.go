@@ -437,7 +437,7 @@ actions:
       params:
          $schema: "http://json-schema.org/draft-03/schema#"
 `,
-		expectedError: "schema key \"$schema\" not compatible with this version of juju",
+		expectedError: "line 5, column 7: schema key \"$schema\" not compatible with this version of juju",
 	}, {
 		description: "Reject JSON-Schema containing references.",
 		yaml: `
@@ -450,7 +450,7 @@ actions:
          properties: 
             outfile: { $ref: "http://json-schema.org/draft-03/schema#" }
 `,
-		expectedError: "schema key \"$ref\" not compatible with this version of juju",
+		expectedError: "line 5, column 7: schema key \"$ref\" not compatible with this version of juju",
 	}, {
 		description: "Malformed YAML: missing key in \"outfile\".",
 		yaml: `
@@ -488,7 +488,7 @@ actions:
       description: Take a snapshot of the database.
 `,
 
-		expectedError: "bad action name -snapshot",
+		expectedError: "line 3, column 4: bad action name -snapshot",
 	}, {
 		description: "Malformed Actions: hyphen after action name.",
 		yaml: `
@@ -497,7 +497,7 @@ actions:
       description: Take a snapshot of the database.
 `,
 
-		expectedError: "bad action name snapshot-",
+		expectedError: "line 3, column 4: bad action name snapshot-",
 	}, {
 		description: "Malformed Actions: caps in action name.",
 		yaml: `
@@ -506,7 +506,7 @@ actions:
       description: Take a snapshot of the database.
 `,
 
-		expectedError: "bad action name Snapshot",
+		expectedError: "line 3, column 4: bad action name Snapshot",
 	}}
 
 	for i, test := range badActionsYamlTests {
@@ -517,3 +517,79 @@ actions:
 		c.Assert(err.Error(), gc.Equals, test.expectedError)
 	}
 }
+
+func (s *ActionsSuite) TestSchema(c *gc.C) {
+	actions := &Actions{map[string]ActionSpec{
+		"snapshot": ActionSpec{
+			Description: "Take a snapshot of the database.",
+			Params: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"outfile": map[string]interface{}{
+						"type": "string"}}}},
+		"reset": ActionSpec{
+			Params: map[string]interface{}{
+				"description": "Reset everything.",
+				"type":        "object"}},
+	}}
+	c.Assert(actions.Schema(), gc.DeepEquals, map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2019-09/schema",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"snapshot": map[string]interface{}{"$ref": "#/$defs/snapshot"},
+			"reset":    map[string]interface{}{"$ref": "#/$defs/reset"},
+		},
+		"additionalProperties": false,
+		"$defs": map[string]interface{}{
+			"snapshot": map[string]interface{}{
+				"description": "Take a snapshot of the database.",
+				"type":        "object",
+				"properties": map[string]interface{}{
+					"outfile": map[string]interface{}{
+						"type": "string"}}},
+			"reset": map[string]interface{}{
+				"description": "Reset everything.",
+				"type":        "object"},
+		},
+	})
+	// The original params must not be modified.
+	_, ok := actions.ActionSpecs["snapshot"].Params["description"]
+	c.Assert(ok, gc.Equals, false)
+}
+
+func (s *ActionsSuite) TestSchemaEmpty(c *gc.C) {
+	schema := NewActions().Schema()
+	c.Assert(schema["$defs"], gc.DeepEquals, map[string]interface{}{})
+	c.Assert(schema["properties"], gc.DeepEquals, map[string]interface{}{})
+}
+
+func (s *ActionsSuite) TestReadActionsYamlRejectsAliases(c *gc.C) {
+	_, err := ReadActionsYaml(bytes.NewReader([]byte(`
+actions:
+   snapshot:
+      params: &params
+         type: object
+   backup:
+      params: *params
+`)))
+	c.Assert(err, gc.ErrorMatches, `invalid actions: line 4, column 15: YAML anchors are not allowed`)
+}
+
+func (s *ActionsSuite) TestReadActionsYamlDecodeError(c *gc.C) {
+	_, err := ReadActionsYaml(bytes.NewBufferString("snapshot:\n\tdescription: d\n"))
+	c.Assert(err, gc.ErrorMatches, `invalid actions: line 2, column 2: found character that cannot start any token`)
+	perr, ok := err.(*ParseError)
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(perr.Line, gc.Equals, 2)
+	c.Assert(perr.context, gc.Equals, "invalid actions")
+}
+
+func (s *ActionsSuite) TestReadActionsYamlByteOrderMark(c *gc.C) {
+	data := "\xef\xbb\xbfactions:\n   snapshot:\n      description: Take a snapshot.\n"
+	actions, err := ReadActionsYaml(bytes.NewReader([]byte(data)))
+	c.Assert(err, gc.IsNil)
+	c.Assert(actions.ActionSpecs["snapshot"].Description, gc.Equals, "Take a snapshot.")
+
+	_, err = ReadActionsYamlStrict(bytes.NewReader([]byte(data)))
+	c.Assert(err, gc.ErrorMatches, `invalid actions: line 1, column 1: byte order marks are not allowed`)
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// annotationsFile holds the name of the reserved archive member
+// that holds the archive's annotations.
+const annotationsFile = "annotations.yaml"
+
+// Annotations returns the annotations attached to the archive by
+// AddAnnotation, such as build identifiers and identifiers assigned
+// by the charm store. It returns no annotations if there are none.
+func (a *CharmArchive) Annotations() (map[string]string, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	return archiveAnnotations(zipr.Reader)
+}
+
+func archiveAnnotations(zipr *zip.Reader) (map[string]string, error) {
+	r, err := zipOpenFile(&zipReadCloser{Reader: zipr}, annotationsFile)
+	if _, ok := err.(*noCharmArchiveFile); ok {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	annotations := make(map[string]string)
+	if err := yamlUnmarshal(data, &annotations); err != nil {
+		return nil, fmt.Errorf("invalid annotations: %v", err)
+	}
+	return annotations, nil
+}
+
+// AddAnnotation writes a copy of the archive to w with the given
+// annotation attached, replacing any existing annotation with the
+// same key. An empty value removes the annotation.
+//
+// Annotations are held in the reserved annotations.yaml member of
+// the archive, which is left out of the archive's statistics and
+// of comparisons between charms, so that annotating an archive does
+// not change its content digest.
+func (a *CharmArchive) AddAnnotation(w io.Writer, key, value string) error {
+	if key == "" || strings.ContainsAny(key, " \t\n:") {
+		return fmt.Errorf("invalid annotation key %q", key)
+	}
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return err
+	}
+	defer zipr.Close()
+	annotations, err := archiveAnnotations(zipr.Reader)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		delete(annotations, key)
+	} else {
+		annotations[key] = value
+	}
+	zipw := zip.NewWriter(w)
+	for _, fh := range zipr.File {
+		if fh.Name == annotationsFile {
+			continue
+		}
+		if err := copyZipFile(zipw, fh, fh.Name); err != nil {
+			return fmt.Errorf("cannot annotate archive: %v", err)
+		}
+	}
+	if len(annotations) > 0 {
+		data, err := yamlMarshal(annotations)
+		if err != nil {
+			return err
+		}
+		h := &zip.FileHeader{
+			Name:   annotationsFile,
+			Method: zip.Deflate,
+		}
+		h.SetMode(0644)
+		fw, err := zipw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+	}
+	// The statistics do not cover the annotations,
+	// so they remain valid.
+	if err := zipw.SetComment(zipr.Comment); err != nil {
+		return err
+	}
+	return zipw.Close()
+}
@@ -0,0 +1,84 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type AnnotationsSuite struct{}
+
+var _ = gc.Suite(&AnnotationsSuite{})
+
+func (s *AnnotationsSuite) annotate(c *gc.C, archive *charm.CharmArchive, key, value string) *charm.CharmArchive {
+	var buf bytes.Buffer
+	err := archive.AddAnnotation(&buf, key, value)
+	c.Assert(err, gc.IsNil)
+	annotated, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	return annotated
+}
+
+func (s *AnnotationsSuite) TestAddAnnotation(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	annotations, err := archive.Annotations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(annotations, gc.HasLen, 0)
+
+	annotated := s.annotate(c, archive, "build-id", "1234")
+	annotated = s.annotate(c, annotated, "store-id", "cs:trusty/dummy-1")
+	annotated = s.annotate(c, annotated, "build-id", "1235")
+	annotations, err = annotated.Annotations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(annotations, jc.DeepEquals, map[string]string{
+		"build-id": "1235",
+		"store-id": "cs:trusty/dummy-1",
+	})
+
+	// Annotations do not change the content digest
+	// or the charm's contents.
+	expect, err := archive.ComputeStats()
+	c.Assert(err, gc.IsNil)
+	stats, err := annotated.Stats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(stats, jc.DeepEquals, expect)
+	stats, err = annotated.ComputeStats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(stats, jc.DeepEquals, expect)
+	c.Assert(annotated.Verify(), gc.IsNil)
+	equal, err := charm.Equal(archive, annotated, charm.EqualOptions{CompareRevision: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(equal, jc.IsTrue)
+
+	// An empty value removes the annotation.
+	annotated = s.annotate(c, annotated, "build-id", "")
+	annotations, err = annotated.Annotations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(annotations, jc.DeepEquals, map[string]string{"store-id": "cs:trusty/dummy-1"})
+}
+
+func (s *AnnotationsSuite) TestAddAnnotationInvalidKey(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	var buf bytes.Buffer
+	err := archive.AddAnnotation(&buf, "build id", "1")
+	c.Assert(err, gc.ErrorMatches, `invalid annotation key "build id"`)
+	err = archive.AddAnnotation(&buf, "", "1")
+	c.Assert(err, gc.ErrorMatches, `invalid annotation key ""`)
+}
+
+func (s *AnnotationsSuite) TestInvalidAnnotations(c *gc.C) {
+	archive, err := charm.ReadCharmArchiveBytes(writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"annotations.yaml", "[not, a, map]"},
+	))
+	c.Assert(err, gc.IsNil)
+	_, err = archive.Annotations()
+	c.Assert(err, gc.ErrorMatches, "(?s)invalid annotations: .*")
+}
@@ -0,0 +1,338 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// archPayloadDir holds the directory of a charm holding the files
+// specific to each architecture, in a subdirectory named after
+// the architecture.
+const archPayloadDir = "arch"
+
+// archManifestFile holds the name of the file in a multi-architecture
+// charm that records the files specific to each architecture.
+const archManifestFile = "architectures.yaml"
+
+// Architectures returns the architectures named by the charm's
+// bases, sorted and without duplicates. It returns nil if the
+// charm does not restrict the architectures it runs on.
+func (m Meta) Architectures() []string {
+	seen := make(map[string]bool)
+	var archs []string
+	for _, b := range m.AllBases() {
+		if b.Arch != "" && !seen[b.Arch] {
+			seen[b.Arch] = true
+			archs = append(archs, b.Arch)
+		}
+	}
+	sort.Strings(archs)
+	return archs
+}
+
+// ArchiveFileName returns the conventional name of the file holding
+// the archive of the named charm built for the given architecture,
+// as in "mysql_amd64.charm", or of the archive for all architectures
+// if arch is empty.
+func ArchiveFileName(name, arch string) string {
+	if arch == "" {
+		return name + ".charm"
+	}
+	return name + "_" + arch + ".charm"
+}
+
+// ParseArchiveFileName parses a file name in the form returned by
+// ArchiveFileName, returning the charm name and architecture.
+func ParseArchiveFileName(filename string) (name, arch string, err error) {
+	base := strings.TrimSuffix(filename, ".charm")
+	if base == filename {
+		return "", "", fmt.Errorf("invalid archive file name %q", filename)
+	}
+	name = base
+	if i := strings.LastIndex(base, "_"); i >= 0 {
+		name, arch = base[:i], base[i+1:]
+		if !knownArchitectures[arch] {
+			return "", "", fmt.Errorf("invalid archive file name %q: unknown architecture %q", filename, arch)
+		}
+	}
+	if !IsValidName(name) {
+		return "", "", fmt.Errorf("invalid archive file name %q", filename)
+	}
+	return name, arch, nil
+}
+
+// archExclude returns a function, for use with writeArchive, that
+// excludes the payload trees for architectures other than arch.
+func archExclude(arch string) func(relpath string) bool {
+	return func(relpath string) bool {
+		parts := strings.SplitN(relpath, "/", 3)
+		return len(parts) >= 2 && parts[0] == archPayloadDir && parts[1] != arch
+	}
+}
+
+// ArchitectureManifest records the files that differ between the
+// architectures of a multi-architecture charm made by
+// MergeArchitectures. It maps each architecture to the slash-separated
+// paths of its files, each stored in the charm under arch/<arch>/
+// and put in place by ExpandToArchitecture.
+type ArchitectureManifest map[string][]string
+
+// ReadArchitectureManifest returns the architecture manifest of the
+// given charm, which must be a *CharmDir or a *CharmArchive. It
+// returns nil if the charm is not a multi-architecture charm.
+func ReadArchitectureManifest(ch Charm) (ArchitectureManifest, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	r, err := zipOpenFile(zipr, archManifestFile)
+	if _, ok := err.(*noCharmArchiveFile); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Architectures ArchitectureManifest
+	}
+	if err := yamlUnmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", archManifestFile, err)
+	}
+	return doc.Architectures, nil
+}
+
+// MergeArchitectures writes to w a single charm archive combining the
+// given archives of the same charm, each built for the architecture
+// it is keyed by, as by ArchiveToWithOptions with the Architecture
+// option. Files that are the same in all the archives are stored
+// once; the others, along with the files each archive holds under
+// arch/<arch>/, are stored for each architecture under arch/<arch>/
+// and recorded in an architectures.yaml manifest, so that
+// ExpandToArchitecture can select the files for an architecture.
+func MergeArchitectures(w io.Writer, archives map[string]*CharmArchive) error {
+	if len(archives) == 0 {
+		return fmt.Errorf("no archives to merge")
+	}
+	var archs []string
+	for arch := range archives {
+		if !knownArchitectures[arch] {
+			return fmt.Errorf("cannot merge archives: unknown architecture %q", arch)
+		}
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+	first := archives[archs[0]]
+	files := make(map[string]map[string]*zip.File)
+	payloads := make(map[string][]*zip.File)
+	for _, arch := range archs {
+		a := archives[arch]
+		if a.Meta().Name != first.Meta().Name || a.Revision() != first.Revision() {
+			return fmt.Errorf("cannot merge archives: %s archive holds %s-%d, not %s-%d", arch, a.Meta().Name, a.Revision(), first.Meta().Name, first.Revision())
+		}
+		zipr, err := a.zopen.openZip()
+		if err != nil {
+			return err
+		}
+		defer zipr.Close()
+		for _, fh := range zipr.File {
+			if fh.Name == archManifestFile {
+				return fmt.Errorf("cannot merge archives: %s archive is already a multi-architecture archive", arch)
+			}
+			if parts := strings.SplitN(fh.Name, "/", 3); len(parts) == 3 && parts[0] == archPayloadDir {
+				// The archive was built from a directory holding
+				// files for each architecture under arch/.
+				if parts[1] != arch {
+					return fmt.Errorf("cannot merge archives: %s archive holds %q", arch, fh.Name)
+				}
+				if parts[2] != "" {
+					payloads[arch] = append(payloads[arch], fh)
+				}
+				continue
+			}
+			if files[fh.Name] == nil {
+				files[fh.Name] = make(map[string]*zip.File)
+			}
+			files[fh.Name][arch] = fh
+		}
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zipw := zip.NewWriter(w)
+	manifest := make(ArchitectureManifest)
+	written := make(map[string]bool)
+	add := func(arch string, fh *zip.File, name string) error {
+		payloadName := path.Join(archPayloadDir, arch, name)
+		if strings.HasSuffix(name, "/") {
+			payloadName += "/"
+		}
+		if written[payloadName] {
+			return fmt.Errorf("cannot merge archives: %s archive holds %q twice", arch, payloadName)
+		}
+		written[payloadName] = true
+		manifest[arch] = append(manifest[arch], name)
+		return copyZipFile(zipw, fh, payloadName)
+	}
+	for _, name := range names {
+		common, err := sameInAll(files[name], archs)
+		if err != nil {
+			return err
+		}
+		if !common && name == MetadataFile {
+			return fmt.Errorf("cannot merge archives: metadata differs between architectures")
+		}
+		if common {
+			if err := copyZipFile(zipw, files[name][archs[0]], name); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, arch := range archs {
+			if fh := files[name][arch]; fh != nil {
+				if err := add(arch, fh, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, arch := range archs {
+		for _, fh := range payloads[arch] {
+			name := strings.SplitN(fh.Name, "/", 3)[2]
+			if err := add(arch, fh, name); err != nil {
+				return err
+			}
+		}
+		// Record architectures with no files of their own too.
+		if manifest[arch] == nil {
+			manifest[arch] = []string{}
+		}
+	}
+	data, err := yamlMarshal(map[string]interface{}{"architectures": manifest})
+	if err != nil {
+		return err
+	}
+	h := &zip.FileHeader{Name: archManifestFile, Method: zip.Deflate}
+	h.SetMode(0644)
+	mw, err := zipw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write(data); err != nil {
+		return err
+	}
+	return zipw.Close()
+}
+
+// sameInAll reports whether the given files, keyed by architecture,
+// exist for all the given architectures with the same mode and content.
+func sameInAll(files map[string]*zip.File, archs []string) (bool, error) {
+	if len(files) != len(archs) {
+		return false, nil
+	}
+	first := files[archs[0]]
+	firstData, err := readZipFile(first)
+	if err != nil {
+		return false, err
+	}
+	for _, arch := range archs[1:] {
+		fh := files[arch]
+		if fh.Mode() != first.Mode() {
+			return false, nil
+		}
+		data, err := readZipFile(fh)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(data, firstData) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// copyZipFile copies the given zip file entry to
+// zipw, storing it under the given name.
+func copyZipFile(zipw *zip.Writer, fh *zip.File, name string) error {
+	h := &zip.FileHeader{
+		Name:   name,
+		Method: fh.Method,
+	}
+	h.SetModTime(fh.ModTime())
+	h.SetMode(fh.Mode())
+	w, err := zipw.CreateHeader(h)
+	if err != nil || strings.HasSuffix(name, "/") {
+		return err
+	}
+	r, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// ExpandToArchitecture is like ExpandTo except that, for a
+// multi-architecture charm made by MergeArchitectures, the files for
+// the given architecture are put in place and those for other
+// architectures are left out. Charms for a single architecture
+// are expanded as usual.
+func (a *CharmArchive) ExpandToArchitecture(dir, arch string) error {
+	manifest, err := ReadArchitectureManifest(a)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		return a.ExpandTo(dir)
+	}
+	paths, ok := manifest[arch]
+	if !ok {
+		return fmt.Errorf("charm %q does not support architecture %q", a.Meta().Name, arch)
+	}
+	if err := a.ExpandTo(dir); err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if clean := path.Clean(p); clean != strings.TrimSuffix(p, "/") || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("invalid path %q in %s", p, archManifestFile)
+		}
+		if strings.HasSuffix(p, "/") {
+			if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(p)), 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		src := filepath.Join(dir, archPayloadDir, arch, filepath.FromSlash(p))
+		dst := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(dir, archPayloadDir)); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(dir, archManifestFile))
+}
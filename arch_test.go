@@ -0,0 +1,203 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ArchSuite struct{}
+
+var _ = gc.Suite(&ArchSuite{})
+
+func (s *ArchSuite) TestArchitectures(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(`
+name: a
+summary: s
+description: d
+bases: [ubuntu@14.04/arm64, ubuntu@14.10/amd64, ubuntu@14.10/arm64]
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Architectures(), jc.DeepEquals, []string{"amd64", "arm64"})
+
+	meta.Bases = []charm.Base{charm.MustParseBase("ubuntu@14.04")}
+	c.Assert(meta.Architectures(), gc.IsNil)
+}
+
+var archiveFileNameTests = []struct {
+	filename string
+	name     string
+	arch     string
+	err      string
+}{{
+	filename: "mysql_amd64.charm",
+	name:     "mysql",
+	arch:     "amd64",
+}, {
+	filename: "mysql.charm",
+	name:     "mysql",
+}, {
+	filename: "my-sql_ppc64el.charm",
+	name:     "my-sql",
+	arch:     "ppc64el",
+}, {
+	filename: "mysql_sparc.charm",
+	err:      `invalid archive file name "mysql_sparc.charm": unknown architecture "sparc"`,
+}, {
+	filename: "mysql.zip",
+	err:      `invalid archive file name "mysql.zip"`,
+}, {
+	filename: "My_amd64.charm",
+	err:      `invalid archive file name "My_amd64.charm"`,
+}}
+
+func (s *ArchSuite) TestArchiveFileName(c *gc.C) {
+	for i, test := range archiveFileNameTests {
+		c.Logf("test %d: %s", i, test.filename)
+		name, arch, err := charm.ParseArchiveFileName(test.filename)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(name, gc.Equals, test.name)
+		c.Assert(arch, gc.Equals, test.arch)
+		c.Assert(charm.ArchiveFileName(name, arch), gc.Equals, test.filename)
+	}
+}
+
+// archCharm returns a copy of the dummy charm holding a payload
+// tree for each of the given architectures and an architecture
+// specific build of src/hello.c.
+func archCharm(c *gc.C, archs ...string) *charm.CharmDir {
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	for _, arch := range archs {
+		dir := filepath.Join(path, "arch", arch, "bin")
+		c.Assert(os.MkdirAll(dir, 0755), gc.IsNil)
+		err := ioutil.WriteFile(filepath.Join(dir, "tool"), []byte("tool for "+arch), 0755)
+		c.Assert(err, gc.IsNil)
+	}
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	return dir
+}
+
+func (s *ArchSuite) archive(c *gc.C, dir *charm.CharmDir, arch string) *charm.CharmArchive {
+	var buf bytes.Buffer
+	err := dir.ArchiveToWithOptions(&buf, charm.ArchiveOptions{Architecture: arch})
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	return archive
+}
+
+func (s *ArchSuite) TestArchiveForArchitecture(c *gc.C) {
+	dir := archCharm(c, "amd64", "arm64")
+	archive := s.archive(c, dir, "amd64")
+	manifest, err := archive.Manifest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(manifest.Contains("arch/amd64/bin/tool"), jc.IsTrue)
+	c.Assert(manifest.Contains("arch/arm64/bin/tool"), jc.IsFalse)
+
+	var buf bytes.Buffer
+	err = dir.ArchiveToWithOptions(&buf, charm.ArchiveOptions{Architecture: "sparc"})
+	c.Assert(err, gc.ErrorMatches, `unknown architecture "sparc"`)
+}
+
+func (s *ArchSuite) TestMergeArchitectures(c *gc.C) {
+	dir := archCharm(c, "amd64", "arm64")
+	amd64 := s.archive(c, dir, "amd64")
+	// Make a file that differs between the architectures.
+	err := ioutil.WriteFile(filepath.Join(dir.Path, "src", "hello.c"), []byte("arm64 hello"), 0644)
+	c.Assert(err, gc.IsNil)
+	arm64 := s.archive(c, dir, "arm64")
+
+	var buf bytes.Buffer
+	err = charm.MergeArchitectures(&buf, map[string]*charm.CharmArchive{
+		"amd64": amd64,
+		"arm64": arm64,
+	})
+	c.Assert(err, gc.IsNil)
+	merged, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	c.Assert(merged.Meta().Name, gc.Equals, "dummy")
+	c.Assert(merged.Revision(), gc.Equals, amd64.Revision())
+
+	archManifest, err := charm.ReadArchitectureManifest(merged)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archManifest, jc.DeepEquals, charm.ArchitectureManifest{
+		"amd64": {"src/hello.c", "bin/", "bin/tool"},
+		"arm64": {"src/hello.c", "bin/", "bin/tool"},
+	})
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		expandDir := c.MkDir()
+		err := merged.ExpandToArchitecture(expandDir, arch)
+		c.Assert(err, gc.IsNil)
+		data, err := ioutil.ReadFile(filepath.Join(expandDir, "bin", "tool"))
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(data), gc.Equals, "tool for "+arch)
+		data, err = ioutil.ReadFile(filepath.Join(expandDir, "src", "hello.c"))
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(data) == "arm64 hello", gc.Equals, arch == "arm64")
+		_, err = os.Stat(filepath.Join(expandDir, "arch"))
+		c.Assert(os.IsNotExist(err), jc.IsTrue)
+		_, err = os.Stat(filepath.Join(expandDir, "architectures.yaml"))
+		c.Assert(os.IsNotExist(err), jc.IsTrue)
+		_, err = os.Stat(filepath.Join(expandDir, "metadata.yaml"))
+		c.Assert(err, gc.IsNil)
+	}
+
+	err = merged.ExpandToArchitecture(c.MkDir(), "s390x")
+	c.Assert(err, gc.ErrorMatches, `charm "dummy" does not support architecture "s390x"`)
+}
+
+func (s *ArchSuite) TestExpandToArchitectureSingle(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	archManifest, err := charm.ReadArchitectureManifest(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archManifest, gc.IsNil)
+	expandDir := c.MkDir()
+	err = archive.ExpandToArchitecture(expandDir, "amd64")
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(filepath.Join(expandDir, "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *ArchSuite) TestMergeArchitecturesErrors(c *gc.C) {
+	dir := archCharm(c, "amd64", "arm64")
+	amd64 := s.archive(c, dir, "amd64")
+
+	var buf bytes.Buffer
+	err := charm.MergeArchitectures(&buf, nil)
+	c.Assert(err, gc.ErrorMatches, "no archives to merge")
+
+	err = charm.MergeArchitectures(&buf, map[string]*charm.CharmArchive{"sparc": amd64})
+	c.Assert(err, gc.ErrorMatches, `cannot merge archives: unknown architecture "sparc"`)
+
+	err = charm.MergeArchitectures(&buf, map[string]*charm.CharmArchive{"arm64": amd64})
+	c.Assert(err, gc.ErrorMatches, `cannot merge archives: arm64 archive holds "arch/amd64/"`)
+
+	other := charmtesting.Charms.CharmArchive(c.MkDir(), "varnish")
+	err = charm.MergeArchitectures(&buf, map[string]*charm.CharmArchive{"amd64": amd64, "arm64": other})
+	c.Assert(err, gc.ErrorMatches, `cannot merge archives: arm64 archive holds varnish-\d+, not dummy-\d+`)
+
+	dir.SetRevision(amd64.Revision())
+	err = ioutil.WriteFile(filepath.Join(dir.Path, "metadata.yaml"), []byte("name: dummy\nsummary: other\ndescription: other\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	dir, err = charm.ReadCharmDir(dir.Path)
+	c.Assert(err, gc.IsNil)
+	err = charm.MergeArchitectures(&buf, map[string]*charm.CharmArchive{"amd64": amd64, "arm64": s.archive(c, dir, "arm64")})
+	c.Assert(err, gc.ErrorMatches, `cannot merge archives: metadata differs between architectures`)
+}
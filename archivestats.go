@@ -0,0 +1,178 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ArchiveStats holds statistics about the contents of a
+// charm archive.
+type ArchiveStats struct {
+	// Files holds the number of files in the archive, not
+	// counting directories or the annotations file, which
+	// is left out of all the statistics so that annotations
+	// can be added without changing them.
+	Files int `json:"files"`
+
+	// Size holds the total uncompressed size of the files.
+	Size int64 `json:"size"`
+
+	// ContentSHA256 holds the hex-encoded SHA256 digest of the
+	// names and contents of the files, in archive order. Unlike the
+	// digest of the archive itself, it does not change when the
+	// archive is recompressed.
+	ContentSHA256 string `json:"content-sha256"`
+}
+
+// archiveStatsPrefix prefixes the statistics stored in the comment
+// of archives written by ArchiveTo.
+const archiveStatsPrefix = "juju-charm-stats "
+
+// statsWriter accumulates the statistics of an
+// archive as its files are written.
+type statsWriter struct {
+	stats ArchiveStats
+	hash  hash.Hash
+}
+
+func newStatsWriter() *statsWriter {
+	return &statsWriter{hash: sha256.New()}
+}
+
+// addFile records the start of the file with the given name,
+// returning a writer that records its contents. Annotations
+// are not counted.
+func (sw *statsWriter) addFile(name string) io.Writer {
+	if name == annotationsFile {
+		return ioutil.Discard
+	}
+	sw.stats.Files++
+	io.WriteString(sw.hash, name)
+	sw.hash.Write([]byte{0})
+	return statsCounter{sw}
+}
+
+type statsCounter struct {
+	sw *statsWriter
+}
+
+func (c statsCounter) Write(data []byte) (int, error) {
+	c.sw.stats.Size += int64(len(data))
+	return c.sw.hash.Write(data)
+}
+
+// result returns the accumulated statistics.
+func (sw *statsWriter) result() ArchiveStats {
+	stats := sw.stats
+	stats.ContentSHA256 = hex.EncodeToString(sw.hash.Sum(nil))
+	return stats
+}
+
+// comment returns the archive comment recording
+// the accumulated statistics.
+func (sw *statsWriter) comment() string {
+	data, err := json.Marshal(sw.result())
+	if err != nil {
+		panic(err)
+	}
+	return archiveStatsPrefix + string(data)
+}
+
+// parseArchiveStats returns the statistics recorded in the given
+// archive comment, or nil if it does not hold any.
+func parseArchiveStats(comment string) *ArchiveStats {
+	if !strings.HasPrefix(comment, archiveStatsPrefix) {
+		return nil
+	}
+	var stats ArchiveStats
+	if err := json.Unmarshal([]byte(comment[len(archiveStatsPrefix):]), &stats); err != nil {
+		logger.Warningf("ignoring invalid archive statistics %q", comment)
+		return nil
+	}
+	return &stats
+}
+
+// recordedArchiveStats returns the statistics recorded in the comment
+// of the given archive, or nil if it holds none. As the comment may have
+// been written by anyone, the recorded file count and size are checked
+// against the archive's central directory, and the statistics are
+// ignored if they disagree. The recorded content digest cannot be
+// checked without reading every file, and is not.
+func recordedArchiveStats(zipr *zip.Reader) *ArchiveStats {
+	stats := parseArchiveStats(zipr.Comment)
+	if stats == nil {
+		return nil
+	}
+	files, size := 0, int64(0)
+	for _, fh := range zipr.File {
+		if fh.Mode().IsDir() || fh.Name == annotationsFile {
+			continue
+		}
+		files++
+		size += int64(fh.UncompressedSize64)
+	}
+	if stats.Files != files || stats.Size != size {
+		logger.Warningf("ignoring archive statistics that do not match its contents")
+		return nil
+	}
+	return stats
+}
+
+// Stats returns statistics about the contents of the archive. Archives
+// written by ArchiveTo record their statistics in the archive comment,
+// which is read by ReadCharmArchive, so that Stats need not read the
+// archive; for other archives they are computed from its contents.
+//
+// The file count and size are always those of the archive's files, but
+// a recorded ContentSHA256 is whatever the archive claims, and is not
+// checked: it can be relied upon only when the archive itself is
+// trusted. Use ComputeStats to obtain a digest of an untrusted archive.
+func (a *CharmArchive) Stats() (*ArchiveStats, error) {
+	if a.stats != nil {
+		stats := *a.stats
+		return &stats, nil
+	}
+	return a.ComputeStats()
+}
+
+// ComputeStats is like Stats except that it always computes
+// the statistics from the contents of the archive, ignoring any
+// that are recorded in it, so that recorded statistics can be
+// checked.
+func (a *CharmArchive) ComputeStats() (*ArchiveStats, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	sw := newStatsWriter()
+	for _, fh := range zipr.File {
+		if fh.Mode().IsDir() {
+			continue
+		}
+		if err := copyStats(sw, fh); err != nil {
+			return nil, err
+		}
+	}
+	stats := sw.result()
+	return &stats, nil
+}
+
+func copyStats(sw *statsWriter, fh *zip.File) error {
+	r, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(sw.addFile(fh.Name), r)
+	return err
+}
@@ -0,0 +1,142 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ArchiveStatsSuite struct{}
+
+var _ = gc.Suite(&ArchiveStatsSuite{})
+
+func (s *ArchiveStatsSuite) TestStatsRecordedByArchiveTo(c *gc.C) {
+	dir := charmtesting.Charms.CharmDir("dummy")
+	var buf bytes.Buffer
+	err := dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+
+	zipr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, gc.IsNil)
+	c.Assert(strings.HasPrefix(zipr.Comment, "juju-charm-stats {"), jc.IsTrue)
+	files, size := 0, int64(0)
+	for _, fh := range zipr.File {
+		if !fh.Mode().IsDir() {
+			files++
+			size += int64(fh.UncompressedSize64)
+		}
+	}
+
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	stats, err := archive.Stats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(stats.Files, gc.Equals, files)
+	c.Assert(stats.Size, gc.Equals, size)
+	c.Assert(stats.ContentSHA256, gc.HasLen, 64)
+
+	computed, err := archive.ComputeStats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(computed, jc.DeepEquals, stats)
+}
+
+func (s *ArchiveStatsSuite) TestStatsWithoutComment(c *gc.C) {
+	dir := charmtesting.Charms.CharmDir("dummy")
+	var buf bytes.Buffer
+	err := dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	expect, err := archive.Stats()
+	c.Assert(err, gc.IsNil)
+
+	// Rewriting the archive with a different compression level
+	// drops the comment but keeps the content digest.
+	rewritten := rewriteArchive(c, buf.Bytes(), zip.Store, "")
+	c.Assert(bytes.Equal(rewritten, buf.Bytes()), jc.IsFalse)
+	archive, err = charm.ReadCharmArchiveBytes(rewritten)
+	c.Assert(err, gc.IsNil)
+	stats, err := archive.Stats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(stats, jc.DeepEquals, expect)
+}
+
+func (s *ArchiveStatsSuite) TestInvalidComment(c *gc.C) {
+	dir := charmtesting.Charms.CharmDir("dummy")
+	var buf bytes.Buffer
+	err := dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	data := rewriteArchive(c, buf.Bytes(), zip.Deflate, "juju-charm-stats {bad")
+	archive, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	stats, err := archive.Stats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(stats.Files > 0, jc.IsTrue)
+}
+
+func (s *ArchiveStatsSuite) TestCommentCheckedAgainstContents(c *gc.C) {
+	dir := charmtesting.Charms.CharmDir("dummy")
+	var buf bytes.Buffer
+	err := dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	expect, err := archive.ComputeStats()
+	c.Assert(err, gc.IsNil)
+
+	// Statistics that disagree with the archive's files are ignored.
+	comment := fmt.Sprintf(`juju-charm-stats {"files":%d,"size":1,"content-sha256":"bogus"}`, expect.Files)
+	archive, err = charm.ReadCharmArchiveBytes(rewriteArchive(c, buf.Bytes(), zip.Deflate, comment))
+	c.Assert(err, gc.IsNil)
+	stats, err := archive.Stats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(stats, jc.DeepEquals, expect)
+
+	// A recorded digest is not checked, but ComputeStats
+	// always computes it.
+	comment = fmt.Sprintf(`juju-charm-stats {"files":%d,"size":%d,"content-sha256":"bogus"}`, expect.Files, expect.Size)
+	archive, err = charm.ReadCharmArchiveBytes(rewriteArchive(c, buf.Bytes(), zip.Deflate, comment))
+	c.Assert(err, gc.IsNil)
+	stats, err = archive.Stats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(stats.ContentSHA256, gc.Equals, "bogus")
+	stats, err = archive.ComputeStats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(stats, jc.DeepEquals, expect)
+}
+
+// rewriteArchive returns a copy of the given archive with its
+// files stored with the given method and the given comment.
+func rewriteArchive(c *gc.C, data []byte, method uint16, comment string) []byte {
+	zipr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	for _, fh := range zipr.File {
+		h := fh.FileHeader
+		h.Method = method
+		w, err := zipw.CreateHeader(&h)
+		c.Assert(err, gc.IsNil)
+		r, err := fh.Open()
+		c.Assert(err, gc.IsNil)
+		content, err := ioutil.ReadAll(r)
+		c.Assert(err, gc.IsNil)
+		r.Close()
+		_, err = w.Write(content)
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(zipw.SetComment(comment), gc.IsNil)
+	c.Assert(zipw.Close(), gc.IsNil)
+	return buf.Bytes()
+}
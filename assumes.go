@@ -0,0 +1,240 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/schema"
+)
+
+// AssumesExpression describes a feature, such as a hook tool, that
+// a charm assumes is provided by the agent running it, as declared
+// under "assumes" in its metadata. Each is a single feature, such
+// as "network-get", or a composite expression satisfied when any or
+// all of the expressions it holds are satisfied, written as:
+//
+//	assumes:
+//	  - network-get
+//	  - any-of:
+//	    - leader-set
+//	    - state-set
+type AssumesExpression struct {
+	// Feature holds the name of the assumed feature.
+	// It is empty for composite expressions.
+	Feature string
+
+	// AnyOf holds the expressions of an any-of expression.
+	AnyOf []AssumesExpression
+
+	// AllOf holds the expressions of an all-of expression.
+	AllOf []AssumesExpression
+}
+
+// SatisfiedBy reports whether the expression is satisfied by
+// the given set of provided features.
+func (e AssumesExpression) SatisfiedBy(features map[string]bool) bool {
+	switch {
+	case e.Feature != "":
+		return features[e.Feature]
+	case e.AnyOf != nil:
+		for _, sub := range e.AnyOf {
+			if sub.SatisfiedBy(features) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, sub := range e.AllOf {
+		if !sub.SatisfiedBy(features) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a compact representation of the expression,
+// such as "any-of(leader-set, state-set)".
+func (e AssumesExpression) String() string {
+	if e.Feature != "" {
+		return e.Feature
+	}
+	kind, subs := "all-of", e.AllOf
+	if e.AnyOf != nil {
+		kind, subs = "any-of", e.AnyOf
+	}
+	strs := make([]string, len(subs))
+	for i, sub := range subs {
+		strs[i] = sub.String()
+	}
+	return kind + "(" + strings.Join(strs, ", ") + ")"
+}
+
+// CheckAssumes returns an error naming the expressions in the
+// charm's assumes declaration that are not satisfied by the given
+// features, so that agents that lack the features can refuse
+// to run the charm.
+func (meta Meta) CheckAssumes(features []string) error {
+	provided := make(map[string]bool)
+	for _, f := range features {
+		provided[f] = true
+	}
+	var missing []string
+	for _, e := range meta.Assumes {
+		if !e.SatisfiedBy(provided) {
+			missing = append(missing, e.String())
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("charm %q assumes unavailable features: %s", meta.Name, strings.Join(missing, ", "))
+}
+
+// KnownHookTools holds the names of the hook tools that
+// charms may declare that they assume.
+var KnownHookTools = []string{
+	"action-fail",
+	"action-get",
+	"action-set",
+	"add-metric",
+	"close-port",
+	"config-get",
+	"is-leader",
+	"juju-log",
+	"juju-reboot",
+	"leader-get",
+	"leader-set",
+	"network-get",
+	"open-port",
+	"opened-ports",
+	"relation-get",
+	"relation-ids",
+	"relation-list",
+	"relation-set",
+	"state-get",
+	"state-set",
+	"status-get",
+	"status-set",
+	"storage-get",
+	"unit-get",
+}
+
+// UnknownAssumedFeatures returns the names of the features assumed by
+// the charm that are not in KnownHookTools, sorted and without
+// duplicates, so that typing mistakes can be reported.
+func (meta Meta) UnknownAssumedFeatures() []string {
+	known := make(map[string]bool)
+	for _, tool := range KnownHookTools {
+		known[tool] = true
+	}
+	unknown := make(map[string]bool)
+	var walk func(exprs []AssumesExpression)
+	walk = func(exprs []AssumesExpression) {
+		for _, e := range exprs {
+			if e.Feature != "" && !known[e.Feature] {
+				unknown[e.Feature] = true
+			}
+			walk(e.AnyOf)
+			walk(e.AllOf)
+		}
+	}
+	walk(meta.Assumes)
+	var names []string
+	for name := range unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// encodeAssumes returns the metadata.yaml representation
+// of the given expressions.
+func encodeAssumes(exprs []AssumesExpression) []interface{} {
+	result := make([]interface{}, len(exprs))
+	for i, e := range exprs {
+		switch {
+		case e.Feature != "":
+			result[i] = e.Feature
+		case e.AnyOf != nil:
+			result[i] = map[string]interface{}{"any-of": encodeAssumes(e.AnyOf)}
+		default:
+			result[i] = map[string]interface{}{"all-of": encodeAssumes(e.AllOf)}
+		}
+	}
+	return result
+}
+
+var validFeature = regexp.MustCompile("^[a-z][a-z0-9]*(-[a-z0-9]+)*$")
+
+// assumesC coerces the assumes field of the metadata
+// into a []AssumesExpression.
+type assumesC struct{}
+
+var assumesListC = schema.List(schema.Any())
+
+func (c assumesC) Coerce(v interface{}, path []string) (interface{}, error) {
+	list, err := assumesListC.Coerce(v, path)
+	if err != nil {
+		return nil, err
+	}
+	exprs := make([]AssumesExpression, len(list.([]interface{})))
+	for i, item := range list.([]interface{}) {
+		itemPath := append(path[:len(path):len(path)], "[", strconv.Itoa(i), "]")
+		exprs[i], err = coerceAssumesExpression(item, itemPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return exprs, nil
+}
+
+func coerceAssumesExpression(v interface{}, path []string) (AssumesExpression, error) {
+	if s, ok := v.(string); ok {
+		if !validFeature.MatchString(s) {
+			return AssumesExpression{}, fmt.Errorf("%sinvalid feature %q", schemaPathPrefix(path), s)
+		}
+		return AssumesExpression{Feature: s}, nil
+	}
+	m, err := mapC.Coerce(v, path)
+	if err != nil {
+		return AssumesExpression{}, fmt.Errorf("%sexpected feature name or any-of or all-of expression, got %T(%#v)", schemaPathPrefix(path), v, v)
+	}
+	if len(m.(map[string]interface{})) != 1 {
+		return AssumesExpression{}, fmt.Errorf("%sexpected a single any-of or all-of expression", schemaPathPrefix(path))
+	}
+	var kind string
+	var subs interface{}
+	for k, v := range m.(map[string]interface{}) {
+		kind, subs = k, v
+	}
+	if kind != "any-of" && kind != "all-of" {
+		return AssumesExpression{}, fmt.Errorf("%sunknown expression %q", schemaPathPrefix(path), kind)
+	}
+	subExprs, err := assumesC{}.Coerce(subs, append(path, ".", kind))
+	if err != nil {
+		return AssumesExpression{}, err
+	}
+	if kind == "any-of" {
+		return AssumesExpression{AnyOf: subExprs.([]AssumesExpression)}, nil
+	}
+	return AssumesExpression{AllOf: subExprs.([]AssumesExpression)}, nil
+}
+
+// schemaPathPrefix returns the given schema path in the form
+// used to prefix schema errors, such as "assumes[1]: ".
+func schemaPathPrefix(path []string) string {
+	if len(path) > 0 && path[0] == "." {
+		path = path[1:]
+	}
+	s := strings.Join(path, "")
+	if s == "" {
+		return ""
+	}
+	return s + ": "
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type AssumesSuite struct{}
+
+var _ = gc.Suite(&AssumesSuite{})
+
+const assumesMeta = `
+name: assuming
+summary: s
+description: d
+assumes:
+  - network-get
+  - any-of:
+    - leader-set
+    - state-set
+  - all-of:
+    - status-set
+    - any-of: [action-get, frobnicate]
+`
+
+func (s *AssumesSuite) TestReadMetaAssumes(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(assumesMeta))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Assumes, jc.DeepEquals, []charm.AssumesExpression{
+		{Feature: "network-get"},
+		{AnyOf: []charm.AssumesExpression{{Feature: "leader-set"}, {Feature: "state-set"}}},
+		{AllOf: []charm.AssumesExpression{
+			{Feature: "status-set"},
+			{AnyOf: []charm.AssumesExpression{{Feature: "action-get"}, {Feature: "frobnicate"}}},
+		}},
+	})
+	c.Assert(meta.UnknownAssumedFeatures(), jc.DeepEquals, []string{"frobnicate"})
+	c.Assert(meta.Assumes[2].String(), gc.Equals, "all-of(status-set, any-of(action-get, frobnicate))")
+}
+
+func (s *AssumesSuite) TestReadMetaNoAssumes(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader("name: a\nsummary: s\ndescription: d\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Assumes, gc.IsNil)
+	c.Assert(meta.CheckAssumes(nil), gc.IsNil)
+}
+
+func (s *AssumesSuite) TestCheckAssumes(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(assumesMeta))
+	c.Assert(err, gc.IsNil)
+
+	err = meta.CheckAssumes([]string{"network-get", "state-set", "status-set", "action-get"})
+	c.Assert(err, gc.IsNil)
+
+	err = meta.CheckAssumes([]string{"leader-set", "status-set"})
+	c.Assert(err, gc.ErrorMatches, `charm "assuming" assumes unavailable features: network-get, all-of\(status-set, any-of\(action-get, frobnicate\)\)`)
+}
+
+var assumesErrorTests = []struct {
+	assumes string
+	err     string
+}{{
+	assumes: "network-get",
+	err:     `metadata: .*assumes: expected list, got string\("network-get"\)`,
+}, {
+	assumes: "[Network-Get]",
+	err:     `metadata: .*assumes\[0\]: invalid feature "Network-Get"`,
+}, {
+	assumes: "[42]",
+	err:     `metadata: .*assumes\[0\]: expected feature name or any-of or all-of expression, got int\(42\)`,
+}, {
+	assumes: "[{one-of: [a, b]}]",
+	err:     `metadata: .*assumes\[0\]: unknown expression "one-of"`,
+}, {
+	assumes: "[{any-of: [a], all-of: [b]}]",
+	err:     `metadata: .*assumes\[0\]: expected a single any-of or all-of expression`,
+}, {
+	assumes: "[a, {any-of: [b, c_d]}]",
+	err:     `metadata: .*assumes\[1\]\.any-of\[1\]: invalid feature "c_d"`,
+}}
+
+func (s *AssumesSuite) TestReadMetaAssumesErrors(c *gc.C) {
+	for i, test := range assumesErrorTests {
+		c.Logf("test %d: %s", i, test.assumes)
+		_, err := charm.ReadMeta(strings.NewReader("name: a\nsummary: s\ndescription: d\nassumes: " + test.assumes + "\n"))
+		c.Assert(err, gc.ErrorMatches, `(?s)`+test.err+`.*`)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"sync"
+	"time"
+)
+
+// Audited operations.
+const (
+	// AuditRead records the reading of a charm
+	// archive or directory.
+	AuditRead = "read"
+
+	// AuditExpand records the expansion of a charm
+	// archive into a directory.
+	AuditExpand = "expand"
+
+	// AuditArchive records the archiving of a
+	// charm directory.
+	AuditArchive = "archive"
+
+	// AuditSign records the writing of a provenance
+	// record for signing by WriteProvenance.
+	AuditSign = "sign"
+
+	// AuditVerify records the verification of a charm
+	// by Verify or VerifyProvenance.
+	AuditVerify = "verify"
+)
+
+// AuditRecord records an operation on a charm.
+type AuditRecord struct {
+	// Time holds when the operation completed.
+	Time time.Time `json:"time"`
+
+	// Actor identifies who performed the operation,
+	// as given by Auditor.Actor.
+	Actor string `json:"actor"`
+
+	// Op holds the operation, such as AuditRead.
+	Op string `json:"op"`
+
+	// Path holds the path of the charm archive or
+	// directory operated on, or the directory an archive
+	// was expanded into, if known.
+	Path string `json:"path,omitempty"`
+
+	// Charm and Revision hold the name and
+	// revision of the charm, if known.
+	Charm    string `json:"charm,omitempty"`
+	Revision int    `json:"revision,omitempty"`
+
+	// SHA256 holds the hex-encoded SHA256 digest of the
+	// charm archive read, expanded, written or verified.
+	// It is empty for charm directories.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Error holds the error that caused the
+	// operation to fail, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink is implemented by types that store audit records.
+type AuditSink interface {
+	Record(r AuditRecord) error
+}
+
+// Auditor holds the details used to record operations on charms.
+type Auditor struct {
+	// Actor identifies who performs the operations,
+	// such as a user or service name.
+	Actor string
+
+	// Sink receives the audit records. Errors returned by it
+	// are logged but do not cause the operations to fail.
+	Sink AuditSink
+}
+
+var (
+	auditorMu sync.Mutex
+	auditor   *Auditor
+)
+
+// SetAuditor sets the Auditor used to record operations on charms,
+// returning the previous one. If a is nil, as it is by default, no
+// records are made.
+func SetAuditor(a *Auditor) *Auditor {
+	auditorMu.Lock()
+	defer auditorMu.Unlock()
+	old := auditor
+	auditor = a
+	return old
+}
+
+func currentAuditor() *Auditor {
+	auditorMu.Lock()
+	defer auditorMu.Unlock()
+	return auditor
+}
+
+// auditing reports whether operations are being recorded,
+// so that callers can avoid computing digests otherwise.
+func auditing() bool {
+	return currentAuditor() != nil
+}
+
+// audit records the outcome of an operation on the given charm,
+// which may be nil if the operation failed. If digest is not nil,
+// it is called to find the digest of the archive concerned.
+func audit(op, path string, ch Charm, digest func() (string, error), err error) {
+	a := currentAuditor()
+	if a == nil {
+		return
+	}
+	r := AuditRecord{
+		Time:  time.Now().UTC(),
+		Actor: a.Actor,
+		Op:    op,
+		Path:  path,
+	}
+	if ch != nil {
+		r.Charm = ch.Meta().Name
+		r.Revision = ch.Revision()
+	}
+	if digest != nil {
+		if d, derr := digest(); derr == nil {
+			r.SHA256 = d
+		} else if err == nil {
+			err = derr
+		}
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := a.Sink.Record(r); err != nil {
+		logger.Errorf("cannot record %s of charm at %q: %v", op, path, err)
+	}
+}
+
+// auditRead records the reading of the given archive,
+// which is nil if err is not.
+func auditRead(a *CharmArchive, path string, err error) {
+	if err != nil {
+		audit(AuditRead, path, nil, nil, err)
+		return
+	}
+	audit(AuditRead, path, a, archiveSHA256(a), nil)
+}
+
+// auditVerify records the verification of the given charm,
+// which must be a *CharmDir or a *CharmArchive.
+func auditVerify(ch Charm, err error) {
+	switch ch := ch.(type) {
+	case *CharmDir:
+		audit(AuditVerify, ch.Path, ch, nil, err)
+	case *CharmArchive:
+		audit(AuditVerify, ch.Path, ch, archiveSHA256(ch), err)
+	default:
+		audit(AuditVerify, "", nil, nil, err)
+	}
+}
+
+// archiveSHA256 returns a function that returns the
+// SHA256 digest of the given archive.
+func archiveSHA256(a *CharmArchive) func() (string, error) {
+	return func() (string, error) {
+		r, err := a.zopen.open()
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+}
+
+// auditArchiveTo calls write to write an archive of the charm
+// directory to w, recording the operation.
+func (dir *CharmDir) auditArchiveTo(w io.Writer, write func(w io.Writer) error) error {
+	if !auditing() {
+		return write(w)
+	}
+	h := sha256.New()
+	err := write(io.MultiWriter(w, h))
+	audit(AuditArchive, dir.Path, dir, hashDigest(h, err), err)
+	return err
+}
+
+// hashDigest returns a function that returns the digest
+// held in h, or nil if err is not nil.
+func hashDigest(h hash.Hash, err error) func() (string, error) {
+	if err != nil {
+		return nil
+	}
+	return func() (string, error) {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+}
+
+// JSONAuditSink is an AuditSink that writes each record
+// as a line of JSON to an io.Writer.
+type JSONAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONAuditSink returns a JSONAuditSink writing to w.
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	return &JSONAuditSink{w: w}
+}
+
+// Record implements AuditSink.Record.
+func (s *JSONAuditSink) Record(r AuditRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
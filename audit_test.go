@@ -0,0 +1,178 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type AuditSuite struct {
+	records []charm.AuditRecord
+}
+
+var _ = gc.Suite(&AuditSuite{})
+
+func (s *AuditSuite) SetUpTest(c *gc.C) {
+	s.records = nil
+	charm.SetAuditor(&charm.Auditor{
+		Actor: "tester",
+		Sink:  s,
+	})
+}
+
+func (s *AuditSuite) TearDownTest(c *gc.C) {
+	charm.SetAuditor(nil)
+}
+
+// Record implements charm.AuditSink.
+func (s *AuditSuite) Record(r charm.AuditRecord) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+// ops returns the operations recorded, with the times checked
+// and cleared.
+func (s *AuditSuite) ops(c *gc.C) []charm.AuditRecord {
+	records := s.records
+	s.records = nil
+	for i := range records {
+		c.Assert(time.Since(records[i].Time) < time.Minute, jc.IsTrue)
+		records[i].Time = time.Time{}
+	}
+	return records
+}
+
+func fileSHA256(c *gc.C, path string) string {
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *AuditSuite) TestAuditArchiveOperations(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	digest := fileSHA256(c, path)
+	s.records = nil
+
+	archive, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	expandDir := c.MkDir()
+	err = archive.ExpandTo(expandDir)
+	c.Assert(err, gc.IsNil)
+	err = archive.Verify()
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.ops(c), jc.DeepEquals, []charm.AuditRecord{{
+		Actor:    "tester",
+		Op:       charm.AuditRead,
+		Path:     path,
+		Charm:    "dummy",
+		Revision: archive.Revision(),
+		SHA256:   digest,
+	}, {
+		Actor:    "tester",
+		Op:       charm.AuditExpand,
+		Path:     expandDir,
+		Charm:    "dummy",
+		Revision: archive.Revision(),
+		SHA256:   digest,
+	}, {
+		Actor:    "tester",
+		Op:       charm.AuditVerify,
+		Path:     path,
+		Charm:    "dummy",
+		Revision: archive.Revision(),
+		SHA256:   digest,
+	}})
+
+	_, err = charm.ReadCharmArchiveBytes([]byte("invalid"))
+	c.Assert(err, gc.NotNil)
+	c.Assert(s.ops(c), jc.DeepEquals, []charm.AuditRecord{{
+		Actor: "tester",
+		Op:    charm.AuditRead,
+		Error: err.Error(),
+	}})
+}
+
+func (s *AuditSuite) TestAuditDirOperations(c *gc.C) {
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	err = dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	sum := sha256.Sum256(buf.Bytes())
+	_, err = dir.WriteProvenance(charm.Provenance{BuilderId: "test"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.ops(c), jc.DeepEquals, []charm.AuditRecord{{
+		Actor:    "tester",
+		Op:       charm.AuditRead,
+		Path:     path,
+		Charm:    "dummy",
+		Revision: dir.Revision(),
+	}, {
+		Actor:    "tester",
+		Op:       charm.AuditArchive,
+		Path:     path,
+		Charm:    "dummy",
+		Revision: dir.Revision(),
+		SHA256:   hex.EncodeToString(sum[:]),
+	}, {
+		Actor:    "tester",
+		Op:       charm.AuditSign,
+		Path:     path,
+		Charm:    "dummy",
+		Revision: dir.Revision(),
+	}})
+}
+
+func (s *AuditSuite) TestNoAuditor(c *gc.C) {
+	old := charm.SetAuditor(nil)
+	c.Assert(old, gc.NotNil)
+	_, err := charm.ReadCharmDir(charmtesting.Charms.CharmDirPath("dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.records, gc.HasLen, 0)
+}
+
+type failingSink struct{}
+
+func (failingSink) Record(charm.AuditRecord) error {
+	return fmt.Errorf("sink is full")
+}
+
+func (s *AuditSuite) TestSinkErrorsDoNotFailOperations(c *gc.C) {
+	charm.SetAuditor(&charm.Auditor{Actor: "tester", Sink: failingSink{}})
+	_, err := charm.ReadCharmDir(charmtesting.Charms.CharmDirPath("dummy"))
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *AuditSuite) TestJSONAuditSink(c *gc.C) {
+	var buf bytes.Buffer
+	sink := charm.NewJSONAuditSink(&buf)
+	r := charm.AuditRecord{
+		Time:     time.Date(2014, 10, 1, 12, 0, 0, 0, time.UTC),
+		Actor:    "tester",
+		Op:       charm.AuditRead,
+		Charm:    "dummy",
+		Revision: 1,
+	}
+	c.Assert(sink.Record(r), gc.IsNil)
+	c.Assert(sink.Record(r), gc.IsNil)
+	line := `{"time":"2014-10-01T12:00:00Z","actor":"tester","op":"read","charm":"dummy","revision":1}` + "\n"
+	c.Assert(buf.String(), gc.Equals, line+line)
+	var decoded charm.AuditRecord
+	c.Assert(json.Unmarshal([]byte(line), &decoded), gc.IsNil)
+	c.Assert(decoded, jc.DeepEquals, r)
+}
@@ -0,0 +1,307 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juju/schema"
+)
+
+// Base describes a platform a charm can run on: an operating system,
+// a channel of that operating system, usually its version, and
+// optionally an architecture. Its string form is "os@channel" or
+// "os@channel/arch", as in "ubuntu@14.04/amd64".
+type Base struct {
+	OS      string
+	Channel string
+	Arch    string
+}
+
+var (
+	validBaseOS      = regexp.MustCompile("^[a-z]+$")
+	validBaseChannel = regexp.MustCompile("^[a-z0-9]+([.-][a-z0-9]+)*$")
+)
+
+// knownArchitectures holds the architectures a base may specify.
+var knownArchitectures = map[string]bool{
+	"amd64":   true,
+	"arm64":   true,
+	"armhf":   true,
+	"i386":    true,
+	"ppc64el": true,
+	"s390x":   true,
+}
+
+// seriesBases holds the Ubuntu base corresponding to each known series.
+var seriesBases = map[string]Base{
+	"precise": {OS: "ubuntu", Channel: "12.04"},
+	"quantal": {OS: "ubuntu", Channel: "12.10"},
+	"raring":  {OS: "ubuntu", Channel: "13.04"},
+	"saucy":   {OS: "ubuntu", Channel: "13.10"},
+	"trusty":  {OS: "ubuntu", Channel: "14.04"},
+	"utopic":  {OS: "ubuntu", Channel: "14.10"},
+	"vivid":   {OS: "ubuntu", Channel: "15.04"},
+}
+
+// ParseBase parses a base in the form returned by Base.String.
+func ParseBase(s string) (Base, error) {
+	var b Base
+	rest := s
+	if i := strings.Index(rest, "/"); i >= 0 {
+		rest, b.Arch = rest[:i], rest[i+1:]
+	}
+	i := strings.Index(rest, "@")
+	if i < 0 {
+		return Base{}, fmt.Errorf("invalid base %q: expected os@channel", s)
+	}
+	b.OS, b.Channel = rest[:i], rest[i+1:]
+	if err := b.Validate(); err != nil {
+		return Base{}, fmt.Errorf("invalid base %q: %v", s, err)
+	}
+	return b, nil
+}
+
+// MustParseBase is like ParseBase except that it panics on error.
+func MustParseBase(s string) Base {
+	b, err := ParseBase(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Validate returns an error if the base is not valid.
+func (b Base) Validate() error {
+	if !validBaseOS.MatchString(b.OS) {
+		return fmt.Errorf("invalid operating system %q", b.OS)
+	}
+	if !validBaseChannel.MatchString(b.Channel) {
+		return fmt.Errorf("invalid channel %q", b.Channel)
+	}
+	if b.Arch != "" && !knownArchitectures[b.Arch] {
+		return fmt.Errorf("unknown architecture %q", b.Arch)
+	}
+	return nil
+}
+
+// String returns the base in the form "os@channel/arch",
+// leaving out the architecture if it is not set.
+func (b Base) String() string {
+	s := b.OS + "@" + b.Channel
+	if b.Arch != "" {
+		s += "/" + b.Arch
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 depending on whether b sorts before,
+// with or after other. Bases are ordered by operating system, then
+// by channel, comparing numeric channel components numerically so
+// that 9.10 sorts before 10.04, and then by architecture.
+func (b Base) Compare(other Base) int {
+	if c := compareStrings(b.OS, other.OS); c != 0 {
+		return c
+	}
+	if c := compareChannels(b.Channel, other.Channel); c != 0 {
+		return c
+	}
+	return compareStrings(b.Arch, other.Arch)
+}
+
+// compareChannels compares two channels component
+// by component.
+func compareChannels(a, b string) int {
+	as, bs := strings.FieldsFunc(a, isChannelSep), strings.FieldsFunc(b, isChannelSep)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		var c int
+		switch {
+		case aerr == nil && berr == nil:
+			c = compareInts(an, bn)
+		default:
+			c = compareStrings(as[i], bs[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(as), len(bs))
+}
+
+func isChannelSep(r rune) bool {
+	return r == '.' || r == '-'
+}
+
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Series returns the Ubuntu series corresponding to the base, such
+// as "trusty" for ubuntu@14.04, or the empty string if there is none.
+func (b Base) Series() string {
+	for series, sb := range seriesBases {
+		if sb.OS == b.OS && sb.Channel == b.Channel {
+			return series
+		}
+	}
+	return ""
+}
+
+// SeriesBase returns the base, without an architecture,
+// corresponding to the given Ubuntu series.
+func SeriesBase(series string) (Base, error) {
+	b, ok := seriesBases[series]
+	if !ok {
+		return Base{}, fmt.Errorf("unknown series %q", series)
+	}
+	return b, nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b Base) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *Base) UnmarshalText(data []byte) error {
+	parsed, err := ParseBase(string(data))
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
+
+// AllBases returns the bases the charm declares, or, if it declares
+// none, the base corresponding to its series, if it has a known
+// series. Code that used to look at Series should use AllBases
+// so that charms declaring bases are handled too.
+func (m Meta) AllBases() []Base {
+	if len(m.Bases) > 0 {
+		return m.Bases
+	}
+	if b, err := SeriesBase(m.Series); err == nil {
+		return []Base{b}
+	}
+	return nil
+}
+
+// checkSeriesBases checks that a charm declaring both a known series
+// and bases declares a base corresponding to the series, so that
+// code using the series and code using AllBases agree.
+func checkSeriesBases(series string, bases []Base) error {
+	if series == "" || len(bases) == 0 {
+		return nil
+	}
+	sb, err := SeriesBase(series)
+	if err != nil {
+		// The series is valid, but not known to this
+		// package, so it cannot be compared.
+		return nil
+	}
+	for _, b := range bases {
+		if b.OS == sb.OS && b.Channel == sb.Channel {
+			return nil
+		}
+	}
+	return fmt.Errorf("declares series %q, which corresponds to none of its bases", series)
+}
+
+// encodeBases returns the metadata.yaml representation
+// of the given bases.
+func encodeBases(bases []Base) []string {
+	result := make([]string, len(bases))
+	for i, b := range bases {
+		result[i] = b.String()
+	}
+	return result
+}
+
+// basesC coerces the bases and platforms fields of the metadata into
+// a []Base. Each entry is either a base in the form accepted by
+// ParseBase or, as written by charmcraft, a map holding the name and
+// channel of the operating system and the architectures it supports,
+// which yields a base for each architecture:
+//
+//	bases:
+//	  - ubuntu@14.04/amd64
+//	  - name: ubuntu
+//	    channel: "14.10"
+//	    architectures: [amd64, arm64]
+type basesC struct{}
+
+var (
+	basesListC = schema.List(schema.Any())
+	baseMapC   = schema.FieldMap(
+		schema.Fields{
+			"name":          schema.String(),
+			"channel":       schema.String(),
+			"architectures": schema.List(schema.String()),
+		},
+		schema.Defaults{
+			"architectures": schema.Omit,
+		},
+	)
+)
+
+func (c basesC) Coerce(v interface{}, path []string) (interface{}, error) {
+	list, err := basesListC.Coerce(v, path)
+	if err != nil {
+		return nil, err
+	}
+	var bases []Base
+	for i, item := range list.([]interface{}) {
+		itemPath := append(path[:len(path):len(path)], "[", strconv.Itoa(i), "]")
+		if s, ok := item.(string); ok {
+			b, err := ParseBase(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s%v", schemaPathPrefix(itemPath), err)
+			}
+			bases = append(bases, b)
+			continue
+		}
+		m, err := baseMapC.Coerce(item, itemPath)
+		if err != nil {
+			return nil, err
+		}
+		fields := m.(map[string]interface{})
+		b := Base{
+			OS:      fields["name"].(string),
+			Channel: fields["channel"].(string),
+		}
+		archs := []interface{}{""}
+		if a, ok := fields["architectures"]; ok {
+			archs = a.([]interface{})
+		}
+		for _, arch := range archs {
+			b.Arch = arch.(string)
+			if err := b.Validate(); err != nil {
+				return nil, fmt.Errorf("%sinvalid base %q: %v", schemaPathPrefix(itemPath), b, err)
+			}
+			bases = append(bases, b)
+		}
+	}
+	return bases, nil
+}
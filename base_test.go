@@ -0,0 +1,175 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"encoding/json"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type BaseSuite struct{}
+
+var _ = gc.Suite(&BaseSuite{})
+
+var parseBaseTests = []struct {
+	base   string
+	expect charm.Base
+	err    string
+}{{
+	base:   "ubuntu@14.04/amd64",
+	expect: charm.Base{OS: "ubuntu", Channel: "14.04", Arch: "amd64"},
+}, {
+	base:   "ubuntu@14.10",
+	expect: charm.Base{OS: "ubuntu", Channel: "14.10"},
+}, {
+	base:   "centos@7",
+	expect: charm.Base{OS: "centos", Channel: "7"},
+}, {
+	base: "ubuntu",
+	err:  `invalid base "ubuntu": expected os@channel`,
+}, {
+	base: "ubuntu@/amd64",
+	err:  `invalid base "ubuntu@/amd64": invalid channel ""`,
+}, {
+	base: "Ubuntu@14.04",
+	err:  `invalid base "Ubuntu@14.04": invalid operating system "Ubuntu"`,
+}, {
+	base: "ubuntu@14.04/sparc",
+	err:  `invalid base "ubuntu@14.04/sparc": unknown architecture "sparc"`,
+}}
+
+func (s *BaseSuite) TestParseBase(c *gc.C) {
+	for i, test := range parseBaseTests {
+		c.Logf("test %d: %s", i, test.base)
+		b, err := charm.ParseBase(test.base)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(b, gc.Equals, test.expect)
+		c.Assert(b.String(), gc.Equals, test.base)
+	}
+}
+
+func (s *BaseSuite) TestCompare(c *gc.C) {
+	ordered := []string{
+		"centos@7",
+		"ubuntu@9.10",
+		"ubuntu@10.04",
+		"ubuntu@14.04",
+		"ubuntu@14.04/amd64",
+		"ubuntu@14.04/arm64",
+		"ubuntu@14.04.1",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			expect := 0
+			switch {
+			case i < j:
+				expect = -1
+			case i > j:
+				expect = 1
+			}
+			c.Check(charm.MustParseBase(a).Compare(charm.MustParseBase(b)), gc.Equals, expect, gc.Commentf("%s vs %s", a, b))
+		}
+	}
+}
+
+func (s *BaseSuite) TestSeries(c *gc.C) {
+	b, err := charm.SeriesBase("trusty")
+	c.Assert(err, gc.IsNil)
+	c.Assert(b, gc.Equals, charm.MustParseBase("ubuntu@14.04"))
+	c.Assert(charm.MustParseBase("ubuntu@14.04/amd64").Series(), gc.Equals, "trusty")
+	c.Assert(charm.MustParseBase("centos@7").Series(), gc.Equals, "")
+
+	_, err = charm.SeriesBase("bogus")
+	c.Assert(err, gc.ErrorMatches, `unknown series "bogus"`)
+}
+
+func (s *BaseSuite) TestJSON(c *gc.C) {
+	data, err := json.Marshal([]charm.Base{charm.MustParseBase("ubuntu@14.04/amd64")})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `["ubuntu@14.04/amd64"]`)
+	var bases []charm.Base
+	err = json.Unmarshal(data, &bases)
+	c.Assert(err, gc.IsNil)
+	c.Assert(bases, jc.DeepEquals, []charm.Base{charm.MustParseBase("ubuntu@14.04/amd64")})
+
+	err = json.Unmarshal([]byte(`["ubuntu"]`), &bases)
+	c.Assert(err, gc.ErrorMatches, `invalid base "ubuntu": expected os@channel`)
+}
+
+func (s *BaseSuite) TestReadMetaBases(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(`
+name: based
+summary: s
+description: d
+bases:
+  - ubuntu@14.04/amd64
+  - name: ubuntu
+    channel: "14.10"
+    architectures: [amd64, arm64]
+platforms:
+  - centos@7
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Bases, jc.DeepEquals, []charm.Base{
+		{OS: "ubuntu", Channel: "14.04", Arch: "amd64"},
+		{OS: "ubuntu", Channel: "14.10", Arch: "amd64"},
+		{OS: "ubuntu", Channel: "14.10", Arch: "arm64"},
+		{OS: "centos", Channel: "7"},
+	})
+	c.Assert(meta.AllBases(), jc.DeepEquals, meta.Bases)
+	c.Assert(meta.Series, gc.Equals, "")
+}
+
+func (s *BaseSuite) TestAllBasesFromSeries(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader("name: a\nsummary: s\ndescription: d\nseries: trusty\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Bases, gc.IsNil)
+	c.Assert(meta.AllBases(), jc.DeepEquals, []charm.Base{{OS: "ubuntu", Channel: "14.04"}})
+
+	meta.Series = ""
+	c.Assert(meta.AllBases(), gc.IsNil)
+}
+
+func (s *BaseSuite) TestReadMetaBasesErrors(c *gc.C) {
+	_, err := charm.ReadMeta(strings.NewReader("name: a\nsummary: s\ndescription: d\nbases: [ubuntu@14.04/sparc]\n"))
+	c.Assert(err, gc.ErrorMatches, `(?s)metadata: .*bases\[0\]: invalid base "ubuntu@14.04/sparc": unknown architecture "sparc".*`)
+
+	_, err = charm.ReadMeta(strings.NewReader("name: a\nsummary: s\ndescription: d\nbases: [{name: ubuntu, channel: 14.04}]\n"))
+	c.Assert(err, gc.ErrorMatches, `(?s)metadata: .*bases\[0\]\.channel: expected string, got float64\(14\.04\).*`)
+}
+
+func (s *BaseSuite) TestCheckInvalidBase(c *gc.C) {
+	meta := charm.Meta{
+		Name:  "a",
+		Bases: []charm.Base{{OS: "ubuntu", Channel: "14.04", Arch: "sparc"}},
+	}
+	err := meta.Check()
+	c.Assert(err, gc.ErrorMatches, `charm "a" declares invalid base "ubuntu@14.04/sparc": unknown architecture "sparc"`)
+}
+
+func (s *BaseSuite) TestCheckSeriesMatchesBases(c *gc.C) {
+	meta := charm.Meta{
+		Name:   "a",
+		Series: "trusty",
+		Bases:  []charm.Base{{OS: "ubuntu", Channel: "14.10", Arch: "amd64"}},
+	}
+	err := meta.Check()
+	c.Assert(err, gc.ErrorMatches, `charm "a" declares series "trusty", which corresponds to none of its bases`)
+
+	meta.Bases = append(meta.Bases, charm.Base{OS: "ubuntu", Channel: "14.04", Arch: "arm64"})
+	c.Assert(meta.Check(), gc.IsNil)
+
+	// A series unknown to the package cannot be compared.
+	meta.Series = "futuristic"
+	c.Assert(meta.Check(), gc.IsNil)
+}
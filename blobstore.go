@@ -0,0 +1,181 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/juju/utils"
+)
+
+// BlobStore is implemented by storage backends that hold blobs,
+// such as charm archives, addressed by their content. A blob's
+// digest is the hex-encoded SHA256 digest of its contents.
+//
+// Implementations must be safe to use concurrently, and should
+// return a *NotFoundError when a blob does not exist.
+type BlobStore interface {
+	// Put stores the size bytes read from r as the blob with
+	// the given digest. It returns an error, and stores
+	// nothing, if the contents do not match the digest.
+	// Putting a blob that already exists has no effect.
+	Put(digest string, r io.Reader, size int64) error
+
+	// Get returns a reader of the contents of the blob
+	// with the given digest, and its size. The reader
+	// must be closed after use.
+	Get(digest string) (io.ReadCloser, int64, error)
+
+	// Stat returns the size of the blob with the given digest.
+	Stat(digest string) (int64, error)
+}
+
+var validDigest = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// PutCharmArchive reads a charm archive from r and stores it in
+// the given blob store, if it is not already there. It returns the
+// digest of the archive.
+func PutCharmArchive(store BlobStore, r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if _, err := ReadCharmArchiveBytes(data); err != nil {
+		return "", fmt.Errorf("cannot store charm archive: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if _, err := store.Stat(digest); err == nil {
+		return digest, nil
+	} else if _, ok := err.(*NotFoundError); !ok {
+		return "", fmt.Errorf("cannot store charm archive: %v", err)
+	}
+	if err := store.Put(digest, bytes.NewReader(data), int64(len(data))); err != nil {
+		return "", fmt.Errorf("cannot store charm archive: %v", err)
+	}
+	return digest, nil
+}
+
+// GetCharmArchive returns the charm archive with the given digest
+// from the given blob store. The archive is checked against the
+// digest before it is read.
+func GetCharmArchive(store BlobStore, digest string) (*CharmArchive, error) {
+	r, _, err := store.Get(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read charm archive %q: %v", digest, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("charm archive %q has been modified", digest)
+	}
+	return ReadCharmArchiveBytes(data)
+}
+
+// FileBlobStore is a BlobStore that holds blobs as files
+// in a directory on the local file system.
+type FileBlobStore struct {
+	// Dir holds the directory holding the blobs.
+	// It is created when the first blob is stored.
+	Dir string
+}
+
+var _ BlobStore = (*FileBlobStore)(nil)
+
+// path returns the path of the file holding the blob with the given
+// digest. Blobs are spread across subdirectories named after the
+// first two characters of their digests.
+func (s *FileBlobStore) path(digest string) (string, error) {
+	if !validDigest.MatchString(digest) {
+		return "", fmt.Errorf("invalid blob digest %q", digest)
+	}
+	return filepath.Join(s.Dir, digest[:2], digest), nil
+}
+
+// Put implements BlobStore.Put.
+func (s *FileBlobStore) Put(digest string, r io.Reader, size int64) error {
+	path, err := s.path(digest)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "blob")
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r, size+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != size {
+		err = fmt.Errorf("expected %d bytes, got %d", size, n)
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != digest {
+		err = fmt.Errorf("blob does not match digest %q", digest)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return utils.ReplaceFile(f.Name(), path)
+}
+
+// Get implements BlobStore.Get.
+func (s *FileBlobStore) Get(digest string) (io.ReadCloser, int64, error) {
+	path, err := s.path(digest)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, blobNotFoundError(digest)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// Stat implements BlobStore.Stat.
+func (s *FileBlobStore) Stat(digest string) (int64, error) {
+	path, err := s.path(digest)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, blobNotFoundError(digest)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func blobNotFoundError(digest string) error {
+	return &NotFoundError{fmt.Sprintf("blob %q not found", digest)}
+}
@@ -0,0 +1,140 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type BlobStoreSuite struct {
+	store *charm.FileBlobStore
+}
+
+var _ = gc.Suite(&BlobStoreSuite{})
+
+func (s *BlobStoreSuite) SetUpTest(c *gc.C) {
+	s.store = &charm.FileBlobStore{Dir: filepath.Join(c.MkDir(), "blobs")}
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *BlobStoreSuite) TestPutGetStat(c *gc.C) {
+	data := []byte("some content")
+	digest := digestOf(data)
+	err := s.store.Put(digest, bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.IsNil)
+
+	size, err := s.store.Stat(digest)
+	c.Assert(err, gc.IsNil)
+	c.Assert(size, gc.Equals, int64(len(data)))
+
+	r, size, err := s.store.Get(digest)
+	c.Assert(err, gc.IsNil)
+	defer r.Close()
+	c.Assert(size, gc.Equals, int64(len(data)))
+	got, err := ioutil.ReadAll(r)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(got), gc.Equals, "some content")
+
+	_, err = os.Stat(filepath.Join(s.store.Dir, digest[:2], digest))
+	c.Assert(err, gc.IsNil)
+
+	// Putting the blob again has no effect.
+	err = s.store.Put(digest, bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *BlobStoreSuite) TestNotFound(c *gc.C) {
+	digest := digestOf([]byte("missing"))
+	_, err := s.store.Stat(digest)
+	c.Assert(err, gc.FitsTypeOf, &charm.NotFoundError{})
+	c.Assert(err, gc.ErrorMatches, `blob "[0-9a-f]+" not found`)
+	_, _, err = s.store.Get(digest)
+	c.Assert(err, gc.FitsTypeOf, &charm.NotFoundError{})
+}
+
+func (s *BlobStoreSuite) TestPutMismatch(c *gc.C) {
+	data := []byte("some content")
+	digest := digestOf([]byte("other content"))
+	err := s.store.Put(digest, bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.ErrorMatches, `blob does not match digest ".*"`)
+
+	digest = digestOf(data)
+	err = s.store.Put(digest, bytes.NewReader(data), 4)
+	c.Assert(err, gc.ErrorMatches, `expected 4 bytes, got 5`)
+	err = s.store.Put(digest, bytes.NewReader(data), 20)
+	c.Assert(err, gc.ErrorMatches, `expected 20 bytes, got 12`)
+
+	_, err = s.store.Stat(digest)
+	c.Assert(err, gc.FitsTypeOf, &charm.NotFoundError{})
+	entries, err := ioutil.ReadDir(filepath.Join(s.store.Dir, digest[:2]))
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 0)
+}
+
+func (s *BlobStoreSuite) TestInvalidDigest(c *gc.C) {
+	for _, digest := range []string{"", "../../etc/passwd", strings.Repeat("A", 64)} {
+		_, err := s.store.Stat(digest)
+		c.Assert(err, gc.ErrorMatches, `invalid blob digest ".*"`)
+		_, _, err = s.store.Get(digest)
+		c.Assert(err, gc.ErrorMatches, `invalid blob digest ".*"`)
+		err = s.store.Put(digest, strings.NewReader(""), 0)
+		c.Assert(err, gc.ErrorMatches, `invalid blob digest ".*"`)
+	}
+}
+
+func (s *BlobStoreSuite) TestPutGetCharmArchive(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+
+	digest, err := charm.PutCharmArchive(s.store, bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(digest, gc.Equals, digestOf(data))
+
+	archive, err := charm.GetCharmArchive(s.store, digest)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+	c.Assert(archive.Revision(), gc.Equals, 1)
+
+	// Storing the same archive again is fine.
+	digest2, err := charm.PutCharmArchive(s.store, bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(digest2, gc.Equals, digest)
+}
+
+func (s *BlobStoreSuite) TestPutCharmArchiveInvalid(c *gc.C) {
+	_, err := charm.PutCharmArchive(s.store, strings.NewReader("not a zip"))
+	c.Assert(err, gc.ErrorMatches, "cannot store charm archive: .*")
+	_, err = os.Stat(s.store.Dir)
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+}
+
+func (s *BlobStoreSuite) TestGetCharmArchiveModified(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	digest, err := charm.PutCharmArchive(s.store, bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+
+	blobPath := filepath.Join(s.store.Dir, digest[:2], digest)
+	err = ioutil.WriteFile(blobPath, append(data, 0), 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.GetCharmArchive(s.store, digest)
+	c.Assert(err, gc.ErrorMatches, `charm archive ".*" has been modified`)
+}
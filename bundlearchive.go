@@ -8,6 +8,7 @@ import (
 	"io"
 	"io/ioutil"
 
+	"github.com/juju/utils/set"
 	ziputil "github.com/juju/utils/zip"
 )
 
@@ -86,6 +87,23 @@ func (a *BundleArchive) ReadMe() string {
 	return a.readMe
 }
 
+// Manifest returns a set of the bundle's contents.
+func (a *BundleArchive) Manifest() (set.Strings, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return set.NewStrings(), err
+	}
+	defer zipr.Close()
+	paths, err := ziputil.Find(zipr.Reader, "*")
+	if err != nil {
+		return set.NewStrings(), err
+	}
+	manifest := set.NewStrings(paths...)
+	// We always strip ".", because that's sometimes not present.
+	manifest.Remove(".")
+	return manifest, nil
+}
+
 // ExpandTo expands the bundle archive into dir, creating it if necessary.
 // If any errors occur during the expansion procedure, the process will
 // abort.
@@ -97,3 +97,23 @@ func (s *BundleArchiveSuite) TestExpandTo(c *gc.C) {
 	c.Assert(bdir.ReadMe(), gc.Equals, archive.ReadMe())
 	c.Assert(bdir.Data(), gc.DeepEquals, archive.Data())
 }
+
+func (s *BundleArchiveSuite) TestManifest(c *gc.C) {
+	archive, err := charm.ReadBundleArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+	manifest, err := archive.Manifest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(manifest.SortedValues(), gc.DeepEquals, []string{"README.md", "bundle.yaml"})
+
+	// Check that the manifest matches the expanded contents.
+	dir := c.MkDir()
+	err = archive.ExpandTo(dir)
+	c.Assert(err, gc.IsNil)
+	infos, err := ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	c.Assert(names, gc.DeepEquals, manifest.SortedValues())
+}
@@ -13,7 +13,6 @@ import (
 	"strings"
 
 	"github.com/juju/names"
-	"gopkg.in/yaml.v1"
 )
 
 // BundleData holds the contents of the bundle.
@@ -129,6 +128,12 @@ type ServiceSpec struct {
 	// when creating new machines for units of the service.
 	// This is ignored for units with explicit placement directives.
 	Constraints string `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
+
+	// Storage holds the constraints for provisioning the stores
+	// required by the service's charm, keyed by storage name,
+	// in the form accepted by ParseStorageConstraint,
+	// such as "ebs,10G,2".
+	Storage map[string]string `bson:",omitempty" json:",omitempty" yaml:",omitempty"`
 }
 
 // ReadBundleData reads bundle data from the given reader.
@@ -140,7 +145,7 @@ func ReadBundleData(r io.Reader) (*BundleData, error) {
 		return nil, err
 	}
 	var bd BundleData
-	if err := yaml.Unmarshal(bytes, &bd); err != nil {
+	if err := yamlUnmarshal(bytes, &bd); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal bundle data: %v", err)
 	}
 	return &bd, nil
@@ -212,22 +217,28 @@ func (bd *BundleData) Verify(
 // VerifyWithCharms verifies that the bundle is consistent.
 // The verifyConstraints function is called to verify any constraints
 // that are found. If verifyConstraints is nil, no checking
-// of constraints will be done.
+// of constraints will be done. VerifyConstraints may be passed
+// to check that constraints can be parsed by ParseConstraints.
 //
 // It verifies the following:
 //
 // - All defined machines are referred to by placement directives.
 // - All services referred to by placement directives are specified in the bundle.
+// - Unit placements do not nest containers or co-locate units in a cycle.
 // - All services referred to by relations are specified in the bundle.
 // - All constraints are valid.
+// - All storage constraints are valid.
 //
 // If charms is not nil, it should hold a map with an entry for each
 // charm url returned by bd.RequiredCharms. The verification will then
 // also check that services are defined with valid charms,
-// relations are correctly made and options are defined correctly.
+// relations are correctly made, options are defined correctly and
+// storage constraints refer to stores declared by the charms and
+// fit their declared ranges and sizes.
 //
 // If the verification fails, Verify returns a *VerificationError describing
-// all the problems found.
+// all the problems found. Problems found in the placements of units once
+// their To fields are expanded are described by a *PlacementError.
 func (bd *BundleData) VerifyWithCharms(
 	verifyConstraints func(c string) error,
 	charms map[string]Charm,
@@ -251,8 +262,10 @@ func (bd *BundleData) VerifyWithCharms(
 	}
 	verifier.verifyMachines()
 	verifier.verifyServices()
+	verifier.verifyUnitPlacements()
 	verifier.verifyRelations()
 	verifier.verifyOptions()
+	verifier.verifyStorage()
 
 	for id, count := range verifier.machineRefCounts {
 		if count == 0 {
@@ -292,6 +305,11 @@ func (verifier *bundleDataVerifier) verifyServices() {
 		if err := verifier.verifyConstraints(svc.Constraints); err != nil {
 			verifier.addErrorf("invalid constraints %q in service %q: %v", svc.Constraints, name, err)
 		}
+		for store, cons := range svc.Storage {
+			if _, err := ParseStorageConstraint(cons); err != nil {
+				verifier.addErrorf("invalid storage constraint %q for %q in service %q: %v", cons, store, name, err)
+			}
+		}
 		verifier.verifyPlacement(svc.To)
 		if svc.NumUnits < 0 {
 			verifier.addErrorf("negative number of units specified on service %q", name)
@@ -419,8 +437,8 @@ var infoRelation = Relation{
 // verifyRelation verifies a single relation.
 // It checks that both endpoints of the relation are
 // defined, and that the relationship is correctly
-// symmetrical (provider to requirer) and shares
-// the same interface.
+// symmetrical (provider to requirer) and uses
+// compatible interfaces.
 func (verifier *bundleDataVerifier) verifyRelation(ep0, ep1 endpoint) {
 	svc0 := verifier.bd.Services[ep0.service]
 	svc1 := verifier.bd.Services[ep1.service]
@@ -474,7 +492,7 @@ func (verifier *bundleDataVerifier) verifyRelation(ep0, ep1 endpoint) {
 		// Errors were added above.
 		return
 	}
-	if relProv.Interface != relReq.Interface {
+	if !relProv.CanRelateTo(relReq) {
 		verifier.addErrorf("mismatched interface between %q and %q (%q vs %q)", epProv, epReq, relProv.Interface, relReq.Interface)
 	}
 }
@@ -506,6 +524,38 @@ func (verifier *bundleDataVerifier) verifyOptions() {
 	}
 }
 
+// verifyStorage verifies that the storage constraints of each
+// service refer to stores declared by its charm and can be
+// satisfied by them.
+func (verifier *bundleDataVerifier) verifyStorage() {
+	if verifier.charms == nil {
+		return
+	}
+	for svcName, svc := range verifier.bd.Services {
+		charm := verifier.charms[svc.Charm]
+		if charm == nil {
+			// An error will be produced by verifyServices for this case.
+			continue
+		}
+		stores := charm.Meta().Storage
+		for name, value := range svc.Storage {
+			store, ok := stores[name]
+			if !ok {
+				verifier.addErrorf("service %q refers to storage %q not declared by charm %q", svcName, name, svc.Charm)
+				continue
+			}
+			cons, err := ParseStorageConstraint(value)
+			if err != nil {
+				// An error will be produced by verifyServices for this case.
+				continue
+			}
+			if err := store.CheckConstraint(cons); err != nil {
+				verifier.addErrorf("cannot validate service %q: storage %q: %v", svcName, name, err)
+			}
+		}
+	}
+}
+
 var validServiceRelation = regexp.MustCompile("^(" + names.ServiceSnippet + "):(" + names.RelationSnippet + ")$")
 
 type endpoint struct {
@@ -558,9 +608,8 @@ func (ep endpointInfo) String() string {
 // and other.
 func (ep endpointInfo) canRelateTo(other endpointInfo) bool {
 	return ep.serviceName != other.serviceName &&
-		ep.Interface == other.Interface &&
 		ep.Role != RolePeer &&
-		counterpartRole(ep.Role) == other.Role
+		ep.Relation.CanRelateTo(other.Relation)
 }
 
 // endpoint returns the endpoint specifier for ep.
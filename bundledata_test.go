@@ -807,3 +807,32 @@ func (*bundleDataSuite) TestParsePlacement(c *gc.C) {
 		}
 	}
 }
+
+func (*bundleDataSuite) TestVerifyWithVerifyConstraints(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(`
+machines:
+    0:
+        constraints: arch=sparc
+services:
+    mysql:
+        charm: mysql
+        num_units: 1
+        to: [0]
+        constraints: mem=lots
+    wordpress:
+        charm: wordpress
+        constraints: mem=4G cores=2
+`))
+	c.Assert(err, gc.IsNil)
+	err = bd.Verify(charm.VerifyConstraints)
+	c.Assert(err, gc.FitsTypeOf, (*charm.VerificationError)(nil))
+	var errors []string
+	for _, err := range err.(*charm.VerificationError).Errors {
+		errors = append(errors, err.Error())
+	}
+	sort.Strings(errors)
+	c.Assert(errors, jc.DeepEquals, []string{
+		`invalid constraints "arch=sparc" in machine "0": bad "arch" constraint: "sparc" not recognized`,
+		`invalid constraints "mem=lots" in service "mysql": bad "mem" constraint: must be a non-negative float with optional M/G/T/P suffix`,
+	})
+}
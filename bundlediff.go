@@ -0,0 +1,278 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// BundleDiff describes the differences between two bundles, as
+// returned by BundleData.Diff. Fields that would describe no
+// differences are nil.
+type BundleDiff struct {
+	Series      *StringDiff             `json:",omitempty" yaml:",omitempty"`
+	Description *StringDiff             `json:",omitempty" yaml:",omitempty"`
+	Tags        *StringsDiff            `json:",omitempty" yaml:",omitempty"`
+	Services    map[string]*ServiceDiff `json:",omitempty" yaml:",omitempty"`
+	Machines    map[string]*MachineDiff `json:",omitempty" yaml:",omitempty"`
+	Relations   *RelationsDiff          `json:",omitempty" yaml:",omitempty"`
+}
+
+// DiffSide identifies one of the bundles being compared.
+type DiffSide string
+
+const (
+	// DiffOld identifies the bundle on which Diff was called.
+	DiffOld DiffSide = "old"
+
+	// DiffNew identifies the bundle passed to Diff.
+	DiffNew DiffSide = "new"
+)
+
+// StringDiff holds a string value that differs between bundles.
+type StringDiff struct {
+	Old string
+	New string
+}
+
+// IntDiff holds an integer value that differs between bundles.
+type IntDiff struct {
+	Old int
+	New int
+}
+
+// StringsDiff holds a list of strings that differs between bundles.
+type StringsDiff struct {
+	Old []string
+	New []string
+}
+
+// OptionDiff holds a service option value that differs between
+// bundles. A nil value means that the option is not set.
+type OptionDiff struct {
+	Old interface{}
+	New interface{}
+}
+
+// ServiceDiff describes the differences in a service. If the
+// service is present in only one of the bundles, Missing names
+// the bundle that lacks it and no other fields are set.
+type ServiceDiff struct {
+	Missing     DiffSide              `json:",omitempty" yaml:",omitempty"`
+	Charm       *StringDiff           `json:",omitempty" yaml:",omitempty"`
+	NumUnits    *IntDiff              `json:",omitempty" yaml:",omitempty"`
+	To          *StringsDiff          `json:",omitempty" yaml:",omitempty"`
+	Constraints *StringDiff           `json:",omitempty" yaml:",omitempty"`
+	Options     map[string]OptionDiff `json:",omitempty" yaml:",omitempty"`
+	Annotations map[string]StringDiff `json:",omitempty" yaml:",omitempty"`
+	Storage     map[string]StringDiff `json:",omitempty" yaml:",omitempty"`
+}
+
+// MachineDiff describes the differences in a machine, as
+// ServiceDiff does for services.
+type MachineDiff struct {
+	Missing     DiffSide              `json:",omitempty" yaml:",omitempty"`
+	Constraints *StringDiff           `json:",omitempty" yaml:",omitempty"`
+	Annotations map[string]StringDiff `json:",omitempty" yaml:",omitempty"`
+}
+
+// RelationsDiff holds the relations present in only one of the
+// bundles. Relations are compared regardless of the order of
+// their endpoints, and are listed in sorted order with their
+// endpoints sorted.
+type RelationsDiff struct {
+	Removed [][]string `json:",omitempty" yaml:",omitempty"`
+	Added   [][]string `json:",omitempty" yaml:",omitempty"`
+}
+
+// Empty reports whether the diff describes no differences.
+func (d *BundleDiff) Empty() bool {
+	return reflect.DeepEqual(d, &BundleDiff{})
+}
+
+// Diff returns the differences between bd and other. Relation
+// endpoints are compared as written, so a relation specified
+// as "wordpress" in one bundle and "wordpress:db" in the other
+// is reported as changed.
+func (bd *BundleData) Diff(other *BundleData) *BundleDiff {
+	d := &BundleDiff{
+		Series:      diffString(bd.Series, other.Series),
+		Description: diffString(bd.Description, other.Description),
+		Tags:        diffStrings(bd.Tags, other.Tags),
+		Relations:   diffRelations(bd.Relations, other.Relations),
+	}
+	for name, svc := range bd.Services {
+		if diff := diffService(svc, other.Services[name]); diff != nil {
+			if d.Services == nil {
+				d.Services = make(map[string]*ServiceDiff)
+			}
+			d.Services[name] = diff
+		}
+	}
+	for name, svc := range other.Services {
+		if _, ok := bd.Services[name]; !ok {
+			if d.Services == nil {
+				d.Services = make(map[string]*ServiceDiff)
+			}
+			d.Services[name] = diffService(nil, svc)
+		}
+	}
+	for id, m := range bd.Machines {
+		otherMachine, ok := other.Machines[id]
+		if diff := diffMachine(m, true, otherMachine, ok); diff != nil {
+			if d.Machines == nil {
+				d.Machines = make(map[string]*MachineDiff)
+			}
+			d.Machines[id] = diff
+		}
+	}
+	for id, m := range other.Machines {
+		if _, ok := bd.Machines[id]; !ok {
+			if d.Machines == nil {
+				d.Machines = make(map[string]*MachineDiff)
+			}
+			d.Machines[id] = diffMachine(nil, false, m, true)
+		}
+	}
+	return d
+}
+
+func diffService(old, new *ServiceSpec) *ServiceDiff {
+	switch {
+	case old == nil && new == nil:
+		return nil
+	case old == nil:
+		return &ServiceDiff{Missing: DiffOld}
+	case new == nil:
+		return &ServiceDiff{Missing: DiffNew}
+	}
+	d := &ServiceDiff{
+		Charm:       diffString(old.Charm, new.Charm),
+		To:          diffStrings(old.To, new.To),
+		Constraints: diffString(old.Constraints, new.Constraints),
+		Annotations: diffAnnotations(old.Annotations, new.Annotations),
+		Storage:     diffAnnotations(old.Storage, new.Storage),
+	}
+	if old.NumUnits != new.NumUnits {
+		d.NumUnits = &IntDiff{old.NumUnits, new.NumUnits}
+	}
+	for key, value := range old.Options {
+		if newValue := new.Options[key]; !reflect.DeepEqual(value, newValue) {
+			if d.Options == nil {
+				d.Options = make(map[string]OptionDiff)
+			}
+			d.Options[key] = OptionDiff{value, newValue}
+		}
+	}
+	for key, value := range new.Options {
+		if _, ok := old.Options[key]; !ok && value != nil {
+			if d.Options == nil {
+				d.Options = make(map[string]OptionDiff)
+			}
+			d.Options[key] = OptionDiff{nil, value}
+		}
+	}
+	if reflect.DeepEqual(d, &ServiceDiff{}) {
+		return nil
+	}
+	return d
+}
+
+// diffMachine returns the differences between two machines. As
+// machines with no specification are nil, the oldOK and newOK
+// parameters record whether each machine is present.
+func diffMachine(old *MachineSpec, oldOK bool, new *MachineSpec, newOK bool) *MachineDiff {
+	switch {
+	case !oldOK && !newOK:
+		return nil
+	case !oldOK:
+		return &MachineDiff{Missing: DiffOld}
+	case !newOK:
+		return &MachineDiff{Missing: DiffNew}
+	}
+	if old == nil {
+		old = &MachineSpec{}
+	}
+	if new == nil {
+		new = &MachineSpec{}
+	}
+	d := &MachineDiff{
+		Constraints: diffString(old.Constraints, new.Constraints),
+		Annotations: diffAnnotations(old.Annotations, new.Annotations),
+	}
+	if reflect.DeepEqual(d, &MachineDiff{}) {
+		return nil
+	}
+	return d
+}
+
+func diffString(old, new string) *StringDiff {
+	if old == new {
+		return nil
+	}
+	return &StringDiff{old, new}
+}
+
+func diffStrings(old, new []string) *StringsDiff {
+	if len(old) == 0 && len(new) == 0 || reflect.DeepEqual(old, new) {
+		return nil
+	}
+	return &StringsDiff{old, new}
+}
+
+func diffAnnotations(old, new map[string]string) map[string]StringDiff {
+	var d map[string]StringDiff
+	add := func(key string) {
+		if old[key] == new[key] {
+			return
+		}
+		if d == nil {
+			d = make(map[string]StringDiff)
+		}
+		d[key] = StringDiff{old[key], new[key]}
+	}
+	for key := range old {
+		add(key)
+	}
+	for key := range new {
+		add(key)
+	}
+	return d
+}
+
+func diffRelations(old, new [][]string) *RelationsDiff {
+	oldKeys := relationKeys(old)
+	newKeys := relationKeys(new)
+	d := &RelationsDiff{}
+	for key, rel := range oldKeys {
+		if _, ok := newKeys[key]; !ok {
+			d.Removed = append(d.Removed, rel)
+		}
+	}
+	for key, rel := range newKeys {
+		if _, ok := oldKeys[key]; !ok {
+			d.Added = append(d.Added, rel)
+		}
+	}
+	if d.Removed == nil && d.Added == nil {
+		return nil
+	}
+	sort.Sort(relationsByEndpoints(d.Removed))
+	sort.Sort(relationsByEndpoints(d.Added))
+	return d
+}
+
+// relationKeys returns the given relations, with their
+// endpoints sorted, indexed by a string identifying each.
+func relationKeys(relations [][]string) map[string][]string {
+	keys := make(map[string][]string)
+	for _, rel := range relations {
+		sorted := append([]string(nil), rel...)
+		sort.Strings(sorted)
+		keys[strings.Join(sorted, " ")] = sorted
+	}
+	return keys
+}
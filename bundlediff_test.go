@@ -0,0 +1,67 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type bundleDiffSuite struct{}
+
+var _ = gc.Suite(&bundleDiffSuite{})
+
+func (*bundleDiffSuite) TestDiffSame(c *gc.C) {
+	bd := readBundleData(c, mergeBaseBundle)
+	diff := bd.Diff(readBundleData(c, mergeBaseBundle))
+	c.Assert(diff, jc.DeepEquals, &charm.BundleDiff{})
+	c.Assert(diff.Empty(), gc.Equals, true)
+}
+
+func (*bundleDiffSuite) TestDiff(c *gc.C) {
+	old := readBundleData(c, mergeBaseBundle)
+	new := readBundleData(c, mergeBaseBundle)
+	err := new.Merge(readBundleData(c, mergeOverlayBundle))
+	c.Assert(err, gc.IsNil)
+	new.Relations = append(new.Relations, []string{"pgsql", "varnish"})
+	new.Machines["5"] = nil
+
+	diff := old.Diff(new)
+	c.Assert(diff.Empty(), gc.Equals, false)
+	c.Assert(diff, jc.DeepEquals, &charm.BundleDiff{
+		Series: &charm.StringDiff{Old: "precise", New: "trusty"},
+		Services: map[string]*charm.ServiceDiff{
+			"wordpress": {
+				NumUnits:    &charm.IntDiff{Old: 1, New: 2},
+				To:          &charm.StringsDiff{Old: []string{"0"}, New: []string{"0", "new"}},
+				Constraints: &charm.StringDiff{Old: "", New: "cores=2"},
+				Options: map[string]charm.OptionDiff{
+					"blog-title": {Old: "My Blog", New: "Production Blog"},
+					"debug":      {Old: true, New: nil},
+				},
+				Annotations: map[string]charm.StringDiff{
+					"gui-y": {Old: "", New: "20"},
+				},
+			},
+			"mysql": {Missing: charm.DiffNew},
+			"pgsql": {Missing: charm.DiffOld},
+		},
+		Machines: map[string]*charm.MachineDiff{
+			"0": {
+				Constraints: &charm.StringDiff{Old: "mem=2G", New: "mem=8G"},
+				Annotations: map[string]charm.StringDiff{
+					"rack": {Old: "", New: "3"},
+				},
+			},
+			"1": {Missing: charm.DiffNew},
+			"5": {Missing: charm.DiffOld},
+		},
+		Relations: &charm.RelationsDiff{
+			Removed: [][]string{{"mysql:db", "wordpress:db"}},
+			Added:   [][]string{{"pgsql", "varnish"}, {"pgsql:db", "wordpress:db"}},
+		},
+	})
+}
@@ -49,8 +49,10 @@ func (dir *BundleDir) ReadMe() string {
 	return dir.readMe
 }
 
+// ArchiveTo creates a bundle archive from the bundle expanded in
+// dir. The archive may be read with ReadBundleArchive.
 func (dir *BundleDir) ArchiveTo(w io.Writer) error {
-	return writeArchive(w, dir.Path, -1, nil)
+	return writeArchive(w, dir.Path, -1, nil, nil)
 }
 
 // join builds a path rooted at the bundle's expanded directory
@@ -0,0 +1,184 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ModelDescription describes the services, machines and relations
+// of a deployed environment, independently of the tool that
+// deployed it. It is used by NewBundleFromModel to export the
+// environment as a bundle.
+type ModelDescription struct {
+	// Series holds the default series of the environment.
+	Series string
+
+	// Services holds the services in the environment.
+	Services []ModelService
+
+	// Machines holds the machines in the environment.
+	// Containers need not be included.
+	Machines []ModelMachine
+
+	// Relations holds the relations in the environment.
+	Relations []ModelRelation
+}
+
+// ModelService describes a deployed service.
+type ModelService struct {
+	Name        string
+	Charm       string
+	Options     map[string]interface{}
+	Annotations map[string]string
+	Constraints string
+
+	// Units holds the service's units.
+	Units []ModelUnit
+}
+
+// ModelUnit describes a deployed unit.
+type ModelUnit struct {
+	// Machine holds the id of the machine the unit is deployed
+	// to, such as "1" or, for a container, "1/lxc/0". It is
+	// empty if the unit has not been assigned to a machine.
+	Machine string
+}
+
+// ModelMachine describes a deployed machine.
+type ModelMachine struct {
+	Id          string
+	Constraints string
+	Annotations map[string]string
+}
+
+// ModelRelation describes a relation between two services.
+type ModelRelation struct {
+	// Endpoints holds the relation's endpoints, each in the form
+	// "service:relation".
+	Endpoints [2]string
+}
+
+// NewBundleFromModel returns a bundle that would deploy the given
+// environment. Units deployed to containers are placed in new
+// containers of the same type on the same machine, and machines
+// that hold no units are left out. The returned bundle has been
+// verified with Verify, without checking constraints.
+func NewBundleFromModel(model ModelDescription) (*BundleData, error) {
+	bd := &BundleData{
+		Series:   model.Series,
+		Services: make(map[string]*ServiceSpec),
+	}
+	machines := make(map[string]ModelMachine)
+	for _, m := range model.Machines {
+		machines[m.Id] = m
+	}
+	for _, svc := range model.Services {
+		if _, ok := bd.Services[svc.Name]; ok {
+			return nil, fmt.Errorf("service %q specified more than once", svc.Name)
+		}
+		spec := &ServiceSpec{
+			Charm:       svc.Charm,
+			NumUnits:    len(svc.Units),
+			Options:     copyOptions(svc.Options),
+			Annotations: copyAnnotations(svc.Annotations),
+			Constraints: svc.Constraints,
+		}
+		placed := false
+		for _, u := range svc.Units {
+			placement, id, err := unitPlacement(u.Machine)
+			if err != nil {
+				return nil, fmt.Errorf("cannot place unit of service %q: %v", svc.Name, err)
+			}
+			spec.To = append(spec.To, placement)
+			if id == "" {
+				continue
+			}
+			placed = true
+			if _, ok := bd.Machines[id]; ok {
+				continue
+			}
+			if bd.Machines == nil {
+				bd.Machines = make(map[string]*MachineSpec)
+			}
+			m := machines[id]
+			if m.Constraints == "" && m.Annotations == nil {
+				bd.Machines[id] = nil
+				continue
+			}
+			bd.Machines[id] = &MachineSpec{
+				Constraints: m.Constraints,
+				Annotations: copyAnnotations(m.Annotations),
+			}
+		}
+		if !placed {
+			// Every unit is on a new machine, which is the default.
+			spec.To = nil
+		}
+		bd.Services[svc.Name] = spec
+	}
+	for _, rel := range model.Relations {
+		bd.Relations = append(bd.Relations, []string{rel.Endpoints[0], rel.Endpoints[1]})
+	}
+	sort.Sort(relationsByEndpoints(bd.Relations))
+	if err := bd.Verify(nil); err != nil {
+		return nil, fmt.Errorf("cannot export bundle: %v", err)
+	}
+	return bd, nil
+}
+
+// unitPlacement returns the placement directive for a unit on the
+// machine with the given id, and the id of the top level machine
+// it refers to, if any.
+func unitPlacement(machineId string) (placement, topId string, err error) {
+	if machineId == "" {
+		return "new", "", nil
+	}
+	parts := strings.Split(machineId, "/")
+	switch len(parts) {
+	case 1:
+		return machineId, machineId, nil
+	case 3:
+		// The unit is in a container; place it in a new container
+		// of the same type on the same machine. Nested containers
+		// cannot be specified in a bundle.
+		if !validMachineId.MatchString(parts[0]) {
+			break
+		}
+		return parts[1] + ":" + parts[0], parts[0], nil
+	}
+	return "", "", fmt.Errorf("unsupported machine id %q", machineId)
+}
+
+func copyOptions(options map[string]interface{}) map[string]interface{} {
+	if options == nil {
+		return nil
+	}
+	result := make(map[string]interface{})
+	for key, value := range options {
+		result[key] = value
+	}
+	return result
+}
+
+func copyAnnotations(annotations map[string]string) map[string]string {
+	if annotations == nil {
+		return nil
+	}
+	result := make(map[string]string)
+	for key, value := range annotations {
+		result[key] = value
+	}
+	return result
+}
+
+type relationsByEndpoints [][]string
+
+func (r relationsByEndpoints) Len() int      { return len(r) }
+func (r relationsByEndpoints) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r relationsByEndpoints) Less(i, j int) bool {
+	return strings.Join(r[i], " ") < strings.Join(r[j], " ")
+}
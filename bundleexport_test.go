@@ -0,0 +1,136 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type bundleExportSuite struct{}
+
+var _ = gc.Suite(&bundleExportSuite{})
+
+var exportModel = charm.ModelDescription{
+	Series: "trusty",
+	Services: []charm.ModelService{{
+		Name:  "wordpress",
+		Charm: "cs:trusty/wordpress-2",
+		Options: map[string]interface{}{
+			"blog-title": "My Blog",
+		},
+		Annotations: map[string]string{"gui-x": "10"},
+		Units:       []charm.ModelUnit{{Machine: "1"}, {Machine: "2/lxc/0"}},
+	}, {
+		Name:        "mysql",
+		Charm:       "cs:trusty/mysql-5",
+		Constraints: "mem=4G",
+		Units:       []charm.ModelUnit{{Machine: "3"}},
+	}, {
+		Name:  "varnish",
+		Charm: "cs:trusty/varnish-1",
+		Units: []charm.ModelUnit{{}, {}},
+	}},
+	Machines: []charm.ModelMachine{{
+		Id: "1",
+	}, {
+		Id:          "2",
+		Constraints: "cores=2",
+	}, {
+		Id:          "3",
+		Annotations: map[string]string{"rack": "a"},
+	}, {
+		Id: "4",
+	}},
+	Relations: []charm.ModelRelation{{
+		Endpoints: [2]string{"wordpress:db", "mysql:db"},
+	}, {
+		Endpoints: [2]string{"varnish:website", "wordpress:cache"},
+	}},
+}
+
+func (*bundleExportSuite) TestNewBundleFromModel(c *gc.C) {
+	bd, err := charm.NewBundleFromModel(exportModel)
+	c.Assert(err, gc.IsNil)
+	expect := &charm.BundleData{
+		Series: "trusty",
+		Services: map[string]*charm.ServiceSpec{
+			"wordpress": {
+				Charm:       "cs:trusty/wordpress-2",
+				NumUnits:    2,
+				To:          []string{"1", "lxc:2"},
+				Options:     map[string]interface{}{"blog-title": "My Blog"},
+				Annotations: map[string]string{"gui-x": "10"},
+			},
+			"mysql": {
+				Charm:       "cs:trusty/mysql-5",
+				NumUnits:    1,
+				To:          []string{"3"},
+				Constraints: "mem=4G",
+			},
+			"varnish": {
+				Charm:    "cs:trusty/varnish-1",
+				NumUnits: 2,
+			},
+		},
+		Machines: map[string]*charm.MachineSpec{
+			"1": nil,
+			"2": {Constraints: "cores=2"},
+			"3": {Annotations: map[string]string{"rack": "a"}},
+		},
+		Relations: [][]string{
+			{"varnish:website", "wordpress:cache"},
+			{"wordpress:db", "mysql:db"},
+		},
+	}
+	c.Assert(bd, jc.DeepEquals, expect)
+
+	// Check that the bundle survives being written out.
+	data, err := yaml.Marshal(bd)
+	c.Assert(err, gc.IsNil)
+	bd, err = charm.ReadBundleData(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(bd, jc.DeepEquals, expect)
+}
+
+var newBundleFromModelErrorTests = []struct {
+	about string
+	model charm.ModelDescription
+	err   string
+}{{
+	about: "duplicate service",
+	model: charm.ModelDescription{
+		Services: []charm.ModelService{{Name: "a", Charm: "a"}, {Name: "a", Charm: "a"}},
+	},
+	err: `service "a" specified more than once`,
+}, {
+	about: "nested container",
+	model: charm.ModelDescription{
+		Services: []charm.ModelService{{
+			Name:  "a",
+			Charm: "a",
+			Units: []charm.ModelUnit{{Machine: "0/lxc/0/kvm/1"}},
+		}},
+	},
+	err: `cannot place unit of service "a": unsupported machine id "0/lxc/0/kvm/1"`,
+}, {
+	about: "invalid bundle",
+	model: charm.ModelDescription{
+		Services: []charm.ModelService{{Name: "a", Charm: "bad:a"}},
+	},
+	err: `cannot export bundle: invalid charm URL in service "a": .*`,
+}}
+
+func (*bundleExportSuite) TestNewBundleFromModelErrors(c *gc.C) {
+	for i, test := range newBundleFromModelErrorTests {
+		c.Logf("test %d: %s", i, test.about)
+		_, err := charm.NewBundleFromModel(test.model)
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
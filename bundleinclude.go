@@ -0,0 +1,102 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// includeFilePrefix prefixes service option values that
+	// are replaced by the contents of a file.
+	includeFilePrefix = "include-file://"
+
+	// includeBase64Prefix prefixes service option values that
+	// are replaced by the base64-encoded contents of a file.
+	includeBase64Prefix = "include-base64://"
+)
+
+// IncludeResolver returns the contents of the file with the given
+// path, as named by an include directive in a bundle.
+type IncludeResolver func(path string) ([]byte, error)
+
+// ReadBundleDataWithIncludes reads bundle data from the given
+// reader, as ReadBundleData does, and then resolves any include
+// directives in it with ResolveIncludes.
+func ReadBundleDataWithIncludes(r io.Reader, resolve IncludeResolver) (*BundleData, error) {
+	bd, err := ReadBundleData(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := bd.ResolveIncludes(resolve); err != nil {
+		return nil, err
+	}
+	return bd, nil
+}
+
+// ResolveIncludes replaces the service option values in the bundle
+// that are include directives with the contents of the files they
+// name, as returned by resolve. A value of the form
+// "include-file://path" is replaced by the contents of the file as
+// a string, and a value of the form "include-base64://path" is
+// replaced by the contents of the file encoded as base64.
+func (bd *BundleData) ResolveIncludes(resolve IncludeResolver) error {
+	for name, svc := range bd.Services {
+		if svc == nil {
+			continue
+		}
+		for key, value := range svc.Options {
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var path string
+			var encode bool
+			switch {
+			case strings.HasPrefix(s, includeFilePrefix):
+				path = s[len(includeFilePrefix):]
+			case strings.HasPrefix(s, includeBase64Prefix):
+				path, encode = s[len(includeBase64Prefix):], true
+			default:
+				continue
+			}
+			if path == "" {
+				return fmt.Errorf("cannot resolve option %q in service %q: empty include path", key, name)
+			}
+			data, err := resolve(path)
+			if err != nil {
+				return fmt.Errorf("cannot resolve option %q in service %q: %v", key, name, err)
+			}
+			if encode {
+				svc.Options[key] = base64.StdEncoding.EncodeToString(data)
+			} else {
+				svc.Options[key] = string(data)
+			}
+		}
+	}
+	return nil
+}
+
+// DirIncludeResolver returns an IncludeResolver that reads files
+// relative to the given directory, such as the directory holding
+// the bundle. Paths that refer to files outside the directory are
+// rejected.
+func DirIncludeResolver(dir string) IncludeResolver {
+	return func(path string) ([]byte, error) {
+		path = filepath.FromSlash(path)
+		if filepath.IsAbs(path) {
+			return nil, fmt.Errorf("include path %q is absolute", path)
+		}
+		path = filepath.Clean(path)
+		if path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("include path %q is outside the bundle directory", path)
+		}
+		return ioutil.ReadFile(filepath.Join(dir, path))
+	}
+}
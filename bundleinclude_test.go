@@ -0,0 +1,95 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type bundleIncludeSuite struct{}
+
+var _ = gc.Suite(&bundleIncludeSuite{})
+
+const includeBundle = `
+services:
+    wordpress:
+        charm: wordpress
+        num_units: 1
+        options:
+            blog-title: include-file://title.txt
+            logo: include-base64://images/logo.png
+            debug: true
+            name: include-nothing://x
+`
+
+func (*bundleIncludeSuite) TestReadBundleDataWithIncludes(c *gc.C) {
+	var paths []string
+	resolve := func(path string) ([]byte, error) {
+		paths = append(paths, path)
+		return []byte("contents of " + path), nil
+	}
+	bd, err := charm.ReadBundleDataWithIncludes(strings.NewReader(includeBundle), resolve)
+	c.Assert(err, gc.IsNil)
+	c.Assert(bd.Services["wordpress"].Options, gc.DeepEquals, map[string]interface{}{
+		"blog-title": "contents of title.txt",
+		"logo":       "Y29udGVudHMgb2YgaW1hZ2VzL2xvZ28ucG5n",
+		"debug":      true,
+		"name":       "include-nothing://x",
+	})
+	c.Assert(paths, gc.HasLen, 2)
+}
+
+func (*bundleIncludeSuite) TestResolveIncludesError(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(includeBundle))
+	c.Assert(err, gc.IsNil)
+	err = bd.ResolveIncludes(func(path string) ([]byte, error) {
+		if path == "title.txt" {
+			return nil, fmt.Errorf("no title")
+		}
+		return nil, nil
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot resolve option "blog-title" in service "wordpress": no title`)
+}
+
+func (*bundleIncludeSuite) TestResolveIncludesEmptyPath(c *gc.C) {
+	_, err := charm.ReadBundleDataWithIncludes(strings.NewReader(`
+services:
+    wordpress:
+        charm: wordpress
+        options:
+            blog-title: include-file://
+`), charm.DirIncludeResolver(c.MkDir()))
+	c.Assert(err, gc.ErrorMatches, `cannot resolve option "blog-title" in service "wordpress": empty include path`)
+}
+
+func (*bundleIncludeSuite) TestDirIncludeResolver(c *gc.C) {
+	dir := c.MkDir()
+	err := os.Mkdir(filepath.Join(dir, "images"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "images", "logo.png"), []byte("logo"), 0644)
+	c.Assert(err, gc.IsNil)
+	resolve := charm.DirIncludeResolver(dir)
+
+	data, err := resolve("images/logo.png")
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "logo")
+	data, err = resolve("images/../images/logo.png")
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "logo")
+
+	_, err = resolve("missing")
+	c.Assert(err, gc.ErrorMatches, "open .*missing: no such file or directory")
+	_, err = resolve("/etc/passwd")
+	c.Assert(err, gc.ErrorMatches, `include path "/etc/passwd" is absolute`)
+	_, err = resolve("images/../../secret")
+	c.Assert(err, gc.ErrorMatches, `include path "../secret" is outside the bundle directory`)
+}
@@ -0,0 +1,212 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+)
+
+// Merge applies the given overlay to the bundle, so that a base
+// bundle can be adapted to a particular environment by a small
+// overlay bundle. Where the overlay and the bundle both specify
+// something, the overlay takes precedence, as follows:
+//
+// - A service specified in the overlay with no content (a nil
+// *ServiceSpec) is removed from the bundle, along with the
+// relations that refer to it and the machines that only it
+// was placed on. It is an error if the bundle has no such
+// service.
+//
+// - A service that is not in the bundle is added to it.
+//
+// - For a service that is in the bundle, the charm, number of
+// units and constraints are replaced by those in the overlay if
+// they are not empty, and the placement directives are replaced
+// if the overlay specifies any. Options, annotations and storage
+// constraints are merged key by key; an option with a nil value in the overlay is removed,
+// so that the charm's default is used.
+//
+// - Machines are added or merged in the same way as services,
+// except that they cannot be removed.
+//
+// - Relations in the overlay are added to the bundle unless it
+// already holds them.
+//
+// - The series, description and tags are replaced by those in
+// the overlay if they are not empty.
+//
+// If Merge returns an error, the bundle is left unchanged.
+func (bd *BundleData) Merge(overlay *BundleData) error {
+	removed := make(map[string]bool)
+	for name, svc := range overlay.Services {
+		if svc != nil {
+			continue
+		}
+		if _, ok := bd.Services[name]; !ok {
+			return fmt.Errorf("cannot remove service %q: service not found in bundle", name)
+		}
+		removed[name] = true
+	}
+	if len(removed) > 0 {
+		bd.removeServices(removed)
+	}
+	for name, svc := range overlay.Services {
+		if svc == nil {
+			continue
+		}
+		base := bd.Services[name]
+		if base == nil {
+			if bd.Services == nil {
+				bd.Services = make(map[string]*ServiceSpec)
+			}
+			base = &ServiceSpec{}
+			bd.Services[name] = base
+		}
+		base.merge(svc)
+	}
+	for id, m := range overlay.Machines {
+		base, ok := bd.Machines[id]
+		if !ok || base == nil {
+			if bd.Machines == nil {
+				bd.Machines = make(map[string]*MachineSpec)
+			}
+			if m == nil {
+				bd.Machines[id] = nil
+				continue
+			}
+			base = &MachineSpec{}
+			bd.Machines[id] = base
+		}
+		if m == nil {
+			continue
+		}
+		if m.Constraints != "" {
+			base.Constraints = m.Constraints
+		}
+		base.Annotations = mergeAnnotations(base.Annotations, m.Annotations)
+	}
+	for _, rel := range overlay.Relations {
+		if !bd.hasRelation(rel) {
+			bd.Relations = append(bd.Relations, append([]string(nil), rel...))
+		}
+	}
+	if overlay.Series != "" {
+		bd.Series = overlay.Series
+	}
+	if overlay.Description != "" {
+		bd.Description = overlay.Description
+	}
+	if overlay.Tags != nil {
+		bd.Tags = append([]string(nil), overlay.Tags...)
+	}
+	return nil
+}
+
+// merge merges the overlay service into svc as described by
+// BundleData.Merge.
+func (svc *ServiceSpec) merge(overlay *ServiceSpec) {
+	if overlay.Charm != "" {
+		svc.Charm = overlay.Charm
+	}
+	if overlay.NumUnits != 0 {
+		svc.NumUnits = overlay.NumUnits
+	}
+	if overlay.Constraints != "" {
+		svc.Constraints = overlay.Constraints
+	}
+	if len(overlay.To) > 0 {
+		svc.To = append([]string(nil), overlay.To...)
+	}
+	for key, value := range overlay.Options {
+		if value == nil {
+			delete(svc.Options, key)
+			continue
+		}
+		if svc.Options == nil {
+			svc.Options = make(map[string]interface{})
+		}
+		svc.Options[key] = value
+	}
+	svc.Annotations = mergeAnnotations(svc.Annotations, overlay.Annotations)
+	svc.Storage = mergeAnnotations(svc.Storage, overlay.Storage)
+}
+
+func mergeAnnotations(base, overlay map[string]string) map[string]string {
+	for key, value := range overlay {
+		if base == nil {
+			base = make(map[string]string)
+		}
+		base[key] = value
+	}
+	return base
+}
+
+// removeServices removes the given services from the bundle,
+// along with their relations and any machines that are no
+// longer referred to once they have gone.
+func (bd *BundleData) removeServices(removed map[string]bool) {
+	before := bd.placedMachines()
+	for name := range removed {
+		delete(bd.Services, name)
+	}
+	after := bd.placedMachines()
+	for id := range before {
+		if !after[id] {
+			delete(bd.Machines, id)
+		}
+	}
+	relations := bd.Relations[:0]
+outer:
+	for _, rel := range bd.Relations {
+		for _, ep := range rel {
+			if parsed, err := parseEndpoint(ep); err == nil && removed[parsed.service] {
+				continue outer
+			}
+		}
+		relations = append(relations, rel)
+	}
+	bd.Relations = relations
+}
+
+// placedMachines returns the ids of the machines referred
+// to by unit placement directives.
+func (bd *BundleData) placedMachines() map[string]bool {
+	ids := make(map[string]bool)
+	for _, svc := range bd.Services {
+		if svc == nil {
+			continue
+		}
+		for _, p := range svc.To {
+			up, err := ParsePlacement(p)
+			if err == nil && up.Machine != "" && up.Machine != "new" {
+				ids[up.Machine] = true
+			}
+		}
+	}
+	return ids
+}
+
+// hasRelation reports whether the bundle holds the given
+// relation, with its endpoints in either order.
+func (bd *BundleData) hasRelation(rel []string) bool {
+	for _, r := range bd.Relations {
+		if len(r) != len(rel) {
+			continue
+		}
+		if len(r) == 2 && r[0] == rel[1] && r[1] == rel[0] {
+			return true
+		}
+		same := true
+		for i := range r {
+			if r[i] != rel[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
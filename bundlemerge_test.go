@@ -0,0 +1,149 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type bundleMergeSuite struct{}
+
+var _ = gc.Suite(&bundleMergeSuite{})
+
+const mergeBaseBundle = `
+series: precise
+description: A blog.
+machines:
+    0:
+        constraints: mem=2G
+    1:
+services:
+    wordpress:
+        charm: cs:precise/wordpress-20
+        num_units: 1
+        to: [0]
+        options:
+            blog-title: My Blog
+            debug: true
+        annotations:
+            gui-x: "10"
+    mysql:
+        charm: cs:precise/mysql-28
+        num_units: 1
+        to: [1]
+    varnish:
+        charm: cs:precise/varnish-1
+        num_units: 1
+        to: [0]
+relations:
+    - [wordpress:db, mysql:db]
+    - [wordpress, varnish]
+`
+
+const mergeOverlayBundle = `
+series: trusty
+machines:
+    0:
+        constraints: mem=8G
+        annotations:
+            rack: "3"
+services:
+    wordpress:
+        num_units: 2
+        to: [0, new]
+        constraints: cores=2
+        options:
+            blog-title: Production Blog
+            debug:
+        annotations:
+            gui-y: "20"
+    mysql:
+    pgsql:
+        charm: cs:trusty/postgresql-3
+        num_units: 1
+relations:
+    - [wordpress:db, pgsql:db]
+    - [varnish, wordpress]
+`
+
+func readBundleData(c *gc.C, data string) *charm.BundleData {
+	bd, err := charm.ReadBundleData(strings.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	return bd
+}
+
+func (*bundleMergeSuite) TestMerge(c *gc.C) {
+	bd := readBundleData(c, mergeBaseBundle)
+	err := bd.Merge(readBundleData(c, mergeOverlayBundle))
+	c.Assert(err, gc.IsNil)
+	c.Assert(bd, jc.DeepEquals, &charm.BundleData{
+		Series:      "trusty",
+		Description: "A blog.",
+		Machines: map[string]*charm.MachineSpec{
+			"0": {
+				Constraints: "mem=8G",
+				Annotations: map[string]string{"rack": "3"},
+			},
+		},
+		Services: map[string]*charm.ServiceSpec{
+			"wordpress": {
+				Charm:       "cs:precise/wordpress-20",
+				NumUnits:    2,
+				To:          []string{"0", "new"},
+				Constraints: "cores=2",
+				Options: map[string]interface{}{
+					"blog-title": "Production Blog",
+				},
+				Annotations: map[string]string{
+					"gui-x": "10",
+					"gui-y": "20",
+				},
+			},
+			"varnish": {
+				Charm:    "cs:precise/varnish-1",
+				NumUnits: 1,
+				To:       []string{"0"},
+			},
+			"pgsql": {
+				Charm:    "cs:trusty/postgresql-3",
+				NumUnits: 1,
+			},
+		},
+		Relations: [][]string{
+			{"wordpress", "varnish"},
+			{"wordpress:db", "pgsql:db"},
+		},
+	})
+	c.Assert(bd.Verify(nil), gc.IsNil)
+}
+
+func (*bundleMergeSuite) TestMergeDoesNotShareOverlayData(c *gc.C) {
+	bd := readBundleData(c, mergeBaseBundle)
+	overlay := readBundleData(c, mergeOverlayBundle)
+	err := bd.Merge(overlay)
+	c.Assert(err, gc.IsNil)
+	overlay.Services["pgsql"].Options = map[string]interface{}{"x": 1}
+	overlay.Services["wordpress"].To[0] = "1"
+	overlay.Relations[0][0] = "foo"
+	c.Assert(bd.Services["pgsql"].Options, gc.IsNil)
+	c.Assert(bd.Services["wordpress"].To, jc.DeepEquals, []string{"0", "new"})
+	c.Assert(bd.Relations[1], jc.DeepEquals, []string{"wordpress:db", "pgsql:db"})
+}
+
+func (*bundleMergeSuite) TestMergeRemoveUnknownService(c *gc.C) {
+	bd := readBundleData(c, mergeBaseBundle)
+	err := bd.Merge(readBundleData(c, `
+services:
+    wordpress:
+        num_units: 3
+    mongodb:
+`))
+	c.Assert(err, gc.ErrorMatches, `cannot remove service "mongodb": service not found in bundle`)
+	c.Assert(bd, jc.DeepEquals, readBundleData(c, mergeBaseBundle))
+}
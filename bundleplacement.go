@@ -0,0 +1,224 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PlacementError describes a problem with the placement of
+// a unit of a service in a bundle found by VerifyWithCharms.
+type PlacementError struct {
+	// Service holds the name of the service.
+	Service string
+
+	// Unit holds the number of the unit.
+	Unit int
+
+	// Placement holds the placement directive of the unit.
+	Placement string
+
+	// Reason holds the problem with the placement.
+	Reason string
+}
+
+func (err *PlacementError) Error() string {
+	return fmt.Sprintf("placement %q for unit %s/%d %s", err.Placement, err.Service, err.Unit, err.Reason)
+}
+
+// unitRef identifies a unit of a service in a bundle.
+type unitRef struct {
+	service string
+	unit    int
+}
+
+func (u unitRef) String() string {
+	return fmt.Sprintf("%s/%d", u.service, u.unit)
+}
+
+// expandedPlacement holds the placement of a single unit, with
+// the unit of any service it refers to made explicit.
+type expandedPlacement struct {
+	directive string
+	*UnitPlacement
+}
+
+// target returns the unit the placement co-locates
+// the unit with, and whether there is one.
+func (p expandedPlacement) target() (unitRef, bool) {
+	if p.UnitPlacement == nil || p.Service == "" {
+		return unitRef{}, false
+	}
+	return unitRef{p.Service, p.Unit}, true
+}
+
+// verifyUnitPlacements checks the placements of all the units of
+// the bundle's services, as expanded from their To fields, for
+// references to units that will not exist, containers nested
+// inside containers and units whose placements depend on each
+// other. Problems with individual directives are reported by
+// verifyPlacement and are not reported again.
+func (verifier *bundleDataVerifier) verifyUnitPlacements() {
+	placements, units := verifier.expandPlacements()
+	cyclic := verifier.verifyPlacementCycles(placements, units)
+	for _, u := range units {
+		p := placements[u]
+		target, ok := p.target()
+		if !ok || p.ContainerType == "" || cyclic[u] {
+			continue
+		}
+		if ctype, host := containerOf(placements, cyclic, target); ctype != "" {
+			verifier.addError(&PlacementError{
+				Service:   u.service,
+				Unit:      u.unit,
+				Placement: p.directive,
+				Reason:    fmt.Sprintf("would create a %s container inside the %s container holding unit %s", p.ContainerType, ctype, host),
+			})
+		}
+	}
+}
+
+// expandPlacements returns the placement of each unit of the
+// bundle's services that is placed on another unit, a machine or
+// a container, and all those units in order.
+func (verifier *bundleDataVerifier) expandPlacements() (map[unitRef]expandedPlacement, []unitRef) {
+	services := make([]string, 0, len(verifier.bd.Services))
+	for name := range verifier.bd.Services {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+	placements := make(map[unitRef]expandedPlacement)
+	var units []unitRef
+	for _, name := range services {
+		svc := verifier.bd.Services[name]
+		if len(svc.To) == 0 || svc.NumUnits <= 0 {
+			continue
+		}
+		// nextUnit holds the unit implied by a directive holding
+		// only the name of the service.
+		nextUnit := make(map[string]int)
+		for i := 0; i < svc.NumUnits; i++ {
+			directive := svc.To[len(svc.To)-1]
+			if i < len(svc.To) {
+				directive = svc.To[i]
+			}
+			up, err := ParsePlacement(directive)
+			if err != nil {
+				continue
+			}
+			u := unitRef{name, i}
+			if up.Service != "" {
+				target, ok := verifier.bd.Services[up.Service]
+				if !ok {
+					continue
+				}
+				implied := up.Unit < 0
+				if implied {
+					up.Unit = nextUnit[up.Service]
+				}
+				nextUnit[up.Service] = up.Unit + 1
+				if up.Unit >= target.NumUnits {
+					if implied {
+						verifier.addError(&PlacementError{
+							Service:   name,
+							Unit:      i,
+							Placement: directive,
+							Reason:    fmt.Sprintf("refers to unit %s/%d, but service %q has %d unit(s)", up.Service, up.Unit, up.Service, target.NumUnits),
+						})
+					}
+					continue
+				}
+			}
+			placements[u] = expandedPlacement{directive, up}
+			units = append(units, u)
+		}
+	}
+	return placements, units
+}
+
+// verifyPlacementCycles reports any units co-located with units
+// that, directly or indirectly, are co-located with them, so that
+// none of them can be placed first. Each cycle is reported once,
+// for its first unit. It returns the set of units in cycles.
+func (verifier *bundleDataVerifier) verifyPlacementCycles(placements map[unitRef]expandedPlacement, units []unitRef) map[unitRef]bool {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[unitRef]int)
+	cyclic := make(map[unitRef]bool)
+	for _, start := range units {
+		var path []unitRef
+		u, ok := start, true
+		for ok && state[u] == unvisited {
+			state[u] = visiting
+			path = append(path, u)
+			u, ok = placements[u].target()
+		}
+		if ok && state[u] == visiting {
+			// The path leads back to u, so the
+			// units from u onwards form a cycle.
+			for i, v := range path {
+				if v == u {
+					cycle := path[i:]
+					for _, w := range cycle {
+						cyclic[w] = true
+					}
+					verifier.addPlacementCycle(placements, cycle)
+					break
+				}
+			}
+		}
+		for _, v := range path {
+			state[v] = visited
+		}
+	}
+	return cyclic
+}
+
+func (verifier *bundleDataVerifier) addPlacementCycle(placements map[unitRef]expandedPlacement, cycle []unitRef) {
+	first := 0
+	for i, u := range cycle {
+		if u.service < cycle[first].service || u.service == cycle[first].service && u.unit < cycle[first].unit {
+			first = i
+		}
+	}
+	cycle = append(cycle[first:], cycle[:first]...)
+	names := make([]string, 0, len(cycle)+1)
+	for _, u := range cycle {
+		names = append(names, u.String())
+	}
+	names = append(names, cycle[0].String())
+	verifier.addError(&PlacementError{
+		Service:   cycle[0].service,
+		Unit:      cycle[0].unit,
+		Placement: placements[cycle[0]].directive,
+		Reason:    "is part of a co-location cycle: " + strings.Join(names, " -> "),
+	})
+}
+
+// containerOf returns the type of the container that will hold the
+// given unit, and the unit placed in it that caused the container
+// to be created, or the empty string if the unit will not be in a
+// container. Units in co-location cycles are never in containers.
+func containerOf(placements map[unitRef]expandedPlacement, cyclic map[unitRef]bool, u unitRef) (string, unitRef) {
+	for !cyclic[u] {
+		p, ok := placements[u]
+		if !ok {
+			break
+		}
+		if p.ContainerType != "" {
+			return p.ContainerType, u
+		}
+		next, ok := p.target()
+		if !ok {
+			break
+		}
+		u = next
+	}
+	return "", unitRef{}
+}
@@ -0,0 +1,117 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+var verifyPlacementTests = []struct {
+	about  string
+	data   string
+	errors []string
+}{{
+	about: "valid placements",
+	data: `
+machines:
+    0:
+services:
+    mysql:
+        charm: mysql
+        num_units: 2
+        to: [0, kvm:new]
+    wordpress:
+        charm: wordpress
+        num_units: 3
+        to: [mysql, mysql, lxc:mysql/0]
+    logging:
+        charm: logging
+        num_units: 1
+        to: [wordpress/2]
+`,
+}, {
+	about: "implied units that will not exist",
+	data: `
+services:
+    mysql:
+        charm: mysql
+        num_units: 1
+    wordpress:
+        charm: wordpress
+        num_units: 3
+        to: [mysql]
+`,
+	errors: []string{
+		`placement "mysql" for unit wordpress/1 refers to unit mysql/1, but service "mysql" has 1 unit(s)`,
+		`placement "mysql" for unit wordpress/2 refers to unit mysql/2, but service "mysql" has 1 unit(s)`,
+	},
+}, {
+	about: "nested containers",
+	data: `
+services:
+    mysql:
+        charm: mysql
+        num_units: 1
+        to: [lxc:new]
+    wordpress:
+        charm: wordpress
+        num_units: 1
+        to: [mysql/0]
+    logging:
+        charm: logging
+        num_units: 1
+        to: [kvm:wordpress/0]
+`,
+	errors: []string{
+		`placement "kvm:wordpress/0" for unit logging/0 would create a kvm container inside the lxc container holding unit mysql/0`,
+	},
+}, {
+	about: "co-location cycles",
+	data: `
+services:
+    mysql:
+        charm: mysql
+        num_units: 2
+        to: [wordpress/0, mysql/1]
+    wordpress:
+        charm: wordpress
+        num_units: 2
+        to: [logging/0, mysql/1]
+    logging:
+        charm: logging
+        num_units: 1
+        to: [lxc:mysql/0]
+`,
+	errors: []string{
+		`placement "lxc:mysql/0" for unit logging/0 is part of a co-location cycle: logging/0 -> mysql/0 -> wordpress/0 -> logging/0`,
+		`placement "mysql/1" for unit mysql/1 is part of a co-location cycle: mysql/1 -> mysql/1`,
+	},
+}}
+
+func (*bundleDataSuite) TestVerifyPlacements(c *gc.C) {
+	for i, test := range verifyPlacementTests {
+		c.Logf("test %d: %s", i, test.about)
+		assertVerifyWithCharmsErrors(c, test.data, nil, test.errors)
+	}
+}
+
+func (*bundleDataSuite) TestPlacementError(c *gc.C) {
+	bd, err := charm.ReadBundleData(strings.NewReader(verifyPlacementTests[2].data))
+	c.Assert(err, gc.IsNil)
+	err = bd.Verify(nil)
+	c.Assert(err, gc.FitsTypeOf, (*charm.VerificationError)(nil))
+	errs := err.(*charm.VerificationError).Errors
+	c.Assert(errs, gc.HasLen, 1)
+	c.Assert(errs[0], jc.DeepEquals, &charm.PlacementError{
+		Service:   "logging",
+		Unit:      0,
+		Placement: "kvm:wordpress/0",
+		Reason:    "would create a kvm container inside the lxc container holding unit mysql/0",
+	})
+}
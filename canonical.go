@@ -0,0 +1,65 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// CanonicalBytes returns a canonical encoding of the metadata, as
+// JSON with object keys in sorted order, suitable for hashing. The
+// encoding depends only on the meaning of the metadata, not on how
+// its metadata.yaml file was written: metadata read from files
+// differing only in formatting, field order, the shorthand used for
+// relations or in fields holding their default values encodes to
+// the same bytes, so that identical metadata can be recognized
+// across revisions.
+func (meta Meta) CanonicalBytes() ([]byte, error) {
+	doc := make(map[string]interface{})
+	for _, field := range metaDocFields(&meta) {
+		for name, value := range field {
+			if !isEmptyValue(value) {
+				doc[name] = value
+			}
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// CanonicalBytes returns a canonical encoding of the configuration,
+// as JSON with object keys in sorted order, suitable for hashing. The
+// encoding depends only on the meaning of the configuration, not on
+// how its config.yaml file was written.
+func (c *Config) CanonicalBytes() ([]byte, error) {
+	options := make(map[string]interface{})
+	for name, option := range configDocOf(c).Options {
+		o := map[string]interface{}{
+			"type": option.Type,
+		}
+		if !isEmptyValue(option.Description) {
+			o["description"] = option.Description
+		}
+		if option.Default != nil {
+			o["default"] = option.Default
+		}
+		options[name] = o
+	}
+	return json.Marshal(map[string]interface{}{
+		"options": options,
+	})
+}
+
+// isEmptyValue reports whether v is nil, an
+// empty string or an empty slice or map.
+func isEmptyValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type CanonicalSuite struct{}
+
+var _ = gc.Suite(&CanonicalSuite{})
+
+var canonicalMetaTests = []struct {
+	about string
+	a, b  string
+	same  bool
+}{{
+	about: "formatting and field order",
+	a:     "name: x\nsummary: s\ndescription: d\ntags: [a, b]\n",
+	b:     "tags:\n  - a\n  - b\ndescription: \"d\"\nsummary: 's'\nname: x\n",
+	same:  true,
+}, {
+	about: "relation shorthand",
+	a:     "name: x\nsummary: s\ndescription: d\nrequires:\n  db: mysql\n",
+	b:     "name: x\nsummary: s\ndescription: d\nrequires:\n  db:\n    interface: mysql\n    limit: 1\n    scope: global\n    optional: false\n",
+	same:  true,
+}, {
+	about: "default values",
+	a:     "name: x\nsummary: s\ndescription: d\n",
+	b:     "name: x\nsummary: s\ndescription: d\nformat: 1\nsubordinate: false\nprovides: {}\ntags: []\n",
+	same:  true,
+}, {
+	about: "different values",
+	a:     "name: x\nsummary: s\ndescription: d\n",
+	b:     "name: x\nsummary: s\ndescription: e\n",
+}, {
+	about: "different relation limit",
+	a:     "name: x\nsummary: s\ndescription: d\nrequires:\n  db: mysql\n",
+	b:     "name: x\nsummary: s\ndescription: d\nrequires:\n  db:\n    interface: mysql\n    limit: 2\n",
+}}
+
+func (s *CanonicalSuite) TestMetaCanonicalBytes(c *gc.C) {
+	for i, test := range canonicalMetaTests {
+		c.Logf("test %d: %s", i, test.about)
+		a, err := charm.ReadMeta(strings.NewReader(test.a))
+		c.Assert(err, gc.IsNil)
+		b, err := charm.ReadMeta(strings.NewReader(test.b))
+		c.Assert(err, gc.IsNil)
+		aBytes, err := a.CanonicalBytes()
+		c.Assert(err, gc.IsNil)
+		bBytes, err := b.CanonicalBytes()
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(aBytes) == string(bBytes), gc.Equals, test.same, gc.Commentf("%s\n%s", aBytes, bBytes))
+	}
+}
+
+func (s *CanonicalSuite) TestMetaCanonicalBytesFormat(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader("summary: s\nname: x\ndescription: d\nrequires:\n  db: mysql\n"))
+	c.Assert(err, gc.IsNil)
+	data, err := meta.CanonicalBytes()
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `{"description":"d","name":"x","requires":{"db":"mysql"},"summary":"s"}`)
+}
+
+func (s *CanonicalSuite) TestConfigCanonicalBytes(c *gc.C) {
+	a, err := charm.ReadConfig(strings.NewReader(`
+options:
+  title: {type: string, default: My Title, description: The title.}
+  port: {type: int, default: 80, description: ""}
+`))
+	c.Assert(err, gc.IsNil)
+	b, err := charm.ReadConfig(strings.NewReader(`
+options:
+  port:
+    default: 80
+    type: int
+  title:
+    description: "The title."
+    type: string
+    default: "My Title"
+`))
+	c.Assert(err, gc.IsNil)
+	aBytes, err := a.CanonicalBytes()
+	c.Assert(err, gc.IsNil)
+	bBytes, err := b.CanonicalBytes()
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(aBytes), gc.Equals, string(bBytes))
+	c.Assert(string(aBytes), gc.Equals, `{"options":{"port":{"default":80,"type":"int"},"title":{"default":"My Title","description":"The title.","type":"string"}}}`)
+
+	b.Options["port"] = charm.Option{Type: "int", Default: int64(8080)}
+	bBytes, err = b.CanonicalBytes()
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(aBytes), gc.Not(gc.Equals), string(bBytes))
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 
 	"github.com/juju/utils/set"
 	ziputil "github.com/juju/utils/zip"
@@ -25,22 +26,42 @@ type CharmArchive struct {
 
 	Path     string // May be empty if CharmArchive wasn't read from a file
 	meta     *Meta
-	config   *Config
 	metrics  *Metrics
-	actions  *Actions
 	revision int
+	stats    *ArchiveStats
+
+	// metaSourceMap holds the source map of the
+	// archive's metadata; see MetaSourceMap.
+	metaSourceMap SourceMap
+
+	// config and actions are read from the archive
+	// when first needed; see LoadConfig and LoadActions.
+	configOnce  sync.Once
+	config      *Config
+	configErr   error
+	actionsOnce sync.Once
+	actions     *Actions
+	actionsErr  error
 }
 
 // Trick to ensure *CharmArchive implements the Charm interface.
 var _ Charm = (*CharmArchive)(nil)
 
 // ReadCharmArchive returns a CharmArchive for the charm in path.
+//
+// Only the archive's metadata.yaml, revision and metrics.yaml files
+// are read and validated; config.yaml and actions.yaml are read when
+// first needed, so an archive holding invalid ones is not rejected.
+// Use LoadConfig and LoadActions, or Verify, to validate them. The
+// same applies to the other functions that read charm archives.
 func ReadCharmArchive(path string) (*CharmArchive, error) {
-	a, err := readCharmArchive(newZipOpenerFromPath(path))
+	a, err := readCharmArchive(newZipOpenerFromPath(path), nil)
 	if err != nil {
+		auditRead(nil, path, err)
 		return nil, err
 	}
 	a.Path = path
+	auditRead(a, path, nil)
 	return a, nil
 }
 
@@ -48,7 +69,9 @@ func ReadCharmArchive(path string) (*CharmArchive, error) {
 // Make sure the archive fits in memory before using this.
 func ReadCharmArchiveBytes(data []byte) (archive *CharmArchive, err error) {
 	zopener := newZipOpenerFromReader(bytes.NewReader(data), int64(len(data)))
-	return readCharmArchive(zopener)
+	archive, err = readCharmArchive(zopener, nil)
+	auditRead(archive, "", err)
+	return archive, err
 }
 
 // ReadCharmArchiveFromReader returns a CharmArchive that uses
@@ -58,10 +81,15 @@ func ReadCharmArchiveBytes(data []byte) (archive *CharmArchive, err error) {
 // Note that the caller is responsible for closing r - methods on
 // the returned CharmArchive may fail after that.
 func ReadCharmArchiveFromReader(r io.ReaderAt, size int64) (archive *CharmArchive, err error) {
-	return readCharmArchive(newZipOpenerFromReader(r, size))
+	archive, err = readCharmArchive(newZipOpenerFromReader(r, size), nil)
+	auditRead(archive, "", err)
+	return archive, err
 }
 
-func readCharmArchive(zopen zipOpener) (archive *CharmArchive, err error) {
+// readCharmArchive reads the charm archive opened by zopen. If scanner
+// is not nil, the archive's files are passed to it once the charm has
+// been read.
+func readCharmArchive(zopen zipOpener, scanner ContentScanner) (archive *CharmArchive, err error) {
 	b := &CharmArchive{
 		zopen: zopen,
 	}
@@ -70,30 +98,13 @@ func readCharmArchive(zopen zipOpener) (archive *CharmArchive, err error) {
 		return nil, err
 	}
 	defer zipr.Close()
-	reader, err := zipOpenFile(zipr, "metadata.yaml")
+	b.stats = recordedArchiveStats(zipr.Reader)
+	b.meta, b.metaSourceMap, b.revision, err = readArchiveMeta(zipr)
 	if err != nil {
 		return nil, err
 	}
-	b.meta, err = ReadMeta(reader)
-	reader.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	reader, err = zipOpenFile(zipr, "config.yaml")
-	if _, ok := err.(*noCharmArchiveFile); ok {
-		b.config = NewConfig()
-	} else if err != nil {
-		return nil, err
-	} else {
-		b.config, err = ReadConfig(reader)
-		reader.Close()
-		if err != nil {
-			return nil, err
-		}
-	}
 
-	reader, err = zipOpenFile(zipr, "metrics.yaml")
+	reader, err := zipOpenFile(zipr, MetricsFile)
 	if err == nil {
 		b.metrics, err = ReadMetrics(reader)
 		reader.Close()
@@ -104,33 +115,42 @@ func readCharmArchive(zopen zipOpener) (archive *CharmArchive, err error) {
 		return nil, err
 	}
 
-	reader, err = zipOpenFile(zipr, "actions.yaml")
-	if _, ok := err.(*noCharmArchiveFile); ok {
-		b.actions = NewActions()
-	} else if err != nil {
-		return nil, err
-	} else {
-		b.actions, err = ReadActionsYaml(reader)
-		reader.Close()
-		if err != nil {
+	if scanner != nil {
+		if err := scanZip(zipr.Reader, scanner); err != nil {
 			return nil, err
 		}
 	}
+	return b, nil
+}
 
-	reader, err = zipOpenFile(zipr, "revision")
+// readArchiveMeta reads the metadata, with its source map, and the
+// revision of the charm in the given archive. It returns an
+// *EncryptedMembersError if any file in the archive is encrypted.
+func readArchiveMeta(zipr *zipReadCloser) (meta *Meta, sourceMap SourceMap, revision int, err error) {
+	if err := checkEncryptedMembers(zipr.File); err != nil {
+		return nil, nil, 0, err
+	}
+	reader, err := zipOpenFile(zipr, MetadataFile)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	meta, sourceMap, err = ReadMetaWithSourceMap(reader)
+	reader.Close()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	reader, err = zipOpenFile(zipr, RevisionFile)
 	if err != nil {
 		if _, ok := err.(*noCharmArchiveFile); !ok {
-			return nil, err
-		}
-		b.revision = b.meta.OldRevision
-	} else {
-		_, err = fmt.Fscan(reader, &b.revision)
-		if err != nil {
-			return nil, errors.New("invalid revision file")
+			return nil, nil, 0, err
 		}
+		return meta, sourceMap, meta.OldRevision, nil
 	}
-
-	return b, nil
+	defer reader.Close()
+	if _, err := fmt.Fscan(reader, &revision); err != nil {
+		return nil, nil, 0, errors.New("invalid revision file")
+	}
+	return meta, sourceMap, revision, nil
 }
 
 func zipOpenFile(zipr *zipReadCloser, path string) (rc io.ReadCloser, err error) {
@@ -169,9 +189,32 @@ func (a *CharmArchive) Meta() *Meta {
 }
 
 // Config returns the Config representing the config.yaml file
-// for the charm archive.
+// for the charm archive. The file is read when first needed; if it
+// cannot be read, the error is logged and an empty Config returned.
+// Use LoadConfig to find out about such errors.
 func (a *CharmArchive) Config() *Config {
-	return a.config
+	config, err := a.LoadConfig()
+	if err != nil {
+		logger.Errorf("cannot read charm config: %v", err)
+		return NewConfig()
+	}
+	return config
+}
+
+// LoadConfig returns the Config representing the config.yaml file
+// for the charm archive, reading it from the archive the first time
+// it is called. It is safe to call concurrently.
+func (a *CharmArchive) LoadConfig() (*Config, error) {
+	a.configOnce.Do(func() {
+		a.configErr = a.readMember(ConfigFile, func(r io.Reader) (err error) {
+			a.config, err = ReadConfig(r)
+			return err
+		})
+		if a.configErr == nil && a.config == nil {
+			a.config = NewConfig()
+		}
+	})
+	return a.config, a.configErr
 }
 
 // Metrics returns the Metrics representing the metrics.yaml file
@@ -180,10 +223,53 @@ func (a *CharmArchive) Metrics() *Metrics {
 	return a.metrics
 }
 
-// Actions returns the Actions map for the actions.yaml file for the charm
-// archive.
+// Actions returns the Actions map for the actions.yaml file for the
+// charm archive. The file is read when first needed; if it cannot be
+// read, the error is logged and empty Actions returned. Use LoadActions
+// to find out about such errors.
 func (a *CharmArchive) Actions() *Actions {
-	return a.actions
+	actions, err := a.LoadActions()
+	if err != nil {
+		logger.Errorf("cannot read charm actions: %v", err)
+		return NewActions()
+	}
+	return actions
+}
+
+// LoadActions returns the Actions map for the actions.yaml file for
+// the charm archive, reading it from the archive the first time it is
+// called. It is safe to call concurrently.
+func (a *CharmArchive) LoadActions() (*Actions, error) {
+	a.actionsOnce.Do(func() {
+		a.actionsErr = a.readMember(ActionsFile, func(r io.Reader) (err error) {
+			a.actions, err = ReadActionsYaml(r)
+			return err
+		})
+		if a.actionsErr == nil && a.actions == nil {
+			a.actions = NewActions()
+		}
+	})
+	return a.actions, a.actionsErr
+}
+
+// readMember calls decode with the contents of the archive file
+// with the given name. If the archive has no such file, decode is
+// not called.
+func (a *CharmArchive) readMember(name string, decode func(io.Reader) error) error {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return err
+	}
+	defer zipr.Close()
+	r, err := zipOpenFile(zipr, name)
+	if _, ok := err.(*noCharmArchiveFile); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return decode(r)
 }
 
 type zipReadCloser struct {
@@ -191,10 +277,32 @@ type zipReadCloser struct {
 	*zip.Reader
 }
 
+// openCharmZip returns the contents of the given charm, which must
+// be a *CharmDir or a *CharmArchive, as a zip archive. The contents
+// of a charm directory are those that would be archived by
+// ArchiveTo, without a revision file.
+func openCharmZip(ch Charm) (*zipReadCloser, error) {
+	switch ch := ch.(type) {
+	case *CharmDir:
+		var buf bytes.Buffer
+		if err := writeArchive(&buf, ch.Path, -1, ch.Meta().Hooks(), nil); err != nil {
+			return nil, err
+		}
+		return newZipOpenerFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())).openZip()
+	case *CharmArchive:
+		return ch.zopen.openZip()
+	}
+	return nil, fmt.Errorf("unsupported charm type %T", ch)
+}
+
 // zipOpener holds the information needed to open a zip
 // file.
 type zipOpener interface {
 	openZip() (*zipReadCloser, error)
+
+	// open returns a reader of the raw
+	// bytes of the archive.
+	open() (io.ReadCloser, error)
 }
 
 // newZipOpenerFromPath returns a zipOpener that can be
@@ -235,6 +343,10 @@ func (zo *zipPathOpener) openZip() (*zipReadCloser, error) {
 	return &zipReadCloser{Closer: f, Reader: r}, nil
 }
 
+func (zo *zipPathOpener) open() (io.ReadCloser, error) {
+	return os.Open(zo.path)
+}
+
 type zipReaderOpener struct {
 	r    io.ReaderAt
 	size int64
@@ -248,6 +360,10 @@ func (zo *zipReaderOpener) openZip() (*zipReadCloser, error) {
 	return &zipReadCloser{Closer: ioutil.NopCloser(nil), Reader: r}, nil
 }
 
+func (zo *zipReaderOpener) open() (io.ReadCloser, error) {
+	return ioutil.NopCloser(io.NewSectionReader(zo.r, 0, zo.size)), nil
+}
+
 // Manifest returns a set of the charm's contents.
 func (a *CharmArchive) Manifest() (set.Strings, error) {
 	zipr, err := a.zopen.openZip()
@@ -262,7 +378,7 @@ func (a *CharmArchive) Manifest() (set.Strings, error) {
 	manifest := set.NewStrings(paths...)
 	// We always write out a revision file, even if there isn't one in the
 	// archive; and we always strip ".", because that's sometimes not present.
-	manifest.Add("revision")
+	manifest.Add(RevisionFile)
 	manifest.Remove(".")
 	return manifest, nil
 }
@@ -271,42 +387,126 @@ func (a *CharmArchive) Manifest() (set.Strings, error) {
 // If any errors occur during the expansion procedure, the process will
 // abort.
 func (a *CharmArchive) ExpandTo(dir string) error {
-	zipr, err := a.zopen.openZip()
+	return a.expandTo(a.zopen, dir)
+}
+
+// expandTo expands the archive opened by zopen into
+// dir, recording the operation.
+func (a *CharmArchive) expandTo(zopen zipOpener, dir string) (err error) {
+	defer func() {
+		audit(AuditExpand, dir, a, archiveSHA256(a), err)
+	}()
+	return a.extractTo(zopen, dir)
+}
+
+// extractTo extracts the archive opened by zopen into dir,
+// making hooks and actions executable and writing the
+// revision file.
+func (a *CharmArchive) extractTo(zopen zipOpener, dir string) error {
+	zipr, err := zopen.openZip()
 	if err != nil {
 		return err
 	}
 	defer zipr.Close()
+	if err := os.Remove(filepath.Join(dir, digestStampFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	reportUnportableNames(zipr.File)
 	if err := ziputil.ExtractAll(zipr.Reader, dir); err != nil {
+		reportRejectedSymlinks(zipr.File)
 		return err
 	}
-	hooksDir := filepath.Join(dir, "hooks")
-	fixHook := fixHookFunc(hooksDir, a.meta.Hooks())
-	if err := filepath.Walk(hooksDir, fixHook); err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
+	if err := fixExecutables(dir, HooksDir, a.meta.Hooks(), EventHookMadeExecutable); err != nil {
+		return err
 	}
-	revFile, err := os.Create(filepath.Join(dir, "revision"))
+	// The charm's config and actions are validated so that the
+	// expanded charm can be read, and actions made executable.
+	if _, err := a.LoadConfig(); err != nil {
+		return err
+	}
+	actions, err := a.LoadActions()
+	if err != nil {
+		return err
+	}
+	if err := fixExecutables(dir, ActionsDir, actionNames(actions), EventActionMadeExecutable); err != nil {
+		return err
+	}
+	revFile, err := os.Create(filepath.Join(dir, RevisionFile))
 	if err != nil {
 		return err
 	}
 	_, err = revFile.Write([]byte(strconv.Itoa(a.revision)))
 	revFile.Close()
-	return err
+	if err != nil {
+		return err
+	}
+	// The stamp is written last, so that it is only
+	// present once the charm is fully expanded.
+	return writeDigestStamp(zopen, dir)
+}
+
+// reportRejectedSymlinks reports an EventSymlinkRejected event
+// for each of the given files that is a symlink pointing outside
+// the charm, which would cause extraction to fail.
+func reportRejectedSymlinks(files []*zip.File) {
+	for _, fh := range files {
+		if fh.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := readZipFile(fh)
+		if err != nil {
+			continue
+		}
+		if checkSymlinkTarget("", fh.Name, string(target)) != nil {
+			logEvent("expand", EventSymlinkRejected, fh.Name, "target", string(target))
+		}
+	}
 }
 
-// fixHookFunc returns a WalkFunc that makes sure hooks are owner-executable.
-func fixHookFunc(hooksDir string, hookNames map[string]bool) filepath.WalkFunc {
+// reportUnportableNames reports an EventUnportableName event for
+// each problem found by CheckMemberNames in the names of the given
+// files, which may prevent the charm from being extracted, or
+// extracted intact, on other filesystems.
+func reportUnportableNames(files []*zip.File) {
+	names := make([]string, len(files))
+	for i, fh := range files {
+		names[i] = fh.Name
+	}
+	for _, p := range memberNameProblems(names) {
+		logEvent("expand", EventUnportableName, p.path, "problem", p.problem)
+	}
+}
+
+// fixExecutables makes sure that the files with the given names
+// in the given subdirectory of dir are owner-executable, reporting
+// the given event for each file changed.
+func fixExecutables(dir, subdir string, names map[string]bool, event string) error {
+	execDir := filepath.Join(dir, subdir)
+	err := filepath.Walk(execDir, fixExecutablesFunc(execDir, subdir, names, event))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// fixExecutablesFunc returns a WalkFunc that makes sure the named
+// files directly within execDir, or the files they are symbolic
+// links to, are owner-executable.
+func fixExecutablesFunc(execDir, subdir string, names map[string]bool, event string) filepath.WalkFunc {
 	return func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		mode := info.Mode()
-		if path != hooksDir && mode.IsDir() {
+		if path != execDir && mode.IsDir() {
 			return filepath.SkipDir
 		}
-		if name := filepath.Base(path); hookNames[name] {
+		if name := filepath.Base(path); path != execDir && names[name] {
+			if mode&os.ModeSymlink != 0 {
+				return fixLinkedExecutable(filepath.Dir(execDir), path, event)
+			}
 			if mode&0100 == 0 {
+				logEvent("expand", event, subdir+"/"+name)
 				return os.Chmod(path, mode|0100)
 			}
 		}
@@ -12,6 +12,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"syscall"
 
 	jc "github.com/juju/testing/checkers"
@@ -103,6 +104,59 @@ func (s *CharmArchiveSuite) TestReadCharmArchiveWithoutActions(c *gc.C) {
 	c.Assert(archive.Actions().ActionSpecs, gc.HasLen, 0)
 }
 
+func (s *CharmArchiveSuite) TestConfigAndActionsReadLazily(c *gc.C) {
+	// Invalid config and actions do not prevent the
+	// archive from being read.
+	data := writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"config.yaml", "options: 42\n"},
+		[2]string{"actions.yaml", "actions:\n  BAD: {}\n"},
+	)
+	archive, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "verified")
+
+	_, err = archive.LoadConfig()
+	c.Assert(err, gc.NotNil)
+	c.Assert(archive.Config().Options, gc.HasLen, 0)
+	_, err = archive.LoadActions()
+	c.Assert(err, gc.ErrorMatches, ".*bad action name BAD")
+	c.Assert(archive.Actions().ActionSpecs, gc.HasLen, 0)
+}
+
+func (s *CharmArchiveSuite) TestConfigReadOnce(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "archive.charm")
+	err := ioutil.WriteFile(path, writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"config.yaml", "options:\n  title: {type: string, description: t}\n"},
+	), 0644)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+
+	var wg sync.WaitGroup
+	configs := make([]*charm.Config, 10)
+	for i := range configs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			configs[i] = archive.Config()
+		}(i)
+	}
+	wg.Wait()
+	for _, config := range configs {
+		c.Assert(config, gc.Equals, configs[0])
+	}
+	c.Assert(configs[0].Options, gc.HasLen, 1)
+
+	// Once read, the config is not read again.
+	err = os.Remove(path)
+	c.Assert(err, gc.IsNil)
+	config, err := archive.LoadConfig()
+	c.Assert(err, gc.IsNil)
+	c.Assert(config, gc.Equals, configs[0])
+}
+
 func (s *CharmArchiveSuite) TestReadCharmArchiveBytes(c *gc.C) {
 	data, err := ioutil.ReadFile(s.archivePath)
 	c.Assert(err, gc.IsNil)
@@ -140,6 +194,9 @@ func (s *CharmArchiveSuite) TestManifestNoRevision(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	err = os.Remove(filepath.Join(dirPath, "revision"))
 	c.Assert(err, gc.IsNil)
+	// The digest stamp is not part of the charm.
+	err = os.Remove(filepath.Join(dirPath, ".charm-digest"))
+	c.Assert(err, gc.IsNil)
 
 	archive = extCharmArchiveDir(c, dirPath)
 	manifest, err := archive.Manifest()
@@ -358,6 +415,21 @@ func (s *CharmArchiveSuite) TestExpandToWithBadLink(c *gc.C) {
 	c.Assert(err, gc.ErrorMatches, `cannot extract "hooks/badlink": symlink "/target" is absolute`)
 }
 
+func (s *CharmArchiveSuite) TestExpandToWithBadActions(c *gc.C) {
+	charmDir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	writeCharmFile(c, charmDir, "actions.yaml", "snapshot:\n  params: [oops\n", 0644)
+
+	// The archive is read without validating its actions...
+	archive := extCharmArchiveDir(c, charmDir)
+
+	// ... but they are validated when it is expanded.
+	path := filepath.Join(c.MkDir(), "charm")
+	err := archive.ExpandTo(path)
+	c.Assert(err, gc.ErrorMatches, `invalid actions: line 2, column 3: did not find expected ',' or '\]'`)
+	_, err = archive.LoadActions()
+	c.Assert(err, gc.NotNil)
+}
+
 func extCharmArchiveDirPath(c *gc.C, dirpath string) string {
 	path := filepath.Join(c.MkDir(), "archive.charm")
 	cmd := exec.Command("/bin/sh", "-c", fmt.Sprintf("cd %s; zip --fifo --symlinks -r %s .", dirpath, path))
@@ -5,14 +5,19 @@ package charm
 
 import (
 	"archive/zip"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+
+	"golang.org/x/net/context"
 )
 
 // The CharmDir type encapsulates access to data and operations
@@ -24,25 +29,73 @@ type CharmDir struct {
 	metrics  *Metrics
 	actions  *Actions
 	revision int
+
+	// metaSourceMap holds the source map of the metadata
+	// read from the directory; see MetaSourceMap.
+	metaSourceMap SourceMap
+
+	// changed holds the names of the files that
+	// must be written by Save.
+	changed map[string]bool
+
+	// readOnly holds whether the directory was opened
+	// by ReadCharmDirReadOnly.
+	readOnly bool
 }
 
+// ErrReadOnly is returned by the methods of a CharmDir opened
+// by ReadCharmDirReadOnly that would change it.
+var ErrReadOnly = errors.New("charm directory is read-only")
+
 // Trick to ensure *CharmDir implements the Charm interface.
 var _ Charm = (*CharmDir)(nil)
 
 // ReadCharmDir returns a CharmDir representing an expanded charm directory.
-func ReadCharmDir(path string) (dir *CharmDir, err error) {
+func ReadCharmDir(path string) (*CharmDir, error) {
+	dir, err := readCharmDir(path)
+	if err != nil {
+		audit(AuditRead, path, nil, nil, err)
+		return nil, err
+	}
+	audit(AuditRead, path, dir, nil, nil)
+	return dir, nil
+}
+
+// ReadCharmDirReadOnly is like ReadCharmDir except that the returned
+// CharmDir cannot be changed: SetRevision and the methods that would
+// write to the directory, such as Save, SetDiskRevision, BumpRevision,
+// NormalizePermissions and WriteProvenance, return ErrReadOnly, as
+// does RenameRelation. Reading and archiving the charm never creates
+// or changes files in the directory, so read-only charm directories
+// are suitable for caches shared between processes or users.
+func ReadCharmDirReadOnly(path string) (*CharmDir, error) {
+	dir, err := ReadCharmDir(path)
+	if err != nil {
+		return nil, err
+	}
+	dir.readOnly = true
+	return dir, nil
+}
+
+// ReadOnly reports whether the charm directory
+// was opened by ReadCharmDirReadOnly.
+func (dir *CharmDir) ReadOnly() bool {
+	return dir.readOnly
+}
+
+func readCharmDir(path string) (dir *CharmDir, err error) {
 	dir = &CharmDir{Path: path}
-	file, err := os.Open(dir.join("metadata.yaml"))
+	file, err := os.Open(dir.join(MetadataFile))
 	if err != nil {
 		return nil, err
 	}
-	dir.meta, err = ReadMeta(file)
+	dir.meta, dir.metaSourceMap, err = ReadMetaWithSourceMap(file)
 	file.Close()
 	if err != nil {
 		return nil, err
 	}
 
-	file, err = os.Open(dir.join("config.yaml"))
+	file, err = os.Open(dir.join(ConfigFile))
 	if _, ok := err.(*os.PathError); ok {
 		dir.config = NewConfig()
 	} else if err != nil {
@@ -55,7 +108,7 @@ func ReadCharmDir(path string) (dir *CharmDir, err error) {
 		}
 	}
 
-	file, err = os.Open(dir.join("metrics.yaml"))
+	file, err = os.Open(dir.join(MetricsFile))
 	if err == nil {
 		dir.metrics, err = ReadMetrics(file)
 		file.Close()
@@ -66,7 +119,7 @@ func ReadCharmDir(path string) (dir *CharmDir, err error) {
 		return nil, err
 	}
 
-	file, err = os.Open(dir.join("actions.yaml"))
+	file, err = os.Open(dir.join(ActionsFile))
 	if _, ok := err.(*os.PathError); ok {
 		dir.actions = NewActions()
 	} else if err != nil {
@@ -79,7 +132,7 @@ func ReadCharmDir(path string) (dir *CharmDir, err error) {
 		}
 	}
 
-	if file, err = os.Open(dir.join("revision")); err == nil {
+	if file, err = os.Open(dir.join(RevisionFile)); err == nil {
 		_, err = fmt.Fscan(file, &dir.revision)
 		file.Close()
 		if err != nil {
@@ -133,15 +186,22 @@ func (dir *CharmDir) Actions() *Actions {
 // the revision reported by Revision and the revision of the
 // charm archived by ArchiveTo.
 // The revision file in the charm directory is not modified.
-func (dir *CharmDir) SetRevision(revision int) {
+// It returns ErrReadOnly if the charm directory is read-only.
+func (dir *CharmDir) SetRevision(revision int) error {
+	if dir.readOnly {
+		return ErrReadOnly
+	}
 	dir.revision = revision
+	return nil
 }
 
 // SetDiskRevision does the same as SetRevision but also changes
 // the revision file in the charm directory.
 func (dir *CharmDir) SetDiskRevision(revision int) error {
-	dir.SetRevision(revision)
-	file, err := os.OpenFile(dir.join("revision"), os.O_WRONLY|os.O_CREATE, 0644)
+	if err := dir.SetRevision(revision); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(dir.join(RevisionFile), os.O_WRONLY|os.O_CREATE, 0644)
 	if err != nil {
 		return err
 	}
@@ -150,6 +210,101 @@ func (dir *CharmDir) SetDiskRevision(revision int) error {
 	return err
 }
 
+// SetMeta changes the charm metadata returned by Meta.
+// The metadata.yaml file in the charm directory, and so the
+// charm archived by ArchiveTo, is not modified until Save
+// is called.
+func (dir *CharmDir) SetMeta(meta *Meta) {
+	dir.meta = meta
+	dir.metaSourceMap = nil
+	dir.setChanged(MetadataFile)
+}
+
+// SetConfig changes the charm configuration, as SetMeta does
+// for the metadata.
+func (dir *CharmDir) SetConfig(config *Config) {
+	dir.config = config
+	dir.setChanged(ConfigFile)
+}
+
+// SetActions changes the charm actions, as SetMeta does for
+// the metadata.
+func (dir *CharmDir) SetActions(actions *Actions) {
+	dir.actions = actions
+	dir.setChanged(ActionsFile)
+}
+
+func (dir *CharmDir) setChanged(name string) {
+	if dir.changed == nil {
+		dir.changed = make(map[string]bool)
+	}
+	dir.changed[name] = true
+}
+
+// Save writes the metadata, configuration and actions changed
+// by SetMeta, SetConfig and SetActions to the metadata.yaml,
+// config.yaml and actions.yaml files in the charm directory.
+// Comments in the files being replaced are kept where possible:
+// a block of comments on the lines before a value is kept
+// before that value if it is still present.
+func (dir *CharmDir) Save() error {
+	if dir.readOnly {
+		return ErrReadOnly
+	}
+	for _, name := range []string{MetadataFile, ConfigFile, ActionsFile} {
+		if !dir.changed[name] {
+			continue
+		}
+		if err := dir.save(name); err != nil {
+			return fmt.Errorf("cannot save %s: %v", name, err)
+		}
+		delete(dir.changed, name)
+	}
+	return nil
+}
+
+// save writes the file with the given name.
+func (dir *CharmDir) save(name string) error {
+	var data []byte
+	var err error
+	switch name {
+	case MetadataFile:
+		data, err = encodeMeta(dir.meta)
+	case ConfigFile:
+		data, err = encodeConfig(dir.config)
+	case ActionsFile:
+		data, err = encodeActions(dir.actions)
+	}
+	if err != nil {
+		return err
+	}
+	path := dir.join(name)
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		old, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		data = preserveComments(old, data)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	// Make sure that the charm can still be read.
+	switch name {
+	case MetadataFile:
+		_, err = ReadMeta(bytes.NewReader(data))
+	case ConfigFile:
+		_, err = ReadConfig(bytes.NewReader(data))
+	case ActionsFile:
+		_, err = ReadActionsYaml(bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, mode)
+}
+
 // resolveSymlinkedRoot returns the target destination of a
 // charm root directory if the root directory is a symlink.
 func resolveSymlinkedRoot(rootPath string) (string, error) {
@@ -166,10 +321,25 @@ func resolveSymlinkedRoot(rootPath string) (string, error) {
 // ArchiveTo creates a charm file from the charm expanded in dir.
 // By convention a charm archive should have a ".charm" suffix.
 func (dir *CharmDir) ArchiveTo(w io.Writer) error {
-	return writeArchive(w, dir.Path, dir.revision, dir.Meta().Hooks())
+	return dir.auditArchiveTo(w, func(w io.Writer) error {
+		return writeArchive(w, dir.Path, dir.revision, dir.Meta().Hooks(), nil)
+	})
+}
+
+// writeArchive writes an archive of the charm or bundle in the given
+// directory to w. If exclude is not nil, files and directories for
+// which it returns true, given their slash-separated paths relative
+// to the root of the charm, are left out.
+func writeArchive(w io.Writer, path string, revision int, hooks map[string]bool, exclude func(relpath string) bool) error {
+	return writeArchiveContext(context.Background(), w, path, revision, hooks, exclude, false, nil)
 }
 
-func writeArchive(w io.Writer, path string, revision int, hooks map[string]bool) error {
+// writeArchiveContext is like writeArchive except that writing fails
+// with ctx.Err() once ctx is done. If linkDuplicates is true, files
+// identical to one already written are stored as symlinks to it.
+// The given files, keyed by slash-separated path relative to the
+// root of the charm, are written in place of any on disk.
+func writeArchiveContext(ctx context.Context, w io.Writer, path string, revision int, hooks map[string]bool, exclude func(relpath string) bool, linkDuplicates bool, files map[string][]byte) error {
 	zipw := zip.NewWriter(w)
 	defer zipw.Close()
 
@@ -179,17 +349,49 @@ func writeArchive(w io.Writer, path string, revision int, hooks map[string]bool)
 	if err != nil {
 		return err
 	}
-	zp := zipPacker{zipw, rootPath, hooks}
+	linkTargets, err := hookLinkTargets(rootPath, hooks)
+	if err != nil {
+		return err
+	}
+	zp := zipPacker{zipw, ctx, rootPath, hooks, exclude, newStatsWriter(), nil, files, linkTargets}
+	if linkDuplicates {
+		zp.written = make(map[string]string)
+	}
 	if revision != -1 {
 		zp.AddRevision(revision)
 	}
-	return filepath.Walk(rootPath, zp.WalkFunc())
+	for _, name := range sortedFileNames(files) {
+		if err := zp.AddFile(name, files[name]); err != nil {
+			return err
+		}
+	}
+	if err := filepath.Walk(rootPath, zp.WalkFunc()); err != nil {
+		return err
+	}
+	// Record statistics about the contents so that
+	// readers need not compute them.
+	return zipw.SetComment(zp.stats.comment())
 }
 
 type zipPacker struct {
 	*zip.Writer
-	root  string
-	hooks map[string]bool
+	ctx     context.Context
+	root    string
+	hooks   map[string]bool
+	exclude func(relpath string) bool
+	stats   *statsWriter
+
+	// written holds the path of each regular file written, keyed
+	// by its contents and mode, if duplicates are to be linked.
+	written map[string]string
+
+	// files holds the contents of files written in
+	// place of those on disk, keyed by path.
+	files map[string][]byte
+
+	// linkTargets holds the slash-separated paths of
+	// the files that hooks are symbolic links to.
+	linkTargets map[string]bool
 }
 
 func (zp *zipPacker) WalkFunc() filepath.WalkFunc {
@@ -199,30 +401,70 @@ func (zp *zipPacker) WalkFunc() filepath.WalkFunc {
 }
 
 func (zp *zipPacker) AddRevision(revision int) error {
-	h := &zip.FileHeader{Name: "revision"}
+	h := &zip.FileHeader{Name: RevisionFile}
 	h.SetMode(syscall.S_IFREG | 0644)
 	w, err := zp.CreateHeader(h)
 	if err == nil {
+		w = io.MultiWriter(w, zp.stats.addFile(h.Name))
 		_, err = w.Write([]byte(strconv.Itoa(revision)))
 	}
 	return err
 }
 
+// AddFile writes a regular file with the given
+// slash-separated path and contents.
+func (zp *zipPacker) AddFile(name string, data []byte) error {
+	h := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+	h.SetMode(syscall.S_IFREG | 0644)
+	w, err := zp.CreateHeader(h)
+	if err == nil {
+		w = io.MultiWriter(w, zp.stats.addFile(h.Name))
+		_, err = w.Write(data)
+	}
+	return err
+}
+
+// sortedFileNames returns the keys of
+// the given files in alphabetical order.
+func sortedFileNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (zp *zipPacker) visit(path string, fi os.FileInfo, err error) error {
 	if err != nil {
 		return err
 	}
+	if err := zp.ctx.Err(); err != nil {
+		return err
+	}
 	relpath, err := filepath.Rel(zp.root, path)
 	if err != nil {
 		return err
 	}
+	if zp.exclude != nil && relpath != "." && zp.exclude(filepath.ToSlash(relpath)) {
+		logEvent("archive", EventFileSkipped, relpath, "reason", "excluded")
+		if fi.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
 	method := zip.Deflate
 	hidden := len(relpath) > 1 && relpath[0] == '.'
 	if fi.IsDir() {
 		if relpath == "build" {
+			logEvent("archive", EventFileSkipped, relpath, "reason", "build directory")
 			return filepath.SkipDir
 		}
 		if hidden {
+			logEvent("archive", EventFileSkipped, relpath, "reason", "hidden")
 			return filepath.SkipDir
 		}
 		relpath += "/"
@@ -236,7 +478,16 @@ func (zp *zipPacker) visit(path string, fi os.FileInfo, err error) error {
 	if mode&os.ModeSymlink != 0 {
 		method = zip.Store
 	}
-	if hidden || relpath == "revision" {
+	if hidden {
+		logEvent("archive", EventFileSkipped, relpath, "reason", "hidden")
+		return nil
+	}
+	if relpath == RevisionFile {
+		logEvent("archive", EventFileSkipped, relpath, "reason", "revision written separately")
+		return nil
+	}
+	if _, ok := zp.files[filepath.ToSlash(relpath)]; ok {
+		logEvent("archive", EventFileSkipped, relpath, "reason", "written separately")
 		return nil
 	}
 	h := &zip.FileHeader{
@@ -250,38 +501,52 @@ func (zp *zipPacker) visit(path string, fi os.FileInfo, err error) error {
 	} else if mode&0100 != 0 {
 		perm = 0755
 	}
-	if filepath.Dir(relpath) == "hooks" {
+	if filepath.Dir(relpath) == HooksDir {
 		hookName := filepath.Base(relpath)
 		if _, ok := zp.hooks[hookName]; ok && !fi.IsDir() && mode&0100 == 0 {
 			logger.Warningf("making %q executable in charm", path)
+			logEvent("archive", EventHookMadeExecutable, relpath)
 			perm = perm | 0100
 		}
 	}
+	if mode.IsRegular() && mode&0100 == 0 && zp.linkTargets[filepath.ToSlash(relpath)] {
+		// All hooks may be links to a single script,
+		// which must then be executable in their stead.
+		logger.Warningf("making %q executable in charm", path)
+		logEvent("archive", EventHookMadeExecutable, relpath)
+		perm = perm | 0100
+	}
 	h.SetMode(mode&^0777 | perm)
 
+	if zp.written != nil && mode.IsRegular() && fi.Size() > 0 {
+		linked, err := zp.linkDuplicate(path, relpath, perm)
+		if linked || err != nil {
+			return err
+		}
+	}
 	w, err := zp.CreateHeader(h)
 	if err != nil || fi.IsDir() {
 		return err
 	}
-	var data []byte
+	w = io.MultiWriter(w, zp.stats.addFile(h.Name))
 	if mode&os.ModeSymlink != 0 {
 		target, err := os.Readlink(path)
 		if err != nil {
 			return err
 		}
 		if err := checkSymlinkTarget(zp.root, relpath, target); err != nil {
+			logEvent("archive", EventSymlinkRejected, relpath, "target", target)
 			return err
 		}
-		data = []byte(target)
-		_, err = w.Write(data)
-	} else {
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		_, err = io.Copy(w, file)
+		_, err = w.Write([]byte(target))
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
+	_, err = io.Copy(w, contextReadCloser{zp.ctx, file})
 	return err
 }
 
@@ -319,3 +319,138 @@ func (s *CharmDirSuite) TestDirSetDiskRevision(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	c.Assert(dir.Revision(), gc.Equals, 42)
 }
+
+func (s *CharmDirSuite) TestReadCharmDirReadOnly(c *gc.C) {
+	charmDir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	// Without a revision file, the revision is
+	// taken from the metadata and no file is created.
+	err := os.Remove(filepath.Join(charmDir, "revision"))
+	c.Assert(err, gc.IsNil)
+	before := readExpandedDir(c, charmDir)
+
+	dir, err := charm.ReadCharmDirReadOnly(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.ReadOnly(), gc.Equals, true)
+	c.Assert(dir.Revision(), gc.Equals, 0)
+
+	c.Assert(dir.SetRevision(42), gc.Equals, charm.ErrReadOnly)
+	c.Assert(dir.Revision(), gc.Equals, 0)
+	c.Assert(dir.SetDiskRevision(42), gc.Equals, charm.ErrReadOnly)
+	c.Assert(dir.BumpRevision("1.0.0"), gc.Equals, charm.ErrReadOnly)
+	dir.SetMeta(dir.Meta())
+	c.Assert(dir.Save(), gc.Equals, charm.ErrReadOnly)
+	_, err = dir.NormalizePermissions()
+	c.Assert(err, gc.Equals, charm.ErrReadOnly)
+	_, err = dir.WriteProvenance(charm.Provenance{BuilderId: "builder"})
+	c.Assert(err, gc.Equals, charm.ErrReadOnly)
+	_, err = charm.RenameRelation(dir, "foo", "bar")
+	c.Assert(err, gc.Equals, charm.ErrReadOnly)
+
+	var b bytes.Buffer
+	err = dir.ArchiveTo(&b)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(b.Bytes())
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Revision(), gc.Equals, 0)
+
+	c.Assert(readExpandedDir(c, charmDir), gc.DeepEquals, before)
+
+	dir, err = charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.ReadOnly(), gc.Equals, false)
+	c.Assert(dir.SetRevision(42), gc.IsNil)
+}
+
+func (s *CharmDirSuite) TestSave(c *gc.C) {
+	charmDir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "wordpress")
+	err := ioutil.WriteFile(filepath.Join(charmDir, "metadata.yaml"), []byte(`
+# The wordpress charm.
+
+name: wordpress
+summary: "Blog engine"
+description: "A pretty popular blog engine"
+# Relations provided.
+provides:
+  url:
+    interface: http
+    limit:
+    optional: false
+requires:
+  # The database.
+  db:
+    interface: mysql
+    limit: 1
+    optional: false
+`[1:]), 0644)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+
+	meta := *dir.Meta()
+	meta.Summary = "Blog engine and CMS"
+	meta.Requires = map[string]charm.Relation{
+		"db": meta.Requires["db"],
+		"cache": {
+			Name:      "cache",
+			Role:      charm.RoleRequirer,
+			Interface: "memcache",
+			Optional:  true,
+			Limit:     1,
+			Scope:     charm.ScopeGlobal,
+		},
+	}
+	dir.SetMeta(&meta)
+	config := charm.NewConfig()
+	config.Options["title"] = charm.Option{
+		Type:        "string",
+		Description: "The blog title.",
+		Default:     "My Blog",
+	}
+	dir.SetConfig(config)
+	c.Assert(dir.Meta(), gc.Equals, &meta)
+	c.Assert(dir.Config(), gc.Equals, config)
+
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(charmDir, "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `
+# The wordpress charm.
+
+name: wordpress
+summary: Blog engine and CMS
+description: A pretty popular blog engine
+# Relations provided.
+provides:
+  url: http
+requires:
+  cache:
+    interface: memcache
+    optional: true
+  # The database.
+  db: mysql
+`[1:])
+
+	dir, err = charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Meta(), gc.DeepEquals, &meta)
+	c.Assert(dir.Config(), gc.DeepEquals, config)
+	c.Assert(dir.Actions(), gc.DeepEquals, charm.NewActions())
+	_, err = os.Stat(filepath.Join(charmDir, "actions.yaml"))
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+}
+
+func (s *CharmDirSuite) TestSaveInvalid(c *gc.C) {
+	charmDir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	meta := *dir.Meta()
+	meta.Series = "bad series"
+	dir.SetMeta(&meta)
+	err = dir.Save()
+	c.Assert(err, gc.ErrorMatches, `cannot save metadata.yaml: charm "dummy" declares invalid series: "bad series"`)
+
+	dir, err = charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Meta().Series, gc.Equals, "")
+}
@@ -0,0 +1,280 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+// The charmhttp package provides an HTTP handler that serves a charm
+// archive and its contents, for embedding a lightweight charm server
+// in tests and caches.
+package charmhttp
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+// Handler serves a charm archive over HTTP. It responds to GET and
+// HEAD requests for the following paths:
+//
+//	/archive     the archive itself
+//	/meta        the charm's metadata, as a MetaResponse in JSON
+//	/manifest    the files in the archive, as a []File in JSON
+//	/file/path   the contents of the file with the given path
+//
+// The archive is served with an ETag holding its SHA256 digest, and
+// each file with one derived from that digest and the file's path, so
+// that neither need be computed again. Both support conditional and
+// range requests. Files are streamed from the archive rather than
+// read into memory. The handler is usually mounted under a prefix
+// with http.StripPrefix.
+type Handler struct {
+	r       io.ReaderAt
+	size    int64
+	archive *charm.CharmArchive
+	zipr    *zip.Reader
+	etag    string
+	files   map[string]*servedFile
+}
+
+// servedFile holds a file in the archive served by a Handler.
+type servedFile struct {
+	fh   *zip.File
+	etag string
+}
+
+// MetaResponse holds the charm metadata served by a Handler.
+type MetaResponse struct {
+	Meta     *charm.Meta
+	Config   *charm.Config
+	Actions  *charm.Actions
+	Revision int
+	SHA256   string
+}
+
+// File describes a file in the archive served by a Handler.
+type File struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Mode string `json:"mode"`
+}
+
+// NewHandler returns a handler serving the charm archive read from
+// r, which must hold the given number of bytes. The caller must
+// not close r while the handler is in use.
+func NewHandler(r io.ReaderAt, size int64) (*Handler, error) {
+	archive, err := charm.ReadCharmArchiveFromReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read charm archive: %v", err)
+	}
+	// The config and actions are read lazily by the archive, so
+	// read them now to reject an archive with invalid ones rather
+	// than serving empty ones.
+	if _, err := archive.LoadConfig(); err != nil {
+		return nil, fmt.Errorf("cannot read charm archive: %v", err)
+	}
+	if _, err := archive.LoadActions(); err != nil {
+		return nil, fmt.Errorf("cannot read charm archive: %v", err)
+	}
+	zipr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read charm archive: %v", err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return nil, fmt.Errorf("cannot read charm archive: %v", err)
+	}
+	sum := h.Sum(nil)
+	handler := &Handler{
+		r:       r,
+		size:    size,
+		archive: archive,
+		zipr:    zipr,
+		etag:    etag(sum),
+		files:   make(map[string]*servedFile),
+	}
+	for _, fh := range zipr.File {
+		if strings.HasSuffix(fh.Name, "/") {
+			continue
+		}
+		// A file's ETag changes whenever the archive does,
+		// which is enough for it to be used for validation.
+		fileSum := sha256.Sum256(append(append([]byte(nil), sum...), fh.Name...))
+		handler.files[fh.Name] = &servedFile{
+			fh:   fh,
+			etag: etag(fileSum[:]),
+		}
+	}
+	return handler, nil
+}
+
+func etag(sum []byte) string {
+	return `"sha256-` + hex.EncodeToString(sum) + `"`
+}
+
+// ServeHTTP implements http.Handler.ServeHTTP.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := req.URL.Path
+	switch {
+	case path == "/archive":
+		h.serveArchive(w, req)
+	case path == "/meta":
+		h.serveMeta(w, req)
+	case path == "/manifest":
+		h.serveManifest(w, req)
+	case strings.HasPrefix(path, "/file/"):
+		h.serveFile(w, req, strings.TrimPrefix(path, "/file/"))
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (h *Handler) serveArchive(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("ETag", h.etag)
+	http.ServeContent(w, req, "", time.Time{}, io.NewSectionReader(h.r, 0, h.size))
+}
+
+func (h *Handler) serveMeta(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, &MetaResponse{
+		Meta:     h.archive.Meta(),
+		Config:   h.archive.Config(),
+		Actions:  h.archive.Actions(),
+		Revision: h.archive.Revision(),
+		SHA256:   strings.TrimSuffix(strings.TrimPrefix(h.etag, `"sha256-`), `"`),
+	})
+}
+
+func (h *Handler) serveManifest(w http.ResponseWriter, req *http.Request) {
+	files := []File{}
+	for _, fh := range h.zipr.File {
+		if strings.HasSuffix(fh.Name, "/") {
+			continue
+		}
+		files = append(files, File{
+			Path: fh.Name,
+			Size: int64(fh.UncompressedSize64),
+			Mode: fh.Mode().String(),
+		})
+	}
+	writeJSON(w, files)
+}
+
+func (h *Handler) serveFile(w http.ResponseWriter, req *http.Request, path string) {
+	f, ok := h.files[path]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("ETag", f.etag)
+	var content io.ReadSeeker
+	if f.fh.Method == zip.Store {
+		// Stored files are served directly from the archive.
+		offset, err := f.fh.DataOffset()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cannot read %q: %v", path, err), http.StatusInternalServerError)
+			return
+		}
+		content = io.NewSectionReader(h.r, offset, int64(f.fh.UncompressedSize64))
+	} else {
+		r := &zipFileReader{fh: f.fh, size: int64(f.fh.UncompressedSize64)}
+		defer r.Close()
+		content = r
+	}
+	// ServeContent determines the content type from
+	// the file's extension, or failing that its contents.
+	http.ServeContent(w, req, path, time.Time{}, content)
+}
+
+// zipFileReader reads a compressed file in an archive, allowing
+// http.ServeContent to seek within it. The file is opened when
+// first read; seeking forward discards data and seeking backward
+// opens the file again, so that the file is streamed without
+// being held in memory. No more than the file's declared size
+// is read.
+type zipFileReader struct {
+	fh   *zip.File
+	size int64
+
+	// rc and r hold the open file and its reader, and
+	// pos the position of r within the file.
+	rc  io.ReadCloser
+	r   io.Reader
+	pos int64
+
+	// offset holds the position set by Seek.
+	offset int64
+}
+
+func (r *zipFileReader) Read(p []byte) (int, error) {
+	if r.rc == nil || r.offset < r.pos {
+		r.Close()
+		rc, err := r.fh.Open()
+		if err != nil {
+			return 0, err
+		}
+		r.rc, r.r, r.pos = rc, io.LimitReader(rc, r.size), 0
+	}
+	if r.offset > r.pos {
+		n, err := io.CopyN(ioutil.Discard, r.r, r.offset-r.pos)
+		r.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.r.Read(p)
+	r.pos += int64(n)
+	r.offset = r.pos
+	return n, err
+}
+
+func (r *zipFileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_SET:
+	case os.SEEK_CUR:
+		offset += r.offset
+	case os.SEEK_END:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close closes the file if it is open.
+func (r *zipFileReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc, r.r = nil, nil
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot marshal response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,211 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charmhttp_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	"gopkg.in/juju/charm.v4/charmhttp"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type HandlerSuite struct {
+	data    []byte
+	handler *charmhttp.Handler
+}
+
+var _ = gc.Suite(&HandlerSuite{})
+
+func (s *HandlerSuite) SetUpSuite(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	s.data = data
+	s.handler, err = charmhttp.NewHandler(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *HandlerSuite) get(c *gc.C, path string, header http.Header) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", path, nil)
+	c.Assert(err, gc.IsNil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *HandlerSuite) TestServeArchive(c *gc.C) {
+	rec := s.get(c, "/archive", nil)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Body.Bytes(), gc.DeepEquals, s.data)
+	c.Assert(rec.Header().Get("Content-Type"), gc.Equals, "application/zip")
+	sum := sha256.Sum256(s.data)
+	etag := `"sha256-` + hex.EncodeToString(sum[:]) + `"`
+	c.Assert(rec.Header().Get("ETag"), gc.Equals, etag)
+
+	rec = s.get(c, "/archive", http.Header{"If-None-Match": {etag}})
+	c.Assert(rec.Code, gc.Equals, http.StatusNotModified)
+}
+
+func (s *HandlerSuite) TestServeArchiveRange(c *gc.C) {
+	rec := s.get(c, "/archive", http.Header{"Range": {"bytes=10-19"}})
+	c.Assert(rec.Code, gc.Equals, http.StatusPartialContent)
+	c.Assert(rec.Body.Bytes(), gc.DeepEquals, s.data[10:20])
+}
+
+func (s *HandlerSuite) TestServeMeta(c *gc.C) {
+	rec := s.get(c, "/meta", nil)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get("Content-Type"), gc.Equals, "application/json")
+	var resp charmhttp.MetaResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &resp)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(s.data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.Meta, gc.DeepEquals, archive.Meta())
+	c.Assert(resp.Revision, gc.Equals, archive.Revision())
+	c.Assert(resp.Config.Options["title"].Description, gc.Equals, archive.Config().Options["title"].Description)
+	sum := sha256.Sum256(s.data)
+	c.Assert(resp.SHA256, gc.Equals, hex.EncodeToString(sum[:]))
+}
+
+func (s *HandlerSuite) TestServeManifest(c *gc.C) {
+	rec := s.get(c, "/manifest", nil)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	var files []charmhttp.File
+	err := json.Unmarshal(rec.Body.Bytes(), &files)
+	c.Assert(err, gc.IsNil)
+	modes := make(map[string]string)
+	for _, f := range files {
+		modes[f.Path] = f.Mode
+	}
+	c.Assert(modes["hooks/install"], gc.Equals, "-rwxr-xr-x")
+	c.Assert(modes["metadata.yaml"], gc.Equals, "-rw-r--r--")
+	_, ok := modes["hooks/"]
+	c.Assert(ok, gc.Equals, false)
+}
+
+func (s *HandlerSuite) TestServeFile(c *gc.C) {
+	rec := s.get(c, "/file/metadata.yaml", nil)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	expect, err := ioutil.ReadFile(charmtesting.Charms.CharmDirPath("dummy") + "/metadata.yaml")
+	c.Assert(err, gc.IsNil)
+	c.Assert(rec.Body.String(), gc.Equals, string(expect))
+	etag := rec.Header().Get("ETag")
+	c.Assert(etag, gc.Matches, `"sha256-[0-9a-f]{64}"`)
+
+	rec = s.get(c, "/file/metadata.yaml", http.Header{"Range": {"bytes=0-3"}})
+	c.Assert(rec.Code, gc.Equals, http.StatusPartialContent)
+	c.Assert(rec.Body.String(), gc.Equals, string(expect[:4]))
+
+	rec = s.get(c, "/file/metadata.yaml", http.Header{"If-None-Match": {etag}})
+	c.Assert(rec.Code, gc.Equals, http.StatusNotModified)
+}
+
+func (s *HandlerSuite) TestServeFileRanges(c *gc.C) {
+	content := make([]byte, 100000)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	for _, f := range []struct {
+		name   string
+		method uint16
+		data   []byte
+	}{
+		{"metadata.yaml", zip.Deflate, []byte("name: ranged\nsummary: s\ndescription: d\n")},
+		{"stored.bin", zip.Store, content},
+		{"deflated.bin", zip.Deflate, content},
+	} {
+		w, err := zipw.CreateHeader(&zip.FileHeader{Name: f.name, Method: f.method})
+		c.Assert(err, gc.IsNil)
+		_, err = w.Write(f.data)
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(zipw.Close(), gc.IsNil)
+	handler, err := charmhttp.NewHandler(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, gc.IsNil)
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		c.Assert(err, gc.IsNil)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	etags := make(map[string]bool)
+	for _, path := range []string{"/file/stored.bin", "/file/deflated.bin"} {
+		rec := get(path, http.Header{})
+		c.Assert(rec.Code, gc.Equals, http.StatusOK)
+		c.Assert(rec.Body.Bytes(), gc.DeepEquals, content)
+		etag := rec.Header().Get("ETag")
+		etags[etag] = true
+
+		rec = get(path, http.Header{"Range": {"bytes=70000-70009"}})
+		c.Assert(rec.Code, gc.Equals, http.StatusPartialContent)
+		c.Assert(rec.Body.Bytes(), gc.DeepEquals, content[70000:70010])
+
+		rec = get(path, http.Header{"Range": {"bytes=-5"}})
+		c.Assert(rec.Code, gc.Equals, http.StatusPartialContent)
+		c.Assert(rec.Body.Bytes(), gc.DeepEquals, content[len(content)-5:])
+
+		rec = get(path, http.Header{"If-None-Match": {etag}})
+		c.Assert(rec.Code, gc.Equals, http.StatusNotModified)
+	}
+	// Each file has its own ETag.
+	c.Assert(etags, gc.HasLen, 2)
+}
+
+func (s *HandlerSuite) TestNotFound(c *gc.C) {
+	for _, path := range []string{"/", "/file/missing", "/file/hooks/", "/other"} {
+		rec := s.get(c, path, nil)
+		c.Assert(rec.Code, gc.Equals, http.StatusNotFound, gc.Commentf("path %q", path))
+	}
+}
+
+func (s *HandlerSuite) TestMethodNotAllowed(c *gc.C) {
+	req, err := http.NewRequest("POST", "/archive", nil)
+	c.Assert(err, gc.IsNil)
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	c.Assert(rec.Code, gc.Equals, http.StatusMethodNotAllowed)
+	c.Assert(rec.Header().Get("Allow"), gc.Equals, "GET, HEAD")
+}
+
+func (s *HandlerSuite) TestNewHandlerInvalidArchive(c *gc.C) {
+	data := []byte("not a zip file")
+	_, err := charmhttp.NewHandler(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.ErrorMatches, "cannot read charm archive: zip: not a valid zip file")
+}
+
+func (s *HandlerSuite) TestNewHandlerInvalidConfig(c *gc.C) {
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	for _, f := range [][2]string{
+		{"metadata.yaml", "name: bad\nsummary: s\ndescription: d\n"},
+		{"config.yaml", "options: 42\n"},
+	} {
+		w, err := zipw.Create(f[0])
+		c.Assert(err, gc.IsNil)
+		_, err = w.Write([]byte(f[1]))
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(zipw.Close(), gc.IsNil)
+	_, err := charmhttp.NewHandler(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, gc.ErrorMatches, "(?s)cannot read charm archive: .*")
+}
@@ -0,0 +1,44 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+// CharmInfo holds the metadata of a charm archive,
+// as read by ReadCharmArchiveMeta.
+type CharmInfo struct {
+	// Path holds the path of the archive.
+	Path string
+
+	// Meta holds the charm's metadata.
+	Meta *Meta
+
+	// Revision holds the charm's revision.
+	Revision int
+
+	// Stats holds the statistics recorded in the
+	// archive, or nil if there are none.
+	Stats *ArchiveStats
+}
+
+// ReadCharmArchiveMeta reads the metadata and revision of the charm
+// archive at path without reading any of its other files, such as
+// config.yaml or actions.yaml, so that jobs that index or scan many
+// archives need not pay for decoding them. Use ReadCharmArchive to
+// read the whole charm.
+func ReadCharmArchiveMeta(path string) (*CharmInfo, error) {
+	zipr, err := newZipOpenerFromPath(path).openZip()
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	meta, _, revision, err := readArchiveMeta(zipr)
+	if err != nil {
+		return nil, err
+	}
+	return &CharmInfo{
+		Path:     path,
+		Meta:     meta,
+		Revision: revision,
+		Stats:    parseArchiveStats(zipr.Comment),
+	}, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type CharmInfoSuite struct{}
+
+var _ = gc.Suite(&CharmInfoSuite{})
+
+func (s *CharmInfoSuite) TestReadCharmArchiveMeta(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	archive, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+
+	info, err := charm.ReadCharmArchiveMeta(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Path, gc.Equals, path)
+	c.Assert(info.Meta, jc.DeepEquals, archive.Meta())
+	c.Assert(info.Revision, gc.Equals, archive.Revision())
+}
+
+func (s *CharmInfoSuite) TestOtherFilesNotRead(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "archive.charm")
+	err := ioutil.WriteFile(path, writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"config.yaml", "options: 42\n"},
+		[2]string{"metrics.yaml", "metrics: 42\n"},
+		[2]string{"revision", "7\n"},
+	), 0644)
+	c.Assert(err, gc.IsNil)
+	info, err := charm.ReadCharmArchiveMeta(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Meta.Name, gc.Equals, "verified")
+	c.Assert(info.Revision, gc.Equals, 7)
+	c.Assert(info.Stats, gc.IsNil)
+}
+
+func (s *CharmInfoSuite) TestInvalidArchive(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "archive.charm")
+	err := ioutil.WriteFile(path, writeZip(c,
+		[2]string{"config.yaml", "options: {}\n"},
+	), 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.ReadCharmArchiveMeta(path)
+	c.Assert(err, gc.ErrorMatches, `archive file "metadata.yaml" not found`)
+
+	err = ioutil.WriteFile(path, writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"revision", "seven"},
+	), 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.ReadCharmArchiveMeta(path)
+	c.Assert(err, gc.ErrorMatches, "invalid revision file")
+}
@@ -0,0 +1,256 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/schema"
+)
+
+// Tests holds the tests of a charm, as declared in the tests.yaml
+// manifest in its tests directory, so that CI systems can discover
+// and run the tests of any charm in the same way:
+//
+//	timeout: 30m
+//	bundles: [cs:~charmers/bundle/wordpress-simple]
+//	tests:
+//	  smoke:
+//	    command: tests/smoke.py
+//	    timeout: 5m
+//	  scale:
+//	    command: tests/scale.py --units 3
+//	    description: Adds and removes units.
+//	    bundles: [bundles/scale.yaml]
+//
+// Timeouts are durations such as "5m" or numbers of seconds. Bundles
+// are bundle URLs or paths of bundle files relative to the tests
+// directory.
+type Tests struct {
+	// Timeout holds the time within which all the tests must
+	// complete, or zero if there is no limit.
+	Timeout time.Duration `bson:",omitempty"`
+
+	// Bundles holds the bundles that must be deployed
+	// before running any of the tests.
+	Bundles []string `bson:",omitempty"`
+
+	// Tests holds the tests, keyed by name.
+	Tests map[string]TestSpec
+}
+
+// TestSpec describes a test of a charm.
+type TestSpec struct {
+	// Command holds the command that runs the test, run
+	// from the charm root. The test fails if it fails.
+	Command string
+
+	// Description holds a description of the test.
+	Description string `bson:",omitempty"`
+
+	// Timeout holds the time within which the test must
+	// complete, or zero if there is no limit.
+	Timeout time.Duration `bson:",omitempty"`
+
+	// Bundles holds the bundles that must be deployed before
+	// running the test, in addition to those of the manifest.
+	Bundles []string `bson:",omitempty"`
+}
+
+// ReadTests reads a tests.yaml manifest.
+func ReadTests(r io.Reader) (*Tests, error) {
+	data, release, err := readYAMLSource(r)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	raw := make(map[interface{}]interface{})
+	if err := yamlUnmarshal(data, raw); err != nil {
+		return nil, err
+	}
+	v, err := testsSchema.Coerce(raw, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tests: %v", err)
+	}
+	m := v.(map[string]interface{})
+	tests := &Tests{
+		Timeout: m["timeout"].(time.Duration),
+		Bundles: parseStringList(m["bundles"]),
+		Tests:   make(map[string]TestSpec),
+	}
+	if specs, ok := m["tests"]; ok {
+		for name, spec := range specs.(map[string]interface{}) {
+			spec := spec.(map[string]interface{})
+			tests.Tests[name] = TestSpec{
+				Command:     spec["command"].(string),
+				Description: spec["description"].(string),
+				Timeout:     spec["timeout"].(time.Duration),
+				Bundles:     parseStringList(spec["bundles"]),
+			}
+		}
+	}
+	return tests, nil
+}
+
+var (
+	testSpecSchema = schema.FieldMap(
+		schema.Fields{
+			"command":     schema.String(),
+			"description": schema.String(),
+			"timeout":     durationC{},
+			"bundles":     schema.List(schema.String()),
+		},
+		schema.Defaults{
+			"description": "",
+			"timeout":     time.Duration(0),
+			"bundles":     schema.Omit,
+		},
+	)
+	testsSchema = schema.FieldMap(
+		schema.Fields{
+			"timeout": durationC{},
+			"bundles": schema.List(schema.String()),
+			"tests":   schema.StringMap(testSpecSchema),
+		},
+		schema.Defaults{
+			"timeout": time.Duration(0),
+			"bundles": schema.Omit,
+			"tests":   schema.Omit,
+		},
+	)
+)
+
+// durationC coerces a duration such as "5m", or a number of seconds,
+// into a time.Duration. A missing duration is coerced to zero.
+type durationC struct{}
+
+func (durationC) Coerce(v interface{}, path []string) (interface{}, error) {
+	if v == nil {
+		return time.Duration(0), nil
+	}
+	var d time.Duration
+	if s, ok := v.(string); ok {
+		var err error
+		d, err = time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("%sinvalid duration %q", schemaPathPrefix(path), s)
+		}
+	} else {
+		secs, err := schema.Int().Coerce(v, path)
+		if err != nil {
+			return nil, fmt.Errorf("%sexpected duration, got %T(%#v)", schemaPathPrefix(path), v, v)
+		}
+		d = time.Duration(secs.(int64)) * time.Second
+	}
+	if d < 0 {
+		return nil, fmt.Errorf("%sduration %v is negative", schemaPathPrefix(path), v)
+	}
+	return d, nil
+}
+
+// ReadCharmTests returns the tests of the given charm, which must
+// be a *CharmDir or a *CharmArchive, as declared in its tests.yaml
+// manifest. It returns nil if the charm has no manifest.
+func ReadCharmTests(ch Charm) (*Tests, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	return readCharmTests(zipr)
+}
+
+func readCharmTests(zipr *zipReadCloser) (*Tests, error) {
+	r, err := zipOpenFile(zipr, TestsFile)
+	if _, ok := err.(*noCharmArchiveFile); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ReadTests(r)
+}
+
+// LintTests returns the problems found in the tests of the given
+// charm, which must be a *CharmDir or a *CharmArchive. It reports
+// charms holding tests but no manifest, manifests declaring no tests,
+// test commands that run files missing from the charm or that are not
+// executable, bundles that are neither valid bundle URLs nor files in
+// the tests directory, and tests whose timeout exceeds that of the
+// manifest. It returns an error if the manifest cannot be read.
+func LintTests(ch Charm) ([]string, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	tests, err := readCharmTests(zipr)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]os.FileMode)
+	for _, fh := range zipr.File {
+		files[strings.TrimSuffix(fh.Name, "/")] = fh.Mode()
+	}
+	var problems []string
+	if tests == nil {
+		if _, ok := files[TestsDir]; ok {
+			problems = append(problems, fmt.Sprintf("%s directory has no %s manifest", TestsDir, path.Base(TestsFile)))
+		}
+		return problems, nil
+	}
+	if len(tests.Tests) == 0 {
+		problems = append(problems, "no tests declared")
+	}
+	checkBundles := func(context string, bundles []string) {
+		for _, b := range bundles {
+			if strings.HasSuffix(b, ".yaml") {
+				if _, ok := files[path.Join(TestsDir, b)]; !ok {
+					problems = append(problems, fmt.Sprintf("%sbundle file %q not found", context, b))
+				}
+			} else if _, err := ParseReference(b); err != nil {
+				problems = append(problems, fmt.Sprintf("%sinvalid bundle %q: %v", context, b, err))
+			}
+		}
+	}
+	checkBundles("", tests.Bundles)
+	for _, name := range tests.names() {
+		spec := tests.Tests[name]
+		context := fmt.Sprintf("test %q: ", name)
+		fields := strings.Fields(spec.Command)
+		if len(fields) == 0 {
+			problems = append(problems, context+"no command")
+		} else if exe := fields[0]; strings.Contains(exe, "/") && !path.IsAbs(exe) {
+			exe = path.Clean(exe)
+			switch mode, ok := files[exe]; {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%scommand %q not found", context, exe))
+			case mode&0100 == 0:
+				problems = append(problems, fmt.Sprintf("%scommand %q is not executable", context, exe))
+			}
+		}
+		if tests.Timeout > 0 && spec.Timeout > tests.Timeout {
+			problems = append(problems, fmt.Sprintf("%stimeout %v exceeds overall timeout %v", context, spec.Timeout, tests.Timeout))
+		}
+		checkBundles(context, spec.Bundles)
+	}
+	return problems, nil
+}
+
+// names returns the names of the tests in alphabetical order.
+func (t *Tests) names() []string {
+	names := make([]string, 0, len(t.Tests))
+	for name := range t.Tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,157 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type CharmTestsSuite struct{}
+
+var _ = gc.Suite(&CharmTestsSuite{})
+
+const testsYAML = `
+timeout: 30m
+bundles: [cs:~charmers/wordpress-simple]
+tests:
+  smoke:
+    command: tests/smoke.py
+    timeout: 300
+  scale:
+    command: tests/scale.py --units 3
+    description: Adds and removes units.
+    timeout: 10m
+    bundles: [bundles/scale.yaml]
+`
+
+func (s *CharmTestsSuite) TestReadTests(c *gc.C) {
+	tests, err := charm.ReadTests(strings.NewReader(testsYAML))
+	c.Assert(err, gc.IsNil)
+	c.Assert(tests, jc.DeepEquals, &charm.Tests{
+		Timeout: 30 * time.Minute,
+		Bundles: []string{"cs:~charmers/wordpress-simple"},
+		Tests: map[string]charm.TestSpec{
+			"smoke": {
+				Command: "tests/smoke.py",
+				Timeout: 5 * time.Minute,
+			},
+			"scale": {
+				Command:     "tests/scale.py --units 3",
+				Description: "Adds and removes units.",
+				Timeout:     10 * time.Minute,
+				Bundles:     []string{"bundles/scale.yaml"},
+			},
+		},
+	})
+}
+
+var invalidTestsTests = []struct {
+	yaml string
+	err  string
+}{{
+	yaml: "timeout: soon",
+	err:  `invalid tests: timeout: invalid duration "soon"`,
+}, {
+	yaml: "timeout: -5",
+	err:  `invalid tests: timeout: duration -5 is negative`,
+}, {
+	yaml: "tests: {smoke: {timeout: 5m}}",
+	err:  `invalid tests: tests.smoke.command: expected string, got nothing`,
+}, {
+	yaml: "tests: {smoke: {command: x, timeout: [1]}}",
+	err:  `invalid tests: tests.smoke.timeout: expected duration, got .*`,
+}}
+
+func (s *CharmTestsSuite) TestReadInvalidTests(c *gc.C) {
+	for i, test := range invalidTestsTests {
+		c.Logf("test %d: %s", i, test.yaml)
+		_, err := charm.ReadTests(strings.NewReader(test.yaml))
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+// writeCharmFile writes a file with the given contents
+// and mode to the given path relative to dir.
+func writeCharmFile(c *gc.C, dir, path, contents string, mode os.FileMode) {
+	path = filepath.Join(dir, filepath.FromSlash(path))
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(path, []byte(contents), mode)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *CharmTestsSuite) TestReadCharmTests(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	tests, err := charm.ReadCharmTests(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(tests, gc.IsNil)
+
+	writeCharmFile(c, dir.Path, charm.TestsFile, testsYAML, 0644)
+	tests, err = charm.ReadCharmTests(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(tests.Tests, gc.HasLen, 2)
+
+	archive := archiveDir(c, dir.Path)
+	tests, err = charm.ReadCharmTests(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(tests.Tests, gc.HasLen, 2)
+}
+
+func (s *CharmTestsSuite) TestLintTests(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	problems, err := charm.LintTests(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, gc.HasLen, 0)
+
+	writeCharmFile(c, dir.Path, "tests/smoke.py", "#!/usr/bin/python\n", 0755)
+	problems, err = charm.LintTests(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, []string{"tests directory has no tests.yaml manifest"})
+
+	writeCharmFile(c, dir.Path, charm.TestsFile, testsYAML, 0644)
+	writeCharmFile(c, dir.Path, "tests/scale.py", "#!/usr/bin/python\n", 0644)
+	writeCharmFile(c, dir.Path, "tests/bundles/scale.yaml", "services: {}\n", 0644)
+	problems, err = charm.LintTests(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, []string{
+		`test "scale": command "tests/scale.py" is not executable`,
+	})
+
+	writeCharmFile(c, dir.Path, charm.TestsFile, `
+timeout: 5m
+bundles: [bundles/missing.yaml, "cs:bad:url"]
+tests:
+  scale:
+    command: ./tests/scale.py
+    timeout: 10m
+  smoke:
+    command: tests/missing.py
+  system:
+    command: /bin/true
+`, 0644)
+	problems, err = charm.LintTests(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, []string{
+		`bundle file "bundles/missing.yaml" not found`,
+		`invalid bundle "cs:bad:url": charm URL has invalid charm name: "cs:bad:url"`,
+		`test "scale": command "tests/scale.py" is not executable`,
+		`test "scale": timeout 10m0s exceeds overall timeout 5m0s`,
+		`test "smoke": command "tests/missing.py" not found`,
+	})
+
+	writeCharmFile(c, dir.Path, charm.TestsFile, "timeout: 5m\n", 0644)
+	problems, err = charm.LintTests(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, []string{"no tests declared"})
+}
@@ -0,0 +1,117 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"sort"
+)
+
+// CharmRelation holds a relation defined by a charm.
+type CharmRelation struct {
+	// Charm holds the name of the charm.
+	Charm string
+	Relation
+}
+
+// String returns the charm and relation names in the
+// form used to specify relations in bundles.
+func (r CharmRelation) String() string {
+	return r.Charm + ":" + r.Name
+}
+
+// RelationPair holds a provider relation and a requirer
+// relation that can be related to one another.
+type RelationPair struct {
+	Provider CharmRelation
+	Requirer CharmRelation
+}
+
+// CompatibilityMatrix holds all the relations that can be
+// established between services of a set of charms.
+type CompatibilityMatrix struct {
+	// Pairs holds the pairs of relations that can be
+	// related, ordered by provider and then by requirer.
+	Pairs []RelationPair
+}
+
+// BuildCompatibilityMatrix returns the matrix of relations that can
+// be established between services of the given charms. A provider
+// and a requirer can be related when their interfaces are compatible,
+// as determined by Interface.CompatibleWith, and,
+// if either of them has container scope, when one of the charms is
+// a subordinate. The juju-info relation implicitly provided by every
+// charm is included. A charm may be related to itself, as two
+// services may be deployed from the same charm. Charms with the same
+// name as an earlier charm are ignored.
+func BuildCompatibilityMatrix(charms []Charm) *CompatibilityMatrix {
+	var providers, requirers []CharmRelation
+	subordinate := make(map[string]bool)
+	for _, ch := range charms {
+		meta := ch.Meta()
+		if _, ok := subordinate[meta.Name]; ok {
+			continue
+		}
+		subordinate[meta.Name] = meta.Subordinate
+		for _, rel := range meta.Provides {
+			providers = append(providers, CharmRelation{meta.Name, rel})
+		}
+		providers = append(providers, CharmRelation{meta.Name, Relation{
+			Name:      "juju-info",
+			Role:      RoleProvider,
+			Interface: "juju-info",
+			Scope:     ScopeGlobal,
+		}})
+		for _, rel := range meta.Requires {
+			requirers = append(requirers, CharmRelation{meta.Name, rel})
+		}
+	}
+	matrix := &CompatibilityMatrix{}
+	for _, prov := range providers {
+		for _, req := range requirers {
+			if !prov.Relation.CanRelateTo(req.Relation) {
+				continue
+			}
+			if prov.Scope == ScopeContainer || req.Scope == ScopeContainer {
+				if !subordinate[prov.Charm] && !subordinate[req.Charm] {
+					continue
+				}
+			}
+			matrix.Pairs = append(matrix.Pairs, RelationPair{
+				Provider: prov,
+				Requirer: req,
+			})
+		}
+	}
+	sort.Sort(relationPairs(matrix.Pairs))
+	return matrix
+}
+
+// Relations returns the pairs in the matrix in which the named
+// charm takes part, in either role.
+func (m *CompatibilityMatrix) Relations(charmName string) []RelationPair {
+	var pairs []RelationPair
+	for _, pair := range m.Pairs {
+		if pair.Provider.Charm == charmName || pair.Requirer.Charm == charmName {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+type relationPairs []RelationPair
+
+func (p relationPairs) Len() int      { return len(p) }
+func (p relationPairs) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p relationPairs) Less(i, j int) bool {
+	if p[i].Provider.Charm != p[j].Provider.Charm {
+		return p[i].Provider.Charm < p[j].Provider.Charm
+	}
+	if p[i].Provider.Name != p[j].Provider.Name {
+		return p[i].Provider.Name < p[j].Provider.Name
+	}
+	if p[i].Requirer.Charm != p[j].Requirer.Charm {
+		return p[i].Requirer.Charm < p[j].Requirer.Charm
+	}
+	return p[i].Requirer.Name < p[j].Requirer.Name
+}
@@ -0,0 +1,73 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type CompatSuite struct{}
+
+var _ = gc.Suite(&CompatSuite{})
+
+func pairStrings(pairs []charm.RelationPair) []string {
+	var s []string
+	for _, pair := range pairs {
+		s = append(s, pair.Provider.String()+" "+pair.Requirer.String())
+	}
+	return s
+}
+
+func (s *CompatSuite) TestBuildCompatibilityMatrix(c *gc.C) {
+	var charms []charm.Charm
+	for _, name := range []string{"wordpress", "mysql", "logging", "varnish", "mysql"} {
+		charms = append(charms, charmtesting.Charms.CharmDir(name))
+	}
+	matrix := charm.BuildCompatibilityMatrix(charms)
+	c.Assert(pairStrings(matrix.Pairs), gc.DeepEquals, []string{
+		"logging:juju-info logging:info",
+		"logging:logging-client logging:logging-directory",
+		"mysql:juju-info logging:info",
+		"mysql:server wordpress:db",
+		"varnish:juju-info logging:info",
+		"varnish:webcache wordpress:cache",
+		"wordpress:juju-info logging:info",
+		"wordpress:logging-dir logging:logging-directory",
+	})
+	c.Assert(matrix.Pairs[3], gc.DeepEquals, charm.RelationPair{
+		Provider: charm.CharmRelation{Charm: "mysql", Relation: charm.Relation{
+			Name:      "server",
+			Role:      charm.RoleProvider,
+			Interface: "mysql",
+			Scope:     charm.ScopeGlobal,
+		}},
+		Requirer: charm.CharmRelation{Charm: "wordpress", Relation: charm.Relation{
+			Name:      "db",
+			Role:      charm.RoleRequirer,
+			Interface: "mysql",
+			Limit:     1,
+			Scope:     charm.ScopeGlobal,
+		}},
+	})
+	c.Assert(pairStrings(matrix.Relations("wordpress")), gc.DeepEquals, []string{
+		"mysql:server wordpress:db",
+		"varnish:webcache wordpress:cache",
+		"wordpress:juju-info logging:info",
+		"wordpress:logging-dir logging:logging-directory",
+	})
+	c.Assert(matrix.Relations("riak"), gc.HasLen, 0)
+}
+
+func (s *CompatSuite) TestContainerScopeNeedsSubordinate(c *gc.C) {
+	logging := charmtesting.Charms.ClonedDir(c.MkDir(), "logging")
+	logging.Meta().Subordinate = false
+	matrix := charm.BuildCompatibilityMatrix([]charm.Charm{
+		charmtesting.Charms.CharmDir("wordpress"),
+		logging,
+	})
+	c.Assert(matrix.Pairs, gc.HasLen, 0)
+}
@@ -6,11 +6,11 @@ package charm
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
+	"reflect"
+	"sort"
 	"strconv"
 
 	"github.com/juju/schema"
-	"gopkg.in/yaml.v1"
 )
 
 // Settings is a group of charm config option names and values. A Settings
@@ -18,11 +18,88 @@ import (
 // C, and every value either has the correct type or is nil.
 type Settings map[string]interface{}
 
+// SettingsDelta holds a set of changes to a Settings value.
+// A nil value in a Settings means that the option takes its
+// default value, so a key whose value becomes nil is recorded
+// as unset rather than set.
+type SettingsDelta struct {
+	// Set holds the options that are given new non-nil values.
+	Set Settings
+
+	// Unset holds the sorted names of the options that revert
+	// to their default values.
+	Unset []string
+}
+
+// IsEmpty returns whether the delta holds no changes.
+func (delta SettingsDelta) IsEmpty() bool {
+	return len(delta.Set) == 0 && len(delta.Unset) == 0
+}
+
+// Diff returns the changes required to turn s into other.
+// Keys that are nil or absent in other are unset if they
+// hold a non-nil value in s.
+func (s Settings) Diff(other Settings) SettingsDelta {
+	delta := SettingsDelta{Set: make(Settings)}
+	for name, value := range other {
+		if value == nil {
+			continue
+		}
+		if old, ok := s[name]; !ok || !reflect.DeepEqual(old, value) {
+			delta.Set[name] = value
+		}
+	}
+	for name, value := range s {
+		if value == nil {
+			continue
+		}
+		if other[name] == nil {
+			delta.Unset = append(delta.Unset, name)
+		}
+	}
+	sort.Strings(delta.Unset)
+	return delta
+}
+
+// ApplyDelta returns a copy of s with the changes in delta applied.
+// Unset options are removed from the result. It returns an error if
+// delta both sets and unsets the same option, or sets an option to nil.
+func (s Settings) ApplyDelta(delta SettingsDelta) (Settings, error) {
+	out := make(Settings)
+	for name, value := range s {
+		out[name] = value
+	}
+	for _, name := range delta.Unset {
+		if _, ok := delta.Set[name]; ok {
+			return nil, fmt.Errorf("option %q both set and unset", name)
+		}
+		delete(out, name)
+	}
+	for name, value := range delta.Set {
+		if value == nil {
+			return nil, fmt.Errorf("option %q set to nil; unset it instead", name)
+		}
+		out[name] = value
+	}
+	return out, nil
+}
+
 // Option represents a single charm config option.
 type Option struct {
 	Type        string
 	Description string
 	Default     interface{}
+
+	// Descriptions holds translations of the description, keyed
+	// by language tag, if the description was given as a map.
+	Descriptions map[string]string `yaml:"-" bson:",omitempty"`
+}
+
+// DescriptionIn returns the option's description in the given
+// language, falling back to English and then to Description if
+// there is no such translation.
+func (option Option) DescriptionIn(lang string) string {
+	return localize(option.Description, option.Descriptions, lang)
 }
 
 // error replaces any supplied non-nil error with a new error describing a
@@ -80,6 +157,40 @@ type Config struct {
 	Options map[string]Option
 }
 
+// configDoc holds a Config as written in a config.yaml file,
+// where option descriptions may be localized.
+type configDoc struct {
+	Options map[string]optionDoc
+}
+
+type optionDoc struct {
+	Type        string
+	Description interface{}
+	Default     interface{}
+}
+
+// encodeConfig returns the contents of a config.yaml file
+// holding the given configuration.
+func encodeConfig(config *Config) ([]byte, error) {
+	return yamlMarshal(configDocOf(config))
+}
+
+// configDocOf returns the config.yaml
+// representation of the given configuration.
+func configDocOf(config *Config) configDoc {
+	doc := configDoc{
+		Options: make(map[string]optionDoc),
+	}
+	for name, option := range config.Options {
+		doc.Options[name] = optionDoc{
+			Type:        option.Type,
+			Description: encodeDescription(option.Description, option.Descriptions),
+			Default:     option.Default,
+		}
+	}
+	return doc
+}
+
 // NewConfig returns a new Config without any options.
 func NewConfig() *Config {
 	return &Config{map[string]Option{}}
@@ -87,32 +198,74 @@ func NewConfig() *Config {
 
 // ReadConfig reads a Config in YAML format.
 func ReadConfig(r io.Reader) (*Config, error) {
-	data, err := ioutil.ReadAll(r)
+	return readConfig(r, false)
+}
+
+// ReadConfigStrict is like ReadConfig except that a configuration
+// holding a byte order mark or CRLF line endings is rejected rather
+// than normalized.
+func ReadConfigStrict(r io.Reader) (*Config, error) {
+	return readConfig(r, true)
+}
+
+func readConfig(r io.Reader, strict bool) (*Config, error) {
+	data, release, err := readYAMLSource(r)
 	if err != nil {
 		return nil, err
 	}
-	var config *Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	defer release()
+	data, perr := normalizeYAML(data, strict)
+	if perr != nil {
+		perr.context = "invalid config"
+		return nil, perr
+	}
+	if err := checkYAMLFeatures(data); err != nil {
+		err.context = "invalid config"
+		return nil, err
+	}
+	var doc *configDoc
+	if err := yamlUnmarshal(data, &doc); err != nil {
+		return nil, yamlDecodeError(data, "invalid config", err)
+	}
+	if err := checkYAMLExpansion(data, doc); err != nil {
+		err.context = "invalid config"
 		return nil, err
 	}
-	if config == nil {
+	if doc == nil {
 		return nil, fmt.Errorf("invalid config: empty configuration")
 	}
-	for name, option := range config.Options {
+	config := &Config{}
+	if doc.Options != nil {
+		config.Options = make(map[string]Option)
+	}
+	for name, optDoc := range doc.Options {
+		option := Option{
+			Type:    optDoc.Type,
+			Default: optDoc.Default,
+		}
+		option.Description, option.Descriptions, err = parseDescription(optDoc.Description)
+		if err == nil {
+			err = checkDescriptions(option.Descriptions)
+		}
+		if err != nil {
+			return nil, newParseError(data, "invalid config", "options."+name+".description",
+				fmt.Sprintf("option %q has invalid description: %v", name, err))
+		}
 		switch option.Type {
 		case "string", "int", "float", "boolean":
 		case "":
 			// Missing type is valid in python.
 			option.Type = "string"
 		default:
-			return nil, fmt.Errorf("invalid config: option %q has unknown type %q", name, option.Type)
+			return nil, newParseError(data, "invalid config", "options."+name+".type",
+				fmt.Sprintf("option %q has unknown type %q", name, option.Type))
 		}
 		def := option.Default
 		if def == "" && option.Type == "string" {
 			// Skip normal validation for compatibility with pyjuju.
 		} else if option.Default, err = option.validate(name, def); err != nil {
 			option.error(&err, name, def)
-			return nil, fmt.Errorf("invalid config default: %v", err)
+			return nil, newParseError(data, "invalid config default", "options."+name+".default", err.Error())
 		}
 		config.Options[name] = option
 	}
@@ -193,7 +346,7 @@ func (c *Config) ParseSettingsStrings(values map[string]string) (Settings, error
 // config option. Empty strings and nil values are both interpreted as nil.
 func (c *Config) ParseSettingsYAML(yamlData []byte, key string) (Settings, error) {
 	var allSettings map[string]Settings
-	if err := yaml.Unmarshal(yamlData, &allSettings); err != nil {
+	if err := yamlUnmarshal(yamlData, &allSettings); err != nil {
 		return nil, fmt.Errorf("cannot parse settings data: %v", err)
 	}
 	settings, ok := allSettings[key]
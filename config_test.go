@@ -391,7 +391,7 @@ func (s *ConfigSuite) TestParseSettingsStrings(c *gc.C) {
 
 func (s *ConfigSuite) TestConfigError(c *gc.C) {
 	_, err := charm.ReadConfig(bytes.NewBuffer([]byte(`options: {t: {type: foo}}`)))
-	c.Assert(err, gc.ErrorMatches, `invalid config: option "t" has unknown type "foo"`)
+	c.Assert(err, gc.ErrorMatches, `invalid config: line 1, column 1: option "t" has unknown type "foo"`)
 }
 
 func (s *ConfigSuite) TestDefaultType(c *gc.C) {
@@ -411,7 +411,7 @@ func (s *ConfigSuite) TestDefaultType(c *gc.C) {
 	assertTypeError := func(type_, str, value string) {
 		config := fmt.Sprintf(`options: {t: {type: %s, default: %s}}`, type_, str)
 		_, err := charm.ReadConfig(bytes.NewBuffer([]byte(config)))
-		expected := fmt.Sprintf(`invalid config default: option "t" expected %s, got %s`, type_, value)
+		expected := fmt.Sprintf(`invalid config default: line 1, column 1: option "t" expected %s, got %s`, type_, value)
 		c.Assert(err, gc.ErrorMatches, expected)
 	}
 
@@ -428,3 +428,109 @@ func (s *ConfigSuite) TestEmptyConfigReturnsError(c *gc.C) {
 	c.Assert(result, gc.IsNil)
 	c.Assert(err, gc.ErrorMatches, "invalid config: empty configuration")
 }
+
+var settingsDiffTests = []struct {
+	about  string
+	old    charm.Settings
+	new    charm.Settings
+	expect charm.SettingsDelta
+}{{
+	about:  "no changes",
+	old:    charm.Settings{"a": "x", "b": int64(1)},
+	new:    charm.Settings{"a": "x", "b": int64(1)},
+	expect: charm.SettingsDelta{Set: charm.Settings{}},
+}, {
+	about: "set and change",
+	old:   charm.Settings{"a": "x", "b": int64(1)},
+	new:   charm.Settings{"a": "y", "b": int64(1), "c": true},
+	expect: charm.SettingsDelta{
+		Set: charm.Settings{"a": "y", "c": true},
+	},
+}, {
+	about: "unset by removal or nil",
+	old:   charm.Settings{"a": "x", "b": int64(1), "c": nil},
+	new:   charm.Settings{"b": nil, "d": nil},
+	expect: charm.SettingsDelta{
+		Set:   charm.Settings{},
+		Unset: []string{"a", "b"},
+	},
+}}
+
+func (s *ConfigSuite) TestSettingsDiff(c *gc.C) {
+	for i, test := range settingsDiffTests {
+		c.Logf("test %d: %s", i, test.about)
+		delta := test.old.Diff(test.new)
+		c.Assert(delta, gc.DeepEquals, test.expect)
+		c.Assert(delta.IsEmpty(), gc.Equals, len(test.expect.Set) == 0 && len(test.expect.Unset) == 0)
+
+		// Applying the delta to the old settings must result in
+		// the new settings, excluding any nil values.
+		result, err := test.old.ApplyDelta(delta)
+		c.Assert(err, gc.IsNil)
+		c.Assert(result.Diff(test.new).IsEmpty(), gc.Equals, true)
+		for name, value := range result {
+			c.Assert(value, gc.DeepEquals, test.new[name])
+		}
+	}
+}
+
+func (s *ConfigSuite) TestSettingsApplyDeltaErrors(c *gc.C) {
+	settings := charm.Settings{"a": "x"}
+	_, err := settings.ApplyDelta(charm.SettingsDelta{
+		Set:   charm.Settings{"a": "y"},
+		Unset: []string{"a"},
+	})
+	c.Assert(err, gc.ErrorMatches, `option "a" both set and unset`)
+	_, err = settings.ApplyDelta(charm.SettingsDelta{
+		Set: charm.Settings{"a": nil},
+	})
+	c.Assert(err, gc.ErrorMatches, `option "a" set to nil; unset it instead`)
+	c.Assert(settings, gc.DeepEquals, charm.Settings{"a": "x"})
+}
+
+func (s *ConfigSuite) TestYAMLMergeKeysRejected(c *gc.C) {
+	_, err := charm.ReadConfig(bytes.NewBuffer([]byte(`
+options:
+  title:
+    <<: {type: string}
+`)))
+	c.Assert(err, gc.ErrorMatches, `invalid config: line 4, column 5: YAML merge keys are not allowed`)
+}
+
+func (s *ConfigSuite) TestReadConfigParseError(c *gc.C) {
+	_, err := charm.ReadConfig(bytes.NewBuffer([]byte(`
+options:
+  title:
+    type: int
+    default: foo
+`)))
+	c.Assert(err, gc.ErrorMatches, `invalid config default: line 5, column 5: option "title" expected int, got "foo"`)
+	perr, ok := err.(*charm.ParseError)
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(perr.Path, gc.Equals, "options.title.default")
+}
+
+func (s *ConfigSuite) TestReadConfigDecodeError(c *gc.C) {
+	_, err := charm.ReadConfig(bytes.NewBufferString("options:\n  title: {type: string\n"))
+	c.Assert(err, gc.ErrorMatches, `invalid config: line 2, column 3: did not find expected ',' or '}'`)
+	perr, ok := err.(*charm.ParseError)
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(perr.Line, gc.Equals, 2)
+
+	_, err = charm.ReadConfig(bytes.NewBufferString("options:\n  title: 42\n"))
+	c.Assert(err, gc.ErrorMatches, "invalid config: line 2, column 3: cannot unmarshal !!int `42` into charm.optionDoc")
+	perr, ok = err.(*charm.ParseError)
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(perr.Line, gc.Equals, 2)
+	c.Assert(perr.Column, gc.Equals, 3)
+}
+
+func (s *ConfigSuite) TestReadConfigWindowsLineEndings(c *gc.C) {
+	data := "options:\r\n  title:\r\n    type: string\r\n    default: foo\r\n"
+	config, err := charm.ReadConfig(bytes.NewBufferString(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(config.Options["title"].Default, gc.Equals, "foo")
+
+	_, err = charm.ReadConfigStrict(bytes.NewBufferString(data))
+	c.Assert(err, gc.ErrorMatches, `invalid config: line 1, column 9: CRLF line endings are not allowed`)
+}
@@ -0,0 +1,202 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Constraints holds the machine constraints that may be specified
+// for services and machines in a bundle. Each field is nil if the
+// constraint is not specified. A constraint specified with an
+// empty value, such as "arch=", holds the zero value, meaning that
+// any value is acceptable.
+type Constraints struct {
+	// Arch holds the required machine architecture.
+	Arch *string
+
+	// Cores holds the minimum number of CPU cores.
+	Cores *uint64
+
+	// Mem holds the minimum amount of memory in megabytes.
+	Mem *uint64
+
+	// RootDisk holds the minimum size of the root disk
+	// in megabytes.
+	RootDisk *uint64
+
+	// Tags holds the tags that the machine must have.
+	Tags *[]string
+}
+
+// validArches holds the architectures accepted in constraints.
+var validArches = map[string]bool{
+	"amd64":   true,
+	"i386":    true,
+	"armhf":   true,
+	"arm64":   true,
+	"ppc64el": true,
+}
+
+// ParseConstraints parses a constraints string, such as
+// "mem=4G cores=2", as found in a bundle. Constraints are
+// separated by spaces. Sizes are in megabytes unless they
+// have an M, G, T or P suffix.
+func ParseConstraints(s string) (Constraints, error) {
+	var cons Constraints
+	for _, word := range strings.Fields(s) {
+		i := strings.Index(word, "=")
+		if i <= 0 {
+			return Constraints{}, fmt.Errorf("malformed constraint %q", word)
+		}
+		name, value := word[:i], word[i+1:]
+		if err := cons.set(name, value); err != nil {
+			return Constraints{}, fmt.Errorf("bad %q constraint: %v", name, err)
+		}
+	}
+	return cons, nil
+}
+
+// VerifyConstraints returns an error if the given constraints
+// string cannot be parsed by ParseConstraints. It is suitable
+// for passing to BundleData.Verify.
+func VerifyConstraints(s string) error {
+	_, err := ParseConstraints(s)
+	return err
+}
+
+func (cons *Constraints) set(name, value string) error {
+	var err error
+	switch name {
+	case "arch":
+		if cons.Arch != nil {
+			return fmt.Errorf("already set")
+		}
+		if value != "" && !validArches[value] {
+			return fmt.Errorf("%q not recognized", value)
+		}
+		cons.Arch = &value
+	case "cores":
+		if cons.Cores != nil {
+			return fmt.Errorf("already set")
+		}
+		cons.Cores, err = parseCount(value)
+	case "mem":
+		if cons.Mem != nil {
+			return fmt.Errorf("already set")
+		}
+		cons.Mem, err = parseSize(value)
+	case "root-disk":
+		if cons.RootDisk != nil {
+			return fmt.Errorf("already set")
+		}
+		cons.RootDisk, err = parseSize(value)
+	case "tags":
+		if cons.Tags != nil {
+			return fmt.Errorf("already set")
+		}
+		tags := []string{}
+		for _, tag := range strings.Split(value, ",") {
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		cons.Tags = &tags
+	default:
+		return fmt.Errorf("unknown constraint")
+	}
+	return err
+}
+
+func parseCount(value string) (*uint64, error) {
+	var n uint64
+	if value != "" {
+		var err error
+		if n, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("must be a non-negative integer")
+		}
+	}
+	return &n, nil
+}
+
+// sizeSuffixes holds the multipliers, in megabytes, of the
+// suffixes allowed on sizes, in increasing order.
+var sizeSuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"M", 1},
+	{"G", 1024},
+	{"T", 1024 * 1024},
+	{"P", 1024 * 1024 * 1024},
+}
+
+// maxSize holds 2**64, the smallest float64
+// size too large to be held in a uint64.
+var maxSize = math.Ldexp(1, 64)
+
+func parseSize(value string) (*uint64, error) {
+	var n uint64
+	if value != "" {
+		multiplier := 1.0
+		for _, s := range sizeSuffixes {
+			if strings.HasSuffix(strings.ToUpper(value), s.suffix) {
+				value = value[:len(value)-1]
+				multiplier = s.multiplier
+				break
+			}
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("must be a non-negative float with optional M/G/T/P suffix")
+		}
+		// Converting a float too large for a uint64
+		// gives an undefined result.
+		f = f*multiplier + 0.5
+		if f >= maxSize {
+			return nil, fmt.Errorf("too large")
+		}
+		n = uint64(f)
+	}
+	return &n, nil
+}
+
+// String returns the constraints in the form accepted by
+// ParseConstraints. Sizes are written using the largest
+// suffix that represents them exactly.
+func (cons Constraints) String() string {
+	var words []string
+	if cons.Arch != nil {
+		words = append(words, "arch="+*cons.Arch)
+	}
+	if cons.Cores != nil {
+		words = append(words, "cores="+strconv.FormatUint(*cons.Cores, 10))
+	}
+	if cons.Mem != nil {
+		words = append(words, "mem="+formatSize(*cons.Mem))
+	}
+	if cons.RootDisk != nil {
+		words = append(words, "root-disk="+formatSize(*cons.RootDisk))
+	}
+	if cons.Tags != nil {
+		words = append(words, "tags="+strings.Join(*cons.Tags, ","))
+	}
+	return strings.Join(words, " ")
+}
+
+func formatSize(n uint64) string {
+	if n == 0 {
+		return "0M"
+	}
+	for i := len(sizeSuffixes) - 1; i >= 0; i-- {
+		m := uint64(sizeSuffixes[i].multiplier)
+		if n%m == 0 {
+			return strconv.FormatUint(n/m, 10) + sizeSuffixes[i].suffix
+		}
+	}
+	panic("unreachable")
+}
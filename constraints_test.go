@@ -0,0 +1,127 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type ConstraintsSuite struct{}
+
+var _ = gc.Suite(&ConstraintsSuite{})
+
+func uint64p(n uint64) *uint64 {
+	return &n
+}
+
+func stringp(s string) *string {
+	return &s
+}
+
+var parseConstraintsTests = []struct {
+	about  string
+	cons   string
+	expect charm.Constraints
+	str    string
+	err    string
+}{{
+	about: "empty",
+}, {
+	about: "all constraints",
+	cons:  "  arch=amd64 cores=4  mem=4G root-disk=8192 tags=foo,bar",
+	expect: charm.Constraints{
+		Arch:     stringp("amd64"),
+		Cores:    uint64p(4),
+		Mem:      uint64p(4096),
+		RootDisk: uint64p(8192),
+		Tags:     &[]string{"foo", "bar"},
+	},
+	str: "arch=amd64 cores=4 mem=4G root-disk=8G tags=foo,bar",
+}, {
+	about:  "size suffixes",
+	cons:   "mem=1.5g root-disk=2T",
+	expect: charm.Constraints{Mem: uint64p(1536), RootDisk: uint64p(2 * 1024 * 1024)},
+	str:    "mem=1536M root-disk=2T",
+}, {
+	about: "empty values",
+	cons:  "arch= cores= mem= tags=",
+	expect: charm.Constraints{
+		Arch:  stringp(""),
+		Cores: uint64p(0),
+		Mem:   uint64p(0),
+		Tags:  &[]string{},
+	},
+	str: "arch= cores=0 mem=0M tags=",
+}, {
+	about: "malformed",
+	cons:  "mem=4G big",
+	err:   `malformed constraint "big"`,
+}, {
+	about: "missing name",
+	cons:  "=4G",
+	err:   `malformed constraint "=4G"`,
+}, {
+	about: "unknown constraint",
+	cons:  "colour=red",
+	err:   `bad "colour" constraint: unknown constraint`,
+}, {
+	about: "repeated constraint",
+	cons:  "cores=2 cores=4",
+	err:   `bad "cores" constraint: already set`,
+}, {
+	about: "bad arch",
+	cons:  "arch=sparc",
+	err:   `bad "arch" constraint: "sparc" not recognized`,
+}, {
+	about: "bad cores",
+	cons:  "cores=-1",
+	err:   `bad "cores" constraint: must be a non-negative integer`,
+}, {
+	about: "bad mem",
+	cons:  "mem=4X",
+	err:   `bad "mem" constraint: must be a non-negative float with optional M/G/T/P suffix`,
+}, {
+	about: "negative root-disk",
+	cons:  "root-disk=-2G",
+	err:   `bad "root-disk" constraint: must be a non-negative float with optional M/G/T/P suffix`,
+}, {
+	about: "NaN mem",
+	cons:  "mem=NaN",
+	err:   `bad "mem" constraint: must be a non-negative float with optional M/G/T/P suffix`,
+}, {
+	about: "infinite root-disk",
+	cons:  "root-disk=+Inf",
+	err:   `bad "root-disk" constraint: must be a non-negative float with optional M/G/T/P suffix`,
+}, {
+	about: "mem too large",
+	cons:  "mem=18446744073709551616",
+	err:   `bad "mem" constraint: too large`,
+}, {
+	about: "mem too large with suffix",
+	cons:  "mem=17179869184P",
+	err:   `bad "mem" constraint: too large`,
+}}
+
+func (*ConstraintsSuite) TestParseConstraints(c *gc.C) {
+	for i, test := range parseConstraintsTests {
+		c.Logf("test %d: %s", i, test.about)
+		cons, err := charm.ParseConstraints(test.cons)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			c.Assert(charm.VerifyConstraints(test.cons), gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(cons, gc.DeepEquals, test.expect)
+		c.Assert(cons.String(), gc.Equals, test.str)
+		c.Assert(charm.VerifyConstraints(test.cons), gc.IsNil)
+
+		// Check that the string form round trips.
+		cons, err = charm.ParseConstraints(cons.String())
+		c.Assert(err, gc.IsNil)
+		c.Assert(cons, gc.DeepEquals, test.expect)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+
+	"golang.org/x/net/context"
+)
+
+// ReadCharmArchiveContext is like ReadCharmArchive except that reading
+// the archive fails with ctx.Err() once the context is done. The
+// context applies only while the archive is read; methods on the
+// returned CharmArchive are not bound by it.
+func ReadCharmArchiveContext(ctx context.Context, path string) (*CharmArchive, error) {
+	zopen := newZipOpenerFromPath(path)
+	a, err := readCharmArchive(contextZipOpener{ctx, zopen}, nil)
+	if err != nil {
+		auditRead(nil, path, err)
+		return nil, err
+	}
+	a.zopen = zopen
+	a.Path = path
+	auditRead(a, path, nil)
+	return a, nil
+}
+
+// ReadCharmDirContext is like ReadCharmDir except that it fails
+// with ctx.Err() if the context is done before the charm has
+// been read.
+func ReadCharmDirContext(ctx context.Context, path string) (*CharmDir, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dir, err := ReadCharmDir(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return dir, nil
+}
+
+// ArchiveToContext is like ArchiveTo except that archiving
+// fails with ctx.Err() once the context is done.
+func (dir *CharmDir) ArchiveToContext(ctx context.Context, w io.Writer) error {
+	return dir.auditArchiveTo(w, func(w io.Writer) error {
+		return writeArchiveContext(ctx, w, dir.Path, dir.revision, dir.Meta().Hooks(), nil, false, nil)
+	})
+}
+
+// ExpandToContext is like ExpandTo except that expanding
+// the archive fails with ctx.Err() once the context is done.
+// Files already expanded are left in place.
+func (a *CharmArchive) ExpandToContext(ctx context.Context, dir string) error {
+	return a.expandTo(contextZipOpener{ctx, a.zopen}, dir)
+}
+
+// WithContext returns a copy of the store whose requests, including
+// those made when mirroring charms with it, are bound by the given
+// context, so that they are abandoned once it is done.
+func (s *CharmStore) WithContext(ctx context.Context) *CharmStore {
+	ctxCS := *s
+	ctxCS.ctx = ctx
+	return &ctxCS
+}
+
+// context returns the context bounding the store's requests.
+func (s *CharmStore) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// contextZipOpener is a zipOpener that reads the archive
+// opened by zopen, failing once ctx is done.
+type contextZipOpener struct {
+	ctx   context.Context
+	zopen zipOpener
+}
+
+func (zo contextZipOpener) openZip() (*zipReadCloser, error) {
+	if err := zo.ctx.Err(); err != nil {
+		return nil, err
+	}
+	switch zopen := zo.zopen.(type) {
+	case *zipPathOpener:
+		f, err := os.Open(zopen.path)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		r, err := zip.NewReader(contextReaderAt{zo.ctx, f}, fi.Size())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &zipReadCloser{Closer: f, Reader: r}, nil
+	case *zipReaderOpener:
+		return newZipOpenerFromReader(contextReaderAt{zo.ctx, zopen.r}, zopen.size).openZip()
+	}
+	// Other archives are held in memory, so
+	// reading them cannot block.
+	return zo.zopen.openZip()
+}
+
+func (zo contextZipOpener) open() (io.ReadCloser, error) {
+	if err := zo.ctx.Err(); err != nil {
+		return nil, err
+	}
+	r, err := zo.zopen.open()
+	if err != nil {
+		return nil, err
+	}
+	return contextReadCloser{zo.ctx, r}, nil
+}
+
+// contextReaderAt is an io.ReaderAt that fails once ctx is done.
+type contextReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+func (r contextReaderAt) ReadAt(buf []byte, off int64) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.ReadAt(buf, off)
+}
+
+// contextReadCloser is an io.ReadCloser that fails once ctx is done.
+type contextReadCloser struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r contextReadCloser) Read(buf []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(buf)
+}
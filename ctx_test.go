@@ -0,0 +1,111 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"path/filepath"
+
+	"golang.org/x/net/context"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ContextSuite struct{}
+
+var _ = gc.Suite(&ContextSuite{})
+
+func cancelledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func (s *ContextSuite) TestReadCharmArchiveContext(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	_, err := charm.ReadCharmArchiveContext(cancelledContext(), path)
+	c.Assert(err, gc.Equals, context.Canceled)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	archive, err := charm.ReadCharmArchiveContext(ctx, path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Path, gc.Equals, path)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+
+	// The archive may still be used once the context is done.
+	cancel()
+	err = archive.ExpandTo(c.MkDir())
+	c.Assert(err, gc.IsNil)
+	err = archive.ExpandToContext(ctx, c.MkDir())
+	c.Assert(err, gc.Equals, context.Canceled)
+	err = archive.ExpandToContext(context.Background(), c.MkDir())
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *ContextSuite) TestReadCharmDirContext(c *gc.C) {
+	path := charmtesting.Charms.CharmDirPath("dummy")
+	_, err := charm.ReadCharmDirContext(cancelledContext(), path)
+	c.Assert(err, gc.Equals, context.Canceled)
+	dir, err := charm.ReadCharmDirContext(context.Background(), path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Meta().Name, gc.Equals, "dummy")
+}
+
+func (s *ContextSuite) TestArchiveToContext(c *gc.C) {
+	dir := charmtesting.Charms.CharmDir("dummy")
+	var buf bytes.Buffer
+	err := dir.ArchiveToContext(cancelledContext(), &buf)
+	c.Assert(err, gc.Equals, context.Canceled)
+
+	buf.Reset()
+	err = dir.ArchiveToContext(context.Background(), &buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+}
+
+// countdownContext is a context that reports itself done once
+// its Err method has been called a given number of times.
+type countdownContext struct {
+	context.Context
+	calls int
+}
+
+func (ctx *countdownContext) Err() error {
+	if ctx.calls--; ctx.calls < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func (s *ContextSuite) TestArchiveToContextCancelledDuringWrite(c *gc.C) {
+	dir := charmtesting.Charms.CharmDir("dummy")
+	// Cancel the context at each point at which it is checked,
+	// including while copying the last file, until archiving
+	// completes before it is cancelled.
+	for n := 0; ; n++ {
+		ctx := &countdownContext{context.Background(), n}
+		var buf bytes.Buffer
+		err := dir.ArchiveToContext(ctx, &buf)
+		if ctx.calls >= 0 {
+			c.Assert(err, gc.IsNil)
+			break
+		}
+		c.Assert(err, gc.Equals, context.Canceled, gc.Commentf("cancelled after %d checks", n))
+	}
+}
+
+func (s *ContextSuite) TestExpandToContextFromBytes(c *gc.C) {
+	dir := charmtesting.Charms.CharmDir("dummy")
+	var buf bytes.Buffer
+	err := dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	err = archive.ExpandToContext(cancelledContext(), filepath.Join(c.MkDir(), "charm"))
+	c.Assert(err, gc.Equals, context.Canceled)
+}
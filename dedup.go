@@ -0,0 +1,121 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DuplicateFiles returns the groups of regular files in the given
+// charm, which must be a *CharmDir or a *CharmArchive, that have
+// identical contents and modes, such as copies of the same interface
+// code in a layered charm. Each group holds the slash-separated paths
+// of its files in order; the groups are ordered by their first path.
+// Empty files are not reported.
+//
+// Such files can be stored once by archiving the charm with the
+// LinkDuplicates archive option.
+func DuplicateFiles(ch Charm) ([][]string, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	groups := make(map[string][]string)
+	for _, fh := range zipr.File {
+		if !fh.Mode().IsRegular() || fh.UncompressedSize64 == 0 || fh.Name == RevisionFile {
+			continue
+		}
+		key, err := zipFileKey(fh)
+		if err != nil {
+			return nil, err
+		}
+		groups[key] = append(groups[key], fh.Name)
+	}
+	var dups [][]string
+	for _, paths := range groups {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			dups = append(dups, paths)
+		}
+	}
+	sort.Sort(pathGroups(dups))
+	return dups, nil
+}
+
+type pathGroups [][]string
+
+func (g pathGroups) Len() int           { return len(g) }
+func (g pathGroups) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
+func (g pathGroups) Less(i, j int) bool { return g[i][0] < g[j][0] }
+
+// zipFileKey returns a key identifying the
+// contents and mode of the given archive member.
+func zipFileKey(fh *zip.File) (string, error) {
+	r, err := fh.Open()
+	if err != nil {
+		return "", fmt.Errorf("cannot read %q: %v", fh.Name, err)
+	}
+	defer r.Close()
+	return contentKey(r, fh.Mode().Perm())
+}
+
+// contentKey returns a key identifying the
+// contents read from r and the given mode.
+func contentKey(r io.Reader, perm os.FileMode) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %o", hex.EncodeToString(h.Sum(nil)), perm), nil
+}
+
+// linkDuplicate checks whether a file with the same contents and
+// mode as the file at path, to be stored at relpath with the given
+// mode, has already been written. If so, it writes a symlink to that
+// file at relpath and returns true. Otherwise it records the file as
+// written and returns false.
+func (zp *zipPacker) linkDuplicate(path, relpath string, perm os.FileMode) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	key, err := contentKey(contextReadCloser{zp.ctx, f}, perm)
+	f.Close()
+	if err != nil {
+		return false, err
+	}
+	original, ok := zp.written[key]
+	if !ok {
+		zp.written[key] = relpath
+		return false, nil
+	}
+	target, err := filepath.Rel(filepath.Dir(relpath), original)
+	if err != nil {
+		return false, err
+	}
+	target = filepath.ToSlash(target)
+	h := &zip.FileHeader{
+		Name:   relpath,
+		Method: zip.Store,
+	}
+	h.SetMode(os.ModeSymlink | 0777)
+	w, err := zp.CreateHeader(h)
+	if err != nil {
+		return false, err
+	}
+	w = io.MultiWriter(w, zp.stats.addFile(h.Name))
+	if _, err := io.WriteString(w, target); err != nil {
+		return false, err
+	}
+	logEvent("archive", EventDuplicateLinked, relpath, "target", target)
+	return true, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type DedupSuite struct{}
+
+var _ = gc.Suite(&DedupSuite{})
+
+const interfaceCode = "def provide(): pass\n"
+
+func (s *DedupSuite) dupCharm(c *gc.C) *charm.CharmDir {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	writeCharmFile(c, dir.Path, "hooks/relations/mysql/provides.py", interfaceCode, 0644)
+	writeCharmFile(c, dir.Path, "lib/mysql/provides.py", interfaceCode, 0644)
+	writeCharmFile(c, dir.Path, "lib/copy.py", interfaceCode, 0644)
+	// Files differing in mode are not duplicates.
+	writeCharmFile(c, dir.Path, "bin/provides", interfaceCode, 0755)
+	writeCharmFile(c, dir.Path, "empty1", "", 0644)
+	writeCharmFile(c, dir.Path, "empty2", "", 0644)
+	return dir
+}
+
+func (s *DedupSuite) TestDuplicateFiles(c *gc.C) {
+	dir := s.dupCharm(c)
+	dups, err := charm.DuplicateFiles(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dups, jc.DeepEquals, [][]string{{
+		"hooks/relations/mysql/provides.py",
+		"lib/copy.py",
+		"lib/mysql/provides.py",
+	}})
+
+	dups, err = charm.DuplicateFiles(charmtesting.Charms.CharmArchive(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(dups, gc.HasLen, 0)
+}
+
+func (s *DedupSuite) TestArchiveLinkDuplicates(c *gc.C) {
+	dir := s.dupCharm(c)
+	var plain, linked bytes.Buffer
+	err := dir.ArchiveTo(&plain)
+	c.Assert(err, gc.IsNil)
+	logger := &recordingLogger{}
+	defer charm.SetLogger(charm.SetLogger(logger))
+	err = dir.ArchiveToWithOptions(&linked, charm.ArchiveOptions{LinkDuplicates: true})
+	c.Assert(err, gc.IsNil)
+
+	archive, err := charm.ReadCharmArchiveBytes(linked.Bytes())
+	c.Assert(err, gc.IsNil)
+	dups, err := charm.DuplicateFiles(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dups, gc.HasLen, 0)
+
+	// The expanded charm holds the same contents.
+	expanded := c.MkDir()
+	err = archive.ExpandTo(expanded)
+	c.Assert(err, gc.IsNil)
+	for _, path := range []string{"hooks/relations/mysql/provides.py", "lib/copy.py", "lib/mysql/provides.py", "bin/provides"} {
+		data, err := ioutil.ReadFile(filepath.Join(expanded, path))
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(data), gc.Equals, interfaceCode)
+	}
+	info, err := os.Lstat(filepath.Join(expanded, "bin", "provides"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&os.ModeSymlink, gc.Equals, os.FileMode(0))
+	c.Assert(logger.kind(charm.EventDuplicateLinked), gc.HasLen, 2)
+}
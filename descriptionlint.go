@@ -0,0 +1,228 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxSummaryLength holds the length beyond which
+// a summary is reported by LintDescription.
+const maxSummaryLength = 80
+
+// Dictionary is implemented by spelling dictionaries
+// used by LintDescription.
+type Dictionary interface {
+	// Contains reports whether the given word
+	// is spelled correctly.
+	Contains(word string) bool
+}
+
+// WordList is a Dictionary holding a set of words.
+type WordList map[string]bool
+
+// ReadWordList reads a word list holding one word per line,
+// as in /usr/share/dict/words. Blank lines and lines starting
+// with "#" are ignored.
+func ReadWordList(r io.Reader) (WordList, error) {
+	words := make(WordList)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word != "" && !strings.HasPrefix(word, "#") {
+			words[word] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// Contains implements Dictionary.Contains. A word is also
+// found if its lower case form is in the list, so that
+// capitalized words at the start of sentences are found.
+func (w WordList) Contains(word string) bool {
+	return w[word] || w[strings.ToLower(word)]
+}
+
+// LintDescription returns the mechanical problems found in the
+// summary and descriptions of the given metadata: summaries that
+// are empty, span several lines or are longer than 80 characters,
+// sentences that do not start with a capital letter, trailing
+// whitespace and broken Markdown links. If dict is not nil, words
+// of the English description and summary that are not in it are
+// reported as possible misspellings; words in code and link targets
+// are not checked.
+func LintDescription(meta *Meta, dict Dictionary) []string {
+	l := &descriptionLinter{}
+	l.lintSummary(meta.Summary, dict)
+	l.lintDescription("description", meta.Description, dict)
+	langs := make([]string, 0, len(meta.Descriptions))
+	for lang := range meta.Descriptions {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		l.lintDescription(fmt.Sprintf("description (%s)", lang), meta.Descriptions[lang], nil)
+	}
+	return l.problems
+}
+
+// descriptionLinter accumulates the problems
+// found by LintDescription.
+type descriptionLinter struct {
+	problems []string
+	reported map[string]bool
+}
+
+func (l *descriptionLinter) addf(format string, args ...interface{}) {
+	l.problems = append(l.problems, fmt.Sprintf(format, args...))
+}
+
+func (l *descriptionLinter) lintSummary(summary string, dict Dictionary) {
+	switch {
+	case strings.TrimSpace(summary) == "":
+		l.addf("summary is empty")
+		return
+	case strings.Contains(strings.TrimRight(summary, "\n"), "\n"):
+		l.addf("summary spans several lines")
+	case utf8.RuneCountInString(summary) > maxSummaryLength:
+		l.addf("summary is longer than %d characters", maxSummaryLength)
+	}
+	if strings.TrimSpace(summary) != summary {
+		l.addf("summary has leading or trailing whitespace")
+	}
+	l.lintProse("summary", summary, dict)
+}
+
+func (l *descriptionLinter) lintDescription(context, text string, dict Dictionary) {
+	if strings.TrimSpace(text) == "" {
+		l.addf("%s is empty", context)
+		return
+	}
+	for i, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if strings.TrimRight(line, " \t\r") != line {
+			l.addf("%s: line %d has trailing whitespace", context, i+1)
+		}
+	}
+	for _, b := range parseMarkdown(text) {
+		switch b.kind {
+		case mdHeading, mdParagraph:
+			l.lintProse(context, b.text, dict)
+		case mdList:
+			for _, item := range b.items {
+				l.lintProse(context, item, dict)
+			}
+		}
+	}
+}
+
+// lintProse checks the links, sentences and spelling
+// of a block of Markdown text outside code blocks.
+func (l *descriptionLinter) lintProse(context, text string, dict Dictionary) {
+	prose, broken := mdProse(text)
+	for _, link := range broken {
+		l.addf("%s: broken link %q", context, link)
+	}
+	start := true
+	for _, word := range strings.Fields(prose) {
+		first, _ := utf8.DecodeRuneInString(word)
+		if start && unicode.IsLower(first) {
+			l.addf("%s: sentence starts with a lower case letter: %q", context, word)
+		}
+		start = strings.ContainsAny(word[len(word)-1:], ".!?") && !abbreviations[strings.ToLower(word)]
+	}
+	if dict == nil {
+		return
+	}
+	words := strings.FieldsFunc(prose, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, word := range words {
+		word = strings.Trim(word, "'")
+		if utf8.RuneCountInString(word) < 2 || strings.ToUpper(word) == word || dict.Contains(word) {
+			continue
+		}
+		key := context + "\x00" + word
+		if l.reported[key] {
+			continue
+		}
+		if l.reported == nil {
+			l.reported = make(map[string]bool)
+		}
+		l.reported[key] = true
+		l.addf("%s: possible misspelling %q", context, word)
+	}
+}
+
+// abbreviations holds abbreviations that end with
+// a full stop without ending a sentence.
+var abbreviations = map[string]bool{
+	"e.g.": true,
+	"i.e.": true,
+	"etc.": true,
+	"vs.":  true,
+	"cf.":  true,
+}
+
+// mdProse returns the prose within the given Markdown text, with
+// code spans and link targets removed, along with the text of any
+// links that would not be rendered: those with no closing
+// parenthesis, with a space before the target, or with an empty,
+// unsupported or space-holding target.
+func mdProse(s string) (prose string, broken []string) {
+	var buf []byte
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte(mdEscapable, s[i+1]) >= 0 {
+				i++
+			}
+		case '`':
+			if j := strings.IndexByte(s[i+1:], '`'); j >= 0 {
+				buf = append(buf, ' ')
+				i += j + 1
+				continue
+			}
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				break
+			}
+			rest := s[i+end+1:]
+			target := strings.TrimLeft(rest, " ")
+			gap := len(rest) - len(target)
+			if !strings.HasPrefix(target, "(") {
+				break
+			}
+			k := closingParen(target)
+			if k < 0 {
+				broken = append(broken, s[i:])
+				break
+			}
+			link := s[i : i+end+1+gap+k+1]
+			url := strings.TrimSpace(target[1:k])
+			if gap > 0 || !safeURL(url) || strings.ContainsAny(url, " \t\n") {
+				broken = append(broken, link)
+			}
+			if gap > 0 {
+				break
+			}
+			label, labelBroken := mdProse(s[i+1 : i+end])
+			buf = append(buf, label...)
+			broken = append(broken, labelBroken...)
+			i += len(link) - 1
+			continue
+		}
+		buf = append(buf, s[i])
+	}
+	return string(buf), broken
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type DescriptionLintSuite struct{}
+
+var _ = gc.Suite(&DescriptionLintSuite{})
+
+var lintDescriptionTests = []struct {
+	about       string
+	summary     string
+	description string
+	problems    []string
+}{{
+	about:       "no problems",
+	summary:     "A database server.",
+	description: "MySQL is a database, e.g. for web sites. See [the docs](http://mysql.com).\n\n    some code here\n\n- Fast.\n- Small.\n",
+}, {
+	about:       "empty",
+	summary:     " ",
+	description: "",
+	problems:    []string{"summary is empty", "description is empty"},
+}, {
+	about:       "summary problems",
+	summary:     "a very long summary " + strings.Repeat("x", 70) + " ",
+	description: "Fine.",
+	problems: []string{
+		"summary is longer than 80 characters",
+		"summary has leading or trailing whitespace",
+		`summary: sentence starts with a lower case letter: "a"`,
+	},
+}, {
+	about:       "several lines",
+	summary:     "One line.\nTwo lines.",
+	description: "Fine.",
+	problems:    []string{"summary spans several lines"},
+}, {
+	about:       "description problems",
+	summary:     "Fine.",
+	description: "First sentence. second sentence.  \nThird `code. here` line.\t\n\n- item one\n",
+	problems: []string{
+		"description: line 1 has trailing whitespace",
+		"description: line 2 has trailing whitespace",
+		`description: sentence starts with a lower case letter: "second"`,
+		`description: sentence starts with a lower case letter: "item"`,
+	},
+}, {
+	about:       "broken links",
+	summary:     "Fine.",
+	description: "See [docs](), [bad](javascript:alert(1)), [spaced] (http://x.com), [target](http://x.com/a b) and [open](http://x.com.",
+	problems: []string{
+		`description: broken link "[docs]()"`,
+		`description: broken link "[bad](javascript:alert(1))"`,
+		`description: broken link "[spaced] (http://x.com)"`,
+		`description: broken link "[target](http://x.com/a b)"`,
+		`description: broken link "[open](http://x.com."`,
+	},
+}}
+
+func (s *DescriptionLintSuite) TestLintDescription(c *gc.C) {
+	for i, test := range lintDescriptionTests {
+		c.Logf("test %d: %s", i, test.about)
+		meta := &charm.Meta{
+			Summary:     test.summary,
+			Description: test.description,
+		}
+		c.Check(charm.LintDescription(meta, nil), jc.DeepEquals, test.problems)
+	}
+}
+
+func (s *DescriptionLintSuite) TestLintTranslations(c *gc.C) {
+	meta := &charm.Meta{
+		Summary:     "Fine.",
+		Description: "Fine.",
+		Descriptions: map[string]string{
+			"fr": "bonjour. ",
+			"de": "Gut.",
+		},
+	}
+	c.Assert(charm.LintDescription(meta, charm.WordList{"fine": true}), jc.DeepEquals, []string{
+		"description (fr): line 1 has trailing whitespace",
+		`description (fr): sentence starts with a lower case letter: "bonjour."`,
+	})
+}
+
+func (s *DescriptionLintSuite) TestLintSpelling(c *gc.C) {
+	dict, err := charm.ReadWordList(strings.NewReader("# words\na\ndatabase\nfor\nsee\nthe\nserver\n\nweb\n"))
+	c.Assert(err, gc.IsNil)
+	meta := &charm.Meta{
+		Summary:     "A databse server.",
+		Description: "See the [databse docs](http://example.com/wrod) for `wrod` and MySQL, a databse for web's users.",
+	}
+	c.Assert(charm.LintDescription(meta, dict), jc.DeepEquals, []string{
+		`summary: possible misspelling "databse"`,
+		`description: possible misspelling "databse"`,
+		`description: possible misspelling "docs"`,
+		`description: possible misspelling "and"`,
+		`description: possible misspelling "MySQL"`,
+		`description: possible misspelling "web's"`,
+		`description: possible misspelling "users"`,
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// DigestAlgorithm identifies a hash algorithm used to make digests.
+type DigestAlgorithm string
+
+const (
+	SHA256 DigestAlgorithm = "sha256"
+	SHA384 DigestAlgorithm = "sha384"
+)
+
+// newHash returns a new hash computing digests with the
+// algorithm, or nil if the algorithm is not supported.
+func (alg DigestAlgorithm) newHash() hash.Hash {
+	switch alg {
+	case SHA256:
+		return sha256.New()
+	case SHA384:
+		return sha512.New384()
+	}
+	return nil
+}
+
+// Digest holds a digest of some data along with the algorithm used to
+// make it, so that digests made with different algorithms can be held
+// side by side while the algorithm in use changes. Its string form is
+// the algorithm and the hex-encoded digest separated by a colon, as
+// in "sha384:0f4c...".
+type Digest struct {
+	Algorithm DigestAlgorithm
+	Hex       string
+}
+
+// ParseDigest parses a digest in the form returned by Digest.String.
+// For compatibility with digests stored before algorithms were
+// recorded, a hex-encoded SHA256 digest without an algorithm is
+// also accepted.
+func ParseDigest(s string) (Digest, error) {
+	d := Digest{Algorithm: SHA256, Hex: s}
+	if i := strings.Index(s, ":"); i >= 0 {
+		d = Digest{Algorithm: DigestAlgorithm(s[:i]), Hex: s[i+1:]}
+	}
+	h := d.Algorithm.newHash()
+	if h == nil {
+		return Digest{}, fmt.Errorf("invalid digest %q: unsupported algorithm %q", s, d.Algorithm)
+	}
+	if data, err := hex.DecodeString(d.Hex); err != nil || len(data) != h.Size() {
+		return Digest{}, fmt.Errorf("invalid digest %q", s)
+	}
+	d.Hex = strings.ToLower(d.Hex)
+	return d, nil
+}
+
+// NewDigest returns the digest, made with the given
+// algorithm, of the data read from r.
+func NewDigest(alg DigestAlgorithm, r io.Reader) (Digest, error) {
+	h := alg.newHash()
+	if h == nil {
+		return Digest{}, fmt.Errorf("unsupported digest algorithm %q", alg)
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return Digest{}, err
+	}
+	return Digest{Algorithm: alg, Hex: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// String returns the digest in the form "algorithm:hex".
+func (d Digest) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return string(d.Algorithm) + ":" + d.Hex
+}
+
+// IsZero reports whether d is the zero Digest.
+func (d Digest) IsZero() bool {
+	return d == Digest{}
+}
+
+// Equal reports whether d and other hold the same digest
+// made with the same algorithm.
+func (d Digest) Equal(other Digest) bool {
+	return d.Algorithm == other.Algorithm && strings.EqualFold(d.Hex, other.Hex)
+}
+
+// Verify returns an error unless the data read from
+// r has the digest d.
+func (d Digest) Verify(r io.Reader) error {
+	got, err := NewDigest(d.Algorithm, r)
+	if err != nil {
+		return err
+	}
+	if !got.Equal(d) {
+		return fmt.Errorf("%s digest mismatch", strings.ToUpper(string(d.Algorithm)))
+	}
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Digest) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Digest) UnmarshalText(data []byte) error {
+	if len(data) == 0 {
+		*d = Digest{}
+		return nil
+	}
+	parsed, err := ParseDigest(string(data))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"encoding/json"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type DigestSuite struct{}
+
+var _ = gc.Suite(&DigestSuite{})
+
+const (
+	helloSha256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	helloSha384 = "59e1748777448c69de6b800d7a33bbfb9ff1b463e44354c3553bcdb9c666fa90125a3c79f90397bdf5f6a13de828684f"
+)
+
+func (s *DigestSuite) TestNewDigest(c *gc.C) {
+	d, err := charm.NewDigest(charm.SHA256, strings.NewReader("hello"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(d, gc.Equals, charm.Digest{Algorithm: charm.SHA256, Hex: helloSha256})
+	c.Assert(d.String(), gc.Equals, "sha256:"+helloSha256)
+
+	d, err = charm.NewDigest(charm.SHA384, strings.NewReader("hello"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(d, gc.Equals, charm.Digest{Algorithm: charm.SHA384, Hex: helloSha384})
+
+	_, err = charm.NewDigest("md5", strings.NewReader("hello"))
+	c.Assert(err, gc.ErrorMatches, `unsupported digest algorithm "md5"`)
+}
+
+var parseDigestTests = []struct {
+	digest string
+	expect charm.Digest
+	err    string
+}{{
+	digest: "sha256:" + helloSha256,
+	expect: charm.Digest{Algorithm: charm.SHA256, Hex: helloSha256},
+}, {
+	digest: "sha384:" + strings.ToUpper(helloSha384),
+	expect: charm.Digest{Algorithm: charm.SHA384, Hex: helloSha384},
+}, {
+	digest: helloSha256,
+	expect: charm.Digest{Algorithm: charm.SHA256, Hex: helloSha256},
+}, {
+	digest: helloSha384,
+	err:    `invalid digest "59e1.*"`,
+}, {
+	digest: "sha384:" + helloSha256,
+	err:    `invalid digest "sha384:2cf2.*"`,
+}, {
+	digest: "md5:5d41402abc4b2a76b9719d911017c592",
+	err:    `invalid digest "md5:.*": unsupported algorithm "md5"`,
+}, {
+	digest: "sha256:xyz",
+	err:    `invalid digest "sha256:xyz"`,
+}, {
+	digest: "",
+	err:    `invalid digest ""`,
+}}
+
+func (s *DigestSuite) TestParseDigest(c *gc.C) {
+	for i, test := range parseDigestTests {
+		c.Logf("test %d: %q", i, test.digest)
+		d, err := charm.ParseDigest(test.digest)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(d, gc.Equals, test.expect)
+	}
+}
+
+func (s *DigestSuite) TestEqual(c *gc.C) {
+	d := charm.Digest{Algorithm: charm.SHA256, Hex: helloSha256}
+	c.Assert(d.Equal(charm.Digest{Algorithm: charm.SHA256, Hex: strings.ToUpper(helloSha256)}), jc.IsTrue)
+	c.Assert(d.Equal(charm.Digest{Algorithm: charm.SHA384, Hex: helloSha256}), jc.IsFalse)
+	c.Assert(d.Equal(charm.Digest{Algorithm: charm.SHA256, Hex: helloSha384}), jc.IsFalse)
+}
+
+func (s *DigestSuite) TestVerify(c *gc.C) {
+	d := charm.Digest{Algorithm: charm.SHA384, Hex: helloSha384}
+	c.Assert(d.Verify(strings.NewReader("hello")), gc.IsNil)
+	c.Assert(d.Verify(strings.NewReader("goodbye")), gc.ErrorMatches, "SHA384 digest mismatch")
+}
+
+func (s *DigestSuite) TestJSON(c *gc.C) {
+	type doc struct {
+		Digest charm.Digest `json:"digest"`
+	}
+	data, err := json.Marshal(doc{charm.Digest{Algorithm: charm.SHA384, Hex: helloSha384}})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `{"digest":"sha384:`+helloSha384+`"}`)
+
+	var d doc
+	err = json.Unmarshal(data, &d)
+	c.Assert(err, gc.IsNil)
+	c.Assert(d.Digest, gc.Equals, charm.Digest{Algorithm: charm.SHA384, Hex: helloSha384})
+
+	// Digests stored without an algorithm are SHA256 digests.
+	err = json.Unmarshal([]byte(`{"digest":"`+helloSha256+`"}`), &d)
+	c.Assert(err, gc.IsNil)
+	c.Assert(d.Digest, gc.Equals, charm.Digest{Algorithm: charm.SHA256, Hex: helloSha256})
+
+	err = json.Unmarshal([]byte(`{"digest":"sha256:bad"}`), &d)
+	c.Assert(err, gc.ErrorMatches, `invalid digest "sha256:bad"`)
+}
@@ -0,0 +1,66 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// zipEncryptedFlag holds the general purpose flag
+// bit that marks an encrypted zip archive member.
+const zipEncryptedFlag = 0x1
+
+// EncryptedMembersError is returned when a charm archive holds
+// encrypted files, such as those of archives created by "zip -e",
+// which cannot be read without a password.
+type EncryptedMembersError struct {
+	// Paths holds the paths of the encrypted
+	// files, in the order of the archive.
+	Paths []string
+}
+
+func (e *EncryptedMembersError) Error() string {
+	return fmt.Sprintf("charm archive has password-protected files: %s", strings.Join(e.Paths, ", "))
+}
+
+// encryptedMembers returns the names of
+// the given files that are encrypted.
+func encryptedMembers(files []*zip.File) []string {
+	var names []string
+	for _, fh := range files {
+		if fh.Flags&zipEncryptedFlag != 0 {
+			names = append(names, fh.Name)
+		}
+	}
+	return names
+}
+
+// checkEncryptedMembers returns an *EncryptedMembersError
+// if any of the given files is encrypted.
+func checkEncryptedMembers(files []*zip.File) error {
+	if names := encryptedMembers(files); len(names) > 0 {
+		return &EncryptedMembersError{Paths: names}
+	}
+	return nil
+}
+
+// LintArchiveEncryption returns a problem for each encrypted file in
+// the charm archive read from r, which holds size bytes. Archives with
+// encrypted files cannot be read as charms, so this can be used to
+// explain the rejection of an upload alongside the other problems
+// found in it.
+func LintArchiveEncryption(r io.ReaderAt, size int64) ([]string, error) {
+	zipr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, name := range encryptedMembers(zipr.File) {
+		problems = append(problems, fmt.Sprintf("file %q is password-protected", name))
+	}
+	return problems, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type EncryptedSuite struct{}
+
+var _ = gc.Suite(&EncryptedSuite{})
+
+// encryptedArchive returns the contents of an archive in
+// which the given files are marked as encrypted.
+func encryptedArchive(c *gc.C, encrypted ...string) []byte {
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	for _, name := range []string{"metadata.yaml", "hooks/install", "README"} {
+		h := &zip.FileHeader{Name: name}
+		for _, e := range encrypted {
+			if e == name {
+				h.Flags |= 0x1
+			}
+		}
+		w, err := zipw.CreateHeader(h)
+		c.Assert(err, gc.IsNil)
+		if name == "metadata.yaml" {
+			_, err = w.Write([]byte(verifyMeta))
+			c.Assert(err, gc.IsNil)
+		}
+	}
+	c.Assert(zipw.Close(), gc.IsNil)
+	return buf.Bytes()
+}
+
+func (s *EncryptedSuite) TestReadEncryptedArchive(c *gc.C) {
+	data := encryptedArchive(c, "hooks/install", "README")
+	_, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, jc.DeepEquals, &charm.EncryptedMembersError{
+		Paths: []string{"hooks/install", "README"},
+	})
+	c.Assert(err, gc.ErrorMatches, `charm archive has password-protected files: hooks/install, README`)
+
+	path := filepath.Join(c.MkDir(), "encrypted.charm")
+	err = ioutil.WriteFile(path, data, 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.ReadCharmArchive(path)
+	c.Assert(err, gc.FitsTypeOf, &charm.EncryptedMembersError{})
+	_, err = charm.ReadCharmArchiveMeta(path)
+	c.Assert(err, gc.FitsTypeOf, &charm.EncryptedMembersError{})
+
+	_, err = charm.ReadCharmArchiveBytes(encryptedArchive(c))
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *EncryptedSuite) TestLintArchiveEncryption(c *gc.C) {
+	data := encryptedArchive(c, "metadata.yaml", "README")
+	problems, err := charm.LintArchiveEncryption(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, []string{
+		`file "metadata.yaml" is password-protected`,
+		`file "README" is password-protected`,
+	})
+
+	data = encryptedArchive(c)
+	problems, err = charm.LintArchiveEncryption(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, gc.HasLen, 0)
+
+	_, err = charm.LintArchiveEncryption(bytes.NewReader([]byte("not a zip")), 9)
+	c.Assert(err, gc.ErrorMatches, "zip: not a valid zip file")
+}
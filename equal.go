@@ -0,0 +1,118 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"reflect"
+)
+
+// EqualOptions holds options for Equal.
+type EqualOptions struct {
+	// CompareRevision specifies that charms with
+	// different revisions are not equal.
+	CompareRevision bool
+
+	// IgnoreFiles specifies that only the charms' metadata,
+	// configuration, metrics and actions are compared, and
+	// not the contents of their other files.
+	IgnoreFiles bool
+}
+
+// Equal reports whether the given charms, each of which must be a
+// *CharmDir or a *CharmArchive unless opts.IgnoreFiles is set, are
+// semantically equal: whether they have the same metadata,
+// configuration, metrics and actions, and hold files with the same
+// contents and modes at the same paths. Differences that do not
+// affect the charm, such as file times, the order of files in an
+// archive or the revision file and revision history, are ignored,
+// as are the provenance record, which holds the time the charm was
+// built, and any annotations. The owners record is compared, as it
+// decides whose signatures the charm accepts.
+func Equal(a, b Charm, opts EqualOptions) (bool, error) {
+	if opts.CompareRevision && a.Revision() != b.Revision() {
+		return false, nil
+	}
+	if !reflect.DeepEqual(a.Meta(), b.Meta()) ||
+		!reflect.DeepEqual(a.Config(), b.Config()) ||
+		!reflect.DeepEqual(a.Metrics(), b.Metrics()) ||
+		!reflect.DeepEqual(a.Actions(), b.Actions()) {
+		return false, nil
+	}
+	if opts.IgnoreFiles {
+		return true, nil
+	}
+	filesA, err := charmFileDigests(a)
+	if err != nil {
+		return false, err
+	}
+	filesB, err := charmFileDigests(b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(filesA, filesB), nil
+}
+
+// fileDigest holds the digest of a file's
+// contents along with its significant mode bits.
+type fileDigest struct {
+	sha256 string
+	mode   os.FileMode
+}
+
+// charmFileDigests returns the digests of the files in the
+// given charm, keyed by path.
+func charmFileDigests(ch Charm) (map[string]fileDigest, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	digests := make(map[string]fileDigest)
+	for _, fh := range zipr.File {
+		if excludedFromDigest(fh.Name) {
+			continue
+		}
+		digest, err := zipFileDigest(fh)
+		if err != nil {
+			return nil, err
+		}
+		digests[fh.Name] = fileDigest{
+			sha256: digest,
+			mode:   fh.Mode() & (os.ModeType | 0100),
+		}
+	}
+	return digests, nil
+}
+
+// excludedFromDigest reports whether the archive member with the
+// given name is left out when comparing charm contents: directories,
+// and files that may change without changing the charm.
+func excludedFromDigest(name string) bool {
+	if name == "" || name[len(name)-1] == '/' {
+		return true
+	}
+	switch name {
+	case RevisionFile, revisionHistoryFile, provenanceFile, annotationsFile:
+		return true
+	}
+	return false
+}
+
+func zipFileDigest(fh *zip.File) (string, error) {
+	r, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type EqualSuite struct{}
+
+var _ = gc.Suite(&EqualSuite{})
+
+// clonedDummy returns a copy of the dummy charm directory
+// along with an archive of it.
+func (s *EqualSuite) clonedDummy(c *gc.C) (*charm.CharmDir, *charm.CharmArchive) {
+	dir, err := charm.ReadCharmDir(charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	return dir, archiveDir(c, dir.Path)
+}
+
+func (s *EqualSuite) assertEqual(c *gc.C, a, b charm.Charm, opts charm.EqualOptions, expect bool) {
+	equal, err := charm.Equal(a, b, opts)
+	c.Assert(err, gc.IsNil)
+	c.Assert(equal, gc.Equals, expect)
+}
+
+func (s *EqualSuite) TestEqualDirAndArchive(c *gc.C) {
+	dir, archive := s.clonedDummy(c)
+	s.assertEqual(c, dir, archive, charm.EqualOptions{}, true)
+	s.assertEqual(c, archive, dir, charm.EqualOptions{CompareRevision: true}, true)
+}
+
+func (s *EqualSuite) TestEqualIgnoresTimesAndRevision(c *gc.C) {
+	dir, archive := s.clonedDummy(c)
+	then := time.Now().Add(-24 * time.Hour)
+	err := os.Chtimes(filepath.Join(dir.Path, "src", "hello.c"), then, then)
+	c.Assert(err, gc.IsNil)
+	err = dir.SetDiskRevision(42)
+	c.Assert(err, gc.IsNil)
+	other := archiveDir(c, dir.Path)
+
+	s.assertEqual(c, archive, other, charm.EqualOptions{}, true)
+	s.assertEqual(c, archive, other, charm.EqualOptions{CompareRevision: true}, false)
+}
+
+func (s *EqualSuite) TestEqualFileContents(c *gc.C) {
+	dir, archive := s.clonedDummy(c)
+	err := ioutil.WriteFile(filepath.Join(dir.Path, "src", "hello.c"), []byte("changed"), 0644)
+	c.Assert(err, gc.IsNil)
+	s.assertEqual(c, dir, archive, charm.EqualOptions{}, false)
+	s.assertEqual(c, dir, archive, charm.EqualOptions{IgnoreFiles: true}, true)
+}
+
+func (s *EqualSuite) TestEqualExtraFile(c *gc.C) {
+	dir, archive := s.clonedDummy(c)
+	err := ioutil.WriteFile(filepath.Join(dir.Path, "extra"), nil, 0644)
+	c.Assert(err, gc.IsNil)
+	s.assertEqual(c, dir, archive, charm.EqualOptions{}, false)
+}
+
+func (s *EqualSuite) TestEqualFileMode(c *gc.C) {
+	dir, archive := s.clonedDummy(c)
+	err := os.Chmod(filepath.Join(dir.Path, "src", "hello.c"), 0755)
+	c.Assert(err, gc.IsNil)
+	s.assertEqual(c, dir, archive, charm.EqualOptions{}, false)
+}
+
+func (s *EqualSuite) TestEqualMetadata(c *gc.C) {
+	dir, _ := s.clonedDummy(c)
+	other, _ := s.clonedDummy(c)
+	other.Meta().Summary = "something else"
+	s.assertEqual(c, dir, other, charm.EqualOptions{IgnoreFiles: true}, false)
+}
+
+func (s *EqualSuite) TestEqualDifferentCharms(c *gc.C) {
+	dummy := charmtesting.Charms.CharmDir("dummy")
+	mysql := charmtesting.Charms.CharmDir("mysql")
+	s.assertEqual(c, dummy, mysql, charm.EqualOptions{}, false)
+}
+
+func (s *EqualSuite) TestEqualProvenanceIgnored(c *gc.C) {
+	dir, archive := s.clonedDummy(c)
+	_, err := dir.WriteProvenance(charm.Provenance{BuilderId: "builder"})
+	c.Assert(err, gc.IsNil)
+	equal, err := charm.Equal(dir, archive, charm.EqualOptions{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(equal, jc.IsTrue)
+}
@@ -0,0 +1,116 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"sync"
+)
+
+// Event kinds reported to the Logger.
+const (
+	// EventFileSkipped is reported when a file is left
+	// out of an archive.
+	EventFileSkipped = "file skipped"
+
+	// EventSymlinkRejected is reported when a symlink
+	// pointing outside a charm is found.
+	EventSymlinkRejected = "symlink rejected"
+
+	// EventUnportableName is reported when a file whose
+	// name cannot be used on some filesystems is expanded;
+	// see CheckMemberNames.
+	EventUnportableName = "unportable name"
+
+	// EventHookMadeExecutable is reported when a hook
+	// is made executable.
+	EventHookMadeExecutable = "hook made executable"
+
+	// EventActionMadeExecutable is reported when an
+	// action executable is made executable.
+	EventActionMadeExecutable = "action made executable"
+
+	// EventDuplicateLinked is reported when a file identical
+	// to one already in an archive is stored as a symlink to it.
+	EventDuplicateLinked = "duplicate linked"
+
+	// EventRetry is reported when a download is retried.
+	EventRetry = "retry"
+
+	// EventCacheHit and EventCacheMiss are reported when a
+	// charm is found or not found in the download cache.
+	EventCacheHit  = "cache hit"
+	EventCacheMiss = "cache miss"
+)
+
+// Event describes something that happened while
+// processing a charm.
+type Event struct {
+	// Op holds the operation during which the event happened:
+	// "archive", "expand", "fetch" or "cache".
+	Op string
+
+	// Kind holds the kind of event, such as EventFileSkipped.
+	Kind string
+
+	// Path holds the path of the file concerned, if any.
+	Path string
+
+	// Fields holds any further details, such as the
+	// reason a file was skipped.
+	Fields map[string]interface{}
+}
+
+// Logger is implemented by types that receive the events reported
+// by ExpandTo, ArchiveTo and the charm store client, so that
+// problems such as files missing from an archive can be diagnosed.
+type Logger interface {
+	LogEvent(e Event)
+}
+
+// nopLogger is the default Logger, which discards all events.
+type nopLogger struct{}
+
+func (nopLogger) LogEvent(Event) {}
+
+var (
+	eventLoggerMu sync.Mutex
+	eventLogger   Logger = nopLogger{}
+)
+
+// SetLogger sets the Logger that receives events, returning the
+// previous one. If l is nil, events are discarded, as they are
+// by default.
+func SetLogger(l Logger) Logger {
+	if l == nil {
+		l = nopLogger{}
+	}
+	eventLoggerMu.Lock()
+	defer eventLoggerMu.Unlock()
+	old := eventLogger
+	eventLogger = l
+	return old
+}
+
+// logEvent reports an event to the current Logger. The fields
+// are given as alternating names and values.
+func logEvent(op, kind, path string, fields ...interface{}) {
+	eventLoggerMu.Lock()
+	l := eventLogger
+	eventLoggerMu.Unlock()
+	if _, ok := l.(nopLogger); ok {
+		return
+	}
+	e := Event{
+		Op:   op,
+		Kind: kind,
+		Path: path,
+	}
+	if len(fields) > 0 {
+		e.Fields = make(map[string]interface{})
+		for i := 0; i+1 < len(fields); i += 2 {
+			e.Fields[fields[i].(string)] = fields[i+1]
+		}
+	}
+	l.LogEvent(e)
+}
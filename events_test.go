@@ -0,0 +1,147 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type EventsSuite struct {
+	logger *recordingLogger
+}
+
+var _ = gc.Suite(&EventsSuite{})
+
+// recordingLogger is a charm.Logger that records the events it receives.
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []charm.Event
+}
+
+func (l *recordingLogger) LogEvent(e charm.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+// kind returns the events of the given kind.
+func (l *recordingLogger) kind(kind string) []charm.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var events []charm.Event
+	for _, e := range l.events {
+		if e.Kind == kind {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func (s *EventsSuite) SetUpTest(c *gc.C) {
+	s.logger = &recordingLogger{}
+	charm.SetLogger(s.logger)
+}
+
+func (s *EventsSuite) TearDownTest(c *gc.C) {
+	charm.SetLogger(nil)
+}
+
+func (s *EventsSuite) TestSetLogger(c *gc.C) {
+	old := charm.SetLogger(nil)
+	c.Assert(old, gc.Equals, s.logger)
+	charm.SetLogger(s.logger)
+}
+
+func (s *EventsSuite) TestArchiveToEvents(c *gc.C) {
+	// The dummy charm holds hidden files and a build directory.
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	err = dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.logger.kind(charm.EventFileSkipped), jc.DeepEquals, []charm.Event{{
+		Op:     "archive",
+		Kind:   charm.EventFileSkipped,
+		Path:   ".dir",
+		Fields: map[string]interface{}{"reason": "hidden"},
+	}, {
+		Op:     "archive",
+		Kind:   charm.EventFileSkipped,
+		Path:   ".ignored",
+		Fields: map[string]interface{}{"reason": "hidden"},
+	}, {
+		Op:     "archive",
+		Kind:   charm.EventFileSkipped,
+		Path:   "build",
+		Fields: map[string]interface{}{"reason": "build directory"},
+	}, {
+		Op:     "archive",
+		Kind:   charm.EventFileSkipped,
+		Path:   "revision",
+		Fields: map[string]interface{}{"reason": "revision written separately"},
+	}})
+
+	err = os.Symlink("../../target", filepath.Join(path, "hooks", "bad"))
+	c.Assert(err, gc.IsNil)
+	err = dir.ArchiveTo(&buf)
+	c.Assert(err, gc.ErrorMatches, `symlink "hooks/bad" links out of charm: "../../target"`)
+	c.Assert(s.logger.kind(charm.EventSymlinkRejected), jc.DeepEquals, []charm.Event{{
+		Op:     "archive",
+		Kind:   charm.EventSymlinkRejected,
+		Path:   "hooks/bad",
+		Fields: map[string]interface{}{"target": "../../target"},
+	}})
+}
+
+func (s *EventsSuite) TestExpandToEvents(c *gc.C) {
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	add := func(name, content string, mode os.FileMode) {
+		h := &zip.FileHeader{Name: name}
+		h.SetMode(mode)
+		w, err := zipw.CreateHeader(h)
+		c.Assert(err, gc.IsNil)
+		_, err = w.Write([]byte(content))
+		c.Assert(err, gc.IsNil)
+	}
+	add("metadata.yaml", verifyMeta, 0644)
+	add("hooks/install", "#!/bin/sh\n", 0644)
+	c.Assert(zipw.Close(), gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	err = archive.ExpandTo(c.MkDir())
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.logger.events, jc.DeepEquals, []charm.Event{{
+		Op:   "expand",
+		Kind: charm.EventHookMadeExecutable,
+		Path: "hooks/install",
+	}})
+
+	buf.Reset()
+	zipw = zip.NewWriter(&buf)
+	add("metadata.yaml", verifyMeta, 0644)
+	add("hooks/bad", "../../target", os.ModeSymlink|0777)
+	c.Assert(zipw.Close(), gc.IsNil)
+	archive, err = charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	err = archive.ExpandTo(c.MkDir())
+	c.Assert(err, gc.NotNil)
+	c.Assert(s.logger.kind(charm.EventSymlinkRejected), jc.DeepEquals, []charm.Event{{
+		Op:     "expand",
+		Kind:   charm.EventSymlinkRejected,
+		Path:   "hooks/bad",
+		Fields: map[string]interface{}{"target": "../../target"},
+	}})
+}
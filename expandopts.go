@@ -0,0 +1,165 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ExpandOptions holds options for ExpandToWithOptions.
+type ExpandOptions struct {
+	// Owner, if not nil, holds the user and group that will own
+	// the expanded files. Changing ownership requires root.
+	Owner *FileOwner
+
+	// Umask holds permission bits that are cleared on
+	// every expanded file and directory.
+	Umask os.FileMode
+
+	// Mode, if not nil, is called with the slash-separated path,
+	// relative to the charm root, and mode of each expanded file
+	// and directory, and returns the permissions it should have.
+	// The root itself has the path ".". The umask is applied
+	// to the result.
+	Mode func(path string, mode os.FileMode) os.FileMode
+}
+
+// FileOwner identifies the owner of a file.
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// ExpandToWithOptions is like ExpandTo except that the expanded files
+// are given the ownership and permissions specified by opts, so that,
+// for example, an agent can expand a charm for a unit running as an
+// unprivileged user. The archive is expanded into a directory next to
+// dir and moved into place only once ownership and permissions have
+// been set, so that no file is ever seen in dir with the wrong ones.
+func (a *CharmArchive) ExpandToWithOptions(dir string, opts ExpandOptions) (err error) {
+	defer func() {
+		audit(AuditExpand, dir, a, archiveSHA256(a), err)
+	}()
+	if opts.Owner != nil && os.Getuid() != 0 {
+		return fmt.Errorf("cannot expand charm with owner %d:%d: changing ownership requires root", opts.Owner.UID, opts.Owner.GID)
+	}
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	staging, err := ioutil.TempDir(filepath.Dir(dir), "."+filepath.Base(dir)+"-expand-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	if err := a.extractTo(a.zopen, staging); err != nil {
+		return err
+	}
+	err = filepath.Walk(staging, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(staging, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			// The staging directory is not moved, so the
+			// options are applied to dir itself instead.
+			info, err = os.Stat(dir)
+			if err != nil {
+				return err
+			}
+			path = dir
+		}
+		return applyExpandOptions(path, filepath.ToSlash(rel), info, opts)
+	})
+	if err != nil {
+		return err
+	}
+	// The stamp is moved into place last, so that it is
+	// only present once the charm is fully expanded.
+	if err := os.Remove(filepath.Join(dir, digestStampFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	stamp := staging + digestStampFile
+	if err := os.Rename(filepath.Join(staging, digestStampFile), stamp); err != nil {
+		return err
+	}
+	defer os.Remove(stamp)
+	if err := moveExpanded(staging, dir, opts.Owner); err != nil {
+		return err
+	}
+	return os.Rename(stamp, filepath.Join(dir, digestStampFile))
+}
+
+// applyExpandOptions gives the file at path, whose slash-separated
+// path relative to the charm root is rel, the ownership and
+// permissions specified by opts.
+func applyExpandOptions(path, rel string, info os.FileInfo, opts ExpandOptions) error {
+	if opts.Owner != nil {
+		if err := os.Lchown(path, opts.Owner.UID, opts.Owner.GID); err != nil {
+			return err
+		}
+	}
+	mode := info.Mode()
+	if mode&os.ModeSymlink != 0 {
+		return nil
+	}
+	perm := mode.Perm()
+	if opts.Mode != nil {
+		perm = opts.Mode(rel, mode).Perm()
+	}
+	perm &^= opts.Umask
+	if perm == mode.Perm() {
+		return nil
+	}
+	return os.Chmod(path, perm)
+}
+
+// moveExpanded moves the contents of the directory src into the
+// directory dst, merging directories present in both and replacing
+// anything else already in dst. Directories already in dst are given
+// the permissions of those in src and, if owner is not nil, the
+// given owner.
+func moveExpanded(src, dst string, owner *FileOwner) error {
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		from := filepath.Join(src, info.Name())
+		to := filepath.Join(dst, info.Name())
+		existing, err := os.Lstat(to)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		case existing.IsDir() && info.IsDir():
+			if owner != nil {
+				if err := os.Lchown(to, owner.UID, owner.GID); err != nil {
+					return err
+				}
+			}
+			if err := os.Chmod(to, info.Mode().Perm()); err != nil {
+				return err
+			}
+			if err := moveExpanded(from, to, owner); err != nil {
+				return err
+			}
+			continue
+		case existing.IsDir() || info.IsDir():
+			if err := os.RemoveAll(to); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
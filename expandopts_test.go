@@ -0,0 +1,113 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ExpandOptionsSuite struct{}
+
+var _ = gc.Suite(&ExpandOptionsSuite{})
+
+func (s *ExpandOptionsSuite) TestUmask(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	dir := filepath.Join(c.MkDir(), "charm")
+	err := archive.ExpandToWithOptions(dir, charm.ExpandOptions{
+		Umask: 0027,
+	})
+	c.Assert(err, gc.IsNil)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		c.Assert(err, gc.IsNil)
+		if info.Mode()&os.ModeSymlink == 0 {
+			c.Check(info.Mode().Perm()&0027, gc.Equals, os.FileMode(0), gc.Commentf("%s", path))
+		}
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(filepath.Join(dir, "hooks", "install"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&0100, gc.Not(gc.Equals), os.FileMode(0))
+	data, err := ioutil.ReadFile(filepath.Join(dir, charm.RevisionFile))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "1")
+}
+
+func (s *ExpandOptionsSuite) TestMode(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	dir := filepath.Join(c.MkDir(), "charm")
+	var paths []string
+	err := archive.ExpandToWithOptions(dir, charm.ExpandOptions{
+		Mode: func(path string, mode os.FileMode) os.FileMode {
+			paths = append(paths, path)
+			if strings.HasPrefix(path, "hooks/") {
+				return 0700
+			}
+			return mode
+		},
+		Umask: 0002,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(paths, jc.DeepEquals, []string{
+		".", ".charm-digest", "actions.yaml", "config.yaml", "empty", "empty/.gitkeep",
+		"hooks", "hooks/install", "metadata.yaml", "revision", "src", "src/hello.c",
+	})
+	info, err := os.Stat(filepath.Join(dir, "hooks", "install"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0700))
+}
+
+func (s *ExpandOptionsSuite) TestExpandIntoExistingDir(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	dir := c.MkDir()
+	err := os.MkdirAll(filepath.Join(dir, "hooks"), 0777)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "hooks", "install"), []byte("old"), 0644)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "keep"), []byte("kept"), 0644)
+	c.Assert(err, gc.IsNil)
+
+	err = archive.ExpandToWithOptions(dir, charm.ExpandOptions{Umask: 0022})
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "hooks", "install"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Not(gc.Equals), "old")
+	data, err = ioutil.ReadFile(filepath.Join(dir, "keep"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "kept")
+	info, err := os.Stat(filepath.Join(dir, "hooks"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm()&0022, gc.Equals, os.FileMode(0))
+
+	// No staging directory is left behind.
+	infos, err := ioutil.ReadDir(filepath.Dir(dir))
+	c.Assert(err, gc.IsNil)
+	for _, info := range infos {
+		c.Assert(strings.Contains(info.Name(), "-expand-"), jc.IsFalse)
+	}
+}
+
+func (s *ExpandOptionsSuite) TestOwner(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	dir := filepath.Join(c.MkDir(), "charm")
+	err := archive.ExpandToWithOptions(dir, charm.ExpandOptions{
+		Owner: &charm.FileOwner{UID: os.Getuid(), GID: os.Getgid()},
+	})
+	if os.Getuid() != 0 {
+		c.Assert(err, gc.ErrorMatches, `cannot expand charm with owner .*: changing ownership requires root`)
+		return
+	}
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(filepath.Join(dir, charm.MetadataFile))
+	c.Assert(err, gc.IsNil)
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// digestStampFile holds the name of the file written to the root of
+// an expanded charm that holds the digest of the archive it was
+// expanded from. Being hidden, it is left out when the expanded charm
+// is archived.
+const digestStampFile = ".charm-digest"
+
+// writeDigestStamp writes the digest of the archive opened by
+// zopen to the stamp file in dir.
+func writeDigestStamp(zopen zipOpener, dir string) error {
+	r, err := zopen.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	digest, err := NewDigest(SHA256, r)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, digestStampFile), []byte(digest.String()+"\n"), 0644)
+}
+
+// NeedsExpand reports whether the archive needs to be expanded into
+// dir: it returns false only if dir holds a charm expanded from an
+// archive with the same contents and revision, as recorded by
+// ExpandTo, so that agents may avoid expanding an unchanged charm
+// again on restart. Changes made to the expanded files since are
+// not detected.
+func NeedsExpand(dir string, archive *CharmArchive) (bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, digestStampFile))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	stamp, err := ParseDigest(strings.TrimSpace(string(data)))
+	if err != nil {
+		// The stamp is corrupt, so the
+		// charm cannot be trusted.
+		return true, nil
+	}
+	revision, err := ioutil.ReadFile(filepath.Join(dir, RevisionFile))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(string(revision)) != strconv.Itoa(archive.Revision()) {
+		return true, nil
+	}
+	r, err := archive.zopen.open()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	digest, err := NewDigest(stamp.Algorithm, r)
+	if err != nil {
+		return false, err
+	}
+	return !digest.Equal(stamp), nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ExpandStampSuite struct{}
+
+var _ = gc.Suite(&ExpandStampSuite{})
+
+func (s *ExpandStampSuite) TestNeedsExpand(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	dir := c.MkDir()
+	needs, err := charm.NeedsExpand(dir, archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(needs, jc.IsTrue)
+
+	err = archive.ExpandTo(dir)
+	c.Assert(err, gc.IsNil)
+	needs, err = charm.NeedsExpand(dir, archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(needs, jc.IsFalse)
+
+	// A different revision of the same archive
+	// needs expanding.
+	archive.SetRevision(archive.Revision() + 1)
+	needs, err = charm.NeedsExpand(dir, archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(needs, jc.IsTrue)
+
+	// As does a different archive.
+	other := charmtesting.Charms.CharmArchive(c.MkDir(), "wordpress")
+	needs, err = charm.NeedsExpand(dir, other)
+	c.Assert(err, gc.IsNil)
+	c.Assert(needs, jc.IsTrue)
+}
+
+func (s *ExpandStampSuite) TestNeedsExpandCorruptStamp(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	dir := c.MkDir()
+	err := archive.ExpandTo(dir)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, ".charm-digest"), []byte("garbage"), 0644)
+	c.Assert(err, gc.IsNil)
+	needs, err := charm.NeedsExpand(dir, archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(needs, jc.IsTrue)
+}
+
+func (s *ExpandStampSuite) TestStampWithOptions(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	dir := c.MkDir()
+	err := archive.ExpandToWithOptions(dir, charm.ExpandOptions{Umask: 0022})
+	c.Assert(err, gc.IsNil)
+	needs, err := charm.NeedsExpand(dir, archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(needs, jc.IsFalse)
+}
+
+func (s *ExpandStampSuite) TestStampNotArchived(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	dir := c.MkDir()
+	err := archive.ExpandTo(dir)
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(filepath.Join(dir, ".charm-digest"))
+	c.Assert(err, gc.IsNil)
+
+	charmDir, err := charm.ReadCharmDir(dir)
+	c.Assert(err, gc.IsNil)
+	path := filepath.Join(c.MkDir(), "dummy.charm")
+	f, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	err = charmDir.ArchiveTo(f)
+	f.Close()
+	c.Assert(err, gc.IsNil)
+	rearchived, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	manifest, err := rearchived.Manifest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(manifest.Contains(".charm-digest"), jc.IsFalse)
+}
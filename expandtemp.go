@@ -0,0 +1,109 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// ExpandTempOptions holds options for ExpandToTemp.
+type ExpandTempOptions struct {
+	// Dir holds the directory in which the temporary directory
+	// is created, such as "/dev/shm" to expand the charm into
+	// memory. If empty, os.TempDir() is used.
+	Dir string
+
+	// Prefix holds the prefix of the name of the temporary
+	// directory. If empty, "charm-" is used.
+	Prefix string
+
+	// ExpandOptions holds the ownership and permissions
+	// to give the expanded files.
+	ExpandOptions
+}
+
+// ExpandedCharm holds a charm archive expanded by ExpandToTemp.
+type ExpandedCharm struct {
+	// Path holds the path of the directory
+	// holding the expanded charm.
+	Path string
+
+	// Size holds the number of bytes the expanded
+	// charm was estimated to require.
+	Size uint64
+}
+
+// Cleanup removes the expanded charm.
+func (e *ExpandedCharm) Cleanup() error {
+	return os.RemoveAll(e.Path)
+}
+
+// ExpandToTemp expands the charm archive into a new temporary
+// directory, which should be removed by calling Cleanup on the
+// result once the charm is no longer needed. Before anything is
+// written, the space required by the expanded charm is checked
+// against the space available in the directory, where the platform
+// allows it, so that a charm too large for a small file system such
+// as /dev/shm is rejected without partially filling it.
+func (a *CharmArchive) ExpandToTemp(opts ExpandTempOptions) (*ExpandedCharm, error) {
+	parent := opts.Dir
+	if parent == "" {
+		parent = os.TempDir()
+	}
+	prefix := opts.Prefix
+	if prefix == "" {
+		prefix = "charm-"
+	}
+	size, err := a.expandedSize()
+	if err != nil {
+		return nil, err
+	}
+	free, ok, err := freeSpace(parent)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine free space in %q: %v", parent, err)
+	}
+	if ok && free < size {
+		return nil, fmt.Errorf("cannot expand charm into %q: %d bytes required, %d available", parent, size, free)
+	}
+	dir, err := ioutil.TempDir(parent, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.ExpandToWithOptions(dir, opts.ExpandOptions); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &ExpandedCharm{
+		Path: dir,
+		Size: size,
+	}, nil
+}
+
+// expandedBlockSize holds the size of the blocks in which the space
+// used by each expanded file is assumed to be allocated.
+const expandedBlockSize = 4096
+
+// expandedSize returns an estimate of the number of bytes
+// required to expand the archive, counting each file and
+// directory, and the files written alongside them, as a
+// whole number of blocks.
+func (a *CharmArchive) expandedSize() (uint64, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return 0, err
+	}
+	defer zipr.Close()
+	// Start with the revision file and the digest stamp.
+	size := uint64(2 * expandedBlockSize)
+	for _, fh := range zipr.File {
+		blocks := (fh.UncompressedSize64 + expandedBlockSize - 1) / expandedBlockSize
+		if blocks == 0 {
+			blocks = 1
+		}
+		size += blocks * expandedBlockSize
+	}
+	return size, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ExpandTempSuite struct{}
+
+var _ = gc.Suite(&ExpandTempSuite{})
+
+func (s *ExpandTempSuite) TestExpandToTemp(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	parent := c.MkDir()
+	expanded, err := archive.ExpandToTemp(charm.ExpandTempOptions{
+		Dir:    parent,
+		Prefix: "inspect-",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(filepath.Dir(expanded.Path), gc.Equals, parent)
+	c.Assert(strings.HasPrefix(filepath.Base(expanded.Path), "inspect-"), jc.IsTrue)
+	c.Assert(expanded.Size > 0, jc.IsTrue)
+
+	dir, err := charm.ReadCharmDir(expanded.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Meta(), jc.DeepEquals, archive.Meta())
+	c.Assert(dir.Revision(), gc.Equals, archive.Revision())
+
+	// Each call expands into a new directory.
+	other, err := archive.ExpandToTemp(charm.ExpandTempOptions{Dir: parent})
+	c.Assert(err, gc.IsNil)
+	c.Assert(other.Path, gc.Not(gc.Equals), expanded.Path)
+	c.Assert(strings.HasPrefix(filepath.Base(other.Path), "charm-"), jc.IsTrue)
+
+	err = expanded.Cleanup()
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(expanded.Path)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+	err = other.Cleanup()
+	c.Assert(err, gc.IsNil)
+	infos, err := ioutil.ReadDir(parent)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 0)
+}
+
+func (s *ExpandTempSuite) TestExpandToTempOptions(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	expanded, err := archive.ExpandToTemp(charm.ExpandTempOptions{
+		Dir: c.MkDir(),
+		ExpandOptions: charm.ExpandOptions{
+			Umask: 0077,
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	defer expanded.Cleanup()
+	info, err := os.Stat(filepath.Join(expanded.Path, "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm()&0077, gc.Equals, os.FileMode(0))
+}
+
+func (s *ExpandTempSuite) TestExpandToTempInsufficientSpace(c *gc.C) {
+	restore := charm.PatchFreeSpace(4096)
+	defer restore()
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	parent := c.MkDir()
+	_, err := archive.ExpandToTemp(charm.ExpandTempOptions{Dir: parent})
+	c.Assert(err, gc.ErrorMatches, `cannot expand charm into ".*": \d+ bytes required, 4096 available`)
+	infos, err := ioutil.ReadDir(parent)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 0)
+}
+
+func (s *ExpandTempSuite) TestExpandToTempCleansUp(c *gc.C) {
+	if os.Getuid() == 0 {
+		c.Skip("root can change ownership")
+	}
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	parent := c.MkDir()
+	_, err := archive.ExpandToTemp(charm.ExpandTempOptions{
+		Dir: parent,
+		ExpandOptions: charm.ExpandOptions{
+			Owner: &charm.FileOwner{UID: os.Getuid(), GID: os.Getgid()},
+		},
+	})
+	c.Assert(err, gc.NotNil)
+	infos, err := ioutil.ReadDir(parent)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 0)
+}
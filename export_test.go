@@ -3,6 +3,11 @@
 
 package charm
 
+import (
+	"bytes"
+	"time"
+)
+
 // Export meaningful bits for tests only.
 
 var IfaceExpander = ifaceExpander
@@ -10,3 +15,80 @@ var IfaceExpander = ifaceExpander
 func NewStore(url string) *CharmStore {
 	return &CharmStore{BaseURL: url}
 }
+
+// MetaSchemaFieldNames returns the names of the
+// fields accepted by the metadata schema.
+func MetaSchemaFieldNames() []string {
+	var names []string
+	for name := range charmSchemaFields {
+		names = append(names, name)
+	}
+	return names
+}
+
+// NewTestRateLimiter returns a limiter as returned by NewRateLimiter
+// that uses the given functions in place of time.Now and time.Sleep.
+func NewTestRateLimiter(bytesPerSecond int64, now func() time.Time, sleep func(time.Duration)) RateLimiter {
+	b := NewRateLimiter(bytesPerSecond).(*tokenBucket)
+	b.now = now
+	b.sleep = sleep
+	return b
+}
+
+// PatchFreeSpace makes ExpandToTemp see the given number of
+// bytes available in every directory, and returns a function
+// that restores the original behaviour.
+func PatchFreeSpace(free uint64) (restore func()) {
+	original := freeSpace
+	freeSpace = func(string) (uint64, bool, error) {
+		return free, true, nil
+	}
+	return func() {
+		freeSpace = original
+	}
+}
+
+// PatchMaxRepairDecompressed changes the number of bytes RepairArchive
+// decompresses before giving up, and returns a function that restores
+// the original limit.
+func PatchMaxRepairDecompressed(max int64) (restore func()) {
+	original := maxRepairDecompressed
+	maxRepairDecompressed = max
+	return func() {
+		maxRepairDecompressed = original
+	}
+}
+
+// PatchMaxVerifiedFileSize changes the size of the largest file
+// checked by Verify, and returns a function that restores the
+// original limit.
+func PatchMaxVerifiedFileSize(max int64) (restore func()) {
+	original := maxVerifiedFileSize
+	maxVerifiedFileSize = max
+	return func() {
+		maxVerifiedFileSize = original
+	}
+}
+
+// PoisonReadBuffers makes the buffers holding the YAML files read by
+// the package be overwritten as soon as they are released, and
+// returns a function that restores the original behaviour.
+func PoisonReadBuffers() (restore func()) {
+	original := releaseReadBuffer
+	releaseReadBuffer = func(buf *bytes.Buffer) {
+		data := buf.Bytes()
+		for i := range data {
+			data[i] = '?'
+		}
+		original(buf)
+	}
+	return func() {
+		releaseReadBuffer = original
+	}
+}
+
+// DecodeSimpleYAML decodes data as the default YAMLCodec does when it
+// does not use gopkg.in/yaml.v1, reporting whether it was able to.
+func DecodeSimpleYAML(data string) (interface{}, bool) {
+	return decodeSimpleYAML([]byte(data))
+}
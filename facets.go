@@ -0,0 +1,163 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MiscFacet holds the facet that charms are placed in when
+// none of their tags map to any other facet.
+const MiscFacet = "misc"
+
+// FacetMap maps charm tags to the store facets, such as "databases"
+// or "monitoring", under which charms are listed. It is used both
+// when indexing charms and when filtering searches, so that the
+// two agree on how charms are categorized. A FacetMap may be
+// used concurrently.
+type FacetMap struct {
+	mu     sync.RWMutex
+	facets map[string]string
+}
+
+// NewFacetMap returns a FacetMap holding no mappings.
+func NewFacetMap() *FacetMap {
+	return &FacetMap{
+		facets: make(map[string]string),
+	}
+}
+
+// Register records that charms with the given tag belong to the
+// given facet, replacing any earlier mapping for the tag. Tags
+// are compared without regard to case. Each facet is also
+// registered as a tag for itself.
+func (m *FacetMap) Register(tag, facet string) error {
+	tag, facet = normalizeTag(tag), normalizeTag(facet)
+	if !validTag(tag) {
+		return fmt.Errorf("invalid tag %q", tag)
+	}
+	if !validTag(facet) {
+		return fmt.Errorf("invalid facet %q", facet)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.facets[tag] = facet
+	if _, ok := m.facets[facet]; !ok {
+		m.facets[facet] = facet
+	}
+	return nil
+}
+
+// Facet returns the facet that the given tag maps to,
+// and whether there is one.
+func (m *FacetMap) Facet(tag string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	facet, ok := m.facets[normalizeTag(tag)]
+	return facet, ok
+}
+
+// Facets returns the facets that charms with the given tags belong
+// to, in sorted order and without duplicates. If none of the tags
+// maps to a facet, it returns MiscFacet alone.
+func (m *FacetMap) Facets(tags []string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found := make(map[string]bool)
+	var facets []string
+	for _, tag := range tags {
+		facet, ok := m.facets[normalizeTag(tag)]
+		if ok && !found[facet] {
+			found[facet] = true
+			facets = append(facets, facet)
+		}
+	}
+	if len(facets) == 0 {
+		return []string{MiscFacet}
+	}
+	sort.Strings(facets)
+	return facets
+}
+
+// AllFacets returns all the facets that tags map to,
+// in sorted order.
+func (m *FacetMap) AllFacets() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	found := map[string]bool{MiscFacet: true}
+	facets := []string{MiscFacet}
+	for _, facet := range m.facets {
+		if !found[facet] {
+			found[facet] = true
+			facets = append(facets, facet)
+		}
+	}
+	sort.Strings(facets)
+	return facets
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func validTag(tag string) bool {
+	return tag != "" && !strings.ContainsAny(tag, " \t\n,")
+}
+
+// DefaultFacets holds the facet mapping used by Meta.Facets.
+// Further mappings may be registered with RegisterFacet.
+var DefaultFacets = NewFacetMap()
+
+// defaultFacetTags holds the tags registered in
+// DefaultFacets, keyed by facet.
+var defaultFacetTags = map[string][]string{
+	"applications": {"app", "application", "blog", "cms", "wiki"},
+	"app-servers":  {"app-server", "application-server", "web-server", "webserver"},
+	"big-data":     {"bigdata", "hadoop", "analytics"},
+	"cache-proxy":  {"cache", "caching", "proxy", "load-balancer", "loadbalancer"},
+	"databases":    {"database", "db", "sql", "nosql"},
+	"file-servers": {"file-server", "fileserver", "nfs"},
+	"misc":         {"miscellaneous", "other"},
+	"monitoring":   {"metrics", "logging", "alerting"},
+	"network":      {"networking", "dns", "sdn"},
+	"openstack":    {},
+	"ops":          {"operations", "devops", "deployment"},
+	"security":     {"auth", "identity", "firewall"},
+	"storage":      {"block-storage", "object-storage"},
+}
+
+func init() {
+	for facet, tags := range defaultFacetTags {
+		mustRegisterFacet(facet, facet)
+		for _, tag := range tags {
+			mustRegisterFacet(tag, facet)
+		}
+	}
+}
+
+func mustRegisterFacet(tag, facet string) {
+	if err := DefaultFacets.Register(tag, facet); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterFacet registers a mapping from the given tag
+// to the given facet in DefaultFacets.
+func RegisterFacet(tag, facet string) error {
+	return DefaultFacets.Register(tag, facet)
+}
+
+// Facets returns the store facets that the charm belongs to according
+// to DefaultFacets. Its tags are used or, if it has none, its
+// categories, which tags supersede.
+func (m Meta) Facets() []string {
+	tags := m.Tags
+	if len(tags) == 0 {
+		tags = m.Categories
+	}
+	return DefaultFacets.Facets(tags)
+}
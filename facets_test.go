@@ -0,0 +1,57 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type FacetsSuite struct{}
+
+var _ = gc.Suite(&FacetsSuite{})
+
+func (s *FacetsSuite) TestFacetMap(c *gc.C) {
+	m := charm.NewFacetMap()
+	c.Assert(m.Facets([]string{"mysql"}), jc.DeepEquals, []string{"misc"})
+	c.Assert(m.Facets(nil), jc.DeepEquals, []string{"misc"})
+
+	c.Assert(m.Register("SQL", "Databases"), gc.IsNil)
+	c.Assert(m.Register("nagios", "monitoring"), gc.IsNil)
+	facet, ok := m.Facet("sql")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(facet, gc.Equals, "databases")
+	facet, ok = m.Facet("databases")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(facet, gc.Equals, "databases")
+
+	facets := m.Facets([]string{"nagios", "unknown", "sql", "Databases"})
+	c.Assert(facets, jc.DeepEquals, []string{"databases", "monitoring"})
+	c.Assert(m.AllFacets(), jc.DeepEquals, []string{"databases", "misc", "monitoring"})
+
+	// A later registration replaces an earlier one.
+	c.Assert(m.Register("sql", "monitoring"), gc.IsNil)
+	c.Assert(m.Facets([]string{"sql"}), jc.DeepEquals, []string{"monitoring"})
+}
+
+func (s *FacetsSuite) TestRegisterInvalid(c *gc.C) {
+	m := charm.NewFacetMap()
+	c.Assert(m.Register("", "databases"), gc.ErrorMatches, `invalid tag ""`)
+	c.Assert(m.Register("sql", "data bases"), gc.ErrorMatches, `invalid facet "data bases"`)
+}
+
+func (s *FacetsSuite) TestMetaFacets(c *gc.C) {
+	meta := charm.Meta{Tags: []string{"database", "monitoring"}, Categories: []string{"cache"}}
+	c.Assert(meta.Facets(), jc.DeepEquals, []string{"databases", "monitoring"})
+
+	meta = charm.Meta{Categories: []string{"cache"}}
+	c.Assert(meta.Facets(), jc.DeepEquals, []string{"cache-proxy"})
+
+	meta = charm.Meta{Tags: []string{"facets-test-tag"}}
+	c.Assert(meta.Facets(), jc.DeepEquals, []string{"misc"})
+	c.Assert(charm.RegisterFacet("facets-test-tag", "ops"), gc.IsNil)
+	c.Assert(meta.Facets(), jc.DeepEquals, []string{"ops"})
+}
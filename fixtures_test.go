@@ -0,0 +1,89 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type FixturesSuite struct{}
+
+var _ = gc.Suite(&FixturesSuite{})
+
+func (s *FixturesSuite) TestFS(c *gc.C) {
+	fsys := charmtesting.Charms.FS()
+	data, err := fs.ReadFile(fsys, "quantal/dummy/metadata.yaml")
+	c.Assert(err, gc.IsNil)
+	meta, err := charm.ReadMeta(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Name, gc.Equals, "dummy")
+
+	_, err = fs.Stat(fsys, "bundle/wordpress-simple/bundle.yaml")
+	c.Assert(err, gc.IsNil)
+	_, err = fs.Stat(fsys, "quantal/dummy/.ignored")
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *FixturesSuite) TestMaterializeCharmDir(c *gc.C) {
+	path := charmtesting.Charms.MaterializeCharmDir(c.MkDir(), "dummy")
+	c.Assert(filepath.Base(path), gc.Equals, "dummy")
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	orig := charmtesting.Charms.CharmDir("dummy")
+	c.Assert(dir.Meta(), jc.DeepEquals, orig.Meta())
+	c.Assert(dir.Config(), jc.DeepEquals, orig.Config())
+	c.Assert(dir.Revision(), gc.Equals, orig.Revision())
+
+	info, err := os.Stat(filepath.Join(path, "hooks", "install"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0755))
+	info, err = os.Stat(filepath.Join(path, "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0644))
+}
+
+func (s *FixturesSuite) TestMaterializeBundleDir(c *gc.C) {
+	path := charmtesting.Charms.MaterializeBundleDir(c.MkDir(), "wordpress-simple")
+	b, err := charm.ReadBundleDir(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(b.Data(), jc.DeepEquals, charmtesting.Charms.BundleDir("wordpress-simple").Data())
+}
+
+func (s *FixturesSuite) TestMaterialize(c *gc.C) {
+	dst := c.MkDir()
+	err := charmtesting.Charms.Materialize(dst)
+	c.Assert(err, gc.IsNil)
+	target, err := os.Readlink(filepath.Join(dst, "series", "format2", "hooks", "symlink"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(target, gc.Equals, "../target")
+
+	// The materialized repository has the same files, executable
+	// files and symbolic links as the original.
+	err = filepath.Walk(charmtesting.Charms.Path(), func(path string, info os.FileInfo, err error) error {
+		c.Assert(err, gc.IsNil)
+		rel, err := filepath.Rel(charmtesting.Charms.Path(), path)
+		c.Assert(err, gc.IsNil)
+		c.Logf("checking %s", rel)
+		got, err := os.Lstat(filepath.Join(dst, rel))
+		c.Assert(err, gc.IsNil)
+		c.Assert(got.Mode()&os.ModeType, gc.Equals, info.Mode()&os.ModeType)
+		c.Assert(got.Mode()&0100, gc.Equals, info.Mode()&0100)
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+
+	repo := &charm.LocalRepository{Path: dst}
+	ch, err := repo.Get(charm.MustParseURL("local:quantal/wordpress"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "wordpress")
+}
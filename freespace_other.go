@@ -0,0 +1,17 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux
+// +build !darwin,!dragonfly,!freebsd,!linux
+
+package charm
+
+// freeSpace is a variable so that it can be changed by tests.
+var freeSpace = unknownFreeSpace
+
+// unknownFreeSpace reports that the free space cannot
+// be determined, as it is not known how to on this
+// platform.
+func unknownFreeSpace(dir string) (free uint64, ok bool, err error) {
+	return 0, false, nil
+}
@@ -0,0 +1,22 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build darwin || dragonfly || freebsd || linux
+// +build darwin dragonfly freebsd linux
+
+package charm
+
+import "syscall"
+
+// freeSpace is a variable so that it can be changed by tests.
+var freeSpace = statfsFreeSpace
+
+// statfsFreeSpace returns the number of bytes available to
+// unprivileged users on the file system holding dir.
+func statfsFreeSpace(dir string) (free uint64, ok bool, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, false, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), true, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+// update follows the convention for golden files
+// used by charmtesting.AssertGolden.
+var update = flag.Bool("update", false, "update golden files")
+
+type GoldenSuite struct{}
+
+var _ = gc.Suite(&GoldenSuite{})
+
+// setUpdate sets the update flag to the given
+// value, returning a function that restores it.
+func setUpdate(value bool) func() {
+	old := *update
+	*update = value
+	return func() {
+		*update = old
+	}
+}
+
+func (s *GoldenSuite) TestMetaGoldenYAML(c *gc.C) {
+	meta := charmtesting.Charms.CharmDir("wordpress").Meta()
+	path := filepath.Join(c.MkDir(), "golden", "wordpress.yaml")
+	restore := setUpdate(true)
+	charmtesting.AssertGolden(c, meta, path)
+	restore()
+
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, `(?s)description: .*\nname: wordpress\n.*requires:\n  cache:\n    interface: varnish\n.*`)
+	charmtesting.AssertGolden(c, meta, path)
+
+	meta.Summary = "changed"
+	diff, err := charmtesting.MatchGolden(meta, path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(diff, gc.Matches, `(?s).*\n-summary: .*\n\+summary: changed\n.*`)
+}
+
+func (s *GoldenSuite) TestConfigGoldenJSON(c *gc.C) {
+	config := charmtesting.Charms.CharmDir("dummy").Config()
+	path := filepath.Join(c.MkDir(), "config.json")
+	err := ioutil.WriteFile(path, []byte(`{"options": {}}`), 0644)
+	c.Assert(err, gc.IsNil)
+	diff, err := charmtesting.MatchGolden(config, path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(diff, gc.Matches, `(?s)-\{"options": \{\}\}\n\+\{\n\+  "options": \{\n.*`)
+
+	defer setUpdate(true)()
+	charmtesting.AssertGolden(c, config, path)
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, `(?s)\{\n  "options": \{\n    "outlook": \{\n      "description": .*`)
+}
+
+func (s *GoldenSuite) TestActionsGolden(c *gc.C) {
+	actions := charmtesting.Charms.CharmDir("dummy").Actions()
+	for _, name := range []string{"actions.yaml", "actions.json"} {
+		path := filepath.Join(c.MkDir(), name)
+		restore := setUpdate(true)
+		charmtesting.AssertGolden(c, actions, path)
+		restore()
+		charmtesting.AssertGolden(c, actions, path)
+	}
+}
+
+func (s *GoldenSuite) TestMatchGoldenMissingFile(c *gc.C) {
+	_, err := charmtesting.MatchGolden(map[string]int{"a": 1}, filepath.Join(c.MkDir(), "missing.yaml"))
+	c.Assert(err, gc.ErrorMatches, "open .*missing.yaml: no such file or directory")
+}
+
+func (s *GoldenSuite) TestMatchGoldenDiffContext(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "golden.yaml")
+	err := ioutil.WriteFile(path, []byte("a: 1\nb: 2\nc: 3\nd: 4\ne: 5\nf: 6\ng: 7\nh: 8\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	diff, err := charmtesting.MatchGolden(map[string]int{
+		"a": 0, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6, "g": 7, "h": 9,
+	}, path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(diff, gc.Equals, "-a: 1\n+a: 0\n b: 2\n c: 3\n...\n f: 6\n g: 7\n-h: 8\n+h: 9\n")
+}
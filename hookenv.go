@@ -0,0 +1,95 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/juju/charm.v4/hooks"
+)
+
+// HookVariable describes an environment variable
+// set when a hook is run.
+type HookVariable struct {
+	Name        string
+	Description string
+}
+
+// commonHookVariables holds the variables set for every hook.
+var commonHookVariables = []HookVariable{
+	{"CHARM_DIR", "The directory holding the charm (deprecated alias of JUJU_CHARM_DIR)."},
+	{"JUJU_AGENT_SOCKET", "The socket through which hook tools talk to the unit agent."},
+	{"JUJU_API_ADDRESSES", "The space-separated addresses of the Juju API servers."},
+	{"JUJU_AVAILABILITY_ZONE", "The availability zone of the unit's machine, if known."},
+	{"JUJU_CHARM_DIR", "The directory holding the charm."},
+	{"JUJU_CONTEXT_ID", "The identifier of the hook context, used by hook tools."},
+	{"JUJU_ENV_NAME", "The name of the environment."},
+	{"JUJU_ENV_UUID", "The UUID of the environment."},
+	{"JUJU_MACHINE_ID", "The id of the machine the unit is deployed to."},
+	{"JUJU_METER_INFO", "Information about the unit's meter status."},
+	{"JUJU_METER_STATUS", "The unit's meter status."},
+	{"JUJU_UNIT_NAME", "The name of the unit running the hook."},
+}
+
+// relationHookVariables holds the variables set for relation hooks.
+var relationHookVariables = []HookVariable{
+	{"JUJU_RELATION", "The name of the relation."},
+	{"JUJU_RELATION_ID", "The id of the relation."},
+}
+
+// remoteUnitHookVariables holds the variables set for relation hooks
+// triggered by a change to a remote unit.
+var remoteUnitHookVariables = []HookVariable{
+	{"JUJU_REMOTE_UNIT", "The name of the remote unit whose change triggered the hook."},
+}
+
+// actionHookVariables holds the variables set for actions.
+var actionHookVariables = []HookVariable{
+	{"JUJU_ACTION_NAME", "The name of the action."},
+	{"JUJU_ACTION_TAG", "The tag of the action."},
+	{"JUJU_ACTION_UUID", "The UUID of the action."},
+}
+
+// HookEnvironment returns the environment variables set when the hook
+// with the given name is run. The name is either the name of a unit
+// hook, such as "install", the name of a relation hook prefixed with
+// its relation, such as "db-relation-joined", or "action" for the
+// scripts run for actions.
+func HookEnvironment(hookName string) ([]HookVariable, error) {
+	kind, err := hookKind(hookName)
+	if err != nil {
+		return nil, err
+	}
+	vars := append([]HookVariable(nil), commonHookVariables...)
+	switch {
+	case kind == hooks.Action || kind == hooks.ActionRequested:
+		vars = append(vars, actionHookVariables...)
+	case kind.IsRelation():
+		vars = append(vars, relationHookVariables...)
+		if kind != hooks.RelationBroken {
+			vars = append(vars, remoteUnitHookVariables...)
+		}
+	}
+	return vars, nil
+}
+
+// hookKind returns the kind of the hook with the given name.
+func hookKind(hookName string) (hooks.Kind, error) {
+	switch kind := hooks.Kind(hookName); kind {
+	case hooks.Action, hooks.ActionRequested:
+		return kind, nil
+	}
+	for _, kind := range hooks.UnitHooks() {
+		if hookName == string(kind) {
+			return kind, nil
+		}
+	}
+	for _, kind := range hooks.RelationHooks() {
+		if strings.HasSuffix(hookName, "-"+string(kind)) && len(hookName) > len(kind)+1 {
+			return kind, nil
+		}
+	}
+	return "", fmt.Errorf("unknown hook %q", hookName)
+}
@@ -0,0 +1,84 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type HookEnvironmentSuite struct{}
+
+var _ = gc.Suite(&HookEnvironmentSuite{})
+
+var commonHookVariables = []string{
+	"CHARM_DIR",
+	"JUJU_AGENT_SOCKET",
+	"JUJU_API_ADDRESSES",
+	"JUJU_AVAILABILITY_ZONE",
+	"JUJU_CHARM_DIR",
+	"JUJU_CONTEXT_ID",
+	"JUJU_ENV_NAME",
+	"JUJU_ENV_UUID",
+	"JUJU_MACHINE_ID",
+	"JUJU_METER_INFO",
+	"JUJU_METER_STATUS",
+	"JUJU_UNIT_NAME",
+}
+
+var hookEnvironmentTests = []struct {
+	hook   string
+	expect []string
+	err    string
+}{{
+	hook:   "install",
+	expect: commonHookVariables,
+}, {
+	hook:   "collect-metrics",
+	expect: commonHookVariables,
+}, {
+	hook:   "db-relation-joined",
+	expect: append(commonHookVariables[:len(commonHookVariables):len(commonHookVariables)], "JUJU_RELATION", "JUJU_RELATION_ID", "JUJU_REMOTE_UNIT"),
+}, {
+	hook:   "db-relation-broken",
+	expect: append(commonHookVariables[:len(commonHookVariables):len(commonHookVariables)], "JUJU_RELATION", "JUJU_RELATION_ID"),
+}, {
+	hook:   "action",
+	expect: append(commonHookVariables[:len(commonHookVariables):len(commonHookVariables)], "JUJU_ACTION_NAME", "JUJU_ACTION_TAG", "JUJU_ACTION_UUID"),
+}, {
+	hook: "relation-joined",
+	err:  `unknown hook "relation-joined"`,
+}, {
+	hook: "frobnicate",
+	err:  `unknown hook "frobnicate"`,
+}}
+
+func (s *HookEnvironmentSuite) TestHookEnvironment(c *gc.C) {
+	for i, test := range hookEnvironmentTests {
+		c.Logf("test %d: %s", i, test.hook)
+		vars, err := charm.HookEnvironment(test.hook)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		var names []string
+		for _, v := range vars {
+			c.Assert(v.Description, gc.Not(gc.Equals), "")
+			names = append(names, v.Name)
+		}
+		c.Assert(names, jc.DeepEquals, test.expect)
+	}
+}
+
+func (s *HookEnvironmentSuite) TestHookEnvironmentNotShared(c *gc.C) {
+	vars, err := charm.HookEnvironment("install")
+	c.Assert(err, gc.IsNil)
+	vars[0].Name = "CHANGED"
+	vars, err = charm.HookEnvironment("install")
+	c.Assert(err, gc.IsNil)
+	c.Assert(vars[0].Name, gc.Equals, "CHARM_DIR")
+}
@@ -0,0 +1,167 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxLinkDepth holds the number of symbolic links
+// followed before a chain of links is abandoned.
+const maxLinkDepth = 16
+
+// LintHookLinks returns the problems found in the hooks of the given
+// charm, which must be a *CharmDir or a *CharmArchive, that are
+// symbolic links, and in its dispatch script if it is one. Charms
+// commonly link every hook to a single script, such as the dispatch
+// script or, in operator charms without one, src/charm.py; each link
+// should lead, possibly through other links, to an executable file
+// within the charm. It reports dangling links, links to directories
+// and links to files that are not executable. A charm directory is
+// checked as it would be archived, so the targets of the links of
+// hooks it declares are executable.
+func LintHookLinks(ch Charm) ([]string, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	files := zipFilesByName(zipr.File)
+	var problems []string
+	for _, fh := range zipr.File {
+		isHook := path.Dir(fh.Name) == HooksDir && !strings.HasSuffix(fh.Name, "/")
+		if !isHook && fh.Name != DispatchFile || fh.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := resolveZipLink(files, fh)
+		switch {
+		case err != nil:
+			problems = append(problems, err.Error())
+		case target.Mode().IsDir():
+			problems = append(problems, fmt.Sprintf("%q links to directory %q", fh.Name, strings.TrimSuffix(target.Name, "/")))
+		case target.Mode()&0100 == 0:
+			problems = append(problems, fmt.Sprintf("%q links to %q, which is not executable", fh.Name, target.Name))
+		}
+	}
+	return problems, nil
+}
+
+// zipFilesByName returns the given files keyed by their
+// names, without the trailing slash of directories.
+func zipFilesByName(files []*zip.File) map[string]*zip.File {
+	byName := make(map[string]*zip.File)
+	for _, fh := range files {
+		byName[strings.TrimSuffix(fh.Name, "/")] = fh
+	}
+	return byName
+}
+
+// resolveZipLink returns the file that the given file, one of the
+// given files of an archive, refers to, following any chain of
+// symbolic links. A file that is not a link refers to itself. It
+// returns an error if the chain ends at a file missing from the
+// archive or leads out of it.
+func resolveZipLink(files map[string]*zip.File, fh *zip.File) (*zip.File, error) {
+	name := fh.Name
+	for i := 0; fh.Mode()&os.ModeSymlink != 0; i++ {
+		if i == maxLinkDepth {
+			return nil, fmt.Errorf("%q: too many levels of symbolic links", name)
+		}
+		data, err := readZipFile(fh)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %q: %v", fh.Name, err)
+		}
+		target := string(data)
+		if err := checkSymlinkTarget("", fh.Name, target); err != nil {
+			return nil, err
+		}
+		p := path.Join(path.Dir(fh.Name), target)
+		next, ok := files[p]
+		if !ok {
+			return nil, fmt.Errorf("%q is a dangling link to %q", name, p)
+		}
+		fh = next
+	}
+	return fh, nil
+}
+
+// resolveCharmLink returns the slash-separated path, relative to the
+// root of the charm directory at root, of the file that the symbolic
+// link at path refers to, following any chain of links. It returns an
+// error if the link is dangling or refers to a file outside the charm.
+func resolveCharmLink(root, path string) (string, error) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("symlink %q links out of charm", path)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// hookLinkTargets returns the slash-separated paths, relative to the
+// root of the charm directory at root, of the regular files that the
+// hooks with the given names that are symbolic links refer to. Links
+// that are dangling or refer to files outside the charm are ignored.
+func hookLinkTargets(root string, hooks map[string]bool) (map[string]bool, error) {
+	targets := make(map[string]bool)
+	infos, err := ioutil.ReadDir(filepath.Join(root, HooksDir))
+	if os.IsNotExist(err) {
+		return targets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if info.Mode()&os.ModeSymlink == 0 || !hooks[info.Name()] {
+			continue
+		}
+		target, err := resolveCharmLink(root, filepath.Join(root, HooksDir, info.Name()))
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(target))); err == nil && info.Mode().IsRegular() {
+			targets[target] = true
+		}
+	}
+	return targets, nil
+}
+
+// fixLinkedExecutable makes sure that the regular file that the
+// symbolic link at path, within the charm directory at root, refers
+// to is owner-executable, reporting the given event if it is changed.
+// Links that are dangling or refer to files outside the charm are
+// left alone.
+func fixLinkedExecutable(root, path, event string) error {
+	target, err := resolveCharmLink(root, path)
+	if err != nil {
+		return nil
+	}
+	targetPath := filepath.Join(root, filepath.FromSlash(target))
+	info, err := os.Stat(targetPath)
+	if err != nil {
+		return err
+	}
+	mode := info.Mode()
+	if !mode.IsRegular() || mode&0100 != 0 {
+		return nil
+	}
+	logEvent("expand", event, target)
+	return os.Chmod(targetPath, mode|0100)
+}
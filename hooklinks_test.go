@@ -0,0 +1,198 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type HookLinksSuite struct{}
+
+var _ = gc.Suite(&HookLinksSuite{})
+
+// linkHooks replaces the given hooks of the charm
+// directory at dir with symbolic links to target.
+func linkHooks(c *gc.C, dir, target string, hooks ...string) {
+	for _, hook := range hooks {
+		path := filepath.Join(dir, "hooks", hook)
+		err := os.RemoveAll(path)
+		c.Assert(err, gc.IsNil)
+		err = os.Symlink(target, path)
+		c.Assert(err, gc.IsNil)
+	}
+}
+
+func (s *HookLinksSuite) TestArchiveRoundTrip(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	writeCharmFile(c, dir, "src/charm.py", "#!/usr/bin/env python3\n", 0644)
+	linkHooks(c, dir, "../src/charm.py", "install", "start", "config-changed")
+
+	archive := archiveDir(c, dir)
+	expanded := filepath.Join(c.MkDir(), "charm")
+	err := archive.ExpandTo(expanded)
+	c.Assert(err, gc.IsNil)
+	for _, hook := range []string{"install", "start", "config-changed"} {
+		target, err := os.Readlink(filepath.Join(expanded, "hooks", hook))
+		c.Assert(err, gc.IsNil)
+		c.Assert(target, gc.Equals, "../src/charm.py")
+	}
+	info, err := os.Stat(filepath.Join(expanded, "src", "charm.py"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&0100, gc.Not(gc.Equals), os.FileMode(0))
+
+	// The links survive archiving the expanded charm again.
+	again := filepath.Join(c.MkDir(), "charm")
+	err = archiveDir(c, expanded).ExpandTo(again)
+	c.Assert(err, gc.IsNil)
+	target, err := os.Readlink(filepath.Join(again, "hooks", "install"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(target, gc.Equals, "../src/charm.py")
+
+	problems, err := charm.LintHookLinks(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, gc.HasLen, 0)
+}
+
+func (s *HookLinksSuite) TestNormalizePermissions(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	_, err := dir.NormalizePermissions()
+	c.Assert(err, gc.IsNil)
+	writeCharmFile(c, dir.Path, "src/charm.py", "#!/usr/bin/env python3\n", 0644)
+	writeCharmFile(c, dir.Path, "src/lib.py", "", 0644)
+	linkHooks(c, dir.Path, "../src/charm.py", "install")
+	changes, err := dir.NormalizePermissions()
+	c.Assert(err, gc.IsNil)
+	c.Assert(changes, jc.DeepEquals, []charm.PermissionChange{{
+		Path: "src/charm.py",
+		Old:  0644,
+		New:  0755,
+	}})
+}
+
+// linkedHooksArchive returns an archive holding the
+// given files, keyed by name, in order of name.
+func linkedHooksArchive(c *gc.C, files map[string]zipEntry) *charm.CharmArchive {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	for _, name := range names {
+		entry := files[name]
+		h := &zip.FileHeader{Name: name}
+		h.SetMode(entry.mode)
+		w, err := zipw.CreateHeader(h)
+		c.Assert(err, gc.IsNil)
+		_, err = w.Write([]byte(entry.data))
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(zipw.Close(), gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	return archive
+}
+
+type zipEntry struct {
+	mode os.FileMode
+	data string
+}
+
+func (s *HookLinksSuite) TestExpandMakesTargetsExecutable(c *gc.C) {
+	archive := linkedHooksArchive(c, map[string]zipEntry{
+		"metadata.yaml":  {0644, verifyMeta},
+		"src/":           {os.ModeDir | 0755, ""},
+		"src/charm.py":   {0644, "#!/usr/bin/env python3\n"},
+		"src/helpers.py": {0644, ""},
+		"hooks/":         {os.ModeDir | 0755, ""},
+		"hooks/install":  {os.ModeSymlink | 0777, "../src/charm.py"},
+		"hooks/start":    {os.ModeSymlink | 0777, "install"},
+	})
+	dir := filepath.Join(c.MkDir(), "charm")
+	err := archive.ExpandTo(dir)
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(filepath.Join(dir, "src", "charm.py"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0744))
+	info, err = os.Stat(filepath.Join(dir, "src", "helpers.py"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0644))
+	info, err = os.Lstat(filepath.Join(dir, "hooks", "start"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&os.ModeSymlink, gc.Not(gc.Equals), os.FileMode(0))
+
+	problems, err := charm.LintHookLinks(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, []string{
+		`"hooks/install" links to "src/charm.py", which is not executable`,
+		`"hooks/start" links to "src/charm.py", which is not executable`,
+	})
+}
+
+func (s *HookLinksSuite) TestLintHookLinks(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	writeCharmFile(c, dir, "dispatch", "#!/bin/sh\n", 0755)
+	linkHooks(c, dir, "../dispatch", "install")
+	linkHooks(c, dir, "../src/missing.py", "start")
+	linkHooks(c, dir, "../src", "stop")
+	linkHooks(c, dir, "loop", "loop")
+	writeCharmFile(c, dir, "src/README", "", 0644)
+	linkHooks(c, dir, "../src/README", "upgrade-charm")
+
+	ch, err := charm.ReadCharmDir(dir)
+	c.Assert(err, gc.IsNil)
+	problems, err := charm.LintHookLinks(ch)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, []string{
+		`"hooks/loop": too many levels of symbolic links`,
+		`"hooks/start" is a dangling link to "src/missing.py"`,
+		`"hooks/stop" links to directory "src"`,
+	})
+
+	// The target of a link from a hook that is not
+	// declared is not made executable by archiving.
+	writeCharmFile(c, dir, "src/NOTES", "", 0644)
+	linkHooks(c, dir, "../src/NOTES", "not-a-hook")
+	problems, err = charm.LintHookLinks(ch)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, []string{
+		`"hooks/loop": too many levels of symbolic links`,
+		`"hooks/not-a-hook" links to "src/NOTES", which is not executable`,
+		`"hooks/start" is a dangling link to "src/missing.py"`,
+		`"hooks/stop" links to directory "src"`,
+	})
+}
+
+func (s *HookLinksSuite) TestCheckProbeScriptLinks(c *gc.C) {
+	meta := `
+name: probed
+summary: s
+description: d
+probes:
+  ready:
+    kind: readiness
+  alive:
+    kind: liveness
+`
+	archive := linkedHooksArchive(c, map[string]zipEntry{
+		"metadata.yaml":  {0644, meta},
+		"probes/check":   {0755, "#!/bin/sh\n"},
+		"probes/ready":   {os.ModeSymlink | 0777, "check"},
+		"probes/alive":   {os.ModeSymlink | 0777, "missing"},
+		"probes/unused/": {os.ModeDir | 0755, ""},
+	})
+	err := charm.CheckProbeScripts(archive)
+	c.Assert(err, gc.ErrorMatches, `probe "alive" script: "probes/alive" is a dangling link to "probes/missing"`)
+}
@@ -0,0 +1,197 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/juju/schema"
+)
+
+// HookPolicy describes the limits the author of a charm places on
+// running one of its hooks, as declared in the hooks field of its
+// metadata:
+//
+//	hooks:
+//	  install:
+//	    timeout: 30m
+//	  config-changed:
+//	    timeout: 5m
+//	    retry:
+//	      attempts: 3
+//	      delay: 10s
+//	      max-delay: 1m
+//
+// Durations are given as strings such as "5m" or as a number of
+// seconds. Zero values mean the agent's defaults apply.
+type HookPolicy struct {
+	// Timeout holds the time after which a run
+	// of the hook should be abandoned.
+	Timeout time.Duration `bson:",omitempty"`
+
+	// Retry holds how a failed hook should be retried.
+	Retry *RetryPolicy `bson:",omitempty"`
+}
+
+// RetryPolicy describes how a failed hook should be retried.
+type RetryPolicy struct {
+	// Attempts holds the maximum number of times the
+	// hook is run, including the first.
+	Attempts int
+
+	// Delay holds the time to wait before the first retry.
+	// Each later retry waits twice as long as the one
+	// before it.
+	Delay time.Duration
+
+	// MaxDelay holds the longest time to wait before a
+	// retry, or zero if the delay is not limited.
+	MaxDelay time.Duration `bson:",omitempty"`
+}
+
+// DelayBefore returns the time to wait before the given
+// attempt, numbered from 1, to run the hook.
+func (r RetryPolicy) DelayBefore(attempt int) time.Duration {
+	if attempt <= 1 {
+		return 0
+	}
+	d := r.Delay
+	for i := 2; i < attempt; i++ {
+		if r.MaxDelay > 0 && d >= r.MaxDelay || d > 1<<62 {
+			break
+		}
+		d *= 2
+	}
+	if r.MaxDelay > 0 && d > r.MaxDelay {
+		d = r.MaxDelay
+	}
+	return d
+}
+
+// HookPolicy returns the policy declared for the
+// named hook, or the zero policy if there is none.
+func (meta Meta) HookPolicy(hook string) HookPolicy {
+	return meta.HookPolicies[hook]
+}
+
+// checkHookPolicies checks that each of the policies in
+// the given metadata is valid and applies to one of the
+// charm's hooks.
+func checkHookPolicies(meta Meta) error {
+	if len(meta.HookPolicies) == 0 {
+		return nil
+	}
+	hooks := meta.Hooks()
+	for _, name := range sortedHookPolicies(meta.HookPolicies) {
+		policy := meta.HookPolicies[name]
+		if !hooks[name] {
+			return fmt.Errorf("policy for unknown hook %q", name)
+		}
+		if policy.Timeout < 0 {
+			return fmt.Errorf("hook %q has negative timeout", name)
+		}
+		if r := policy.Retry; r != nil {
+			switch {
+			case r.Attempts < 1:
+				return fmt.Errorf("hook %q retry has no attempts", name)
+			case r.Delay < 0 || r.MaxDelay < 0:
+				return fmt.Errorf("hook %q retry has negative delay", name)
+			case r.MaxDelay > 0 && r.MaxDelay < r.Delay:
+				return fmt.Errorf("hook %q retry has max-delay less than delay", name)
+			}
+		}
+	}
+	return nil
+}
+
+// sortedHookPolicies returns the names of the hooks
+// with the given policies in alphabetical order.
+func sortedHookPolicies(policies map[string]HookPolicy) []string {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// encodeHookPolicies returns the metadata.yaml
+// representation of the given hook policies.
+func encodeHookPolicies(policies map[string]HookPolicy) map[string]interface{} {
+	result := make(map[string]interface{})
+	for name, policy := range policies {
+		m := make(map[string]interface{})
+		if policy.Timeout != 0 {
+			m["timeout"] = policy.Timeout.String()
+		}
+		if r := policy.Retry; r != nil {
+			retry := map[string]interface{}{
+				"attempts": r.Attempts,
+			}
+			if r.Delay != 0 {
+				retry["delay"] = r.Delay.String()
+			}
+			if r.MaxDelay != 0 {
+				retry["max-delay"] = r.MaxDelay.String()
+			}
+			m["retry"] = retry
+		}
+		result[name] = m
+	}
+	return result
+}
+
+// hookPoliciesC coerces the hooks field of the metadata
+// into a map[string]HookPolicy keyed by hook name.
+type hookPoliciesC struct{}
+
+var (
+	retryPolicyC = schema.FieldMap(
+		schema.Fields{
+			"attempts":  schema.Int(),
+			"delay":     durationC{},
+			"max-delay": durationC{},
+		},
+		schema.Defaults{
+			"delay":     time.Duration(0),
+			"max-delay": time.Duration(0),
+		},
+	)
+	hookPolicyMapC = schema.StringMap(schema.FieldMap(
+		schema.Fields{
+			"timeout": durationC{},
+			"retry":   retryPolicyC,
+		},
+		schema.Defaults{
+			"timeout": time.Duration(0),
+			"retry":   schema.Omit,
+		},
+	))
+)
+
+func (hookPoliciesC) Coerce(v interface{}, path []string) (interface{}, error) {
+	m, err := hookPolicyMapC.Coerce(v, path)
+	if err != nil {
+		return nil, err
+	}
+	policies := make(map[string]HookPolicy)
+	for name, fields := range m.(map[string]interface{}) {
+		fields := fields.(map[string]interface{})
+		policy := HookPolicy{
+			Timeout: fields["timeout"].(time.Duration),
+		}
+		if retry, ok := fields["retry"]; ok {
+			retry := retry.(map[string]interface{})
+			policy.Retry = &RetryPolicy{
+				Attempts: int(retry["attempts"].(int64)),
+				Delay:    retry["delay"].(time.Duration),
+				MaxDelay: retry["max-delay"].(time.Duration),
+			}
+		}
+		policies[name] = policy
+	}
+	return policies, nil
+}
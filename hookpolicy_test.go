@@ -0,0 +1,123 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type HookPolicySuite struct{}
+
+var _ = gc.Suite(&HookPolicySuite{})
+
+const hookPolicyMeta = `
+name: policy
+summary: s
+description: d
+requires:
+  db: mysql
+hooks:
+  install:
+    timeout: 30m
+  config-changed:
+    timeout: 300
+    retry:
+      attempts: 3
+      delay: 10s
+      max-delay: 1m
+  db-relation-changed:
+    retry: {attempts: 2}
+`
+
+func (s *HookPolicySuite) TestReadHookPolicies(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(hookPolicyMeta))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.HookPolicies, jc.DeepEquals, map[string]charm.HookPolicy{
+		"install": {
+			Timeout: 30 * time.Minute,
+		},
+		"config-changed": {
+			Timeout: 5 * time.Minute,
+			Retry: &charm.RetryPolicy{
+				Attempts: 3,
+				Delay:    10 * time.Second,
+				MaxDelay: time.Minute,
+			},
+		},
+		"db-relation-changed": {
+			Retry: &charm.RetryPolicy{
+				Attempts: 2,
+			},
+		},
+	})
+	c.Assert(meta.HookPolicy("install").Timeout, gc.Equals, 30*time.Minute)
+	c.Assert(meta.HookPolicy("start"), gc.DeepEquals, charm.HookPolicy{})
+	c.Assert(meta.UnknownFields, gc.IsNil)
+}
+
+func (s *HookPolicySuite) TestHookPoliciesSaved(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(hookPolicyMeta))
+	c.Assert(err, gc.IsNil)
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	dir.SetMeta(meta)
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+	saved, err := charm.ReadCharmDir(dir.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(saved.Meta().HookPolicies, jc.DeepEquals, meta.HookPolicies)
+}
+
+var hookPolicyErrorTests = []struct {
+	hooks string
+	err   string
+}{{
+	hooks: "  frobnicate:\n    timeout: 5m\n",
+	err:   `charm "policy" has policy for unknown hook "frobnicate"`,
+}, {
+	hooks: "  install:\n    timeout: soon\n",
+	err:   `metadata: line .*: hooks.install.timeout: invalid duration "soon"`,
+}, {
+	hooks: "  install:\n    timeout: -5\n",
+	err:   `metadata: line .*: hooks.install.timeout: duration -5 is negative`,
+}, {
+	hooks: "  install:\n    retry: {attempts: 0}\n",
+	err:   `charm "policy" has hook "install" retry has no attempts`,
+}, {
+	hooks: "  install:\n    retry: {delay: 5s}\n",
+	err:   `metadata: line .*: hooks.install.retry.attempts: expected int, got nothing`,
+}, {
+	hooks: "  install:\n    retry: {attempts: 2, delay: 1m, max-delay: 5s}\n",
+	err:   `charm "policy" has hook "install" retry has max-delay less than delay`,
+}}
+
+func (s *HookPolicySuite) TestHookPolicyErrors(c *gc.C) {
+	for i, test := range hookPolicyErrorTests {
+		c.Logf("test %d: %q", i, test.hooks)
+		_, err := charm.ReadMeta(strings.NewReader("name: policy\nsummary: s\ndescription: d\nhooks:\n" + test.hooks))
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *HookPolicySuite) TestDelayBefore(c *gc.C) {
+	r := charm.RetryPolicy{
+		Attempts: 5,
+		Delay:    10 * time.Second,
+		MaxDelay: 30 * time.Second,
+	}
+	c.Assert(r.DelayBefore(1), gc.Equals, time.Duration(0))
+	c.Assert(r.DelayBefore(2), gc.Equals, 10*time.Second)
+	c.Assert(r.DelayBefore(3), gc.Equals, 20*time.Second)
+	c.Assert(r.DelayBefore(4), gc.Equals, 30*time.Second)
+	c.Assert(r.DelayBefore(100), gc.Equals, 30*time.Second)
+
+	r.MaxDelay = 0
+	c.Assert(r.DelayBefore(4), gc.Equals, 40*time.Second)
+}
@@ -0,0 +1,111 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"sort"
+	"strings"
+)
+
+// SearchDocument holds the fields of a charm indexed by search
+// backends, as returned by IndexDocument. All the lists are sorted,
+// hold no duplicates and are never nil, so that documents for
+// equivalent charms encode identically.
+type SearchDocument struct {
+	Name    string `json:"name"`
+	Summary string `json:"summary"`
+
+	// Description holds the charm's description
+	// as plain text, with Markdown formatting removed.
+	Description string `json:"description"`
+
+	// Tags holds the charm's tags or, if it has
+	// none, its categories.
+	Tags []string `json:"tags"`
+
+	// Provides and Requires hold the names of the
+	// interfaces provided and required by the charm.
+	Provides []string `json:"provides"`
+	Requires []string `json:"requires"`
+
+	// ConfigOptions holds the names of the
+	// charm's configuration options.
+	ConfigOptions []string `json:"config-options"`
+
+	// Actions holds the names of the charm's actions.
+	Actions []string `json:"actions"`
+
+	// Series holds the series the charm supports, from
+	// its series and bases.
+	Series []string `json:"series"`
+}
+
+// IndexDocument returns the document that search backends should
+// index for the given charm, so that all backends index the same
+// fields, flattened in the same way.
+func IndexDocument(ch Charm) *SearchDocument {
+	meta := ch.Meta()
+	tags := meta.Tags
+	if len(tags) == 0 {
+		tags = meta.Categories
+	}
+	doc := &SearchDocument{
+		Name:          meta.Name,
+		Summary:       meta.Summary,
+		Description:   strings.TrimSpace(MarkdownText(meta.Description, 0)),
+		Tags:          sortedSet(tags),
+		Provides:      relationInterfaces(meta.Provides),
+		Requires:      relationInterfaces(meta.Requires),
+		ConfigOptions: []string{},
+		Actions:       []string{},
+	}
+	if config := ch.Config(); config != nil {
+		for name := range config.Options {
+			doc.ConfigOptions = append(doc.ConfigOptions, name)
+		}
+		sort.Strings(doc.ConfigOptions)
+	}
+	if actions := ch.Actions(); actions != nil {
+		for name := range actions.ActionSpecs {
+			doc.Actions = append(doc.Actions, name)
+		}
+		sort.Strings(doc.Actions)
+	}
+	var series []string
+	if meta.Series != "" {
+		series = append(series, meta.Series)
+	}
+	for _, b := range meta.AllBases() {
+		if s := b.Series(); s != "" {
+			series = append(series, s)
+		}
+	}
+	doc.Series = sortedSet(series)
+	return doc
+}
+
+// relationInterfaces returns the interfaces
+// of the given relations.
+func relationInterfaces(relations map[string]Relation) []string {
+	var interfaces []string
+	for _, r := range relations {
+		interfaces = append(interfaces, r.Interface)
+	}
+	return sortedSet(interfaces)
+}
+
+// sortedSet returns the given strings sorted, with
+// duplicates removed. It never returns nil.
+func sortedSet(s []string) []string {
+	result := make([]string, 0, len(s))
+	seen := make(map[string]bool)
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
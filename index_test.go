@@ -0,0 +1,57 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"encoding/json"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type IndexSuite struct{}
+
+var _ = gc.Suite(&IndexSuite{})
+
+func (s *IndexSuite) TestIndexDocument(c *gc.C) {
+	ch := charmtesting.Charms.CharmDir("wordpress")
+	doc := charm.IndexDocument(ch)
+	c.Assert(doc, jc.DeepEquals, &charm.SearchDocument{
+		Name:          "wordpress",
+		Summary:       "Blog engine",
+		Description:   "A pretty popular blog engine",
+		Tags:          []string{},
+		Provides:      []string{"http", "logging", "monitoring"},
+		Requires:      []string{"mysql", "varnish"},
+		ConfigOptions: []string{"blog-title"},
+		Actions:       []string{},
+		Series:        []string{},
+	})
+}
+
+func (s *IndexSuite) TestIndexDocumentFlattensFields(c *gc.C) {
+	ch := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	meta := *ch.Meta()
+	meta.Description = "Some *emphasized* text\nand a [link](http://example.com)."
+	meta.Categories = []string{"misc", "database", "misc"}
+	meta.Series = "trusty"
+	meta.Bases = []charm.Base{
+		charm.MustParseBase("ubuntu@14.04/amd64"),
+		charm.MustParseBase("ubuntu@14.10"),
+		charm.MustParseBase("centos@7"),
+	}
+	ch.SetMeta(&meta)
+	doc := charm.IndexDocument(ch)
+	c.Assert(doc.Description, gc.Equals, "Some emphasized text and a link (http://example.com).")
+	c.Assert(doc.Tags, jc.DeepEquals, []string{"database", "misc"})
+	c.Assert(doc.Actions, jc.DeepEquals, []string{"snapshot"})
+	c.Assert(doc.Series, jc.DeepEquals, []string{"trusty", "utopic"})
+
+	data, err := json.Marshal(charm.IndexDocument(charmtesting.Charms.CharmDir("varnish")))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `{"name":"varnish","summary":"Database engine","description":"Another popular database","tags":[],"provides":["varnish"],"requires":[],"config-options":[],"actions":[],"series":[]}`)
+}
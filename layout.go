@@ -0,0 +1,164 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"path"
+	"strings"
+)
+
+// The following constants hold the paths, relative to the charm root,
+// of the files and directories with a meaning defined by the charm
+// format.
+const (
+	MetadataFile     = "metadata.yaml"
+	ConfigFile       = "config.yaml"
+	ActionsFile      = "actions.yaml"
+	MetricsFile      = "metrics.yaml"
+	RevisionFile     = "revision"
+	LXDProfileFile   = "lxd-profile.yaml"
+	DispatchFile     = "dispatch"
+	UpgradeNotesFile = "upgrade-notes.yaml"
+	OwnersFile       = "owners.yaml"
+	VersionFile      = "version"
+	TestsFile        = "tests/tests.yaml"
+	HooksDir         = "hooks"
+	ActionsDir       = "actions"
+	TestsDir         = "tests"
+	ProbesDir        = "probes"
+	TemplatesDir     = "templates"
+	FilesDir         = "files"
+)
+
+// LayoutEntry describes a well-known path within a charm.
+type LayoutEntry struct {
+	// Path holds the slash-separated path relative to the charm root.
+	Path string
+
+	// Dir specifies whether the path is a directory.
+	Dir bool
+
+	// Required specifies whether every charm must hold the path.
+	Required bool
+
+	// Internal specifies whether the path is maintained by this
+	// package rather than written by charm authors.
+	Internal bool
+
+	// Description holds a short description of the path.
+	Description string
+}
+
+// Layout describes the well-known paths within a charm, for the use of
+// tools that build or check charms. Every path it holds is reserved;
+// see IsReservedPath.
+var Layout = []LayoutEntry{{
+	Path:        MetadataFile,
+	Required:    true,
+	Description: "charm metadata",
+}, {
+	Path:        ConfigFile,
+	Description: "configuration options",
+}, {
+	Path:        ActionsFile,
+	Description: "action specifications",
+}, {
+	Path:        MetricsFile,
+	Description: "metrics collected from the charm",
+}, {
+	Path:        RevisionFile,
+	Description: "charm revision",
+}, {
+	Path:        LXDProfileFile,
+	Description: "LXD profile applied to containers running the charm",
+}, {
+	Path:        DispatchFile,
+	Description: "script run for every hook and action",
+}, {
+	Path:        UpgradeNotesFile,
+	Description: "notes to show before upgrading to a revision",
+}, {
+	Path:        OwnersFile,
+	Description: "maintainers of the charm and their signing keys",
+}, {
+	Path:        VersionFile,
+	Description: "version of the source the charm was built from",
+}, {
+	Path:        HooksDir,
+	Dir:         true,
+	Description: "hook executables",
+}, {
+	Path:        ActionsDir,
+	Dir:         true,
+	Description: "action executables",
+}, {
+	Path:        ProbesDir,
+	Dir:         true,
+	Description: "readiness and liveness probe scripts",
+}, {
+	Path:        TestsDir,
+	Dir:         true,
+	Description: "charm tests and their tests.yaml manifest",
+}, {
+	Path:        TemplatesDir,
+	Dir:         true,
+	Description: "templates rendered by hooks",
+}, {
+	Path:        FilesDir,
+	Dir:         true,
+	Description: "static files installed by hooks",
+}, {
+	Path:        revisionHistoryFile,
+	Internal:    true,
+	Description: "revision history",
+}, {
+	Path:        provenanceFile,
+	Internal:    true,
+	Description: "build provenance",
+}, {
+	Path:        annotationsFile,
+	Internal:    true,
+	Description: "archive annotations",
+}, {
+	Path:        digestStampFile,
+	Internal:    true,
+	Description: "digest of the archive an expanded charm came from",
+}, {
+	Path:        archManifestFile,
+	Internal:    true,
+	Description: "per-architecture file manifest",
+}}
+
+// HookPath returns the path, relative to the charm
+// root, of the executable for the named hook.
+func HookPath(name string) string {
+	return HooksDir + "/" + name
+}
+
+// ActionPath returns the path, relative to the charm
+// root, of the executable for the named action.
+func ActionPath(name string) string {
+	return ActionsDir + "/" + name
+}
+
+// ProbePath returns the path, relative to the charm
+// root, of the script for the named probe.
+func ProbePath(name string) string {
+	return ProbesDir + "/" + name
+}
+
+// IsReservedPath reports whether the given slash-separated path,
+// relative to the charm root, is one of the paths described by Layout
+// or lies within one of its directories. Builders and linters can use
+// it to avoid overwriting, or to treat specially, files with a meaning
+// defined by the charm format.
+func IsReservedPath(p string) bool {
+	p = path.Clean(p)
+	for _, e := range Layout {
+		if p == e.Path || e.Dir && strings.HasPrefix(p, e.Path+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type LayoutSuite struct{}
+
+var _ = gc.Suite(&LayoutSuite{})
+
+var isReservedPathTests = []struct {
+	path     string
+	reserved bool
+}{
+	{"metadata.yaml", true},
+	{"./config.yaml", true},
+	{"actions.yaml", true},
+	{"metrics.yaml", true},
+	{"revision", true},
+	{"lxd-profile.yaml", true},
+	{"upgrade-notes.yaml", true},
+	{"hooks", true},
+	{"hooks/install", true},
+	{"actions/snapshot", true},
+	{"probes/ready", true},
+	{"templates/nginx.conf", true},
+	{"files/logo.png", true},
+	{"annotations.yaml", true},
+	{"provenance.json", true},
+	{"revisions.yaml", true},
+	{".charm-digest", true},
+	{"README.md", false},
+	{"hooksfoo/install", false},
+	{"src/metadata.yaml", false},
+	{"hooks/../icon.svg", false},
+}
+
+func (s *LayoutSuite) TestIsReservedPath(c *gc.C) {
+	for i, test := range isReservedPathTests {
+		c.Logf("test %d: %s", i, test.path)
+		c.Assert(charm.IsReservedPath(test.path), gc.Equals, test.reserved)
+	}
+}
+
+func (s *LayoutSuite) TestLayoutPathsAreReserved(c *gc.C) {
+	required := 0
+	for _, e := range charm.Layout {
+		c.Assert(charm.IsReservedPath(e.Path), jc.IsTrue)
+		if e.Required {
+			required++
+		}
+	}
+	c.Assert(required, gc.Equals, 1)
+}
+
+func (s *LayoutSuite) TestPaths(c *gc.C) {
+	c.Assert(charm.HookPath("install"), gc.Equals, "hooks/install")
+	c.Assert(charm.ActionPath("snapshot"), gc.Equals, "actions/snapshot")
+	c.Assert(charm.ProbePath("ready"), gc.Equals, "probes/ready")
+}
@@ -0,0 +1,165 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// ReadLegacyMeta is like ReadMeta except that it also accepts metadata
+// written for older versions of juju, including those from the days
+// when juju was called ensemble, upgrading it to the current format.
+// It returns a warning describing each change made, so that very old
+// charms can be migrated without fixing them by hand.
+func ReadLegacyMeta(r io.Reader) (*Meta, []string, error) {
+	raw, err := readLegacyYAML(r, "metadata")
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings := upgradeLegacyMeta(raw)
+	data, err := yamlMarshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta, err := ReadMeta(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return meta, warnings, nil
+}
+
+// ReadLegacyConfig is like ReadConfig except that it also accepts
+// configuration written for older versions of juju, upgrading it to
+// the current format. It returns a warning describing each change
+// made.
+func ReadLegacyConfig(r io.Reader) (*Config, []string, error) {
+	raw, err := readLegacyYAML(r, "invalid config")
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings, err := upgradeLegacyConfig(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %v", err)
+	}
+	data, err := yamlMarshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := ReadConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, warnings, nil
+}
+
+// readLegacyYAML reads a YAML document holding a map. The
+// document is checked as readMeta checks current metadata, as
+// legacy charms are no more to be trusted than current ones.
+func readLegacyYAML(r io.Reader, context string) (map[interface{}]interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data, perr := normalizeYAML(data, false)
+	if perr != nil {
+		perr.context = context
+		return nil, perr
+	}
+	if perr := checkYAMLFeatures(data); perr != nil {
+		perr.context = context
+		return nil, perr
+	}
+	raw := make(map[interface{}]interface{})
+	if err := yamlUnmarshal(data, raw); err != nil {
+		return nil, yamlDecodeError(data, context, err)
+	}
+	if perr := checkYAMLExpansion(data, raw); perr != nil {
+		perr.context = context
+		return nil, perr
+	}
+	return raw, nil
+}
+
+// upgradeLegacyMeta upgrades legacy metadata held in raw
+// in place, returning a warning for each change made.
+func upgradeLegacyMeta(raw map[interface{}]interface{}) []string {
+	var warnings []string
+	if v, ok := raw["ensemble"]; ok {
+		// Ensemble-era charms were marked with "ensemble: formula".
+		delete(raw, "ensemble")
+		warnings = append(warnings, fmt.Sprintf("removed obsolete field \"ensemble\" (value %#v)", v))
+	}
+	if _, ok := raw["revision"]; ok {
+		warnings = append(warnings, `obsolete field "revision" should be replaced by a revision file`)
+	}
+	if categories, ok := raw["categories"]; ok {
+		delete(raw, "categories")
+		if _, ok := raw["tags"]; ok {
+			warnings = append(warnings, `removed field "categories", superseded by "tags"`)
+		} else {
+			raw["tags"] = categories
+			warnings = append(warnings, `renamed field "categories" to "tags"`)
+		}
+	}
+	return warnings
+}
+
+// legacyOptionTypes maps the option types accepted by
+// older versions of juju to their current names.
+var legacyOptionTypes = map[string]string{
+	"str":     "string",
+	"integer": "int",
+	"bool":    "boolean",
+	"number":  "float",
+}
+
+// upgradeLegacyConfig upgrades legacy configuration held in raw
+// in place, returning a warning for each change made.
+func upgradeLegacyConfig(raw map[interface{}]interface{}) ([]string, error) {
+	var warnings []string
+	if format, ok := raw["format"]; ok {
+		if format != 1 {
+			return nil, fmt.Errorf("unsupported format %#v", format)
+		}
+		delete(raw, "format")
+		warnings = append(warnings, `removed obsolete field "format"`)
+	}
+	if _, ok := raw["options"]; !ok && len(raw) > 0 {
+		// The first format held the options at the top level.
+		options := make(map[interface{}]interface{})
+		for name, option := range raw {
+			options[name] = option
+			delete(raw, name)
+		}
+		raw["options"] = options
+		warnings = append(warnings, `moved options under "options"`)
+	}
+	options, ok := raw["options"].(map[interface{}]interface{})
+	if !ok {
+		return warnings, nil
+	}
+	var names []string
+	for name := range options {
+		if name, ok := name.(string); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		option, ok := options[name].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		oldType, _ := option["type"].(string)
+		if newType, ok := legacyOptionTypes[oldType]; ok {
+			option["type"] = newType
+			warnings = append(warnings, fmt.Sprintf("option %q: converted type %q to %q", name, oldType, newType))
+		}
+	}
+	return warnings, nil
+}
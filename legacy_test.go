@@ -0,0 +1,113 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type LegacySuite struct{}
+
+var _ = gc.Suite(&LegacySuite{})
+
+func (s *LegacySuite) TestReadLegacyMeta(c *gc.C) {
+	meta, warnings, err := charm.ReadLegacyMeta(strings.NewReader(`
+ensemble: formula
+name: wordpress
+revision: 3
+summary: Blog engine.
+description: A blog engine.
+categories: [applications]
+requires:
+  db: mysql
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Name, gc.Equals, "wordpress")
+	c.Assert(meta.OldRevision, gc.Equals, 3)
+	c.Assert(meta.Tags, jc.DeepEquals, []string{"applications"})
+	c.Assert(meta.Categories, gc.IsNil)
+	c.Assert(meta.Requires["db"].Interface, gc.Equals, "mysql")
+	c.Assert(warnings, jc.DeepEquals, []string{
+		`removed obsolete field "ensemble" (value "formula")`,
+		`obsolete field "revision" should be replaced by a revision file`,
+		`renamed field "categories" to "tags"`,
+	})
+}
+
+func (s *LegacySuite) TestReadLegacyMetaCurrent(c *gc.C) {
+	meta, warnings, err := charm.ReadLegacyMeta(strings.NewReader(`
+name: wordpress
+summary: Blog engine.
+description: A blog engine.
+categories: [applications]
+tags: [blog]
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Tags, jc.DeepEquals, []string{"blog"})
+	c.Assert(warnings, jc.DeepEquals, []string{`removed field "categories", superseded by "tags"`})
+
+	_, _, err = charm.ReadLegacyMeta(strings.NewReader("ensemble: formula\nsummary: s\ndescription: d\n"))
+	c.Assert(err, gc.ErrorMatches, `metadata: .*name: expected string, got nothing`)
+}
+
+func (s *LegacySuite) TestReadLegacyConfig(c *gc.C) {
+	config, warnings, err := charm.ReadLegacyConfig(strings.NewReader(`
+format: 1
+title:
+  type: str
+  default: My Title
+port:
+  type: integer
+  default: 80
+debug:
+  type: bool
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(config.Options["title"].Type, gc.Equals, "string")
+	c.Assert(config.Options["port"].Type, gc.Equals, "int")
+	c.Assert(config.Options["port"].Default, gc.Equals, int64(80))
+	c.Assert(config.Options["debug"].Type, gc.Equals, "boolean")
+	c.Assert(warnings, jc.DeepEquals, []string{
+		`removed obsolete field "format"`,
+		`moved options under "options"`,
+		`option "debug": converted type "bool" to "boolean"`,
+		`option "port": converted type "integer" to "int"`,
+		`option "title": converted type "str" to "string"`,
+	})
+}
+
+func (s *LegacySuite) TestReadLegacyConfigCurrent(c *gc.C) {
+	config, warnings, err := charm.ReadLegacyConfig(strings.NewReader(`
+options:
+  title: {type: string, default: My Title}
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(config.Options["title"].Default, gc.Equals, "My Title")
+	c.Assert(warnings, gc.HasLen, 0)
+
+	_, _, err = charm.ReadLegacyConfig(strings.NewReader("format: 2\n"))
+	c.Assert(err, gc.ErrorMatches, `invalid config: unsupported format 2`)
+}
+
+func (s *LegacySuite) TestReadLegacyYAMLAliasesRejected(c *gc.C) {
+	_, _, err := charm.ReadLegacyMeta(strings.NewReader(`
+ensemble: formula
+name: &name foo
+summary: *name
+description: bar
+`))
+	c.Assert(err, gc.ErrorMatches, `metadata: line 3, column 7: YAML anchors are not allowed`)
+
+	_, _, err = charm.ReadLegacyConfig(strings.NewReader(`
+options:
+  title: {type: string, default: &t My Title}
+  subtitle: {type: string, default: *t}
+`))
+	c.Assert(err, gc.ErrorMatches, `invalid config: line 3, column 34: YAML anchors are not allowed`)
+}
@@ -0,0 +1,170 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Descriptions in metadata.yaml, config.yaml and actions.yaml may be
+// given either as a single string or as a map from language tags,
+// such as "en", "de" or "pt-BR", to translations of the description:
+//
+//     description:
+//       en: Blog engine.
+//       de: Blog-Software.
+//
+// In the latter case the Description field holds the English text,
+// or the text in the first language in sorted order if there is no
+// English text, so that clients unaware of translations still see
+// a description, and the Descriptions field holds the whole map.
+
+// defaultLanguage is the language used when no translation
+// exists for the requested language.
+const defaultLanguage = "en"
+
+var validLanguageTag = regexp.MustCompile(`^[a-zA-Z]{2,8}(?:[-_][a-zA-Z0-9]{1,8})*$`)
+
+// parseDescription returns the default text and the translations
+// of a description value as decoded from YAML. The translations are
+// nil if the description is a plain string.
+func parseDescription(v interface{}) (string, map[string]string, error) {
+	var texts map[string]string
+	switch v := v.(type) {
+	case nil:
+		return "", nil, nil
+	case string:
+		return v, nil, nil
+	case map[string]interface{}:
+		texts = make(map[string]string)
+		for lang, text := range v {
+			s, ok := text.(string)
+			if !ok {
+				return "", nil, fmt.Errorf("description in %q: expected string, got %T", lang, text)
+			}
+			texts[lang] = s
+		}
+	case map[interface{}]interface{}:
+		texts = make(map[string]string)
+		for lang, text := range v {
+			langStr, ok := lang.(string)
+			if !ok {
+				return "", nil, fmt.Errorf("expected language tag, got %#v", lang)
+			}
+			s, ok := text.(string)
+			if !ok {
+				return "", nil, fmt.Errorf("description in %q: expected string, got %T", langStr, text)
+			}
+			texts[langStr] = s
+		}
+	default:
+		return "", nil, fmt.Errorf("expected string or map, got %T", v)
+	}
+	return defaultDescription(texts), texts, nil
+}
+
+// checkDescriptions returns an error if any of the given
+// translations is keyed by an invalid language tag.
+func checkDescriptions(texts map[string]string) error {
+	for lang := range texts {
+		if !validLanguageTag.MatchString(lang) {
+			return fmt.Errorf("invalid language tag %q", lang)
+		}
+	}
+	return nil
+}
+
+// defaultDescription returns the text that should be used as
+// the description given the translations.
+func defaultDescription(texts map[string]string) string {
+	if text, ok := translation(texts, defaultLanguage); ok {
+		return text
+	}
+	langs := make([]string, 0, len(texts))
+	for lang := range texts {
+		langs = append(langs, lang)
+	}
+	if len(langs) == 0 {
+		return ""
+	}
+	sort.Strings(langs)
+	return texts[langs[0]]
+}
+
+// encodeDescription returns the YAML representation of
+// a description with the given default text and translations.
+func encodeDescription(description string, texts map[string]string) interface{} {
+	if len(texts) == 0 {
+		return description
+	}
+	result := make(map[string]string)
+	for lang, text := range texts {
+		result[lang] = text
+	}
+	if description != defaultDescription(texts) {
+		// The default text has been changed independently
+		// of the translations; record it as English.
+		result[defaultLanguage] = description
+	}
+	return result
+}
+
+// localize returns the translation of a description into the
+// given language, falling back to English and then to the
+// default text.
+func localize(description string, texts map[string]string, lang string) string {
+	if text, ok := translation(texts, lang); ok {
+		return text
+	}
+	if text, ok := translation(texts, defaultLanguage); ok {
+		return text
+	}
+	return description
+}
+
+// translation returns the translation for the given language. Tags
+// are compared without regard to case or to whether "-" or "_"
+// separates their subtags. If there is no translation for the tag
+// as given, its subtags are removed one by one from the end until
+// one is found, so that "pt-BR" falls back to "pt". Failing that,
+// any translation in the same base language is used, so that "pt"
+// may be satisfied by "pt-BR".
+func translation(texts map[string]string, lang string) (string, bool) {
+	if len(texts) == 0 || lang == "" {
+		return "", false
+	}
+	byTag := make(map[string]string)
+	for tag, text := range texts {
+		byTag[normalizeLanguageTag(tag)] = text
+	}
+	tag := normalizeLanguageTag(lang)
+	for {
+		if text, ok := byTag[tag]; ok {
+			return text, true
+		}
+		i := strings.LastIndex(tag, "-")
+		if i < 0 {
+			break
+		}
+		tag = tag[:i]
+	}
+	var matches []string
+	for t := range byTag {
+		if strings.HasPrefix(t, tag+"-") {
+			matches = append(matches, t)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	sort.Strings(matches)
+	return byTag[matches[0]], true
+}
+
+func normalizeLanguageTag(tag string) string {
+	return strings.ToLower(strings.Replace(tag, "_", "-", -1))
+}
@@ -0,0 +1,181 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type LocalizeSuite struct{}
+
+var _ = gc.Suite(&LocalizeSuite{})
+
+func (s *LocalizeSuite) TestReadMetaLocalizedDescription(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(`
+name: wordpress
+summary: Blog engine.
+description:
+  de: Eine Blog-Software.
+  en: A blog engine.
+  pt-BR: Um motor de blog.
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Description, gc.Equals, "A blog engine.")
+	c.Assert(meta.Descriptions, gc.DeepEquals, map[string]string{
+		"de":    "Eine Blog-Software.",
+		"en":    "A blog engine.",
+		"pt-BR": "Um motor de blog.",
+	})
+}
+
+func (s *LocalizeSuite) TestReadMetaLocalizedDescriptionWithoutEnglish(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(`
+name: wordpress
+summary: Blog engine.
+description: {fr: Un moteur de blog., de: Eine Blog-Software.}
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Description, gc.Equals, "Eine Blog-Software.")
+}
+
+func (s *LocalizeSuite) TestReadMetaInvalidLanguageTag(c *gc.C) {
+	_, err := charm.ReadMeta(strings.NewReader(`
+name: wordpress
+summary: Blog engine.
+description: {en: A blog engine., "not a tag": Something.}
+`))
+	c.Assert(err, gc.ErrorMatches, `charm "wordpress" has invalid description: invalid language tag "not a tag"`)
+}
+
+var descriptionInTests = []struct {
+	lang   string
+	expect string
+}{{
+	lang:   "de",
+	expect: "Eine Blog-Software.",
+}, {
+	lang:   "de-AT",
+	expect: "Eine Blog-Software.",
+}, {
+	lang:   "pt_br",
+	expect: "Um motor de blog.",
+}, {
+	lang:   "pt",
+	expect: "Um motor de blog.",
+}, {
+	lang:   "fr",
+	expect: "A blog engine.",
+}, {
+	lang:   "",
+	expect: "A blog engine.",
+}}
+
+func (s *LocalizeSuite) TestDescriptionIn(c *gc.C) {
+	meta := charm.Meta{
+		Description: "A blog engine.",
+		Descriptions: map[string]string{
+			"de":    "Eine Blog-Software.",
+			"en-US": "A blog engine.",
+			"pt-BR": "Um motor de blog.",
+		},
+	}
+	for i, test := range descriptionInTests {
+		c.Logf("test %d: %q", i, test.lang)
+		c.Assert(meta.DescriptionIn(test.lang), gc.Equals, test.expect)
+	}
+}
+
+func (s *LocalizeSuite) TestDescriptionInWithoutTranslations(c *gc.C) {
+	meta := charm.Meta{Description: "A blog engine."}
+	c.Assert(meta.DescriptionIn("de"), gc.Equals, "A blog engine.")
+}
+
+func (s *LocalizeSuite) TestReadConfigLocalizedDescription(c *gc.C) {
+	config, err := charm.ReadConfig(bytes.NewBufferString(`
+options:
+  title:
+    type: string
+    description:
+      en: The blog title.
+      de: Der Titel des Blogs.
+  tagline:
+    type: string
+    description: The blog tagline.
+`))
+	c.Assert(err, gc.IsNil)
+	title := config.Options["title"]
+	c.Assert(title.Description, gc.Equals, "The blog title.")
+	c.Assert(title.DescriptionIn("de"), gc.Equals, "Der Titel des Blogs.")
+	c.Assert(title.DescriptionIn("fr"), gc.Equals, "The blog title.")
+	tagline := config.Options["tagline"]
+	c.Assert(tagline.Description, gc.Equals, "The blog tagline.")
+	c.Assert(tagline.Descriptions, gc.IsNil)
+}
+
+func (s *LocalizeSuite) TestReadConfigInvalidDescription(c *gc.C) {
+	_, err := charm.ReadConfig(bytes.NewBufferString(`
+options:
+  title:
+    type: string
+    description:
+      en: [The, blog, title.]
+`))
+	c.Assert(err, gc.ErrorMatches, `invalid config: line 5, column 5: option "title" has invalid description: description in "en": expected string, got .*`)
+}
+
+func (s *LocalizeSuite) TestReadActionsLocalizedDescription(c *gc.C) {
+	actions, err := charm.ReadActionsYaml(bytes.NewBufferString(`
+actions:
+  snapshot:
+    description:
+      en: Take a snapshot of the database.
+      de: Einen Schnappschuss der Datenbank erstellen.
+`))
+	c.Assert(err, gc.IsNil)
+	spec := actions.ActionSpecs["snapshot"]
+	c.Assert(spec.Description, gc.Equals, "Take a snapshot of the database.")
+	c.Assert(spec.DescriptionIn("de"), gc.Equals, "Einen Schnappschuss der Datenbank erstellen.")
+}
+
+func (s *LocalizeSuite) TestSaveLocalizedDescriptions(c *gc.C) {
+	charmDir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	meta := *dir.Meta()
+	meta.Description = "A dummy charm."
+	meta.Descriptions = map[string]string{
+		"en": "A dummy charm.",
+		"de": "Ein Dummy-Charm.",
+	}
+	dir.SetMeta(&meta)
+	config := charm.NewConfig()
+	config.Options["title"] = charm.Option{
+		Type:        "string",
+		Description: "The title.",
+		Descriptions: map[string]string{
+			"de": "Der Titel.",
+		},
+		Default: "",
+	}
+	dir.SetConfig(config)
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+
+	dir, err = charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Meta().Description, gc.Equals, "A dummy charm.")
+	c.Assert(dir.Meta().DescriptionIn("de"), gc.Equals, "Ein Dummy-Charm.")
+	title := dir.Config().Options["title"]
+	c.Assert(title.Description, gc.Equals, "The title.")
+	c.Assert(title.Descriptions, gc.DeepEquals, map[string]string{
+		"en": "The title.",
+		"de": "Der Titel.",
+	})
+}
@@ -0,0 +1,419 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Kinds of dependency recorded in a Lockfile.
+const (
+	// DependencyInterface is the kind of the relation
+	// interfaces used by a charm.
+	DependencyInterface = "interface"
+
+	// DependencyPython is the kind of the Python
+	// packages bundled in a charm.
+	DependencyPython = "python"
+)
+
+// Lockfile records the exact contents of a charm, as returned by
+// Freeze, so that a charm can later be checked, with VerifyLock, to be
+// bit-for-bit the one that was frozen; for example, so that the charm
+// promoted to a stable channel is known to be the one that passed QA.
+//
+// The revision of the charm, its revision history, annotations
+// and provenance record are not recorded, as they may be
+// changed without changing the charm.
+type Lockfile struct {
+	// Name holds the name of the charm.
+	Name string
+
+	// Metadata holds the digest of the canonical
+	// encoding of the charm's metadata; see
+	// Meta.CanonicalBytes.
+	Metadata Digest
+
+	// Files holds the charm's files, sorted by path.
+	Files []LockedFile
+
+	// Dependencies holds the charm's dependencies,
+	// sorted by kind, name and version.
+	Dependencies []LockedDependency
+}
+
+// LockedFile records a file in a frozen charm.
+type LockedFile struct {
+	// Path holds the slash-separated path of the file
+	// relative to the root of the charm.
+	Path string
+
+	// Mode holds the permission bits of the file, along
+	// with os.ModeSymlink if it is a symbolic link.
+	Mode os.FileMode
+
+	// Digest holds the digest of the file's contents. The
+	// contents of a symbolic link are its target.
+	Digest Digest
+}
+
+// LockedDependency records a dependency of a frozen charm.
+type LockedDependency struct {
+	// Kind holds the kind of the dependency, such
+	// as DependencyInterface.
+	Kind string
+
+	// Name and Version hold the name and version of the
+	// dependency. The version may be empty.
+	Name    string
+	Version string
+}
+
+// Freeze returns a lockfile recording the contents of the given
+// charm, which must be a *CharmDir or a *CharmArchive: the digest of
+// every file and of its metadata, and the relation interfaces and
+// bundled Python packages it depends on.
+func Freeze(ch Charm) (*Lockfile, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, fmt.Errorf("cannot freeze charm: %v", err)
+	}
+	defer zipr.Close()
+	lock, err := freeze(ch, zipr.File)
+	if err != nil {
+		return nil, fmt.Errorf("cannot freeze charm: %v", err)
+	}
+	return lock, nil
+}
+
+// freeze returns a lockfile recording the given charm,
+// holding the given files.
+func freeze(ch Charm, files []*zip.File) (*Lockfile, error) {
+	metadata, err := metadataDigest(ch.Meta())
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lockfile{
+		Name:     ch.Meta().Name,
+		Metadata: metadata,
+	}
+	for _, fh := range files {
+		if excludedFromDigest(fh.Name) {
+			continue
+		}
+		f, err := lockedFile(fh, SHA256)
+		if err != nil {
+			return nil, err
+		}
+		lock.Files = append(lock.Files, f)
+	}
+	sort.Sort(lockedFilesByPath(lock.Files))
+	lock.Dependencies, err = charmDependencies(ch)
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// metadataDigest returns the SHA256 digest of the
+// canonical encoding of the given metadata.
+func metadataDigest(meta *Meta) (Digest, error) {
+	data, err := meta.CanonicalBytes()
+	if err != nil {
+		return Digest{}, err
+	}
+	return NewDigest(SHA256, bytes.NewReader(data))
+}
+
+// lockedFile returns the record of the given archive member,
+// with its digest made with the given algorithm.
+func lockedFile(fh *zip.File, alg DigestAlgorithm) (LockedFile, error) {
+	r, err := fh.Open()
+	if err != nil {
+		return LockedFile{}, err
+	}
+	defer r.Close()
+	digest, err := NewDigest(alg, r)
+	if err != nil {
+		return LockedFile{}, fmt.Errorf("cannot read %q: %v", fh.Name, err)
+	}
+	return LockedFile{
+		Path:   fh.Name,
+		Mode:   fh.Mode() & (os.ModeSymlink | os.ModePerm),
+		Digest: digest,
+	}, nil
+}
+
+// charmDependencies returns the relation interfaces
+// and Python packages the given charm depends on.
+func charmDependencies(ch Charm) ([]LockedDependency, error) {
+	seen := make(map[LockedDependency]bool)
+	var deps []LockedDependency
+	add := func(dep LockedDependency) {
+		if !seen[dep] {
+			seen[dep] = true
+			deps = append(deps, dep)
+		}
+	}
+	meta := ch.Meta()
+	for _, rels := range []map[string]Relation{meta.Provides, meta.Requires, meta.Peers} {
+		for _, rel := range rels {
+			iface := rel.ParsedInterface()
+			dep := LockedDependency{
+				Kind: DependencyInterface,
+				Name: iface.Name,
+			}
+			if iface.Version != 0 {
+				dep.Version = strconv.Itoa(iface.Version)
+			}
+			add(dep)
+		}
+	}
+	pydeps, err := PythonDependencies(ch)
+	if err != nil {
+		return nil, err
+	}
+	for _, pydep := range pydeps {
+		add(LockedDependency{
+			Kind:    DependencyPython,
+			Name:    pydep.Name,
+			Version: pydep.Version,
+		})
+	}
+	sort.Sort(lockedDependencies(deps))
+	return deps, nil
+}
+
+// VerifyLock checks that the given charm, which must be a *CharmDir
+// or a *CharmArchive, is the one recorded in the given lockfile.
+// File digests are made with the algorithms recorded in the lockfile.
+// If the charm differs, VerifyLock returns a *VerificationError
+// holding an error for each difference, each a *MemberError if it
+// concerns a single file.
+func VerifyLock(ch Charm, lock *Lockfile) error {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return fmt.Errorf("cannot verify lock: %v", err)
+	}
+	defer zipr.Close()
+	var errs []error
+	if ch.Meta().Name != lock.Name {
+		errs = append(errs, fmt.Errorf("charm name %q does not match locked name %q", ch.Meta().Name, lock.Name))
+	}
+	metadata, err := metadataDigest(ch.Meta())
+	if err != nil {
+		return fmt.Errorf("cannot verify lock: %v", err)
+	}
+	if !metadata.Equal(lock.Metadata) {
+		errs = append(errs, fmt.Errorf("metadata does not match lock"))
+	}
+	locked := make(map[string]LockedFile)
+	for _, f := range lock.Files {
+		locked[f.Path] = f
+	}
+	for _, fh := range zipr.File {
+		if excludedFromDigest(fh.Name) {
+			continue
+		}
+		want, ok := locked[fh.Name]
+		if !ok {
+			errs = append(errs, &MemberError{fh.Name, fmt.Errorf("file is not locked")})
+			continue
+		}
+		delete(locked, fh.Name)
+		got, err := lockedFile(fh, want.Digest.Algorithm)
+		if err != nil {
+			return fmt.Errorf("cannot verify lock: %v", err)
+		}
+		switch {
+		case !got.Digest.Equal(want.Digest):
+			errs = append(errs, &MemberError{fh.Name, fmt.Errorf("contents do not match lock")})
+		case got.Mode != want.Mode:
+			errs = append(errs, &MemberError{fh.Name, fmt.Errorf("mode %v does not match locked mode %v", got.Mode, want.Mode)})
+		}
+	}
+	var missing []string
+	for path := range locked {
+		missing = append(missing, path)
+	}
+	sort.Strings(missing)
+	for _, path := range missing {
+		errs = append(errs, &MemberError{path, fmt.Errorf("locked file is missing")})
+	}
+	deps, err := charmDependencies(ch)
+	if err != nil {
+		return fmt.Errorf("cannot verify lock: %v", err)
+	}
+	errs = append(errs, checkLockedDependencies(lock.Dependencies, deps)...)
+	if len(errs) > 0 {
+		return &VerificationError{errs}
+	}
+	return nil
+}
+
+// checkLockedDependencies returns an error for each
+// difference between the locked and found dependencies.
+func checkLockedDependencies(locked, found []LockedDependency) []error {
+	want := make(map[LockedDependency]bool)
+	for _, dep := range locked {
+		want[dep] = true
+	}
+	var errs []error
+	for _, dep := range found {
+		if !want[dep] {
+			errs = append(errs, fmt.Errorf("%s dependency %q is not locked", dep.Kind, dep))
+		}
+		delete(want, dep)
+	}
+	for _, dep := range locked {
+		if want[dep] {
+			errs = append(errs, fmt.Errorf("locked %s dependency %q is missing", dep.Kind, dep))
+		}
+	}
+	return errs
+}
+
+// String returns the name of the dependency, followed
+// by its version, if any, in the form "name@version".
+func (dep LockedDependency) String() string {
+	if dep.Version == "" {
+		return dep.Name
+	}
+	return dep.Name + "@" + dep.Version
+}
+
+type lockfileDoc struct {
+	Name         string                `yaml:"name"`
+	Metadata     Digest                `yaml:"metadata"`
+	Files        []lockedFileDoc       `yaml:"files,omitempty"`
+	Dependencies []lockedDependencyDoc `yaml:"dependencies,omitempty"`
+}
+
+type lockedFileDoc struct {
+	Path    string `yaml:"path"`
+	Mode    string `yaml:"mode"`
+	Digest  Digest `yaml:"digest"`
+	Symlink bool   `yaml:"symlink,omitempty"`
+}
+
+type lockedDependencyDoc struct {
+	Kind    string `yaml:"kind"`
+	Name    string `yaml:"name"`
+	Version string `yaml:"version,omitempty"`
+}
+
+// Write writes the lockfile to w in YAML format:
+//
+//	name: mysql
+//	metadata: sha256:4b1d...
+//	files:
+//	- path: hooks/install
+//	  mode: "0755"
+//	  digest: sha256:9f86...
+//	dependencies:
+//	- kind: interface
+//	  name: mysql
+func (lock *Lockfile) Write(w io.Writer) error {
+	doc := lockfileDoc{
+		Name:     lock.Name,
+		Metadata: lock.Metadata,
+	}
+	for _, f := range lock.Files {
+		doc.Files = append(doc.Files, lockedFileDoc{
+			Path:    f.Path,
+			Mode:    fmt.Sprintf("%04o", f.Mode.Perm()),
+			Digest:  f.Digest,
+			Symlink: f.Mode&os.ModeSymlink != 0,
+		})
+	}
+	for _, dep := range lock.Dependencies {
+		doc.Dependencies = append(doc.Dependencies, lockedDependencyDoc{
+			Kind:    dep.Kind,
+			Name:    dep.Name,
+			Version: dep.Version,
+		})
+	}
+	data, err := yamlMarshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadLockfile reads a lockfile in the format written
+// by Lockfile.Write.
+func ReadLockfile(r io.Reader) (*Lockfile, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc lockfileDoc
+	if err := yamlUnmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid lockfile: %v", err)
+	}
+	if doc.Name == "" {
+		return nil, fmt.Errorf("invalid lockfile: no charm name")
+	}
+	if doc.Metadata.IsZero() {
+		return nil, fmt.Errorf("invalid lockfile: no metadata digest")
+	}
+	lock := &Lockfile{
+		Name:     doc.Name,
+		Metadata: doc.Metadata,
+	}
+	for _, f := range doc.Files {
+		mode, err := strconv.ParseUint(f.Mode, 8, 32)
+		if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+			return nil, fmt.Errorf("invalid lockfile: file %q has invalid mode %q", f.Path, f.Mode)
+		}
+		if f.Digest.IsZero() {
+			return nil, fmt.Errorf("invalid lockfile: file %q has no digest", f.Path)
+		}
+		locked := LockedFile{
+			Path:   f.Path,
+			Mode:   os.FileMode(mode),
+			Digest: f.Digest,
+		}
+		if f.Symlink {
+			locked.Mode |= os.ModeSymlink
+		}
+		lock.Files = append(lock.Files, locked)
+	}
+	for _, dep := range doc.Dependencies {
+		lock.Dependencies = append(lock.Dependencies, LockedDependency{
+			Kind:    dep.Kind,
+			Name:    dep.Name,
+			Version: dep.Version,
+		})
+	}
+	return lock, nil
+}
+
+type lockedFilesByPath []LockedFile
+
+func (f lockedFilesByPath) Len() int           { return len(f) }
+func (f lockedFilesByPath) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f lockedFilesByPath) Less(i, j int) bool { return f[i].Path < f[j].Path }
+
+type lockedDependencies []LockedDependency
+
+func (d lockedDependencies) Len() int      { return len(d) }
+func (d lockedDependencies) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d lockedDependencies) Less(i, j int) bool {
+	switch {
+	case d[i].Kind != d[j].Kind:
+		return d[i].Kind < d[j].Kind
+	case d[i].Name != d[j].Name:
+		return d[i].Name < d[j].Name
+	}
+	return d[i].Version < d[j].Version
+}
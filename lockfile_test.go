@@ -0,0 +1,148 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type LockfileSuite struct{}
+
+var _ = gc.Suite(&LockfileSuite{})
+
+func (s *LockfileSuite) TestFreeze(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "wordpress")
+	writeCharmFile(c, dir.Path, "hooks/install", "#!/bin/sh\n", 0755)
+	writeCharmFile(c, dir.Path, "wheelhouse/six-1.9.0-py2.py3-none-any.whl", "wheel", 0644)
+	lock, err := charm.Freeze(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(lock.Name, gc.Equals, "wordpress")
+	c.Assert(lock.Metadata.Algorithm, gc.Equals, charm.SHA256)
+	c.Assert(lock.Dependencies, jc.DeepEquals, []charm.LockedDependency{
+		{charm.DependencyInterface, "http", ""},
+		{charm.DependencyInterface, "logging", ""},
+		{charm.DependencyInterface, "monitoring", ""},
+		{charm.DependencyInterface, "mysql", ""},
+		{charm.DependencyInterface, "varnish", ""},
+		{charm.DependencyPython, "six", "1.9.0"},
+	})
+	var paths []string
+	for _, f := range lock.Files {
+		paths = append(paths, f.Path)
+		if f.Path == "hooks/install" {
+			c.Assert(f.Mode, gc.Equals, os.FileMode(0755))
+		}
+	}
+	c.Assert(paths, jc.DeepEquals, []string{
+		"actions/.gitkeep",
+		"config.yaml",
+		"hooks/.gitkeep",
+		"hooks/install",
+		"metadata.yaml",
+		"wheelhouse/six-1.9.0-py2.py3-none-any.whl",
+	})
+
+	// The archive of a charm matches the lock of its directory,
+	// whatever its revision.
+	dir.SetRevision(99)
+	var buf bytes.Buffer
+	err = dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	err = charm.VerifyLock(archive, lock)
+	c.Assert(err, gc.IsNil)
+	archiveLock, err := charm.Freeze(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archiveLock, jc.DeepEquals, lock)
+}
+
+func (s *LockfileSuite) TestVerifyLockMismatch(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "wordpress")
+	lock, err := charm.Freeze(dir)
+	c.Assert(err, gc.IsNil)
+
+	writeCharmFile(c, dir.Path, "config.yaml", "options: {}\n", 0644)
+	writeCharmFile(c, dir.Path, "lib/extra", "", 0644)
+	writeCharmFile(c, dir.Path, "wheelhouse/six-1.9.0.tar.gz", "", 0644)
+	err = os.Chmod(filepath.Join(dir.Path, "metadata.yaml"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = os.Remove(filepath.Join(dir.Path, "actions", ".gitkeep"))
+	c.Assert(err, gc.IsNil)
+	err = charm.VerifyLock(dir, lock)
+	c.Assert(err, gc.FitsTypeOf, &charm.VerificationError{})
+	var problems []string
+	for _, err := range err.(*charm.VerificationError).Errors {
+		problems = append(problems, err.Error())
+	}
+	c.Assert(problems, jc.DeepEquals, []string{
+		"config.yaml: contents do not match lock",
+		"lib/extra: file is not locked",
+		"metadata.yaml: mode -rwxr-xr-x does not match locked mode -rw-r--r--",
+		"wheelhouse/six-1.9.0.tar.gz: file is not locked",
+		"actions/.gitkeep: locked file is missing",
+		`python dependency "six@1.9.0" is not locked`,
+	})
+
+	other := charmtesting.Charms.CharmDir("mysql")
+	err = charm.VerifyLock(other, lock)
+	c.Assert(err, gc.ErrorMatches, `charm name "mysql" does not match locked name "wordpress" \(and [0-9]+ more errors\)`)
+	c.Assert(err.(*charm.VerificationError).Errors[1], gc.ErrorMatches, "metadata does not match lock")
+}
+
+func (s *LockfileSuite) TestWriteReadLockfile(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "wordpress")
+	writeCharmFile(c, dir.Path, "hooks/install", "#!/bin/sh\n", 0755)
+	err := os.Symlink("install", filepath.Join(dir.Path, "hooks", "start"))
+	c.Assert(err, gc.IsNil)
+	lock, err := charm.Freeze(dir)
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	err = lock.Write(&buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(buf.String(), jc.Contains, "- path: hooks/start\n  mode: \"0777\"\n  digest: sha256:")
+	c.Assert(buf.String(), jc.Contains, "- kind: interface\n  name: http\n")
+	read, err := charm.ReadLockfile(&buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(read, jc.DeepEquals, lock)
+	err = charm.VerifyLock(dir, read)
+	c.Assert(err, gc.IsNil)
+}
+
+var invalidLockfileTests = []struct {
+	yaml string
+	err  string
+}{{
+	yaml: "metadata: sha256:" + strings.Repeat("0", 64),
+	err:  "invalid lockfile: no charm name",
+}, {
+	yaml: "name: foo",
+	err:  "invalid lockfile: no metadata digest",
+}, {
+	yaml: "name: foo\nmetadata: md5:1234",
+	err:  `invalid lockfile: invalid digest "md5:1234": unsupported algorithm "md5"`,
+}, {
+	yaml: "name: foo\nmetadata: sha256:" + strings.Repeat("0", 64) + "\nfiles:\n- {path: a, mode: '0999', digest: 'sha256:" + strings.Repeat("0", 64) + "'}",
+	err:  `invalid lockfile: file "a" has invalid mode "0999"`,
+}, {
+	yaml: "name: foo\nmetadata: sha256:" + strings.Repeat("0", 64) + "\nfiles:\n- {path: a, mode: '0644'}",
+	err:  `invalid lockfile: file "a" has no digest`,
+}}
+
+func (s *LockfileSuite) TestReadInvalidLockfile(c *gc.C) {
+	for i, test := range invalidLockfileTests {
+		c.Logf("test %d: %s", i, test.yaml)
+		_, err := charm.ReadLockfile(strings.NewReader(test.yaml))
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Charm descriptions are written in a small dialect of Markdown, so
+// that every client presents them the same way. It supports
+// paragraphs, ATX headings ("# Title"), bulleted and numbered lists,
+// indented and fenced code blocks, and, within text, `code`, *emphasis*,
+// **strong emphasis** and [links](http://example.com). Anything else,
+// including raw HTML, is treated as text.
+
+// MarkdownHTML renders the given Markdown text as HTML. All text
+// is escaped and links are only generated for http, https and mailto
+// URLs and for relative URLs, so the result is safe to include
+// in a web page.
+func MarkdownHTML(text string) string {
+	var buf bytes.Buffer
+	for _, b := range parseMarkdown(text) {
+		switch b.kind {
+		case mdHeading:
+			fmt.Fprintf(&buf, "<h%d>%s</h%d>\n", b.level, renderInline(b.text, true), b.level)
+		case mdParagraph:
+			fmt.Fprintf(&buf, "<p>%s</p>\n", renderInline(b.text, true))
+		case mdCode:
+			buf.WriteString("<pre><code>")
+			for _, line := range b.lines {
+				buf.WriteString(html.EscapeString(line))
+				buf.WriteString("\n")
+			}
+			buf.WriteString("</code></pre>\n")
+		case mdList:
+			tag := "ul"
+			if b.ordered {
+				tag = "ol"
+			}
+			fmt.Fprintf(&buf, "<%s>\n", tag)
+			for _, item := range b.items {
+				fmt.Fprintf(&buf, "<li>%s</li>\n", renderInline(item, true))
+			}
+			fmt.Fprintf(&buf, "</%s>\n", tag)
+		}
+	}
+	return buf.String()
+}
+
+// MarkdownText renders the given Markdown text as plain text,
+// with markup removed and paragraphs and list items wrapped to
+// lines of at most width characters where possible. If width
+// is not positive, text is not wrapped. Code blocks are indented
+// by four spaces and never wrapped.
+func MarkdownText(text string, width int) string {
+	var buf bytes.Buffer
+	for i, b := range parseMarkdown(text) {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		switch b.kind {
+		case mdHeading, mdParagraph:
+			wrapText(&buf, renderInline(b.text, false), "", "", width)
+		case mdCode:
+			for _, line := range b.lines {
+				if line != "" {
+					buf.WriteString("    ")
+				}
+				buf.WriteString(line)
+				buf.WriteString("\n")
+			}
+		case mdList:
+			for j, item := range b.items {
+				prefix := "- "
+				if b.ordered {
+					prefix = fmt.Sprintf("%d. ", j+1)
+				}
+				indent := strings.Repeat(" ", len(prefix))
+				wrapText(&buf, renderInline(item, false), prefix, indent, width)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// DescriptionHTML returns the charm's description in the
+// given language, as returned by DescriptionIn, rendered
+// as HTML by MarkdownHTML.
+func (m Meta) DescriptionHTML(lang string) string {
+	return MarkdownHTML(m.DescriptionIn(lang))
+}
+
+// DescriptionText returns the charm's description in the
+// given language, as returned by DescriptionIn, rendered
+// as plain text by MarkdownText.
+func (m Meta) DescriptionText(lang string, width int) string {
+	return MarkdownText(m.DescriptionIn(lang), width)
+}
+
+// DescriptionHTML returns the option's description in the
+// given language rendered as HTML by MarkdownHTML.
+func (option Option) DescriptionHTML(lang string) string {
+	return MarkdownHTML(option.DescriptionIn(lang))
+}
+
+// DescriptionText returns the option's description in the
+// given language rendered as plain text by MarkdownText.
+func (option Option) DescriptionText(lang string, width int) string {
+	return MarkdownText(option.DescriptionIn(lang), width)
+}
+
+// DescriptionHTML returns the action's description in the
+// given language rendered as HTML by MarkdownHTML.
+func (spec *ActionSpec) DescriptionHTML(lang string) string {
+	return MarkdownHTML(spec.DescriptionIn(lang))
+}
+
+// DescriptionText returns the action's description in the
+// given language rendered as plain text by MarkdownText.
+func (spec *ActionSpec) DescriptionText(lang string, width int) string {
+	return MarkdownText(spec.DescriptionIn(lang), width)
+}
+
+type mdKind int
+
+const (
+	mdParagraph mdKind = iota
+	mdHeading
+	mdCode
+	mdList
+)
+
+// mdBlock holds a block of Markdown text.
+type mdBlock struct {
+	kind mdKind
+
+	// level holds the level of a heading.
+	level int
+
+	// text holds the text of a heading or paragraph.
+	text string
+
+	// lines holds the lines of a code block.
+	lines []string
+
+	// items holds the text of the items of a list,
+	// and ordered whether it is numbered.
+	items   []string
+	ordered bool
+}
+
+var (
+	mdHeadingPattern  = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	mdListItemPattern = regexp.MustCompile(`^ {0,3}([-*+]|[0-9]+[.)])[ \t]+(.*)$`)
+	mdFencePattern    = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+)
+
+// parseMarkdown splits the given Markdown text into blocks.
+func parseMarkdown(text string) []mdBlock {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	lines := strings.Split(strings.Replace(text, "\t", "    ", -1), "\n")
+	var blocks []mdBlock
+	// para holds the lines of the current paragraph.
+	var para []string
+	// list holds the current list, if any, and inList
+	// whether lines continue its last item.
+	var list *mdBlock
+	inList := false
+	flushPara := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, mdBlock{kind: mdParagraph, text: strings.Join(para, "\n")})
+			para = nil
+		}
+	}
+	flushList := func() {
+		if list != nil {
+			blocks = append(blocks, *list)
+			list, inList = nil, false
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			flushPara()
+			inList = false
+			continue
+		}
+		if m := mdListItemPattern.FindStringSubmatch(line); m != nil {
+			flushPara()
+			ordered := !strings.ContainsAny(m[1][:1], "-*+")
+			if list != nil && list.ordered != ordered {
+				flushList()
+			}
+			if list == nil {
+				list = &mdBlock{kind: mdList, ordered: ordered}
+			}
+			list.items = append(list.items, m[2])
+			inList = true
+			continue
+		}
+		if inList {
+			list.items[len(list.items)-1] += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		if len(para) == 0 && strings.HasPrefix(line, "    ") {
+			// An indented code block continues until the
+			// first line that is not indented.
+			flushList()
+			var code []string
+			for ; i < len(lines); i++ {
+				if strings.HasPrefix(lines[i], "    ") {
+					code = append(code, lines[i][4:])
+				} else if strings.TrimSpace(lines[i]) == "" {
+					code = append(code, "")
+				} else {
+					break
+				}
+			}
+			i--
+			for len(code) > 0 && code[len(code)-1] == "" {
+				code = code[:len(code)-1]
+			}
+			blocks = append(blocks, mdBlock{kind: mdCode, lines: code})
+			continue
+		}
+		flushList()
+		if m := mdFencePattern.FindStringSubmatch(line); m != nil {
+			flushPara()
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, mdBlock{kind: mdCode, lines: code})
+			continue
+		}
+		if m := mdHeadingPattern.FindStringSubmatch(line); m != nil {
+			flushPara()
+			blocks = append(blocks, mdBlock{kind: mdHeading, level: len(m[1]), text: m[2]})
+			continue
+		}
+		para = append(para, strings.TrimSpace(line))
+	}
+	flushPara()
+	flushList()
+	return blocks
+}
+
+// renderInline renders the markup within a block of text,
+// as HTML if asHTML is true or as plain text otherwise.
+func renderInline(s string, asHTML bool) string {
+	var buf bytes.Buffer
+	text := func(t string) {
+		if asHTML {
+			t = html.EscapeString(t)
+		}
+		buf.WriteString(t)
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte(mdEscapable, s[i+1]) >= 0 {
+				i++
+				text(s[i : i+1])
+				continue
+			}
+		case '`':
+			if j := strings.IndexByte(s[i+1:], '`'); j >= 0 {
+				code := s[i+1 : i+1+j]
+				if asHTML {
+					buf.WriteString("<code>")
+					text(code)
+					buf.WriteString("</code>")
+				} else {
+					text(code)
+				}
+				i += j + 1
+				continue
+			}
+		case '*', '_':
+			if c == '_' && i > 0 && isWordByte(s[i-1]) {
+				// Underscores within words, as in
+				// snake_case, are not emphasis.
+				break
+			}
+			delim, tag := s[i:i+1], "em"
+			if i+1 < len(s) && s[i+1] == c {
+				delim, tag = s[i:i+2], "strong"
+			}
+			start := i + len(delim)
+			if start >= len(s) || s[start] == ' ' {
+				break
+			}
+			j := strings.Index(s[start:], delim)
+			if j <= 0 || s[start+j-1] == ' ' {
+				break
+			}
+			inner := renderInline(s[start:start+j], asHTML)
+			if asHTML {
+				fmt.Fprintf(&buf, "<%s>%s</%s>", tag, inner, tag)
+			} else {
+				buf.WriteString(inner)
+			}
+			i = start + j + len(delim) - 1
+			continue
+		case '[':
+			j := strings.Index(s[i:], "](")
+			if j < 0 {
+				break
+			}
+			k := closingParen(s[i+j+1:])
+			if k < 0 {
+				break
+			}
+			k++
+			label := renderInline(s[i+1:i+j], asHTML)
+			url := strings.TrimSpace(s[i+j+2 : i+j+k])
+			switch {
+			case !safeURL(url):
+				buf.WriteString(label)
+			case asHTML:
+				fmt.Fprintf(&buf, `<a href="%s" rel="nofollow">%s</a>`, html.EscapeString(url), label)
+			case label == url:
+				buf.WriteString(url)
+			default:
+				fmt.Fprintf(&buf, "%s (%s)", label, url)
+			}
+			i += j + k
+			continue
+		case '\n':
+			if !asHTML {
+				buf.WriteByte(' ')
+				continue
+			}
+		}
+		text(s[i : i+1])
+	}
+	return buf.String()
+}
+
+// closingParen returns the index of the parenthesis closing
+// the one that starts s, or -1 if there is none.
+func closingParen(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// mdEscapable holds the characters that may be
+// escaped with a backslash.
+const mdEscapable = "\\`*_{}[]()#+-.!<>"
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// safeURL reports whether the given link target may be
+// included in rendered HTML.
+func safeURL(url string) bool {
+	if url == "" {
+		return false
+	}
+	i := strings.IndexAny(url, ":/?#")
+	if i < 0 || url[i] != ':' {
+		// A relative URL.
+		return true
+	}
+	switch strings.ToLower(url[:i]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// wrapText writes the words of the given text to buf, wrapped
+// to lines of at most width characters where possible. The first
+// line is prefixed with prefix and subsequent ones with indent.
+func wrapText(buf *bytes.Buffer, text, prefix, indent string, width int) {
+	words := strings.Fields(text)
+	buf.WriteString(prefix)
+	n := len(prefix)
+	lineStart := true
+	for _, w := range words {
+		if !lineStart && width > 0 && n+1+len([]rune(w)) > width {
+			buf.WriteString("\n")
+			buf.WriteString(indent)
+			n = len(indent)
+			lineStart = true
+		}
+		if !lineStart {
+			buf.WriteString(" ")
+			n++
+		}
+		buf.WriteString(w)
+		n += len([]rune(w))
+		lineStart = false
+	}
+	buf.WriteString("\n")
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type MarkdownSuite struct{}
+
+var _ = gc.Suite(&MarkdownSuite{})
+
+var markdownTests = []struct {
+	about    string
+	markdown string
+	html     string
+	text     string
+}{{
+	about:    "paragraphs",
+	markdown: "A blog\nengine.\n\nIt is *fast*.",
+	html:     "<p>A blog\nengine.</p>\n<p>It is <em>fast</em>.</p>\n",
+	text:     "A blog engine.\n\nIt is fast.\n",
+}, {
+	about:    "headings and lists",
+	markdown: "# Usage\n\n- install it\n- relate it\n  to mysql\n\n1. one\n2. **two**\n",
+	html:     "<h1>Usage</h1>\n<ul>\n<li>install it</li>\n<li>relate it\nto mysql</li>\n</ul>\n<ol>\n<li>one</li>\n<li><strong>two</strong></li>\n</ol>\n",
+	text:     "Usage\n\n- install it\n- relate it to mysql\n\n1. one\n2. two\n",
+}, {
+	about:    "code",
+	markdown: "Run `juju deploy`:\n\n    juju deploy <charm>\n    juju expose\n\n```\na && b\n```",
+	html:     "<p>Run <code>juju deploy</code>:</p>\n<pre><code>juju deploy &lt;charm&gt;\njuju expose\n</code></pre>\n<pre><code>a &amp;&amp; b\n</code></pre>\n",
+	text:     "Run juju deploy:\n\n    juju deploy <charm>\n    juju expose\n\n    a && b\n",
+}, {
+	about:    "links",
+	markdown: "See [the docs](https://juju.ubuntu.com/docs), [readme](README.md) and [this](javascript:alert(1)).",
+	html:     `<p>See <a href="https://juju.ubuntu.com/docs" rel="nofollow">the docs</a>, <a href="README.md" rel="nofollow">readme</a> and this.</p>` + "\n",
+	text:     "See the docs (https://juju.ubuntu.com/docs), readme (README.md) and this.\n",
+}, {
+	about:    "raw html is escaped",
+	markdown: `<script>alert("x")</script> & snake_case_name \*not em\*`,
+	html:     "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; snake_case_name *not em*</p>\n",
+	text:     `<script>alert("x")</script> & snake_case_name *not em*` + "\n",
+}, {
+	about:    "empty",
+	markdown: "",
+	html:     "",
+	text:     "",
+}}
+
+func (s *MarkdownSuite) TestMarkdown(c *gc.C) {
+	for i, test := range markdownTests {
+		c.Logf("test %d: %s", i, test.about)
+		c.Check(charm.MarkdownHTML(test.markdown), gc.Equals, test.html)
+		c.Check(charm.MarkdownText(test.markdown, 0), gc.Equals, test.text)
+	}
+}
+
+func (s *MarkdownSuite) TestMarkdownTextWrapping(c *gc.C) {
+	text := charm.MarkdownText("The quick brown fox jumps over the lazy dog.\n\n- a list item that wraps\n\n    a code line that is not wrapped", 16)
+	c.Assert(text, gc.Equals, `The quick brown
+fox jumps over
+the lazy dog.
+
+- a list item
+  that wraps
+
+    a code line that is not wrapped
+`)
+}
+
+func (s *MarkdownSuite) TestDescriptionRendering(c *gc.C) {
+	meta := charm.Meta{
+		Description:  "A *blog* engine.",
+		Descriptions: map[string]string{"de": "Eine *Blog*-Software."},
+	}
+	c.Assert(meta.DescriptionHTML("de"), gc.Equals, "<p>Eine <em>Blog</em>-Software.</p>\n")
+	c.Assert(meta.DescriptionText("en", 0), gc.Equals, "A blog engine.\n")
+
+	option := charm.Option{Description: "The `title`."}
+	c.Assert(option.DescriptionHTML(""), gc.Equals, "<p>The <code>title</code>.</p>\n")
+	c.Assert(option.DescriptionText("", 0), gc.Equals, "The title.\n")
+
+	spec := &charm.ActionSpec{Description: "Take a **snapshot**."}
+	c.Assert(spec.DescriptionHTML(""), gc.Equals, "<p>Take a <strong>snapshot</strong>.</p>\n")
+	c.Assert(spec.DescriptionText("", 10), gc.Equals, "Take a\nsnapshot.\n")
+}
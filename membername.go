@@ -0,0 +1,143 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Values of Policy.MemberNames, which determine how problems
+// reported by CheckMemberNames affect the evaluation of a charm.
+const (
+	// MemberNamesIgnore causes problems to be ignored.
+	MemberNamesIgnore = ""
+
+	// MemberNamesWarn causes problems to be
+	// reported as warnings.
+	MemberNamesWarn = "warn"
+
+	// MemberNamesReject causes problems to be
+	// reported as reasons to reject the charm.
+	MemberNamesReject = "reject"
+)
+
+// windowsReservedNames holds the file names, without extension,
+// that cannot be used on Windows.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// CheckMemberName checks that the given slash-separated path of a
+// file in a charm can be extracted on any filesystem: it must not hold
+// NUL bytes or invalid UTF-8, and none of its elements may be a name
+// reserved on Windows, such as "CON" or "nul.txt", hold characters
+// that Windows does not allow or end with a dot or a space.
+func CheckMemberName(name string) error {
+	for _, elem := range strings.Split(strings.TrimSuffix(name, "/"), "/") {
+		if problem := checkNameElement(elem); problem != "" {
+			return fmt.Errorf("file name %q %s", name, problem)
+		}
+	}
+	return nil
+}
+
+// checkNameElement returns the problem with the given
+// element of a file path, or "" if there is none.
+func checkNameElement(elem string) string {
+	base := elem
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	switch {
+	case strings.IndexByte(elem, 0) >= 0:
+		return "contains a NUL byte"
+	case !utf8.ValidString(elem):
+		return "is not valid UTF-8"
+	case windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))]:
+		return fmt.Sprintf("uses %q, which is reserved on Windows", elem)
+	case strings.ContainsAny(elem, `<>:"\|?*`) || strings.IndexFunc(elem, isControl) >= 0:
+		return "holds characters not allowed on Windows"
+	case elem != "." && elem != ".." && strings.TrimRight(elem, ". ") != elem:
+		return "has an element ending in a dot or space"
+	}
+	return ""
+}
+
+func isControl(r rune) bool {
+	return r < 0x20
+}
+
+// CheckMemberNames returns the problems found in the names of the
+// files in the given charm, which must be a *CharmDir or a
+// *CharmArchive: those found by CheckMemberName, and paths that
+// differ only in case, which collide when the charm is extracted on
+// a case-insensitive filesystem such as those used by default on
+// Windows and OS X. The problems are sorted by file name.
+func CheckMemberNames(ch Charm) ([]string, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	names := make([]string, len(zipr.File))
+	for i, fh := range zipr.File {
+		names[i] = fh.Name
+	}
+	var problems []string
+	for _, p := range memberNameProblems(names) {
+		problems = append(problems, p.problem)
+	}
+	return problems, nil
+}
+
+// memberNameProblem describes a problem with the
+// name of the file at the given path.
+type memberNameProblem struct {
+	path    string
+	problem string
+}
+
+// memberNameProblems returns the problems found in the given
+// archive member names, sorted by name.
+func memberNameProblems(names []string) []memberNameProblem {
+	// The directories holding each file are checked
+	// for collisions too, as archives need not hold
+	// entries for them.
+	paths := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSuffix(name, "/")
+		for p := name; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+			paths[p] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+	var problems []memberNameProblem
+	folded := make(map[string]string)
+	for _, p := range sorted {
+		// Each directory is checked once, rather
+		// than with every file in it.
+		if problem := checkNameElement(path.Base(p)); problem != "" {
+			problems = append(problems, memberNameProblem{p, fmt.Sprintf("file name %q %s", p, problem)})
+		}
+		key := strings.ToLower(p)
+		if other, ok := folded[key]; ok {
+			problems = append(problems, memberNameProblem{p, fmt.Sprintf("file names %q and %q differ only in case", other, p)})
+			continue
+		}
+		folded[key] = p
+	}
+	return problems
+}
@@ -0,0 +1,161 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type MemberNameSuite struct{}
+
+var _ = gc.Suite(&MemberNameSuite{})
+
+var checkMemberNameTests = []struct {
+	name string
+	err  string
+}{{
+	name: "hooks/install",
+}, {
+	name: "templates/",
+}, {
+	name: "docs/café.md",
+}, {
+	name: "lib/console.py",
+}, {
+	name: "a\x00b",
+	err:  `file name "a\\x00b" contains a NUL byte`,
+}, {
+	name: "docs/caf\xe9.md",
+	err:  `file name "docs/caf\\xe9.md" is not valid UTF-8`,
+}, {
+	name: "lib/con/x",
+	err:  `file name "lib/con/x" uses "con", which is reserved on Windows`,
+}, {
+	name: "lib/NUL.txt",
+	err:  `file name "lib/NUL.txt" uses "NUL.txt", which is reserved on Windows`,
+}, {
+	name: "lib/com1",
+	err:  `file name "lib/com1" uses "com1", which is reserved on Windows`,
+}, {
+	name: "what?",
+	err:  `file name "what\?" holds characters not allowed on Windows`,
+}, {
+	name: "a\tb",
+	err:  `file name "a\\tb" holds characters not allowed on Windows`,
+}, {
+	name: "notes./x",
+	err:  `file name "notes./x" has an element ending in a dot or space`,
+}}
+
+func (s *MemberNameSuite) TestCheckMemberName(c *gc.C) {
+	for i, test := range checkMemberNameTests {
+		c.Logf("test %d: %q", i, test.name)
+		err := charm.CheckMemberName(test.name)
+		if test.err == "" {
+			c.Assert(err, gc.IsNil)
+		} else {
+			c.Assert(err, gc.ErrorMatches, test.err)
+		}
+	}
+}
+
+// unportableArchive returns an archive holding
+// files with names that are not portable.
+func unportableArchive(c *gc.C) *charm.CharmArchive {
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	for _, name := range []string{
+		"metadata.yaml",
+		"README",
+		"readme",
+		"hooks/install",
+		"Hooks/start",
+		"lib/aux.py",
+	} {
+		w, err := zipw.Create(name)
+		c.Assert(err, gc.IsNil)
+		if name == "metadata.yaml" {
+			_, err = w.Write([]byte(verifyMeta))
+			c.Assert(err, gc.IsNil)
+		}
+	}
+	c.Assert(zipw.Close(), gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	return archive
+}
+
+var unportableProblems = []string{
+	`file names "Hooks" and "hooks" differ only in case`,
+	`file name "lib/aux.py" uses "aux.py", which is reserved on Windows`,
+	`file names "README" and "readme" differ only in case`,
+}
+
+func (s *MemberNameSuite) TestCheckMemberNames(c *gc.C) {
+	problems, err := charm.CheckMemberNames(unportableArchive(c))
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, unportableProblems)
+
+	for _, ch := range []charm.Charm{
+		charmtesting.Charms.CharmDir("wordpress"),
+		charmtesting.Charms.CharmArchive(c.MkDir(), "wordpress"),
+	} {
+		problems, err := charm.CheckMemberNames(ch)
+		c.Assert(err, gc.IsNil)
+		c.Assert(problems, gc.HasLen, 0)
+	}
+}
+
+func (s *MemberNameSuite) TestExpandReportsUnportableNames(c *gc.C) {
+	logger := &recordingLogger{}
+	defer charm.SetLogger(charm.SetLogger(logger))
+	err := unportableArchive(c).ExpandTo(c.MkDir())
+	c.Assert(err, gc.IsNil)
+	c.Assert(logger.kind(charm.EventUnportableName), jc.DeepEquals, []charm.Event{{
+		Op:     "expand",
+		Kind:   charm.EventUnportableName,
+		Path:   "hooks",
+		Fields: map[string]interface{}{"problem": unportableProblems[0]},
+	}, {
+		Op:     "expand",
+		Kind:   charm.EventUnportableName,
+		Path:   "lib/aux.py",
+		Fields: map[string]interface{}{"problem": unportableProblems[1]},
+	}, {
+		Op:     "expand",
+		Kind:   charm.EventUnportableName,
+		Path:   "readme",
+		Fields: map[string]interface{}{"problem": unportableProblems[2]},
+	}})
+}
+
+func (s *MemberNameSuite) TestPolicyMemberNames(c *gc.C) {
+	archive := unportableArchive(c)
+	p := &charm.Policy{MemberNames: charm.MemberNamesWarn}
+	result, err := p.Evaluate(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result, jc.DeepEquals, &charm.PolicyResult{
+		Pass:     true,
+		Warnings: unportableProblems,
+	})
+
+	p.MemberNames = charm.MemberNamesReject
+	result, err = p.Evaluate(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result, jc.DeepEquals, &charm.PolicyResult{
+		Reasons: unportableProblems,
+	})
+
+	p.MemberNames = charm.MemberNamesIgnore
+	result, err = p.Evaluate(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result, jc.DeepEquals, &charm.PolicyResult{Pass: true})
+}
@@ -4,39 +4,15 @@
 package charm
 
 import (
-	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"strings"
 
 	"github.com/juju/schema"
-	"gopkg.in/yaml.v1"
 
 	"gopkg.in/juju/charm.v4/hooks"
 )
 
-// RelationScope describes the scope of a relation.
-type RelationScope string
-
-// Note that schema doesn't support custom string types,
-// so when we use these values in a schema.Checker,
-// we must store them as strings, not RelationScopes.
-
-const (
-	ScopeGlobal    RelationScope = "global"
-	ScopeContainer RelationScope = "container"
-)
-
-// RelationRole defines the role of a relation.
-type RelationRole string
-
-const (
-	RoleProvider RelationRole = "provider"
-	RoleRequirer RelationRole = "requirer"
-	RolePeer     RelationRole = "peer"
-)
-
 // Relation represents a single relation defined in the charm
 // metadata.yaml file.
 type Relation struct {
@@ -46,6 +22,10 @@ type Relation struct {
 	Optional  bool
 	Limit     int
 	Scope     RelationScope
+
+	// Schema describes the data that units are expected to
+	// set on the relation, or is nil if none is declared.
+	Schema *RelationSchema `bson:",omitempty"`
 }
 
 // ImplementedBy returns whether the relation is implemented by the supplied charm.
@@ -104,6 +84,55 @@ type Meta struct {
 	Categories  []string            `bson:",omitempty"`
 	Tags        []string            `bson:",omitempty"`
 	Series      string              `bson:",omitempty"`
+
+	// Version holds the semantic version the charm is
+	// published as, such as "2.0.0-rc1", if declared.
+	// See ParseSemVer. A declared version that is not a
+	// semantic version is ignored, leaving Version empty.
+	Version string `bson:",omitempty"`
+
+	// Bases holds the bases the charm declares it can run on,
+	// from the bases and platforms fields of its metadata.
+	Bases []Base `bson:",omitempty"`
+
+	// Descriptions holds translations of the description, keyed
+	// by language tag, if the description was given as a map.
+	Descriptions map[string]string `bson:",omitempty"`
+
+	// Assumes holds the features, such as hook tools,
+	// that the charm assumes are available.
+	Assumes []AssumesExpression `bson:",omitempty"`
+
+	// ExposedPorts holds the ports that the charm's workload
+	// listens on, from the exposed-ports and networking fields
+	// of its metadata.
+	ExposedPorts []PortRange `bson:",omitempty"`
+
+	// HookPolicies holds the timeouts and retry policies
+	// declared for the charm's hooks, keyed by hook name.
+	HookPolicies map[string]HookPolicy `bson:",omitempty"`
+
+	// Probes holds the readiness and liveness probes
+	// provided by the charm, keyed by name.
+	Probes map[string]Probe `bson:",omitempty"`
+
+	// Storage holds the stores required by the
+	// charm, keyed by name.
+	Storage map[string]Storage `bson:",omitempty"`
+
+	// UnknownFields holds the fields of the metadata that are not
+	// known to this version of the package, such as those added
+	// by later versions, keyed by name. They are written back when
+	// the metadata is saved, so that rewriting a newer charm does
+	// not silently drop them.
+	UnknownFields map[string]interface{} `bson:",omitempty"`
+}
+
+// DescriptionIn returns the charm's description in the given
+// language, such as "de" or "pt-BR", falling back to English
+// and then to Description if there is no such translation.
+func (m Meta) DescriptionIn(lang string) string {
+	return localize(m.Description, m.Descriptions, lang)
 }
 
 func generateRelationHooks(relName string, allHooks map[string]bool) {
@@ -149,27 +178,190 @@ func parseStringList(list interface{}) []string {
 
 // ReadMeta reads the content of a metadata.yaml file and returns
 // its representation.
-func ReadMeta(r io.Reader) (meta *Meta, err error) {
-	data, err := ioutil.ReadAll(r)
+func ReadMeta(r io.Reader) (*Meta, error) {
+	meta, _, err := readMeta(r, false, false)
+	return meta, err
+}
+
+// ReadMetaStrict is like ReadMeta except that metadata holding a
+// byte order mark or CRLF line endings is rejected rather than
+// normalized.
+func ReadMetaStrict(r io.Reader) (*Meta, error) {
+	meta, _, err := readMeta(r, true, false)
+	return meta, err
+}
+
+// ReadMetaWithSourceMap is like ReadMeta except that it also returns
+// the positions in the metadata.yaml file of the values of the
+// metadata.
+func ReadMetaWithSourceMap(r io.Reader) (*Meta, SourceMap, error) {
+	return readMeta(r, false, true)
+}
+
+func readMeta(r io.Reader, strict, withSourceMap bool) (meta *Meta, sourceMap SourceMap, err error) {
+	data, release, err := readYAMLSource(r)
 	if err != nil {
 		return
 	}
+	defer release()
+	data, perr := normalizeYAML(data, strict)
+	if perr != nil {
+		perr.context = "metadata"
+		return nil, nil, perr
+	}
+	if err := checkYAMLFeatures(data); err != nil {
+		err.context = "metadata"
+		return nil, nil, err
+	}
 	raw := make(map[interface{}]interface{})
-	err = yaml.Unmarshal(data, raw)
-	if err != nil {
-		return
+	if err := yamlUnmarshal(data, raw); err != nil {
+		return nil, nil, yamlDecodeError(data, "metadata", err)
+	}
+	if err := checkYAMLExpansion(data, raw); err != nil {
+		err.context = "metadata"
+		return nil, nil, err
 	}
 	v, err := charmSchema.Coerce(raw, nil)
 	if err != nil {
-		return nil, errors.New("metadata: " + err.Error())
+		return nil, nil, schemaParseError(data, "metadata", err)
 	}
-	m := v.(map[string]interface{})
-	meta = &Meta{}
+	meta = parseMeta(v.(map[string]interface{}))
+	meta.UnknownFields = unknownMetaFields(raw)
+	if err := meta.Check(); err != nil {
+		return nil, nil, err
+	}
+	if withSourceMap {
+		sourceMap = yamlSourceMap(data)
+	}
+	return meta, sourceMap, nil
+}
+
+// encodeMeta returns the contents of a metadata.yaml file
+// holding the given metadata. Fields are written in the order
+// in which they are conventionally written, and fields holding
+// their default values are left out.
+func encodeMeta(meta *Meta) ([]byte, error) {
+	// Marshal each field separately to preserve the order.
+	var data []byte
+	for _, field := range metaDocFields(meta) {
+		fieldData, err := yamlMarshal(field)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, fieldData...)
+	}
+	return data, nil
+}
+
+// metaDocFields returns the fields of a metadata.yaml file holding
+// the given metadata, each as a map holding the field alone, in the
+// order in which they are conventionally written. Fields holding
+// their default values are left out.
+func metaDocFields(meta *Meta) []map[string]interface{} {
+	var fields []map[string]interface{}
+	add := func(name string, value interface{}) {
+		fields = append(fields, map[string]interface{}{name: value})
+	}
+	add("name", meta.Name)
+	add("summary", meta.Summary)
+	add("description", encodeDescription(meta.Description, meta.Descriptions))
+	if meta.Format != 0 && meta.Format != 1 {
+		add("format", meta.Format)
+	}
+	if meta.Subordinate {
+		add("subordinate", true)
+	}
+	if meta.Provides != nil {
+		add("provides", encodeRelations(meta.Provides, 0))
+	}
+	if meta.Requires != nil {
+		add("requires", encodeRelations(meta.Requires, 1))
+	}
+	if meta.Peers != nil {
+		add("peers", encodeRelations(meta.Peers, 1))
+	}
+	if meta.Categories != nil {
+		add("categories", meta.Categories)
+	}
+	if meta.Tags != nil {
+		add("tags", meta.Tags)
+	}
+	if meta.Series != "" {
+		add("series", meta.Series)
+	}
+	if meta.Bases != nil {
+		add("bases", encodeBases(meta.Bases))
+	}
+	if meta.Assumes != nil {
+		add("assumes", encodeAssumes(meta.Assumes))
+	}
+	if meta.ExposedPorts != nil {
+		add("exposed-ports", encodeExposedPorts(meta.ExposedPorts))
+	}
+	if meta.HookPolicies != nil {
+		add("hooks", encodeHookPolicies(meta.HookPolicies))
+	}
+	if meta.Probes != nil {
+		add("probes", encodeProbes(meta.Probes))
+	}
+	if meta.Storage != nil {
+		add("storage", encodeStorage(meta.Storage))
+	}
+	if meta.Version != "" {
+		add("version", meta.Version)
+	}
+	if meta.OldRevision != 0 {
+		add("revision", meta.OldRevision)
+	}
+	for _, name := range sortedUnknownFields(meta.UnknownFields) {
+		add(name, meta.UnknownFields[name])
+	}
+	return fields
+}
+
+// encodeRelations returns the metadata.yaml representation of
+// the given relations, using the interface shorthand notation
+// for relations that hold default values. The given limit is
+// the default limit for the relations.
+func encodeRelations(relations map[string]Relation, limit int) map[string]interface{} {
+	result := make(map[string]interface{})
+	for name, rel := range relations {
+		global := rel.Scope == "" || rel.Scope == ScopeGlobal
+		if rel.Limit == limit && !rel.Optional && global && rel.Schema == nil {
+			result[name] = rel.Interface
+			continue
+		}
+		relMap := map[string]interface{}{
+			"interface": rel.Interface,
+		}
+		if rel.Limit != limit {
+			relMap["limit"] = rel.Limit
+		}
+		if rel.Optional {
+			relMap["optional"] = true
+		}
+		if !global {
+			relMap["scope"] = string(rel.Scope)
+		}
+		if rel.Schema != nil {
+			relMap["schema"] = encodeRelationSchema(rel.Schema)
+		}
+		result[name] = relMap
+	}
+	return result
+}
+
+// parseMeta returns the metadata held in m, which must have
+// been coerced by charmSchema.
+func parseMeta(m map[string]interface{}) *Meta {
+	meta := &Meta{}
 	meta.Name = m["name"].(string)
 	// Schema decodes as int64, but the int range should be good
 	// enough for revisions.
 	meta.Summary = m["summary"].(string)
-	meta.Description = m["description"].(string)
+	// The description has been coerced to a string or a map of
+	// strings, so it cannot fail to parse.
+	meta.Description, meta.Descriptions, _ = parseDescription(m["description"])
 	meta.Provides = parseRelations(m["provides"], RoleProvider)
 	meta.Requires = parseRelations(m["requires"], RoleRequirer)
 	meta.Peers = parseRelations(m["peers"], RolePeer)
@@ -186,14 +378,50 @@ func ReadMeta(r io.Reader) (meta *Meta, err error) {
 	if series, ok := m["series"]; ok && series != nil {
 		meta.Series = series.(string)
 	}
-	if err := meta.Check(); err != nil {
-		return nil, err
+	if version, ok := m["version"]; ok && version != nil {
+		// Older charms declare versions such as "1.0" or 2
+		// for their own purposes, which are not semantic
+		// versions; they are ignored rather than rejected.
+		s, _ := version.(string)
+		if _, err := ParseSemVer(s); err == nil {
+			meta.Version = s
+		} else {
+			logger.Warningf("charm %q: ignoring version %v, which is not a semantic version", meta.Name, version)
+		}
+	}
+	// Platforms are an alternative spelling of bases.
+	for _, field := range []string{"bases", "platforms"} {
+		if bases, ok := m[field]; ok && bases != nil {
+			meta.Bases = append(meta.Bases, bases.([]Base)...)
+		}
+	}
+	if assumes, ok := m["assumes"]; ok && assumes != nil {
+		meta.Assumes = assumes.([]AssumesExpression)
 	}
-	return meta, nil
+	// Networking is an alternative spelling of exposed-ports.
+	for _, field := range []string{"exposed-ports", "networking"} {
+		if ports, ok := m[field]; ok && ports != nil {
+			meta.ExposedPorts = append(meta.ExposedPorts, ports.([]PortRange)...)
+		}
+	}
+	if policies, ok := m["hooks"]; ok && policies != nil {
+		meta.HookPolicies = policies.(map[string]HookPolicy)
+	}
+	if probes, ok := m["probes"]; ok && probes != nil {
+		meta.Probes = probes.(map[string]Probe)
+	}
+	if stores, ok := m["storage"]; ok && stores != nil {
+		meta.Storage = stores.(map[string]Storage)
+	}
+	return meta
 }
 
 // Check checks that the metadata is well-formed.
 func (meta Meta) Check() error {
+	if err := ValidateName(meta.Name); err != nil {
+		return err
+	}
+
 	// Check for duplicate or forbidden relation names or interfaces.
 	names := map[string]bool{}
 	checkRelations := func(src map[string]Relation, role RelationRole) error {
@@ -204,6 +432,11 @@ func (meta Meta) Check() error {
 			if rel.Role != role {
 				return fmt.Errorf("charm %q has mismatched role %q; expected %q", meta.Name, rel.Role, role)
 			}
+			if rel.Scope != "" {
+				if err := rel.Scope.Validate(); err != nil {
+					return fmt.Errorf("charm %q relation %q has %v", meta.Name, name, err)
+				}
+			}
 			// Container-scoped require relations on subordinates are allowed
 			// to use the otherwise-reserved juju-* namespace.
 			if !meta.Subordinate || role != RoleRequirer || rel.Scope != ScopeContainer {
@@ -211,8 +444,12 @@ func (meta Meta) Check() error {
 					return fmt.Errorf("charm %q using a reserved relation name: %q", meta.Name, name)
 				}
 			}
+			iface, err := ParseInterface(rel.Interface)
+			if err != nil {
+				return fmt.Errorf("charm %q relation %q has %v", meta.Name, name, err)
+			}
 			if role != RoleRequirer {
-				if reservedName(rel.Interface) {
+				if reservedName(iface.Name) {
 					return fmt.Errorf("charm %q relation %q using a reserved interface: %q", meta.Name, name, rel.Interface)
 				}
 			}
@@ -256,6 +493,43 @@ func (meta Meta) Check() error {
 			return fmt.Errorf("charm %q declares invalid series: %q", meta.Name, meta.Series)
 		}
 	}
+	for _, b := range meta.Bases {
+		if err := b.Validate(); err != nil {
+			return fmt.Errorf("charm %q declares invalid base %q: %v", meta.Name, b, err)
+		}
+	}
+	if err := checkSeriesBases(meta.Series, meta.Bases); err != nil {
+		return fmt.Errorf("charm %q %v", meta.Name, err)
+	}
+	if meta.Version != "" {
+		if _, err := ParseSemVer(meta.Version); err != nil {
+			return fmt.Errorf("charm %q declares %v", meta.Name, err)
+		}
+	}
+
+	if err := checkExposedPorts(meta.ExposedPorts); err != nil {
+		return fmt.Errorf("charm %q has %v", meta.Name, err)
+	}
+
+	if err := checkHookPolicies(meta); err != nil {
+		return fmt.Errorf("charm %q has %v", meta.Name, err)
+	}
+
+	if err := checkProbes(meta.Probes); err != nil {
+		return fmt.Errorf("charm %q has %v", meta.Name, err)
+	}
+
+	if err := checkStorage(meta.Storage); err != nil {
+		return fmt.Errorf("charm %q has %v", meta.Name, err)
+	}
+
+	if err := checkDescriptions(meta.Descriptions); err != nil {
+		return fmt.Errorf("charm %q has invalid description: %v", meta.Name, err)
+	}
+
+	if err := checkUnknownFields(meta.UnknownFields); err != nil {
+		return fmt.Errorf("charm %q has %v", meta.Name, err)
+	}
 
 	return nil
 }
@@ -285,6 +559,9 @@ func parseRelations(relations interface{}, role RelationRole) map[string]Relatio
 			// the int range should be more than enough.
 			relation.Limit = int(relMap["limit"].(int64))
 		}
+		if s := relMap["schema"]; s != nil {
+			relation.Schema = s.(*RelationSchema)
+		}
 		result[name] = relation
 	}
 	return result
@@ -352,37 +629,73 @@ var ifaceSchema = schema.FieldMap(
 		"limit":     schema.OneOf(schema.Const(nil), schema.Int()),
 		"scope":     schema.OneOf(schema.Const(string(ScopeGlobal)), schema.Const(string(ScopeContainer))),
 		"optional":  schema.Bool(),
+		"schema":    relationSchemaC{},
 	},
 	schema.Defaults{
 		"scope":    string(ScopeGlobal),
 		"optional": false,
+		"schema":   schema.Omit,
 	},
 )
 
-var charmSchema = schema.FieldMap(
-	schema.Fields{
-		"name":        schema.String(),
-		"summary":     schema.String(),
-		"description": schema.String(),
-		"peers":       schema.StringMap(ifaceExpander(int64(1))),
-		"provides":    schema.StringMap(ifaceExpander(nil)),
-		"requires":    schema.StringMap(ifaceExpander(int64(1))),
-		"revision":    schema.Int(), // Obsolete
-		"format":      schema.Int(),
-		"subordinate": schema.Bool(),
-		"categories":  schema.List(schema.String()),
-		"tags":        schema.List(schema.String()),
-		"series":      schema.String(),
-	},
-	schema.Defaults{
-		"provides":    schema.Omit,
-		"requires":    schema.Omit,
-		"peers":       schema.Omit,
-		"revision":    schema.Omit,
-		"format":      1,
-		"subordinate": schema.Omit,
-		"categories":  schema.Omit,
-		"tags":        schema.Omit,
-		"series":      schema.Omit,
-	},
-)
+// descriptionC accepts a description given either as a string
+// or as a map from language tags to translations.
+type descriptionC struct{}
+
+var descriptionsC = schema.StringMap(schema.String())
+
+func (c descriptionC) Coerce(v interface{}, path []string) (interface{}, error) {
+	if _, ok := v.(map[interface{}]interface{}); ok {
+		return descriptionsC.Coerce(v, path)
+	}
+	return stringC.Coerce(v, path)
+}
+
+var charmSchemaFields = schema.Fields{
+	"name":        schema.String(),
+	"summary":     schema.String(),
+	"description": descriptionC{},
+	"peers":       schema.StringMap(ifaceExpander(int64(1))),
+	"provides":    schema.StringMap(ifaceExpander(nil)),
+	"requires":    schema.StringMap(ifaceExpander(int64(1))),
+	"revision":    schema.Int(), // Obsolete
+	"format":      schema.Int(),
+	"subordinate": schema.Bool(),
+	"categories":  schema.List(schema.String()),
+	"tags":        schema.List(schema.String()),
+	"series":      schema.String(),
+	"version":     schema.OneOf(schema.String(), schema.Int(), schema.Float()),
+	"assumes":     assumesC{},
+	"bases":       basesC{},
+	"platforms":   basesC{},
+
+	"exposed-ports": exposedPortsC{},
+	"networking":    exposedPortsC{},
+	"hooks":         hookPoliciesC{},
+	"probes":        probesC{},
+	"storage":       storageC{},
+}
+
+var charmSchemaDefaults = schema.Defaults{
+	"provides":    schema.Omit,
+	"requires":    schema.Omit,
+	"peers":       schema.Omit,
+	"revision":    schema.Omit,
+	"format":      1,
+	"subordinate": schema.Omit,
+	"categories":  schema.Omit,
+	"tags":        schema.Omit,
+	"series":      schema.Omit,
+	"version":     schema.Omit,
+	"assumes":     schema.Omit,
+	"bases":       schema.Omit,
+	"platforms":   schema.Omit,
+
+	"exposed-ports": schema.Omit,
+	"networking":    schema.Omit,
+	"hooks":         schema.Omit,
+	"probes":        schema.Omit,
+	"storage":       schema.Omit,
+}
+
+var charmSchema = schema.FieldMap(charmSchemaFields, charmSchemaDefaults)
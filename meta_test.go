@@ -544,3 +544,44 @@ func (c *dummyCharm) Meta() *charm.Meta {
 		},
 	}
 }
+
+func (s *MetaSuite) TestYAMLAliasesRejected(c *gc.C) {
+	_, err := charm.ReadMeta(strings.NewReader(`
+name: &name foo
+summary: *name
+description: bar
+`))
+	c.Assert(err, gc.ErrorMatches, `metadata: line 2, column 7: YAML anchors are not allowed`)
+}
+
+func (s *MetaSuite) TestReadMetaParseError(c *gc.C) {
+	_, err := charm.ReadMeta(strings.NewReader(`
+name: foo
+summary: bar
+description: baz
+requires:
+  db:
+    limit: 1
+`))
+	c.Assert(err, gc.ErrorMatches, `metadata: line 6, column 3: requires.db.interface: expected string, got nothing`)
+	perr, ok := err.(*charm.ParseError)
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(perr.Path, gc.Equals, "requires.db.interface")
+	c.Assert(perr.Line, gc.Equals, 6)
+	c.Assert(perr.Column, gc.Equals, 3)
+	c.Assert(perr.Message, gc.Equals, "requires.db.interface: expected string, got nothing")
+}
+
+func (s *MetaSuite) TestReadMetaWindowsLineEndings(c *gc.C) {
+	data := "\xef\xbb\xbfname: foo\r\nsummary: bar\r\ndescription: baz\r\n"
+	meta, err := charm.ReadMeta(strings.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Name, gc.Equals, "foo")
+	c.Assert(meta.Description, gc.Equals, "baz")
+
+	_, err = charm.ReadMetaStrict(strings.NewReader(data))
+	c.Assert(err, gc.ErrorMatches, `metadata: line 1, column 1: byte order marks are not allowed`)
+
+	_, err = charm.ReadMetaStrict(strings.NewReader(data[3:]))
+	c.Assert(err, gc.ErrorMatches, `metadata: line 1, column 10: CRLF line endings are not allowed`)
+}
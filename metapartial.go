@@ -0,0 +1,249 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/juju/schema"
+)
+
+// Severity describes how serious a Diagnostic is.
+type Severity string
+
+const (
+	// SeverityError is used for problems that would cause
+	// ReadMeta to reject the metadata.
+	SeverityError Severity = "error"
+
+	// SeverityWarning is used for problems that ReadMeta
+	// tolerates, such as unknown fields.
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic describes a problem found by ParseMetaPartial.
+type Diagnostic struct {
+	Severity Severity
+
+	// Path holds the dot-separated path to the value at
+	// fault, such as "requires.db.interface", or the empty
+	// string if the problem does not relate to a particular
+	// value.
+	Path string
+
+	// Line and Column hold the 1-based position of the
+	// problem, as for ParseError. They are both zero if the
+	// position is not known; Column alone is zero if only
+	// the line is known.
+	Line   int
+	Column int
+
+	// Message describes the problem.
+	Message string
+}
+
+// ParseMetaPartial parses the charm metadata held in data as
+// ReadMeta does, but instead of stopping at the first problem it
+// reports every problem it can find as a diagnostic, sorted by
+// position. It always returns a Meta, filled in with as much as
+// could be parsed: fields that do not hold valid values are left
+// at their zero values, and relations that are not valid are
+// left out.
+//
+// ParseMetaPartial is intended for editors that validate
+// metadata.yaml as it is being written. Only metadata for which
+// it returns no diagnostics of SeverityError will be accepted by
+// ReadMeta.
+func ParseMetaPartial(data []byte) (*Meta, []Diagnostic) {
+	p := &partialParser{data: data}
+	meta := &Meta{Format: 1}
+	if raw := p.unmarshal(); raw != nil {
+		meta = parseMeta(p.coerce(raw))
+		if err := meta.Check(); err != nil {
+			p.add(SeverityError, "", err.Error())
+		}
+	}
+	sort.Stable(diagnosticsByPosition(p.diagnostics))
+	return meta, p.diagnostics
+}
+
+// partialParser holds the state of ParseMetaPartial.
+type partialParser struct {
+	data        []byte
+	diagnostics []Diagnostic
+
+	// truncated holds whether only a prefix of data
+	// could be decoded.
+	truncated bool
+}
+
+// add adds a diagnostic for the value at the given path.
+func (p *partialParser) add(severity Severity, path, message string) {
+	p.addParseError(severity, newParseError(p.data, "", path, message))
+}
+
+func (p *partialParser) addParseError(severity Severity, err *ParseError) {
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: severity,
+		Path:     err.Path,
+		Line:     err.Line,
+		Column:   err.Column,
+		Message:  err.Message,
+	})
+}
+
+// yamlErrorLine matches the line number in the messages
+// of YAML syntax errors.
+var yamlErrorLine = regexp.MustCompile(`line ([0-9]+): `)
+
+// unmarshal decodes p.data. If the document is not valid YAML,
+// it reports the syntax error and decodes the longest prefix of
+// the document, ending before the line at fault, that is valid.
+// It returns nil if nothing could be decoded.
+func (p *partialParser) unmarshal() map[interface{}]interface{} {
+	data, perr := normalizeYAML(p.data, false)
+	if perr != nil {
+		p.addParseError(SeverityError, perr)
+		return nil
+	}
+	p.data = data
+	if err := checkYAMLFeatures(p.data); err != nil {
+		p.addParseError(SeverityError, err)
+		return nil
+	}
+	raw := make(map[interface{}]interface{})
+	err := yamlUnmarshal(p.data, raw)
+	if err == nil {
+		if err := checkYAMLExpansion(p.data, raw); err != nil {
+			p.addParseError(SeverityError, err)
+			return nil
+		}
+		return raw
+	}
+	line := yamlErrorLineOf(err)
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Line:     line,
+		Message:  err.Error(),
+	})
+	lines := bytes.SplitAfter(p.data, []byte("\n"))
+	for cut := line - 1; cut > 0; cut-- {
+		raw = make(map[interface{}]interface{})
+		prefix := bytes.Join(lines[:cut], nil)
+		err := yamlUnmarshal(prefix, raw)
+		if err == nil {
+			if err := checkYAMLExpansion(prefix, raw); err != nil {
+				p.addParseError(SeverityError, err)
+				return nil
+			}
+			p.truncated = true
+			return raw
+		}
+		if errLine := yamlErrorLineOf(err); errLine > 0 && errLine <= cut {
+			cut = errLine
+		}
+	}
+	return nil
+}
+
+// yamlErrorLineOf returns the line number held in the
+// given YAML syntax error, or zero if it holds none.
+func yamlErrorLineOf(err error) int {
+	m := yamlErrorLine.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
+
+// coerce coerces each of the fields in raw separately with the
+// checkers in charmSchemaFields, so that a problem with one field
+// does not prevent the others from being parsed. The returned map
+// is suitable for passing to parseMeta.
+func (p *partialParser) coerce(raw map[interface{}]interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	for key := range raw {
+		name, ok := key.(string)
+		if !ok {
+			p.add(SeverityError, "", fmt.Sprintf("unexpected non-string field %#v", key))
+			continue
+		}
+		if charmSchemaFields[name] == nil {
+			p.add(SeverityWarning, name, fmt.Sprintf("unknown field %q", name))
+		}
+	}
+	for name, checker := range charmSchemaFields {
+		dflt, hasDefault := charmSchemaDefaults[name]
+		value, ok := raw[name]
+		if ok && value == nil && p.truncated && dflt == schema.Omit {
+			// The value was probably cut off along with
+			// the line holding the syntax error.
+			ok = false
+		}
+		if !ok {
+			if hasDefault && dflt == schema.Omit {
+				continue
+			}
+			value = dflt
+		}
+		path := []string{".", name}
+		switch name {
+		case "provides", "requires", "peers":
+			// Coerce each relation separately too.
+			rels, err := schema.StringMap(schema.Any()).Coerce(value, path)
+			if err != nil {
+				p.addParseError(SeverityError, schemaParseError(p.data, "", err))
+				continue
+			}
+			coerced := make(map[string]interface{})
+			for relName, rel := range rels.(map[string]interface{}) {
+				v, err := checker.Coerce(map[string]interface{}{relName: rel}, path)
+				if err != nil {
+					p.addParseError(SeverityError, schemaParseError(p.data, "", err))
+					continue
+				}
+				coerced[relName] = v.(map[string]interface{})[relName]
+			}
+			m[name] = coerced
+			continue
+		}
+		v, err := checker.Coerce(value, path)
+		if err != nil {
+			p.addParseError(SeverityError, schemaParseError(p.data, "", err))
+			continue
+		}
+		m[name] = v
+	}
+	// parseMeta requires these fields to be present.
+	for _, name := range []string{"name", "summary", "description"} {
+		if _, ok := m[name]; !ok {
+			m[name] = ""
+		}
+	}
+	if _, ok := m["format"]; !ok {
+		m["format"] = int64(1)
+	}
+	return m
+}
+
+// diagnosticsByPosition sorts diagnostics by position in the
+// document. Those without a position come first.
+type diagnosticsByPosition []Diagnostic
+
+func (d diagnosticsByPosition) Len() int      { return len(d) }
+func (d diagnosticsByPosition) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d diagnosticsByPosition) Less(i, j int) bool {
+	if d[i].Line != d[j].Line {
+		return d[i].Line < d[j].Line
+	}
+	if d[i].Column != d[j].Column {
+		return d[i].Column < d[j].Column
+	}
+	return d[i].Path < d[j].Path
+}
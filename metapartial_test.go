@@ -0,0 +1,136 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type MetaPartialSuite struct{}
+
+var _ = gc.Suite(&MetaPartialSuite{})
+
+func (s *MetaPartialSuite) TestValidMeta(c *gc.C) {
+	data, err := ioutil.ReadAll(repoMeta("dummy"))
+	c.Assert(err, gc.IsNil)
+	meta, diagnostics := charm.ParseMetaPartial(data)
+	c.Assert(diagnostics, gc.HasLen, 0)
+	expect, err := charm.ReadMeta(repoMeta("dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta, gc.DeepEquals, expect)
+}
+
+func (s *MetaPartialSuite) TestInvalidFields(c *gc.C) {
+	meta, diagnostics := charm.ParseMetaPartial([]byte(`
+name: foo
+summary: [bar]
+description: baz
+provides:
+  website: http
+requires:
+  db:
+    limit: 1
+  cache: memcache
+colour: blue
+`))
+	c.Assert(meta.Name, gc.Equals, "foo")
+	c.Assert(meta.Summary, gc.Equals, "")
+	c.Assert(meta.Description, gc.Equals, "baz")
+	c.Assert(meta.Format, gc.Equals, 1)
+	c.Assert(meta.Provides, gc.DeepEquals, map[string]charm.Relation{
+		"website": {
+			Name:      "website",
+			Role:      charm.RoleProvider,
+			Interface: "http",
+			Scope:     charm.ScopeGlobal,
+		},
+	})
+	c.Assert(meta.Requires, gc.DeepEquals, map[string]charm.Relation{
+		"cache": {
+			Name:      "cache",
+			Role:      charm.RoleRequirer,
+			Interface: "memcache",
+			Limit:     1,
+			Scope:     charm.ScopeGlobal,
+		},
+	})
+	c.Assert(diagnostics, gc.DeepEquals, []charm.Diagnostic{{
+		Severity: charm.SeverityError,
+		Path:     "summary",
+		Line:     3,
+		Column:   1,
+		Message:  "summary: expected string, got []interface {}([]interface {}{\"bar\"})",
+	}, {
+		Severity: charm.SeverityError,
+		Path:     "requires.db.interface",
+		Line:     8,
+		Column:   3,
+		Message:  "requires.db.interface: expected string, got nothing",
+	}, {
+		Severity: charm.SeverityWarning,
+		Path:     "colour",
+		Line:     11,
+		Column:   1,
+		Message:  `unknown field "colour"`,
+	}})
+}
+
+func (s *MetaPartialSuite) TestMissingFields(c *gc.C) {
+	meta, diagnostics := charm.ParseMetaPartial([]byte("name: foo\n"))
+	c.Assert(meta.Name, gc.Equals, "foo")
+	c.Assert(diagnostics, gc.HasLen, 2)
+	c.Assert(diagnostics[0].Path, gc.Equals, "description")
+	c.Assert(diagnostics[0].Message, gc.Equals, "description: expected string, got nothing")
+	c.Assert(diagnostics[1].Path, gc.Equals, "summary")
+	c.Assert(diagnostics[1].Message, gc.Equals, "summary: expected string, got nothing")
+}
+
+func (s *MetaPartialSuite) TestCheckFailure(c *gc.C) {
+	meta, diagnostics := charm.ParseMetaPartial([]byte(`
+name: foo
+summary: bar
+description: baz
+series: not-a-series!
+`))
+	c.Assert(meta.Series, gc.Equals, "not-a-series!")
+	c.Assert(diagnostics, gc.DeepEquals, []charm.Diagnostic{{
+		Severity: charm.SeverityError,
+		Message:  `charm "foo" declares invalid series: "not-a-series!"`,
+	}})
+}
+
+func (s *MetaPartialSuite) TestSyntaxError(c *gc.C) {
+	meta, diagnostics := charm.ParseMetaPartial([]byte(`
+name: foo
+summary: bar
+description: baz
+requires:
+  db: [mysql
+`))
+	c.Assert(meta.Name, gc.Equals, "foo")
+	c.Assert(meta.Summary, gc.Equals, "bar")
+	c.Assert(meta.Description, gc.Equals, "baz")
+	c.Assert(diagnostics, gc.HasLen, 1)
+	c.Assert(diagnostics[0].Severity, gc.Equals, charm.SeverityError)
+	c.Assert(diagnostics[0].Line, gc.Not(gc.Equals), 0)
+}
+
+func (s *MetaPartialSuite) TestAliasesRejected(c *gc.C) {
+	meta, diagnostics := charm.ParseMetaPartial([]byte(`
+name: &n foo
+summary: *n
+description: baz
+`))
+	c.Assert(meta, gc.DeepEquals, &charm.Meta{Format: 1})
+	c.Assert(diagnostics, gc.DeepEquals, []charm.Diagnostic{{
+		Severity: charm.SeverityError,
+		Line:     2,
+		Column:   7,
+		Message:  "YAML anchors are not allowed",
+	}})
+}
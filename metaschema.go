@@ -0,0 +1,295 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+// MetaField describes a field that may be specified in a
+// charm's metadata.yaml file.
+type MetaField struct {
+	// Name holds the name of the field as it appears in
+	// metadata.yaml.
+	Name string
+
+	// Type describes the type of the field's value; one of
+	// "string", "int", "bool", "list" or "map".
+	Type string
+
+	// Elem describes the type of the elements of a "list"
+	// field or the values of a "map" field, such as "string"
+	// or "relation". Map keys are always strings.
+	Elem string `json:",omitempty"`
+
+	// Required holds whether the field must be specified.
+	Required bool
+
+	// SinceFormat holds the first metadata format in which
+	// the field is accepted.
+	SinceFormat int
+
+	// Deprecated holds whether the field is obsolete and
+	// should not be used in new charms.
+	Deprecated bool `json:",omitempty"`
+
+	// Description describes the meaning of the field.
+	Description string
+
+	// Fields describes the fields of the values of a "map"
+	// field whose values are themselves maps.
+	Fields []MetaField `json:",omitempty"`
+}
+
+// MetaSchema returns a description of every field accepted in
+// a charm's metadata.yaml file, in the order in which they are
+// conventionally written. It is intended for tools, such as
+// editors, that help authors write metadata.
+func MetaSchema() []MetaField {
+	return copyMetaFields(metaFields)
+}
+
+func copyMetaFields(fields []MetaField) []MetaField {
+	if fields == nil {
+		return nil
+	}
+	result := make([]MetaField, len(fields))
+	for i, f := range fields {
+		f.Fields = copyMetaFields(f.Fields)
+		result[i] = f
+	}
+	return result
+}
+
+// relationFields describes the fields of a relation
+// in the provides, requires and peers sections.
+var relationFields = []MetaField{{
+	Name:        "interface",
+	Type:        "string",
+	Required:    true,
+	SinceFormat: 1,
+	Description: `The name of the interface implemented by the relation, optionally followed by "@" and a version, as in "mysql@2". A relation may be specified by its interface name alone rather than by a map.`,
+}, {
+	Name:        "limit",
+	Type:        "int",
+	SinceFormat: 1,
+	Description: "The maximum number of relations of this kind that may be established.",
+}, {
+	Name:        "optional",
+	Type:        "bool",
+	SinceFormat: 1,
+	Description: "Whether the charm can function without the relation.",
+}, {
+	Name:        "scope",
+	Type:        "string",
+	SinceFormat: 1,
+	Description: `The scope of the relation; either "global" (the default) or "container".`,
+}, {
+	Name:        "schema",
+	Type:        "map",
+	SinceFormat: 1,
+	Description: `The data that units are expected to set on the relation. Each key maps to its type, one of "string", "int", "float" or "boolean", or to a map holding its type, description and whether it is required.`,
+}}
+
+// hookPolicyFields describes the fields of a hook
+// policy in the hooks section.
+var hookPolicyFields = []MetaField{{
+	Name:        "timeout",
+	Type:        "string",
+	SinceFormat: 1,
+	Description: `The time the hook may run before it is killed, such as "5m".`,
+}, {
+	Name:        "retry",
+	Type:        "map",
+	SinceFormat: 1,
+	Description: `How the hook is retried when it fails: the number of attempts, and the initial and maximum delay between them, as in {attempts: 3, delay: 10s, max-delay: 1m}.`,
+}}
+
+// probeFields describes the fields of a probe
+// in the probes section.
+var probeFields = []MetaField{{
+	Name:        "kind",
+	Type:        "string",
+	Required:    true,
+	SinceFormat: 1,
+	Description: `The kind of the probe; either "readiness" or "liveness".`,
+}, {
+	Name:        "interval",
+	Type:        "string",
+	SinceFormat: 1,
+	Description: `The time between runs of the probe, such as "30s".`,
+}, {
+	Name:        "timeout",
+	Type:        "string",
+	SinceFormat: 1,
+	Description: `The time the probe may run before it is deemed to have failed, such as "5s".`,
+}}
+
+// storageFields describes the fields of a store
+// in the storage section.
+var storageFields = []MetaField{{
+	Name:        "type",
+	Type:        "string",
+	Required:    true,
+	SinceFormat: 1,
+	Description: `The type of the store; either "block" or "filesystem".`,
+}, {
+	Name:        "description",
+	Type:        "string",
+	SinceFormat: 1,
+	Description: "A description of what the store is used for.",
+}, {
+	Name:        "location",
+	Type:        "string",
+	SinceFormat: 1,
+	Description: "The path at which a filesystem store is mounted.",
+}, {
+	Name:        "shared",
+	Type:        "bool",
+	SinceFormat: 1,
+	Description: "Whether the store is shared by all units of the service.",
+}, {
+	Name:        "read-only",
+	Type:        "bool",
+	SinceFormat: 1,
+	Description: "Whether the store is mounted read-only.",
+}, {
+	Name:        "multiple",
+	Type:        "map",
+	SinceFormat: 1,
+	Description: `The number of instances of the store each unit may have, as a range such as "1-3" or "2+", held in the range field.`,
+}, {
+	Name:        "minimum-size",
+	Type:        "string",
+	SinceFormat: 1,
+	Description: `The minimum size of the store, in megabytes or with a suffix such as "10G".`,
+}}
+
+// metaFields must be kept in sync with charmSchema.
+var metaFields = []MetaField{{
+	Name:        "name",
+	Type:        "string",
+	Required:    true,
+	SinceFormat: 1,
+	Description: "The name of the charm.",
+}, {
+	Name:        "summary",
+	Type:        "string",
+	Required:    true,
+	SinceFormat: 1,
+	Description: "A one-line summary of what the charm does.",
+}, {
+	Name:        "description",
+	Type:        "string",
+	Required:    true,
+	SinceFormat: 1,
+	Description: "A longer description of the charm. It may instead be a map from language tags, such as \"en\" or \"pt-BR\", to translations of the description.",
+}, {
+	Name:        "format",
+	Type:        "int",
+	SinceFormat: 1,
+	Description: "The format of the metadata. Defaults to 1.",
+}, {
+	Name:        "subordinate",
+	Type:        "bool",
+	SinceFormat: 1,
+	Description: "Whether the charm is a subordinate, deployed alongside a principal service.",
+}, {
+	Name:        "provides",
+	Type:        "map",
+	Elem:        "relation",
+	SinceFormat: 1,
+	Description: "The relations provided by the charm, indexed by relation name.",
+	Fields:      relationFields,
+}, {
+	Name:        "requires",
+	Type:        "map",
+	Elem:        "relation",
+	SinceFormat: 1,
+	Description: "The relations required by the charm, indexed by relation name.",
+	Fields:      relationFields,
+}, {
+	Name:        "peers",
+	Type:        "map",
+	Elem:        "relation",
+	SinceFormat: 1,
+	Description: "The peer relations of the charm, indexed by relation name.",
+	Fields:      relationFields,
+}, {
+	Name:        "categories",
+	Type:        "list",
+	Elem:        "string",
+	SinceFormat: 1,
+	Deprecated:  true,
+	Description: "Categories of the charm. Superseded by tags.",
+}, {
+	Name:        "tags",
+	Type:        "list",
+	Elem:        "string",
+	SinceFormat: 1,
+	Description: "Tags used to categorize the charm.",
+}, {
+	Name:        "series",
+	Type:        "string",
+	SinceFormat: 1,
+	Description: "The series the charm is intended for. Superseded by bases: a charm declaring both must declare a base corresponding to its series.",
+}, {
+	Name:        "version",
+	Type:        "string",
+	SinceFormat: 1,
+	Description: `The semantic version the charm is published as, such as "2.0.0-rc1". Charms are still ordered by their revision.`,
+}, {
+	Name:        "bases",
+	Type:        "list",
+	Elem:        "base",
+	SinceFormat: 1,
+	Description: `The bases the charm can run on, such as "ubuntu@14.04/amd64", or maps holding the name and channel of the operating system and its supported architectures. Supersedes series.`,
+}, {
+	Name:        "platforms",
+	Type:        "list",
+	Elem:        "base",
+	SinceFormat: 1,
+	Description: "An alternative spelling of bases.",
+}, {
+	Name:        "assumes",
+	Type:        "list",
+	Elem:        "assumes",
+	SinceFormat: 1,
+	Description: `The features, such as hook tools, that the charm assumes are available. Each entry is a feature name or a map holding an "any-of" or "all-of" list of entries.`,
+}, {
+	Name:        "exposed-ports",
+	Type:        "list",
+	Elem:        "port-range",
+	SinceFormat: 1,
+	Description: `The ports the charm's workload listens on, such as "80/tcp" or "8000-8080/udp", or maps holding the port, protocol and purpose.`,
+}, {
+	Name:        "networking",
+	Type:        "list",
+	Elem:        "port-range",
+	SinceFormat: 1,
+	Description: "An alternative spelling of exposed-ports.",
+}, {
+	Name:        "hooks",
+	Type:        "map",
+	Elem:        "hook-policy",
+	SinceFormat: 1,
+	Description: "The timeouts and retry policies of the charm's hooks, indexed by hook name.",
+	Fields:      hookPolicyFields,
+}, {
+	Name:        "probes",
+	Type:        "map",
+	Elem:        "probe",
+	SinceFormat: 1,
+	Description: "The readiness and liveness probes provided by the charm, indexed by probe name.",
+	Fields:      probeFields,
+}, {
+	Name:        "storage",
+	Type:        "map",
+	Elem:        "storage",
+	SinceFormat: 1,
+	Description: "The stores required by the charm, indexed by store name.",
+	Fields:      storageFields,
+}, {
+	Name:        "revision",
+	Type:        "int",
+	SinceFormat: 1,
+	Deprecated:  true,
+	Description: "The charm revision. Superseded by the revision file.",
+}}
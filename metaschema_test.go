@@ -0,0 +1,114 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"sort"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type MetaSchemaSuite struct{}
+
+var _ = gc.Suite(&MetaSchemaSuite{})
+
+func (s *MetaSchemaSuite) TestFieldNames(c *gc.C) {
+	var names []string
+	for _, f := range charm.MetaSchema() {
+		names = append(names, f.Name)
+	}
+	c.Assert(names, gc.DeepEquals, []string{
+		"name",
+		"summary",
+		"description",
+		"format",
+		"subordinate",
+		"provides",
+		"requires",
+		"peers",
+		"categories",
+		"tags",
+		"series",
+		"version",
+		"bases",
+		"platforms",
+		"assumes",
+		"exposed-ports",
+		"networking",
+		"hooks",
+		"probes",
+		"storage",
+		"revision",
+	})
+}
+
+func (s *MetaSchemaSuite) TestFieldsMatchSchema(c *gc.C) {
+	var names []string
+	for _, f := range charm.MetaSchema() {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	schemaNames := charm.MetaSchemaFieldNames()
+	sort.Strings(schemaNames)
+	c.Assert(names, gc.DeepEquals, schemaNames)
+}
+
+func (s *MetaSchemaSuite) TestRequiredFields(c *gc.C) {
+	full := map[string]interface{}{
+		"name":        "foo",
+		"summary":     "bar",
+		"description": "baz",
+	}
+	for _, f := range charm.MetaSchema() {
+		if !f.Required {
+			_, ok := full[f.Name]
+			c.Check(ok, gc.Equals, false, gc.Commentf("field %q", f.Name))
+			continue
+		}
+		m := make(map[string]interface{})
+		for name, value := range full {
+			if name != f.Name {
+				m[name] = value
+			}
+		}
+		data, err := yaml.Marshal(m)
+		c.Assert(err, gc.IsNil)
+		_, err = charm.ReadMeta(strings.NewReader(string(data)))
+		c.Check(err, gc.ErrorMatches, ".*"+f.Name+": expected string, got nothing", gc.Commentf("field %q", f.Name))
+	}
+}
+
+func (s *MetaSchemaSuite) TestRelationFields(c *gc.C) {
+	for _, f := range charm.MetaSchema() {
+		if f.Type != "map" || f.Elem == "" {
+			c.Check(f.Fields, gc.HasLen, 0)
+			continue
+		}
+		if f.Elem == "relation" {
+			c.Check(f.Fields, gc.HasLen, 5)
+		} else {
+			c.Check(f.Fields, gc.Not(gc.HasLen), 0)
+		}
+	}
+}
+
+func (s *MetaSchemaSuite) TestResultIsCopy(c *gc.C) {
+	fields := charm.MetaSchema()
+	fields[0].Name = "changed"
+	for i := range fields {
+		if fields[i].Fields != nil {
+			fields[i].Fields[0].Name = "changed"
+		}
+	}
+	for _, f := range charm.MetaSchema() {
+		c.Assert(f.Name, gc.Not(gc.Equals), "changed")
+		for _, rf := range f.Fields {
+			c.Assert(rf.Name, gc.Not(gc.Equals), "changed")
+		}
+	}
+}
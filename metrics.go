@@ -6,10 +6,7 @@ package charm
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"strconv"
-
-	goyaml "gopkg.in/yaml.v1"
 )
 
 // MetricType is used to identify metric types supported by juju.
@@ -50,12 +47,13 @@ type Metrics struct {
 
 // ReadMetrics reads a MetricsDeclaration in YAML format.
 func ReadMetrics(r io.Reader) (*Metrics, error) {
-	data, err := ioutil.ReadAll(r)
+	data, release, err := readYAMLSource(r)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	var metrics Metrics
-	if err := goyaml.Unmarshal(data, &metrics); err != nil {
+	if err := yamlUnmarshal(data, &metrics); err != nil {
 		return nil, err
 	}
 	if metrics.Metrics == nil {
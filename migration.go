@@ -0,0 +1,285 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The kinds of issue reported by CheckMigration.
+const (
+	// MigrationSeries is the kind of issues found when the charm
+	// does not declare support for the target base.
+	MigrationSeries = "series"
+
+	// MigrationInterpreter is the kind of issues found when a hook
+	// is run by an interpreter not installed by default on the
+	// target base.
+	MigrationInterpreter = "interpreter"
+
+	// MigrationPackageManager is the kind of issues found when a
+	// hook uses a package manager not provided by the target base.
+	MigrationPackageManager = "package-manager"
+)
+
+// MigrationIssue describes a likely incompatibility between a charm
+// and the base it is to be migrated to.
+type MigrationIssue struct {
+	// Kind holds the kind of the issue, such as MigrationSeries.
+	Kind string
+
+	// Path holds the slash-separated path of the file in
+	// which the issue was found, or the empty string if it
+	// was found in the charm's metadata.
+	Path string
+
+	// Line holds the number, starting at 1, of the line in
+	// which the issue was found, or 0 if it applies to the
+	// whole file.
+	Line int
+
+	// Message describes the issue.
+	Message string
+}
+
+// String returns the issue in the form "path:line: message",
+// leaving out the parts that are not set.
+func (issue MigrationIssue) String() string {
+	switch {
+	case issue.Path == "":
+		return issue.Message
+	case issue.Line == 0:
+		return issue.Path + ": " + issue.Message
+	}
+	return fmt.Sprintf("%s:%d: %s", issue.Path, issue.Line, issue.Message)
+}
+
+// interpreterRange holds the channels of an operating system
+// on which an interpreter is installed by default. An empty
+// bound leaves the range open at that end.
+type interpreterRange struct {
+	interpreter string
+	from, until string
+}
+
+// defaultInterpreters holds, for each operating system, the
+// interpreters installed by default on its cloud images.
+var defaultInterpreters = map[string][]interpreterRange{
+	"ubuntu": {
+		{"sh", "", ""},
+		{"bash", "", ""},
+		{"dash", "", ""},
+		{"perl", "", ""},
+		{"python", "", "18.04"},
+		{"python2", "", "18.04"},
+		{"python2.7", "12.04", "18.04"},
+		{"python3", "", ""},
+	},
+	"centos": {
+		{"sh", "", ""},
+		{"bash", "", ""},
+		{"python", "", "7"},
+		{"python2", "", "7"},
+	},
+}
+
+// packageManagers holds the package managers recognized in hooks,
+// with the operating systems that provide them. Commands run from
+// shell scripts are recognized, as are the names of the commands and
+// of the charmhelpers functions in Python scripts.
+var packageManagers = []struct {
+	name    string
+	pattern *regexp.Regexp
+	os      []string
+}{{
+	name:    "apt",
+	pattern: regexp.MustCompile(`(^|[^\w-])(apt-get|apt-cache|dpkg|add-apt-repository|apt +(install|update|upgrade|remove|purge)|apt_(install|update|upgrade|purge))([^\w-]|$)`),
+	os:      []string{"ubuntu", "debian"},
+}, {
+	name:    "yum",
+	pattern: regexp.MustCompile(`(^|[^\w-])(yum|dnf|rpm|yum_(install|update|upgrade|purge))([^\w-]|$)`),
+	os:      []string{"centos", "rhel", "fedora"},
+}, {
+	name:    "zypper",
+	pattern: regexp.MustCompile(`(^|[^\w-])zypper([^\w-]|$)`),
+	os:      []string{"opensuse", "sles"},
+}}
+
+// CheckMigration reports the likely incompatibilities between the
+// given charm, which must be a *CharmDir or a *CharmArchive, and the
+// target it is to be migrated to, given as a base such as
+// "ubuntu@14.04" or as an Ubuntu series such as "trusty". It is meant
+// to help sift through many charms when moving deployments to a new
+// series, so the checks are heuristic:
+//
+// - the charm should declare support for the target in its series or
+// bases fields, if it declares any;
+//
+// - the interpreters named in the shebang lines of its hooks and
+// dispatch script should be installed by default on the target;
+//
+// - those scripts should not use the package managers of other
+// operating systems, as recognized by simple patterns. Comment
+// lines are ignored.
+//
+// The issues are returned with those found in the metadata first,
+// followed by those found in files, in order of path and line.
+func CheckMigration(ch Charm, target string) ([]MigrationIssue, error) {
+	base, err := parseMigrationTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	issues := checkMigrationBases(ch.Meta(), base)
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	var fileIssues []MigrationIssue
+	for _, fh := range zipr.File {
+		isHook := path.Dir(fh.Name) == HooksDir
+		if !isHook && fh.Name != DispatchFile || !fh.Mode().IsRegular() {
+			continue
+		}
+		data, err := readZipFile(fh)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %q: %v", fh.Name, err)
+		}
+		fileIssues = append(fileIssues, checkMigrationScript(fh.Name, data, base)...)
+	}
+	sort.Stable(migrationIssuesByPath(fileIssues))
+	return append(issues, fileIssues...), nil
+}
+
+// parseMigrationTarget returns the base
+// identified by the given target.
+func parseMigrationTarget(target string) (Base, error) {
+	if strings.Contains(target, "@") {
+		return ParseBase(target)
+	}
+	return SeriesBase(target)
+}
+
+// checkMigrationBases checks that the given metadata
+// declares support for the target base, if it declares
+// support for any base.
+func checkMigrationBases(meta *Meta, target Base) []MigrationIssue {
+	bases := meta.AllBases()
+	if len(bases) == 0 {
+		// The charm declares no series, or one that is
+		// not known to this package.
+		if meta.Series != "" && meta.Series != target.Series() {
+			return []MigrationIssue{{
+				Kind:    MigrationSeries,
+				Message: fmt.Sprintf("charm declares series %q, not %s", meta.Series, target),
+			}}
+		}
+		return nil
+	}
+	var declared []string
+	for _, b := range bases {
+		if b.OS == target.OS && b.Channel == target.Channel && (b.Arch == "" || target.Arch == "" || b.Arch == target.Arch) {
+			return nil
+		}
+		declared = append(declared, b.String())
+	}
+	return []MigrationIssue{{
+		Kind:    MigrationSeries,
+		Message: fmt.Sprintf("charm does not declare support for %s (declared: %s)", target, strings.Join(declared, ", ")),
+	}}
+}
+
+// checkMigrationScript checks the script with the given
+// name, holding the given data, for use on the target base.
+func checkMigrationScript(name string, data []byte, target Base) []MigrationIssue {
+	var issues []MigrationIssue
+	reported := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if n == 1 {
+			if interpreter := shebangInterpreter(line); interpreter != "" && !hasDefaultInterpreter(target, interpreter) {
+				issues = append(issues, MigrationIssue{
+					Kind:    MigrationInterpreter,
+					Path:    name,
+					Line:    n,
+					Message: fmt.Sprintf("interpreter %q is not installed by default on %s", interpreter, target),
+				})
+			}
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, pm := range packageManagers {
+			if reported[pm.name] || !pm.pattern.MatchString(line) || !knownPackageManagerOS(target.OS) || containsString(pm.os, target.OS) {
+				continue
+			}
+			reported[pm.name] = true
+			issues = append(issues, MigrationIssue{
+				Kind:    MigrationPackageManager,
+				Path:    name,
+				Line:    n,
+				Message: fmt.Sprintf("uses the %s package manager, which %s does not provide", pm.name, target.OS),
+			})
+		}
+	}
+	return issues
+}
+
+// hasDefaultInterpreter reports whether the given interpreter
+// is installed by default on the given base. Interpreters not
+// known for its operating system are assumed to be missing.
+func hasDefaultInterpreter(b Base, interpreter string) bool {
+	for _, r := range defaultInterpreters[b.OS] {
+		if r.interpreter != interpreter {
+			continue
+		}
+		if r.from != "" && compareChannels(b.Channel, r.from) < 0 {
+			return false
+		}
+		if r.until != "" && compareChannels(b.Channel, r.until) > 0 {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// knownPackageManagerOS reports whether the package manager
+// of the given operating system is known, so that the use
+// of other package managers can be reported.
+func knownPackageManagerOS(os string) bool {
+	for _, pm := range packageManagers {
+		if containsString(pm.os, os) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type migrationIssuesByPath []MigrationIssue
+
+func (s migrationIssuesByPath) Len() int      { return len(s) }
+func (s migrationIssuesByPath) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s migrationIssuesByPath) Less(i, j int) bool {
+	if s[i].Path != s[j].Path {
+		return s[i].Path < s[j].Path
+	}
+	return s[i].Line < s[j].Line
+}
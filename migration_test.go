@@ -0,0 +1,110 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type MigrationSuite struct{}
+
+var _ = gc.Suite(&MigrationSuite{})
+
+func (s *MigrationSuite) TestCheckMigrationNoIssues(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	issues, err := charm.CheckMigration(dir, "trusty")
+	c.Assert(err, gc.IsNil)
+	c.Assert(issues, gc.HasLen, 0)
+}
+
+func (s *MigrationSuite) TestCheckMigration(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	meta := *dir.Meta()
+	meta.Series = "precise"
+	dir.SetMeta(&meta)
+	writeCharmFile(c, dir.Path, "hooks/install", `#!/usr/bin/env python
+# apt-get is only mentioned in this comment.
+from charmhelpers.fetch import apt_install
+apt_install(["nginx"])
+`, 0755)
+	writeCharmFile(c, dir.Path, "hooks/start", `#!/bin/sh
+sudo yum install -y nginx
+rpm -q nginx
+`, 0755)
+	writeCharmFile(c, dir.Path, "hooks/stop", "#!/usr/bin/ruby\n", 0755)
+	writeCharmFile(c, dir.Path, "hooks/lib/helpers.sh", "apt-get update\n", 0644)
+	writeCharmFile(c, dir.Path, "dispatch", "#!/bin/bash\napt install -y nginx\n", 0755)
+
+	issues, err := charm.CheckMigration(dir, "ubuntu@20.04")
+	c.Assert(err, gc.IsNil)
+	c.Assert(issues, jc.DeepEquals, []charm.MigrationIssue{{
+		Kind:    charm.MigrationSeries,
+		Message: `charm does not declare support for ubuntu@20.04 (declared: ubuntu@12.04)`,
+	}, {
+		Kind:    charm.MigrationInterpreter,
+		Path:    "hooks/install",
+		Line:    1,
+		Message: `interpreter "python" is not installed by default on ubuntu@20.04`,
+	}, {
+		Kind:    charm.MigrationPackageManager,
+		Path:    "hooks/start",
+		Line:    2,
+		Message: `uses the yum package manager, which ubuntu does not provide`,
+	}, {
+		Kind:    charm.MigrationInterpreter,
+		Path:    "hooks/stop",
+		Line:    1,
+		Message: `interpreter "ruby" is not installed by default on ubuntu@20.04`,
+	}})
+	c.Assert(issues[2].String(), gc.Equals, "hooks/start:2: uses the yum package manager, which ubuntu does not provide")
+	c.Assert(issues[0].String(), gc.Equals, "charm does not declare support for ubuntu@20.04 (declared: ubuntu@12.04)")
+
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+	archive := archiveDir(c, dir.Path)
+	issues, err = charm.CheckMigration(archive, "centos@7/amd64")
+	c.Assert(err, gc.IsNil)
+	var found []string
+	for _, issue := range issues {
+		found = append(found, issue.String())
+	}
+	c.Assert(found, jc.DeepEquals, []string{
+		"charm does not declare support for centos@7/amd64 (declared: ubuntu@12.04)",
+		"dispatch:2: uses the apt package manager, which centos does not provide",
+		"hooks/install:3: uses the apt package manager, which centos does not provide",
+		`hooks/stop:1: interpreter "ruby" is not installed by default on centos@7/amd64`,
+	})
+}
+
+func (s *MigrationSuite) TestCheckMigrationBases(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	dir.Meta().Bases = []charm.Base{
+		charm.MustParseBase("ubuntu@14.04/amd64"),
+		charm.MustParseBase("ubuntu@14.10"),
+	}
+	issues, err := charm.CheckMigration(dir, "ubuntu@14.04")
+	c.Assert(err, gc.IsNil)
+	c.Assert(issues, gc.HasLen, 0)
+	issues, err = charm.CheckMigration(dir, "utopic")
+	c.Assert(err, gc.IsNil)
+	c.Assert(issues, gc.HasLen, 0)
+	issues, err = charm.CheckMigration(dir, "ubuntu@14.04/arm64")
+	c.Assert(err, gc.IsNil)
+	c.Assert(issues, jc.DeepEquals, []charm.MigrationIssue{{
+		Kind:    charm.MigrationSeries,
+		Message: "charm does not declare support for ubuntu@14.04/arm64 (declared: ubuntu@14.04/amd64, ubuntu@14.10)",
+	}})
+}
+
+func (s *MigrationSuite) TestCheckMigrationInvalidTarget(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	_, err := charm.CheckMigration(dir, "bionic")
+	c.Assert(err, gc.ErrorMatches, `unknown series "bionic"`)
+	_, err = charm.CheckMigration(dir, "ubuntu@")
+	c.Assert(err, gc.ErrorMatches, `invalid base "ubuntu@": invalid channel ""`)
+}
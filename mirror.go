@@ -0,0 +1,301 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/juju/utils"
+)
+
+// mirrorIndexFile holds the name of the file, at the root of a
+// local repository, that indexes the charms mirrored into it.
+const mirrorIndexFile = "mirror-index.json"
+
+// partialSuffix is added to the names of archives
+// whose download has not completed.
+const partialSuffix = ".partial"
+
+// MirrorParams holds parameters for Mirror.
+type MirrorParams struct {
+	// Store holds the charm store to mirror charms from.
+	Store *CharmStore
+
+	// Dest holds the repository to mirror charms into.
+	// Its directory is created if necessary.
+	Dest *LocalRepository
+
+	// Concurrency holds the maximum number of charms to
+	// download at once. If it is zero, one is used.
+	Concurrency int
+}
+
+// MirrorResult holds the outcome of mirroring a charm.
+type MirrorResult struct {
+	// URL holds the URL of the charm in the store, with
+	// the revision that was mirrored, if known.
+	URL *URL
+
+	// Path holds the path of the charm archive in the
+	// local repository.
+	Path string
+
+	// Skipped holds whether the charm was already present in
+	// the local repository, so that nothing was downloaded.
+	Skipped bool
+
+	// Err holds any error encountered when mirroring the charm.
+	Err error
+}
+
+// MirrorIndex indexes the charms mirrored into a local repository,
+// keyed by their charm store URL.
+type MirrorIndex map[string]MirrorIndexEntry
+
+// MirrorIndexEntry describes a charm mirrored into a local repository.
+type MirrorIndexEntry struct {
+	// Path holds the slash-separated path of the charm archive,
+	// relative to the root of the repository.
+	Path string `json:"path"`
+
+	// Digest holds the digest the archive was verified against:
+	// the one made with the strongest algorithm the store provided.
+	Digest Digest `json:"digest"`
+}
+
+// Mirror downloads the charms with the given URLs from the store into
+// the local repository, so that they can be deployed without access
+// to the store. Each charm is saved as an archive named after the
+// charm and its revision in the directory for its series, where it
+// can be found by Get with the corresponding local URL. A charm URL
+// without a revision refers to the latest revision in the store.
+//
+// Each downloaded archive is verified against the digest held by
+// the store, and checked to be a charm with the expected name. Charms
+// already present with the correct digest are not downloaded again,
+// and an interrupted download is resumed where it left off when
+// Mirror is next called. Once the charms have been mirrored, they are
+// recorded in the repository's index, which can be read with
+// ReadMirrorIndex.
+//
+// The returned results correspond to the given URLs. An error is
+// returned only if the store or the repository cannot be accessed.
+func Mirror(p MirrorParams, curls ...*URL) ([]MirrorResult, error) {
+	concurrency := p.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	locations := make([]Location, len(curls))
+	for i, curl := range curls {
+		locations[i] = curl
+	}
+	infos, err := p.Store.Info(locations...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot mirror charms: %v", err)
+	}
+	if err := os.MkdirAll(p.Dest.Path, 0755); err != nil {
+		return nil, fmt.Errorf("cannot mirror charms: %v", err)
+	}
+	results := make([]MirrorResult, len(curls))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range curls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := p.Store.context().Err(); err != nil {
+				results[i] = MirrorResult{URL: curls[i], Err: err}
+				return
+			}
+			results[i] = p.mirror(curls[i], infos[i])
+		}(i)
+	}
+	wg.Wait()
+
+	index, err := ReadMirrorIndex(p.Dest.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot mirror charms: %v", err)
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(p.Dest.Path, result.Path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot mirror charms: %v", err)
+		}
+		index[result.URL.String()] = MirrorIndexEntry{
+			Path:   filepath.ToSlash(rel),
+			Digest: infos[i].ArchiveDigest(),
+		}
+	}
+	if err := writeMirrorIndex(p.Dest.Path, index); err != nil {
+		return nil, fmt.Errorf("cannot mirror charms: %v", err)
+	}
+	return results, nil
+}
+
+// mirror mirrors a single charm, given its details from the store.
+func (p MirrorParams) mirror(curl *URL, info *InfoResponse) MirrorResult {
+	if len(info.Errors) > 0 {
+		return MirrorResult{
+			URL: curl,
+			Err: fmt.Errorf("cannot get %q: %s", curl, strings.Join(info.Errors, "; ")),
+		}
+	}
+	if curl.Revision == -1 {
+		curl = curl.WithRevision(info.Revision)
+	} else if curl.Revision != info.Revision {
+		return MirrorResult{
+			URL: curl,
+			Err: fmt.Errorf("store returned charm with wrong revision %d for %q", info.Revision, curl),
+		}
+	}
+	result := MirrorResult{
+		URL:  curl,
+		Path: filepath.Join(p.Dest.Path, curl.Series, fmt.Sprintf("%s-%d.charm", curl.Name, curl.Revision)),
+	}
+	digest := info.ArchiveDigest()
+	if verify(result.Path, digest) == nil {
+		result.Skipped = true
+		return result
+	}
+	if err := os.MkdirAll(filepath.Dir(result.Path), 0755); err != nil {
+		result.Err = err
+		return result
+	}
+	if err := p.download(curl, result.Path, digest); err != nil {
+		result.Err = fmt.Errorf("cannot mirror %q: %v", curl, err)
+	}
+	return result
+}
+
+// download downloads the archive of the given charm to path,
+// resuming any previous partial download.
+func (p MirrorParams) download(curl *URL, path string, digest Digest) error {
+	partial := path + partialSuffix
+	err := p.fetch(curl, partial, true)
+	if err == nil {
+		err = verify(partial, digest)
+		if err != nil {
+			// The partial download may have been corrupt,
+			// so try again from the start.
+			logEvent("fetch", EventRetry, partial, "url", curl.String(), "error", err.Error())
+			err = p.fetch(curl, partial, false)
+			if err == nil {
+				err = verify(partial, digest)
+			}
+		}
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	ch, err := ReadCharmArchive(partial)
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if ch.Meta().Name != curl.Name {
+		os.Remove(partial)
+		return fmt.Errorf("store returned charm %q", ch.Meta().Name)
+	}
+	return utils.ReplaceFile(partial, path)
+}
+
+// fetch downloads the archive of the given charm to path. If resume
+// is true and path already exists, only the remainder of the archive
+// is requested.
+func (p MirrorParams) fetch(curl *URL, path string, resume bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	var offset int64
+	if resume {
+		if info, err := os.Stat(path); err == nil {
+			offset = info.Size()
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+	}
+	req, err := http.NewRequest("GET", p.Store.archiveURL(curl), nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := p.Store.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The store ignored the range, so start again.
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial download is already complete,
+		// or longer than the archive; leave it to be
+		// verified.
+		return nil
+	default:
+		return fmt.Errorf("cannot download charm: %s", resp.Status)
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadMirrorIndex returns the index of the charms mirrored into the
+// local repository at the given path. It returns an empty index if
+// no charms have been mirrored into it.
+func ReadMirrorIndex(repoPath string) (MirrorIndex, error) {
+	data, err := ioutil.ReadFile(filepath.Join(repoPath, mirrorIndexFile))
+	if os.IsNotExist(err) {
+		return make(MirrorIndex), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := make(MirrorIndex)
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid mirror index: %v", err)
+	}
+	return index, nil
+}
+
+func writeMirrorIndex(repoPath string, index MirrorIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(repoPath, "mirror-index")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return utils.ReplaceFile(f.Name(), filepath.Join(repoPath, mirrorIndexFile))
+}
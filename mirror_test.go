@@ -0,0 +1,209 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type MirrorSuite struct {
+	gitjujutesting.FakeHomeSuite
+	server *charmtesting.MockStore
+	params charm.MirrorParams
+}
+
+var _ = gc.Suite(&MirrorSuite{})
+
+func (s *MirrorSuite) SetUpSuite(c *gc.C) {
+	s.FakeHomeSuite.SetUpSuite(c)
+	// The store serves the dummy charm, whose revision
+	// is 1, for every URL.
+	s.server = charmtesting.NewMockStore(c, map[string]int{
+		"cs:series/dummy":     1,
+		"cs:trusty/dummy":     1,
+		"cs:series/wordpress": 2,
+	})
+}
+
+func (s *MirrorSuite) SetUpTest(c *gc.C) {
+	s.FakeHomeSuite.SetUpTest(c)
+	s.PatchValue(&charm.CacheDir, c.MkDir())
+	s.server.Downloads = nil
+	s.server.DownloadsNoStats = nil
+	s.params = charm.MirrorParams{
+		Store:       charm.NewStore(s.server.Address()),
+		Dest:        &charm.LocalRepository{Path: filepath.Join(c.MkDir(), "repo")},
+		Concurrency: 2,
+	}
+}
+
+func (s *MirrorSuite) TearDownSuite(c *gc.C) {
+	s.server.Close()
+	s.FakeHomeSuite.TearDownSuite(c)
+}
+
+func (s *MirrorSuite) archivePath(series, name string) string {
+	return filepath.Join(s.params.Dest.Path, series, name)
+}
+
+func (s *MirrorSuite) TestMirror(c *gc.C) {
+	results, err := charm.Mirror(s.params,
+		charm.MustParseURL("cs:series/dummy"),
+		charm.MustParseURL("cs:trusty/dummy-1"),
+	)
+	c.Assert(err, gc.IsNil)
+	c.Assert(results, jc.DeepEquals, []charm.MirrorResult{{
+		URL:  charm.MustParseURL("cs:series/dummy-1"),
+		Path: s.archivePath("series", "dummy-1.charm"),
+	}, {
+		URL:  charm.MustParseURL("cs:trusty/dummy-1"),
+		Path: s.archivePath("trusty", "dummy-1.charm"),
+	}})
+	c.Assert(s.server.DownloadsNoStats, gc.HasLen, 0)
+	c.Assert(s.server.Downloads, gc.HasLen, 2)
+
+	// The mirrored charms can be found in the local repository.
+	ch, err := s.params.Dest.Get(charm.MustParseURL("local:series/dummy-1"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch.Meta().Name, gc.Equals, "dummy")
+	_, err = s.params.Dest.Get(charm.MustParseURL("local:trusty/dummy-1"))
+	c.Assert(err, gc.IsNil)
+
+	index, err := charm.ReadMirrorIndex(s.params.Dest.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(index, gc.HasLen, 2)
+	entry := index["cs:series/dummy-1"]
+	c.Assert(entry.Path, gc.Equals, "series/dummy-1.charm")
+	c.Assert(entry.Digest.Algorithm, gc.Equals, charm.SHA256)
+	c.Assert(verifyFileDigest(c, s.archivePath("series", "dummy-1.charm"), entry.Digest), gc.IsNil)
+	c.Assert(index["cs:trusty/dummy-1"].Path, gc.Equals, "trusty/dummy-1.charm")
+}
+
+func (s *MirrorSuite) TestMirrorIndexRecordsSha384(c *gc.C) {
+	s.PatchValue(&s.server.ServeSha384, true)
+	_, err := charm.Mirror(s.params, charm.MustParseURL("cs:series/dummy"))
+	c.Assert(err, gc.IsNil)
+	index, err := charm.ReadMirrorIndex(s.params.Dest.Path)
+	c.Assert(err, gc.IsNil)
+	entry := index["cs:series/dummy-1"]
+	c.Assert(entry.Digest.Algorithm, gc.Equals, charm.SHA384)
+	c.Assert(verifyFileDigest(c, s.archivePath("series", "dummy-1.charm"), entry.Digest), gc.IsNil)
+}
+
+// verifyFileDigest returns an error unless the
+// file at path has the given digest.
+func verifyFileDigest(c *gc.C, path string, d charm.Digest) error {
+	f, err := os.Open(path)
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	return d.Verify(f)
+}
+
+func (s *MirrorSuite) TestMirrorSkipsExisting(c *gc.C) {
+	curl := charm.MustParseURL("cs:series/dummy")
+	_, err := charm.Mirror(s.params, curl)
+	c.Assert(err, gc.IsNil)
+	s.server.Downloads = nil
+
+	results, err := charm.Mirror(s.params, curl)
+	c.Assert(err, gc.IsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Assert(results[0].Err, gc.IsNil)
+	c.Assert(results[0].Skipped, jc.IsTrue)
+	c.Assert(s.server.Downloads, gc.HasLen, 0)
+}
+
+func (s *MirrorSuite) TestMirrorReplacesModified(c *gc.C) {
+	path := s.archivePath("series", "dummy-1.charm")
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(path, []byte("bogus"), 0644)
+	c.Assert(err, gc.IsNil)
+
+	results, err := charm.Mirror(s.params, charm.MustParseURL("cs:series/dummy-1"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(results[0].Err, gc.IsNil)
+	c.Assert(results[0].Skipped, jc.IsFalse)
+	_, err = charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *MirrorSuite) TestMirrorResumesPartialDownload(c *gc.C) {
+	data, err := ioutil.ReadFile(charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	path := s.archivePath("series", "dummy-1.charm")
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(path+".partial", data[:len(data)/2], 0644)
+	c.Assert(err, gc.IsNil)
+
+	results, err := charm.Mirror(s.params, charm.MustParseURL("cs:series/dummy-1"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(results[0].Err, gc.IsNil)
+	c.Assert(s.server.Downloads, gc.HasLen, 1)
+	_, err = charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	_, err = os.Stat(path + ".partial")
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (s *MirrorSuite) TestMirrorRestartsCorruptPartialDownload(c *gc.C) {
+	path := s.archivePath("series", "dummy-1.charm")
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(path+".partial", []byte("garbage"), 0644)
+	c.Assert(err, gc.IsNil)
+
+	logger := &recordingLogger{}
+	charm.SetLogger(logger)
+	defer charm.SetLogger(nil)
+	results, err := charm.Mirror(s.params, charm.MustParseURL("cs:series/dummy-1"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(results[0].Err, gc.IsNil)
+	c.Assert(s.server.Downloads, gc.HasLen, 2)
+	retries := logger.kind(charm.EventRetry)
+	c.Assert(retries, gc.HasLen, 1)
+	c.Assert(retries[0].Path, gc.Equals, path+".partial")
+	c.Assert(retries[0].Fields["url"], gc.Equals, "cs:series/dummy-1")
+	_, err = charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *MirrorSuite) TestMirrorErrors(c *gc.C) {
+	results, err := charm.Mirror(s.params,
+		charm.MustParseURL("cs:series/missing"),
+		charm.MustParseURL("cs:series/wordpress"),
+		charm.MustParseURL("cs:series/dummy"),
+	)
+	c.Assert(err, gc.IsNil)
+	c.Assert(results, gc.HasLen, 3)
+	c.Assert(results[0].Err, gc.ErrorMatches, `cannot get "cs:series/missing": charm not found: cs:series/missing`)
+	c.Assert(results[1].Err, gc.ErrorMatches, `cannot mirror "cs:series/wordpress-2": store returned charm "dummy"`)
+	c.Assert(results[2].Err, gc.IsNil)
+
+	_, err = os.Stat(s.archivePath("series", "wordpress-2.charm"))
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+	_, err = os.Stat(s.archivePath("series", "wordpress-2.charm.partial"))
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+
+	index, err := charm.ReadMirrorIndex(s.params.Dest.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(index, gc.HasLen, 1)
+	c.Assert(index["cs:series/dummy-1"].Path, gc.Equals, "series/dummy-1.charm")
+}
+
+func (s *MirrorSuite) TestReadMirrorIndexEmpty(c *gc.C) {
+	index, err := charm.ReadMirrorIndex(c.MkDir())
+	c.Assert(err, gc.IsNil)
+	c.Assert(index, gc.HasLen, 0)
+}
@@ -0,0 +1,25 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+// ReadCharmArchiveMmap is like ReadCharmArchive except that the
+// archive is mapped into memory rather than read, so that the files
+// in it are read straight from the operating system's page cache.
+// This reduces copying and memory use when many archives are being
+// served concurrently from local storage. The file is mapped anew
+// each time the archive is opened, and unmapped when the operation
+// that opened it is done.
+//
+// On platforms that do not support memory mapping, the archive is
+// read as ReadCharmArchive reads it.
+func ReadCharmArchiveMmap(path string) (*CharmArchive, error) {
+	a, err := readCharmArchive(newZipOpenerFromMmap(path), nil)
+	if err != nil {
+		auditRead(nil, path, err)
+		return nil, err
+	}
+	a.Path = path
+	auditRead(a, path, nil)
+	return a, nil
+}
@@ -0,0 +1,14 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package charm
+
+// newZipOpenerFromMmap returns a zipOpener that reads the
+// archive at the given path, as memory mapping is not
+// supported on this platform.
+func newZipOpenerFromMmap(path string) zipOpener {
+	return newZipOpenerFromPath(path)
+}
@@ -0,0 +1,60 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type MmapSuite struct{}
+
+var _ = gc.Suite(&MmapSuite{})
+
+func (s *MmapSuite) TestReadCharmArchiveMmap(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	archive, err := charm.ReadCharmArchiveMmap(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Path, gc.Equals, path)
+	checkDummy(c, archive, path)
+
+	expected, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	manifest, err := archive.Manifest()
+	c.Assert(err, gc.IsNil)
+	expectedManifest, err := expected.Manifest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(manifest, gc.DeepEquals, expectedManifest)
+
+	dir := c.MkDir()
+	err = archive.ExpandTo(dir)
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "metadata.yaml"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, "(?s).*name: dummy.*")
+}
+
+func (s *MmapSuite) TestReadCharmArchiveMmapNotFound(c *gc.C) {
+	_, err := charm.ReadCharmArchiveMmap(filepath.Join(c.MkDir(), "missing.charm"))
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+}
+
+func (s *MmapSuite) TestReadCharmArchiveMmapInvalid(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "bad.charm")
+	err := ioutil.WriteFile(path, []byte("not a zip file"), 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.ReadCharmArchiveMmap(path)
+	c.Assert(err, gc.ErrorMatches, "zip: not a valid zip file")
+
+	err = ioutil.WriteFile(path, nil, 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.ReadCharmArchiveMmap(path)
+	c.Assert(err, gc.ErrorMatches, "zip: not a valid zip file")
+}
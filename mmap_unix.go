@@ -0,0 +1,67 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package charm
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// newZipOpenerFromMmap returns a zipOpener that maps
+// the archive at the given path into memory.
+func newZipOpenerFromMmap(path string) zipOpener {
+	return &zipMmapOpener{path: path}
+}
+
+type zipMmapOpener struct {
+	path string
+}
+
+func (zo *zipMmapOpener) openZip() (*zipReadCloser, error) {
+	f, err := os.Open(zo.path)
+	if err != nil {
+		return nil, err
+	}
+	// The mapping remains valid after the file is closed.
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size == 0 || int64(int(size)) != size {
+		// Empty files cannot be mapped, and files too large
+		// to map cannot be archives we can read anyway.
+		return (&zipPathOpener{path: zo.path}).openZip()
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("cannot map %q: %v", zo.path, err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(data), size)
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+	return &zipReadCloser{Closer: mapping(data), Reader: r}, nil
+}
+
+func (zo *zipMmapOpener) open() (io.ReadCloser, error) {
+	return os.Open(zo.path)
+}
+
+// mapping holds memory mapped by syscall.Mmap.
+type mapping []byte
+
+// Close unmaps the memory.
+func (m mapping) Close() error {
+	return syscall.Munmap(m)
+}
@@ -0,0 +1,123 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/juju/names"
+)
+
+var (
+	validSeries = regexp.MustCompile("^[a-z]+([a-z0-9]+)?$")
+	validName   = regexp.MustCompile("^[a-z][a-z0-9]*(-[a-z0-9]*[a-z][a-z0-9]*)*$")
+)
+
+// IsValidSeries returns whether series is a valid series in charm URLs.
+func IsValidSeries(series string) bool {
+	return validSeries.MatchString(series)
+}
+
+// IsValidName returns whether name is a valid charm name. A valid
+// name consists of lower case ASCII letters and digits, starts with
+// a letter, and may be split by single dashes into parts that each
+// hold at least one letter.
+func IsValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// ValidateName returns an error if name is not a valid charm name.
+// Where possible, the error proposes a valid name derived from it.
+func ValidateName(name string) error {
+	if IsValidName(name) {
+		return nil
+	}
+	if proposal := NormalizeName(name); proposal != "" {
+		return fmt.Errorf("invalid charm name %q; perhaps %q", name, proposal)
+	}
+	return fmt.Errorf("invalid charm name %q", name)
+}
+
+// NormalizeName returns a valid charm name derived from name, or
+// the empty string if none can be derived. Letters are converted to
+// lower case, other characters that may not appear in names, such
+// as underscores and dots, are converted to dashes, leading digits
+// and surplus dashes are removed, and parts consisting only of
+// digits are joined to the part before. For example, "My_Charm" is
+// normalized to "my-charm" and "mysql-5.5" to "mysql55".
+func NormalizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	var parts []string
+	for _, part := range strings.Split(name, "-") {
+		if len(parts) == 0 {
+			part = strings.TrimLeft(part, "0123456789")
+		}
+		switch {
+		case part == "":
+		case len(parts) > 0 && strings.Trim(part, "0123456789") == "":
+			parts[len(parts)-1] += part
+		default:
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// MaxApplicationNameLength holds the maximum length of an application
+// name, chosen so that the names of its units, formed from the
+// application name and a unit number, fit in a 63-character DNS label.
+const MaxApplicationNameLength = 56
+
+// ValidateApplicationName returns an error if name cannot be used
+// as the name of an application and its units. Where possible, the
+// error proposes a usable name derived from it.
+func ValidateApplicationName(name string) error {
+	var msg string
+	switch {
+	case !names.IsValidService(name):
+		msg = fmt.Sprintf("invalid application name %q", name)
+	case len(name) > MaxApplicationNameLength:
+		msg = fmt.Sprintf("application name %q is longer than %d characters", name, MaxApplicationNameLength)
+	default:
+		return nil
+	}
+	if proposal := SuggestApplicationName(name); proposal != "" {
+		return fmt.Errorf("%s; perhaps %q", msg, proposal)
+	}
+	return errors.New(msg)
+}
+
+// SuggestApplicationName returns a usable application name derived
+// from name, or the empty string if none can be derived. The name is
+// normalized as by NormalizeName and, if it is too long, shortened,
+// dropping whole dash-separated parts where possible.
+func SuggestApplicationName(name string) string {
+	name = NormalizeName(name)
+	if len(name) > MaxApplicationNameLength {
+		if i := strings.LastIndex(name[:MaxApplicationNameLength+1], "-"); i > 0 {
+			name = name[:i]
+		} else {
+			name = name[:MaxApplicationNameLength]
+		}
+	}
+	return name
+}
+
+// DefaultApplicationName returns the name given by default to an
+// application deployed from the charm: the charm's name, shortened
+// if necessary to make it usable as an application name.
+func (meta Meta) DefaultApplicationName() string {
+	return SuggestApplicationName(meta.Name)
+}
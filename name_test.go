@@ -0,0 +1,110 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type NameSuite struct{}
+
+var _ = gc.Suite(&NameSuite{})
+
+var normalizeNameTests = []struct {
+	name   string
+	expect string
+}{
+	{"wordpress", "wordpress"},
+	{"word-press", "word-press"},
+	{"Wordpress", "wordpress"},
+	{"My_Charm", "my-charm"},
+	{"word press", "word-press"},
+	{"word--press", "word-press"},
+	{"-wordpress-", "wordpress"},
+	{"wordpress-2", "wordpress2"},
+	{"mysql-5.5", "mysql55"},
+	{"mysql-5-server", "mysql5-server"},
+	{"7zip", "zip"},
+	{"2-fast", "fast"},
+	{"café", "caf"},
+	{"", ""},
+	{"123", ""},
+	{"---", ""},
+}
+
+func (s *NameSuite) TestNormalizeName(c *gc.C) {
+	for i, test := range normalizeNameTests {
+		c.Logf("test %d: %q", i, test.name)
+		name := charm.NormalizeName(test.name)
+		c.Check(name, gc.Equals, test.expect)
+		if name != "" {
+			c.Check(charm.IsValidName(name), gc.Equals, true)
+		}
+	}
+}
+
+func (s *NameSuite) TestValidateName(c *gc.C) {
+	c.Assert(charm.ValidateName("wordpress"), gc.IsNil)
+	err := charm.ValidateName("Word_Press")
+	c.Assert(err, gc.ErrorMatches, `invalid charm name "Word_Press"; perhaps "word-press"`)
+	err = charm.ValidateName("42")
+	c.Assert(err, gc.ErrorMatches, `invalid charm name "42"`)
+}
+
+func (s *NameSuite) TestMetaCheckName(c *gc.C) {
+	_, err := charm.ReadMeta(strings.NewReader("name: My_Charm\nsummary: s\ndescription: d\n"))
+	c.Assert(err, gc.ErrorMatches, `invalid charm name "My_Charm"; perhaps "my-charm"`)
+}
+
+var applicationNameTests = []struct {
+	name    string
+	err     string
+	suggest string
+}{{
+	name:    "wordpress",
+	suggest: "wordpress",
+}, {
+	name:    "Word_Press",
+	err:     `invalid application name "Word_Press"; perhaps "word-press"`,
+	suggest: "word-press",
+}, {
+	name: "42",
+	err:  `invalid application name "42"`,
+}, {
+	name:    strings.Repeat("abcdefghij-", 5) + "abcdefghij",
+	err:     `application name "abcdefghij-.*" is longer than 56 characters; perhaps "abcdefghij-abcdefghij-abcdefghij-abcdefghij-abcdefghij"`,
+	suggest: "abcdefghij-abcdefghij-abcdefghij-abcdefghij-abcdefghij",
+}, {
+	name:    strings.Repeat("a", 60),
+	err:     `application name "a+" is longer than 56 characters; perhaps "a{56}"`,
+	suggest: strings.Repeat("a", 56),
+}}
+
+func (s *NameSuite) TestValidateApplicationName(c *gc.C) {
+	for i, test := range applicationNameTests {
+		c.Logf("test %d: %q", i, test.name)
+		err := charm.ValidateApplicationName(test.name)
+		if test.err == "" {
+			c.Check(err, gc.IsNil)
+		} else {
+			c.Check(err, gc.ErrorMatches, test.err)
+		}
+		suggestion := charm.SuggestApplicationName(test.name)
+		c.Check(suggestion, gc.Equals, test.suggest)
+		if suggestion != "" {
+			c.Check(charm.ValidateApplicationName(suggestion), gc.IsNil)
+		}
+	}
+}
+
+func (s *NameSuite) TestDefaultApplicationName(c *gc.C) {
+	meta := charm.Meta{Name: "mysql"}
+	c.Assert(meta.DefaultApplicationName(), gc.Equals, "mysql")
+	meta.Name = strings.Repeat("long-", 20) + "charm"
+	c.Assert(meta.DefaultApplicationName(), gc.Equals, strings.TrimSuffix(strings.Repeat("long-", 11), "-"))
+}
@@ -0,0 +1,190 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Annotations describing a charm in an OCI image manifest. The
+// org.opencontainers.image annotations are those defined by the OCI
+// image specification, for the benefit of registries that display
+// them; the io.juju.charm annotations hold everything needed to
+// recover the charm's metadata, configuration and revision.
+const (
+	OCIAnnotationTitle       = "org.opencontainers.image.title"
+	OCIAnnotationDescription = "org.opencontainers.image.description"
+	OCIAnnotationVersion     = "org.opencontainers.image.version"
+	OCIAnnotationMetadata    = "io.juju.charm.metadata"
+	OCIAnnotationConfig      = "io.juju.charm.config"
+	OCIAnnotationRevision    = "io.juju.charm.revision"
+)
+
+// Media types used in OCI artifacts holding charms.
+const (
+	OCIManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	OCIArtifactType      = "application/vnd.juju.charm.v1"
+	OCILayerMediaType    = "application/vnd.juju.charm.layer.v1.zip"
+	OCIEmptyMediaType    = "application/vnd.oci.empty.v1+json"
+)
+
+// ociEmptyConfig holds the contents of the empty config blob
+// used by artifacts that need no image configuration.
+var ociEmptyConfig = []byte("{}")
+
+// OCIAnnotations returns annotations describing a charm with the
+// given metadata, configuration and revision, for inclusion in an
+// OCI image manifest. The configuration may be nil.
+func OCIAnnotations(meta *Meta, config *Config, revision int) (map[string]string, error) {
+	metadata, err := encodeMeta(meta)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode charm metadata: %v", err)
+	}
+	annotations := map[string]string{
+		OCIAnnotationTitle:       meta.Name,
+		OCIAnnotationDescription: meta.Summary,
+		OCIAnnotationVersion:     strconv.Itoa(revision),
+		OCIAnnotationMetadata:    string(metadata),
+		OCIAnnotationRevision:    strconv.Itoa(revision),
+	}
+	if config != nil {
+		data, err := encodeConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode charm config: %v", err)
+		}
+		annotations[OCIAnnotationConfig] = string(data)
+	}
+	return annotations, nil
+}
+
+// ParseOCIAnnotations returns the metadata, configuration and
+// revision of the charm described by the given annotations, as
+// created by OCIAnnotations. If the annotations hold no
+// configuration, an empty configuration is returned.
+func ParseOCIAnnotations(annotations map[string]string) (*Meta, *Config, int, error) {
+	metadata, ok := annotations[OCIAnnotationMetadata]
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("no %s annotation", OCIAnnotationMetadata)
+	}
+	meta, err := ReadMeta(strings.NewReader(metadata))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid %s annotation: %v", OCIAnnotationMetadata, err)
+	}
+	config := NewConfig()
+	if data, ok := annotations[OCIAnnotationConfig]; ok {
+		config, err = ReadConfig(strings.NewReader(data))
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("invalid %s annotation: %v", OCIAnnotationConfig, err)
+		}
+	}
+	revision, err := strconv.Atoi(annotations[OCIAnnotationRevision])
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid %s annotation: %q", OCIAnnotationRevision, annotations[OCIAnnotationRevision])
+	}
+	return meta, config, revision, nil
+}
+
+// OCIDescriptor describes a blob referenced by an OCI image manifest.
+type OCIDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// OCIManifest holds an OCI image manifest.
+type OCIManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        OCIDescriptor     `json:"config"`
+	Layers        []OCIDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// OCIArtifact holds a charm packaged as an OCI artifact, ready to
+// be pushed to a container registry: the manifest, marshaled as
+// JSON, is pushed after the config and layer blobs it refers to.
+type OCIArtifact struct {
+	// Manifest holds the artifact's manifest, annotated
+	// as described by OCIAnnotations.
+	Manifest OCIManifest
+
+	// Config holds the contents of the config blob.
+	Config []byte
+
+	// Layer holds the contents of the single layer,
+	// which is the charm archive.
+	Layer []byte
+}
+
+// NewOCIArtifact reads a charm archive from r and packages it
+// as an OCI artifact.
+func NewOCIArtifact(r io.Reader) (*OCIArtifact, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := ReadCharmArchiveBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	config, err := archive.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	annotations, err := OCIAnnotations(archive.Meta(), config, archive.Revision())
+	if err != nil {
+		return nil, err
+	}
+	return &OCIArtifact{
+		Manifest: OCIManifest{
+			SchemaVersion: 2,
+			MediaType:     OCIManifestMediaType,
+			ArtifactType:  OCIArtifactType,
+			Config:        ociDescriptor(OCIEmptyMediaType, ociEmptyConfig),
+			Layers: []OCIDescriptor{
+				ociDescriptor(OCILayerMediaType, data),
+			},
+			Annotations: annotations,
+		},
+		Config: ociEmptyConfig,
+		Layer:  data,
+	}, nil
+}
+
+// ReadOCIArtifactLayer returns the charm archive held in the given
+// layer of an artifact created by NewOCIArtifact, as pulled from a
+// registry. The layer is checked against the manifest's descriptor.
+func ReadOCIArtifactLayer(manifest *OCIManifest, layer []byte) (*CharmArchive, error) {
+	if manifest.ArtifactType != OCIArtifactType {
+		return nil, fmt.Errorf("unexpected artifact type %q", manifest.ArtifactType)
+	}
+	if len(manifest.Layers) != 1 {
+		return nil, fmt.Errorf("expected 1 layer, got %d", len(manifest.Layers))
+	}
+	desc := manifest.Layers[0]
+	if desc.MediaType != OCILayerMediaType {
+		return nil, fmt.Errorf("unexpected layer media type %q", desc.MediaType)
+	}
+	if got := ociDescriptor(desc.MediaType, layer); got.Digest != desc.Digest || got.Size != desc.Size {
+		return nil, fmt.Errorf("layer digest mismatch: expected %s, got %s", desc.Digest, got.Digest)
+	}
+	return ReadCharmArchiveBytes(layer)
+}
+
+func ociDescriptor(mediaType string, data []byte) OCIDescriptor {
+	sum := sha256.Sum256(data)
+	return OCIDescriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+		Size:      int64(len(data)),
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"encoding/json"
+	"os"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type OCISuite struct{}
+
+var _ = gc.Suite(&OCISuite{})
+
+func (s *OCISuite) TestAnnotationsRoundTrip(c *gc.C) {
+	for _, name := range []string{"dummy", "mysql", "logging"} {
+		c.Logf("charm %s", name)
+		ch := charmtesting.Charms.CharmDir(name)
+		annotations, err := charm.OCIAnnotations(ch.Meta(), ch.Config(), ch.Revision())
+		c.Assert(err, gc.IsNil)
+		c.Assert(annotations[charm.OCIAnnotationTitle], gc.Equals, ch.Meta().Name)
+		c.Assert(annotations[charm.OCIAnnotationDescription], gc.Equals, ch.Meta().Summary)
+
+		meta, config, revision, err := charm.ParseOCIAnnotations(annotations)
+		c.Assert(err, gc.IsNil)
+		c.Assert(meta, jc.DeepEquals, ch.Meta())
+		c.Assert(config, jc.DeepEquals, ch.Config())
+		c.Assert(revision, gc.Equals, ch.Revision())
+	}
+}
+
+func (s *OCISuite) TestAnnotationsWithoutConfig(c *gc.C) {
+	ch := charmtesting.Charms.CharmDir("dummy")
+	annotations, err := charm.OCIAnnotations(ch.Meta(), nil, 5)
+	c.Assert(err, gc.IsNil)
+	_, ok := annotations[charm.OCIAnnotationConfig]
+	c.Assert(ok, jc.IsFalse)
+	c.Assert(annotations[charm.OCIAnnotationVersion], gc.Equals, "5")
+
+	_, config, revision, err := charm.ParseOCIAnnotations(annotations)
+	c.Assert(err, gc.IsNil)
+	c.Assert(config, jc.DeepEquals, charm.NewConfig())
+	c.Assert(revision, gc.Equals, 5)
+}
+
+var parseAnnotationsErrorTests = []struct {
+	about       string
+	annotations map[string]string
+	expectErr   string
+}{{
+	about:       "no metadata",
+	annotations: map[string]string{},
+	expectErr:   `no io.juju.charm.metadata annotation`,
+}, {
+	about: "invalid metadata",
+	annotations: map[string]string{
+		charm.OCIAnnotationMetadata: "name: foo",
+	},
+	expectErr: `invalid io.juju.charm.metadata annotation: .*`,
+}, {
+	about: "invalid config",
+	annotations: map[string]string{
+		charm.OCIAnnotationMetadata: "name: foo\nsummary: s\ndescription: d\n",
+		charm.OCIAnnotationConfig:   "options: {x: {type: bogus}}",
+		charm.OCIAnnotationRevision: "1",
+	},
+	expectErr: `invalid io.juju.charm.config annotation: .*`,
+}, {
+	about: "no revision",
+	annotations: map[string]string{
+		charm.OCIAnnotationMetadata: "name: foo\nsummary: s\ndescription: d\n",
+	},
+	expectErr: `invalid io.juju.charm.revision annotation: ""`,
+}}
+
+func (s *OCISuite) TestParseAnnotationsErrors(c *gc.C) {
+	for i, test := range parseAnnotationsErrorTests {
+		c.Logf("test %d: %s", i, test.about)
+		_, _, _, err := charm.ParseOCIAnnotations(test.annotations)
+		c.Assert(err, gc.ErrorMatches, test.expectErr)
+	}
+}
+
+func (s *OCISuite) newArtifact(c *gc.C) *charm.OCIArtifact {
+	f, err := os.Open(charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	artifact, err := charm.NewOCIArtifact(f)
+	c.Assert(err, gc.IsNil)
+	return artifact
+}
+
+func (s *OCISuite) TestNewOCIArtifact(c *gc.C) {
+	artifact := s.newArtifact(c)
+	m := artifact.Manifest
+	c.Assert(m.SchemaVersion, gc.Equals, 2)
+	c.Assert(m.MediaType, gc.Equals, charm.OCIManifestMediaType)
+	c.Assert(m.ArtifactType, gc.Equals, charm.OCIArtifactType)
+	c.Assert(m.Config.MediaType, gc.Equals, charm.OCIEmptyMediaType)
+	c.Assert(m.Config.Size, gc.Equals, int64(len(artifact.Config)))
+	c.Assert(string(artifact.Config), gc.Equals, "{}")
+	c.Assert(m.Layers, gc.HasLen, 1)
+	c.Assert(m.Layers[0].MediaType, gc.Equals, charm.OCILayerMediaType)
+	c.Assert(m.Layers[0].Size, gc.Equals, int64(len(artifact.Layer)))
+	c.Assert(m.Layers[0].Digest, gc.Matches, "sha256:[0-9a-f]{64}")
+	c.Assert(m.Annotations[charm.OCIAnnotationTitle], gc.Equals, "dummy")
+	c.Assert(m.Annotations[charm.OCIAnnotationRevision], gc.Equals, "1")
+
+	data, err := json.Marshal(m)
+	c.Assert(err, gc.IsNil)
+	var doc map[string]interface{}
+	err = json.Unmarshal(data, &doc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc["artifactType"], gc.Equals, charm.OCIArtifactType)
+	c.Assert(doc["schemaVersion"], gc.Equals, 2.0)
+}
+
+func (s *OCISuite) TestReadOCIArtifactLayer(c *gc.C) {
+	artifact := s.newArtifact(c)
+	archive, err := charm.ReadOCIArtifactLayer(&artifact.Manifest, artifact.Layer)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+	c.Assert(archive.Revision(), gc.Equals, 1)
+}
+
+func (s *OCISuite) TestReadOCIArtifactLayerErrors(c *gc.C) {
+	artifact := s.newArtifact(c)
+	layer := append([]byte(nil), artifact.Layer...)
+	layer[0] ^= 0xff
+	_, err := charm.ReadOCIArtifactLayer(&artifact.Manifest, layer)
+	c.Assert(err, gc.ErrorMatches, "layer digest mismatch: expected sha256:.*, got sha256:.*")
+
+	m := artifact.Manifest
+	m.ArtifactType = "application/vnd.example"
+	_, err = charm.ReadOCIArtifactLayer(&m, artifact.Layer)
+	c.Assert(err, gc.ErrorMatches, `unexpected artifact type "application/vnd.example"`)
+
+	m = artifact.Manifest
+	m.Layers = nil
+	_, err = charm.ReadOCIArtifactLayer(&m, artifact.Layer)
+	c.Assert(err, gc.ErrorMatches, `expected 1 layer, got 0`)
+}
@@ -0,0 +1,221 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/juju/schema"
+)
+
+// ErrNoOwners is returned when a charm holds no owners.yaml file.
+var ErrNoOwners = errors.New("charm has no owners record")
+
+// Owners holds the history of the maintainers of a charm and the
+// keys they sign it with, as recorded in its owners.yaml file:
+//
+//	owners:
+//	  - name: Jane Doe
+//	    email: jane@example.com
+//	    keys: [3A4F9C0D21E0B7A2]
+//	    since: 2013-06-01
+//	    until: 2014-03-15
+//	  - name: Charmers
+//	    email: charmers@example.com
+//	    keys: [7C1B0E5F66D3A948, 0B9A55E3C2F1D407]
+//	    since: 2014-03-15
+//
+// Times are dates or RFC 3339 times. Recording previous maintainers,
+// rather than replacing them, lets a charm signed by a previous
+// maintainer still be verified after it has changed hands.
+//
+// The owners file is part of the charm's content, as it decides whose
+// signatures are accepted: changing hands changes the charm's digest,
+// and so requires the charm to be locked, or its provenance recorded,
+// anew.
+type Owners struct {
+	// Owners holds the maintainers of the charm,
+	// past and present, in order of Since.
+	Owners []Owner
+}
+
+// Owner describes a maintainer of a charm.
+type Owner struct {
+	// Name holds the name of the maintainer.
+	Name string
+
+	// Email holds the email address of the maintainer, if known.
+	Email string `bson:",omitempty"`
+
+	// Keys holds the fingerprints of the keys
+	// the maintainer signs the charm with.
+	Keys []string `bson:",omitempty"`
+
+	// Since holds the time from which the maintainer
+	// has maintained the charm.
+	Since time.Time
+
+	// Until holds the time at which the maintainer handed
+	// the charm over, or the zero time if the maintainer
+	// still maintains it.
+	Until time.Time `bson:",omitempty"`
+}
+
+// current reports whether the owner maintained the charm at time t.
+func (o Owner) current(t time.Time) bool {
+	return !t.Before(o.Since) && (o.Until.IsZero() || t.Before(o.Until))
+}
+
+// Current returns the owners that currently maintain the charm.
+func (o *Owners) Current() []Owner {
+	var current []Owner
+	for _, owner := range o.Owners {
+		if owner.Until.IsZero() {
+			current = append(current, owner)
+		}
+	}
+	return current
+}
+
+// AcceptsKey reports whether a signature made at the given time
+// with the key having the given fingerprint should be accepted:
+// the key must belong to an owner who maintained the charm at
+// that time. Keys of previous owners are thus accepted for
+// signatures made before the charm changed hands.
+func (o *Owners) AcceptsKey(fingerprint string, signedAt time.Time) bool {
+	for _, owner := range o.Owners {
+		if !owner.current(signedAt) {
+			continue
+		}
+		for _, key := range owner.Keys {
+			if key == fingerprint {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	ownersSchema = schema.FieldMap(
+		schema.Fields{
+			"owners": schema.List(ownerSchema),
+		},
+		schema.Defaults{
+			"owners": schema.Omit,
+		},
+	)
+	ownerSchema = schema.FieldMap(
+		schema.Fields{
+			"name":  schema.String(),
+			"email": schema.String(),
+			"keys":  schema.List(schema.String()),
+			"since": schema.String(),
+			"until": schema.String(),
+		},
+		schema.Defaults{
+			"email": "",
+			"keys":  schema.Omit,
+			"until": "",
+		},
+	)
+)
+
+// ReadOwners reads an owners.yaml file.
+func ReadOwners(r io.Reader) (*Owners, error) {
+	data, release, err := readYAMLSource(r)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	raw := make(map[interface{}]interface{})
+	if err := yamlUnmarshal(data, raw); err != nil {
+		return nil, err
+	}
+	v, err := ownersSchema.Coerce(raw, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid owners: %v", err)
+	}
+	owners := &Owners{}
+	if list, ok := v.(map[string]interface{})["owners"]; ok {
+		for _, item := range list.([]interface{}) {
+			m := item.(map[string]interface{})
+			owner := Owner{
+				Name:  m["name"].(string),
+				Email: m["email"].(string),
+				Keys:  parseStringList(m["keys"]),
+			}
+			if owner.Since, err = parseOwnerTime(m["since"].(string)); err != nil {
+				return nil, fmt.Errorf("invalid owners: owner %q: %v", owner.Name, err)
+			}
+			if until := m["until"].(string); until != "" {
+				if owner.Until, err = parseOwnerTime(until); err != nil {
+					return nil, fmt.Errorf("invalid owners: owner %q: %v", owner.Name, err)
+				}
+				if !owner.Until.After(owner.Since) {
+					return nil, fmt.Errorf("invalid owners: owner %q: until is not after since", owner.Name)
+				}
+			}
+			owners.Owners = append(owners.Owners, owner)
+		}
+	}
+	sort.Sort(ownersBySince(owners.Owners))
+	return owners, nil
+}
+
+// parseOwnerTime parses a date or an RFC 3339 time.
+func parseOwnerTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return t, nil
+}
+
+type ownersBySince []Owner
+
+func (o ownersBySince) Len() int           { return len(o) }
+func (o ownersBySince) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+func (o ownersBySince) Less(i, j int) bool { return o[i].Since.Before(o[j].Since) }
+
+// Owners returns the owners recorded in the charm's owners.yaml
+// file. It returns ErrNoOwners if there is no such file.
+func (dir *CharmDir) Owners() (*Owners, error) {
+	f, err := os.Open(dir.join(OwnersFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNoOwners
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadOwners(f)
+}
+
+// Owners returns the owners recorded in the charm's owners.yaml
+// file. It returns ErrNoOwners if there is no such file.
+func (a *CharmArchive) Owners() (*Owners, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	r, err := zipOpenFile(zipr, OwnersFile)
+	if _, ok := err.(*noCharmArchiveFile); ok {
+		return nil, ErrNoOwners
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ReadOwners(r)
+}
@@ -0,0 +1,160 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type OwnersSuite struct{}
+
+var _ = gc.Suite(&OwnersSuite{})
+
+const ownersYAML = `
+owners:
+  - name: Charmers
+    email: charmers@example.com
+    keys: [7C1B0E5F66D3A948, 0B9A55E3C2F1D407]
+    since: 2014-03-15T12:00:00Z
+  - name: Jane Doe
+    keys: [3A4F9C0D21E0B7A2]
+    since: 2013-06-01
+    until: 2014-03-15T12:00:00Z
+`
+
+func ownersTime(c *gc.C, s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	c.Assert(err, gc.IsNil)
+	return t
+}
+
+func (s *OwnersSuite) TestReadOwners(c *gc.C) {
+	owners, err := charm.ReadOwners(strings.NewReader(ownersYAML))
+	c.Assert(err, gc.IsNil)
+	c.Assert(owners, gc.DeepEquals, &charm.Owners{
+		Owners: []charm.Owner{{
+			Name:  "Jane Doe",
+			Keys:  []string{"3A4F9C0D21E0B7A2"},
+			Since: ownersTime(c, "2013-06-01T00:00:00Z"),
+			Until: ownersTime(c, "2014-03-15T12:00:00Z"),
+		}, {
+			Name:  "Charmers",
+			Email: "charmers@example.com",
+			Keys:  []string{"7C1B0E5F66D3A948", "0B9A55E3C2F1D407"},
+			Since: ownersTime(c, "2014-03-15T12:00:00Z"),
+		}},
+	})
+	current := owners.Current()
+	c.Assert(current, gc.HasLen, 1)
+	c.Assert(current[0].Name, gc.Equals, "Charmers")
+}
+
+var ownersErrorTests = []struct {
+	yaml string
+	err  string
+}{{
+	yaml: "owners:\n  - name: x\n",
+	err:  `invalid owners: owners\[0\].since: expected string, got nothing`,
+}, {
+	yaml: "owners:\n  - name: x\n    since: yesterday\n",
+	err:  `invalid owners: owner "x": invalid time "yesterday"`,
+}, {
+	yaml: "owners:\n  - name: x\n    since: 2014-01-02\n    until: 2014-01-01\n",
+	err:  `invalid owners: owner "x": until is not after since`,
+}}
+
+func (s *OwnersSuite) TestReadOwnersErrors(c *gc.C) {
+	for i, test := range ownersErrorTests {
+		c.Logf("test %d: %q", i, test.yaml)
+		_, err := charm.ReadOwners(strings.NewReader(test.yaml))
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *OwnersSuite) TestAcceptsKey(c *gc.C) {
+	owners, err := charm.ReadOwners(strings.NewReader(ownersYAML))
+	c.Assert(err, gc.IsNil)
+	tests := []struct {
+		key      string
+		signedAt string
+		accepts  bool
+	}{
+		{"3A4F9C0D21E0B7A2", "2013-12-01T00:00:00Z", true},
+		{"3A4F9C0D21E0B7A2", "2014-03-15T12:00:00Z", false},
+		{"3A4F9C0D21E0B7A2", "2013-05-01T00:00:00Z", false},
+		{"0B9A55E3C2F1D407", "2014-03-15T12:00:00Z", true},
+		{"0B9A55E3C2F1D407", "2013-12-01T00:00:00Z", false},
+		{"FFFFFFFFFFFFFFFF", "2014-06-01T00:00:00Z", false},
+	}
+	for i, test := range tests {
+		c.Logf("test %d: %s at %s", i, test.key, test.signedAt)
+		c.Assert(owners.AcceptsKey(test.key, ownersTime(c, test.signedAt)), gc.Equals, test.accepts)
+	}
+}
+
+func (s *OwnersSuite) TestCharmOwners(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	_, err := dir.Owners()
+	c.Assert(err, gc.Equals, charm.ErrNoOwners)
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	_, err = archive.Owners()
+	c.Assert(err, gc.Equals, charm.ErrNoOwners)
+
+	err = ioutil.WriteFile(filepath.Join(dir.Path, "owners.yaml"), []byte(ownersYAML), 0644)
+	c.Assert(err, gc.IsNil)
+	owners, err := dir.Owners()
+	c.Assert(err, gc.IsNil)
+	c.Assert(owners.Owners, gc.HasLen, 2)
+
+	path := filepath.Join(c.MkDir(), "dummy.charm")
+	file, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	err = dir.ArchiveTo(file)
+	file.Close()
+	c.Assert(err, gc.IsNil)
+	archive, err = charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	read, err := archive.Owners()
+	c.Assert(err, gc.IsNil)
+	c.Assert(read, gc.DeepEquals, owners)
+}
+
+func (s *OwnersSuite) TestOwnersInContent(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	before := charmtesting.Charms.CharmDir("dummy")
+	err := ioutil.WriteFile(filepath.Join(dir.Path, "owners.yaml"), []byte(ownersYAML), 0644)
+	c.Assert(err, gc.IsNil)
+	equal, err := charm.Equal(before, dir, charm.EqualOptions{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(equal, gc.Equals, false)
+}
+
+func (s *OwnersSuite) TestTamperedOwnersFailVerification(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	writeCharmFile(c, dir.Path, "owners.yaml", ownersYAML, 0644)
+	lock, err := charm.Freeze(dir)
+	c.Assert(err, gc.IsNil)
+	_, err = dir.WriteProvenance(testProvenance)
+	c.Assert(err, gc.IsNil)
+
+	tampered := ownersYAML + "  - name: Mallory\n    keys: [FFFFFFFFFFFFFFFF]\n    since: 2014-06-01\n"
+	writeCharmFile(c, dir.Path, "owners.yaml", tampered, 0644)
+	owners, err := dir.Owners()
+	c.Assert(err, gc.IsNil)
+	c.Assert(owners.AcceptsKey("FFFFFFFFFFFFFFFF", ownersTime(c, "2014-07-01T00:00:00Z")), gc.Equals, true)
+
+	err = charm.VerifyLock(dir, lock)
+	c.Assert(err, gc.ErrorMatches, "owners.yaml: contents do not match lock")
+	_, err = charm.VerifyProvenance(dir)
+	c.Assert(err, gc.ErrorMatches, `cannot verify provenance: file "owners.yaml" has been modified`)
+}
@@ -0,0 +1,294 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/juju/utils"
+)
+
+// patchFile holds the name of the member of a patch archive
+// that describes the patch. Its name is hidden so that it cannot
+// clash with the files of a charm.
+const patchFile = ".charm-patch.yaml"
+
+// CharmPatch holds a patch to a charm archive, made by CreatePatch.
+// A patch is a zip archive holding only the files of a charm that
+// differ from those in the archive it was made against, so that a
+// fix to a large charm can be distributed without sending the whole
+// charm again.
+type CharmPatch struct {
+	// Base holds the SHA256 digest of the
+	// archive the patch applies to.
+	Base Digest
+
+	// Removed holds the paths of the files of the
+	// base archive that are not in the patched charm,
+	// in alphabetical order.
+	Removed []string
+
+	// Files holds the paths of the files held by the
+	// patch, which replace or add to those of the base.
+	Files []string
+
+	zopen zipOpener
+}
+
+// patchDoc holds the contents of the patch file.
+type patchDoc struct {
+	Base    Digest   `yaml:"base"`
+	Removed []string `yaml:"removed,omitempty"`
+}
+
+// CreatePatch writes to w a patch holding the files of updated that
+// are not in base or differ from them in contents or mode, so that
+// applying the patch to base produces a charm with the same files as
+// updated.
+func CreatePatch(base, updated *CharmArchive, w io.Writer) error {
+	digest, err := archiveDigest(base)
+	if err != nil {
+		return fmt.Errorf("cannot read base archive: %v", err)
+	}
+	basez, err := base.zopen.openZip()
+	if err != nil {
+		return err
+	}
+	defer basez.Close()
+	updatedz, err := updated.zopen.openZip()
+	if err != nil {
+		return err
+	}
+	defer updatedz.Close()
+	baseFiles := make(map[string]*zip.File)
+	for _, fh := range basez.File {
+		baseFiles[fh.Name] = fh
+	}
+	doc := patchDoc{Base: digest}
+	zipw := zip.NewWriter(w)
+	for _, fh := range updatedz.File {
+		if fh.Name == patchFile {
+			continue
+		}
+		same, err := sameZipFile(baseFiles[fh.Name], fh)
+		if err != nil {
+			return fmt.Errorf("cannot create patch: %v", err)
+		}
+		delete(baseFiles, fh.Name)
+		if same {
+			continue
+		}
+		if err := copyZipFile(zipw, fh, fh.Name); err != nil {
+			return fmt.Errorf("cannot create patch: %v", err)
+		}
+	}
+	for name := range baseFiles {
+		doc.Removed = append(doc.Removed, name)
+	}
+	sort.Strings(doc.Removed)
+	data, err := yamlMarshal(doc)
+	if err != nil {
+		return err
+	}
+	h := &zip.FileHeader{
+		Name:   patchFile,
+		Method: zip.Deflate,
+	}
+	h.SetMode(0644)
+	fw, err := zipw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	return zipw.Close()
+}
+
+// sameZipFile reports whether the archive members a and b have the
+// same mode and contents. A nil member is the same as no other.
+func sameZipFile(a, b *zip.File) (bool, error) {
+	if a == nil || b == nil || a.Mode() != b.Mode() {
+		return false, nil
+	}
+	if a.Mode().IsDir() {
+		return true, nil
+	}
+	if a.CRC32 != b.CRC32 || a.UncompressedSize64 != b.UncompressedSize64 {
+		return false, nil
+	}
+	keyA, err := zipFileKey(a)
+	if err != nil {
+		return false, err
+	}
+	keyB, err := zipFileKey(b)
+	if err != nil {
+		return false, err
+	}
+	return keyA == keyB, nil
+}
+
+// archiveDigest returns the SHA256 digest of the given archive.
+func archiveDigest(a *CharmArchive) (Digest, error) {
+	r, err := a.zopen.open()
+	if err != nil {
+		return Digest{}, err
+	}
+	defer r.Close()
+	return NewDigest(SHA256, r)
+}
+
+// ReadCharmPatch returns the patch held in the file at path.
+func ReadCharmPatch(path string) (*CharmPatch, error) {
+	return readCharmPatch(newZipOpenerFromPath(path))
+}
+
+// ReadCharmPatchBytes returns the patch held in data.
+func ReadCharmPatchBytes(data []byte) (*CharmPatch, error) {
+	return readCharmPatch(newZipOpenerFromReader(bytes.NewReader(data), int64(len(data))))
+}
+
+func readCharmPatch(zopen zipOpener) (*CharmPatch, error) {
+	zipr, err := zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	p := &CharmPatch{zopen: zopen}
+	found := false
+	for _, fh := range zipr.File {
+		if fh.Name != patchFile {
+			p.Files = append(p.Files, fh.Name)
+			continue
+		}
+		r, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		var doc patchDoc
+		if err := yamlUnmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("cannot read patch: %v", err)
+		}
+		if doc.Base.IsZero() {
+			return nil, fmt.Errorf("cannot read patch: no base digest")
+		}
+		p.Base = doc.Base
+		p.Removed = doc.Removed
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("archive is not a charm patch: no %s file", patchFile)
+	}
+	sort.Strings(p.Files)
+	return p, nil
+}
+
+// Apply writes to w the archive made by applying the patch to base,
+// which must be the archive the patch was made against. The archive
+// holds the files of base that the patch neither replaces nor
+// removes, followed by the files of the patch. If base records its
+// statistics, as archives written by ArchiveTo do, so does the
+// patched archive; they are computed afresh, as its files differ.
+func (p *CharmPatch) Apply(base *CharmArchive, w io.Writer) error {
+	digest, err := archiveDigest(base)
+	if err != nil {
+		return fmt.Errorf("cannot read base archive: %v", err)
+	}
+	if !digest.Equal(p.Base) {
+		return fmt.Errorf("patch applies to archive %s, not %s", p.Base, digest)
+	}
+	skip := make(map[string]bool)
+	for _, name := range p.Removed {
+		skip[name] = true
+	}
+	for _, name := range p.Files {
+		skip[name] = true
+	}
+	basez, err := base.zopen.openZip()
+	if err != nil {
+		return err
+	}
+	defer basez.Close()
+	patchz, err := p.zopen.openZip()
+	if err != nil {
+		return err
+	}
+	defer patchz.Close()
+	zipw := zip.NewWriter(w)
+	var sw *statsWriter
+	if base.stats != nil {
+		sw = newStatsWriter()
+	}
+	copyFile := func(fh *zip.File) error {
+		if err := copyZipFile(zipw, fh, fh.Name); err != nil {
+			return fmt.Errorf("cannot apply patch: %v", err)
+		}
+		if sw == nil || fh.Mode().IsDir() {
+			return nil
+		}
+		if err := copyStats(sw, fh); err != nil {
+			return fmt.Errorf("cannot apply patch: %v", err)
+		}
+		return nil
+	}
+	for _, fh := range basez.File {
+		if skip[fh.Name] {
+			continue
+		}
+		if err := copyFile(fh); err != nil {
+			return err
+		}
+	}
+	for _, fh := range patchz.File {
+		if fh.Name == patchFile {
+			continue
+		}
+		if err := copyFile(fh); err != nil {
+			return err
+		}
+	}
+	if sw != nil {
+		if err := zipw.SetComment(sw.comment()); err != nil {
+			return err
+		}
+	}
+	return zipw.Close()
+}
+
+// ApplyPatch applies the patch to base as Apply does, writing
+// the patched charm to the file at path, and returns it. The
+// patched charm is written to a temporary file in the same
+// directory and moved into place only once the patch has been
+// applied, so path may name base itself, and any existing file
+// at path is left untouched if the patch cannot be applied.
+func ApplyPatch(base *CharmArchive, p *CharmPatch, path string) (*CharmArchive, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "charm-patch")
+	if err != nil {
+		return nil, err
+	}
+	err = p.Apply(base, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = utils.ReplaceFile(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return ReadCharmArchive(path)
+}
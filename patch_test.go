@@ -0,0 +1,221 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type PatchSuite struct{}
+
+var _ = gc.Suite(&PatchSuite{})
+
+// patchArchives returns archives of the dummy charm before and
+// after changing, adding and removing some of its files.
+func patchArchives(c *gc.C) (base, updated []byte) {
+	dir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	base = archiveBytes(c, dir)
+	writeCharmFile(c, dir, "src/hello.c", "int main() { return 1; }\n", 0644)
+	writeCharmFile(c, dir, "data/extra", "extra\n", 0644)
+	err := os.Remove(filepath.Join(dir, "actions.yaml"))
+	c.Assert(err, gc.IsNil)
+	err = os.Chmod(filepath.Join(dir, "config.yaml"), 0755)
+	c.Assert(err, gc.IsNil)
+	return base, archiveBytes(c, dir)
+}
+
+func archiveBytes(c *gc.C, path string) []byte {
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	err = dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	return buf.Bytes()
+}
+
+func readArchiveBytes(c *gc.C, data []byte) *charm.CharmArchive {
+	archive, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	return archive
+}
+
+// zipContents returns the mode and contents of each
+// member of the given zip archive, keyed by name.
+func zipContents(c *gc.C, data []byte) map[string]string {
+	zipr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.IsNil)
+	files := make(map[string]string)
+	for _, fh := range zipr.File {
+		r, err := fh.Open()
+		c.Assert(err, gc.IsNil)
+		contents, err := ioutil.ReadAll(r)
+		r.Close()
+		c.Assert(err, gc.IsNil)
+		files[fh.Name] = fh.Mode().String() + " " + string(contents)
+	}
+	return files
+}
+
+func (s *PatchSuite) TestCreateAndApplyPatch(c *gc.C) {
+	baseData, updatedData := patchArchives(c)
+	base := readArchiveBytes(c, baseData)
+	var buf bytes.Buffer
+	err := charm.CreatePatch(base, readArchiveBytes(c, updatedData), &buf)
+	c.Assert(err, gc.IsNil)
+
+	p, err := charm.ReadCharmPatchBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	sum := sha256.Sum256(baseData)
+	c.Assert(p.Base, gc.Equals, charm.Digest{
+		Algorithm: charm.SHA256,
+		Hex:       hex.EncodeToString(sum[:]),
+	})
+	c.Assert(p.Files, jc.DeepEquals, []string{"config.yaml", "data/", "data/extra", "src/hello.c"})
+	c.Assert(p.Removed, jc.DeepEquals, []string{"actions.yaml"})
+
+	var patched bytes.Buffer
+	err = p.Apply(base, &patched)
+	c.Assert(err, gc.IsNil)
+	c.Assert(zipContents(c, patched.Bytes()), jc.DeepEquals, zipContents(c, updatedData))
+
+	path := filepath.Join(c.MkDir(), "patched.charm")
+	archive, err := charm.ApplyPatch(base, p, path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Path, gc.Equals, path)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+	c.Assert(archive.Actions(), jc.DeepEquals, charm.NewActions())
+
+	// The patched archive records the statistics of its
+	// own files, as the base archive does.
+	info, err := charm.ReadCharmArchiveMeta(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Stats, gc.NotNil)
+	computed, err := archive.ComputeStats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Stats, jc.DeepEquals, computed)
+	c.Assert(archive.Verify(), gc.IsNil)
+}
+
+func (s *PatchSuite) TestApplyPatchToWrongBase(c *gc.C) {
+	baseData, updatedData := patchArchives(c)
+	var buf bytes.Buffer
+	err := charm.CreatePatch(readArchiveBytes(c, baseData), readArchiveBytes(c, updatedData), &buf)
+	c.Assert(err, gc.IsNil)
+	p, err := charm.ReadCharmPatchBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	path := filepath.Join(c.MkDir(), "patched.charm")
+	_, err = charm.ApplyPatch(readArchiveBytes(c, updatedData), p, path)
+	c.Assert(err, gc.ErrorMatches, `patch applies to archive .*`)
+	_, err = os.Stat(path)
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (s *PatchSuite) TestApplyPatchInPlace(c *gc.C) {
+	baseData, updatedData := patchArchives(c)
+	var buf bytes.Buffer
+	err := charm.CreatePatch(readArchiveBytes(c, baseData), readArchiveBytes(c, updatedData), &buf)
+	c.Assert(err, gc.IsNil)
+	p, err := charm.ReadCharmPatchBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+
+	dir := c.MkDir()
+	path := filepath.Join(dir, "dummy.charm")
+	err = ioutil.WriteFile(path, baseData, 0644)
+	c.Assert(err, gc.IsNil)
+	base, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ApplyPatch(base, p, path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Path, gc.Equals, path)
+	c.Assert(archive.Actions(), jc.DeepEquals, charm.NewActions())
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(zipContents(c, data), jc.DeepEquals, zipContents(c, updatedData))
+
+	// No temporary files are left behind.
+	infos, err := ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 1)
+}
+
+func (s *PatchSuite) TestApplyPatchFailureLeavesDestination(c *gc.C) {
+	baseData, updatedData := patchArchives(c)
+	var buf bytes.Buffer
+	err := charm.CreatePatch(readArchiveBytes(c, baseData), readArchiveBytes(c, updatedData), &buf)
+	c.Assert(err, gc.IsNil)
+	p, err := charm.ReadCharmPatchBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+
+	dir := c.MkDir()
+	path := filepath.Join(dir, "patched.charm")
+	err = ioutil.WriteFile(path, []byte("existing"), 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.ApplyPatch(readArchiveBytes(c, updatedData), p, path)
+	c.Assert(err, gc.ErrorMatches, `patch applies to archive .*`)
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "existing")
+	infos, err := ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 1)
+}
+
+func (s *PatchSuite) TestReadCharmPatchFile(c *gc.C) {
+	baseData, updatedData := patchArchives(c)
+	path := filepath.Join(c.MkDir(), "dummy.patch")
+	f, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	err = charm.CreatePatch(readArchiveBytes(c, baseData), readArchiveBytes(c, updatedData), f)
+	c.Assert(err, gc.IsNil)
+	err = f.Close()
+	c.Assert(err, gc.IsNil)
+
+	p, err := charm.ReadCharmPatch(path)
+	c.Assert(err, gc.IsNil)
+	var patched bytes.Buffer
+	err = p.Apply(readArchiveBytes(c, baseData), &patched)
+	c.Assert(err, gc.IsNil)
+	c.Assert(zipContents(c, patched.Bytes()), jc.DeepEquals, zipContents(c, updatedData))
+}
+
+func (s *PatchSuite) TestEmptyPatch(c *gc.C) {
+	baseData, _ := patchArchives(c)
+	base := readArchiveBytes(c, baseData)
+	var buf bytes.Buffer
+	err := charm.CreatePatch(base, base, &buf)
+	c.Assert(err, gc.IsNil)
+	p, err := charm.ReadCharmPatchBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	c.Assert(p.Files, gc.HasLen, 0)
+	c.Assert(p.Removed, gc.HasLen, 0)
+}
+
+func (s *PatchSuite) TestApplyToWrongBase(c *gc.C) {
+	baseData, updatedData := patchArchives(c)
+	var buf bytes.Buffer
+	err := charm.CreatePatch(readArchiveBytes(c, baseData), readArchiveBytes(c, updatedData), &buf)
+	c.Assert(err, gc.IsNil)
+	p, err := charm.ReadCharmPatchBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	err = p.Apply(readArchiveBytes(c, updatedData), ioutil.Discard)
+	c.Assert(err, gc.ErrorMatches, `patch applies to archive sha256:[0-9a-f]{64}, not sha256:[0-9a-f]{64}`)
+}
+
+func (s *PatchSuite) TestReadCharmPatchNotPatch(c *gc.C) {
+	baseData, _ := patchArchives(c)
+	_, err := charm.ReadCharmPatchBytes(baseData)
+	c.Assert(err, gc.ErrorMatches, `archive is not a charm patch: no .charm-patch.yaml file`)
+}
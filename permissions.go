@@ -0,0 +1,107 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// PermissionChange describes a change made by NormalizePermissions.
+type PermissionChange struct {
+	// Path holds the slash-separated path of the
+	// file relative to the charm root.
+	Path string
+
+	// Old and New hold the permission bits of the
+	// file before and after the change.
+	Old, New os.FileMode
+}
+
+// NormalizePermissions gives the files in the charm directory their
+// canonical modes: 0755 for directories, for hooks, actions and
+// probes, for the dispatch script, for the files that hooks are
+// symbolic links to and for files that are executable by anyone, and
+// 0644 for other files. Hooks, actions and probes are recognized by
+// the names declared for them. It returns the changes
+// made, in the order of the files' paths.
+//
+// Normalizing permissions before archiving ensures that checkouts
+// that lose executable bits, such as those made on Windows or by some
+// version control tools, do not produce charms with hooks that cannot
+// be run. Hidden files, the build directory and symbolic links are
+// left alone, as ArchiveTo leaves them out or keeps them as they are.
+func (dir *CharmDir) NormalizePermissions() ([]PermissionChange, error) {
+	if dir.readOnly {
+		return nil, ErrReadOnly
+	}
+	probes := make(map[string]bool)
+	for name := range dir.Meta().Probes {
+		probes[name] = true
+	}
+	executables := map[string]map[string]bool{
+		HooksDir:   dir.Meta().Hooks(),
+		ActionsDir: actionNames(dir.Actions()),
+		ProbesDir:  probes,
+	}
+	root, err := resolveSymlinkedRoot(dir.Path)
+	if err != nil {
+		return nil, err
+	}
+	linkTargets, err := hookLinkTargets(root, dir.Meta().Hooks())
+	if err != nil {
+		return nil, err
+	}
+	var changes []PermissionChange
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relpath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if relpath == "." {
+			return nil
+		}
+		relpath = filepath.ToSlash(relpath)
+		mode := info.Mode()
+		if relpath[0] == '.' || relpath == "build" && mode.IsDir() {
+			if mode.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		var perm os.FileMode
+		switch {
+		case mode.IsDir():
+			perm = 0755
+		case !mode.IsRegular():
+			return nil
+		case mode&0111 != 0,
+			relpath == DispatchFile,
+			linkTargets[relpath],
+			executables[filepath.ToSlash(filepath.Dir(relpath))][filepath.Base(relpath)]:
+			perm = 0755
+		default:
+			perm = 0644
+		}
+		if mode&os.ModePerm == perm && mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky) == 0 {
+			return nil
+		}
+		if err := os.Chmod(path, perm); err != nil {
+			return err
+		}
+		changes = append(changes, PermissionChange{
+			Path: relpath,
+			Old:  mode.Perm(),
+			New:  perm,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type PermissionsSuite struct{}
+
+var _ = gc.Suite(&PermissionsSuite{})
+
+func (s *PermissionsSuite) TestNormalizePermissions(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	// Start from canonical modes.
+	_, err := dir.NormalizePermissions()
+	c.Assert(err, gc.IsNil)
+
+	chmod := func(path string, mode os.FileMode) {
+		err := os.Chmod(filepath.Join(dir.Path, filepath.FromSlash(path)), mode)
+		c.Assert(err, gc.IsNil)
+	}
+	chmod("hooks/install", 0644)
+	chmod("config.yaml", 0600)
+	chmod("src", 0700)
+	writeCharmFile(c, dir.Path, "hooks/start", "#!/bin/sh\n", 0600)
+	writeCharmFile(c, dir.Path, "hooks/common.sh", "", 0644)
+	writeCharmFile(c, dir.Path, "actions/snapshot", "#!/bin/sh\n", 0644)
+	writeCharmFile(c, dir.Path, "bin/tool", "#!/bin/sh\n", 0700)
+	writeCharmFile(c, dir.Path, "dispatch", "#!/bin/sh\n", 0644)
+	writeCharmFile(c, dir.Path, ".git/config", "", 0600)
+	chmod("hooks/common.sh", 0664)
+	chmod("bin", 0755)
+
+	changes, err := dir.NormalizePermissions()
+	c.Assert(err, gc.IsNil)
+	c.Assert(changes, jc.DeepEquals, []charm.PermissionChange{
+		{"actions/snapshot", 0644, 0755},
+		{"bin/tool", 0700, 0755},
+		{"config.yaml", 0600, 0644},
+		{"dispatch", 0644, 0755},
+		{"hooks/common.sh", 0664, 0644},
+		{"hooks/install", 0644, 0755},
+		{"hooks/start", 0600, 0755},
+		{"src", 0700, 0755},
+	})
+	info, err := os.Stat(filepath.Join(dir.Path, "hooks", "start"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0755))
+	info, err = os.Stat(filepath.Join(dir.Path, ".git", "config"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+
+	changes, err = dir.NormalizePermissions()
+	c.Assert(err, gc.IsNil)
+	c.Assert(changes, gc.HasLen, 0)
+}
@@ -0,0 +1,279 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/juju/schema"
+)
+
+// Policy holds the criteria that a charm must meet to be accepted,
+// for example by a charm store, as read from a policy document by
+// ReadPolicy. Criteria left empty are not checked.
+type Policy struct {
+	// AllowedInterfaces holds patterns, in the syntax of
+	// path.Match, matching the names of the interfaces the
+	// charm's relations may use.
+	AllowedInterfaces []string
+
+	// ForbiddenFiles holds patterns, in the syntax of path.Match,
+	// matching the slash-separated paths of files the charm may
+	// not hold. A pattern holding no slash is matched against
+	// the name of files in any directory. A file is also forbidden
+	// when any directory holding it is, whether or not the charm
+	// holds an entry for the directory itself.
+	ForbiddenFiles []string
+
+	// MaxSize holds the maximum total size, in bytes, of the
+	// charm's files, uncompressed.
+	MaxSize int64
+
+	// MemberNames holds how problems with the names of the
+	// charm's files found by CheckMemberNames are treated:
+	// MemberNamesIgnore, MemberNamesWarn or MemberNamesReject.
+	MemberNames string
+
+	// RequiredFields holds the fields that the charm must
+	// provide; see PolicyFields.
+	RequiredFields []string
+}
+
+// PolicyFields holds the fields that may be required by a policy,
+// along with a description of what each requires.
+var PolicyFields = map[string]string{
+	"summary":     "a summary in the metadata",
+	"description": "a description in the metadata",
+	"categories":  "categories in the metadata",
+	"tags":        "tags in the metadata",
+	"series":      "a series or bases in the metadata",
+	"config":      "configuration options",
+	"actions":     "actions",
+	"icon":        "an icon.svg file",
+	"readme":      "a README file",
+}
+
+// PolicyResult holds the result of evaluating a charm against a policy.
+type PolicyResult struct {
+	// Pass holds whether the charm meets the policy.
+	Pass bool
+
+	// Reasons holds the reasons the charm does not meet
+	// the policy, if any.
+	Reasons []string
+
+	// Warnings holds problems found in the charm that
+	// do not prevent it from meeting the policy.
+	Warnings []string
+}
+
+var policySchema = schema.StrictFieldMap(
+	schema.Fields{
+		"allowed-interfaces": schema.List(schema.String()),
+		"forbidden-files":    schema.List(schema.String()),
+		"max-size":           schema.Int(),
+		"member-names":       schema.String(),
+		"required-fields":    schema.List(schema.String()),
+	},
+	schema.Defaults{
+		"allowed-interfaces": schema.Omit,
+		"forbidden-files":    schema.Omit,
+		"max-size":           int64(0),
+		"member-names":       MemberNamesIgnore,
+		"required-fields":    schema.Omit,
+	},
+)
+
+// ReadPolicy reads a policy document in YAML format:
+//
+//	allowed-interfaces: [http, mysql, "juju-*"]
+//	forbidden-files: ["*.pyc", .git]
+//	max-size: 10485760
+//	member-names: reject
+//	required-fields: [summary, icon, readme]
+//
+// Unknown keys are rejected, so that a mistyped criterion is
+// not silently ignored.
+func ReadPolicy(r io.Reader) (*Policy, error) {
+	data, release, err := readYAMLSource(r)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	raw := make(map[interface{}]interface{})
+	if err := yamlUnmarshal(data, raw); err != nil {
+		return nil, err
+	}
+	v, err := policySchema.Coerce(raw, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+	m := v.(map[string]interface{})
+	p := &Policy{
+		AllowedInterfaces: parseStringList(m["allowed-interfaces"]),
+		ForbiddenFiles:    parseStringList(m["forbidden-files"]),
+		MaxSize:           m["max-size"].(int64),
+		MemberNames:       m["member-names"].(string),
+		RequiredFields:    parseStringList(m["required-fields"]),
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+	return p, nil
+}
+
+// Validate checks that the policy is well-formed.
+func (p *Policy) Validate() error {
+	for _, patterns := range [][]string{p.AllowedInterfaces, p.ForbiddenFiles} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("bad pattern %q", pattern)
+			}
+		}
+	}
+	if p.MaxSize < 0 {
+		return fmt.Errorf("negative maximum size %d", p.MaxSize)
+	}
+	switch p.MemberNames {
+	case MemberNamesIgnore, MemberNamesWarn, MemberNamesReject:
+	default:
+		return fmt.Errorf("unknown member-names treatment %q", p.MemberNames)
+	}
+	for _, field := range p.RequiredFields {
+		if _, ok := PolicyFields[field]; !ok {
+			return fmt.Errorf("unknown required field %q", field)
+		}
+	}
+	return nil
+}
+
+// Evaluate evaluates the given charm, which must be a *CharmDir or a
+// *CharmArchive, against the policy. It returns an error only if the
+// charm cannot be read.
+func (p *Policy) Evaluate(ch Charm) (*PolicyResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	var reasons, warnings []string
+	files := make(map[string]bool)
+	names := make([]string, 0, len(zipr.File))
+	var size int64
+	for _, fh := range zipr.File {
+		names = append(names, fh.Name)
+		name := strings.TrimSuffix(fh.Name, "/")
+		files[name] = true
+		size += int64(fh.UncompressedSize64)
+		if pattern, ok := p.forbidden(name); ok {
+			reasons = append(reasons, fmt.Sprintf("file %q is forbidden by %q", name, pattern))
+		}
+	}
+	if p.MemberNames != MemberNamesIgnore {
+		for _, problem := range memberNameProblems(names) {
+			if p.MemberNames == MemberNamesReject {
+				reasons = append(reasons, problem.problem)
+			} else {
+				warnings = append(warnings, problem.problem)
+			}
+		}
+	}
+	if p.MaxSize > 0 && size > p.MaxSize {
+		reasons = append(reasons, fmt.Sprintf("charm size %d exceeds maximum %d", size, p.MaxSize))
+	}
+	if len(p.AllowedInterfaces) > 0 {
+		reasons = append(reasons, p.checkInterfaces(ch.Meta())...)
+	}
+	for _, field := range p.RequiredFields {
+		if !hasPolicyField(ch, field, files) {
+			reasons = append(reasons, fmt.Sprintf("charm lacks %s", PolicyFields[field]))
+		}
+	}
+	return &PolicyResult{
+		Pass:     len(reasons) == 0,
+		Reasons:  reasons,
+		Warnings: warnings,
+	}, nil
+}
+
+// forbidden returns the pattern forbidding the file
+// with the given name, or any directory holding it, if any.
+func (p *Policy) forbidden(name string) (string, bool) {
+	for _, pattern := range p.ForbiddenFiles {
+		hasSlash := strings.Contains(pattern, "/")
+		for target := name; target != "." && target != "/"; target = path.Dir(target) {
+			candidate := target
+			if !hasSlash {
+				candidate = path.Base(target)
+			}
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return pattern, true
+			}
+		}
+	}
+	return "", false
+}
+
+// checkInterfaces returns a reason for each relation
+// using an interface the policy does not allow.
+func (p *Policy) checkInterfaces(meta *Meta) []string {
+	var reasons []string
+	for _, rels := range []map[string]Relation{meta.Provides, meta.Requires, meta.Peers} {
+		for name, rel := range rels {
+			iface := rel.ParsedInterface().Name
+			allowed := false
+			for _, pattern := range p.AllowedInterfaces {
+				if ok, _ := path.Match(pattern, iface); ok {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				reasons = append(reasons, fmt.Sprintf("relation %q uses interface %q, which is not allowed", name, iface))
+			}
+		}
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// hasPolicyField reports whether the charm, holding
+// the given files, provides the given field.
+func hasPolicyField(ch Charm, field string, files map[string]bool) bool {
+	meta := ch.Meta()
+	switch field {
+	case "summary":
+		return strings.TrimSpace(meta.Summary) != ""
+	case "description":
+		return strings.TrimSpace(meta.Description) != ""
+	case "categories":
+		return len(meta.Categories) > 0
+	case "tags":
+		return len(meta.Tags) > 0
+	case "series":
+		return meta.Series != "" || len(meta.Bases) > 0
+	case "config":
+		config := ch.Config()
+		return config != nil && len(config.Options) > 0
+	case "actions":
+		actions := ch.Actions()
+		return actions != nil && len(actions.ActionSpecs) > 0
+	case "icon":
+		return files["icon.svg"]
+	case "readme":
+		for name := range files {
+			if !strings.Contains(name, "/") && strings.HasPrefix(strings.ToLower(name), "readme") {
+				return true
+			}
+		}
+	}
+	return false
+}
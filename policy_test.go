@@ -0,0 +1,137 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type PolicySuite struct{}
+
+var _ = gc.Suite(&PolicySuite{})
+
+func (s *PolicySuite) TestReadPolicy(c *gc.C) {
+	p, err := charm.ReadPolicy(strings.NewReader(`
+allowed-interfaces: [http, mysql, "juju-*"]
+forbidden-files: ["*.pyc", .git]
+max-size: 10485760
+member-names: warn
+required-fields: [summary, icon, readme]
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(p, jc.DeepEquals, &charm.Policy{
+		AllowedInterfaces: []string{"http", "mysql", "juju-*"},
+		ForbiddenFiles:    []string{"*.pyc", ".git"},
+		MaxSize:           10485760,
+		MemberNames:       charm.MemberNamesWarn,
+		RequiredFields:    []string{"summary", "icon", "readme"},
+	})
+
+	p, err = charm.ReadPolicy(strings.NewReader("{}"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(p, jc.DeepEquals, &charm.Policy{})
+}
+
+var invalidPolicyTests = []struct {
+	yaml string
+	err  string
+}{{
+	yaml: "max-sise: 10",
+	err:  `invalid policy: unknown key "max-sise" \(value 10\)`,
+}, {
+	yaml: "max-size: -1",
+	err:  `invalid policy: negative maximum size -1`,
+}, {
+	yaml: "required-fields: [maintainer]",
+	err:  `invalid policy: unknown required field "maintainer"`,
+}, {
+	yaml: `forbidden-files: ["[a"]`,
+	err:  `invalid policy: bad pattern "\[a"`,
+}, {
+	yaml: "member-names: fix",
+	err:  `invalid policy: unknown member-names treatment "fix"`,
+}}
+
+func (s *PolicySuite) TestReadInvalidPolicy(c *gc.C) {
+	for i, test := range invalidPolicyTests {
+		c.Logf("test %d: %s", i, test.yaml)
+		_, err := charm.ReadPolicy(strings.NewReader(test.yaml))
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *PolicySuite) TestEvaluatePass(c *gc.C) {
+	p := &charm.Policy{
+		AllowedInterfaces: []string{"http", "logging", "monitoring", "mysql", "varnish"},
+		ForbiddenFiles:    []string{"*.pyc"},
+		MaxSize:           1 << 20,
+		RequiredFields:    []string{"summary", "description", "config"},
+	}
+	for _, ch := range []charm.Charm{
+		charmtesting.Charms.CharmDir("wordpress"),
+		charmtesting.Charms.CharmArchive(c.MkDir(), "wordpress"),
+	} {
+		result, err := p.Evaluate(ch)
+		c.Assert(err, gc.IsNil)
+		c.Assert(result, jc.DeepEquals, &charm.PolicyResult{Pass: true})
+	}
+}
+
+func (s *PolicySuite) TestEvaluateFail(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "wordpress")
+	writeCharmFile(c, dir.Path, "hooks/lib/util.pyc", "compiled", 0644)
+	p := &charm.Policy{
+		AllowedInterfaces: []string{"http", "m*"},
+		ForbiddenFiles:    []string{"*.pyc", "actions"},
+		MaxSize:           10,
+		RequiredFields:    []string{"summary", "icon", "readme", "tags"},
+	}
+	result, err := p.Evaluate(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Pass, jc.IsFalse)
+	c.Assert(result.Reasons, gc.HasLen, 9)
+	c.Assert(result.Reasons[3], gc.Matches, `charm size [0-9]+ exceeds maximum 10`)
+	result.Reasons[3] = ""
+	c.Assert(result.Reasons, jc.DeepEquals, []string{
+		`file "actions" is forbidden by "actions"`,
+		`file "actions/.gitkeep" is forbidden by "actions"`,
+		`file "hooks/lib/util.pyc" is forbidden by "*.pyc"`,
+		"",
+		`relation "cache" uses interface "varnish", which is not allowed`,
+		`relation "logging-dir" uses interface "logging", which is not allowed`,
+		"charm lacks an icon.svg file",
+		"charm lacks a README file",
+		"charm lacks tags in the metadata",
+	})
+}
+
+func (s *PolicySuite) TestEvaluateForbiddenDirectory(c *gc.C) {
+	// The archive holds no entry for the .git
+	// directory or the config/ directory.
+	data := writeZip(c,
+		[2]string{"metadata.yaml", "name: dummy\nsummary: s\ndescription: d\n"},
+		[2]string{".git/config", "[core]\n"},
+		[2]string{"config/.git/HEAD", "ref: refs/heads/master\n"},
+		[2]string{"src/secrets/key.pem", "key"},
+	)
+	archive, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	p := &charm.Policy{
+		ForbiddenFiles: []string{".git", "src/secrets"},
+	}
+	result, err := p.Evaluate(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Pass, jc.IsFalse)
+	c.Assert(result.Reasons, jc.DeepEquals, []string{
+		`file ".git/config" is forbidden by ".git"`,
+		`file "config/.git/HEAD" is forbidden by ".git"`,
+		`file "src/secrets/key.pem" is forbidden by "src/secrets"`,
+	})
+}
@@ -0,0 +1,221 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/juju/schema"
+)
+
+// PortRange describes a range of ports that a charm's workload
+// listens on and that may be exposed, as declared in the
+// exposed-ports field of its metadata. Declaring ports lets
+// firewalling tools derive rules from the charm rather than
+// waiting for its hooks to open them.
+type PortRange struct {
+	// FromPort and ToPort hold the first and last port of
+	// the range. Both are zero for the icmp protocol.
+	FromPort int
+	ToPort   int
+
+	// Protocol holds the protocol of the ports;
+	// one of "tcp", "udp" or "icmp".
+	Protocol string
+
+	// Purpose optionally describes what the ports are used for.
+	Purpose string `bson:",omitempty"`
+}
+
+// validProtocols holds the protocols that ports may be declared with.
+var validProtocols = map[string]bool{
+	"tcp":  true,
+	"udp":  true,
+	"icmp": true,
+}
+
+// ParsePortRange parses a port range in the form "80/tcp",
+// "8000-8080/udp" or "icmp". The protocol defaults to tcp
+// if it is omitted.
+func ParsePortRange(s string) (PortRange, error) {
+	ports, protocol := s, "tcp"
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		ports, protocol = s[:i], s[i+1:]
+	} else if s == "icmp" {
+		ports, protocol = "", s
+	}
+	pr := PortRange{
+		Protocol: strings.ToLower(protocol),
+	}
+	if ports != "" {
+		from, to := ports, ports
+		if i := strings.Index(ports, "-"); i >= 0 {
+			from, to = ports[:i], ports[i+1:]
+		}
+		var err1, err2 error
+		pr.FromPort, err1 = strconv.Atoi(from)
+		pr.ToPort, err2 = strconv.Atoi(to)
+		if err1 != nil || err2 != nil {
+			return PortRange{}, fmt.Errorf("invalid port range %q", s)
+		}
+	}
+	if err := pr.Validate(); err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q: %v", s, err)
+	}
+	return pr, nil
+}
+
+// Validate checks that the port range is well-formed.
+func (pr PortRange) Validate() error {
+	if !validProtocols[pr.Protocol] {
+		return fmt.Errorf("unknown protocol %q", pr.Protocol)
+	}
+	if pr.Protocol == "icmp" {
+		if pr.FromPort != 0 || pr.ToPort != 0 {
+			return fmt.Errorf("icmp does not use ports")
+		}
+		return nil
+	}
+	if pr.FromPort < 1 || pr.ToPort > 65535 {
+		return fmt.Errorf("ports must be between 1 and 65535")
+	}
+	if pr.FromPort > pr.ToPort {
+		return fmt.Errorf("first port is greater than last port")
+	}
+	return nil
+}
+
+// String returns the port range in the form accepted by ParsePortRange.
+// The purpose is not included.
+func (pr PortRange) String() string {
+	switch {
+	case pr.Protocol == "icmp":
+		return pr.Protocol
+	case pr.FromPort == pr.ToPort:
+		return fmt.Sprintf("%d/%s", pr.FromPort, pr.Protocol)
+	}
+	return fmt.Sprintf("%d-%d/%s", pr.FromPort, pr.ToPort, pr.Protocol)
+}
+
+// Overlaps reports whether the two port ranges
+// have a port, or the icmp protocol, in common.
+func (pr PortRange) Overlaps(other PortRange) bool {
+	if pr.Protocol != other.Protocol {
+		return false
+	}
+	if pr.Protocol == "icmp" {
+		return true
+	}
+	return pr.FromPort <= other.ToPort && other.FromPort <= pr.ToPort
+}
+
+// checkExposedPorts checks that the given port ranges
+// are valid and that no two of them overlap.
+func checkExposedPorts(ports []PortRange) error {
+	for i, pr := range ports {
+		if err := pr.Validate(); err != nil {
+			return fmt.Errorf("invalid exposed port %q: %v", pr, err)
+		}
+		for _, other := range ports[:i] {
+			if pr.Overlaps(other) {
+				return fmt.Errorf("exposed ports %q and %q overlap", other, pr)
+			}
+		}
+	}
+	return nil
+}
+
+// encodeExposedPorts returns the metadata.yaml representation of the
+// given port ranges, using the short form for ranges with no purpose.
+func encodeExposedPorts(ports []PortRange) []interface{} {
+	result := make([]interface{}, len(ports))
+	for i, pr := range ports {
+		if pr.Purpose == "" {
+			result[i] = pr.String()
+			continue
+		}
+		m := map[string]interface{}{
+			"protocol": pr.Protocol,
+			"purpose":  pr.Purpose,
+		}
+		if pr.Protocol != "icmp" {
+			if pr.FromPort == pr.ToPort {
+				m["port"] = pr.FromPort
+			} else {
+				m["port"] = fmt.Sprintf("%d-%d", pr.FromPort, pr.ToPort)
+			}
+		}
+		result[i] = m
+	}
+	return result
+}
+
+// exposedPortsC coerces the exposed-ports and networking fields of
+// the metadata into a []PortRange. Each entry is either a port range
+// in the form accepted by ParsePortRange or a map holding the port
+// or range of ports, the protocol and the purpose of the ports:
+//
+//	exposed-ports:
+//	  - 80/tcp
+//	  - 8000-8080/udp
+//	  - port: 443
+//	    protocol: tcp
+//	    purpose: HTTPS
+type exposedPortsC struct{}
+
+var (
+	exposedPortsListC = schema.List(schema.Any())
+	exposedPortMapC   = schema.FieldMap(
+		schema.Fields{
+			"port":     schema.OneOf(schema.Int(), schema.String()),
+			"protocol": schema.String(),
+			"purpose":  schema.String(),
+		},
+		schema.Defaults{
+			"port":     schema.Omit,
+			"protocol": "tcp",
+			"purpose":  "",
+		},
+	)
+)
+
+func (exposedPortsC) Coerce(v interface{}, path []string) (interface{}, error) {
+	list, err := exposedPortsListC.Coerce(v, path)
+	if err != nil {
+		return nil, err
+	}
+	var ports []PortRange
+	for i, item := range list.([]interface{}) {
+		itemPath := append(path[:len(path):len(path)], "[", strconv.Itoa(i), "]")
+		if s, ok := item.(string); ok {
+			pr, err := ParsePortRange(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s%v", schemaPathPrefix(itemPath), err)
+			}
+			ports = append(ports, pr)
+			continue
+		}
+		m, err := exposedPortMapC.Coerce(item, itemPath)
+		if err != nil {
+			return nil, err
+		}
+		fields := m.(map[string]interface{})
+		s := fields["protocol"].(string)
+		if port, ok := fields["port"]; ok {
+			s = fmt.Sprint(port) + "/" + s
+		} else if s != "icmp" {
+			portPath := append(itemPath, ".", "port")
+			return nil, fmt.Errorf("%sexpected port, got nothing", schemaPathPrefix(portPath))
+		}
+		pr, err := ParsePortRange(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s%v", schemaPathPrefix(itemPath), err)
+		}
+		pr.Purpose = fields["purpose"].(string)
+		ports = append(ports, pr)
+	}
+	return ports, nil
+}
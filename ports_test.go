@@ -0,0 +1,169 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type PortsSuite struct{}
+
+var _ = gc.Suite(&PortsSuite{})
+
+var parsePortRangeTests = []struct {
+	s      string
+	expect charm.PortRange
+	str    string
+	err    string
+}{{
+	s:      "80/tcp",
+	expect: charm.PortRange{FromPort: 80, ToPort: 80, Protocol: "tcp"},
+}, {
+	s:      "8000-8080/udp",
+	expect: charm.PortRange{FromPort: 8000, ToPort: 8080, Protocol: "udp"},
+}, {
+	s:      "443",
+	expect: charm.PortRange{FromPort: 443, ToPort: 443, Protocol: "tcp"},
+	str:    "443/tcp",
+}, {
+	s:      "53/UDP",
+	expect: charm.PortRange{FromPort: 53, ToPort: 53, Protocol: "udp"},
+	str:    "53/udp",
+}, {
+	s:      "icmp",
+	expect: charm.PortRange{Protocol: "icmp"},
+}, {
+	s:   "80/sctp",
+	err: `invalid port range "80/sctp": unknown protocol "sctp"`,
+}, {
+	s:   "http/tcp",
+	err: `invalid port range "http/tcp"`,
+}, {
+	s:   "0/tcp",
+	err: `invalid port range "0/tcp": ports must be between 1 and 65535`,
+}, {
+	s:   "65536/tcp",
+	err: `invalid port range "65536/tcp": ports must be between 1 and 65535`,
+}, {
+	s:   "8080-8000/tcp",
+	err: `invalid port range "8080-8000/tcp": first port is greater than last port`,
+}, {
+	s:   "80/icmp",
+	err: `invalid port range "80/icmp": icmp does not use ports`,
+}}
+
+func (s *PortsSuite) TestParsePortRange(c *gc.C) {
+	for i, test := range parsePortRangeTests {
+		c.Logf("test %d: %q", i, test.s)
+		pr, err := charm.ParsePortRange(test.s)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(pr, gc.Equals, test.expect)
+		str := test.str
+		if str == "" {
+			str = test.s
+		}
+		c.Assert(pr.String(), gc.Equals, str)
+	}
+}
+
+var overlapsTests = []struct {
+	a, b     string
+	overlaps bool
+}{
+	{"80/tcp", "80/tcp", true},
+	{"80/tcp", "80/udp", false},
+	{"8000-8080/tcp", "8080/tcp", true},
+	{"8000-8080/tcp", "8081-8090/tcp", false},
+	{"8000-8080/tcp", "7000-9000/tcp", true},
+	{"icmp", "icmp", true},
+}
+
+func (s *PortsSuite) TestOverlaps(c *gc.C) {
+	for i, test := range overlapsTests {
+		c.Logf("test %d: %s %s", i, test.a, test.b)
+		a, err := charm.ParsePortRange(test.a)
+		c.Assert(err, gc.IsNil)
+		b, err := charm.ParsePortRange(test.b)
+		c.Assert(err, gc.IsNil)
+		c.Assert(a.Overlaps(b), gc.Equals, test.overlaps)
+		c.Assert(b.Overlaps(a), gc.Equals, test.overlaps)
+	}
+}
+
+const exposedPortsMeta = `
+name: ported
+summary: s
+description: d
+exposed-ports:
+  - 80/tcp
+  - {port: 443, purpose: HTTPS}
+  - {port: 8000-8080, protocol: udp, purpose: Streaming.}
+networking:
+  - icmp
+`
+
+func (s *PortsSuite) TestReadExposedPorts(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(exposedPortsMeta))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.ExposedPorts, jc.DeepEquals, []charm.PortRange{
+		{FromPort: 80, ToPort: 80, Protocol: "tcp"},
+		{FromPort: 443, ToPort: 443, Protocol: "tcp", Purpose: "HTTPS"},
+		{FromPort: 8000, ToPort: 8080, Protocol: "udp", Purpose: "Streaming."},
+		{Protocol: "icmp"},
+	})
+}
+
+func (s *PortsSuite) TestExposedPortsSaved(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	meta, err := charm.ReadMeta(strings.NewReader(exposedPortsMeta))
+	c.Assert(err, gc.IsNil)
+	dir.SetMeta(meta)
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+	saved, err := charm.ReadCharmDir(dir.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(saved.Meta().ExposedPorts, jc.DeepEquals, meta.ExposedPorts)
+}
+
+var invalidExposedPortsTests = []struct {
+	ports string
+	err   string
+}{{
+	ports: "80/tcp",
+	err:   `.*exposed-ports: expected list, got .*`,
+}, {
+	ports: "[80/sctp]",
+	err:   `.*exposed-ports\[0\]: invalid port range "80/sctp": unknown protocol "sctp"`,
+}, {
+	ports: "[{protocol: tcp}]",
+	err:   `.*exposed-ports\[0\].port: expected port, got nothing`,
+}, {
+	ports: "[80/tcp, {port: 70000}]",
+	err:   `.*exposed-ports\[1\]: invalid port range "70000/tcp": ports must be between 1 and 65535`,
+}, {
+	ports: "[8000-8080/tcp, 8080/tcp]",
+	err:   `charm "ported" has exposed ports "8000-8080/tcp" and "8080/tcp" overlap`,
+}}
+
+func (s *PortsSuite) TestInvalidExposedPorts(c *gc.C) {
+	for i, test := range invalidExposedPortsTests {
+		c.Logf("test %d: %s", i, test.ports)
+		_, err := charm.ReadMeta(strings.NewReader(`
+name: ported
+summary: s
+description: d
+exposed-ports: ` + test.ports + "\n"))
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/juju/schema"
+)
+
+// The kinds of probe a charm may declare.
+const (
+	// ProbeReadiness is the kind of probes that check whether
+	// the charm's workload is ready to serve its clients.
+	ProbeReadiness = "readiness"
+
+	// ProbeLiveness is the kind of probes that check whether
+	// the charm's workload is healthy, or should be restarted.
+	ProbeLiveness = "liveness"
+)
+
+// Probe describes a check of the charm's workload provided by the
+// charm's author, as declared in the probes field of its metadata:
+//
+//	probes:
+//	  ready:
+//	    kind: readiness
+//	    interval: 10s
+//	    timeout: 5s
+//	  alive:
+//	    kind: liveness
+//
+// Each probe is run by executing the script with the probe's name in
+// the charm's probes directory; see ProbePath. The probe passes if the
+// script exits with status zero. Durations are given as strings such
+// as "5m" or as a number of seconds. Zero durations mean the defaults
+// of the orchestration layer apply.
+type Probe struct {
+	// Kind holds the kind of the probe, ProbeReadiness
+	// or ProbeLiveness.
+	Kind string
+
+	// Interval holds the time to wait between runs
+	// of the probe.
+	Interval time.Duration `bson:",omitempty"`
+
+	// Timeout holds the time after which a run of the
+	// probe is abandoned and considered to have failed.
+	Timeout time.Duration `bson:",omitempty"`
+}
+
+// validProbeName matches valid probe names.
+var validProbeName = regexp.MustCompile("^[a-z][a-z0-9]*(-[a-z0-9]+)*$")
+
+// checkProbes checks that each of the given probes
+// has a valid name, kind and durations.
+func checkProbes(probes map[string]Probe) error {
+	for _, name := range sortedProbes(probes) {
+		probe := probes[name]
+		switch {
+		case !validProbeName.MatchString(name):
+			return fmt.Errorf("invalid probe name %q", name)
+		case probe.Kind != ProbeReadiness && probe.Kind != ProbeLiveness:
+			return fmt.Errorf("probe %q has unknown kind %q", name, probe.Kind)
+		case probe.Interval < 0 || probe.Timeout < 0:
+			return fmt.Errorf("probe %q has negative duration", name)
+		case probe.Interval > 0 && probe.Timeout > probe.Interval:
+			return fmt.Errorf("probe %q has timeout longer than its interval", name)
+		}
+	}
+	return nil
+}
+
+// CheckProbeScripts checks that the given charm, which must be a
+// *CharmDir or a *CharmArchive, holds an executable script for each
+// probe declared in its metadata.
+func CheckProbeScripts(ch Charm) error {
+	probes := ch.Meta().Probes
+	if len(probes) == 0 {
+		return nil
+	}
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return err
+	}
+	defer zipr.Close()
+	files := zipFilesByName(zipr.File)
+	for _, name := range sortedProbes(probes) {
+		path := ProbePath(name)
+		fh, ok := files[path]
+		if !ok {
+			return fmt.Errorf("probe %q has no script %q", name, path)
+		}
+		// Probe scripts, like hooks, may be links
+		// to a script shared with other probes.
+		script, err := resolveZipLink(files, fh)
+		if err != nil {
+			return fmt.Errorf("probe %q script: %v", name, err)
+		}
+		if mode := script.Mode(); !mode.IsRegular() || mode&0100 == 0 {
+			return fmt.Errorf("probe %q script %q is not executable", name, path)
+		}
+	}
+	return nil
+}
+
+// sortedProbes returns the names of the given
+// probes in alphabetical order.
+func sortedProbes(probes map[string]Probe) []string {
+	names := make([]string, 0, len(probes))
+	for name := range probes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// encodeProbes returns the metadata.yaml
+// representation of the given probes.
+func encodeProbes(probes map[string]Probe) map[string]interface{} {
+	result := make(map[string]interface{})
+	for name, probe := range probes {
+		m := map[string]interface{}{
+			"kind": probe.Kind,
+		}
+		if probe.Interval != 0 {
+			m["interval"] = probe.Interval.String()
+		}
+		if probe.Timeout != 0 {
+			m["timeout"] = probe.Timeout.String()
+		}
+		result[name] = m
+	}
+	return result
+}
+
+// probesC coerces the probes field of the metadata
+// into a map[string]Probe keyed by probe name.
+type probesC struct{}
+
+var probeMapC = schema.StringMap(schema.FieldMap(
+	schema.Fields{
+		"kind":     schema.String(),
+		"interval": durationC{},
+		"timeout":  durationC{},
+	},
+	schema.Defaults{
+		"interval": time.Duration(0),
+		"timeout":  time.Duration(0),
+	},
+))
+
+func (probesC) Coerce(v interface{}, path []string) (interface{}, error) {
+	m, err := probeMapC.Coerce(v, path)
+	if err != nil {
+		return nil, err
+	}
+	probes := make(map[string]Probe)
+	for name, fields := range m.(map[string]interface{}) {
+		fields := fields.(map[string]interface{})
+		probes[name] = Probe{
+			Kind:     fields["kind"].(string),
+			Interval: fields["interval"].(time.Duration),
+			Timeout:  fields["timeout"].(time.Duration),
+		}
+	}
+	return probes, nil
+}
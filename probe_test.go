@@ -0,0 +1,124 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ProbeSuite struct{}
+
+var _ = gc.Suite(&ProbeSuite{})
+
+const probeMeta = `
+name: probed
+summary: s
+description: d
+probes:
+  ready:
+    kind: readiness
+    interval: 10s
+    timeout: 5
+  alive:
+    kind: liveness
+`
+
+func (s *ProbeSuite) TestReadProbes(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(probeMeta))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Probes, jc.DeepEquals, map[string]charm.Probe{
+		"ready": {
+			Kind:     charm.ProbeReadiness,
+			Interval: 10 * time.Second,
+			Timeout:  5 * time.Second,
+		},
+		"alive": {
+			Kind: charm.ProbeLiveness,
+		},
+	})
+	c.Assert(meta.UnknownFields, gc.IsNil)
+}
+
+func (s *ProbeSuite) TestProbesSaved(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(probeMeta))
+	c.Assert(err, gc.IsNil)
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	dir.SetMeta(meta)
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+	saved, err := charm.ReadCharmDir(dir.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(saved.Meta().Probes, jc.DeepEquals, meta.Probes)
+}
+
+var probeErrorTests = []struct {
+	probes string
+	err    string
+}{{
+	probes: "  Ready:\n    kind: readiness\n",
+	err:    `charm "probed" has invalid probe name "Ready"`,
+}, {
+	probes: "  ready:\n    kind: startup\n",
+	err:    `charm "probed" has probe "ready" has unknown kind "startup"`,
+}, {
+	probes: "  ready:\n    interval: 5s\n",
+	err:    `metadata: line .*: probes.ready.kind: expected string, got nothing`,
+}, {
+	probes: "  ready:\n    kind: readiness\n    timeout: never\n",
+	err:    `metadata: line .*: probes.ready.timeout: invalid duration "never"`,
+}, {
+	probes: "  ready:\n    kind: readiness\n    interval: 5s\n    timeout: 10s\n",
+	err:    `charm "probed" has probe "ready" has timeout longer than its interval`,
+}}
+
+func (s *ProbeSuite) TestProbeErrors(c *gc.C) {
+	for i, test := range probeErrorTests {
+		c.Logf("test %d: %q", i, test.probes)
+		_, err := charm.ReadMeta(strings.NewReader("name: probed\nsummary: s\ndescription: d\nprobes:\n" + test.probes))
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *ProbeSuite) TestCheckProbeScripts(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(probeMeta))
+	c.Assert(err, gc.IsNil)
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	dir.SetMeta(meta)
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+	_, err = dir.NormalizePermissions()
+	c.Assert(err, gc.IsNil)
+
+	err = charm.CheckProbeScripts(dir)
+	c.Assert(err, gc.ErrorMatches, `probe "alive" has no script "probes/alive"`)
+
+	writeCharmFile(c, dir.Path, "probes/alive", "#!/bin/sh\n", 0755)
+	writeCharmFile(c, dir.Path, "probes/ready", "#!/bin/sh\n", 0644)
+	err = charm.CheckProbeScripts(dir)
+	c.Assert(err, gc.ErrorMatches, `probe "ready" script "probes/ready" is not executable`)
+
+	changes, err := dir.NormalizePermissions()
+	c.Assert(err, gc.IsNil)
+	c.Assert(changes, jc.DeepEquals, []charm.PermissionChange{
+		{"probes/ready", 0644, 0755},
+	})
+	err = charm.CheckProbeScripts(dir)
+	c.Assert(err, gc.IsNil)
+
+	var buf bytes.Buffer
+	err = dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	err = charm.CheckProbeScripts(archive)
+	c.Assert(err, gc.IsNil)
+}
@@ -0,0 +1,264 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// provenanceFile holds the name of the file in a charm
+// that holds its provenance record.
+const provenanceFile = "provenance.json"
+
+// ErrNoProvenance is returned when a charm holds no
+// provenance record.
+var ErrNoProvenance = errors.New("charm has no provenance record")
+
+// Provenance records how a charm was built, so that operators
+// can check where the charm they are deploying came from. It is
+// held in the provenance.json file at the root of the charm.
+//
+// The record does not vouch for itself: anyone able to change the
+// charm can also change the record. To be trusted it must be
+// signed by the builder; Digest returns the value to sign.
+type Provenance struct {
+	// BuilderId identifies the system that built the charm,
+	// such as the URL of a build service.
+	BuilderId string `json:"builder-id"`
+
+	// SourceRepo holds the location of the source repository
+	// the charm was built from, if known.
+	SourceRepo string `json:"source-repo,omitempty"`
+
+	// SourceCommit holds the revision of the source repository
+	// the charm was built from, if known.
+	SourceCommit string `json:"source-commit,omitempty"`
+
+	// BuildTime holds the time the charm was built.
+	BuildTime time.Time `json:"build-time"`
+
+	// Materials holds the digests of the files in the charm,
+	// sorted by path. The revision file and revision history,
+	// which may be changed independently of the content, and the
+	// provenance record itself are not included.
+	Materials []ProvenanceMaterial `json:"materials"`
+}
+
+// ProvenanceMaterial holds the digest of a file in a charm.
+type ProvenanceMaterial struct {
+	// Path holds the slash-separated path of the file
+	// relative to the root of the charm.
+	Path string `json:"path"`
+
+	// SHA256 holds the hex-encoded SHA256 digest of the file's
+	// contents. The contents of a symbolic link are its target.
+	SHA256 string `json:"sha256"`
+}
+
+// Digest returns the hex-encoded SHA256 digest of the record
+// as written to provenance.json, for signing by the builder.
+func (p *Provenance) Digest() (string, error) {
+	data, err := encodeProvenance(p)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// WriteProvenance records the digests of the charm's files in
+// the given provenance record and writes it to the provenance.json
+// file in the charm directory, replacing any existing record. The
+// files are those that would be archived by ArchiveTo. It returns
+// the record as written.
+func (dir *CharmDir) WriteProvenance(p Provenance) (_ *Provenance, err error) {
+	defer func() {
+		audit(AuditSign, dir.Path, dir, nil, err)
+	}()
+	if dir.readOnly {
+		return nil, ErrReadOnly
+	}
+	if p.BuilderId == "" {
+		return nil, fmt.Errorf("cannot write provenance: no builder id")
+	}
+	zipr, err := openCharmZip(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write provenance: %v", err)
+	}
+	defer zipr.Close()
+	materials, err := archiveMaterials(zipr.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write provenance: %v", err)
+	}
+	p.Materials = materials
+	data, err := encodeProvenance(&p)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write provenance: %v", err)
+	}
+	if err := ioutil.WriteFile(dir.join(provenanceFile), data, 0644); err != nil {
+		return nil, fmt.Errorf("cannot write provenance: %v", err)
+	}
+	return &p, nil
+}
+
+// Provenance returns the provenance record held in the charm
+// directory. It returns ErrNoProvenance if there is none.
+// The record is not verified; use VerifyProvenance for that.
+func (dir *CharmDir) Provenance() (*Provenance, error) {
+	data, err := ioutil.ReadFile(dir.join(provenanceFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNoProvenance
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeProvenance(data)
+}
+
+// Provenance returns the provenance record held in the charm
+// archive, as CharmDir.Provenance does for charm directories.
+func (a *CharmArchive) Provenance() (*Provenance, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	return archiveProvenance(zipr.Reader)
+}
+
+// VerifyProvenance checks that the files in the given charm, which
+// must be a *CharmDir or a *CharmArchive, match the digests in its
+// provenance record, and returns the record. It returns
+// ErrNoProvenance if the charm has no record.
+func VerifyProvenance(ch Charm) (_ *Provenance, err error) {
+	defer func() {
+		auditVerify(ch, err)
+	}()
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify provenance: %v", err)
+	}
+	defer zipr.Close()
+	p, err := archiveProvenance(zipr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	materials, err := archiveMaterials(zipr.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify provenance: %v", err)
+	}
+	if err := checkMaterials(p.Materials, materials); err != nil {
+		return nil, fmt.Errorf("cannot verify provenance: %v", err)
+	}
+	return p, nil
+}
+
+// checkMaterials returns an error describing the first difference
+// between the recorded materials and those actually found.
+func checkMaterials(recorded, found []ProvenanceMaterial) error {
+	digests := make(map[string]string)
+	for _, m := range recorded {
+		digests[m.Path] = m.SHA256
+	}
+	for _, m := range found {
+		digest, ok := digests[m.Path]
+		if !ok {
+			return fmt.Errorf("file %q is not recorded", m.Path)
+		}
+		if digest != m.SHA256 {
+			return fmt.Errorf("file %q has been modified", m.Path)
+		}
+		delete(digests, m.Path)
+	}
+	var missing []string
+	for path := range digests {
+		missing = append(missing, path)
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("file %q is missing", missing[0])
+	}
+	return nil
+}
+
+// archiveMaterials returns the digests of the files in
+// the given charm archive.
+func archiveMaterials(zipr *zip.Reader) ([]ProvenanceMaterial, error) {
+	var materials []ProvenanceMaterial
+	for _, fh := range zipr.File {
+		if excludedFromDigest(fh.Name) {
+			continue
+		}
+		r, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		materials = append(materials, ProvenanceMaterial{
+			Path:   fh.Name,
+			SHA256: hex.EncodeToString(h.Sum(nil)),
+		})
+	}
+	sort.Sort(materialsByPath(materials))
+	return materials, nil
+}
+
+func archiveProvenance(zipr *zip.Reader) (*Provenance, error) {
+	for _, fh := range zipr.File {
+		if fh.Name != provenanceFile {
+			continue
+		}
+		r, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return decodeProvenance(data)
+	}
+	return nil, ErrNoProvenance
+}
+
+func encodeProvenance(p *Provenance) ([]byte, error) {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func decodeProvenance(data []byte) (*Provenance, error) {
+	var p Provenance
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid provenance record: %v", err)
+	}
+	if p.BuilderId == "" {
+		return nil, fmt.Errorf("invalid provenance record: no builder id")
+	}
+	return &p, nil
+}
+
+type materialsByPath []ProvenanceMaterial
+
+func (m materialsByPath) Len() int           { return len(m) }
+func (m materialsByPath) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m materialsByPath) Less(i, j int) bool { return m[i].Path < m[j].Path }
@@ -0,0 +1,151 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ProvenanceSuite struct{}
+
+var _ = gc.Suite(&ProvenanceSuite{})
+
+var testProvenance = charm.Provenance{
+	BuilderId:    "https://build.example.com/",
+	SourceRepo:   "https://git.example.com/dummy.git",
+	SourceCommit: "0123456789abcdef",
+	BuildTime:    time.Date(2014, 11, 5, 12, 0, 0, 0, time.UTC),
+}
+
+func (s *ProvenanceSuite) writeProvenance(c *gc.C) (*charm.CharmDir, *charm.Provenance) {
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	p, err := dir.WriteProvenance(testProvenance)
+	c.Assert(err, gc.IsNil)
+	return dir, p
+}
+
+func (s *ProvenanceSuite) TestWriteProvenance(c *gc.C) {
+	dir, p := s.writeProvenance(c)
+	var paths []string
+	for _, m := range p.Materials {
+		paths = append(paths, m.Path)
+		c.Assert(m.SHA256, gc.HasLen, 64)
+	}
+	c.Assert(paths, gc.DeepEquals, []string{
+		"actions.yaml",
+		"config.yaml",
+		"empty/.gitkeep",
+		"hooks/install",
+		"metadata.yaml",
+		"src/hello.c",
+	})
+	c.Assert(p.BuilderId, gc.Equals, testProvenance.BuilderId)
+
+	read, err := dir.Provenance()
+	c.Assert(err, gc.IsNil)
+	c.Assert(read, gc.DeepEquals, p)
+
+	verified, err := charm.VerifyProvenance(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(verified, gc.DeepEquals, p)
+}
+
+func (s *ProvenanceSuite) TestWriteProvenanceWithoutBuilder(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	_, err := dir.WriteProvenance(charm.Provenance{})
+	c.Assert(err, gc.ErrorMatches, "cannot write provenance: no builder id")
+}
+
+func (s *ProvenanceSuite) TestNoProvenance(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	_, err := dir.Provenance()
+	c.Assert(err, gc.Equals, charm.ErrNoProvenance)
+	_, err = charm.VerifyProvenance(dir)
+	c.Assert(err, gc.Equals, charm.ErrNoProvenance)
+
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	_, err = archive.Provenance()
+	c.Assert(err, gc.Equals, charm.ErrNoProvenance)
+}
+
+func (s *ProvenanceSuite) TestArchiveProvenance(c *gc.C) {
+	dir, p := s.writeProvenance(c)
+	// Changing the revision does not invalidate the record.
+	dir.SetRevision(42)
+	path := filepath.Join(c.MkDir(), "dummy.charm")
+	file, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	err = dir.ArchiveTo(file)
+	file.Close()
+	c.Assert(err, gc.IsNil)
+
+	archive, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	read, err := archive.Provenance()
+	c.Assert(err, gc.IsNil)
+	c.Assert(read, gc.DeepEquals, p)
+	verified, err := charm.VerifyProvenance(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(verified, gc.DeepEquals, p)
+}
+
+func (s *ProvenanceSuite) TestVerifyProvenanceModified(c *gc.C) {
+	dir, _ := s.writeProvenance(c)
+	err := ioutil.WriteFile(filepath.Join(dir.Path, "src", "hello.c"), []byte("/* changed */"), 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.VerifyProvenance(dir)
+	c.Assert(err, gc.ErrorMatches, `cannot verify provenance: file "src/hello.c" has been modified`)
+}
+
+func (s *ProvenanceSuite) TestVerifyProvenanceAdded(c *gc.C) {
+	dir, _ := s.writeProvenance(c)
+	err := ioutil.WriteFile(filepath.Join(dir.Path, "hooks", "start"), []byte("#!/bin/sh\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.VerifyProvenance(dir)
+	c.Assert(err, gc.ErrorMatches, `cannot verify provenance: file "hooks/start" is not recorded`)
+}
+
+func (s *ProvenanceSuite) TestVerifyProvenanceRemoved(c *gc.C) {
+	dir, _ := s.writeProvenance(c)
+	err := os.Remove(filepath.Join(dir.Path, "src", "hello.c"))
+	c.Assert(err, gc.IsNil)
+	_, err = charm.VerifyProvenance(dir)
+	c.Assert(err, gc.ErrorMatches, `cannot verify provenance: file "src/hello.c" is missing`)
+}
+
+func (s *ProvenanceSuite) TestInvalidProvenance(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(dir.Path, "provenance.json"), []byte(`{"materials": []}`), 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = dir.Provenance()
+	c.Assert(err, gc.ErrorMatches, "invalid provenance record: no builder id")
+}
+
+func (s *ProvenanceSuite) TestDigest(c *gc.C) {
+	dir, p := s.writeProvenance(c)
+	digest, err := p.Digest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(digest, gc.HasLen, 64)
+
+	read, err := dir.Provenance()
+	c.Assert(err, gc.IsNil)
+	readDigest, err := read.Digest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(readDigest, gc.Equals, digest)
+
+	read.SourceCommit = "fedcba9876543210"
+	changedDigest, err := read.Digest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(changedDigest, gc.Not(gc.Equals), digest)
+}
@@ -0,0 +1,137 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pruningPrefix is added to the names of expansions while
+// they are being removed.
+const pruningPrefix = ".pruning-"
+
+// PruneParams holds parameters for PruneExpandedCharms.
+type PruneParams struct {
+	// Dir holds the directory holding the expanded charms.
+	Dir string
+
+	// InUse holds the charm URLs or archive digests identifying
+	// the expansions that are still in use and must be kept.
+	InUse []string
+
+	// MinAge holds the minimum age of the expansions to remove.
+	// Expansions modified more recently are kept, so that
+	// charms that are still being expanded are left alone.
+	MinAge time.Duration
+
+	// DryRun specifies that nothing should be removed; the
+	// report describes what would have been removed.
+	DryRun bool
+}
+
+// PruneReport describes the outcome of PruneExpandedCharms.
+type PruneReport struct {
+	// Removed holds the names of the expansions removed,
+	// in alphabetical order.
+	Removed []string
+
+	// Kept holds the names of the expansions kept,
+	// in alphabetical order.
+	Kept []string
+
+	// Size holds the total size, in bytes, of the files
+	// in the removed expansions.
+	Size int64
+}
+
+// PruneExpandedCharms removes the expanded charms in p.Dir that are
+// no longer in use. Each expansion is a directory, named after the
+// URL or archive digest of its charm as quoted by Quote, holding
+// the charm as expanded by ExpandTo. Expansions whose names do not
+// correspond to an entry in p.InUse are removed, unless they have
+// been modified within p.MinAge.
+//
+// Only directories are considered; files, symbolic links and hidden
+// entries are left alone. Each expansion is renamed before it is
+// removed, so that an interrupted removal never leaves a partial
+// expansion under its original name; any such leftovers are removed
+// by the next call.
+func PruneExpandedCharms(p PruneParams) (*PruneReport, error) {
+	inUse := make(map[string]bool)
+	for _, id := range p.InUse {
+		inUse[Quote(id)] = true
+	}
+	infos, err := ioutil.ReadDir(p.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prune expanded charms: %v", err)
+	}
+	now := time.Now()
+	report := &PruneReport{}
+	var leftovers []string
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(name, pruningPrefix) {
+			leftovers = append(leftovers, name)
+			continue
+		}
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if inUse[name] || now.Sub(info.ModTime()) < p.MinAge {
+			report.Kept = append(report.Kept, name)
+			continue
+		}
+		size, err := dirSize(filepath.Join(p.Dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("cannot prune expanded charms: %v", err)
+		}
+		report.Removed = append(report.Removed, name)
+		report.Size += size
+	}
+	sort.Strings(report.Removed)
+	sort.Strings(report.Kept)
+	if p.DryRun {
+		return report, nil
+	}
+	for _, name := range leftovers {
+		if err := os.RemoveAll(filepath.Join(p.Dir, name)); err != nil {
+			return nil, fmt.Errorf("cannot prune expanded charms: %v", err)
+		}
+	}
+	for _, name := range report.Removed {
+		pruning := filepath.Join(p.Dir, pruningPrefix+name)
+		if err := os.Rename(filepath.Join(p.Dir, name), pruning); err != nil {
+			return nil, fmt.Errorf("cannot prune expanded charm %q: %v", name, err)
+		}
+		if err := os.RemoveAll(pruning); err != nil {
+			return nil, fmt.Errorf("cannot prune expanded charm %q: %v", name, err)
+		}
+	}
+	return report, nil
+}
+
+// dirSize returns the total size of the regular files
+// within the given directory.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
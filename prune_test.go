@@ -0,0 +1,149 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type PruneSuite struct {
+	dir string
+}
+
+var _ = gc.Suite(&PruneSuite{})
+
+const (
+	mysqlURL     = "cs:trusty/mysql-3"
+	wordpressURL = "cs:trusty/wordpress-5"
+	dummyDigest  = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+func (s *PruneSuite) SetUpTest(c *gc.C) {
+	s.dir = c.MkDir()
+	old := time.Now().Add(-2 * time.Hour)
+	for _, id := range []string{mysqlURL, wordpressURL, dummyDigest} {
+		path := filepath.Join(s.dir, charm.Quote(id))
+		archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+		err := archive.ExpandTo(path)
+		c.Assert(err, gc.IsNil)
+		err = os.Chtimes(path, old, old)
+		c.Assert(err, gc.IsNil)
+	}
+}
+
+func (s *PruneSuite) exists(c *gc.C, name string) bool {
+	_, err := os.Lstat(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return false
+	}
+	c.Assert(err, gc.IsNil)
+	return true
+}
+
+func (s *PruneSuite) TestPrune(c *gc.C) {
+	report, err := charm.PruneExpandedCharms(charm.PruneParams{
+		Dir:   s.dir,
+		InUse: []string{mysqlURL, "cs:trusty/other-1"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(report.Removed, jc.DeepEquals, []string{dummyDigest, charm.Quote(wordpressURL)})
+	c.Assert(report.Kept, jc.DeepEquals, []string{charm.Quote(mysqlURL)})
+	c.Assert(report.Size > 0, jc.IsTrue)
+
+	c.Assert(s.exists(c, charm.Quote(mysqlURL)), jc.IsTrue)
+	c.Assert(s.exists(c, charm.Quote(wordpressURL)), jc.IsFalse)
+	c.Assert(s.exists(c, dummyDigest), jc.IsFalse)
+	infos, err := ioutil.ReadDir(s.dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos, gc.HasLen, 1)
+}
+
+func (s *PruneSuite) TestPruneDryRun(c *gc.C) {
+	report, err := charm.PruneExpandedCharms(charm.PruneParams{
+		Dir:    s.dir,
+		InUse:  []string{dummyDigest},
+		DryRun: true,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(report.Removed, jc.DeepEquals, []string{charm.Quote(mysqlURL), charm.Quote(wordpressURL)})
+	c.Assert(report.Kept, jc.DeepEquals, []string{dummyDigest})
+	for _, name := range report.Removed {
+		c.Assert(s.exists(c, name), jc.IsTrue)
+	}
+
+	// The report from a real run matches.
+	report2, err := charm.PruneExpandedCharms(charm.PruneParams{
+		Dir:   s.dir,
+		InUse: []string{dummyDigest},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(report2, jc.DeepEquals, report)
+}
+
+func (s *PruneSuite) TestPruneKeepsRecent(c *gc.C) {
+	now := time.Now()
+	path := filepath.Join(s.dir, charm.Quote(wordpressURL))
+	err := os.Chtimes(path, now, now)
+	c.Assert(err, gc.IsNil)
+
+	report, err := charm.PruneExpandedCharms(charm.PruneParams{
+		Dir:    s.dir,
+		MinAge: time.Hour,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(report.Kept, jc.DeepEquals, []string{charm.Quote(wordpressURL)})
+	c.Assert(report.Removed, gc.HasLen, 2)
+	c.Assert(s.exists(c, charm.Quote(wordpressURL)), jc.IsTrue)
+}
+
+func (s *PruneSuite) TestPruneIgnoresOtherEntries(c *gc.C) {
+	err := ioutil.WriteFile(filepath.Join(s.dir, "file"), []byte("data"), 0644)
+	c.Assert(err, gc.IsNil)
+	err = os.Mkdir(filepath.Join(s.dir, ".hidden"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = os.Symlink(filepath.Join(s.dir, charm.Quote(mysqlURL)), filepath.Join(s.dir, "link"))
+	c.Assert(err, gc.IsNil)
+
+	report, err := charm.PruneExpandedCharms(charm.PruneParams{
+		Dir:   s.dir,
+		InUse: []string{mysqlURL},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(report.Removed, gc.HasLen, 2)
+	for _, name := range []string{"file", ".hidden", "link", charm.Quote(mysqlURL)} {
+		c.Assert(s.exists(c, name), jc.IsTrue)
+	}
+}
+
+func (s *PruneSuite) TestPruneRemovesLeftovers(c *gc.C) {
+	leftover := filepath.Join(s.dir, ".pruning-"+charm.Quote("cs:trusty/old-1"))
+	err := os.MkdirAll(filepath.Join(leftover, "hooks"), 0755)
+	c.Assert(err, gc.IsNil)
+
+	report, err := charm.PruneExpandedCharms(charm.PruneParams{
+		Dir:   s.dir,
+		InUse: []string{mysqlURL, wordpressURL, dummyDigest},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(report.Removed, gc.HasLen, 0)
+	c.Assert(report.Kept, gc.HasLen, 3)
+	_, err = os.Stat(leftover)
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (s *PruneSuite) TestPruneMissingDir(c *gc.C) {
+	_, err := charm.PruneExpandedCharms(charm.PruneParams{
+		Dir: filepath.Join(s.dir, "missing"),
+	})
+	c.Assert(err, gc.ErrorMatches, "cannot prune expanded charms: .*")
+}
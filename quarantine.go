@@ -0,0 +1,185 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/utils"
+)
+
+// quarantineReportSuffix is added to the name of a quarantined
+// archive to form the name of its report.
+const quarantineReportSuffix = ".report.json"
+
+// QuarantineReport describes why an archive was quarantined. It is
+// written as JSON alongside the quarantined archive.
+type QuarantineReport struct {
+	// OriginalPath holds the path the archive was moved from.
+	OriginalPath string `json:"original-path"`
+
+	// Path holds the path of the archive in quarantine.
+	Path string `json:"path"`
+
+	// Time holds when the archive was quarantined.
+	Time time.Time `json:"time"`
+
+	// SHA256 holds the hex-encoded SHA256 digest of the archive.
+	SHA256 string `json:"sha256"`
+
+	// Size holds the size of the archive in bytes.
+	Size int64 `json:"size"`
+
+	// Errors holds the validation failures that caused the
+	// archive to be quarantined, one for each problem found.
+	Errors []string `json:"errors"`
+}
+
+// QuarantineError is returned by ReadCharmArchiveOrQuarantine
+// when an archive fails validation and has been quarantined.
+type QuarantineError struct {
+	// Report holds the report written for the archive.
+	Report *QuarantineReport
+
+	// Err holds the validation failure.
+	Err error
+}
+
+func (e *QuarantineError) Error() string {
+	return fmt.Sprintf("charm archive quarantined as %q: %v", e.Report.Path, e.Err)
+}
+
+// ReadCharmArchiveOrQuarantine reads the charm archive at path and
+// verifies it as Verify does. If that fails, the archive is moved into
+// the given quarantine directory, which is created if necessary, with a
+// report alongside describing the failure, and a *QuarantineError is
+// returned. Upload pipelines can thus examine rejected archives later
+// rather than losing them.
+func ReadCharmArchiveOrQuarantine(path, quarantineDir string) (*CharmArchive, error) {
+	a, err := ReadCharmArchive(path)
+	if err == nil {
+		err = a.Verify()
+	}
+	if err == nil {
+		return a, nil
+	}
+	report, qerr := Quarantine(path, quarantineDir, err)
+	if qerr != nil {
+		return nil, fmt.Errorf("%v (and cannot quarantine archive: %v)", err, qerr)
+	}
+	return nil, &QuarantineError{
+		Report: report,
+		Err:    err,
+	}
+}
+
+// Quarantine moves the file at path into the given quarantine
+// directory, which is created if necessary, and writes a report
+// alongside it recording the given reason. The quarantined file is
+// named after its digest and original name, so that rejected files
+// with the same name do not replace one another; its report has the
+// same name with ".report.json" appended. If reason is a
+// *VerificationError, each of its errors is reported separately.
+func Quarantine(path, quarantineDir string, reason error) (*QuarantineReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(quarantineDir, 0755); err != nil {
+		return nil, err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	report := &QuarantineReport{
+		OriginalPath: path,
+		Path:         filepath.Join(quarantineDir, digest[:12]+"-"+filepath.Base(path)),
+		Time:         time.Now().UTC(),
+		SHA256:       digest,
+		Size:         size,
+		Errors:       quarantineErrors(reason),
+	}
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	// Write the report first so that no archive
+	// is ever found in quarantine without one.
+	if err := utils.AtomicWriteFile(report.Path+quarantineReportSuffix, append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	if err := moveFile(path, report.Path); err != nil {
+		os.Remove(report.Path + quarantineReportSuffix)
+		return nil, err
+	}
+	return report, nil
+}
+
+// ReadQuarantineReport reads the report written
+// for the given quarantined archive.
+func ReadQuarantineReport(path string) (*QuarantineReport, error) {
+	f, err := os.Open(path + quarantineReportSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var report QuarantineReport
+	if err := json.NewDecoder(f).Decode(&report); err != nil {
+		return nil, fmt.Errorf("cannot read quarantine report: %v", err)
+	}
+	return &report, nil
+}
+
+func quarantineErrors(reason error) []string {
+	if reason == nil {
+		return []string{}
+	}
+	verr, ok := reason.(*VerificationError)
+	if !ok {
+		return []string{reason.Error()}
+	}
+	errs := make([]string, len(verr.Errors))
+	for i, err := range verr.Errors {
+		errs[i] = err.Error()
+	}
+	return errs
+}
+
+// moveFile moves the file at src to dst, copying it
+// if it cannot be renamed, as when dst is on another
+// file system.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type QuarantineSuite struct{}
+
+var _ = gc.Suite(&QuarantineSuite{})
+
+func (s *QuarantineSuite) TestValidArchive(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	quarantineDir := filepath.Join(c.MkDir(), "quarantine")
+	archive, err := charm.ReadCharmArchiveOrQuarantine(path, quarantineDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+	_, err = os.Stat(quarantineDir)
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (s *QuarantineSuite) TestInvalidArchive(c *gc.C) {
+	data := writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"config.yaml", "options: {}\n"},
+		[2]string{"../escape", "x"},
+	)
+	path := filepath.Join(c.MkDir(), "bad.charm")
+	err := ioutil.WriteFile(path, data, 0644)
+	c.Assert(err, gc.IsNil)
+	quarantineDir := filepath.Join(c.MkDir(), "quarantine")
+
+	_, err = charm.ReadCharmArchiveOrQuarantine(path, quarantineDir)
+	c.Assert(err, gc.FitsTypeOf, (*charm.QuarantineError)(nil))
+	report := err.(*charm.QuarantineError).Report
+	c.Assert(err, gc.ErrorMatches, `charm archive quarantined as ".*-bad.charm": \.\./escape: path outside charm`)
+	c.Assert(report.OriginalPath, gc.Equals, path)
+	c.Assert(filepath.Dir(report.Path), gc.Equals, quarantineDir)
+	c.Assert(report.SHA256, gc.Equals, digestOf(data))
+	c.Assert(report.Size, gc.Equals, int64(len(data)))
+	c.Assert(report.Errors, jc.DeepEquals, []string{"../escape: path outside charm"})
+	c.Assert(time.Since(report.Time) < time.Minute, jc.IsTrue)
+
+	_, err = os.Stat(path)
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+	quarantined, err := ioutil.ReadFile(report.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(quarantined, jc.DeepEquals, data)
+
+	read, err := charm.ReadQuarantineReport(report.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(read.Time.Equal(report.Time), jc.IsTrue)
+	read.Time = report.Time
+	c.Assert(read, jc.DeepEquals, report)
+}
+
+func (s *QuarantineSuite) TestUnreadableArchive(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "garbage.charm")
+	err := ioutil.WriteFile(path, []byte("garbage"), 0644)
+	c.Assert(err, gc.IsNil)
+	quarantineDir := c.MkDir()
+	_, err = charm.ReadCharmArchiveOrQuarantine(path, quarantineDir)
+	c.Assert(err, gc.ErrorMatches, `charm archive quarantined as ".*-garbage.charm": zip: not a valid zip file`)
+	report := err.(*charm.QuarantineError).Report
+	c.Assert(report.Errors, jc.DeepEquals, []string{"zip: not a valid zip file"})
+}
+
+func (s *QuarantineSuite) TestQuarantineMissingFile(c *gc.C) {
+	_, err := charm.Quarantine(filepath.Join(c.MkDir(), "missing"), c.MkDir(), fmt.Errorf("bad"))
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+}
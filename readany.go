@@ -0,0 +1,93 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Kind identifies the kind of entity read by ReadAny.
+type Kind string
+
+const (
+	KindCharmDir      Kind = "charm directory"
+	KindCharmArchive  Kind = "charm archive"
+	KindBundleDir     Kind = "bundle directory"
+	KindBundleArchive Kind = "bundle archive"
+)
+
+// ReadAny reads the charm or bundle at the given path, which may
+// be a directory or an archive. The kind of entity is determined
+// by its contents rather than its name: a charm holds a
+// metadata.yaml file and a bundle holds a bundle.yaml file.
+// The returned value is a *CharmDir, *CharmArchive, *BundleDir or
+// *BundleArchive, according to the returned Kind.
+func ReadAny(path string) (interface{}, Kind, error) {
+	kind, err := detectKind(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var entity interface{}
+	switch kind {
+	case KindCharmDir:
+		entity, err = ReadCharmDir(path)
+	case KindCharmArchive:
+		entity, err = ReadCharmArchive(path)
+	case KindBundleDir:
+		entity, err = ReadBundleDir(path)
+	case KindBundleArchive:
+		entity, err = ReadBundleArchive(path)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return entity, kind, nil
+}
+
+// detectKind returns the kind of the entity at the given path.
+func detectKind(path string) (Kind, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	var isCharm, isBundle bool
+	if info.IsDir() {
+		isCharm = fileExists(filepath.Join(path, MetadataFile))
+		isBundle = fileExists(filepath.Join(path, "bundle.yaml"))
+	} else {
+		zipr, err := newZipOpenerFromPath(path).openZip()
+		if err != nil {
+			return "", fmt.Errorf("%q is not a charm or bundle: %v", path, err)
+		}
+		defer zipr.Close()
+		for _, fh := range zipr.File {
+			switch fh.Name {
+			case MetadataFile:
+				isCharm = true
+			case "bundle.yaml":
+				isBundle = true
+			}
+		}
+	}
+	switch {
+	case isCharm && isBundle:
+		return "", fmt.Errorf("%q holds both metadata.yaml and bundle.yaml", path)
+	case isCharm && info.IsDir():
+		return KindCharmDir, nil
+	case isCharm:
+		return KindCharmArchive, nil
+	case isBundle && info.IsDir():
+		return KindBundleDir, nil
+	case isBundle:
+		return KindBundleArchive, nil
+	}
+	return "", fmt.Errorf("%q is not a charm or bundle: no metadata.yaml or bundle.yaml found", path)
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,90 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ReadAnySuite struct{}
+
+var _ = gc.Suite(&ReadAnySuite{})
+
+func (s *ReadAnySuite) TestReadAny(c *gc.C) {
+	// Give the archives misleading names to check that the
+	// kind is determined by content.
+	charmArchive := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	misnamedCharm := filepath.Join(filepath.Dir(charmArchive), "archive.bundle")
+	err := os.Rename(charmArchive, misnamedCharm)
+	c.Assert(err, gc.IsNil)
+	bundleArchive := charmtesting.Charms.BundleArchivePath(c.MkDir(), "wordpress-simple")
+	misnamedBundle := filepath.Join(filepath.Dir(bundleArchive), "archive.charm")
+	err = os.Rename(bundleArchive, misnamedBundle)
+	c.Assert(err, gc.IsNil)
+
+	tests := []struct {
+		path  string
+		kind  charm.Kind
+		check func(entity interface{})
+	}{{
+		path: charmtesting.Charms.CharmDirPath("dummy"),
+		kind: charm.KindCharmDir,
+		check: func(entity interface{}) {
+			c.Assert(entity.(*charm.CharmDir).Meta().Name, gc.Equals, "dummy")
+		},
+	}, {
+		path: misnamedCharm,
+		kind: charm.KindCharmArchive,
+		check: func(entity interface{}) {
+			c.Assert(entity.(*charm.CharmArchive).Meta().Name, gc.Equals, "dummy")
+		},
+	}, {
+		path: charmtesting.Charms.BundleDirPath("wordpress-simple"),
+		kind: charm.KindBundleDir,
+		check: func(entity interface{}) {
+			c.Assert(entity.(*charm.BundleDir).Data().Services, gc.HasLen, 2)
+		},
+	}, {
+		path: misnamedBundle,
+		kind: charm.KindBundleArchive,
+		check: func(entity interface{}) {
+			c.Assert(entity.(*charm.BundleArchive).Data().Services, gc.HasLen, 2)
+		},
+	}}
+	for i, test := range tests {
+		c.Logf("test %d: %s", i, test.kind)
+		entity, kind, err := charm.ReadAny(test.path)
+		c.Assert(err, gc.IsNil)
+		c.Assert(kind, gc.Equals, test.kind)
+		test.check(entity)
+	}
+}
+
+func (s *ReadAnySuite) TestReadAnyErrors(c *gc.C) {
+	dir := c.MkDir()
+	_, _, err := charm.ReadAny(dir)
+	c.Assert(err, gc.ErrorMatches, `".*" is not a charm or bundle: no metadata.yaml or bundle.yaml found`)
+
+	path := filepath.Join(dir, "foo.charm")
+	err = ioutil.WriteFile(path, []byte("not a zip"), 0644)
+	c.Assert(err, gc.IsNil)
+	_, _, err = charm.ReadAny(path)
+	c.Assert(err, gc.ErrorMatches, `".*foo.charm" is not a charm or bundle: zip: not a valid zip file`)
+
+	charmDir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	err = ioutil.WriteFile(filepath.Join(charmDir, "bundle.yaml"), nil, 0644)
+	c.Assert(err, gc.IsNil)
+	_, _, err = charm.ReadAny(charmDir)
+	c.Assert(err, gc.ErrorMatches, `".*" holds both metadata.yaml and bundle.yaml`)
+
+	_, _, err = charm.ReadAny(filepath.Join(dir, "missing"))
+	c.Assert(err, gc.ErrorMatches, `stat .*missing: no such file or directory`)
+}
@@ -0,0 +1,210 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReadOptions holds options for ReadCharmArchiveWithOptions
+// and CharmArchive.WalkWithOptions.
+type ReadOptions struct {
+	// Limiter, if not nil, limits the rate at which data is
+	// read. The same Limiter may be shared by many archives, to
+	// limit the total rate at which they are read, for example by
+	// a store extracting many uploads at once.
+	Limiter RateLimiter
+
+	// Counter, if not nil, counts the data read.
+	Counter *ReadCounter
+}
+
+// RateLimiter is implemented by types that limit the
+// rate at which data is read.
+type RateLimiter interface {
+	// Wait blocks until n more bytes may be read.
+	Wait(n int)
+}
+
+// ReadCounter counts the data read from archives. It is safe to
+// use concurrently, so the same counter may be shared by many archives.
+type ReadCounter struct {
+	// The counts are accessed atomically, and are held first
+	// so that they are aligned on 32 bit platforms.
+	bytes int64
+	reads int64
+}
+
+// Bytes returns the number of bytes read.
+func (c *ReadCounter) Bytes() int64 {
+	return atomic.LoadInt64(&c.bytes)
+}
+
+// Reads returns the number of reads made.
+func (c *ReadCounter) Reads() int64 {
+	return atomic.LoadInt64(&c.reads)
+}
+
+func (c *ReadCounter) add(n int) {
+	atomic.AddInt64(&c.bytes, int64(n))
+	atomic.AddInt64(&c.reads, 1)
+}
+
+// NewRateLimiter returns a RateLimiter that allows data to be read
+// at the given number of bytes a second on average, with bursts of
+// up to a second's worth of data.
+func NewRateLimiter(bytesPerSecond int64) RateLimiter {
+	return &tokenBucket{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// tokenBucket implements RateLimiter by holding up to a
+// second's worth of tokens, each allowing a byte to be read,
+// replenished at the rate.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+
+	// now and sleep are replaced in tests.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func (b *tokenBucket) Wait(n int) {
+	if n <= 0 || b.rate <= 0 {
+		return
+	}
+	b.mu.Lock()
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+	// The tokens are taken now, leaving a debt if there are
+	// too few, so that later readers wait their turn.
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	if wait > 0 {
+		b.sleep(wait)
+	}
+}
+
+// account waits for the limiter, if any, to allow n
+// bytes to be read and adds them to the counter, if any.
+func (opts ReadOptions) account(n int) {
+	if n <= 0 {
+		return
+	}
+	if opts.Limiter != nil {
+		opts.Limiter.Wait(n)
+	}
+	if opts.Counter != nil {
+		opts.Counter.add(n)
+	}
+}
+
+// limitedReaderAt is an io.ReaderAt that
+// accounts for its reads with opts.
+type limitedReaderAt struct {
+	r    io.ReaderAt
+	opts ReadOptions
+}
+
+func (r limitedReaderAt) ReadAt(buf []byte, off int64) (int, error) {
+	n, err := r.r.ReadAt(buf, off)
+	r.opts.account(n)
+	return n, err
+}
+
+// limitedReader is an io.Reader that
+// accounts for its reads with opts.
+type limitedReader struct {
+	r    io.Reader
+	opts ReadOptions
+}
+
+func (r limitedReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	r.opts.account(n)
+	return n, err
+}
+
+// ReadCharmArchiveWithOptions is like ReadCharmArchive except that
+// every read of the archive file, by this function and by the methods
+// of the returned CharmArchive, is limited and counted as specified
+// by opts. The data counted is that read from the file, before it is
+// decompressed.
+func ReadCharmArchiveWithOptions(path string, opts ReadOptions) (*CharmArchive, error) {
+	a, err := readCharmArchive(&zipLimitedOpener{path: path, opts: opts}, nil)
+	if err != nil {
+		auditRead(nil, path, err)
+		return nil, err
+	}
+	a.Path = path
+	auditRead(a, path, nil)
+	return a, nil
+}
+
+// zipLimitedOpener is a zipOpener that reads the archive at
+// path, accounting for its reads with opts.
+type zipLimitedOpener struct {
+	path string
+	opts ReadOptions
+}
+
+func (zo *zipLimitedOpener) openZip() (*zipReadCloser, error) {
+	f, err := os.Open(zo.path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := zip.NewReader(limitedReaderAt{f, zo.opts}, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &zipReadCloser{Closer: f, Reader: r}, nil
+}
+
+func (zo *zipLimitedOpener) open() (io.ReadCloser, error) {
+	f, err := os.Open(zo.path)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{limitedReader{f, zo.opts}, f}, nil
+}
+
+// WalkWithOptions is like Walk except that reads of the members'
+// contents by fn are limited and counted as specified by opts. The
+// data counted is the members' contents, after decompression.
+func (a *CharmArchive) WalkWithOptions(opts ReadOptions, fn func(Entry, io.Reader) error) error {
+	return a.Walk(func(entry Entry, r io.Reader) error {
+		return fn(entry, limitedReader{r, opts})
+	})
+}
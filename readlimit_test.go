@@ -0,0 +1,132 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ReadLimitSuite struct{}
+
+var _ = gc.Suite(&ReadLimitSuite{})
+
+func (s *ReadLimitSuite) TestReadCharmArchiveWithOptionsCounts(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	var counter charm.ReadCounter
+	archive, err := charm.ReadCharmArchiveWithOptions(path, charm.ReadOptions{
+		Counter: &counter,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+	c.Assert(counter.Bytes() > 0, gc.Equals, true)
+	c.Assert(counter.Reads() > 0, gc.Equals, true)
+
+	// Expanding the archive reads it again.
+	before := counter.Bytes()
+	err = archive.ExpandTo(c.MkDir())
+	c.Assert(err, gc.IsNil)
+	c.Assert(counter.Bytes() > before, gc.Equals, true)
+}
+
+func (s *ReadLimitSuite) TestWalkWithOptionsCounts(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	var counter charm.ReadCounter
+	var total int64
+	err := archive.WalkWithOptions(charm.ReadOptions{Counter: &counter}, func(entry charm.Entry, r io.Reader) error {
+		n, err := io.Copy(ioutil.Discard, r)
+		total += n
+		return err
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(total > 0, gc.Equals, true)
+	c.Assert(counter.Bytes(), gc.Equals, total)
+}
+
+func (s *ReadLimitSuite) TestWalkWithOptionsLimits(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	limiter := &recordingLimiter{}
+	var total int64
+	err := archive.WalkWithOptions(charm.ReadOptions{Limiter: limiter}, func(entry charm.Entry, r io.Reader) error {
+		n, err := io.Copy(ioutil.Discard, r)
+		total += n
+		return err
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(limiter.total, gc.Equals, total)
+}
+
+func (s *ReadLimitSuite) TestRateLimiter(c *gc.C) {
+	now := time.Unix(0, 0)
+	var slept []time.Duration
+	limiter := charm.NewTestRateLimiter(1000, func() time.Time {
+		return now
+	}, func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	})
+
+	// A second's worth of data may be read at once.
+	limiter.Wait(1000)
+	c.Assert(slept, gc.HasLen, 0)
+
+	// After that, reads wait for the data to be allowed.
+	limiter.Wait(500)
+	c.Assert(slept, gc.DeepEquals, []time.Duration{500 * time.Millisecond})
+	limiter.Wait(250)
+	c.Assert(slept[1:], gc.DeepEquals, []time.Duration{250 * time.Millisecond})
+
+	// Idle time allows reads again, but no more
+	// than a second's worth.
+	now = now.Add(time.Hour)
+	limiter.Wait(1000)
+	c.Assert(slept, gc.HasLen, 2)
+	limiter.Wait(100)
+	c.Assert(slept[2:], gc.DeepEquals, []time.Duration{100 * time.Millisecond})
+}
+
+func (s *ReadLimitSuite) TestRateLimiterShared(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	var counter charm.ReadCounter
+	opts := charm.ReadOptions{
+		Limiter: charm.NewRateLimiter(1 << 30),
+		Counter: &counter,
+	}
+	archive, err := charm.ReadCharmArchiveWithOptions(path, opts)
+	c.Assert(err, gc.IsNil)
+	err = archive.ExpandTo(c.MkDir())
+	c.Assert(err, gc.IsNil)
+	once := counter.Bytes()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		dir := c.MkDir()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			archive, err := charm.ReadCharmArchiveWithOptions(path, opts)
+			c.Check(err, gc.IsNil)
+			c.Check(archive.ExpandTo(dir), gc.IsNil)
+		}()
+	}
+	wg.Wait()
+	c.Assert(counter.Bytes(), gc.Equals, 5*once)
+}
+
+// recordingLimiter is a RateLimiter that
+// records the number of bytes allowed.
+type recordingLimiter struct {
+	total int64
+}
+
+func (l *recordingLimiter) Wait(n int) {
+	l.total += int64(n)
+}
@@ -0,0 +1,136 @@
+// Copyright 2011, 2012, 2013 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RelationRole defines the role of a relation.
+type RelationRole string
+
+const (
+	RoleProvider RelationRole = "provider"
+	RoleRequirer RelationRole = "requirer"
+	RolePeer     RelationRole = "peer"
+)
+
+// ParseRelationRole returns the relation role with the given name.
+func ParseRelationRole(s string) (RelationRole, error) {
+	r := RelationRole(s)
+	if err := r.Validate(); err != nil {
+		return "", err
+	}
+	return r, nil
+}
+
+// IsValid reports whether r is one of the known relation roles.
+func (r RelationRole) IsValid() bool {
+	switch r {
+	case RoleProvider, RoleRequirer, RolePeer:
+		return true
+	}
+	return false
+}
+
+// Validate returns an error if r is not one
+// of the known relation roles.
+func (r RelationRole) Validate() error {
+	if !r.IsValid() {
+		return fmt.Errorf("invalid relation role %q", string(r))
+	}
+	return nil
+}
+
+// String returns the name of the role.
+func (r RelationRole) String() string {
+	return string(r)
+}
+
+// MarshalText implements encoding.TextMarshaler, which is also
+// used when the role is encoded as YAML.
+func (r RelationRole) MarshalText() ([]byte, error) {
+	return []byte(r), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, which is also
+// used when the role is decoded from YAML. Known roles are recognized
+// regardless of case and surrounding space. Other text is kept as it
+// is, so that data written by other versions still decodes; such
+// roles are reported by Validate.
+func (r *RelationRole) UnmarshalText(text []byte) error {
+	*r = RelationRole(text)
+	if role := RelationRole(strings.ToLower(strings.TrimSpace(string(text)))); role.IsValid() {
+		*r = role
+	}
+	return nil
+}
+
+// RelationScope describes the scope of a relation.
+type RelationScope string
+
+// Note that schema doesn't support custom string types,
+// so when we use these values in a schema.Checker,
+// we must store them as strings, not RelationScopes.
+
+const (
+	ScopeGlobal    RelationScope = "global"
+	ScopeContainer RelationScope = "container"
+)
+
+// ParseRelationScope returns the relation scope with the given name.
+// The empty string is parsed as ScopeGlobal, the default scope.
+func ParseRelationScope(s string) (RelationScope, error) {
+	if s == "" {
+		return ScopeGlobal, nil
+	}
+	scope := RelationScope(s)
+	if err := scope.Validate(); err != nil {
+		return "", err
+	}
+	return scope, nil
+}
+
+// IsValid reports whether s is one of the known relation scopes.
+func (s RelationScope) IsValid() bool {
+	switch s {
+	case ScopeGlobal, ScopeContainer:
+		return true
+	}
+	return false
+}
+
+// Validate returns an error if s is not one
+// of the known relation scopes.
+func (s RelationScope) Validate() error {
+	if !s.IsValid() {
+		return fmt.Errorf("invalid relation scope %q", string(s))
+	}
+	return nil
+}
+
+// String returns the name of the scope.
+func (s RelationScope) String() string {
+	return string(s)
+}
+
+// MarshalText implements encoding.TextMarshaler, which is also
+// used when the scope is encoded as YAML.
+func (s RelationScope) MarshalText() ([]byte, error) {
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, which is also
+// used when the scope is decoded from YAML. Known scopes are recognized
+// regardless of case and surrounding space. Other text is kept as it
+// is, so that data written by other versions still decodes; such
+// scopes are reported by Validate.
+func (s *RelationScope) UnmarshalText(text []byte) error {
+	*s = RelationScope(text)
+	if scope := RelationScope(strings.ToLower(strings.TrimSpace(string(text)))); scope.IsValid() {
+		*s = scope
+	}
+	return nil
+}
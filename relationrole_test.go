@@ -0,0 +1,96 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"encoding/json"
+
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type RelationRoleSuite struct{}
+
+var _ = gc.Suite(&RelationRoleSuite{})
+
+func (s *RelationRoleSuite) TestParseRelationRole(c *gc.C) {
+	for _, role := range []charm.RelationRole{charm.RoleProvider, charm.RoleRequirer, charm.RolePeer} {
+		parsed, err := charm.ParseRelationRole(role.String())
+		c.Assert(err, gc.IsNil)
+		c.Assert(parsed, gc.Equals, role)
+		c.Assert(role.IsValid(), gc.Equals, true)
+	}
+	_, err := charm.ParseRelationRole("consumer")
+	c.Assert(err, gc.ErrorMatches, `invalid relation role "consumer"`)
+	_, err = charm.ParseRelationRole("")
+	c.Assert(err, gc.ErrorMatches, `invalid relation role ""`)
+}
+
+func (s *RelationRoleSuite) TestParseRelationScope(c *gc.C) {
+	scope, err := charm.ParseRelationScope("container")
+	c.Assert(err, gc.IsNil)
+	c.Assert(scope, gc.Equals, charm.ScopeContainer)
+	scope, err = charm.ParseRelationScope("")
+	c.Assert(err, gc.IsNil)
+	c.Assert(scope, gc.Equals, charm.ScopeGlobal)
+	_, err = charm.ParseRelationScope("machine")
+	c.Assert(err, gc.ErrorMatches, `invalid relation scope "machine"`)
+	c.Assert(charm.RelationScope("machine").Validate(), gc.ErrorMatches, `invalid relation scope "machine"`)
+}
+
+type relationDoc struct {
+	Role  charm.RelationRole  `json:"role" yaml:"role"`
+	Scope charm.RelationScope `json:"scope" yaml:"scope"`
+}
+
+func (s *RelationRoleSuite) TestYAML(c *gc.C) {
+	data, err := yaml.Marshal(relationDoc{charm.RolePeer, charm.ScopeContainer})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "role: peer\nscope: container\n")
+	var doc relationDoc
+	err = yaml.Unmarshal(data, &doc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc, gc.Equals, relationDoc{charm.RolePeer, charm.ScopeContainer})
+
+	// Known values are recognized regardless of case.
+	err = yaml.Unmarshal([]byte("role: Provider\nscope: ' GLOBAL'\n"), &doc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc, gc.Equals, relationDoc{charm.RoleProvider, charm.ScopeGlobal})
+
+	// Unknown values are kept, to be reported by Validate.
+	err = yaml.Unmarshal([]byte("role: boss\nscope: nearby\n"), &doc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc, gc.Equals, relationDoc{"boss", "nearby"})
+	c.Assert(doc.Role.Validate(), gc.ErrorMatches, `invalid relation role "boss"`)
+	c.Assert(doc.Scope.Validate(), gc.ErrorMatches, `invalid relation scope "nearby"`)
+}
+
+func (s *RelationRoleSuite) TestJSON(c *gc.C) {
+	data, err := json.Marshal(relationDoc{charm.RoleRequirer, charm.ScopeGlobal})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `{"role":"requirer","scope":"global"}`)
+	var doc relationDoc
+	err = json.Unmarshal(data, &doc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc, gc.Equals, relationDoc{charm.RoleRequirer, charm.ScopeGlobal})
+
+	// Unset values round trip.
+	data, err = json.Marshal(relationDoc{})
+	c.Assert(err, gc.IsNil)
+	err = json.Unmarshal(data, &doc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc, gc.Equals, relationDoc{})
+}
+
+func (s *RelationRoleSuite) TestMetaCheckScope(c *gc.C) {
+	meta := charm.Meta{
+		Name: "x",
+		Provides: map[string]charm.Relation{
+			"db": {Name: "db", Role: charm.RoleProvider, Interface: "mysql", Scope: "nearby"},
+		},
+	}
+	c.Assert(meta.Check(), gc.ErrorMatches, `charm "x" relation "db" has invalid relation scope "nearby"`)
+}
@@ -0,0 +1,228 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RelationDataCodec encodes the data a unit sets on a relation, which
+// is stored as a bag of string keys and string values, so that values
+// of other types survive being set by one party and read by another.
+// Each value is encoded as JSON, which is also YAML: strings are
+// quoted, so that the string "42" is not read back as the number 42,
+// and floating point numbers always hold a decimal point or exponent,
+// so that 1.0 is not read back as the integer 1. Values may be nil,
+// booleans, strings, integers, floating point numbers, and lists and
+// maps with string keys holding such values.
+//
+// The zero RelationDataCodec places no limit on the size of the data.
+type RelationDataCodec struct {
+	// MaxSize holds the maximum total size, in bytes, of the
+	// encoded keys and values in a bag, or zero if the size
+	// is not limited.
+	MaxSize int
+}
+
+// Marshal returns the bag holding the given data.
+func (codec RelationDataCodec) Marshal(data map[string]interface{}) (map[string]string, error) {
+	bag := make(map[string]string)
+	for _, key := range sortedRelationKeys(data) {
+		if err := checkRelationKey(key); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := encodeRelationValue(&buf, data[key]); err != nil {
+			return nil, fmt.Errorf("cannot encode relation data key %q: %v", key, err)
+		}
+		bag[key] = buf.String()
+	}
+	if err := codec.CheckSize(bag); err != nil {
+		return nil, err
+	}
+	return bag, nil
+}
+
+// Unmarshal returns the data held in the given bag. For compatibility
+// with data set by hooks that do not use the codec, a value that is
+// not valid JSON is returned unchanged as a string. Integers are
+// returned as int64 values and floating point numbers as float64
+// values.
+func (codec RelationDataCodec) Unmarshal(bag map[string]string) (map[string]interface{}, error) {
+	if err := codec.CheckSize(bag); err != nil {
+		return nil, err
+	}
+	data := make(map[string]interface{})
+	for key, value := range bag {
+		if err := checkRelationKey(key); err != nil {
+			return nil, err
+		}
+		data[key] = decodeRelationValue(value)
+	}
+	return data, nil
+}
+
+// CheckSize returns an error if the total size of the keys and
+// values in the given bag exceeds the codec's maximum size.
+func (codec RelationDataCodec) CheckSize(bag map[string]string) error {
+	if codec.MaxSize <= 0 {
+		return nil
+	}
+	size := 0
+	for key, value := range bag {
+		size += len(key) + len(value)
+	}
+	if size > codec.MaxSize {
+		return fmt.Errorf("relation data size %d exceeds maximum %d", size, codec.MaxSize)
+	}
+	return nil
+}
+
+// checkRelationKey checks that the given
+// relation data key is valid.
+func checkRelationKey(key string) error {
+	if key == "" || strings.TrimSpace(key) != key {
+		return fmt.Errorf("invalid relation data key %q", key)
+	}
+	return nil
+}
+
+func sortedRelationKeys(data map[string]interface{}) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeRelationValue writes the JSON encoding of v to buf.
+func encodeRelationValue(buf *bytes.Buffer, v interface{}) error {
+	if v == nil {
+		buf.WriteString("null")
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		buf.WriteString(strconv.FormatBool(rv.Bool()))
+	case reflect.String:
+		data, err := json.Marshal(rv.String())
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buf.WriteString(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		buf.WriteString(strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return fmt.Errorf("unsupported value %v", f)
+		}
+		s := strconv.FormatFloat(f, 'g', -1, rv.Type().Bits())
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		buf.WriteString(s)
+	case reflect.Slice, reflect.Array:
+		buf.WriteByte('[')
+		for i := 0; i < rv.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeRelationValue(buf, rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", rv.Type().Key())
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeRelationValue(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			elem := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+			if err := encodeRelationValue(buf, elem.Interface()); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+	return nil
+}
+
+// decodeRelationValue returns the value encoded in s,
+// or s itself if it is not valid JSON.
+func decodeRelationValue(s string) interface{} {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return s
+	}
+	// Anything after the value means the
+	// whole string is not valid JSON.
+	var extra interface{}
+	if err := dec.Decode(&extra); err != io.EOF {
+		return s
+	}
+	v, err := convertRelationNumbers(v)
+	if err != nil {
+		return s
+	}
+	return v
+}
+
+// convertRelationNumbers returns v with each json.Number
+// within it replaced by an int64 or a float64. It returns
+// an error if a number is out of range.
+func convertRelationNumbers(v interface{}) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case json.Number:
+		if !strings.ContainsAny(string(v), ".eE") {
+			if i, err := v.Int64(); err == nil {
+				return i, nil
+			}
+		}
+		return v.Float64()
+	case []interface{}:
+		for i, elem := range v {
+			if v[i], err = convertRelationNumbers(elem); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for key, elem := range v {
+			if v[key], err = convertRelationNumbers(elem); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"math"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type RelationDataSuite struct{}
+
+var _ = gc.Suite(&RelationDataSuite{})
+
+func (s *RelationDataSuite) TestRoundTrip(c *gc.C) {
+	data := map[string]interface{}{
+		"host":    "10.0.0.1",
+		"port":    3306,
+		"number":  "42",
+		"ratio":   1.0,
+		"small":   float32(0.5),
+		"ready":   true,
+		"nothing": nil,
+		"users":   []string{"admin", "guest"},
+		"limits": map[string]interface{}{
+			"conns":   int64(100),
+			"timeout": 2.5,
+			"tags":    []interface{}{"a", 1},
+		},
+	}
+	var codec charm.RelationDataCodec
+	bag, err := codec.Marshal(data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(bag, jc.DeepEquals, map[string]string{
+		"host":    `"10.0.0.1"`,
+		"port":    `3306`,
+		"number":  `"42"`,
+		"ratio":   `1.0`,
+		"small":   `0.5`,
+		"ready":   `true`,
+		"nothing": `null`,
+		"users":   `["admin","guest"]`,
+		"limits":  `{"conns":100,"tags":["a",1],"timeout":2.5}`,
+	})
+	decoded, err := codec.Unmarshal(bag)
+	c.Assert(err, gc.IsNil)
+	c.Assert(decoded, jc.DeepEquals, map[string]interface{}{
+		"host":    "10.0.0.1",
+		"port":    int64(3306),
+		"number":  "42",
+		"ratio":   1.0,
+		"small":   0.5,
+		"ready":   true,
+		"nothing": nil,
+		"users":   []interface{}{"admin", "guest"},
+		"limits": map[string]interface{}{
+			"conns":   int64(100),
+			"timeout": 2.5,
+			"tags":    []interface{}{"a", int64(1)},
+		},
+	})
+}
+
+func (s *RelationDataSuite) TestUnmarshalRawValues(c *gc.C) {
+	// Values set without the codec are read as well as they can be.
+	decoded, err := charm.RelationDataCodec{}.Unmarshal(map[string]string{
+		"host":     "10.0.0.1",
+		"port":     "3306",
+		"enabled":  "true",
+		"password": "s3cret pass",
+		"list":     "[1, 2",
+		"two":      "1 2",
+		"big":      "1e400",
+		"empty":    "",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(decoded, jc.DeepEquals, map[string]interface{}{
+		"host":     "10.0.0.1",
+		"port":     int64(3306),
+		"enabled":  true,
+		"password": "s3cret pass",
+		"list":     "[1, 2",
+		"two":      "1 2",
+		"big":      "1e400",
+		"empty":    "",
+	})
+}
+
+var marshalRelationDataErrorTests = []struct {
+	data map[string]interface{}
+	err  string
+}{{
+	data: map[string]interface{}{"": "x"},
+	err:  `invalid relation data key ""`,
+}, {
+	data: map[string]interface{}{" host": "x"},
+	err:  `invalid relation data key " host"`,
+}, {
+	data: map[string]interface{}{"ratio": math.NaN()},
+	err:  `cannot encode relation data key "ratio": unsupported value NaN`,
+}, {
+	data: map[string]interface{}{"m": map[int]string{1: "x"}},
+	err:  `cannot encode relation data key "m": unsupported map key type int`,
+}, {
+	data: map[string]interface{}{"f": func() {}},
+	err:  `cannot encode relation data key "f": unsupported type func\(\)`,
+}}
+
+func (s *RelationDataSuite) TestMarshalErrors(c *gc.C) {
+	for i, test := range marshalRelationDataErrorTests {
+		c.Logf("test %d: %v", i, test.err)
+		_, err := charm.RelationDataCodec{}.Marshal(test.data)
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *RelationDataSuite) TestMaxSize(c *gc.C) {
+	codec := charm.RelationDataCodec{MaxSize: 16}
+	bag, err := codec.Marshal(map[string]interface{}{"host": "10.0.0.1"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(codec.CheckSize(bag), gc.IsNil)
+
+	_, err = codec.Marshal(map[string]interface{}{"host": "10.0.0.1", "port": 3306})
+	c.Assert(err, gc.ErrorMatches, "relation data size 22 exceeds maximum 16")
+	_, err = codec.Unmarshal(map[string]string{"hostname": "db.example.com"})
+	c.Assert(err, gc.ErrorMatches, "relation data size 22 exceeds maximum 16")
+}
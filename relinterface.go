@@ -0,0 +1,90 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Interface identifies a relation interface and the version of the
+// relation data contract it uses, as written in the interface field
+// of a relation in the form "mysql@2". A version lets the contract
+// evolve without charms using incompatible versions being related.
+type Interface struct {
+	Name string
+
+	// Version holds the version of the interface,
+	// or zero if none is specified.
+	Version int
+}
+
+// ParseInterface parses an interface as written in charm
+// metadata, with an optional version: "mysql" or "mysql@2".
+func ParseInterface(s string) (Interface, error) {
+	i := strings.LastIndex(s, "@")
+	if i < 0 {
+		return Interface{Name: s}, nil
+	}
+	if i == 0 {
+		return Interface{}, fmt.Errorf("invalid interface %q: no name", s)
+	}
+	version, err := strconv.Atoi(s[i+1:])
+	if err != nil || version < 1 || s[i+1] == '+' || s[i+1] == '0' {
+		return Interface{}, fmt.Errorf("invalid interface %q: version must be a positive integer", s)
+	}
+	return Interface{
+		Name:    s[:i],
+		Version: version,
+	}, nil
+}
+
+// String returns the interface in the form accepted by ParseInterface.
+func (i Interface) String() string {
+	if i.Version == 0 {
+		return i.Name
+	}
+	return i.Name + "@" + strconv.Itoa(i.Version)
+}
+
+// CompatibleWith reports whether endpoints using interfaces i and
+// other may be related. The interfaces must have the same name and,
+// if both specify a version, the same version, as a new version of an
+// interface is not expected to be compatible with earlier ones. An
+// interface without a version is compatible with every version of
+// the same interface, so that charms may adopt versions gradually.
+func (i Interface) CompatibleWith(other Interface) bool {
+	if i.Name != other.Name {
+		return false
+	}
+	return i.Version == 0 || other.Version == 0 || i.Version == other.Version
+}
+
+// ParsedInterface returns the relation's interface, parsed as by
+// ParseInterface. If the interface is invalid, it is returned as
+// the interface name.
+func (r Relation) ParsedInterface() Interface {
+	i, err := ParseInterface(r.Interface)
+	if err != nil {
+		return Interface{Name: r.Interface}
+	}
+	return i
+}
+
+// CanRelateTo reports whether the relation may be established with
+// the other relation: their roles must be counterparts, a provider
+// relating to a requirer or a peer to a peer, and their interfaces
+// must be compatible, as determined by Interface.CompatibleWith.
+func (r Relation) CanRelateTo(other Relation) bool {
+	switch r.Role {
+	case RoleProvider, RoleRequirer, RolePeer:
+	default:
+		return false
+	}
+	if counterpartRole(r.Role) != other.Role {
+		return false
+	}
+	return r.ParsedInterface().CompatibleWith(other.ParsedInterface())
+}
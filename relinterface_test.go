@@ -0,0 +1,137 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type InterfaceSuite struct{}
+
+var _ = gc.Suite(&InterfaceSuite{})
+
+var parseInterfaceTests = []struct {
+	s      string
+	expect charm.Interface
+	err    string
+}{{
+	s:      "mysql",
+	expect: charm.Interface{Name: "mysql"},
+}, {
+	s:      "mysql@2",
+	expect: charm.Interface{Name: "mysql", Version: 2},
+}, {
+	s:      "my@sql@10",
+	expect: charm.Interface{Name: "my@sql", Version: 10},
+}, {
+	s:   "@2",
+	err: `invalid interface "@2": no name`,
+}, {
+	s:   "mysql@",
+	err: `invalid interface "mysql@": version must be a positive integer`,
+}, {
+	s:   "mysql@0",
+	err: `invalid interface "mysql@0": version must be a positive integer`,
+}, {
+	s:   "mysql@02",
+	err: `invalid interface "mysql@02": version must be a positive integer`,
+}, {
+	s:   "mysql@+2",
+	err: `invalid interface "mysql@\+2": version must be a positive integer`,
+}, {
+	s:   "mysql@two",
+	err: `invalid interface "mysql@two": version must be a positive integer`,
+}}
+
+func (s *InterfaceSuite) TestParseInterface(c *gc.C) {
+	for i, test := range parseInterfaceTests {
+		c.Logf("test %d: %q", i, test.s)
+		iface, err := charm.ParseInterface(test.s)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(iface, gc.Equals, test.expect)
+		c.Assert(iface.String(), gc.Equals, test.s)
+	}
+}
+
+var compatibleTests = []struct {
+	a, b       string
+	compatible bool
+}{
+	{"mysql", "mysql", true},
+	{"mysql", "mysql@2", true},
+	{"mysql@2", "mysql", true},
+	{"mysql@2", "mysql@2", true},
+	{"mysql@1", "mysql@2", false},
+	{"mysql@2", "pgsql@2", false},
+	{"mysql", "pgsql", false},
+}
+
+func (s *InterfaceSuite) TestCompatibleWith(c *gc.C) {
+	for i, test := range compatibleTests {
+		c.Logf("test %d: %s %s", i, test.a, test.b)
+		a, err := charm.ParseInterface(test.a)
+		c.Assert(err, gc.IsNil)
+		b, err := charm.ParseInterface(test.b)
+		c.Assert(err, gc.IsNil)
+		c.Assert(a.CompatibleWith(b), gc.Equals, test.compatible)
+		prov := charm.Relation{Role: charm.RoleProvider, Interface: test.a}
+		req := charm.Relation{Role: charm.RoleRequirer, Interface: test.b}
+		c.Assert(prov.CanRelateTo(req), gc.Equals, test.compatible)
+		c.Assert(req.CanRelateTo(prov), gc.Equals, test.compatible)
+	}
+}
+
+func (s *InterfaceSuite) TestCanRelateToRoles(c *gc.C) {
+	prov := charm.Relation{Role: charm.RoleProvider, Interface: "http"}
+	req := charm.Relation{Role: charm.RoleRequirer, Interface: "http"}
+	peer := charm.Relation{Role: charm.RolePeer, Interface: "http"}
+	c.Assert(prov.CanRelateTo(prov), jc.IsFalse)
+	c.Assert(req.CanRelateTo(req), jc.IsFalse)
+	c.Assert(prov.CanRelateTo(peer), jc.IsFalse)
+	c.Assert(peer.CanRelateTo(peer), jc.IsTrue)
+	c.Assert(charm.Relation{Interface: "http"}.CanRelateTo(req), jc.IsFalse)
+}
+
+func (s *InterfaceSuite) TestMetaInterfaces(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(`
+name: versioned
+summary: s
+description: d
+provides:
+  db: mysql@2
+requires:
+  cache: memcache
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Provides["db"].Interface, gc.Equals, "mysql@2")
+	c.Assert(meta.Provides["db"].ParsedInterface(), gc.Equals, charm.Interface{Name: "mysql", Version: 2})
+	c.Assert(meta.Requires["cache"].ParsedInterface(), gc.Equals, charm.Interface{Name: "memcache"})
+
+	_, err = charm.ReadMeta(strings.NewReader(`
+name: versioned
+summary: s
+description: d
+provides:
+  db: mysql@latest
+`))
+	c.Assert(err, gc.ErrorMatches, `charm "versioned" relation "db" has invalid interface "mysql@latest": version must be a positive integer`)
+
+	_, err = charm.ReadMeta(strings.NewReader(`
+name: versioned
+summary: s
+description: d
+provides:
+  info: juju-info@2
+`))
+	c.Assert(err, gc.ErrorMatches, `charm "versioned" relation "info" using a reserved interface: "juju-info@2"`)
+}
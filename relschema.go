@@ -0,0 +1,160 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/juju/schema"
+)
+
+// RelationSchema describes the data that units are expected to set
+// on a relation, as declared in the schema field of the relation in
+// metadata.yaml. Each key is given either a type or a map holding its
+// type, description and whether it is required:
+//
+//	provides:
+//	  db:
+//	    interface: mysql
+//	    schema:
+//	      host: string
+//	      port: {type: int, required: true, description: The port.}
+//
+// The types are those of configuration options: string, int,
+// float and boolean.
+type RelationSchema struct {
+	Fields map[string]RelationField
+}
+
+// RelationField describes a key in the data of a relation.
+type RelationField struct {
+	Type        string
+	Description string `bson:",omitempty"`
+	Required    bool   `bson:",omitempty"`
+}
+
+// ValidateRelationData checks the given data, as set by a unit on the
+// given relation, against the relation's schema: every required key
+// must be present and every value must be of its key's type. Keys not
+// in the schema are allowed, as Juju sets some keys itself, as are all
+// keys if the relation has no schema.
+func ValidateRelationData(rel Relation, data map[string]string) error {
+	if rel.Schema == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(rel.Schema.Fields))
+	for key := range rel.Schema.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field := rel.Schema.Fields[key]
+		value, ok := data[key]
+		if !ok {
+			if field.Required {
+				return fmt.Errorf("relation %q: missing required key %q", rel.Name, key)
+			}
+			continue
+		}
+		if !validRelationValue(field.Type, value) {
+			return fmt.Errorf("relation %q: key %q: expected %s, got %q", rel.Name, key, field.Type, value)
+		}
+	}
+	return nil
+}
+
+// validRelationValue reports whether the given
+// relation data value is of the given type.
+func validRelationValue(fieldType, value string) bool {
+	var err error
+	switch fieldType {
+	case "int":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "float":
+		_, err = strconv.ParseFloat(value, 64)
+	case "boolean":
+		_, err = strconv.ParseBool(value)
+	}
+	return err == nil
+}
+
+// relationSchemaC coerces the schema field of a relation into
+// a *RelationSchema, or nil if the field is empty.
+type relationSchemaC struct{}
+
+var (
+	relationSchemaMapC   = schema.StringMap(schema.Any())
+	relationFieldSchemaC = schema.FieldMap(
+		schema.Fields{
+			"type":        schema.String(),
+			"description": schema.String(),
+			"required":    schema.Bool(),
+		},
+		schema.Defaults{
+			"description": "",
+			"required":    false,
+		},
+	)
+)
+
+func (relationSchemaC) Coerce(v interface{}, path []string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	m, err := relationSchemaMapC.Coerce(v, path)
+	if err != nil {
+		return nil, err
+	}
+	s := &RelationSchema{
+		Fields: make(map[string]RelationField),
+	}
+	for key, fv := range m.(map[string]interface{}) {
+		keyPath := append(path[:len(path):len(path)], ".", key)
+		var field RelationField
+		if t, ok := fv.(string); ok {
+			field.Type = t
+		} else {
+			f, err := relationFieldSchemaC.Coerce(fv, keyPath)
+			if err != nil {
+				return nil, err
+			}
+			fields := f.(map[string]interface{})
+			field = RelationField{
+				Type:        fields["type"].(string),
+				Description: fields["description"].(string),
+				Required:    fields["required"].(bool),
+			}
+		}
+		if _, ok := optionTypeCheckers[field.Type]; !ok {
+			return nil, fmt.Errorf("%sunknown type %q", schemaPathPrefix(keyPath), field.Type)
+		}
+		s.Fields[key] = field
+	}
+	return s, nil
+}
+
+// encodeRelationSchema returns the metadata.yaml
+// representation of the given relation schema.
+func encodeRelationSchema(s *RelationSchema) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, field := range s.Fields {
+		if field.Description == "" && !field.Required {
+			result[key] = field.Type
+			continue
+		}
+		m := map[string]interface{}{
+			"type": field.Type,
+		}
+		if field.Description != "" {
+			m["description"] = field.Description
+		}
+		if field.Required {
+			m["required"] = true
+		}
+		result[key] = m
+	}
+	return result
+}
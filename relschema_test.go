@@ -0,0 +1,126 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type RelationSchemaSuite struct{}
+
+var _ = gc.Suite(&RelationSchemaSuite{})
+
+const relationSchemaMeta = `
+name: schemed
+summary: s
+description: d
+provides:
+  db:
+    interface: mysql
+    schema:
+      host: string
+      port: {type: int, required: true, description: The port.}
+      ssl: boolean
+requires:
+  cache: memcache
+peers:
+  cluster:
+    interface: cluster
+    schema:
+`
+
+func (s *RelationSchemaSuite) TestReadSchema(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(relationSchemaMeta))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Provides["db"].Schema, jc.DeepEquals, &charm.RelationSchema{
+		Fields: map[string]charm.RelationField{
+			"host": {Type: "string"},
+			"port": {Type: "int", Required: true, Description: "The port."},
+			"ssl":  {Type: "boolean"},
+		},
+	})
+	c.Assert(meta.Requires["cache"].Schema, gc.IsNil)
+	c.Assert(meta.Peers["cluster"].Schema, gc.IsNil)
+}
+
+func (s *RelationSchemaSuite) TestSchemaSaved(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	meta, err := charm.ReadMeta(strings.NewReader(relationSchemaMeta))
+	c.Assert(err, gc.IsNil)
+	dir.SetMeta(meta)
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+	saved, err := charm.ReadCharmDir(dir.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(saved.Meta().Provides["db"].Schema, jc.DeepEquals, meta.Provides["db"].Schema)
+}
+
+var invalidSchemaTests = []struct {
+	schema string
+	err    string
+}{{
+	schema: "[host]",
+	err:    `.*provides.db.schema: expected map, got .*`,
+}, {
+	schema: "{host: text}",
+	err:    `.*provides.db.schema.host: unknown type "text"`,
+}, {
+	schema: "{host: {required: true}}",
+	err:    `.*provides.db.schema.host.type: expected string, got nothing`,
+}}
+
+func (s *RelationSchemaSuite) TestInvalidSchema(c *gc.C) {
+	for i, test := range invalidSchemaTests {
+		c.Logf("test %d: %s", i, test.schema)
+		_, err := charm.ReadMeta(strings.NewReader(`
+name: schemed
+summary: s
+description: d
+provides:
+  db:
+    interface: mysql
+    schema: ` + test.schema + "\n"))
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+var validateRelationDataTests = []struct {
+	data map[string]string
+	err  string
+}{{
+	data: map[string]string{"port": "3306"},
+}, {
+	data: map[string]string{"host": "db", "port": "3306", "ssl": "true", "private-address": "10.0.0.1"},
+}, {
+	data: map[string]string{"host": "db"},
+	err:  `relation "db": missing required key "port"`,
+}, {
+	data: map[string]string{"port": "three"},
+	err:  `relation "db": key "port": expected int, got "three"`,
+}, {
+	data: map[string]string{"port": "1", "ssl": "maybe"},
+	err:  `relation "db": key "ssl": expected boolean, got "maybe"`,
+}}
+
+func (s *RelationSchemaSuite) TestValidateRelationData(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(relationSchemaMeta))
+	c.Assert(err, gc.IsNil)
+	for i, test := range validateRelationDataTests {
+		c.Logf("test %d: %v", i, test.data)
+		err := charm.ValidateRelationData(meta.Provides["db"], test.data)
+		if test.err == "" {
+			c.Assert(err, gc.IsNil)
+		} else {
+			c.Assert(err, gc.ErrorMatches, test.err)
+		}
+	}
+	err = charm.ValidateRelationData(meta.Requires["cache"], map[string]string{"anything": "goes"})
+	c.Assert(err, gc.IsNil)
+}
@@ -0,0 +1,184 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minRangeRead holds the minimum number of bytes requested by
+// each range request. Reading a zip file involves many small
+// reads of neighbouring data, which are served from the last
+// block read.
+const minRangeRead = 32 * 1024
+
+// HTTPReaderAt is an io.ReaderAt that reads a remote file
+// using HTTP range requests, so that only the parts of the
+// file that are needed are downloaded.
+type HTTPReaderAt struct {
+	client *http.Client
+	url    string
+	size   int64
+
+	mu        sync.Mutex
+	block     []byte
+	blockOff  int64
+	nrequests int
+}
+
+// NewHTTPReaderAt returns an HTTPReaderAt reading the file at the
+// given URL with the given client, or http.DefaultClient if client
+// is nil. It returns an error if the server does not support range
+// requests.
+func NewHTTPReaderAt(client *http.Client, url string) (*HTTPReaderAt, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r := &HTTPReaderAt{
+		client: client,
+		url:    url,
+	}
+	// Find out the size of the file by reading its first block.
+	data, size, err := r.get(0, minRangeRead)
+	if err != nil {
+		return nil, err
+	}
+	r.size = size
+	r.block = data
+	return r, nil
+}
+
+// Size returns the size of the remote file.
+func (r *HTTPReaderAt) Size() int64 {
+	return r.size
+}
+
+// Requests returns the number of range requests made so far.
+func (r *HTTPReaderAt) Requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.nrequests
+}
+
+// ReadAt implements io.ReaderAt.ReadAt.
+func (r *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if off < r.blockOff || end > r.blockOff+int64(len(r.block)) {
+		length := end - off
+		if length < minRangeRead {
+			length = minRangeRead
+		}
+		data, _, err := r.get(off, length)
+		if err != nil {
+			return 0, err
+		}
+		r.block, r.blockOff = data, off
+	}
+	n := copy(p, r.block[off-r.blockOff:end-r.blockOff])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// get requests length bytes of the file starting at off, and returns
+// the data received along with the total size of the file. Fewer
+// bytes are returned if the file ends first.
+func (r *HTTPReaderAt) get(off, length int64) ([]byte, int64, error) {
+	r.nrequests++
+	req, err := http.NewRequest("GET", r.url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+length-1))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return nil, 0, fmt.Errorf("cannot read %q: server does not support range requests", r.url)
+	default:
+		return nil, 0, fmt.Errorf("cannot read %q: %s", r.url, resp.Status)
+	}
+	start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot read %q: %v", r.url, err)
+	}
+	if start != off {
+		return nil, 0, fmt.Errorf("cannot read %q: server returned range starting at %d, not %d", r.url, start, off)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, length))
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot read %q: %v", r.url, err)
+	}
+	if want := min64(length, size-off); int64(len(data)) < want {
+		return nil, 0, fmt.Errorf("cannot read %q: expected %d bytes, got %d", r.url, want, len(data))
+	}
+	return data, size, nil
+}
+
+// parseContentRange parses the value of a Content-Range header
+// of the form "bytes start-end/size".
+func parseContentRange(s string) (start, size int64, err error) {
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	parts := strings.SplitN(s[len("bytes "):], "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	bounds := strings.SplitN(parts[0], "-", 2)
+	start, err = strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	size, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	return start, size, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ReadRemoteCharmArchive returns a CharmArchive reading the charm
+// archive at the given URL with HTTP range requests, using the given
+// client, or http.DefaultClient if client is nil. Only the archive's
+// central directory and the files holding the charm's metadata,
+// configuration, actions and revision are downloaded, so that
+// information about the charm can be shown without downloading the
+// whole archive; other files are downloaded only if they are read,
+// for example by ExpandTo.
+func ReadRemoteCharmArchive(client *http.Client, url string) (*CharmArchive, error) {
+	r, err := NewHTTPReaderAt(client, url)
+	if err != nil {
+		return nil, err
+	}
+	return ReadCharmArchiveFromReader(r, r.Size())
+}
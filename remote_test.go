@@ -0,0 +1,149 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type RemoteSuite struct {
+	archive []byte
+	server  *httptest.Server
+
+	mu     sync.Mutex
+	served int64
+	ranges bool
+}
+
+var _ = gc.Suite(&RemoteSuite{})
+
+func (s *RemoteSuite) SetUpSuite(c *gc.C) {
+	// Make a charm holding a large incompressible file.
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	big := make([]byte, 1<<20)
+	rand.New(rand.NewSource(0)).Read(big)
+	err := ioutil.WriteFile(filepath.Join(path, "big"), big, 0644)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	err = dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	s.archive = buf.Bytes()
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+}
+
+func (s *RemoteSuite) TearDownSuite(c *gc.C) {
+	s.server.Close()
+}
+
+func (s *RemoteSuite) SetUpTest(c *gc.C) {
+	s.served = 0
+	s.ranges = true
+}
+
+func (s *RemoteSuite) serve(w http.ResponseWriter, req *http.Request) {
+	if !s.ranges {
+		req.Header.Del("Range")
+	}
+	cw := &countingWriter{ResponseWriter: w}
+	http.ServeContent(cw, req, "", time.Time{}, bytes.NewReader(s.archive))
+	s.mu.Lock()
+	s.served += cw.n
+	s.mu.Unlock()
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (s *RemoteSuite) TestReadRemoteCharmArchive(c *gc.C) {
+	archive, err := charm.ReadRemoteCharmArchive(nil, s.server.URL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+	c.Assert(archive.Config().Options["title"].Default, gc.Equals, "My Title")
+	c.Assert(archive.Actions().ActionSpecs, gc.Not(gc.HasLen), 0)
+	c.Assert(archive.Revision(), gc.Equals, 1)
+
+	// Only a small part of the archive was downloaded.
+	c.Assert(s.served < int64(len(s.archive))/4, jc.IsTrue, gc.Commentf("served %d of %d bytes", s.served, len(s.archive)))
+
+	// The rest of the archive can still be read.
+	dir := c.MkDir()
+	err = archive.ExpandTo(dir)
+	c.Assert(err, gc.IsNil)
+	big, err := ioutil.ReadFile(filepath.Join(dir, "big"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(big, gc.HasLen, 1<<20)
+}
+
+func (s *RemoteSuite) TestHTTPReaderAt(c *gc.C) {
+	r, err := charm.NewHTTPReaderAt(nil, s.server.URL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(r.Size(), gc.Equals, int64(len(s.archive)))
+	c.Assert(r.Requests(), gc.Equals, 1)
+
+	// Reads within the first block are served without
+	// further requests.
+	buf := make([]byte, 100)
+	n, err := r.ReadAt(buf, 50)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 100)
+	c.Assert(buf, jc.DeepEquals, s.archive[50:150])
+	c.Assert(r.Requests(), gc.Equals, 1)
+
+	// Reads beyond it are not.
+	buf = make([]byte, 64*1024)
+	n, err = r.ReadAt(buf, 200000)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, len(buf))
+	c.Assert(buf, jc.DeepEquals, s.archive[200000:200000+len(buf)])
+	c.Assert(r.Requests(), gc.Equals, 2)
+
+	// Reads past the end of the file return io.EOF.
+	size := len(s.archive)
+	buf = make([]byte, 100)
+	n, err = r.ReadAt(buf, int64(size-10))
+	c.Assert(err, gc.Equals, io.EOF)
+	c.Assert(n, gc.Equals, 10)
+	c.Assert(buf[:10], jc.DeepEquals, s.archive[size-10:])
+	n, err = r.ReadAt(buf, int64(size))
+	c.Assert(err, gc.Equals, io.EOF)
+	c.Assert(n, gc.Equals, 0)
+}
+
+func (s *RemoteSuite) TestNoRangeSupport(c *gc.C) {
+	s.ranges = false
+	_, err := charm.ReadRemoteCharmArchive(nil, s.server.URL)
+	c.Assert(err, gc.ErrorMatches, `cannot read ".*": server does not support range requests`)
+}
+
+func (s *RemoteSuite) TestNotFound(c *gc.C) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	_, err := charm.NewHTTPReaderAt(nil, server.URL)
+	c.Assert(err, gc.ErrorMatches, `cannot read ".*": 404 Not Found`)
+}
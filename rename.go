@@ -0,0 +1,136 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"gopkg.in/juju/charm.v4/hooks"
+)
+
+// RenameRelation renames the relation named oldName in the charm
+// expanded in dir to newName. It rewrites metadata.yaml, as Save
+// does, and renames the relation's hooks. Other references to the
+// relation cannot be changed reliably, so RenameRelation returns
+// the slash-separated paths, relative to the charm directory, of
+// the files that still mention oldName; they should be checked
+// by hand. Hidden files and the build directory are not checked,
+// as they are not archived.
+func RenameRelation(dir *CharmDir, oldName, newName string) ([]string, error) {
+	if dir.readOnly {
+		return nil, ErrReadOnly
+	}
+	if err := renameRelation(dir, oldName, newName); err != nil {
+		return nil, fmt.Errorf("cannot rename relation %q to %q: %v", oldName, newName, err)
+	}
+	return filesMentioning(dir.Path, oldName)
+}
+
+func renameRelation(dir *CharmDir, oldName, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("empty relation name")
+	}
+	meta := *dir.Meta()
+	relations := []*map[string]Relation{&meta.Provides, &meta.Requires, &meta.Peers}
+	var found *map[string]Relation
+	for _, rels := range relations {
+		if _, ok := (*rels)[newName]; ok {
+			return fmt.Errorf("charm %q already has relation %q", meta.Name, newName)
+		}
+		if _, ok := (*rels)[oldName]; ok {
+			found = rels
+		}
+	}
+	if found == nil {
+		return fmt.Errorf("charm %q has no relation %q", meta.Name, oldName)
+	}
+	// Copy the relations so that the original metadata
+	// is left alone if the rename fails.
+	renamed := make(map[string]Relation)
+	for name, rel := range *found {
+		if name == oldName {
+			name = newName
+			rel.Name = newName
+		}
+		renamed[name] = rel
+	}
+	*found = renamed
+
+	// Check that the hooks can be renamed before changing anything.
+	var renames [][2]string
+	for _, kind := range hooks.RelationHooks() {
+		oldPath := dir.join(HooksDir, oldName+"-"+string(kind))
+		newPath := dir.join(HooksDir, newName+"-"+string(kind))
+		if _, err := os.Lstat(oldPath); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(newPath); err == nil {
+			return fmt.Errorf("hook %q already exists", filepath.Base(newPath))
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		renames = append(renames, [2]string{oldPath, newPath})
+	}
+	oldMeta, oldSourceMap := dir.meta, dir.metaSourceMap
+	dir.SetMeta(&meta)
+	if err := dir.Save(); err != nil {
+		dir.meta, dir.metaSourceMap = oldMeta, oldSourceMap
+		delete(dir.changed, MetadataFile)
+		return err
+	}
+	for _, r := range renames {
+		if err := os.Rename(r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filesMentioning returns the slash-separated paths, relative to
+// root, of the archivable files under root that mention the given
+// name. Binary files are ignored.
+func filesMentioning(root, name string) ([]string, error) {
+	word := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+	var paths []string
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relpath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		hidden := len(relpath) > 1 && relpath[0] == '.'
+		if fi.IsDir() {
+			if hidden || relpath == "build" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if hidden || !fi.Mode().IsRegular() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(data, 0) == -1 && word.Match(data) {
+			paths = append(paths, filepath.ToSlash(relpath))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type RenameSuite struct{}
+
+var _ = gc.Suite(&RenameSuite{})
+
+func (s *RenameSuite) TestRenameRelation(c *gc.C) {
+	charmDir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "all-hooks")
+	err := ioutil.WriteFile(filepath.Join(charmDir, "hooks", "install"), []byte("#!/bin/sh\nrelation-ids foo\n"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(filepath.Join(charmDir, ".notes"), []byte("foo\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+
+	paths, err := charm.RenameRelation(dir, "foo", "baz")
+	c.Assert(err, gc.IsNil)
+	c.Assert(paths, gc.DeepEquals, []string{"hooks/install"})
+
+	expect := charm.Relation{
+		Name:      "baz",
+		Role:      charm.RoleProvider,
+		Interface: "phony",
+		Scope:     charm.ScopeGlobal,
+	}
+	c.Assert(dir.Meta().Provides, gc.DeepEquals, map[string]charm.Relation{"baz": expect})
+	dir, err = charm.ReadCharmDir(charmDir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Meta().Provides, gc.DeepEquals, map[string]charm.Relation{"baz": expect})
+	for _, kind := range []string{"joined", "changed", "departed", "broken"} {
+		_, err := os.Stat(filepath.Join(charmDir, "hooks", "baz-relation-"+kind))
+		c.Check(err, gc.IsNil)
+		_, err = os.Stat(filepath.Join(charmDir, "hooks", "foo-relation-"+kind))
+		c.Check(os.IsNotExist(err), gc.Equals, true)
+	}
+}
+
+var renameRelationErrorTests = []struct {
+	about   string
+	oldName string
+	newName string
+	hook    string
+	err     string
+}{{
+	about:   "unknown relation",
+	oldName: "nope",
+	newName: "baz",
+	err:     `cannot rename relation "nope" to "baz": charm "all-hooks" has no relation "nope"`,
+}, {
+	about:   "existing relation",
+	oldName: "foo",
+	newName: "self",
+	err:     `cannot rename relation "foo" to "self": charm "all-hooks" already has relation "self"`,
+}, {
+	about:   "existing hook",
+	oldName: "foo",
+	newName: "baz",
+	hook:    "baz-relation-changed",
+	err:     `cannot rename relation "foo" to "baz": hook "baz-relation-changed" already exists`,
+}, {
+	about:   "reserved name",
+	oldName: "foo",
+	newName: "juju-foo",
+	err:     `cannot rename relation "foo" to "juju-foo": cannot save metadata.yaml: charm "all-hooks" using a reserved relation name: "juju-foo"`,
+}}
+
+func (s *RenameSuite) TestRenameRelationErrors(c *gc.C) {
+	for i, test := range renameRelationErrorTests {
+		c.Logf("test %d: %s", i, test.about)
+		charmDir := charmtesting.Charms.ClonedDirPath(c.MkDir(), "all-hooks")
+		if test.hook != "" {
+			err := ioutil.WriteFile(filepath.Join(charmDir, "hooks", test.hook), nil, 0755)
+			c.Assert(err, gc.IsNil)
+		}
+		dir, err := charm.ReadCharmDir(charmDir)
+		c.Assert(err, gc.IsNil)
+		meta := dir.Meta()
+
+		_, err = charm.RenameRelation(dir, test.oldName, test.newName)
+		c.Assert(err, gc.ErrorMatches, test.err)
+		c.Assert(dir.Meta(), gc.Equals, meta)
+		_, err = os.Stat(filepath.Join(charmDir, "hooks", "foo-relation-joined"))
+		c.Assert(err, gc.IsNil)
+		dir, err = charm.ReadCharmDir(charmDir)
+		c.Assert(err, gc.IsNil)
+		c.Assert(dir.Meta(), gc.DeepEquals, meta)
+	}
+}
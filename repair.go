@@ -0,0 +1,308 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	localHeaderSignature   = 0x04034b50
+	centralHeaderSignature = 0x02014b50
+	dataDescriptorSig      = 0x08074b50
+	localHeaderLen         = 30
+	centralHeaderLen       = 46
+
+	// Flags in the general purpose bit field.
+	flagEncrypted      = 0x1
+	flagDataDescriptor = 0x8
+)
+
+// maxRepairDecompressed holds the number of bytes RepairArchive
+// decompresses, over all its attempts to read files, before it gives
+// up. As a file is looked for at every local header signature found,
+// a damaged archive may be decompressed many times over.
+var maxRepairDecompressed int64 = 1 << 30
+
+// RepairReport describes the outcome of RepairArchive.
+type RepairReport struct {
+	// Recovered holds the names of the files that were
+	// recovered, in the order they were found.
+	Recovered []string
+
+	// Damaged holds the names of the files that were found
+	// but could not be recovered, in the order they were found.
+	Damaged []string
+}
+
+// RepairArchive salvages what it can from a damaged zip archive, such
+// as a charm whose upload was truncated, and writes the recovered
+// files as a new archive to w. Rather than relying on the central
+// directory at the end of the archive, it scans the archive for the
+// local header that precedes each file, and recovers each file whose
+// contents are intact, as shown by their checksum. File modes are
+// taken from whatever part of the central directory survives. The
+// returned report lists the files recovered and those found damaged;
+// an error is returned only if the archive cannot be read or written,
+// or if recovering it means decompressing more than 1GiB of data.
+//
+// The recovered archive need not be a valid charm: the caller should
+// check the report, or read the archive, to find out.
+func RepairArchive(r io.Reader, w io.Writer) (*RepairReport, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	modes := centralDirectoryModes(data)
+	report := &RepairReport{}
+	seen := make(map[string]bool)
+	zipw := zip.NewWriter(w)
+	budget := maxRepairDecompressed
+	for offset := 0; ; {
+		i := bytes.Index(data[offset:], signatureBytes(localHeaderSignature))
+		if i < 0 {
+			break
+		}
+		offset += i
+		member, ok := readLocalMember(data, offset, budget)
+		budget -= member.decompressed
+		if budget < 0 {
+			return nil, fmt.Errorf("cannot repair archive: more than %d bytes decompressed", maxRepairDecompressed)
+		}
+		if !ok {
+			if member.name != "" && !seen[member.name] {
+				report.Damaged = append(report.Damaged, member.name)
+			}
+			offset += 4
+			continue
+		}
+		offset = member.end
+		if seen[member.name] {
+			continue
+		}
+		seen[member.name] = true
+		h := &zip.FileHeader{
+			Name:         member.name,
+			Method:       member.method,
+			ModifiedTime: member.modTime,
+			ModifiedDate: member.modDate,
+		}
+		if attrs, ok := modes[member.name]; ok {
+			h.CreatorVersion = attrs.creatorVersion
+			h.ExternalAttrs = attrs.externalAttrs
+		}
+		fw, err := zipw.CreateHeader(h)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write(member.content); err != nil {
+			return nil, err
+		}
+		report.Recovered = append(report.Recovered, member.name)
+	}
+	if err := zipw.Close(); err != nil {
+		return nil, err
+	}
+	// A file that was damaged in one place may have been
+	// recovered from another.
+	damaged := report.Damaged[:0]
+	for _, name := range report.Damaged {
+		if !seen[name] {
+			damaged = append(damaged, name)
+		}
+	}
+	report.Damaged = damaged
+	return report, nil
+}
+
+// localMember holds a file read from a local header.
+type localMember struct {
+	name             string
+	method           uint16
+	modTime, modDate uint16
+	content          []byte
+
+	// decompressed holds the number of bytes
+	// decompressed while reading the file.
+	decompressed int64
+
+	// end holds the offset of the first byte after
+	// the file's data and any data descriptor.
+	end int
+}
+
+// readLocalMember reads the file whose local header starts at
+// the given offset in data, decompressing no more than
+// budget+1 bytes. If the file cannot be recovered, it
+// returns false, with the file's name if that could be read.
+func readLocalMember(data []byte, offset int, budget int64) (localMember, bool) {
+	var m localMember
+	if len(data)-offset < localHeaderLen {
+		return m, false
+	}
+	hdr := data[offset : offset+localHeaderLen]
+	le := binary.LittleEndian
+	flags := le.Uint16(hdr[6:])
+	m.method = le.Uint16(hdr[8:])
+	m.modTime = le.Uint16(hdr[10:])
+	m.modDate = le.Uint16(hdr[12:])
+	crc := le.Uint32(hdr[14:])
+	compressedSize := le.Uint32(hdr[18:])
+	size := le.Uint32(hdr[22:])
+	nameLen := int(le.Uint16(hdr[26:]))
+	extraLen := int(le.Uint16(hdr[28:]))
+	start := offset + localHeaderLen + nameLen + extraLen
+	if start > len(data) {
+		return m, false
+	}
+	m.name = string(data[offset+localHeaderLen : offset+localHeaderLen+nameLen])
+	if flags&flagEncrypted != 0 {
+		return m, false
+	}
+	var end int
+	switch m.method {
+	case zip.Store:
+		if flags&flagDataDescriptor != 0 {
+			// The size of the data is not recorded in the
+			// header, so look for a data descriptor that
+			// matches the data before it.
+			return readStoredMember(m, data, start)
+		}
+		end = start + int(size)
+		if end > len(data) {
+			return m, false
+		}
+		m.content = data[start:end]
+	case zip.Deflate:
+		// The compressed data marks its own end, so it can be
+		// read even if its size is recorded in a data
+		// descriptor. The bytes.Reader ensures that the
+		// decompressor reads no further than it needs.
+		limit := budget
+		if flags&flagDataDescriptor == 0 && size != ^uint32(0) && int64(size) < limit {
+			limit = int64(size)
+		}
+		br := bytes.NewReader(data[start:])
+		content, err := ioutil.ReadAll(io.LimitReader(flate.NewReader(br), limit+1))
+		m.decompressed = int64(len(content))
+		if err != nil || int64(len(content)) > limit {
+			return m, false
+		}
+		m.content = content
+		end = len(data) - br.Len()
+	default:
+		return m, false
+	}
+	if flags&flagDataDescriptor != 0 {
+		if len(data)-end >= 4 && le.Uint32(data[end:]) == dataDescriptorSig {
+			end += 4
+		}
+		if len(data)-end < 12 {
+			return m, false
+		}
+		crc = le.Uint32(data[end:])
+		size = le.Uint32(data[end+8:])
+		end += 12
+	} else if m.method == zip.Deflate && compressedSize != ^uint32(0) && end-start != int(compressedSize) {
+		return m, false
+	}
+	if uint32(len(m.content)) != size && size != ^uint32(0) {
+		return m, false
+	}
+	if crc32.ChecksumIEEE(m.content) != crc {
+		return m, false
+	}
+	m.end = end
+	return m, true
+}
+
+// readStoredMember reads the uncompressed data of a file, starting
+// at the given offset, whose size is recorded only in the data
+// descriptor that follows it. Only descriptors that start with their
+// optional signature can be found.
+//
+// The descriptor is looked for only before the next local header
+// signature, so that the data scanned for each header found does not
+// overlap and repairing an archive takes time linear in its size. A
+// stored file whose data holds a local header signature, such as an
+// uncompressed zip archive, cannot be recovered.
+func readStoredMember(m localMember, data []byte, start int) (localMember, bool) {
+	le := binary.LittleEndian
+	sig := signatureBytes(dataDescriptorSig)
+	limit := len(data)
+	if i := bytes.Index(data[start:], signatureBytes(localHeaderSignature)); i >= 0 {
+		limit = start + i
+	}
+	// The checksum of the data is computed as the
+	// descriptors are found, rather than afresh for each.
+	var crc uint32
+	summed := start
+	for end := start; ; end += 4 {
+		i := bytes.Index(data[end:limit], sig)
+		if i < 0 || limit-(end+i) < 16 {
+			return m, false
+		}
+		end += i
+		desc := data[end+4 : end+16]
+		if le.Uint32(desc[8:]) != uint32(end-start) {
+			continue
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, data[summed:end])
+		summed = end
+		if crc == le.Uint32(desc) {
+			m.content = data[start:end]
+			m.end = end + 16
+			return m, true
+		}
+	}
+}
+
+// fileAttrs holds the attributes of a file recorded
+// in the central directory.
+type fileAttrs struct {
+	creatorVersion uint16
+	externalAttrs  uint32
+}
+
+// centralDirectoryModes returns the attributes of the files
+// whose central directory headers can be found in data.
+func centralDirectoryModes(data []byte) map[string]fileAttrs {
+	le := binary.LittleEndian
+	attrs := make(map[string]fileAttrs)
+	sig := signatureBytes(centralHeaderSignature)
+	for offset := 0; ; offset += 4 {
+		i := bytes.Index(data[offset:], sig)
+		if i < 0 {
+			break
+		}
+		offset += i
+		if len(data)-offset < centralHeaderLen {
+			break
+		}
+		hdr := data[offset : offset+centralHeaderLen]
+		nameLen := int(le.Uint16(hdr[28:]))
+		if offset+centralHeaderLen+nameLen > len(data) {
+			break
+		}
+		name := string(data[offset+centralHeaderLen : offset+centralHeaderLen+nameLen])
+		attrs[name] = fileAttrs{
+			creatorVersion: le.Uint16(hdr[4:]),
+			externalAttrs:  le.Uint32(hdr[38:]),
+		}
+	}
+	return attrs
+}
+
+func signatureBytes(sig uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, sig)
+	return b
+}
@@ -0,0 +1,205 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type RepairSuite struct {
+	archiveData []byte
+}
+
+var _ = gc.Suite(&RepairSuite{})
+
+func (s *RepairSuite) SetUpSuite(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	s.archiveData = data
+}
+
+// centralDirectoryOffset returns the offset of the central
+// directory in the given zip archive.
+func centralDirectoryOffset(data []byte) int {
+	return bytes.Index(data, []byte{0x50, 0x4b, 0x01, 0x02})
+}
+
+func (s *RepairSuite) repair(c *gc.C, data []byte) (*charm.RepairReport, []byte) {
+	var buf bytes.Buffer
+	report, err := charm.RepairArchive(bytes.NewReader(data), &buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+	return report, buf.Bytes()
+}
+
+// zipModes returns the modes of the files in the given
+// zip archive, keyed by name.
+func zipModes(c *gc.C, data []byte) map[string]os.FileMode {
+	zipr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.IsNil)
+	modes := make(map[string]os.FileMode)
+	for _, fh := range zipr.File {
+		modes[fh.Name] = fh.Mode()
+	}
+	return modes
+}
+
+func names(modes map[string]os.FileMode) []string {
+	var names []string
+	for name := range modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedStrings(s []string) []string {
+	s = append([]string(nil), s...)
+	sort.Strings(s)
+	return s
+}
+
+func (s *RepairSuite) TestRepairIntactArchive(c *gc.C) {
+	report, data := s.repair(c, s.archiveData)
+	c.Assert(report.Damaged, gc.HasLen, 0)
+	c.Assert(sortedStrings(report.Recovered), gc.DeepEquals, names(zipModes(c, s.archiveData)))
+	c.Assert(zipModes(c, data), gc.DeepEquals, zipModes(c, s.archiveData))
+}
+
+func (s *RepairSuite) TestRepairDamagedCentralDirectory(c *gc.C) {
+	data := append([]byte(nil), s.archiveData...)
+	// Damage the end of central directory record, which
+	// is followed by the archive comment.
+	eocd := bytes.LastIndex(data, []byte{0x50, 0x4b, 0x05, 0x06})
+	c.Assert(eocd > 0, gc.Equals, true)
+	copy(data[eocd:], []byte{0, 0, 0, 0})
+	_, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.NotNil)
+
+	report, repaired := s.repair(c, data)
+	c.Assert(report.Damaged, gc.HasLen, 0)
+	c.Assert(sortedStrings(report.Recovered), gc.DeepEquals, names(zipModes(c, s.archiveData)))
+	// The file modes recorded in the central directory are kept.
+	c.Assert(zipModes(c, repaired), gc.DeepEquals, zipModes(c, s.archiveData))
+}
+
+func (s *RepairSuite) TestRepairTruncatedArchive(c *gc.C) {
+	data := s.archiveData[:centralDirectoryOffset(s.archiveData)]
+	report, _ := s.repair(c, data)
+	c.Assert(report.Damaged, gc.HasLen, 0)
+	c.Assert(sortedStrings(report.Recovered), gc.DeepEquals, names(zipModes(c, s.archiveData)))
+}
+
+func (s *RepairSuite) TestRepairDamagedFile(c *gc.C) {
+	data := append([]byte(nil), s.archiveData...)
+	// Damage the contents of the last file before the
+	// central directory.
+	end := centralDirectoryOffset(data)
+	start := bytes.LastIndex(data[:end], []byte{0x50, 0x4b, 0x03, 0x04})
+	nameLen := int(binary.LittleEndian.Uint16(data[start+26:]))
+	name := string(data[start+30 : start+30+nameLen])
+	dataStart := start + 30 + nameLen + int(binary.LittleEndian.Uint16(data[start+28:]))
+	data[dataStart] ^= 0xff
+
+	var buf bytes.Buffer
+	report, err := charm.RepairArchive(bytes.NewReader(data), &buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(report.Damaged, gc.DeepEquals, []string{name})
+	c.Assert(report.Recovered, gc.HasLen, len(zipModes(c, s.archiveData))-1)
+}
+
+func (s *RepairSuite) TestRepairNotAnArchive(c *gc.C) {
+	var buf bytes.Buffer
+	report, err := charm.RepairArchive(bytes.NewReader([]byte("not a zip file")), &buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(report.Recovered, gc.HasLen, 0)
+	c.Assert(report.Damaged, gc.HasLen, 0)
+}
+
+// deflatedZeros returns a zip archive holding a single
+// file of n zero bytes, compressed.
+func deflatedZeros(c *gc.C, n int) []byte {
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	w, err := zipw.CreateHeader(&zip.FileHeader{Name: "zeros", Method: zip.Deflate})
+	c.Assert(err, gc.IsNil)
+	_, err = w.Write(make([]byte, n))
+	c.Assert(err, gc.IsNil)
+	c.Assert(zipw.Close(), gc.IsNil)
+	return buf.Bytes()
+}
+
+func (s *RepairSuite) TestRepairDecompressesNoMoreThanDeclared(c *gc.C) {
+	defer charm.PatchMaxRepairDecompressed(1000)()
+	data := deflatedZeros(c, 1<<20)
+	// Record an understated size for the file in its local
+	// header, rather than in a data descriptor.
+	le := binary.LittleEndian
+	le.PutUint16(data[6:], le.Uint16(data[6:])&^0x8)
+	le.PutUint32(data[22:], 10)
+
+	var buf bytes.Buffer
+	report, err := charm.RepairArchive(bytes.NewReader(data), &buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(report.Recovered, gc.HasLen, 0)
+	c.Assert(report.Damaged, gc.DeepEquals, []string{"zeros"})
+}
+
+func (s *RepairSuite) TestRepairDecompressionLimit(c *gc.C) {
+	defer charm.PatchMaxRepairDecompressed(1000)()
+	data := deflatedZeros(c, 1<<20)
+
+	var buf bytes.Buffer
+	_, err := charm.RepairArchive(bytes.NewReader(data), &buf)
+	c.Assert(err, gc.ErrorMatches, "cannot repair archive: more than 1000 bytes decompressed")
+}
+
+func (s *RepairSuite) TestRepairManyHeadersAndDescriptors(c *gc.C) {
+	// Many empty local headers for stored files whose sizes are
+	// recorded in data descriptors, followed by many descriptors
+	// that match none of them, used to take time quadratic in
+	// the size of the archive to scan.
+	const n = 50000
+	le := binary.LittleEndian
+	var buf bytes.Buffer
+	hdr := make([]byte, 30)
+	le.PutUint32(hdr, 0x04034b50)
+	le.PutUint16(hdr[6:], 0x8)
+	for i := 0; i < n; i++ {
+		buf.Write(hdr)
+	}
+	desc := make([]byte, 16)
+	le.PutUint32(desc, 0x08074b50)
+	le.PutUint32(desc[12:], 1)
+	for i := 0; i < n; i++ {
+		buf.Write(desc)
+	}
+	var zipData bytes.Buffer
+	zipw := zip.NewWriter(&zipData)
+	w, err := zipw.CreateHeader(&zip.FileHeader{Name: "stored", Method: zip.Store})
+	c.Assert(err, gc.IsNil)
+	_, err = w.Write([]byte("stored contents"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(zipw.Close(), gc.IsNil)
+	buf.Write(zipData.Bytes())
+
+	var out bytes.Buffer
+	report, err := charm.RepairArchive(&buf, &out)
+	c.Assert(err, gc.IsNil)
+	c.Assert(report.Recovered, gc.DeepEquals, []string{"stored"})
+	c.Assert(report.Damaged, gc.HasLen, 0)
+}
@@ -16,6 +16,8 @@ import (
 	"strings"
 
 	"github.com/juju/utils"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
 )
 
 // CacheDir stores the charm cache directory path.
@@ -26,11 +28,25 @@ type InfoResponse struct {
 	CanonicalURL string   `json:"canonical-url,omitempty"`
 	Revision     int      `json:"revision"` // Zero is valid. Can't omitempty.
 	Sha256       string   `json:"sha256,omitempty"`
+	Sha384       string   `json:"sha384,omitempty"`
 	Digest       string   `json:"digest,omitempty"`
 	Errors       []string `json:"errors,omitempty"`
 	Warnings     []string `json:"warnings,omitempty"`
 }
 
+// ArchiveDigest returns the digest of the charm archive made with
+// the strongest algorithm the store provided, or the zero Digest if
+// the store provided none.
+func (info *InfoResponse) ArchiveDigest() Digest {
+	switch {
+	case info.Sha384 != "":
+		return Digest{Algorithm: SHA384, Hex: info.Sha384}
+	case info.Sha256 != "":
+		return Digest{Algorithm: SHA256, Hex: info.Sha256}
+	}
+	return Digest{}
+}
+
 // EventResponse is sent by the charm store in response to charm-event requests.
 type EventResponse struct {
 	Kind     string   `json:"kind"`
@@ -83,12 +99,19 @@ func (e *NotFoundError) Error() string {
 	return e.msg
 }
 
+// NewNotFoundError returns a *NotFoundError with the given message,
+// for the use of Repository implementations outside this package.
+func NewNotFoundError(msg string) *NotFoundError {
+	return &NotFoundError{msg}
+}
+
 // CharmStore is a Repository that provides access to the public juju charm store.
 type CharmStore struct {
 	BaseURL   string
 	authAttrs string // a list of attr=value pairs, comma separated
 	jujuAttrs string // a list of attr=value pairs, comma separated
 	testMode  bool
+	ctx       context.Context
 }
 
 var _ Repository = (*CharmStore)(nil)
@@ -125,6 +148,11 @@ func (s *CharmStore) get(url string) (resp *http.Response, err error) {
 	if err != nil {
 		return nil, err
 	}
+	return s.do(req)
+}
+
+// do sends the given request, adding custom headers if necessary.
+func (s *CharmStore) do(req *http.Request) (*http.Response, error) {
 	if s.authAttrs != "" {
 		// To comply with RFC 2617, we send the authentication data in
 		// the Authorization header with a custom auth scheme
@@ -135,7 +163,7 @@ func (s *CharmStore) get(url string) (resp *http.Response, err error) {
 		// The use of "X-" to prefix custom header values is deprecated.
 		req.Header.Add("Juju-Metadata", s.jujuAttrs)
 	}
-	return http.DefaultClient.Do(req)
+	return ctxhttp.Do(s.context(), http.DefaultClient, req)
 }
 
 // Resolve canonicalizes charm URLs any implied series in the reference.
@@ -247,12 +275,18 @@ func (s *CharmStore) Event(curl *URL, digest string) (*EventResponse, error) {
 }
 
 // revisions returns the revisions of the charms referenced by curls.
-func (s *CharmStore) revisions(curls ...Location) (revisions []CharmRevision, err error) {
+func (s *CharmStore) revisions(curls ...Location) ([]CharmRevision, error) {
 	infos, err := s.Info(curls...)
 	if err != nil {
 		return nil, err
 	}
-	revisions = make([]CharmRevision, len(infos))
+	return infoRevisions(curls, infos), nil
+}
+
+// infoRevisions returns the revisions held in the given
+// charm-info responses for the charms referenced by curls.
+func infoRevisions(curls []Location, infos []*InfoResponse) []CharmRevision {
+	revisions := make([]CharmRevision, len(infos))
 	for i, info := range infos {
 		for _, w := range info.Warnings {
 			logger.Warningf("charm store reports for %q: %s", curls[i], w)
@@ -263,13 +297,13 @@ func (s *CharmStore) revisions(curls ...Location) (revisions []CharmRevision, er
 		} else {
 			// If a charm is not found, we are more concise with the error message.
 			if len(info.Errors) == 1 && strings.HasPrefix(info.Errors[0], "charm not found") {
-				revisions[i].Err = fmt.Errorf(info.Errors[0])
+				revisions[i].Err = &NotFoundError{info.Errors[0]}
 			} else {
 				revisions[i].Err = fmt.Errorf("charm info errors for %q: %s", curls[i], strings.Join(info.Errors, "; "))
 			}
 		}
 	}
-	return revisions, nil
+	return revisions
 }
 
 // Latest returns the latest revision of the charms referenced by curls, regardless
@@ -335,15 +369,15 @@ func (s *CharmStore) CharmURL(location string) (*URL, error) {
 	return nil, fmt.Errorf("unknown branch location: %q", location)
 }
 
-// verify returns an error unless a file exists at path with a hex-encoded
-// SHA256 matching digest.
-func verify(path, digest string) error {
-	hash, _, err := utils.ReadFileSHA256(path)
+// verify returns an error unless a file exists at path with the given digest.
+func verify(path string, d Digest) error {
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	if hash != digest {
-		return fmt.Errorf("bad SHA256 of %q", path)
+	defer f.Close()
+	if err := d.Verify(f); err != nil {
+		return fmt.Errorf("bad %s of %q", strings.ToUpper(string(d.Algorithm)), path)
 	}
 	return nil
 }
@@ -358,17 +392,19 @@ func (s *CharmStore) Get(curl *URL) (Charm, error) {
 	if err := os.MkdirAll(CacheDir, os.FileMode(0755)); err != nil {
 		return nil, err
 	}
-	revInfo, err := s.revisions(curl)
+	infos, err := s.Info(curl)
 	if err != nil {
 		return nil, err
 	}
+	revInfo := infoRevisions([]Location{curl}, infos)
 	if len(revInfo) != 1 {
 		return nil, fmt.Errorf("expected 1 result, got %d", len(revInfo))
 	}
 	if revInfo[0].Err != nil {
 		return nil, revInfo[0].Err
 	}
-	rev, digest := revInfo[0].Revision, revInfo[0].Sha256
+	rev := revInfo[0].Revision
+	digest := infos[0].ArchiveDigest()
 	if curl.Revision == -1 {
 		curl = curl.WithRevision(rev)
 	} else if curl.Revision != rev {
@@ -376,11 +412,8 @@ func (s *CharmStore) Get(curl *URL) (Charm, error) {
 	}
 	path := filepath.Join(CacheDir, Quote(curl.String())+".charm")
 	if verify(path, digest) != nil {
-		store_url := s.BaseURL + "/charm/" + url.QueryEscape(curl.Path())
-		if s.testMode {
-			store_url = store_url + "?stats=0"
-		}
-		resp, err := s.get(store_url)
+		logEvent("cache", EventCacheMiss, path, "url", curl.String())
+		resp, err := s.get(s.archiveURL(curl))
 		if err != nil {
 			return nil, err
 		}
@@ -401,6 +434,8 @@ func (s *CharmStore) Get(curl *URL) (Charm, error) {
 		if err := utils.ReplaceFile(dlPath, path); err != nil {
 			return nil, err
 		}
+	} else {
+		logEvent("cache", EventCacheHit, path, "url", curl.String())
 	}
 	if err := verify(path, digest); err != nil {
 		return nil, err
@@ -408,6 +443,16 @@ func (s *CharmStore) Get(curl *URL) (Charm, error) {
 	return ReadCharmArchive(path)
 }
 
+// archiveURL returns the URL from which the archive of
+// the given charm can be downloaded.
+func (s *CharmStore) archiveURL(curl *URL) string {
+	store_url := s.BaseURL + "/charm/" + url.QueryEscape(curl.Path())
+	if s.testMode {
+		store_url = store_url + "?stats=0"
+	}
+	return store_url
+}
+
 // LocalRepository represents a local directory containing subdirectories
 // named after an Ubuntu series, each of which contains charms targeted for
 // that series. For example:
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 
 	gitjujutesting "github.com/juju/testing"
+	"golang.org/x/net/context"
 	gc "gopkg.in/check.v1"
 
 	"gopkg.in/juju/charm.v4"
@@ -127,6 +128,36 @@ func (s *StoreSuite) TestGetCacheExplicitRevision(c *gc.C) {
 	s.assertCached(c, charmURL)
 }
 
+func (s *StoreSuite) TestGetLogsCacheEvents(c *gc.C) {
+	logger := &recordingLogger{}
+	charm.SetLogger(logger)
+	defer charm.SetLogger(nil)
+	charmURL := charm.MustParseURL("cs:series/good-23")
+	for i := 0; i < 2; i++ {
+		_, err := s.store.Get(charmURL)
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(logger.events, gc.HasLen, 2)
+	c.Assert(logger.events[0].Kind, gc.Equals, charm.EventCacheMiss)
+	c.Assert(logger.events[1].Kind, gc.Equals, charm.EventCacheHit)
+	c.Assert(logger.events[1].Op, gc.Equals, "cache")
+	c.Assert(logger.events[1].Fields, gc.DeepEquals, map[string]interface{}{"url": "cs:series/good-23"})
+}
+
+func (s *StoreSuite) TestGetWithContext(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := s.store.WithContext(ctx)
+	ch, err := store.Get(charm.MustParseURL("cs:series/good"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch, gc.NotNil)
+
+	cancel()
+	_, err = store.Get(charm.MustParseURL("cs:series/good"))
+	c.Assert(err, gc.ErrorMatches, ".*context canceled")
+	_, err = s.store.Get(charm.MustParseURL("cs:series/good"))
+	c.Assert(err, gc.IsNil)
+}
+
 func (s *StoreSuite) TestGetBadCache(c *gc.C) {
 	c.Assert(os.Mkdir(filepath.Join(charm.CacheDir, "cache"), 0777), gc.IsNil)
 	base := "cs:series/good"
@@ -143,6 +174,24 @@ func (s *StoreSuite) TestGetBadCache(c *gc.C) {
 	s.assertCached(c, revCharmURL)
 }
 
+func (s *StoreSuite) TestGetBadCacheSha384(c *gc.C) {
+	s.server.ServeSha384 = true
+	c.Assert(os.Mkdir(filepath.Join(charm.CacheDir, "cache"), 0777), gc.IsNil)
+	charmURL := charm.MustParseURL("cs:series/good-23")
+	name := charm.Quote(charmURL.String()) + ".charm"
+	err := ioutil.WriteFile(filepath.Join(charm.CacheDir, "cache", name), nil, 0666)
+	c.Assert(err, gc.IsNil)
+	ch, err := s.store.Get(charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ch, gc.NotNil)
+	c.Assert(s.server.Downloads, gc.DeepEquals, []*charm.URL{charmURL})
+	s.assertCached(c, charmURL)
+
+	infos, err := s.store.Info(charmURL)
+	c.Assert(err, gc.IsNil)
+	c.Assert(infos[0].ArchiveDigest().Algorithm, gc.Equals, charm.SHA384)
+}
+
 func (s *StoreSuite) TestGetTestModeFlag(c *gc.C) {
 	base := "cs:series/good-12"
 	charmURL := charm.MustParseURL(base)
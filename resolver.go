@@ -0,0 +1,135 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Resolver is implemented by types that resolve charm
+// references to URLs with a series and revision.
+type Resolver interface {
+	Resolve(ref *Reference) (*URL, error)
+}
+
+// MultiResolver is a Resolver that resolves references against
+// a list of repositories in priority order, caching the results.
+// It is safe to use concurrently.
+type MultiResolver struct {
+	repos []Repository
+
+	mu    sync.Mutex
+	cache map[string]*URL
+}
+
+var _ Resolver = (*MultiResolver)(nil)
+
+// NewMultiResolver returns a resolver that resolves references
+// against each of the given repositories in turn, typically a
+// local repository followed by the charm store.
+func NewMultiResolver(repos ...Repository) *MultiResolver {
+	return &MultiResolver{
+		repos: repos,
+		cache: make(map[string]*URL),
+	}
+}
+
+// ParsePartialReference is like ParseReference except that a
+// missing schema is left empty rather than assumed to be "cs", so
+// that MultiResolver.Resolve may find the charm in any repository.
+func ParsePartialReference(url string) (*Reference, error) {
+	return parseReference(url)
+}
+
+// Resolve returns the URL of the charm referenced by ref in the first
+// of the resolver's repositories that holds it. The series of the URL
+// is resolved by the repository, and its revision is that of the latest
+// revision of the charm unless ref holds a revision. A reference that
+// holds a revision is resolved without asking the repository for the
+// latest revision, so it is resolved by the first repository able to
+// resolve its series, whether or not that repository holds the charm.
+//
+// A reference with an empty schema, as returned by ParsePartialReference,
+// is resolved against every repository, taking the repository's schema;
+// otherwise only repositories with the reference's schema are consulted.
+// Local repositories are not consulted for references holding a user.
+func (r *MultiResolver) Resolve(ref *Reference) (*URL, error) {
+	key := ref.String()
+	if ref.Schema == "" {
+		key = ref.Path()
+	}
+	r.mu.Lock()
+	curl, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok {
+		return copyURL(curl), nil
+	}
+	for _, repo := range r.repos {
+		schema := repositorySchema(repo)
+		if ref.Schema != "" && ref.Schema != schema || schema == "local" && ref.User != "" {
+			continue
+		}
+		candidate := *ref
+		candidate.Schema = schema
+		curl, err := resolveIn(repo, &candidate)
+		if isNotFound(err) {
+			logger.Debugf("cannot resolve %q in %T: %v", key, repo, err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %q: %v", key, err)
+		}
+		r.mu.Lock()
+		r.cache[key] = curl
+		r.mu.Unlock()
+		return copyURL(curl), nil
+	}
+	return nil, &NotFoundError{fmt.Sprintf("cannot resolve %q: charm not found", key)}
+}
+
+// Forget removes all cached resolutions, so that
+// later calls to Resolve consult the repositories.
+func (r *MultiResolver) Forget() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = make(map[string]*URL)
+}
+
+// resolveIn resolves ref against the given repository.
+func resolveIn(repo Repository, ref *Reference) (*URL, error) {
+	curl, err := repo.Resolve(ref)
+	if err != nil || curl.Revision >= 0 {
+		return curl, err
+	}
+	rev, err := Latest(repo, curl)
+	if err != nil {
+		return nil, err
+	}
+	return curl.WithRevision(rev), nil
+}
+
+// repositorySchema returns the schema of the
+// URLs of charms in the given repository.
+func repositorySchema(repo Repository) string {
+	if _, ok := repo.(*LocalRepository); ok {
+		return "local"
+	}
+	return "cs"
+}
+
+// isNotFound reports whether err, returned when resolving a
+// reference in a repository, means that the repository does
+// not hold the charm, so that the next should be consulted.
+func isNotFound(err error) bool {
+	if _, ok := err.(*NotFoundError); ok {
+		return true
+	}
+	return err == ErrUnresolvedUrl
+}
+
+func copyURL(curl *URL) *URL {
+	c := *curl
+	return &c
+}
@@ -0,0 +1,170 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"errors"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ResolverSuite struct {
+	local *charm.LocalRepository
+	store *countingRepository
+}
+
+var _ = gc.Suite(&ResolverSuite{})
+
+func (s *ResolverSuite) SetUpTest(c *gc.C) {
+	root := c.MkDir()
+	charmtesting.Charms.ClonedURL(root, "quantal", "dummy")
+	s.local = &charm.LocalRepository{Path: root}
+
+	store := charmtesting.NewMockCharmStore()
+	store.WithDefaultSeries("quantal")
+	for _, name := range []string{"dummy", "wordpress"} {
+		archive := charmtesting.Charms.CharmArchive(c.MkDir(), name)
+		archive.SetRevision(7)
+		err := store.SetCharm(charm.MustParseURL("cs:quantal/"+name+"-7"), archive)
+		c.Assert(err, gc.IsNil)
+	}
+	s.store = &countingRepository{Repository: store}
+}
+
+func (s *ResolverSuite) resolver() *charm.MultiResolver {
+	return charm.NewMultiResolver(s.local.WithDefaultSeries("quantal"), s.store)
+}
+
+var resolveTests = []struct {
+	ref    string
+	expect string
+	err    string
+}{{
+	ref:    "dummy",
+	expect: "local:quantal/dummy-1",
+}, {
+	ref:    "wordpress",
+	expect: "cs:quantal/wordpress-7",
+}, {
+	ref:    "quantal/dummy-3",
+	expect: "local:quantal/dummy-3",
+}, {
+	ref:    "cs:dummy",
+	expect: "cs:quantal/dummy-7",
+}, {
+	ref:    "local:dummy",
+	expect: "local:quantal/dummy-1",
+}, {
+	ref: "local:wordpress",
+	err: `cannot resolve "local:wordpress": charm not found`,
+}, {
+	ref: "~bob/dummy",
+	err: `cannot resolve "~bob/dummy": charm not found`,
+}, {
+	ref: "mysql",
+	err: `cannot resolve "mysql": charm not found`,
+}}
+
+func (s *ResolverSuite) TestResolve(c *gc.C) {
+	for i, test := range resolveTests {
+		c.Logf("test %d: %s", i, test.ref)
+		ref, err := charm.ParsePartialReference(test.ref)
+		c.Assert(err, gc.IsNil)
+		curl, err := s.resolver().Resolve(ref)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			c.Assert(err, gc.FitsTypeOf, &charm.NotFoundError{})
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(curl.String(), gc.Equals, test.expect)
+	}
+}
+
+func (s *ResolverSuite) TestResolveCaches(c *gc.C) {
+	r := s.resolver()
+	ref, err := charm.ParsePartialReference("wordpress")
+	c.Assert(err, gc.IsNil)
+	curl, err := r.Resolve(ref)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.store.calls, gc.Equals, 2)
+
+	// The cached URL is not changed by changes to the result.
+	curl.Revision = 99
+	curl, err = r.Resolve(ref)
+	c.Assert(err, gc.IsNil)
+	c.Assert(curl.String(), gc.Equals, "cs:quantal/wordpress-7")
+	c.Assert(s.store.calls, gc.Equals, 2)
+
+	r.Forget()
+	_, err = r.Resolve(ref)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.store.calls, gc.Equals, 4)
+}
+
+func (s *ResolverSuite) TestResolveError(c *gc.C) {
+	s.store.err = errors.New("store is down")
+	ref, err := charm.ParsePartialReference("wordpress")
+	c.Assert(err, gc.IsNil)
+	_, err = s.resolver().Resolve(ref)
+	c.Assert(err, gc.ErrorMatches, `cannot resolve "wordpress": store is down`)
+
+	// A charm found before the failing repository is resolved.
+	ref, err = charm.ParsePartialReference("dummy")
+	c.Assert(err, gc.IsNil)
+	curl, err := s.resolver().Resolve(ref)
+	c.Assert(err, gc.IsNil)
+	c.Assert(curl.String(), gc.Equals, "local:quantal/dummy-1")
+}
+
+func (s *ResolverSuite) TestResolveRevision(c *gc.C) {
+	// A reference holding a revision is resolved without
+	// asking the repository for the latest revision.
+	ref, err := charm.ParsePartialReference("cs:wordpress-3")
+	c.Assert(err, gc.IsNil)
+	curl, err := s.resolver().Resolve(ref)
+	c.Assert(err, gc.IsNil)
+	c.Assert(curl.String(), gc.Equals, "cs:quantal/wordpress-3")
+	c.Assert(s.store.calls, gc.Equals, 1)
+}
+
+func (s *ResolverSuite) TestResolveErrorMentioningNotFound(c *gc.C) {
+	// Only a *charm.NotFoundError makes the resolver
+	// move on to the next repository.
+	s.store.err = errors.New("charm not found, or so it seems")
+	ref, err := charm.ParsePartialReference("wordpress")
+	c.Assert(err, gc.IsNil)
+	_, err = s.resolver().Resolve(ref)
+	c.Assert(err, gc.ErrorMatches, `cannot resolve "wordpress": charm not found, or so it seems`)
+	_, ok := err.(*charm.NotFoundError)
+	c.Assert(ok, gc.Equals, false)
+}
+
+// countingRepository is a Repository that counts the calls made
+// to its Resolve and Latest methods, and returns err from them
+// if it is not nil.
+type countingRepository struct {
+	charm.Repository
+	calls int
+	err   error
+}
+
+func (r *countingRepository) Resolve(ref *charm.Reference) (*charm.URL, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.Repository.Resolve(ref)
+}
+
+func (r *countingRepository) Latest(curls ...*charm.URL) ([]charm.CharmRevision, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.Repository.Latest(curls...)
+}
@@ -0,0 +1,155 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// revisionHistoryFile holds the name of the file in a charm
+// that records its revision history.
+const revisionHistoryFile = "revisions.yaml"
+
+// RevisionEntry records a revision of a charm.
+type RevisionEntry struct {
+	// Revision holds the charm revision.
+	Revision int
+
+	// Version holds a free-form description of the version
+	// of the charm at this revision, such as a release name
+	// or a version control revision, if known.
+	Version string
+
+	// Date holds the time the revision was made.
+	Date time.Time
+}
+
+// revisionHistoryDoc holds a revision history as
+// written in a revisions.yaml file.
+type revisionHistoryDoc struct {
+	Revisions []revisionEntryDoc `yaml:"revisions"`
+}
+
+type revisionEntryDoc struct {
+	Revision int    `yaml:"revision"`
+	Version  string `yaml:"version,omitempty"`
+	Date     string `yaml:"date"`
+}
+
+// RevisionHistory returns the revision history recorded in the
+// revisions.yaml file in the charm directory, oldest first. It
+// returns no entries if the charm has no revision history.
+func (dir *CharmDir) RevisionHistory() ([]RevisionEntry, error) {
+	f, err := os.Open(dir.join(revisionHistoryFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readRevisionHistory(f)
+}
+
+// RevisionHistory returns the revision history recorded in the
+// charm archive, as CharmDir.RevisionHistory does for charm
+// directories.
+func (a *CharmArchive) RevisionHistory() ([]RevisionEntry, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	r, err := zipOpenFile(zipr, revisionHistoryFile)
+	if _, ok := err.(*noCharmArchiveFile); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readRevisionHistory(r)
+}
+
+// BumpRevision increments the revision of the charm directory,
+// updating its revision file, and records the new revision in its
+// revision history along with the given version, which may be empty,
+// and the current time. If the given version and that of the latest
+// revision in the history are both semantic versions, as accepted by
+// ParseSemVer, the given version must not be older, so that versions
+// follow the order of revisions.
+func (dir *CharmDir) BumpRevision(version string) error {
+	if dir.readOnly {
+		return ErrReadOnly
+	}
+	history, err := dir.RevisionHistory()
+	if err != nil {
+		return fmt.Errorf("cannot bump revision: %v", err)
+	}
+	if len(history) > 0 {
+		last := history[len(history)-1]
+		v, err1 := ParseSemVer(version)
+		lastv, err2 := ParseSemVer(last.Version)
+		if err1 == nil && err2 == nil && v.Compare(lastv) < 0 {
+			return fmt.Errorf("cannot bump revision: version %s is older than version %s of revision %d", v, lastv, last.Revision)
+		}
+	}
+	revision := dir.revision + 1
+	history = append(history, RevisionEntry{
+		Revision: revision,
+		Version:  version,
+		Date:     time.Now().UTC(),
+	})
+	data, err := encodeRevisionHistory(history)
+	if err != nil {
+		return fmt.Errorf("cannot bump revision: %v", err)
+	}
+	if err := ioutil.WriteFile(dir.join(revisionHistoryFile), data, 0644); err != nil {
+		return fmt.Errorf("cannot bump revision: %v", err)
+	}
+	if err := dir.SetDiskRevision(revision); err != nil {
+		return fmt.Errorf("cannot bump revision: %v", err)
+	}
+	return nil
+}
+
+func readRevisionHistory(r io.Reader) ([]RevisionEntry, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var doc revisionHistoryDoc
+	if err := yamlUnmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid revision history: %v", err)
+	}
+	history := make([]RevisionEntry, len(doc.Revisions))
+	for i, entry := range doc.Revisions {
+		date, err := time.Parse(time.RFC3339, entry.Date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid revision history: revision %d has invalid date %q", entry.Revision, entry.Date)
+		}
+		history[i] = RevisionEntry{
+			Revision: entry.Revision,
+			Version:  entry.Version,
+			Date:     date,
+		}
+	}
+	return history, nil
+}
+
+func encodeRevisionHistory(history []RevisionEntry) ([]byte, error) {
+	var doc revisionHistoryDoc
+	for _, entry := range history {
+		doc.Revisions = append(doc.Revisions, revisionEntryDoc{
+			Revision: entry.Revision,
+			Version:  entry.Version,
+			Date:     entry.Date.Format(time.RFC3339),
+		})
+	}
+	return yamlMarshal(doc)
+}
@@ -0,0 +1,124 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type RevisionsSuite struct{}
+
+var _ = gc.Suite(&RevisionsSuite{})
+
+func (s *RevisionsSuite) TestNoHistory(c *gc.C) {
+	dir := charmtesting.Charms.CharmDir("dummy")
+	history, err := dir.RevisionHistory()
+	c.Assert(err, gc.IsNil)
+	c.Assert(history, gc.HasLen, 0)
+
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	history, err = archive.RevisionHistory()
+	c.Assert(err, gc.IsNil)
+	c.Assert(history, gc.HasLen, 0)
+}
+
+func (s *RevisionsSuite) TestBumpRevision(c *gc.C) {
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Revision(), gc.Equals, 1)
+
+	before := time.Now().Add(-time.Second)
+	err = dir.BumpRevision("1.1")
+	c.Assert(err, gc.IsNil)
+	err = dir.BumpRevision("")
+	c.Assert(err, gc.IsNil)
+	after := time.Now().Add(time.Second)
+	c.Assert(dir.Revision(), gc.Equals, 3)
+
+	dir, err = charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Revision(), gc.Equals, 3)
+	history, err := dir.RevisionHistory()
+	c.Assert(err, gc.IsNil)
+	c.Assert(history, gc.HasLen, 2)
+	c.Assert(history[0].Revision, gc.Equals, 2)
+	c.Assert(history[0].Version, gc.Equals, "1.1")
+	c.Assert(history[1].Revision, gc.Equals, 3)
+	c.Assert(history[1].Version, gc.Equals, "")
+	for _, entry := range history {
+		c.Assert(entry.Date.After(before), jc.IsTrue)
+		c.Assert(entry.Date.Before(after), jc.IsTrue)
+	}
+
+	// The history is archived with the charm.
+	archive := archiveDir(c, path)
+	archived, err := archive.RevisionHistory()
+	c.Assert(err, gc.IsNil)
+	c.Assert(archived, jc.DeepEquals, history)
+}
+
+func (s *RevisionsSuite) TestBumpRevisionVersionOrder(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	err := dir.BumpRevision("2.0.0-rc1")
+	c.Assert(err, gc.IsNil)
+	err = dir.BumpRevision("1.9.0")
+	c.Assert(err, gc.ErrorMatches, "cannot bump revision: version 1.9.0 is older than version 2.0.0-rc1 of revision 2")
+	c.Assert(dir.Revision(), gc.Equals, 2)
+	err = dir.BumpRevision("2.0.0")
+	c.Assert(err, gc.IsNil)
+	// Versions that are not semantic versions are not ordered.
+	err = dir.BumpRevision("release-1")
+	c.Assert(err, gc.IsNil)
+	err = dir.BumpRevision("1.0.0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir.Revision(), gc.Equals, 5)
+}
+
+func (s *RevisionsSuite) TestReadHistory(c *gc.C) {
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(path, "revisions.yaml"), []byte(`
+revisions:
+  - revision: 1
+    version: "0.1"
+    date: "2014-10-01T09:00:00Z"
+  - revision: 5
+    date: "2014-11-05T12:30:00+01:00"
+`), 0644)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	history, err := dir.RevisionHistory()
+	c.Assert(err, gc.IsNil)
+	c.Assert(history, gc.HasLen, 2)
+	c.Assert(history[0].Revision, gc.Equals, 1)
+	c.Assert(history[0].Version, gc.Equals, "0.1")
+	c.Assert(history[0].Date.Equal(time.Date(2014, 10, 1, 9, 0, 0, 0, time.UTC)), jc.IsTrue)
+	c.Assert(history[1].Revision, gc.Equals, 5)
+	c.Assert(history[1].Date.Equal(time.Date(2014, 11, 5, 11, 30, 0, 0, time.UTC)), jc.IsTrue)
+}
+
+func (s *RevisionsSuite) TestReadHistoryInvalidDate(c *gc.C) {
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	err := ioutil.WriteFile(filepath.Join(path, "revisions.yaml"), []byte(`
+revisions:
+  - revision: 1
+    date: yesterday
+`), 0644)
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	_, err = dir.RevisionHistory()
+	c.Assert(err, gc.ErrorMatches, `invalid revision history: revision 1 has invalid date "yesterday"`)
+	err = dir.BumpRevision("")
+	c.Assert(err, gc.ErrorMatches, `cannot bump revision: invalid revision history: .*`)
+}
@@ -0,0 +1,142 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+)
+
+// Runtime identifies the language or framework a charm is written in.
+type Runtime string
+
+const (
+	RuntimeUnknown  Runtime = "unknown"
+	RuntimeBash     Runtime = "bash"
+	RuntimePython   Runtime = "python"
+	RuntimeReactive Runtime = "reactive"
+	RuntimeOperator Runtime = "operator"
+)
+
+// DetectRuntime guesses the runtime of the given charm, which must
+// be a *CharmDir or a *CharmArchive, from the files it holds. A charm
+// with a dispatch script, or whose requirements.txt file requires the
+// ops package, uses the operator framework. Failing that, a charm with
+// a layer.yaml file or a reactive directory, or that requires the
+// charms.reactive package, is a reactive charm. Otherwise, a charm
+// whose hooks are mostly Python scripts, or that holds a
+// requirements.txt file, is a Python charm, and one whose hooks are
+// mostly shell scripts is a bash charm. RuntimeUnknown is returned if
+// none of these applies.
+func DetectRuntime(ch Charm) (Runtime, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return "", err
+	}
+	defer zipr.Close()
+	var (
+		requirements []string
+		reactive     bool
+		dispatch     bool
+		python       int
+		shell        int
+	)
+	for _, fh := range zipr.File {
+		switch {
+		case fh.Name == DispatchFile:
+			dispatch = true
+		case fh.Name == "layer.yaml", strings.HasPrefix(fh.Name, "reactive/"):
+			reactive = true
+		case fh.Name == "requirements.txt":
+			data, err := readZipFile(fh)
+			if err != nil {
+				return "", err
+			}
+			requirements = requirementNames(data)
+		case path.Dir(fh.Name) == HooksDir && !strings.HasSuffix(fh.Name, "/"):
+			switch interpreter, err := hookInterpreter(fh); {
+			case err != nil:
+				return "", err
+			case strings.HasPrefix(interpreter, "python"):
+				python++
+			case interpreter == "sh" || interpreter == "bash" || interpreter == "dash":
+				shell++
+			}
+		}
+	}
+	for _, name := range requirements {
+		switch name {
+		case "ops":
+			dispatch = true
+		case "charms.reactive":
+			reactive = true
+		}
+	}
+	switch {
+	case dispatch:
+		return RuntimeOperator, nil
+	case reactive:
+		return RuntimeReactive, nil
+	case python > shell:
+		return RuntimePython, nil
+	case shell > 0:
+		return RuntimeBash, nil
+	case requirements != nil:
+		return RuntimePython, nil
+	}
+	return RuntimeUnknown, nil
+}
+
+// hookInterpreter returns the base name of the interpreter named in
+// the given hook's shebang line, or the empty string if it has none.
+// Interpreters run through env are recognized.
+func hookInterpreter(fh *zip.File) (string, error) {
+	r, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	line, _ := bufio.NewReader(r).ReadString('\n')
+	return shebangInterpreter(line), nil
+}
+
+// shebangInterpreter returns the base name of the interpreter named
+// in the given shebang line, or the empty string if it is not one.
+func shebangInterpreter(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[len("#!"):])
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" && len(fields) > 1 {
+		interpreter = path.Base(fields[1])
+	}
+	return interpreter
+}
+
+// requirementNames returns the lower-cased names of the packages
+// listed in a pip requirements file.
+func requirementNames(data []byte) []string {
+	names := []string{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		s := strings.TrimSpace(string(line))
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = strings.TrimSpace(s[:i])
+		}
+		if s == "" || strings.HasPrefix(s, "-") {
+			continue
+		}
+		if i := strings.IndexAny(s, "<>=!~;[ "); i >= 0 {
+			s = s[:i]
+		}
+		names = append(names, strings.ToLower(s))
+	}
+	return names
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type RuntimeSuite struct{}
+
+var _ = gc.Suite(&RuntimeSuite{})
+
+var detectRuntimeTests = []struct {
+	about  string
+	files  map[string]string
+	remove []string
+	expect charm.Runtime
+}{{
+	about:  "bash hooks",
+	expect: charm.RuntimeBash,
+}, {
+	about: "python hooks",
+	files: map[string]string{
+		"hooks/install":        "#!/usr/bin/env python3\nprint('hello')\n",
+		"hooks/config-changed": "#!/usr/bin/python\n",
+		"hooks/start":          "#!/bin/sh\n",
+	},
+	expect: charm.RuntimePython,
+}, {
+	about: "requirements without hooks",
+	files: map[string]string{
+		"requirements.txt": "PyYAML==3.11\n",
+	},
+	remove: []string{"hooks/install"},
+	expect: charm.RuntimePython,
+}, {
+	about: "layer.yaml",
+	files: map[string]string{
+		"layer.yaml": "includes: ['layer:basic']\n",
+	},
+	expect: charm.RuntimeReactive,
+}, {
+	about: "reactive directory",
+	files: map[string]string{
+		"reactive/dummy.py": "from charms.reactive import when\n",
+	},
+	expect: charm.RuntimeReactive,
+}, {
+	about: "charms.reactive requirement",
+	files: map[string]string{
+		"requirements.txt": "# Reactive framework\ncharms.reactive>=0.4 # needed\n",
+	},
+	expect: charm.RuntimeReactive,
+}, {
+	about: "dispatch",
+	files: map[string]string{
+		"dispatch":     "#!/bin/sh\nJUJU_DISPATCH_PATH=\"${JUJU_DISPATCH_PATH:-$0}\" PYTHONPATH=lib:venv ./src/charm.py\n",
+		"src/charm.py": "#!/usr/bin/env python3\n",
+	},
+	expect: charm.RuntimeOperator,
+}, {
+	about: "ops requirement",
+	files: map[string]string{
+		"requirements.txt": "-r base.txt\nOps == 1.2\n",
+	},
+	expect: charm.RuntimeOperator,
+}, {
+	about:  "no hooks",
+	remove: []string{"hooks/install"},
+	expect: charm.RuntimeUnknown,
+}}
+
+func (s *RuntimeSuite) TestDetectRuntime(c *gc.C) {
+	for i, test := range detectRuntimeTests {
+		c.Logf("test %d: %s", i, test.about)
+		path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+		for name, content := range test.files {
+			file := filepath.Join(path, filepath.FromSlash(name))
+			err := os.MkdirAll(filepath.Dir(file), 0755)
+			c.Assert(err, gc.IsNil)
+			err = ioutil.WriteFile(file, []byte(content), 0755)
+			c.Assert(err, gc.IsNil)
+		}
+		for _, name := range test.remove {
+			err := os.Remove(filepath.Join(path, filepath.FromSlash(name)))
+			c.Assert(err, gc.IsNil)
+		}
+		dir, err := charm.ReadCharmDir(path)
+		c.Assert(err, gc.IsNil)
+		runtime, err := charm.DetectRuntime(dir)
+		c.Assert(err, gc.IsNil)
+		c.Check(runtime, gc.Equals, test.expect)
+
+		runtime, err = charm.DetectRuntime(archiveDir(c, path))
+		c.Assert(err, gc.IsNil)
+		c.Check(runtime, gc.Equals, test.expect)
+	}
+}
@@ -0,0 +1,486 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ComponentType identifies the kind of a software component
+// found in a charm.
+type ComponentType string
+
+const (
+	// ComponentPython identifies a Python package, shipped as
+	// a wheel or source distribution or installed in the charm.
+	ComponentPython ComponentType = "python"
+
+	// ComponentDeb identifies a Debian package.
+	ComponentDeb ComponentType = "deb"
+
+	// ComponentJar identifies a Java archive.
+	ComponentJar ComponentType = "jar"
+
+	// ComponentVendored identifies source code copied into
+	// the charm from another project.
+	ComponentVendored ComponentType = "vendored"
+)
+
+// SBOM holds a software bill of materials for a charm: an
+// inventory of the third party software components it holds.
+type SBOM struct {
+	// CharmName and CharmRevision identify the charm.
+	CharmName     string
+	CharmRevision int
+
+	// Created holds the time the inventory was made.
+	Created time.Time
+
+	// Components holds the components found in the charm,
+	// sorted by path.
+	Components []SBOMComponent
+}
+
+// SBOMComponent describes a software component found in a charm.
+type SBOMComponent struct {
+	Type ComponentType
+	Name string
+
+	// Version holds the version of the component, or
+	// the empty string if it could not be determined.
+	Version string
+
+	// Path holds the slash-separated path of the file or
+	// directory holding the component within the charm.
+	Path string
+
+	// SHA256 holds the hex-encoded SHA256 digest of the file
+	// holding the component. It is empty for components held
+	// in directories.
+	SHA256 string
+}
+
+// vendorDirs holds the names of directories whose
+// subdirectories conventionally hold vendored source.
+var vendorDirs = map[string]bool{
+	"vendor":      true,
+	"vendored":    true,
+	"_vendor":     true,
+	"third_party": true,
+}
+
+// GenerateSBOM returns an inventory of the software components in
+// the given charm, which must be a *CharmDir or a *CharmArchive.
+// Components are found by their file names and, where those are
+// not enough, their metadata:
+//
+// - Python wheels (*.whl), source distributions in a wheelhouse
+// directory, and installed packages (*.dist-info and *.egg-info
+// directories).
+//
+// - Debian packages (*.deb).
+//
+// - Java archives (*.jar), whose version is read from the archive's
+// manifest if it is not in the file name.
+//
+// - Directories within vendor, vendored, _vendor or third_party
+// directories, whose version is read from a VERSION file within
+// them, if any.
+func GenerateSBOM(ch Charm) (*SBOM, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate SBOM: %v", err)
+	}
+	defer zipr.Close()
+	sbom := &SBOM{
+		CharmName:     ch.Meta().Name,
+		CharmRevision: ch.Revision(),
+		Created:       time.Now().UTC(),
+	}
+	seen := make(map[string]bool)
+	for _, fh := range zipr.File {
+		comp, ok, err := fileComponent(fh)
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate SBOM: %v", err)
+		}
+		if !ok {
+			comp, ok, err = dirComponent(zipr.Reader, fh.Name)
+			if err != nil {
+				return nil, fmt.Errorf("cannot generate SBOM: %v", err)
+			}
+		}
+		if ok && !seen[comp.Path] {
+			seen[comp.Path] = true
+			sbom.Components = append(sbom.Components, comp)
+		}
+	}
+	sort.Sort(componentsByPath(sbom.Components))
+	return sbom, nil
+}
+
+// fileComponent returns the component held in the given
+// file, if any.
+func fileComponent(fh *zip.File) (SBOMComponent, bool, error) {
+	if strings.HasSuffix(fh.Name, "/") {
+		return SBOMComponent{}, false, nil
+	}
+	base := path.Base(fh.Name)
+	var comp SBOMComponent
+	switch {
+	case strings.HasSuffix(base, ".whl"):
+		// name-version(-build)?-python-abi-platform.whl
+		parts := strings.Split(strings.TrimSuffix(base, ".whl"), "-")
+		if len(parts) < 5 {
+			return SBOMComponent{}, false, nil
+		}
+		comp = SBOMComponent{Type: ComponentPython, Name: parts[0], Version: parts[1]}
+	case isSourceDist(fh.Name):
+		name, version := splitNameVersion(trimArchiveSuffix(base))
+		comp = SBOMComponent{Type: ComponentPython, Name: name, Version: version}
+	case strings.HasSuffix(base, ".deb"):
+		// name_version_architecture.deb
+		parts := strings.Split(strings.TrimSuffix(base, ".deb"), "_")
+		comp = SBOMComponent{Type: ComponentDeb, Name: parts[0]}
+		if len(parts) > 1 {
+			comp.Version = parts[1]
+		}
+	case strings.HasSuffix(base, ".jar"):
+		name, version := splitNameVersion(strings.TrimSuffix(base, ".jar"))
+		comp = SBOMComponent{Type: ComponentJar, Name: name, Version: version}
+	default:
+		return SBOMComponent{}, false, nil
+	}
+	data, err := readZipFile(fh)
+	if err != nil {
+		return SBOMComponent{}, false, err
+	}
+	sum := sha256.Sum256(data)
+	comp.SHA256 = hex.EncodeToString(sum[:])
+	comp.Path = fh.Name
+	if comp.Type == ComponentJar && comp.Version == "" {
+		comp.Version = jarVersion(data)
+	}
+	return comp, true, nil
+}
+
+// dirComponent returns the component held in the directory
+// containing the file with the given path, if any.
+func dirComponent(zipr *zip.Reader, name string) (SBOMComponent, bool, error) {
+	parts := strings.Split(strings.TrimSuffix(name, "/"), "/")
+	for i, part := range parts[:len(parts)-1] {
+		dir := strings.Join(parts[:i+1], "/")
+		switch {
+		case strings.HasSuffix(part, ".dist-info"), strings.HasSuffix(part, ".egg-info"):
+			pkgName, version := splitNameVersion(strings.TrimSuffix(strings.TrimSuffix(part, ".dist-info"), ".egg-info"))
+			return SBOMComponent{
+				Type:    ComponentPython,
+				Name:    pkgName,
+				Version: version,
+				Path:    dir,
+			}, true, nil
+		case vendorDirs[part] && i+1 < len(parts)-1:
+			dir = dir + "/" + parts[i+1]
+			version, err := vendoredVersion(zipr, dir)
+			if err != nil {
+				return SBOMComponent{}, false, err
+			}
+			return SBOMComponent{
+				Type:    ComponentVendored,
+				Name:    parts[i+1],
+				Version: version,
+				Path:    dir,
+			}, true, nil
+		}
+	}
+	return SBOMComponent{}, false, nil
+}
+
+// isSourceDist reports whether the file with the given path is
+// a Python source distribution in a wheelhouse directory.
+func isSourceDist(name string) bool {
+	if path.Base(path.Dir(name)) != "wheelhouse" {
+		return false
+	}
+	return trimArchiveSuffix(path.Base(name)) != path.Base(name)
+}
+
+func trimArchiveSuffix(name string) string {
+	for _, suffix := range []string{".tar.gz", ".tgz", ".tar.bz2", ".zip"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// splitNameVersion splits a name of the form "name-version",
+// where the version starts with a digit, into its parts.
+func splitNameVersion(s string) (name, version string) {
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] == '-' && s[i+1] >= '0' && s[i+1] <= '9' {
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// jarVersion returns the version recorded in the manifest
+// of the given Java archive, if any.
+func jarVersion(data []byte) string {
+	zipr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return ""
+	}
+	for _, fh := range zipr.File {
+		if fh.Name != "META-INF/MANIFEST.MF" {
+			continue
+		}
+		manifest, err := readZipFile(fh)
+		if err != nil {
+			return ""
+		}
+		var version string
+		scanner := bufio.NewScanner(bytes.NewReader(manifest))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case strings.HasPrefix(line, "Implementation-Version:"):
+				return strings.TrimSpace(line[len("Implementation-Version:"):])
+			case strings.HasPrefix(line, "Bundle-Version:"):
+				version = strings.TrimSpace(line[len("Bundle-Version:"):])
+			}
+		}
+		return version
+	}
+	return ""
+}
+
+// vendoredVersion returns the contents of the VERSION file
+// in the given directory, if any.
+func vendoredVersion(zipr *zip.Reader, dir string) (string, error) {
+	for _, fh := range zipr.File {
+		if fh.Name != dir+"/VERSION" {
+			continue
+		}
+		data, err := readZipFile(fh)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", nil
+}
+
+func readZipFile(fh *zip.File) ([]byte, error) {
+	r, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// purl returns the package URL identifying the component.
+func (comp SBOMComponent) purl() string {
+	kind := "generic"
+	switch comp.Type {
+	case ComponentPython:
+		kind = "pypi"
+	case ComponentDeb:
+		kind = "deb"
+	}
+	p := "pkg:" + kind + "/" + url.QueryEscape(comp.Name)
+	if comp.Version != "" {
+		p += "@" + url.QueryEscape(comp.Version)
+	}
+	return p
+}
+
+type cycloneDXDocument struct {
+	BOMFormat   string               `json:"bomFormat"`
+	SpecVersion string               `json:"specVersion"`
+	Version     int                  `json:"version"`
+	Metadata    cycloneDXMetadata    `json:"metadata"`
+	Components  []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Hashes     []cycloneDXHash     `json:"hashes,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// CycloneDX returns the inventory as a CycloneDX 1.4 JSON document.
+func (s *SBOM) CycloneDX() ([]byte, error) {
+	doc := cycloneDXDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.4",
+		Version:     1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: s.Created.UTC().Format(time.RFC3339),
+			Component: cycloneDXComponent{
+				Type:    "application",
+				Name:    s.CharmName,
+				Version: strconv.Itoa(s.CharmRevision),
+			},
+		},
+		Components: []cycloneDXComponent{},
+	}
+	for _, comp := range s.Components {
+		c := cycloneDXComponent{
+			Type:    "library",
+			Name:    comp.Name,
+			Version: comp.Version,
+			PURL:    comp.purl(),
+			Properties: []cycloneDXProperty{
+				{"juju:component-type", string(comp.Type)},
+				{"juju:path", comp.Path},
+			},
+		}
+		if comp.SHA256 != "" {
+			c.Hashes = []cycloneDXHash{{"SHA-256", comp.SHA256}}
+		}
+		doc.Components = append(doc.Components, c)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementId      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// SPDX returns the inventory as an SPDX 2.3 JSON document.
+func (s *SBOM) SPDX() ([]byte, error) {
+	// The document namespace must be unique to the document,
+	// so derive it from the document's content.
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %d %s\n", s.CharmName, s.CharmRevision, s.Created.UTC().Format(time.RFC3339))
+	for _, comp := range s.Components {
+		fmt.Fprintf(h, "%s %s %s %s %s\n", comp.Type, comp.Name, comp.Version, comp.Path, comp.SHA256)
+	}
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              fmt.Sprintf("%s-%d", s.CharmName, s.CharmRevision),
+		DocumentNamespace: fmt.Sprintf("https://juju.ubuntu.com/spdx/%s-%d-%x", url.QueryEscape(s.CharmName), s.CharmRevision, h.Sum(nil)),
+		CreationInfo: spdxCreationInfo{
+			Created:  s.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: gopkg.in/juju/charm"},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:           "SPDXRef-Charm",
+			Name:             s.CharmName,
+			VersionInfo:      strconv.Itoa(s.CharmRevision),
+			DownloadLocation: "NOASSERTION",
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementId:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: "SPDXRef-Charm",
+		}},
+	}
+	for i, comp := range s.Components {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		p := spdxPackage{
+			SPDXID:           id,
+			Name:             comp.Name,
+			VersionInfo:      comp.Version,
+			DownloadLocation: "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  comp.purl(),
+			}},
+			Comment: fmt.Sprintf("%s component found at %s", comp.Type, comp.Path),
+		}
+		if comp.SHA256 != "" {
+			p.Checksums = []spdxChecksum{{"SHA256", comp.SHA256}}
+		}
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementId:      "SPDXRef-Charm",
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+type componentsByPath []SBOMComponent
+
+func (c componentsByPath) Len() int           { return len(c) }
+func (c componentsByPath) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c componentsByPath) Less(i, j int) bool { return c[i].Path < c[j].Path }
@@ -0,0 +1,236 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type SBOMSuite struct{}
+
+var _ = gc.Suite(&SBOMSuite{})
+
+// sbomCharmDir returns a copy of the dummy charm holding
+// a variety of third party components.
+func sbomCharmDir(c *gc.C) *charm.CharmDir {
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	files := map[string][]byte{
+		"wheelhouse/requests-2.4.3-py2.py3-none-any.whl": []byte("wheel"),
+		"wheelhouse/six-1.8.0.tar.gz":                    []byte("sdist"),
+		"wheelhouse/README":                              []byte("not a component"),
+		"debs/libfoo_1.0-1_amd64.deb":                    []byte("deb"),
+		"lib/java/commons-io-2.4.jar":                    []byte("jar"),
+		"lib/java/app.jar":                               jarWithManifest(c, "Implementation-Version: 3.1.4\n"),
+		"lib/PyYAML-3.11.dist-info/METADATA":             []byte("Name: PyYAML\n"),
+		"lib/PyYAML-3.11.dist-info/RECORD":               []byte(""),
+		"third_party/jquery/VERSION":                     []byte("1.11.1\n"),
+		"third_party/jquery/jquery.js":                   []byte("//"),
+		"vendor/shlex/shlex.go":                          []byte("package shlex"),
+	}
+	for name, data := range files {
+		name = filepath.Join(path, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(name), 0755)
+		c.Assert(err, gc.IsNil)
+		err = ioutil.WriteFile(name, data, 0644)
+		c.Assert(err, gc.IsNil)
+	}
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	return dir
+}
+
+func jarWithManifest(c *gc.C, manifest string) []byte {
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	w, err := zipw.Create("META-INF/MANIFEST.MF")
+	c.Assert(err, gc.IsNil)
+	_, err = w.Write([]byte("Manifest-Version: 1.0\n" + manifest))
+	c.Assert(err, gc.IsNil)
+	err = zipw.Close()
+	c.Assert(err, gc.IsNil)
+	return buf.Bytes()
+}
+
+type sbomComponent struct {
+	Type    charm.ComponentType
+	Name    string
+	Version string
+	Path    string
+}
+
+var expectSBOMComponents = []sbomComponent{
+	{charm.ComponentDeb, "libfoo", "1.0-1", "debs/libfoo_1.0-1_amd64.deb"},
+	{charm.ComponentPython, "PyYAML", "3.11", "lib/PyYAML-3.11.dist-info"},
+	{charm.ComponentJar, "app", "3.1.4", "lib/java/app.jar"},
+	{charm.ComponentJar, "commons-io", "2.4", "lib/java/commons-io-2.4.jar"},
+	{charm.ComponentVendored, "jquery", "1.11.1", "third_party/jquery"},
+	{charm.ComponentVendored, "shlex", "", "vendor/shlex"},
+	{charm.ComponentPython, "requests", "2.4.3", "wheelhouse/requests-2.4.3-py2.py3-none-any.whl"},
+	{charm.ComponentPython, "six", "1.8.0", "wheelhouse/six-1.8.0.tar.gz"},
+}
+
+func (s *SBOMSuite) checkSBOM(c *gc.C, sbom *charm.SBOM) {
+	c.Assert(sbom.CharmName, gc.Equals, "dummy")
+	var comps []sbomComponent
+	for _, comp := range sbom.Components {
+		comps = append(comps, sbomComponent{comp.Type, comp.Name, comp.Version, comp.Path})
+		if comp.Type == charm.ComponentPython && filepath.Ext(comp.Path) == ".dist-info" || comp.Type == charm.ComponentVendored {
+			c.Check(comp.SHA256, gc.Equals, "", gc.Commentf("%s", comp.Path))
+		} else {
+			c.Check(comp.SHA256, gc.HasLen, 64, gc.Commentf("%s", comp.Path))
+		}
+	}
+	c.Assert(comps, gc.DeepEquals, expectSBOMComponents)
+}
+
+func (s *SBOMSuite) TestGenerateSBOMCharmDir(c *gc.C) {
+	sbom, err := charm.GenerateSBOM(sbomCharmDir(c))
+	c.Assert(err, gc.IsNil)
+	s.checkSBOM(c, sbom)
+}
+
+func (s *SBOMSuite) TestGenerateSBOMCharmArchive(c *gc.C) {
+	dir := sbomCharmDir(c)
+	path := filepath.Join(c.MkDir(), "dummy.charm")
+	file, err := os.Create(path)
+	c.Assert(err, gc.IsNil)
+	err = dir.ArchiveTo(file)
+	file.Close()
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+
+	sbom, err := charm.GenerateSBOM(archive)
+	c.Assert(err, gc.IsNil)
+	s.checkSBOM(c, sbom)
+}
+
+func (s *SBOMSuite) TestGenerateSBOMNoComponents(c *gc.C) {
+	sbom, err := charm.GenerateSBOM(charmtesting.Charms.CharmDir("dummy"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(sbom.Components, gc.HasLen, 0)
+}
+
+var testSBOM = &charm.SBOM{
+	CharmName:     "dummy",
+	CharmRevision: 5,
+	Created:       time.Date(2014, 11, 5, 12, 0, 0, 0, time.UTC),
+	Components: []charm.SBOMComponent{{
+		Type:    charm.ComponentPython,
+		Name:    "requests",
+		Version: "2.4.3",
+		Path:    "wheelhouse/requests-2.4.3-py2.py3-none-any.whl",
+		SHA256:  "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	}, {
+		Type: charm.ComponentVendored,
+		Name: "shlex",
+		Path: "vendor/shlex",
+	}},
+}
+
+func (s *SBOMSuite) TestCycloneDX(c *gc.C) {
+	data, err := testSBOM.CycloneDX()
+	c.Assert(err, gc.IsNil)
+	var doc map[string]interface{}
+	err = json.Unmarshal(data, &doc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc["bomFormat"], gc.Equals, "CycloneDX")
+	c.Assert(doc["specVersion"], gc.Equals, "1.4")
+	c.Assert(doc["metadata"], gc.DeepEquals, map[string]interface{}{
+		"timestamp": "2014-11-05T12:00:00Z",
+		"component": map[string]interface{}{
+			"type":    "application",
+			"name":    "dummy",
+			"version": "5",
+		},
+	})
+	c.Assert(doc["components"], gc.DeepEquals, []interface{}{
+		map[string]interface{}{
+			"type":    "library",
+			"name":    "requests",
+			"version": "2.4.3",
+			"purl":    "pkg:pypi/requests@2.4.3",
+			"hashes": []interface{}{
+				map[string]interface{}{
+					"alg":     "SHA-256",
+					"content": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+				},
+			},
+			"properties": []interface{}{
+				map[string]interface{}{"name": "juju:component-type", "value": "python"},
+				map[string]interface{}{"name": "juju:path", "value": "wheelhouse/requests-2.4.3-py2.py3-none-any.whl"},
+			},
+		},
+		map[string]interface{}{
+			"type": "library",
+			"name": "shlex",
+			"purl": "pkg:generic/shlex",
+			"properties": []interface{}{
+				map[string]interface{}{"name": "juju:component-type", "value": "vendored"},
+				map[string]interface{}{"name": "juju:path", "value": "vendor/shlex"},
+			},
+		},
+	})
+}
+
+func (s *SBOMSuite) TestSPDX(c *gc.C) {
+	data, err := testSBOM.SPDX()
+	c.Assert(err, gc.IsNil)
+	var doc struct {
+		SPDXVersion       string
+		Name              string
+		DocumentNamespace string
+		CreationInfo      struct {
+			Created string
+		}
+		Packages []struct {
+			SPDXID       string
+			Name         string
+			VersionInfo  string
+			Checksums    []map[string]string
+			ExternalRefs []map[string]string
+		}
+		Relationships []map[string]string
+	}
+	err = json.Unmarshal(data, &doc)
+	c.Assert(err, gc.IsNil)
+	c.Assert(doc.SPDXVersion, gc.Equals, "SPDX-2.3")
+	c.Assert(doc.Name, gc.Equals, "dummy-5")
+	c.Assert(doc.DocumentNamespace, gc.Matches, "https://juju.ubuntu.com/spdx/dummy-5-[0-9a-f]{64}")
+	c.Assert(doc.CreationInfo.Created, gc.Equals, "2014-11-05T12:00:00Z")
+	c.Assert(doc.Packages, gc.HasLen, 3)
+	c.Assert(doc.Packages[0].SPDXID, gc.Equals, "SPDXRef-Charm")
+	c.Assert(doc.Packages[1].Name, gc.Equals, "requests")
+	c.Assert(doc.Packages[1].VersionInfo, gc.Equals, "2.4.3")
+	c.Assert(doc.Packages[1].Checksums, gc.DeepEquals, []map[string]string{{
+		"algorithm":     "SHA256",
+		"checksumValue": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	}})
+	c.Assert(doc.Packages[1].ExternalRefs[0]["referenceLocator"], gc.Equals, "pkg:pypi/requests@2.4.3")
+	c.Assert(doc.Packages[2].Checksums, gc.HasLen, 0)
+	c.Assert(doc.Relationships, gc.DeepEquals, []map[string]string{{
+		"spdxElementId":      "SPDXRef-DOCUMENT",
+		"relationshipType":   "DESCRIBES",
+		"relatedSpdxElement": "SPDXRef-Charm",
+	}, {
+		"spdxElementId":      "SPDXRef-Charm",
+		"relationshipType":   "CONTAINS",
+		"relatedSpdxElement": "SPDXRef-Package-1",
+	}, {
+		"spdxElementId":      "SPDXRef-Charm",
+		"relationshipType":   "CONTAINS",
+		"relatedSpdxElement": "SPDXRef-Package-2",
+	}})
+}
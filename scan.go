@@ -0,0 +1,131 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ContentScanner is implemented by types that inspect the files
+// in a charm archive, such as virus or vulnerability scanners.
+type ContentScanner interface {
+	// ScanFile is called with the slash-separated path of each
+	// file in the archive, its details and a reader of its
+	// contents. The contents of a symbolic link are its target.
+	// The reader is only valid until ScanFile returns. An error
+	// stops the scan, and is returned as a *ScanError.
+	ScanFile(path string, info os.FileInfo, r io.Reader) error
+}
+
+// ContentScannerFunc adapts a function to the ContentScanner
+// interface.
+type ContentScannerFunc func(path string, info os.FileInfo, r io.Reader) error
+
+// ScanFile implements ContentScanner.ScanFile by calling f.
+func (f ContentScannerFunc) ScanFile(path string, info os.FileInfo, r io.Reader) error {
+	return f(path, info, r)
+}
+
+// ScanError is returned when a ContentScanner rejects a file.
+type ScanError struct {
+	// Path holds the path of the file in the archive.
+	Path string
+
+	// Err holds the error returned by the scanner.
+	Err error
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("scan of %q failed: %v", e.Path, e.Err)
+}
+
+// ReadCharmArchiveWithScanner is like ReadCharmArchive except that
+// once the charm has been read, each file in the archive is passed
+// to the given scanner, without opening the archive again.
+func ReadCharmArchiveWithScanner(path string, scanner ContentScanner) (*CharmArchive, error) {
+	a, err := readCharmArchive(newZipOpenerFromPath(path), scanner)
+	if err != nil {
+		auditRead(nil, path, err)
+		return nil, err
+	}
+	a.Path = path
+	auditRead(a, path, nil)
+	return a, nil
+}
+
+// Scan passes each file in the charm archive to the given scanner.
+func (a *CharmArchive) Scan(scanner ContentScanner) error {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return err
+	}
+	defer zipr.Close()
+	return scanZip(zipr.Reader, scanner)
+}
+
+func scanZip(zipr *zip.Reader, scanner ContentScanner) error {
+	for _, fh := range zipr.File {
+		if strings.HasSuffix(fh.Name, "/") {
+			continue
+		}
+		r, err := fh.Open()
+		if err != nil {
+			return err
+		}
+		err = scanner.ScanFile(fh.Name, fh.FileInfo(), r)
+		r.Close()
+		if err != nil {
+			return &ScanError{Path: fh.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+// SandboxScanner returns a ContentScanner that copies each file to
+// a temporary file in the given directory, which may be watched by
+// an on-access scanner or shared with a scanning sandbox, and then
+// calls check with the file's path in the archive and the path of
+// the temporary file. The temporary file is removed when check
+// returns.
+func SandboxScanner(dir string, check func(path, file string) error) ContentScanner {
+	return ContentScannerFunc(func(path string, info os.FileInfo, r io.Reader) error {
+		f, err := ioutil.TempFile(dir, "charm-scan-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		_, err = io.Copy(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		return check(path, f.Name())
+	})
+}
+
+// StreamScanner returns a ContentScanner that copies each file
+// to the writer returned by calling open with the file's path in
+// the archive, such as a connection to a scanning daemon. The
+// writer is closed after the file has been copied; the error
+// returned by Close holds the scanner's verdict.
+func StreamScanner(open func(path string) (io.WriteCloser, error)) ContentScanner {
+	return ContentScannerFunc(func(path string, info os.FileInfo, r io.Reader) error {
+		w, err := open(path)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	})
+}
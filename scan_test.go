@@ -0,0 +1,145 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ScanSuite struct {
+	archivePath string
+}
+
+var _ = gc.Suite(&ScanSuite{})
+
+func (s *ScanSuite) SetUpSuite(c *gc.C) {
+	s.archivePath = charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+}
+
+var dummyArchiveFiles = []string{
+	"actions.yaml",
+	"config.yaml",
+	"empty/.gitkeep",
+	"hooks/install",
+	"metadata.yaml",
+	"revision",
+	"src/hello.c",
+}
+
+// recordingScanner returns a ContentScanner that records
+// the contents of each file scanned in files.
+func recordingScanner(files map[string]string) charm.ContentScanner {
+	return charm.ContentScannerFunc(func(path string, info os.FileInfo, r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		files[path] = string(data)
+		return nil
+	})
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *ScanSuite) TestReadCharmArchiveWithScanner(c *gc.C) {
+	files := make(map[string]string)
+	archive, err := charm.ReadCharmArchiveWithScanner(s.archivePath, recordingScanner(files))
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dummy")
+	c.Assert(archive.Path, gc.Equals, s.archivePath)
+	c.Assert(sortedKeys(files), gc.DeepEquals, dummyArchiveFiles)
+	c.Assert(files["src/hello.c"], gc.Matches, "(?s).*main.*")
+}
+
+func (s *ScanSuite) TestScan(c *gc.C) {
+	archive, err := charm.ReadCharmArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+	files := make(map[string]string)
+	err = archive.Scan(recordingScanner(files))
+	c.Assert(err, gc.IsNil)
+	c.Assert(sortedKeys(files), gc.DeepEquals, dummyArchiveFiles)
+}
+
+func (s *ScanSuite) TestScanRejected(c *gc.C) {
+	scanner := charm.ContentScannerFunc(func(path string, info os.FileInfo, r io.Reader) error {
+		if path == "hooks/install" {
+			c.Check(info.Mode()&0100, gc.Not(gc.Equals), os.FileMode(0))
+			return errors.New("infected")
+		}
+		return nil
+	})
+	archive, err := charm.ReadCharmArchiveWithScanner(s.archivePath, scanner)
+	c.Assert(err, gc.ErrorMatches, `scan of "hooks/install" failed: infected`)
+	c.Assert(archive, gc.IsNil)
+	scanErr, ok := err.(*charm.ScanError)
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(scanErr.Path, gc.Equals, "hooks/install")
+}
+
+func (s *ScanSuite) TestSandboxScanner(c *gc.C) {
+	sandbox := c.MkDir()
+	files := make(map[string]string)
+	var tempFiles []string
+	scanner := charm.SandboxScanner(sandbox, func(path, file string) error {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		files[path] = string(data)
+		tempFiles = append(tempFiles, file)
+		return nil
+	})
+	archive, err := charm.ReadCharmArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+	err = archive.Scan(scanner)
+	c.Assert(err, gc.IsNil)
+	c.Assert(sortedKeys(files), gc.DeepEquals, dummyArchiveFiles)
+	for _, file := range tempFiles {
+		_, err := os.Stat(file)
+		c.Assert(os.IsNotExist(err), gc.Equals, true)
+	}
+}
+
+// verdictWriter rejects files mentioning main.
+type verdictWriter struct {
+	bytes.Buffer
+}
+
+func (w *verdictWriter) Close() error {
+	if bytes.Contains(w.Bytes(), []byte("main")) {
+		return errors.New("suspicious")
+	}
+	return nil
+}
+
+func (s *ScanSuite) TestStreamScanner(c *gc.C) {
+	var opened []string
+	scanner := charm.StreamScanner(func(path string) (io.WriteCloser, error) {
+		opened = append(opened, path)
+		return &verdictWriter{}, nil
+	})
+	archive, err := charm.ReadCharmArchive(s.archivePath)
+	c.Assert(err, gc.IsNil)
+	err = archive.Scan(scanner)
+	c.Assert(err, gc.ErrorMatches, `scan of "src/hello.c" failed: suspicious`)
+	c.Assert(opened, gc.Not(gc.HasLen), 0)
+	c.Assert(opened[len(opened)-1], gc.Equals, "src/hello.c")
+}
@@ -0,0 +1,169 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// ScanOptions holds options for ScanDir.
+type ScanOptions struct {
+	// Concurrency holds the maximum number of charms read at
+	// once. If it is zero, runtime.NumCPU() is used.
+	Concurrency int
+
+	// Skip, if not nil, is called for each directory and file
+	// found below the root. If it returns true, the directory
+	// or file is ignored.
+	Skip func(path string, info os.FileInfo) bool
+}
+
+// ScanResult holds a charm found by ScanDir.
+type ScanResult struct {
+	// Path holds the path of the charm directory or archive.
+	Path string
+
+	// Charm holds the charm read, a *CharmDir or a
+	// *CharmArchive, or nil if it could not be read.
+	Charm Charm
+
+	// Err holds the error encountered reading the charm,
+	// or walking the tree at Path.
+	Err error
+}
+
+// ScanDir finds and reads every charm under the given root directory,
+// for the use of repository indexers and migration scripts. A charm
+// directory is a directory holding a metadata.yaml file; a charm
+// archive is a file with a ".charm" or ".zip" extension holding one.
+// Charm directories are not searched further, and hidden files and
+// directories are ignored.
+//
+// The charms are read concurrently and sent on the returned channel,
+// in no particular order, as they are read; a charm that cannot be
+// read is sent with the error encountered. The channel is closed once
+// the whole tree has been scanned, and callers must read from it
+// until then. An error is returned only if root cannot be read.
+func ScanDir(root string, opts ScanOptions) (<-chan ScanResult, error) {
+	return ScanDirContext(context.Background(), root, opts)
+}
+
+// ScanDirContext is like ScanDir except that the scan is abandoned
+// once the context is done: no more charms are read, charms whose
+// reading was interrupted are not sent, and the channel is closed
+// once the scanning goroutines have stopped. Callers may stop reading
+// from the channel once the context is done.
+func ScanDirContext(ctx context.Context, root string, opts ScanOptions) (<-chan ScanResult, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%q is not a directory", root)
+	}
+	n := opts.Concurrency
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	paths := make(chan ScanResult)
+	results := make(chan ScanResult)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for r := range paths {
+				if r.Err == nil {
+					r.Charm, r.Err = scanCharm(ctx, r.Path)
+				}
+				if ctx.Err() != nil || r.Charm == nil && r.Err == nil {
+					continue
+				}
+				select {
+				case results <- r:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	// send sends r to the workers, returning
+	// ctx.Err() if the context is done first.
+	send := func(r ScanResult) error {
+		select {
+		case paths <- r:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	go func() {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err != nil {
+				return send(ScanResult{Path: path, Err: err})
+			}
+			if path == root {
+				return nil
+			}
+			if strings.HasPrefix(info.Name(), ".") || opts.Skip != nil && opts.Skip(path, info) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			switch {
+			case info.IsDir() && fileExists(filepath.Join(path, MetadataFile)):
+				if err := send(ScanResult{Path: path}); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			case info.Mode().IsRegular() && isArchiveName(path):
+				return send(ScanResult{Path: path})
+			}
+			return nil
+		})
+		close(paths)
+		wg.Wait()
+		close(results)
+	}()
+	return results, nil
+}
+
+// isArchiveName reports whether the file at the
+// given path is named as a charm archive.
+func isArchiveName(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".charm" || ext == ".zip"
+}
+
+// scanCharm reads the charm at the given path found by ScanDir,
+// failing with ctx.Err() once the context is done. It returns a
+// nil Charm and error if the path holds an archive that is not a
+// charm, such as a bundle.
+func scanCharm(ctx context.Context, path string) (Charm, error) {
+	kind, err := detectKind(path)
+	if err != nil {
+		return nil, err
+	}
+	var ch Charm
+	switch kind {
+	case KindCharmDir:
+		ch, err = ReadCharmDirContext(ctx, path)
+	case KindCharmArchive:
+		ch, err = ReadCharmArchiveContext(ctx, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
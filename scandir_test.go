@@ -0,0 +1,138 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	"golang.org/x/net/context"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type ScanDirSuite struct{}
+
+var _ = gc.Suite(&ScanDirSuite{})
+
+// scanTree creates a tree of charms to scan, returning its root.
+func scanTree(c *gc.C) string {
+	root := c.MkDir()
+	mkdir := func(path string) string {
+		path = filepath.Join(root, path)
+		err := os.MkdirAll(path, 0755)
+		c.Assert(err, gc.IsNil)
+		return path
+	}
+	charmtesting.Charms.ClonedDirPath(mkdir("trusty"), "dummy")
+	charmtesting.Charms.ClonedDirPath(mkdir("trusty"), "wordpress")
+	charmtesting.Charms.CharmArchivePath(mkdir("archives/mysql"), "mysql")
+	charmtesting.Charms.ClonedDirPath(mkdir(".hidden"), "varnish")
+	err := ioutil.WriteFile(filepath.Join(mkdir("archives"), "bundle.zip"), writeZip(c,
+		[2]string{"bundle.yaml", "services: {}\n"},
+	), 0644)
+	c.Assert(err, gc.IsNil)
+	bad := mkdir("trusty/bad")
+	err = ioutil.WriteFile(filepath.Join(bad, "metadata.yaml"), []byte("name: bad\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	return root
+}
+
+func (s *ScanDirSuite) TestScanDir(c *gc.C) {
+	root := scanTree(c)
+	results, err := charm.ScanDir(root, charm.ScanOptions{Concurrency: 2})
+	c.Assert(err, gc.IsNil)
+	var found, failed []string
+	for r := range results {
+		rel, err := filepath.Rel(root, r.Path)
+		c.Assert(err, gc.IsNil)
+		if r.Err != nil {
+			c.Assert(r.Charm, gc.IsNil)
+			failed = append(failed, filepath.ToSlash(rel))
+			continue
+		}
+		found = append(found, filepath.ToSlash(rel)+" "+r.Charm.Meta().Name)
+	}
+	sort.Strings(found)
+	c.Assert(found, jc.DeepEquals, []string{
+		"archives/mysql/archive.charm mysql",
+		"trusty/dummy dummy",
+		"trusty/wordpress wordpress",
+	})
+	c.Assert(failed, jc.DeepEquals, []string{"trusty/bad"})
+}
+
+func (s *ScanDirSuite) TestScanDirSkip(c *gc.C) {
+	root := scanTree(c)
+	results, err := charm.ScanDir(root, charm.ScanOptions{
+		Skip: func(path string, info os.FileInfo) bool {
+			return info.Name() == "trusty"
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	var names []string
+	for r := range results {
+		c.Assert(r.Err, gc.IsNil)
+		names = append(names, r.Charm.Meta().Name)
+	}
+	c.Assert(names, jc.DeepEquals, []string{"mysql"})
+}
+
+// drainScan reads the results remaining on the given channel,
+// failing if it is not closed in good time.
+func drainScan(c *gc.C, results <-chan charm.ScanResult) []charm.ScanResult {
+	var rs []charm.ScanResult
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				return rs
+			}
+			rs = append(rs, r)
+		case <-timeout:
+			c.Fatalf("scan results not closed")
+		}
+	}
+}
+
+func (s *ScanDirSuite) TestScanDirContextDone(c *gc.C) {
+	root := scanTree(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := charm.ScanDirContext(ctx, root, charm.ScanOptions{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(drainScan(c, results), gc.HasLen, 0)
+}
+
+func (s *ScanDirSuite) TestScanDirContextCancel(c *gc.C) {
+	root := scanTree(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results, err := charm.ScanDirContext(ctx, root, charm.ScanOptions{Concurrency: 1})
+	c.Assert(err, gc.IsNil)
+	<-results
+	cancel()
+	// A charm may already be waiting to be sent,
+	// but no more are read.
+	rest := drainScan(c, results)
+	c.Assert(len(rest) <= 1, jc.IsTrue, gc.Commentf("%d results after cancel", len(rest)))
+}
+
+func (s *ScanDirSuite) TestScanDirBadRoot(c *gc.C) {
+	_, err := charm.ScanDir(filepath.Join(c.MkDir(), "missing"), charm.ScanOptions{})
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+
+	path := filepath.Join(c.MkDir(), "file")
+	err = ioutil.WriteFile(path, nil, 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.ScanDir(path, charm.ScanOptions{})
+	c.Assert(err, gc.ErrorMatches, `".*file" is not a directory`)
+}
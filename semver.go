@@ -0,0 +1,158 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SemVer holds a semantic version, as described at
+// http://semver.org, such as "2.0.0" or "2.0.0-rc1".
+//
+// A charm may declare the version it was published as in the version
+// field of its metadata. The version is informational: charms are
+// still ordered by their integer revision, which increases with each
+// change, so that a release candidate such as 2.0.0-rc1 may be
+// published at one revision and 2.0.0 at a later one.
+type SemVer struct {
+	Major, Minor, Patch int
+
+	// PreRelease holds the dot-separated pre-release
+	// identifiers of the version, such as "rc1" or
+	// "beta.2", or the empty string for a release.
+	PreRelease string
+
+	// Build holds the dot-separated build metadata of the
+	// version, such as "20141105". It is ignored when
+	// ordering versions.
+	Build string
+}
+
+var (
+	validSemVer  = regexp.MustCompile(`^(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+	numericIdent = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// ParseSemVer parses a semantic version in the form
+// "major.minor.patch", optionally followed by "-" and
+// pre-release identifiers and by "+" and build metadata,
+// as in "2.0.0-rc1+20141105".
+func ParseSemVer(s string) (SemVer, error) {
+	m := validSemVer.FindStringSubmatch(s)
+	if m == nil {
+		return SemVer{}, fmt.Errorf("invalid version %q", s)
+	}
+	v := SemVer{
+		PreRelease: m[4],
+		Build:      m[5],
+	}
+	for i, p := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return SemVer{}, fmt.Errorf("invalid version %q: %v", s, err)
+		}
+		*p = n
+	}
+	for _, ident := range strings.Split(v.PreRelease, ".") {
+		if len(ident) > 1 && ident[0] == '0' && numericIdent.MatchString(ident) {
+			return SemVer{}, fmt.Errorf("invalid version %q: pre-release identifier %q has a leading zero", s, ident)
+		}
+	}
+	return v, nil
+}
+
+// MustParseSemVer is like ParseSemVer except that it panics on error.
+func MustParseSemVer(s string) SemVer {
+	v, err := ParseSemVer(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// String returns the version in the form accepted by ParseSemVer.
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// IsPreRelease reports whether the version
+// is a pre-release, such as "2.0.0-rc1".
+func (v SemVer) IsPreRelease() bool {
+	return v.PreRelease != ""
+}
+
+// Compare returns -1, 0 or 1 depending on whether v has lower, equal
+// or higher precedence than other. As described by the semantic
+// versioning specification, a pre-release has lower precedence than
+// the release with the same major, minor and patch versions;
+// pre-release identifiers are compared in turn, numerically for
+// numeric identifiers, which have lower precedence than others, and
+// build metadata is ignored.
+func (v SemVer) Compare(other SemVer) int {
+	for _, c := range []int{
+		compareInts(v.Major, other.Major),
+		compareInts(v.Minor, other.Minor),
+		compareInts(v.Patch, other.Patch),
+	} {
+		if c != 0 {
+			return c
+		}
+	}
+	switch {
+	case v.PreRelease == other.PreRelease:
+		return 0
+	case v.PreRelease == "":
+		return 1
+	case other.PreRelease == "":
+		return -1
+	}
+	as, bs := strings.Split(v.PreRelease, "."), strings.Split(other.PreRelease, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := comparePreReleaseIdents(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(as), len(bs))
+}
+
+func comparePreReleaseIdents(a, b string) int {
+	an, bn := numericIdent.MatchString(a), numericIdent.MatchString(b)
+	switch {
+	case an && bn:
+		if c := compareInts(len(a), len(b)); c != 0 {
+			return c
+		}
+		return compareStrings(a, b)
+	case an:
+		return -1
+	case bn:
+		return 1
+	}
+	return compareStrings(a, b)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v SemVer) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *SemVer) UnmarshalText(data []byte) error {
+	parsed, err := ParseSemVer(string(data))
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"encoding/json"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type SemVerSuite struct{}
+
+var _ = gc.Suite(&SemVerSuite{})
+
+var parseSemVerTests = []struct {
+	s      string
+	expect charm.SemVer
+	err    string
+}{{
+	s:      "2.0.0",
+	expect: charm.SemVer{Major: 2},
+}, {
+	s:      "1.10.3-rc1",
+	expect: charm.SemVer{Major: 1, Minor: 10, Patch: 3, PreRelease: "rc1"},
+}, {
+	s:      "0.1.0-beta.2+20141105.sha-5114f85",
+	expect: charm.SemVer{Minor: 1, PreRelease: "beta.2", Build: "20141105.sha-5114f85"},
+}, {
+	s:      "1.0.0+001",
+	expect: charm.SemVer{Major: 1, Build: "001"},
+}, {
+	s:   "1.0",
+	err: `invalid version "1.0"`,
+}, {
+	s:   "v1.0.0",
+	err: `invalid version "v1.0.0"`,
+}, {
+	s:   "01.0.0",
+	err: `invalid version "01.0.0"`,
+}, {
+	s:   "1.0.0-",
+	err: `invalid version "1.0.0-"`,
+}, {
+	s:   "1.0.0-rc..1",
+	err: `invalid version "1.0.0-rc..1"`,
+}, {
+	s:   "1.0.0-rc.01",
+	err: `invalid version "1.0.0-rc.01": pre-release identifier "01" has a leading zero`,
+}, {
+	s:   "1.0.0-rc_1",
+	err: `invalid version "1.0.0-rc_1"`,
+}, {
+	s:   "99999999999999999999.0.0",
+	err: `invalid version "99999999999999999999.0.0": .*`,
+}}
+
+func (s *SemVerSuite) TestParseSemVer(c *gc.C) {
+	for i, test := range parseSemVerTests {
+		c.Logf("test %d: %q", i, test.s)
+		v, err := charm.ParseSemVer(test.s)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(v, gc.Equals, test.expect)
+		c.Assert(v.String(), gc.Equals, test.s)
+		c.Assert(v.IsPreRelease(), gc.Equals, v.PreRelease != "")
+	}
+}
+
+func (s *SemVerSuite) TestMustParseSemVer(c *gc.C) {
+	c.Assert(charm.MustParseSemVer("1.2.3"), gc.Equals, charm.SemVer{Major: 1, Minor: 2, Patch: 3})
+	c.Assert(func() { charm.MustParseSemVer("1.2") }, gc.PanicMatches, `invalid version "1.2"`)
+}
+
+// versionOrder holds versions in order of precedence,
+// as given by the semantic versioning specification.
+var versionOrder = []string{
+	"1.0.0-alpha",
+	"1.0.0-alpha.1",
+	"1.0.0-alpha.beta",
+	"1.0.0-beta",
+	"1.0.0-beta.2",
+	"1.0.0-beta.11",
+	"1.0.0-rc.1",
+	"1.0.0",
+	"1.0.1",
+	"1.1.0",
+	"1.10.0",
+	"2.0.0-rc1",
+	"2.0.0-rc2",
+	"2.0.0",
+}
+
+func (s *SemVerSuite) TestCompare(c *gc.C) {
+	for i, a := range versionOrder {
+		for j, b := range versionOrder {
+			expect := 0
+			switch {
+			case i < j:
+				expect = -1
+			case i > j:
+				expect = 1
+			}
+			c.Check(charm.MustParseSemVer(a).Compare(charm.MustParseSemVer(b)), gc.Equals, expect, gc.Commentf("%s vs %s", a, b))
+		}
+	}
+	// Build metadata is ignored.
+	c.Assert(charm.MustParseSemVer("1.0.0+1").Compare(charm.MustParseSemVer("1.0.0+2")), gc.Equals, 0)
+}
+
+func (s *SemVerSuite) TestMarshalText(c *gc.C) {
+	data, err := json.Marshal(charm.MustParseSemVer("2.0.0-rc1"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `"2.0.0-rc1"`)
+	var v charm.SemVer
+	err = json.Unmarshal(data, &v)
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, charm.MustParseSemVer("2.0.0-rc1"))
+	err = json.Unmarshal([]byte(`"2.0"`), &v)
+	c.Assert(err, gc.ErrorMatches, `invalid version "2.0"`)
+}
+
+func (s *SemVerSuite) TestMetaVersion(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader("name: v\nsummary: s\ndescription: d\nversion: 2.0.0-rc1\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Version, gc.Equals, "2.0.0-rc1")
+	c.Assert(meta.UnknownFields, gc.IsNil)
+
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	dir.SetMeta(meta)
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+	saved, err := charm.ReadCharmDir(dir.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(saved.Meta(), jc.DeepEquals, meta)
+
+	// Versions that are not semantic versions are ignored.
+	for _, version := range []string{"2.0rc1", `"1.0"`, "1.0", "2"} {
+		c.Logf("version %s", version)
+		meta, err := charm.ReadMeta(strings.NewReader("name: v\nsummary: s\ndescription: d\nversion: " + version + "\n"))
+		c.Assert(err, gc.IsNil)
+		c.Assert(meta.Version, gc.Equals, "")
+		c.Assert(meta.Check(), gc.IsNil)
+	}
+}
@@ -0,0 +1,622 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The default YAMLCodec spends most of its time and allocations setting
+// up the gopkg.in/yaml.v1 parser and building its token stream, which
+// dominates the cost of reading the small files held in charms. Nearly
+// all of those files use only a small part of YAML: block mappings and
+// sequences of plain or quoted scalars, single-line flow collections
+// and literal or folded descriptions. decodeSimpleYAML decodes that
+// subset directly, producing exactly the values yaml.v1 would, and
+// declines any document using anything else so that yaml.v1 decodes
+// it instead and reports any error just as it always did.
+
+// decodeSimpleYAMLInto decodes data into v, which must be one of
+// the types decoded by ReadMeta and ReadConfig, and reports whether
+// it did so. If it returns false, v is unchanged.
+func decodeSimpleYAMLInto(data []byte, v interface{}) bool {
+	switch v.(type) {
+	case map[interface{}]interface{}, *interface{}, **configDoc:
+	default:
+		return false
+	}
+	decoded, ok := decodeSimpleYAML(data)
+	if !ok {
+		return false
+	}
+	switch out := v.(type) {
+	case map[interface{}]interface{}:
+		m, ok := decoded.(map[interface{}]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range m {
+			out[key] = value
+		}
+	case *interface{}:
+		*out = decoded
+	case **configDoc:
+		doc, ok := simpleConfigDoc(decoded)
+		if !ok {
+			return false
+		}
+		*out = doc
+	}
+	return true
+}
+
+// simpleConfigDoc returns the configDoc that yaml.v1 would decode
+// from v, reporting whether v is simple enough to convert.
+func simpleConfigDoc(v interface{}) (*configDoc, bool) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, false
+	}
+	doc := &configDoc{}
+	for key, value := range m {
+		if key, ok := key.(string); !ok {
+			return nil, false
+		} else if key != "options" {
+			continue
+		}
+		options, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil, false
+		}
+		doc.Options = make(map[string]optionDoc, len(options))
+		for name, value := range options {
+			name, ok := name.(string)
+			if !ok {
+				return nil, false
+			}
+			fields, ok := value.(map[interface{}]interface{})
+			if !ok {
+				return nil, false
+			}
+			var opt optionDoc
+			for field, value := range fields {
+				field, ok := field.(string)
+				if !ok {
+					return nil, false
+				}
+				switch field {
+				case "type":
+					// yaml.v1 stores the source text of any
+					// other scalar, which is not kept here.
+					if opt.Type, ok = value.(string); !ok {
+						return nil, false
+					}
+				case "description":
+					opt.Description = value
+				case "default":
+					opt.Default = value
+				}
+			}
+			doc.Options[name] = opt
+		}
+	}
+	return doc, true
+}
+
+// notSimpleYAML is raised by a simpleYAMLDecoder on
+// finding something outside the subset it decodes.
+type notSimpleYAML struct{}
+
+// decodeSimpleYAML decodes a document consisting of a single
+// block mapping or sequence, reporting whether it was able to.
+func decodeSimpleYAML(data []byte) (v interface{}, ok bool) {
+	// Tabs, carriage returns, other control characters and
+	// anything outside ASCII are all left to yaml.v1.
+	for _, b := range data {
+		if (b < ' ' || b > '~') && b != '\n' {
+			return nil, false
+		}
+	}
+	d := &simpleYAMLDecoder{}
+	if !d.split(string(data)) {
+		return nil, false
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isNotSimple := r.(notSimpleYAML); !isNotSimple {
+				panic(r)
+			}
+			v, ok = nil, false
+		}
+	}()
+	d.skip()
+	if d.i == len(d.lines) {
+		return nil, false
+	}
+	v = d.block(d.lines[d.i].indent)
+	d.skip()
+	if d.i != len(d.lines) {
+		d.decline()
+	}
+	return v, true
+}
+
+// yamlLine holds one line of a YAML document.
+type yamlLine struct {
+	// indent holds the number of leading spaces.
+	indent int
+	// text holds the rest of the line.
+	text string
+}
+
+func (l yamlLine) blank() bool {
+	return l.text == ""
+}
+
+// simpleYAMLDecoder decodes the lines of a document.
+type simpleYAMLDecoder struct {
+	lines []yamlLine
+	// i holds the index of the next line to decode.
+	i int
+}
+
+// split splits doc into lines, reporting false if any
+// line holds a directive or a document marker.
+func (d *simpleYAMLDecoder) split(doc string) bool {
+	d.lines = make([]yamlLine, 0, strings.Count(doc, "\n")+1)
+	for len(doc) > 0 {
+		line := doc
+		if j := strings.IndexByte(doc, '\n'); j >= 0 {
+			line, doc = doc[:j], doc[j+1:]
+		} else {
+			doc = ""
+		}
+		indent := 0
+		for indent < len(line) && line[indent] == ' ' {
+			indent++
+		}
+		if indent == 0 && (strings.HasPrefix(line, "---") || strings.HasPrefix(line, "...") || strings.HasPrefix(line, "%")) {
+			return false
+		}
+		d.lines = append(d.lines, yamlLine{indent, line[indent:]})
+	}
+	return true
+}
+
+func (d *simpleYAMLDecoder) decline() {
+	panic(notSimpleYAML{})
+}
+
+// skip moves past any blank and comment lines.
+func (d *simpleYAMLDecoder) skip() {
+	for d.i < len(d.lines) && (d.lines[d.i].blank() || d.lines[d.i].text[0] == '#') {
+		d.i++
+	}
+}
+
+// block decodes the mapping or sequence starting
+// at the current line, which is indented by indent.
+func (d *simpleYAMLDecoder) block(indent int) interface{} {
+	if isSequenceEntry(d.lines[d.i].text) {
+		return d.sequence(indent)
+	}
+	return d.mapping(indent)
+}
+
+func isSequenceEntry(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// mapping decodes a block mapping whose keys are indented by indent.
+func (d *simpleYAMLDecoder) mapping(indent int) interface{} {
+	m := make(map[interface{}]interface{})
+	for {
+		d.skip()
+		if d.i == len(d.lines) || d.lines[d.i].indent < indent {
+			return m
+		}
+		line := d.lines[d.i]
+		if line.indent > indent || isSequenceEntry(line.text) {
+			d.decline()
+		}
+		j := mappingColon(line.text)
+		if j < 0 {
+			d.decline()
+		}
+		key := d.resolve(d.plain(line.text[:j]))
+		switch key.(type) {
+		case string, int, bool:
+		default:
+			d.decline()
+		}
+		if _, ok := m[key]; ok {
+			d.decline()
+		}
+		d.i++
+		m[key] = d.value(indent, strings.TrimLeft(line.text[j+1:], " "), true)
+	}
+}
+
+// sequence decodes a block sequence whose entries are indented by indent.
+func (d *simpleYAMLDecoder) sequence(indent int) interface{} {
+	var s []interface{}
+	for {
+		d.skip()
+		if d.i == len(d.lines) {
+			return s
+		}
+		line := &d.lines[d.i]
+		if line.indent < indent || line.indent == indent && !isSequenceEntry(line.text) {
+			return s
+		}
+		if line.indent > indent {
+			d.decline()
+		}
+		rest := strings.TrimLeft(line.text[1:], " ")
+		if isSequenceEntry(rest) {
+			d.decline()
+		}
+		if rest != "" && strings.IndexByte(`#"'[{|>`, rest[0]) < 0 && mappingColon(rest) >= 0 {
+			// An entry such as "- key: value" starts a mapping
+			// whose keys are indented to the first key.
+			line.indent += len(line.text) - len(rest)
+			line.text = rest
+			s = append(s, d.mapping(line.indent))
+			continue
+		}
+		d.i++
+		s = append(s, d.value(indent, rest, false))
+	}
+}
+
+// value decodes the value following a mapping key or a
+// sequence entry indicator, where text holds the rest of
+// the line and indent the indentation of the key or entry.
+func (d *simpleYAMLDecoder) value(indent int, text string, inMapping bool) interface{} {
+	if text == "" || text[0] == '#' {
+		d.skip()
+		if d.i < len(d.lines) {
+			line := d.lines[d.i]
+			if line.indent > indent {
+				return d.block(line.indent)
+			}
+			if inMapping && line.indent == indent && isSequenceEntry(line.text) {
+				return d.sequence(indent)
+			}
+		}
+		return nil
+	}
+	var v interface{}
+	switch text[0] {
+	case '|', '>':
+		v = d.blockScalar(indent, text)
+	case '"', '\'':
+		s, tail := d.quoted(text)
+		d.checkTail(tail)
+		v = s
+	case '[', '{':
+		var tail string
+		v, tail = d.flow(text)
+		d.checkTail(tail)
+	default:
+		text, tail := text, ""
+		if j := strings.Index(text, " #"); j >= 0 {
+			text, tail = text[:j], text[j:]
+		}
+		if mappingColon(text) >= 0 {
+			d.decline()
+		}
+		v = d.resolve(d.plain(text))
+		d.checkTail(tail)
+	}
+	// A value continued on further lines, such
+	// as a multi-line plain scalar, is not simple.
+	d.skip()
+	if d.i < len(d.lines) && d.lines[d.i].indent > indent {
+		d.decline()
+	}
+	return v
+}
+
+// mappingColon returns the index of the colon ending
+// the mapping key that starts text, or -1 if text
+// does not start with a key.
+func mappingColon(text string) int {
+	for j := 0; j < len(text); j++ {
+		switch text[j] {
+		case ':':
+			if j+1 == len(text) || text[j+1] == ' ' {
+				return j
+			}
+		case '#':
+			if j > 0 && text[j-1] == ' ' {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+// checkTail declines unless tail, which
+// follows a value, is empty or a comment.
+func (d *simpleYAMLDecoder) checkTail(tail string) {
+	t := strings.TrimLeft(tail, " ")
+	if t != "" && (t[0] != '#' || len(t) == len(tail)) {
+		d.decline()
+	}
+}
+
+// plain returns text, which holds a plain scalar, without any
+// trailing spaces. It declines if text starts with an indicator
+// that gives it another meaning.
+func (d *simpleYAMLDecoder) plain(text string) string {
+	text = strings.TrimRight(text, " ")
+	if text == "" || strings.IndexByte("?:,[]{}#&*!|>'\"%@`", text[0]) >= 0 || text[0] == '-' && (len(text) == 1 || text[1] == ' ') {
+		d.decline()
+	}
+	return text
+}
+
+// simpleYAMLWords holds the plain scalars that yaml.v1
+// resolves to booleans or null.
+var simpleYAMLWords = map[string]interface{}{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true,
+	"true": true, "True": true, "TRUE": true,
+	"on": true, "On": true, "ON": true,
+	"n": false, "N": false, "no": false, "No": false, "NO": false,
+	"false": false, "False": false, "FALSE": false,
+	"off": false, "Off": false, "OFF": false,
+	"": nil, "~": nil, "null": nil, "Null": nil, "NULL": nil,
+}
+
+// resolve returns the value of the plain scalar s as yaml.v1
+// resolves it. Only booleans, null, decimal integers and strings
+// are resolved; anything that yaml.v1 might decode as some other
+// type, such as a float or a timestamp, is declined.
+func (d *simpleYAMLDecoder) resolve(s string) interface{} {
+	if v, ok := simpleYAMLWords[s]; ok {
+		return v
+	}
+	switch c := s[0]; {
+	case c == '.' || s == "<<":
+		d.decline()
+	case (c == '+' || c == '-') && len(s) > 1 && (s[1] < '0' || s[1] > '9') && s[1] != '.':
+		// yaml.v1 resolves no number
+		// from such a signed string.
+	case c == '+' || c == '-' || c >= '0' && c <= '9':
+		n, ok := simpleInt(s)
+		if !ok {
+			d.decline()
+		}
+		return n
+	}
+	return s
+}
+
+// simpleInt parses s as a decimal integer without leading
+// zeros, reporting whether it is one small enough to fit
+// in an int without overflow on any platform yaml.v1 runs on.
+func simpleInt(s string) (int, bool) {
+	digits := s
+	if s[0] == '+' || s[0] == '-' {
+		digits = s[1:]
+	}
+	if digits == "" || len(digits) > 9 || digits[0] == '0' && len(digits) > 1 {
+		return 0, false
+	}
+	for j := 0; j < len(digits); j++ {
+		if digits[j] < '0' || digits[j] > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+// quoted decodes the single or double quoted scalar that
+// starts text, returning it along with the rest of text. It
+// declines if the scalar continues past the end of the line
+// or uses an escape sequence other than \\, \", \n and \t.
+func (d *simpleYAMLDecoder) quoted(text string) (s, tail string) {
+	quote := text[0]
+	var buf []byte
+	start := 1
+	for j := 1; j < len(text); j++ {
+		c := text[j]
+		switch {
+		case c == quote && quote == '\'' && j+1 < len(text) && text[j+1] == '\'':
+			buf = append(buf, text[start:j+1]...)
+			j++
+			start = j + 1
+		case c == quote:
+			if buf == nil {
+				return text[start:j], text[j+1:]
+			}
+			buf = append(buf, text[start:j]...)
+			return string(buf), text[j+1:]
+		case c == '\\' && quote == '"':
+			if j+1 == len(text) {
+				d.decline()
+			}
+			buf = append(buf, text[start:j]...)
+			j++
+			switch text[j] {
+			case '\\', '"':
+				buf = append(buf, text[j])
+			case 'n':
+				buf = append(buf, '\n')
+			case 't':
+				buf = append(buf, '\t')
+			default:
+				d.decline()
+			}
+			start = j + 1
+		}
+	}
+	panic(notSimpleYAML{})
+}
+
+// flow decodes the single-line flow sequence or mapping of
+// scalars that starts text, returning it along with the rest of
+// text.
+func (d *simpleYAMLDecoder) flow(text string) (v interface{}, tail string) {
+	end := byte(']')
+	if text[0] == '{' {
+		end = '}'
+	}
+	s := []interface{}{}
+	m := make(map[interface{}]interface{})
+	j := 1
+	for first := true; ; first = false {
+		j = skipSpaces(text, j)
+		if j < len(text) && text[j] == end && first {
+			break
+		}
+		if end == ']' {
+			var item interface{}
+			item, j = d.flowScalar(text, j, ",]")
+			s = append(s, item)
+		} else {
+			k := strings.IndexByte(text[j:], ':')
+			if k < 0 {
+				d.decline()
+			}
+			if j+k+1 == len(text) || text[j+k+1] != ' ' || strings.ContainsAny(text[j:j+k], ",[]{}#\"'") {
+				d.decline()
+			}
+			key := d.resolve(d.plain(text[j : j+k]))
+			switch key.(type) {
+			case string, int, bool:
+			default:
+				d.decline()
+			}
+			if _, ok := m[key]; ok {
+				d.decline()
+			}
+			m[key], j = d.flowScalar(text, j+k+1, ",}")
+		}
+		j = skipSpaces(text, j)
+		if j == len(text) {
+			d.decline()
+		}
+		if text[j] == end {
+			break
+		}
+		if text[j] != ',' {
+			d.decline()
+		}
+		j++
+	}
+	if end == ']' {
+		return s, text[j+1:]
+	}
+	return m, text[j+1:]
+}
+
+// flowScalar decodes the scalar at text[j:] within a flow collection,
+// which ends at any of the given bytes, returning its value and the
+// index following it.
+func (d *simpleYAMLDecoder) flowScalar(text string, j int, ends string) (interface{}, int) {
+	j = skipSpaces(text, j)
+	if j == len(text) {
+		d.decline()
+	}
+	if c := text[j]; c == '"' || c == '\'' {
+		s, tail := d.quoted(text[j:])
+		return s, len(text) - len(tail)
+	}
+	k := strings.IndexAny(text[j:], ends)
+	if k < 0 || strings.ContainsAny(text[j:j+k], ":#[]{}\"'") {
+		d.decline()
+	}
+	return d.resolve(d.plain(text[j : j+k])), j + k
+}
+
+func skipSpaces(text string, j int) int {
+	for j < len(text) && text[j] == ' ' {
+		j++
+	}
+	return j
+}
+
+// blockScalar decodes the literal or folded block scalar whose
+// header is given, found after a key or entry indented by indent.
+// It declines explicit indentation indicators, lines more indented
+// than the first in a folded scalar, and leading blank lines.
+func (d *simpleYAMLDecoder) blockScalar(indent int, header string) string {
+	folded := header[0] == '>'
+	chomp := byte(0)
+	rest := header[1:]
+	if rest != "" && (rest[0] == '-' || rest[0] == '+') {
+		chomp, rest = rest[0], rest[1:]
+	}
+	d.checkTail(rest)
+	var lines []string
+	trailing := 0
+	blockIndent := -1
+	for ; d.i < len(d.lines); d.i++ {
+		line := d.lines[d.i]
+		if line.blank() {
+			if blockIndent < 0 || line.indent > blockIndent {
+				d.decline()
+			}
+			trailing++
+			continue
+		}
+		if blockIndent < 0 {
+			if line.indent <= indent {
+				break
+			}
+			blockIndent = line.indent
+		}
+		if line.indent < blockIndent {
+			break
+		}
+		if line.indent > blockIndent && folded {
+			d.decline()
+		}
+		for ; trailing > 0; trailing-- {
+			lines = append(lines, "")
+		}
+		lines = append(lines, strings.Repeat(" ", line.indent-blockIndent)+line.text)
+	}
+	if len(lines) == 0 {
+		if chomp == '+' {
+			d.decline()
+		}
+		return ""
+	}
+	var s string
+	if folded {
+		// Lines are joined by spaces, and each run
+		// of blank lines between them becomes as
+		// many line breaks.
+		var buf []byte
+		breaks := 0
+		for j, line := range lines {
+			switch {
+			case line == "":
+				breaks++
+				continue
+			case breaks > 0:
+				buf = append(buf, strings.Repeat("\n", breaks)...)
+			case j > 0:
+				buf = append(buf, ' ')
+			}
+			buf = append(buf, line...)
+			breaks = 0
+		}
+		s = string(buf)
+	} else {
+		s = strings.Join(lines, "\n")
+	}
+	switch chomp {
+	case '-':
+		return s
+	case '+':
+		return s + strings.Repeat("\n", trailing+1)
+	}
+	return s + "\n"
+}
@@ -0,0 +1,271 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type SimpleYAMLSuite struct{}
+
+var _ = gc.Suite(&SimpleYAMLSuite{})
+
+// checkSimpleYAML checks that the simple decoder reports
+// whether it decodes doc as expected and that, if it does,
+// it produces the same value as yaml.v1.
+func checkSimpleYAML(c *gc.C, doc string, simple bool) {
+	v, ok := charm.DecodeSimpleYAML(doc)
+	c.Assert(ok, gc.Equals, simple, gc.Commentf("document %q", doc))
+	if !ok {
+		return
+	}
+	var expect interface{}
+	err := yaml.Unmarshal([]byte(doc), &expect)
+	c.Assert(err, gc.IsNil, gc.Commentf("document %q", doc))
+	c.Assert(v, jc.DeepEquals, expect, gc.Commentf("document %q", doc))
+}
+
+var simpleYAMLTests = []struct {
+	doc    string
+	simple bool
+}{
+	// Scalars.
+	{"a: b\n", true},
+	{"a: b c  # comment\nd: e#f\n", true},
+	{"a:\nb: ~\nc: null\n", true},
+	{"a: 1\nb: -42\nc: +7\nd: 0\ne: 123456789\n", true},
+	{"a: yes\nb: No\nc: on\nd: OFF\ne: y\nf: n\ng: true\n", true},
+	{"a: -b\nb: +c\nc: 1a\n", false},
+	{"a: -b\nb: +c\n", true},
+	{"a: 1.0\n", false},
+	{"a: 010\n", false},
+	{"a: 0x10\n", false},
+	{"a: 1_000\n", false},
+	{"a: 1234567890\n", false},
+	{"a: .5\n", false},
+	{"a: .inf\n", false},
+	{"a: 2014-01-01\n", false},
+	{"a: http://example.com/a:b\n", true},
+	{"a: b: c\n", false},
+	{"a: b:\n", false},
+	{"a: &x b\n", false},
+	{"a: *x\n", false},
+	{"a: !!str 1\n", false},
+	{"a: @b\n", false},
+	{"a: b\n  c\n", false},
+	{"a: b\n\n  # comment\nc: d\n", true},
+	{"a: \"b: c # d\"\ne: 'it''s'  # comment\n", true},
+	{"a: \"b\\\"c\\\\d\\ne\\tf\"\n", true},
+	{"a: \"\\x41\"\n", false},
+	{"a: \"\\/\"\n", false},
+	{"a: \"b\n  c\"\n", false},
+	{"a: \"b\"c\n", false},
+	{"a: \"b\"#c\n", false},
+	{"a: ''\nb: \"\"\n", true},
+	{"a: b\tc\n", false},
+	{"a: b\r\n", false},
+	{"a: caf\xc3\xa9\n", false},
+
+	// Keys.
+	{"1: a\ntrue: b\nc d: e\n", true},
+	{"~: a\n", false},
+	{"<<: a\n", false},
+	{"a: b\na: c\n", false},
+	{"\"a\": b\n", false},
+	{"? a\n: b\n", false},
+	{"a : b\n", true},
+
+	// Block collections.
+	{"a:\n  b:\n    c: d\n  e: f\ng: h\n", true},
+	{"a:\n- b\n- c\nd: e\n", true},
+	{"a:\n  - b\n  -   c\n  -\n  - # comment\n", true},
+	{"- a\n- b: c\n  d: e\n-   f: g\n    h:\n    - i\n", true},
+	{"- - a\n", false},
+	{"-\n  a: b\n", true},
+	{"a:\n  b: c\n d: e\n", false},
+	{"a:\n  b: c\n   d: e\n", false},
+	{"  a: b\n  c: d\n", true},
+	{"  a: b\nc: d\n", false},
+	{"a:\n  b\n", false},
+	{"a\n", false},
+	{"- a\nb: c\n", false},
+	{"", false},
+	{"# comment\n", false},
+	{"---\na: b\n", false},
+	{"a: b\n...\n", false},
+	{"%YAML 1.1\n---\na: b\n", false},
+
+	// Flow collections.
+	{"a: []\nb: {}\nc: [ ]\n", true},
+	{"a: [b, 1, yes, \"c, d\", 'e']\n", true},
+	{"a: {b: c, d: 1, e: \"f, g\", h: ~}  # comment\n", true},
+	{"a: [b, [c]]\n", false},
+	{"a: {b: {c: d}}\n", false},
+	{"a: [b, ]\n", false},
+	{"a: [b, c\n  d]\n", false},
+	{"a: {b}\n", false},
+	{"a: {b: }\n", false},
+	{"a: {b:c}\n", false},
+	{"a: [b: c]\n", false},
+	{"a: {b: c, b: d}\n", false},
+	{"a: [b] c\n", false},
+	{"[a]: b\n", false},
+	{"- [a, b]\n- {c: d}\n", true},
+
+	// Block scalars.
+	{"a: |\n  b\n   c\n\n  d\n\n\ne: f\n", true},
+	{"a: |-\n  b\n  c\n\ne: f\n", true},
+	{"a: |+\n  b\n  c\n\n\ne: f\n", true},
+	{"a: >\n  b\n  c\n\n  d\n\n\n  e\ne: f\n", true},
+	{"a: >-\n  b\n  c\n", true},
+	{"a: >+\n  b\n\n", true},
+	{"a: |  # comment\n  # not a comment\n  b\n", true},
+	{"- |\n  a\n- >\n  b\n  c\n", true},
+	{"- a: |\n    b\n  c: d\n", true},
+	{"a: |\nb: c\n", true},
+	{"a: |-\nb: c\n", true},
+	{"a: |+\nb: c\n", false},
+	{"a: >\n  b\n   c\n", false},
+	{"a: |2\n   b\n", false},
+	{"a: |\n\n  b\n", false},
+	{"a: |\n  b\n    \n  c\n", false},
+	{"a: |\n    b\n  c\n", false},
+	{"a: |x\n  b\n", false},
+}
+
+func (s *SimpleYAMLSuite) TestDecodeSimpleYAML(c *gc.C) {
+	for i, test := range simpleYAMLTests {
+		c.Logf("test %d: %q", i, test.doc)
+		checkSimpleYAML(c, test.doc, test.simple)
+	}
+}
+
+func (s *SimpleYAMLSuite) TestDecodeRepositoryFiles(c *gc.C) {
+	// Every YAML file in the testing repository decodes as
+	// yaml.v1 decodes it, and all the metadata and configuration
+	// is simple enough not to need yaml.v1 at all.
+	err := filepath.Walk(charmtesting.Charms.Path(), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".yaml" {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		c.Assert(err, gc.IsNil)
+		_, simple := charm.DecodeSimpleYAML(string(data))
+		switch filepath.Base(path) {
+		case "metadata.yaml", "config.yaml":
+			c.Check(simple, jc.IsTrue, gc.Commentf("%s", path))
+		}
+		checkSimpleYAML(c, string(data), simple)
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *SimpleYAMLSuite) TestReadConfigSimple(c *gc.C) {
+	// Configuration decoded without yaml.v1 is the same as
+	// that decoded with it, including the options that the
+	// simple decoder declines to convert.
+	docs := []string{
+		`
+options:
+  title:
+    default: My Title
+    description: A descriptive title used for the service.
+    type: string
+  subtitle:
+    default: ""
+    description: An optional subtitle used for the service.
+  outlook:
+    description: No default outlook.
+    # type defaults to string in python
+  skill-level:
+    description: A number indicating skill.
+    type: int
+    default: 3
+`,
+		"options:\n  title: {type: string, default: 1, description: {en: t, fr: f}}\n",
+		"options:\n  title: {type: 42}\n",
+		"options:\n  title:\n",
+		"options:\n",
+		"other: x\n",
+		"options: {}\n",
+	}
+	for i, doc := range docs {
+		c.Logf("test %d: %q", i, doc)
+		config, err := charm.ReadConfig(strings.NewReader(doc))
+		old := charm.SetYAMLCodec(goyamlCodec{})
+		expect, expectErr := charm.ReadConfig(strings.NewReader(doc))
+		charm.SetYAMLCodec(old)
+		if expectErr != nil {
+			c.Assert(err, gc.ErrorMatches, regexp.QuoteMeta(expectErr.Error()))
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(config, jc.DeepEquals, expect)
+	}
+}
+
+// goyamlCodec is a charm.YAMLCodec that always uses yaml.v1.
+type goyamlCodec struct{}
+
+func (goyamlCodec) Unmarshal(data []byte, v interface{}) error {
+	return yaml.Unmarshal(data, v)
+}
+
+func (goyamlCodec) Marshal(v interface{}) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+func benchmarkReadFile(c *gc.C, name string, codec charm.YAMLCodec, read func([]byte) error) {
+	data, err := ioutil.ReadFile(filepath.Join(charmtesting.Charms.CharmDirPath("wordpress"), name))
+	c.Assert(err, gc.IsNil)
+	if codec != nil {
+		old := charm.SetYAMLCodec(codec)
+		defer charm.SetYAMLCodec(old)
+	}
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		if err := read(data); err != nil {
+			c.Fatal(err)
+		}
+	}
+}
+
+func readMeta(data []byte) error {
+	_, err := charm.ReadMeta(bytes.NewReader(data))
+	return err
+}
+
+func readConfig(data []byte) error {
+	_, err := charm.ReadConfig(bytes.NewReader(data))
+	return err
+}
+
+func (s *SimpleYAMLSuite) BenchmarkReadMeta(c *gc.C) {
+	benchmarkReadFile(c, "metadata.yaml", nil, readMeta)
+}
+
+func (s *SimpleYAMLSuite) BenchmarkReadMetaGoyaml(c *gc.C) {
+	benchmarkReadFile(c, "metadata.yaml", goyamlCodec{}, readMeta)
+}
+
+func (s *SimpleYAMLSuite) BenchmarkReadConfig(c *gc.C) {
+	benchmarkReadFile(c, "config.yaml", nil, readConfig)
+}
+
+func (s *SimpleYAMLSuite) BenchmarkReadConfigGoyaml(c *gc.C) {
+	benchmarkReadFile(c, "config.yaml", goyamlCodec{}, readConfig)
+}
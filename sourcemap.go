@@ -0,0 +1,120 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"sort"
+	"strings"
+)
+
+// SourceRange describes where a value was found in a YAML file.
+type SourceRange struct {
+	// Line and Column hold the 1-based position of the
+	// start of the entry holding the value: its key or,
+	// for a sequence entry, the entry itself.
+	Line   int
+	Column int
+
+	// EndLine holds the last line holding the value,
+	// not counting any blank lines or comments that
+	// follow it.
+	EndLine int
+}
+
+// SourceMap holds the positions of the values in a YAML file,
+// indexed by the dot-separated path used by ParseError, such as
+// "requires.db.interface" or "tags[0]". Only values within block
+// collections are included: the elements of flow collections such
+// as "[a, b]" are part of the value holding them.
+type SourceMap map[string]SourceRange
+
+// Find returns the range of the value with the given path or,
+// if it is not in the map, of its closest ancestor that is. It
+// returns false if neither the value nor any ancestor is found.
+func (m SourceMap) Find(path string) (SourceRange, bool) {
+	for path != "" {
+		if r, ok := m[path]; ok {
+			return r, true
+		}
+		if i := strings.LastIndexAny(path, ".["); i >= 0 {
+			path = path[:i]
+		} else {
+			path = ""
+		}
+	}
+	return SourceRange{}, false
+}
+
+// MetaSourceMap returns the positions in the charm's metadata.yaml
+// file of the values of its metadata, so that tools checking the
+// metadata can point at the place a problem was found. It returns nil
+// once the metadata has been changed by SetMeta.
+func (dir *CharmDir) MetaSourceMap() SourceMap {
+	return dir.metaSourceMap
+}
+
+// MetaSourceMap returns the positions in the charm's metadata.yaml
+// file of the values of its metadata, so that tools checking the
+// metadata can point at the place a problem was found.
+func (a *CharmArchive) MetaSourceMap() SourceMap {
+	return a.metaSourceMap
+}
+
+// yamlSourceMap returns the source map of
+// the YAML document held in data.
+func yamlSourceMap(data []byte) SourceMap {
+	positions := yamlPositions(data)
+	paths := make([]string, 0, len(positions))
+	for path := range positions {
+		paths = append(paths, path)
+	}
+	sort.Sort(pathsByPosition{paths, positions})
+	lines := strings.Split(string(data), "\n")
+	m := make(SourceMap)
+	for i, path := range paths {
+		pos := positions[path]
+		// The value extends to the entry that
+		// follows it that it does not enclose.
+		end := len(lines)
+		for _, next := range paths[i+1:] {
+			if !strings.HasPrefix(next, path+".") && !strings.HasPrefix(next, path+"[") {
+				end = positions[next].line - 1
+				break
+			}
+		}
+		for end > pos.line && !isYAMLContent(lines[end-1]) {
+			end--
+		}
+		m[path] = SourceRange{
+			Line:    pos.line,
+			Column:  pos.column,
+			EndLine: end,
+		}
+	}
+	return m
+}
+
+// isYAMLContent reports whether the given line of
+// a YAML document holds anything but a comment.
+func isYAMLContent(line string) bool {
+	line = strings.TrimSpace(line)
+	return line != "" && line[0] != '#'
+}
+
+// pathsByPosition sorts paths by the position
+// of their values in a YAML document.
+type pathsByPosition struct {
+	paths     []string
+	positions map[string]yamlPos
+}
+
+func (s pathsByPosition) Len() int      { return len(s.paths) }
+func (s pathsByPosition) Swap(i, j int) { s.paths[i], s.paths[j] = s.paths[j], s.paths[i] }
+func (s pathsByPosition) Less(i, j int) bool {
+	pi, pj := s.positions[s.paths[i]], s.positions[s.paths[j]]
+	if pi.line != pj.line {
+		return pi.line < pj.line
+	}
+	return pi.column < pj.column
+}
@@ -0,0 +1,104 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type SourceMapSuite struct{}
+
+var _ = gc.Suite(&SourceMapSuite{})
+
+const sourceMapMeta = `name: mapped
+summary: s
+description: |
+    A description
+    over two lines.
+# The relations.
+provides:
+  url: http
+requires:
+  db:
+    interface: mysql
+    limit: 1
+
+  # Comments after a value are not part of it.
+  cache: memcache
+tags:
+  - web
+  - blog
+series: trusty
+`
+
+func (s *SourceMapSuite) TestSourceMap(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	writeCharmFile(c, dir.Path, "metadata.yaml", sourceMapMeta, 0644)
+	dir, err := charm.ReadCharmDir(dir.Path)
+	c.Assert(err, gc.IsNil)
+	expect := charm.SourceMap{
+		"name":                  {1, 1, 1},
+		"summary":               {2, 1, 2},
+		"description":           {3, 1, 5},
+		"provides":              {7, 1, 8},
+		"provides.url":          {8, 3, 8},
+		"requires":              {9, 1, 15},
+		"requires.db":           {10, 3, 12},
+		"requires.db.interface": {11, 5, 11},
+		"requires.db.limit":     {12, 5, 12},
+		"requires.cache":        {15, 3, 15},
+		"tags":                  {16, 1, 18},
+		"tags[0]":               {17, 5, 17},
+		"tags[1]":               {18, 5, 18},
+		"series":                {19, 1, 19},
+	}
+	c.Assert(dir.MetaSourceMap(), jc.DeepEquals, expect)
+
+	// The archived charm has the same source map,
+	// and its metadata is equal to that of the directory.
+	archive := archiveDir(c, dir.Path)
+	c.Assert(archive.MetaSourceMap(), jc.DeepEquals, expect)
+	c.Assert(archive.Meta(), jc.DeepEquals, dir.Meta())
+}
+
+func (s *SourceMapSuite) TestFind(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	writeCharmFile(c, dir.Path, "metadata.yaml", sourceMapMeta, 0644)
+	dir, err := charm.ReadCharmDir(dir.Path)
+	c.Assert(err, gc.IsNil)
+	m := dir.MetaSourceMap()
+	r, ok := m.Find("requires.db.scope")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(r, gc.Equals, charm.SourceRange{Line: 10, Column: 3, EndLine: 12})
+	r, ok = m.Find("tags[1]")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(r, gc.Equals, charm.SourceRange{Line: 18, Column: 5, EndLine: 18})
+	_, ok = m.Find("peers.ring")
+	c.Assert(ok, jc.IsFalse)
+}
+
+func (s *SourceMapSuite) TestReadMetaWithSourceMap(c *gc.C) {
+	meta, m, err := charm.ReadMetaWithSourceMap(strings.NewReader(sourceMapMeta))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Name, gc.Equals, "mapped")
+	c.Assert(m["requires.db.limit"], gc.Equals, charm.SourceRange{Line: 12, Column: 5, EndLine: 12})
+
+	_, m, err = charm.ReadMetaWithSourceMap(strings.NewReader("name: [\n"))
+	c.Assert(err, gc.NotNil)
+	c.Assert(m, gc.IsNil)
+}
+
+func (s *SourceMapSuite) TestSetMetaDropsSourceMap(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	c.Assert(dir.MetaSourceMap(), gc.NotNil)
+	meta := *dir.Meta()
+	dir.SetMeta(&meta)
+	c.Assert(dir.MetaSourceMap(), gc.IsNil)
+}
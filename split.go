@@ -0,0 +1,115 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// SplitIndex describes a charm archive split into parts by
+// SplitArchive. It is sent along with the parts so that each
+// part can be verified as it arrives, and the archive
+// reassembled with JoinArchive.
+type SplitIndex struct {
+	// Size holds the size of the archive in bytes.
+	Size int64 `json:"size"`
+
+	// SHA256 holds the hex-encoded SHA256 digest of the archive.
+	SHA256 string `json:"sha256"`
+
+	// Parts describes the parts of the archive, in order.
+	Parts []SplitPart `json:"parts"`
+}
+
+// SplitPart describes a part of a split charm archive.
+type SplitPart struct {
+	// Size holds the size of the part in bytes.
+	Size int64 `json:"size"`
+
+	// SHA256 holds the hex-encoded SHA256 digest of the part.
+	SHA256 string `json:"sha256"`
+}
+
+// SplitArchive splits the given charm archive into parts holding at
+// most partSize bytes each, for sending over transports that limit
+// the size of the data they carry. It returns the parts along with
+// an index describing them.
+func SplitArchive(a *CharmArchive, partSize int64) (*SplitIndex, [][]byte, error) {
+	if partSize <= 0 {
+		return nil, nil, fmt.Errorf("invalid part size %d", partSize)
+	}
+	r, err := a.zopen.open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	index := &SplitIndex{}
+	var parts [][]byte
+	h := sha256.New()
+	for {
+		var buf bytes.Buffer
+		n, err := io.CopyN(&buf, r, partSize)
+		if n > 0 {
+			part := buf.Bytes()
+			h.Write(part)
+			parts = append(parts, part)
+			index.Parts = append(index.Parts, SplitPart{
+				Size:   n,
+				SHA256: sha256Hex(part),
+			})
+			index.Size += n
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	index.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return index, parts, nil
+}
+
+// VerifyPart checks that the given data is the part of the
+// archive with the given index, counting from zero.
+func (index *SplitIndex) VerifyPart(i int, data []byte) error {
+	if i < 0 || i >= len(index.Parts) {
+		return fmt.Errorf("archive has no part %d", i)
+	}
+	part := index.Parts[i]
+	if int64(len(data)) != part.Size || sha256Hex(data) != part.SHA256 {
+		return fmt.Errorf("part %d is corrupt", i)
+	}
+	return nil
+}
+
+// JoinArchive reassembles a charm archive from the parts
+// described by the given index, verifying each part and the
+// resulting archive.
+func JoinArchive(index *SplitIndex, parts [][]byte) (*CharmArchive, error) {
+	if len(parts) != len(index.Parts) {
+		return nil, fmt.Errorf("cannot join archive: expected %d parts, got %d", len(index.Parts), len(parts))
+	}
+	var buf bytes.Buffer
+	for i, part := range parts {
+		if err := index.VerifyPart(i, part); err != nil {
+			return nil, fmt.Errorf("cannot join archive: %v", err)
+		}
+		buf.Write(part)
+	}
+	data := buf.Bytes()
+	if int64(len(data)) != index.Size || sha256Hex(data) != index.SHA256 {
+		return nil, fmt.Errorf("cannot join archive: archive does not match index")
+	}
+	return ReadCharmArchiveBytes(data)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,101 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type SplitSuite struct{}
+
+var _ = gc.Suite(&SplitSuite{})
+
+func (s *SplitSuite) TestSplitAndJoin(c *gc.C) {
+	path := charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+
+	index, parts, err := charm.SplitArchive(archive, 1000)
+	c.Assert(err, gc.IsNil)
+	c.Assert(index.Size, gc.Equals, int64(len(data)))
+	c.Assert(index.SHA256, gc.Equals, digestOf(data))
+	c.Assert(parts, gc.HasLen, (len(data)+999)/1000)
+	c.Assert(index.Parts, gc.HasLen, len(parts))
+	c.Assert(bytes.Join(parts, nil), jc.DeepEquals, data)
+	for i, part := range parts {
+		c.Assert(len(part) <= 1000, jc.IsTrue)
+		c.Assert(index.VerifyPart(i, part), gc.IsNil)
+	}
+
+	// The index survives a round trip through JSON.
+	indexData, err := json.Marshal(index)
+	c.Assert(err, gc.IsNil)
+	var index2 charm.SplitIndex
+	err = json.Unmarshal(indexData, &index2)
+	c.Assert(err, gc.IsNil)
+
+	joined, err := charm.JoinArchive(&index2, parts)
+	c.Assert(err, gc.IsNil)
+	c.Assert(joined.Meta().Name, gc.Equals, "dummy")
+	c.Assert(joined.Revision(), gc.Equals, 1)
+}
+
+func (s *SplitSuite) TestSplitArchiveFromBytes(c *gc.C) {
+	data, err := ioutil.ReadFile(charmtesting.Charms.CharmArchivePath(c.MkDir(), "dummy"))
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	index, parts, err := charm.SplitArchive(archive, int64(len(data)))
+	c.Assert(err, gc.IsNil)
+	c.Assert(parts, gc.HasLen, 1)
+	c.Assert(index.SHA256, gc.Equals, digestOf(data))
+}
+
+func (s *SplitSuite) TestSplitArchiveInvalidPartSize(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	_, _, err := charm.SplitArchive(archive, 0)
+	c.Assert(err, gc.ErrorMatches, "invalid part size 0")
+}
+
+func (s *SplitSuite) TestJoinArchiveErrors(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	index, parts, err := charm.SplitArchive(archive, 1000)
+	c.Assert(err, gc.IsNil)
+
+	_, err = charm.JoinArchive(index, parts[1:])
+	c.Assert(err, gc.ErrorMatches, `cannot join archive: expected \d+ parts, got \d+`)
+
+	corrupt := make([][]byte, len(parts))
+	copy(corrupt, parts)
+	corrupt[1] = append([]byte(nil), parts[1]...)
+	corrupt[1][0] ^= 0xff
+	_, err = charm.JoinArchive(index, corrupt)
+	c.Assert(err, gc.ErrorMatches, `cannot join archive: part 1 is corrupt`)
+
+	// Swapping parts of equal size is detected too.
+	swapped := make([][]byte, len(parts))
+	copy(swapped, parts)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	_, err = charm.JoinArchive(index, swapped)
+	c.Assert(err, gc.ErrorMatches, `cannot join archive: part 0 is corrupt`)
+
+	err = index.VerifyPart(len(parts), nil)
+	c.Assert(err, gc.ErrorMatches, `archive has no part \d+`)
+
+	// A tampered index is detected.
+	tampered := *index
+	tampered.SHA256 = digestOf(nil)
+	_, err = charm.JoinArchive(&tampered, parts)
+	c.Assert(err, gc.ErrorMatches, `cannot join archive: archive does not match index`)
+}
@@ -0,0 +1,590 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The following constants describe the squashfs 4.0 format.
+const (
+	squashfsMagic          = 0x73717368
+	squashfsBlockLog       = 17
+	squashfsBlockSize      = 1 << squashfsBlockLog
+	squashfsMetadataSize   = 8192
+	squashfsSuperblockSize = 96
+	squashfsDeviceSize     = 4096
+	squashfsGzip           = 1
+	squashfsNoFragments    = 0x0010
+	squashfsNoXattrs       = 0x0200
+	squashfsInvalidBlock   = 0xffffffffffffffff
+	squashfsInvalidFrag    = 0xffffffff
+	squashfsDirEntries     = 256
+	squashfsMaxNameLen     = 256
+
+	// squashfsMetadataUncompressed is set in the header
+	// of a metadata block that is stored uncompressed.
+	squashfsMetadataUncompressed = 0x8000
+
+	// squashfsDataUncompressed is set in the size
+	// of a data block that is stored uncompressed.
+	squashfsDataUncompressed = 1 << 24
+
+	squashfsDirType     = 1
+	squashfsFileType    = 2
+	squashfsSymlinkType = 3
+)
+
+// WriteSquashFS writes a squashfs image of the given charm, which
+// must be a *CharmDir or a *CharmArchive, to w. The image holds the
+// charm as ExpandTo would expand it, with its hooks and actions
+// executable and a revision file holding the charm's revision, so
+// that it can be loop-mounted read-only in place of expanding the
+// charm. Data and metadata are compressed with gzip; all files are
+// owned by root.
+//
+// The image is built in memory, and the same charm always produces
+// the same image.
+func WriteSquashFS(ch Charm, w io.Writer) error {
+	if err := writeSquashFS(ch, w); err != nil {
+		return fmt.Errorf("cannot write squashfs image: %v", err)
+	}
+	return nil
+}
+
+func writeSquashFS(ch Charm, w io.Writer) error {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return err
+	}
+	defer zipr.Close()
+	tree, err := newSquashfsTree(ch, zipr.File)
+	if err != nil {
+		return err
+	}
+	sw := &squashfsWriter{
+		modTime: tree.modTime,
+	}
+	sw.number(tree.root)
+	if err := sw.writeDir(tree.root, sw.count+1); err != nil {
+		return err
+	}
+	return sw.writeImage(w, tree.root.ref)
+}
+
+// squashfsNode holds a file, directory or symbolic
+// link to be written to a squashfs image.
+type squashfsNode struct {
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+
+	// file holds the archive member holding the contents of
+	// the node. If it is nil, the contents, or the target of
+	// a symbolic link, are in data.
+	file *zip.File
+	data []byte
+
+	children []*squashfsNode
+	inode    uint32
+	ref      uint64
+}
+
+// open returns a reader of the node's contents.
+func (n *squashfsNode) open() (io.ReadCloser, error) {
+	if n.file == nil {
+		return ioutil.NopCloser(bytes.NewReader(n.data)), nil
+	}
+	return n.file.Open()
+}
+
+// squashfsTree holds the tree of nodes of a squashfs image.
+type squashfsTree struct {
+	root    *squashfsNode
+	dirs    map[string]*squashfsNode
+	modTime time.Time
+}
+
+// newSquashfsTree returns the tree of nodes of an image
+// of the charm ch, whose archive holds the given files.
+func newSquashfsTree(ch Charm, files []*zip.File) (*squashfsTree, error) {
+	t := &squashfsTree{
+		root: &squashfsNode{mode: os.ModeDir | 0755},
+		dirs: make(map[string]*squashfsNode),
+	}
+	actions := ch.Actions()
+	if a, ok := ch.(*CharmArchive); ok {
+		var err error
+		if actions, err = a.LoadActions(); err != nil {
+			return nil, err
+		}
+	}
+	executables := map[string]map[string]bool{
+		HooksDir:   ch.Meta().Hooks(),
+		ActionsDir: actionNames(actions),
+	}
+	// As when the charm is expanded, the files that hooks and
+	// actions link to are made executable in their stead.
+	linkTargets := make(map[string]bool)
+	byName := zipFilesByName(files)
+	for _, fh := range files {
+		name := path.Clean(fh.Name)
+		if fh.Mode()&os.ModeSymlink == 0 || !executables[path.Dir(name)][path.Base(name)] {
+			continue
+		}
+		target, err := resolveZipLink(byName, fh)
+		if err != nil {
+			// Dangling links are left alone.
+			continue
+		}
+		if target.Mode().IsRegular() {
+			linkTargets[path.Clean(target.Name)] = true
+		}
+	}
+	for _, fh := range files {
+		name := path.Clean(strings.TrimSuffix(fh.Name, "/"))
+		if name == "." || name == RevisionFile {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("invalid path %q", fh.Name)
+		}
+		if fh.ModTime().After(t.modTime) {
+			t.modTime = fh.ModTime()
+		}
+		mode := fh.Mode()
+		switch mode & os.ModeType {
+		case os.ModeDir:
+			dir := t.dir(name)
+			dir.mode = mode
+			dir.modTime = fh.ModTime()
+			continue
+		case os.ModeSymlink:
+			target, err := readZipFile(fh)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkSymlinkTarget("", name, string(target)); err != nil {
+				return nil, err
+			}
+			t.add(name, &squashfsNode{
+				mode:    mode,
+				modTime: fh.ModTime(),
+				data:    target,
+			})
+			continue
+		case 0:
+			if executables[path.Dir(name)][path.Base(name)] || linkTargets[name] {
+				mode |= 0100
+			}
+		default:
+			return nil, fmt.Errorf("file has an unknown type: %q", name)
+		}
+		t.add(name, &squashfsNode{
+			mode:    mode,
+			modTime: fh.ModTime(),
+			file:    fh,
+		})
+	}
+	t.add(RevisionFile, &squashfsNode{
+		mode:    0644,
+		modTime: t.modTime,
+		data:    []byte(strconv.Itoa(ch.Revision())),
+	})
+	return t, t.root.sort()
+}
+
+// dir returns the directory node with the given path,
+// creating it and its parents if necessary.
+func (t *squashfsTree) dir(name string) *squashfsNode {
+	if name == "." {
+		return t.root
+	}
+	if dir, ok := t.dirs[name]; ok {
+		return dir
+	}
+	dir := &squashfsNode{mode: os.ModeDir | 0755}
+	t.add(name, dir)
+	t.dirs[name] = dir
+	return dir
+}
+
+// add adds the given node to the tree at the given path.
+func (t *squashfsTree) add(name string, n *squashfsNode) {
+	n.name = path.Base(name)
+	parent := t.dir(path.Dir(name))
+	parent.children = append(parent.children, n)
+}
+
+// sort sorts the children of the directory node n
+// and its subdirectories by name, as squashfs
+// requires.
+func (n *squashfsNode) sort() error {
+	sort.Sort(squashfsNodesByName(n.children))
+	for i, child := range n.children {
+		if i > 0 && child.name == n.children[i-1].name {
+			return fmt.Errorf("duplicate entry %q", child.name)
+		}
+		if len(child.name) > squashfsMaxNameLen {
+			return fmt.Errorf("name too long: %q", child.name)
+		}
+		if child.mode.IsDir() {
+			if err := child.sort(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type squashfsNodesByName []*squashfsNode
+
+func (s squashfsNodesByName) Len() int           { return len(s) }
+func (s squashfsNodesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s squashfsNodesByName) Less(i, j int) bool { return s[i].name < s[j].name }
+
+// squashfsWriter accumulates the tables of a squashfs image.
+type squashfsWriter struct {
+	modTime time.Time
+	count   uint32
+	data    bytes.Buffer
+	inodes  squashfsMetadata
+	dirs    squashfsMetadata
+}
+
+// number numbers the inodes of the directory node n and
+// everything beneath it in the order they are written.
+func (w *squashfsWriter) number(n *squashfsNode) {
+	for _, child := range n.children {
+		if child.mode.IsDir() {
+			w.number(child)
+		} else {
+			w.count++
+			child.inode = w.count
+		}
+	}
+	w.count++
+	n.inode = w.count
+}
+
+// writeDir writes the directory node n and everything beneath it,
+// leaving the node's inode last, as its directory listing must refer
+// to the inodes of its children.
+func (w *squashfsWriter) writeDir(n *squashfsNode, parent uint32) error {
+	links := 2
+	for _, child := range n.children {
+		var err error
+		switch child.mode & os.ModeType {
+		case os.ModeDir:
+			links++
+			err = w.writeDir(child, n.inode)
+		case os.ModeSymlink:
+			w.writeSymlink(child)
+		default:
+			err = w.writeFile(child)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	listing := w.dirs.pos()
+	size := w.writeListing(n.children) + 3
+	if size > 0xffff {
+		return fmt.Errorf("directory %q has too many entries", n.name)
+	}
+	n.ref = w.inodes.pos()
+	b := w.inodeHeader(squashfsDirType, n)
+	b = appendUint32(b, uint32(listing>>16))
+	b = appendUint32(b, uint32(links))
+	b = appendUint16(b, uint16(size))
+	b = appendUint16(b, uint16(listing))
+	b = appendUint32(b, parent)
+	w.inodes.Write(b)
+	return nil
+}
+
+// writeListing writes a directory listing holding the given nodes
+// and returns its size.
+func (w *squashfsWriter) writeListing(nodes []*squashfsNode) int {
+	var b []byte
+	for i := 0; i < len(nodes); {
+		start, base := nodes[i].ref>>16, nodes[i].inode
+		j := i + 1
+		for j < len(nodes) && j-i < squashfsDirEntries && nodes[j].ref>>16 == start {
+			if delta := int64(nodes[j].inode) - int64(base); delta < -0x8000 || delta > 0x7fff {
+				break
+			}
+			j++
+		}
+		b = appendUint32(b, uint32(j-i-1))
+		b = appendUint32(b, uint32(start))
+		b = appendUint32(b, base)
+		for _, n := range nodes[i:j] {
+			b = appendUint16(b, uint16(n.ref))
+			b = appendUint16(b, uint16(int16(int64(n.inode)-int64(base))))
+			b = appendUint16(b, squashfsType(n.mode))
+			b = appendUint16(b, uint16(len(n.name)-1))
+			b = append(b, n.name...)
+		}
+		i = j
+	}
+	w.dirs.Write(b)
+	return len(b)
+}
+
+// writeFile writes the contents and inode of the file node n.
+func (w *squashfsWriter) writeFile(n *squashfsNode) error {
+	r, err := n.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	start := uint64(squashfsSuperblockSize + w.data.Len())
+	var size uint64
+	var sizes []uint32
+	buf := make([]byte, squashfsBlockSize)
+	for {
+		nr, err := io.ReadFull(r, buf)
+		if nr > 0 {
+			block, compressed := squashfsCompress(buf[:nr])
+			w.data.Write(block)
+			blockSize := uint32(len(block))
+			if !compressed {
+				blockSize |= squashfsDataUncompressed
+			}
+			sizes = append(sizes, blockSize)
+			size += uint64(nr)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read %q: %v", n.name, err)
+		}
+	}
+	if start+size > 0xffffffff {
+		return fmt.Errorf("charm too large")
+	}
+	n.ref = w.inodes.pos()
+	b := w.inodeHeader(squashfsFileType, n)
+	b = appendUint32(b, uint32(start))
+	b = appendUint32(b, squashfsInvalidFrag)
+	b = appendUint32(b, 0)
+	b = appendUint32(b, uint32(size))
+	for _, blockSize := range sizes {
+		b = appendUint32(b, blockSize)
+	}
+	w.inodes.Write(b)
+	return nil
+}
+
+// writeSymlink writes the inode of the symbolic link node n.
+func (w *squashfsWriter) writeSymlink(n *squashfsNode) {
+	n.ref = w.inodes.pos()
+	b := w.inodeHeader(squashfsSymlinkType, n)
+	b = appendUint32(b, 1)
+	b = appendUint32(b, uint32(len(n.data)))
+	b = append(b, n.data...)
+	w.inodes.Write(b)
+}
+
+// inodeHeader returns the header of an
+// inode of the given type for node n.
+func (w *squashfsWriter) inodeHeader(inodeType uint16, n *squashfsNode) []byte {
+	var b []byte
+	b = appendUint16(b, inodeType)
+	b = appendUint16(b, squashfsPerm(n.mode))
+	b = appendUint16(b, 0)
+	b = appendUint16(b, 0)
+	b = appendUint32(b, w.unixTime(n.modTime))
+	b = appendUint32(b, n.inode)
+	return b
+}
+
+// unixTime returns t as a squashfs time, using the
+// time of the image if t cannot be represented.
+func (w *squashfsWriter) unixTime(t time.Time) uint32 {
+	if t.IsZero() || t.Unix() < 0 || t.Unix() > 0xffffffff {
+		t = w.modTime
+	}
+	if t.Unix() < 0 || t.Unix() > 0xffffffff {
+		return 0
+	}
+	return uint32(t.Unix())
+}
+
+// writeImage writes the complete image, with the
+// root inode at the given reference, to out.
+func (w *squashfsWriter) writeImage(out io.Writer, root uint64) error {
+	inodeTable := w.inodes.finish()
+	dirTable := w.dirs.finish()
+	// There is a single id, 0, used as
+	// the owner and group of every inode.
+	var ids squashfsMetadata
+	ids.Write(appendUint32(nil, 0))
+	idTable := ids.finish()
+
+	inodeStart := uint64(squashfsSuperblockSize + w.data.Len())
+	dirStart := inodeStart + uint64(len(inodeTable))
+	idStart := dirStart + uint64(len(dirTable))
+	idIndexStart := idStart + uint64(len(idTable))
+	bytesUsed := idIndexStart + 8
+
+	var sb []byte
+	sb = appendUint32(sb, squashfsMagic)
+	sb = appendUint32(sb, w.count)
+	sb = appendUint32(sb, w.unixTime(w.modTime))
+	sb = appendUint32(sb, squashfsBlockSize)
+	sb = appendUint32(sb, 0)
+	sb = appendUint16(sb, squashfsGzip)
+	sb = appendUint16(sb, squashfsBlockLog)
+	sb = appendUint16(sb, squashfsNoFragments|squashfsNoXattrs)
+	sb = appendUint16(sb, 1)
+	sb = appendUint16(sb, 4)
+	sb = appendUint16(sb, 0)
+	sb = appendUint64(sb, root)
+	sb = appendUint64(sb, bytesUsed)
+	sb = appendUint64(sb, idIndexStart)
+	sb = appendUint64(sb, squashfsInvalidBlock)
+	sb = appendUint64(sb, inodeStart)
+	sb = appendUint64(sb, dirStart)
+	sb = appendUint64(sb, squashfsInvalidBlock)
+	sb = appendUint64(sb, squashfsInvalidBlock)
+
+	// The image is padded to a whole number of device blocks
+	// so that it can be mounted through a loop device.
+	padding := make([]byte, (squashfsDeviceSize-bytesUsed%squashfsDeviceSize)%squashfsDeviceSize)
+	for _, part := range [][]byte{
+		sb,
+		w.data.Bytes(),
+		inodeTable,
+		dirTable,
+		idTable,
+		appendUint64(nil, idStart),
+		padding,
+	} {
+		if _, err := out.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// squashfsMetadata accumulates a squashfs metadata table,
+// which is stored as a sequence of blocks each holding
+// up to 8KiB of data.
+type squashfsMetadata struct {
+	out bytes.Buffer
+	buf []byte
+}
+
+// pos returns a reference to the current position in the table:
+// the offset of the current block from the start of the table
+// in the upper bits and the offset within the block in the lower
+// 16 bits.
+func (m *squashfsMetadata) pos() uint64 {
+	return uint64(m.out.Len())<<16 | uint64(len(m.buf))
+}
+
+// Write appends p to the table. It never returns an error.
+func (m *squashfsMetadata) Write(p []byte) (int, error) {
+	m.buf = append(m.buf, p...)
+	for len(m.buf) >= squashfsMetadataSize {
+		m.flush(squashfsMetadataSize)
+	}
+	return len(p), nil
+}
+
+// flush writes a block holding the first n bytes of data.
+func (m *squashfsMetadata) flush(n int) {
+	block, compressed := squashfsCompress(m.buf[:n])
+	header := uint16(len(block))
+	if !compressed {
+		header |= squashfsMetadataUncompressed
+	}
+	m.out.Write(appendUint16(nil, header))
+	m.out.Write(block)
+	m.buf = append(m.buf[:0], m.buf[n:]...)
+}
+
+// finish returns the complete table.
+func (m *squashfsMetadata) finish() []byte {
+	if len(m.buf) > 0 {
+		m.flush(len(m.buf))
+	}
+	return m.out.Bytes()
+}
+
+// squashfsCompress returns p compressed, reporting whether it
+// was, or p itself if compression would not make it smaller.
+func squashfsCompress(p []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		panic(err)
+	}
+	zw.Write(p)
+	zw.Close()
+	if buf.Len() >= len(p) {
+		return p, false
+	}
+	return buf.Bytes(), true
+}
+
+// squashfsType returns the basic squashfs
+// inode type for a file of the given mode.
+func squashfsType(mode os.FileMode) uint16 {
+	switch mode & os.ModeType {
+	case os.ModeDir:
+		return squashfsDirType
+	case os.ModeSymlink:
+		return squashfsSymlinkType
+	}
+	return squashfsFileType
+}
+
+// squashfsPerm returns the Unix permission bits of the given mode.
+func squashfsPerm(mode os.FileMode) uint16 {
+	perm := uint16(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return perm
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,288 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type SquashFSSuite struct{}
+
+var _ = gc.Suite(&SquashFSSuite{})
+
+func (s *SquashFSSuite) TestWriteSquashFSArchive(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	archive.SetRevision(42)
+	var buf bytes.Buffer
+	err := charm.WriteSquashFS(archive, &buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(buf.Len()%4096, gc.Equals, 0)
+
+	// The image holds the charm as it is expanded.
+	dir := c.MkDir()
+	err = archive.ExpandTo(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(readSquashFS(c, buf.Bytes()), jc.DeepEquals, readExpandedDir(c, dir))
+}
+
+func (s *SquashFSSuite) TestWriteSquashFSDir(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	// Add a file spanning several blocks, and enough
+	// files to span several metadata blocks.
+	big := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+	writeCharmFile(c, dir.Path, "data/big", string(big), 0644)
+	for i := 0; i < 400; i++ {
+		name := fmt.Sprintf("%s%03d", strings.Repeat("x", 40), i)
+		writeCharmFile(c, dir.Path, "many/"+name, name, 0644)
+	}
+	var buf bytes.Buffer
+	err := charm.WriteSquashFS(dir, &buf)
+	c.Assert(err, gc.IsNil)
+	files := readSquashFS(c, buf.Bytes())
+	c.Assert(files["data/big"] == "-rw-r--r-- "+string(big), gc.Equals, true)
+	c.Assert(files["many"], gc.Equals, "drwxr-xr-x")
+	for i := 0; i < 400; i++ {
+		name := fmt.Sprintf("%s%03d", strings.Repeat("x", 40), i)
+		c.Assert(files["many/"+name], gc.Equals, "-rw-r--r-- "+name)
+	}
+	c.Assert(files["revision"], gc.Equals, "-rw-r--r-- 1")
+	c.Assert(files["hooks/install"], gc.Matches, `(?s)-rwx.*`)
+
+	// The same charm always produces the same image.
+	var again bytes.Buffer
+	err = charm.WriteSquashFS(dir, &again)
+	c.Assert(err, gc.IsNil)
+	c.Assert(again.Bytes(), jc.DeepEquals, buf.Bytes())
+}
+
+func (s *SquashFSSuite) TestWriteSquashFSSymlinks(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	err := os.Symlink("../config.yaml", filepath.Join(dir.Path, "hooks", "config"))
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	err = charm.WriteSquashFS(dir, &buf)
+	c.Assert(err, gc.IsNil)
+	files := readSquashFS(c, buf.Bytes())
+	c.Assert(files["hooks/config"], gc.Equals, "Lrwxrwxrwx ../config.yaml")
+}
+
+func (s *SquashFSSuite) TestWriteSquashFSLinkedHooks(c *gc.C) {
+	// Every hook links to a single script that
+	// is not itself marked executable.
+	var zipData bytes.Buffer
+	zipw := zip.NewWriter(&zipData)
+	add := func(name string, mode os.FileMode, data string) {
+		h := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		h.SetMode(mode)
+		w, err := zipw.CreateHeader(h)
+		c.Assert(err, gc.IsNil)
+		_, err = w.Write([]byte(data))
+		c.Assert(err, gc.IsNil)
+	}
+	add("metadata.yaml", 0644, "name: linked\nsummary: s\ndescription: d\n")
+	add("src/", os.ModeDir|0755, "")
+	add("src/hook.sh", 0644, "#!/bin/sh\n")
+	add("hooks/", os.ModeDir|0755, "")
+	for _, hook := range []string{"install", "start", "stop", "upgrade-charm"} {
+		add("hooks/"+hook, os.ModeSymlink|0777, "../src/hook.sh")
+	}
+	c.Assert(zipw.Close(), gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(zipData.Bytes())
+	c.Assert(err, gc.IsNil)
+
+	var buf bytes.Buffer
+	err = charm.WriteSquashFS(archive, &buf)
+	c.Assert(err, gc.IsNil)
+	files := readSquashFS(c, buf.Bytes())
+	c.Assert(files["src/hook.sh"], gc.Equals, "-rwxr--r-- #!/bin/sh\n")
+	c.Assert(files["hooks/install"], gc.Equals, "Lrwxrwxrwx ../src/hook.sh")
+
+	// The image holds the charm as it is expanded.
+	dir := c.MkDir()
+	err = archive.ExpandTo(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(files, jc.DeepEquals, readExpandedDir(c, dir))
+}
+
+// readExpandedDir returns a description of each
+// file beneath dir, in the form of readSquashFS.
+func readExpandedDir(c *gc.C, dir string) map[string]string {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		c.Assert(err, gc.IsNil)
+		rel, err := filepath.Rel(dir, path)
+		c.Assert(err, gc.IsNil)
+		if rel == "." || rel == ".charm-digest" {
+			return nil
+		}
+		desc := info.Mode().String()
+		switch {
+		case info.Mode().IsRegular():
+			data, err := ioutil.ReadFile(path)
+			c.Assert(err, gc.IsNil)
+			desc += " " + string(data)
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			c.Assert(err, gc.IsNil)
+			desc += " " + target
+		}
+		files[filepath.ToSlash(rel)] = desc
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+	return files
+}
+
+// readSquashFS reads the squashfs image held in img, returning a
+// description of each file in it, holding its mode followed by the
+// contents of regular files and the targets of symbolic links.
+func readSquashFS(c *gc.C, img []byte) map[string]string {
+	var sb struct {
+		Magic, Inodes, ModTime, BlockSize, Fragments uint32
+		Compression, BlockLog, Flags, Ids            uint16
+		Major, Minor                                 uint16
+		Root, BytesUsed, IdTable, XattrTable         uint64
+		InodeTable, DirTable, FragTable, ExportTable uint64
+	}
+	err := binary.Read(bytes.NewReader(img), binary.LittleEndian, &sb)
+	c.Assert(err, gc.IsNil)
+	c.Assert(sb.Magic, gc.Equals, uint32(0x73717368))
+	c.Assert(sb.Major, gc.Equals, uint16(4))
+	c.Assert(sb.Ids, gc.Equals, uint16(1))
+	c.Assert(sb.BlockSize, gc.Equals, uint32(1)<<sb.BlockLog)
+	idStart := binary.LittleEndian.Uint64(img[sb.IdTable:])
+	r := &squashfsReader{
+		c:         c,
+		img:       img,
+		blockSize: sb.BlockSize,
+		inodes:    readSquashFSMetadata(c, img[sb.InodeTable:sb.DirTable]),
+		dirs:      readSquashFSMetadata(c, img[sb.DirTable:idStart]),
+		files:     make(map[string]string),
+	}
+	r.readDir("", sb.Root)
+	c.Assert(r.count, gc.Equals, int(sb.Inodes))
+	return r.files
+}
+
+type squashfsReader struct {
+	c         *gc.C
+	img       []byte
+	blockSize uint32
+	inodes    squashfsMetadata
+	dirs      squashfsMetadata
+	files     map[string]string
+	count     int
+}
+
+// squashfsMetadata holds the decompressed contents of a metadata
+// table, and the position in them of each block of the table.
+type squashfsMetadata struct {
+	data   []byte
+	blocks map[uint64]int
+}
+
+func readSquashFSMetadata(c *gc.C, table []byte) squashfsMetadata {
+	m := squashfsMetadata{blocks: make(map[uint64]int)}
+	for pos := 0; pos < len(table); {
+		m.blocks[uint64(pos)] = len(m.data)
+		header := binary.LittleEndian.Uint16(table[pos:])
+		size := int(header &^ 0x8000)
+		block := table[pos+2 : pos+2+size]
+		if header&0x8000 == 0 {
+			block = decompress(c, block)
+		}
+		c.Assert(len(block) <= 8192, gc.Equals, true)
+		m.data = append(m.data, block...)
+		pos += 2 + size
+	}
+	return m
+}
+
+// at returns the metadata at the given reference.
+func (m squashfsMetadata) at(c *gc.C, ref uint64) []byte {
+	pos, ok := m.blocks[ref>>16]
+	c.Assert(ok, gc.Equals, true)
+	return m.data[pos+int(ref&0xffff):]
+}
+
+func decompress(c *gc.C, data []byte) []byte {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	c.Assert(err, gc.IsNil)
+	data, err = ioutil.ReadAll(zr)
+	c.Assert(err, gc.IsNil)
+	return data
+}
+
+func (r *squashfsReader) readDir(path string, ref uint64) {
+	le := binary.LittleEndian
+	inode := r.inodes.at(r.c, ref)
+	r.c.Assert(le.Uint16(inode), gc.Equals, uint16(1))
+	r.count++
+	if path != "" {
+		r.files[path] = "d" + os.FileMode(le.Uint16(inode[2:])).String()[1:]
+	}
+	listing := r.dirs.at(r.c, uint64(le.Uint32(inode[16:]))<<16|uint64(le.Uint16(inode[26:])))
+	listing = listing[:le.Uint16(inode[24:])-3]
+	for len(listing) > 0 {
+		count := int(le.Uint32(listing)) + 1
+		start := uint64(le.Uint32(listing[4:]))
+		listing = listing[12:]
+		for i := 0; i < count; i++ {
+			offset := uint64(le.Uint16(listing))
+			nameSize := int(le.Uint16(listing[6:])) + 1
+			name := string(listing[8 : 8+nameSize])
+			listing = listing[8+nameSize:]
+			if path != "" {
+				name = path + "/" + name
+			}
+			r.readInode(name, start<<16|offset)
+		}
+	}
+}
+
+func (r *squashfsReader) readInode(path string, ref uint64) {
+	le := binary.LittleEndian
+	inode := r.inodes.at(r.c, ref)
+	mode := os.FileMode(le.Uint16(inode[2:])).String()[1:]
+	switch le.Uint16(inode) {
+	case 1:
+		r.readDir(path, ref)
+		return
+	case 2:
+		start := uint64(le.Uint32(inode[16:]))
+		size := le.Uint32(inode[28:])
+		var data []byte
+		for i := uint32(0); i*r.blockSize < size; i++ {
+			blockSize := le.Uint32(inode[32+4*i:])
+			block := r.img[start : start+uint64(blockSize&^(1<<24))]
+			start += uint64(blockSize &^ (1 << 24))
+			if blockSize&(1<<24) == 0 {
+				block = decompress(r.c, block)
+			}
+			data = append(data, block...)
+		}
+		r.c.Assert(data, gc.HasLen, int(size))
+		r.files[path] = "-" + mode + " " + string(data)
+	case 3:
+		size := le.Uint32(inode[20:])
+		r.files[path] = "L" + mode + " " + string(inode[24:24+size])
+	default:
+		r.c.Fatalf("unexpected inode type %d", le.Uint16(inode))
+	}
+	r.count++
+}
@@ -0,0 +1,169 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// RepositoryStats holds statistics about the charms in a
+// repository, as returned by LocalRepository.Stats.
+type RepositoryStats struct {
+	// Charms holds the number of charms read.
+	Charms int
+
+	// Invalid holds the paths of the charms that could
+	// not be read.
+	Invalid []string
+
+	// Interfaces holds the usage of each interface,
+	// indexed by interface name.
+	Interfaces map[string]InterfaceStats
+
+	// ConfigOptions holds the number of charms that
+	// declare each configuration option, indexed by
+	// option name.
+	ConfigOptions map[string]int
+
+	// Series holds the number of charms available
+	// for each series, indexed by series name.
+	Series map[string]int
+
+	// TotalArchiveSize holds the sum of the sizes in
+	// bytes of the charms' archives. The archive size
+	// of a charm directory is the size of the archive
+	// that ArchiveTo would create.
+	TotalArchiveSize int64
+}
+
+// InterfaceStats holds the number of charms that use an
+// interface in each role.
+type InterfaceStats struct {
+	Provides int
+	Requires int
+	Peers    int
+}
+
+// AverageArchiveSize returns the mean size in bytes of the
+// charms' archives, or zero if no charms were read.
+func (s *RepositoryStats) AverageArchiveSize() int64 {
+	if s.Charms == 0 {
+		return 0
+	}
+	return s.TotalArchiveSize / int64(s.Charms)
+}
+
+// Stats reads every charm in the repository and returns
+// statistics about them. Charms that cannot be read are
+// recorded in the Invalid field of the result rather than
+// causing an error.
+func (r *LocalRepository) Stats() (*RepositoryStats, error) {
+	seriesInfos, err := ioutil.ReadDir(r.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = repoNotFound(r.Path)
+		}
+		return nil, err
+	}
+	stats := &RepositoryStats{
+		Interfaces:    make(map[string]InterfaceStats),
+		ConfigOptions: make(map[string]int),
+		Series:        make(map[string]int),
+	}
+	for _, seriesInfo := range seriesInfos {
+		series := seriesInfo.Name()
+		if !seriesInfo.IsDir() || !IsValidSeries(series) {
+			continue
+		}
+		path := filepath.Join(r.Path, series)
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			chPath := filepath.Join(path, info.Name())
+			if info.Mode()&os.ModeSymlink != 0 {
+				var err error
+				if info, err = os.Stat(chPath); err != nil {
+					return nil, err
+				}
+			}
+			if !mightBeCharm(info) {
+				continue
+			}
+			ch, err := ReadCharm(chPath)
+			if err != nil {
+				logger.Warningf("failed to load charm at %q: %s", chPath, err)
+				stats.Invalid = append(stats.Invalid, chPath)
+				continue
+			}
+			size, err := archiveSize(ch)
+			if err != nil {
+				return nil, err
+			}
+			stats.add(series, ch, size)
+		}
+	}
+	return stats, nil
+}
+
+// add adds the given charm, found in the given series, to
+// the statistics.
+func (s *RepositoryStats) add(series string, ch Charm, size int64) {
+	s.Charms++
+	s.Series[series]++
+	s.TotalArchiveSize += size
+	meta := ch.Meta()
+	// Count each interface once per charm and role.
+	count := func(rels map[string]Relation, inc func(*InterfaceStats)) {
+		seen := make(map[string]bool)
+		for _, rel := range rels {
+			if seen[rel.Interface] {
+				continue
+			}
+			seen[rel.Interface] = true
+			iface := s.Interfaces[rel.Interface]
+			inc(&iface)
+			s.Interfaces[rel.Interface] = iface
+		}
+	}
+	count(meta.Provides, func(iface *InterfaceStats) { iface.Provides++ })
+	count(meta.Requires, func(iface *InterfaceStats) { iface.Requires++ })
+	count(meta.Peers, func(iface *InterfaceStats) { iface.Peers++ })
+	if config := ch.Config(); config != nil {
+		for name := range config.Options {
+			s.ConfigOptions[name]++
+		}
+	}
+}
+
+// archiveSize returns the size in bytes of the archive of
+// the given charm.
+func archiveSize(ch Charm) (int64, error) {
+	switch ch := ch.(type) {
+	case *CharmArchive:
+		info, err := os.Stat(ch.Path)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	case *CharmDir:
+		var w countingWriter
+		if err := ch.ArchiveTo(&w); err != nil {
+			return 0, err
+		}
+		return int64(w), nil
+	}
+	return 0, nil
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
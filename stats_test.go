@@ -0,0 +1,81 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type StatsSuite struct{}
+
+var _ = gc.Suite(&StatsSuite{})
+
+func (s *StatsSuite) TestStats(c *gc.C) {
+	root := c.MkDir()
+	charmtesting.Charms.ClonedURL(root, "quantal", "wordpress")
+	charmtesting.Charms.ClonedURL(root, "quantal", "mysql")
+	err := os.Mkdir(filepath.Join(root, "quantal", "broken"), 0755)
+	c.Assert(err, gc.IsNil)
+	err = os.Mkdir(filepath.Join(root, "precise"), 0755)
+	c.Assert(err, gc.IsNil)
+	archivePath := charmtesting.Charms.CharmArchivePath(filepath.Join(root, "precise"), "wordpress")
+
+	repo := &charm.LocalRepository{Path: root}
+	stats, err := repo.Stats()
+	c.Assert(err, gc.IsNil)
+
+	var buf bytes.Buffer
+	err = charmtesting.Charms.CharmDir("wordpress").ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	wordpressSize := int64(buf.Len())
+	buf.Reset()
+	err = charmtesting.Charms.CharmDir("mysql").ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	mysqlSize := int64(buf.Len())
+	info, err := os.Stat(archivePath)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Size(), gc.Equals, wordpressSize)
+
+	c.Assert(stats, gc.DeepEquals, &charm.RepositoryStats{
+		Charms:  3,
+		Invalid: []string{filepath.Join(root, "quantal", "broken")},
+		Interfaces: map[string]charm.InterfaceStats{
+			"http":       {Provides: 2},
+			"logging":    {Provides: 2},
+			"monitoring": {Provides: 2},
+			"mysql":      {Provides: 1, Requires: 2},
+			"varnish":    {Requires: 2},
+		},
+		ConfigOptions: map[string]int{
+			"blog-title": 2,
+		},
+		Series: map[string]int{
+			"precise": 1,
+			"quantal": 2,
+		},
+		TotalArchiveSize: 2*wordpressSize + mysqlSize,
+	})
+	c.Assert(stats.AverageArchiveSize(), gc.Equals, (2*wordpressSize+mysqlSize)/3)
+}
+
+func (s *StatsSuite) TestStatsEmptyRepository(c *gc.C) {
+	repo := &charm.LocalRepository{Path: c.MkDir()}
+	stats, err := repo.Stats()
+	c.Assert(err, gc.IsNil)
+	c.Assert(stats.Charms, gc.Equals, 0)
+	c.Assert(stats.AverageArchiveSize(), gc.Equals, int64(0))
+}
+
+func (s *StatsSuite) TestStatsNoRepository(c *gc.C) {
+	repo := &charm.LocalRepository{Path: filepath.Join(c.MkDir(), "missing")}
+	_, err := repo.Stats()
+	c.Assert(err, gc.ErrorMatches, `no repository found at ".*missing"`)
+}
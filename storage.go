@@ -0,0 +1,364 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/schema"
+)
+
+// The types of storage a charm may declare.
+const (
+	// StorageBlock is the type of storage provided
+	// as a block device.
+	StorageBlock = "block"
+
+	// StorageFilesystem is the type of storage provided
+	// as a mounted filesystem.
+	StorageFilesystem = "filesystem"
+)
+
+// Storage describes a store required by a charm, as declared in
+// the storage field of its metadata:
+//
+//	storage:
+//	  data:
+//	    type: filesystem
+//	    location: /srv/data
+//	    minimum-size: 10G
+//	  logs:
+//	    type: block
+//	    multiple:
+//	      range: 1-3
+//
+// A range is given as "N" for exactly N instances, "N-M" for
+// between N and M instances, or "N-" or "N+" for at least N
+// instances. Sizes are given in megabytes, or with one of the
+// suffixes M, G, T and P.
+type Storage struct {
+	// Type holds the type of the store,
+	// StorageBlock or StorageFilesystem.
+	Type string
+
+	// Description holds a description of the store.
+	Description string `bson:",omitempty"`
+
+	// Location holds where a filesystem store
+	// should be mounted.
+	Location string `bson:",omitempty"`
+
+	// Shared reports whether the store is shared
+	// between the units of a service.
+	Shared bool `bson:",omitempty"`
+
+	// ReadOnly reports whether the store is
+	// mounted read-only.
+	ReadOnly bool `bson:",omitempty"`
+
+	// CountMin and CountMax hold the minimum and maximum
+	// number of instances of the store. CountMax is -1 if
+	// the number of instances is not limited.
+	CountMin int
+	CountMax int
+
+	// MinimumSize holds the minimum size of each
+	// instance of the store, in megabytes.
+	MinimumSize uint64 `bson:",omitempty"`
+}
+
+// StorageConstraint describes how instances of a store should be
+// provisioned, as given in the storage field of a service in a
+// bundle. Its zero fields are left to the environment's defaults.
+type StorageConstraint struct {
+	// Pool holds the name of the storage pool or
+	// provider to provision the store from.
+	Pool string
+
+	// Size holds the size of each instance
+	// of the store, in megabytes.
+	Size uint64
+
+	// Count holds the number of instances
+	// of the store.
+	Count int
+}
+
+// validStoragePool matches valid storage pool names.
+var validStoragePool = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9-]*$")
+
+// ParseStorageConstraint parses a storage constraint of the form
+//
+//	[<pool>][,<size>][,<count>]
+//
+// such as "ebs,10G,2". The pool, if present, comes first; a size
+// is distinguished from a count by its suffix, and a number with
+// no suffix is a count.
+func ParseStorageConstraint(s string) (StorageConstraint, error) {
+	var cons StorageConstraint
+	if strings.TrimSpace(s) == "" {
+		return cons, fmt.Errorf("storage constraint is empty")
+	}
+	for i, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+			return cons, fmt.Errorf("storage constraint has an empty field")
+		case part[0] < '0' || part[0] > '9':
+			if i > 0 {
+				return cons, fmt.Errorf("pool %q must come first", part)
+			}
+			if !validStoragePool.MatchString(part) {
+				return cons, fmt.Errorf("invalid pool %q", part)
+			}
+			cons.Pool = part
+		case strings.Trim(part, "0123456789") == "":
+			if cons.Count != 0 {
+				return cons, fmt.Errorf("count specified more than once")
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil || n <= 0 {
+				return cons, fmt.Errorf("invalid count %q", part)
+			}
+			cons.Count = n
+		default:
+			if cons.Size != 0 {
+				return cons, fmt.Errorf("size specified more than once")
+			}
+			n, err := parseSize(part)
+			if err != nil {
+				return cons, fmt.Errorf("invalid size %q: %v", part, err)
+			}
+			if *n == 0 {
+				return cons, fmt.Errorf("invalid size %q: must be greater than zero", part)
+			}
+			cons.Size = *n
+		}
+	}
+	return cons, nil
+}
+
+// String returns the constraint in the form
+// accepted by ParseStorageConstraint.
+func (cons StorageConstraint) String() string {
+	var parts []string
+	if cons.Pool != "" {
+		parts = append(parts, cons.Pool)
+	}
+	if cons.Size != 0 {
+		parts = append(parts, formatSize(cons.Size))
+	}
+	if cons.Count != 0 {
+		parts = append(parts, strconv.Itoa(cons.Count))
+	}
+	return strings.Join(parts, ",")
+}
+
+// CheckConstraint checks that the given constraint
+// can be satisfied by instances of the store.
+func (s Storage) CheckConstraint(cons StorageConstraint) error {
+	if cons.Count != 0 {
+		if cons.Count < s.CountMin {
+			return fmt.Errorf("count %d is less than the minimum of %d", cons.Count, s.CountMin)
+		}
+		if s.CountMax >= 0 && cons.Count > s.CountMax {
+			return fmt.Errorf("count %d is greater than the maximum of %d", cons.Count, s.CountMax)
+		}
+	}
+	if cons.Size != 0 && cons.Size < s.MinimumSize {
+		return fmt.Errorf("size %s is less than the minimum of %s", formatSize(cons.Size), formatSize(s.MinimumSize))
+	}
+	return nil
+}
+
+// validStorageName matches valid storage names.
+var validStorageName = regexp.MustCompile("^[a-z][a-z0-9]*(-[a-z0-9]+)*$")
+
+// checkStorage checks that each of the given stores
+// has a valid name, type and range.
+func checkStorage(stores map[string]Storage) error {
+	for _, name := range sortedStorage(stores) {
+		s := stores[name]
+		switch {
+		case !validStorageName.MatchString(name):
+			return fmt.Errorf("invalid storage name %q", name)
+		case s.Type != StorageBlock && s.Type != StorageFilesystem:
+			return fmt.Errorf("storage %q has unknown type %q", name, s.Type)
+		case s.Location != "" && s.Type != StorageFilesystem:
+			return fmt.Errorf("storage %q has a location but is not a filesystem", name)
+		case s.CountMin < 0 || s.CountMax == 0 || s.CountMax > 0 && s.CountMax < s.CountMin:
+			return fmt.Errorf("storage %q has invalid range %s", name, formatStorageRange(s.CountMin, s.CountMax))
+		}
+	}
+	return nil
+}
+
+// sortedStorage returns the names of the
+// given stores in alphabetical order.
+func sortedStorage(stores map[string]Storage) []string {
+	names := make([]string, 0, len(stores))
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatStorageRange returns the given range in the
+// form accepted in the storage field of the metadata.
+func formatStorageRange(min, max int) string {
+	switch {
+	case max < 0:
+		return fmt.Sprintf("%d-", min)
+	case min == max:
+		return strconv.Itoa(min)
+	}
+	return fmt.Sprintf("%d-%d", min, max)
+}
+
+// encodeStorage returns the metadata.yaml
+// representation of the given stores.
+func encodeStorage(stores map[string]Storage) map[string]interface{} {
+	result := make(map[string]interface{})
+	for name, s := range stores {
+		m := map[string]interface{}{
+			"type": s.Type,
+		}
+		if s.Description != "" {
+			m["description"] = s.Description
+		}
+		if s.Location != "" {
+			m["location"] = s.Location
+		}
+		if s.Shared {
+			m["shared"] = true
+		}
+		if s.ReadOnly {
+			m["read-only"] = true
+		}
+		if s.CountMin != 1 || s.CountMax != 1 {
+			m["multiple"] = map[string]interface{}{
+				"range": formatStorageRange(s.CountMin, s.CountMax),
+			}
+		}
+		if s.MinimumSize != 0 {
+			m["minimum-size"] = formatSize(s.MinimumSize)
+		}
+		result[name] = m
+	}
+	return result
+}
+
+// storageC coerces the storage field of the metadata
+// into a map[string]Storage keyed by storage name.
+type storageC struct{}
+
+var storageMapC = schema.StringMap(schema.FieldMap(
+	schema.Fields{
+		"type":         schema.String(),
+		"description":  schema.String(),
+		"location":     schema.String(),
+		"shared":       schema.Bool(),
+		"read-only":    schema.Bool(),
+		"multiple":     schema.FieldMap(schema.Fields{"range": storageRangeC{}}, nil),
+		"minimum-size": storageSizeC{},
+	},
+	schema.Defaults{
+		"description":  "",
+		"location":     "",
+		"shared":       false,
+		"read-only":    false,
+		"multiple":     schema.Omit,
+		"minimum-size": uint64(0),
+	},
+))
+
+func (storageC) Coerce(v interface{}, path []string) (interface{}, error) {
+	m, err := storageMapC.Coerce(v, path)
+	if err != nil {
+		return nil, err
+	}
+	stores := make(map[string]Storage)
+	for name, fields := range m.(map[string]interface{}) {
+		fields := fields.(map[string]interface{})
+		s := Storage{
+			Type:        fields["type"].(string),
+			Description: fields["description"].(string),
+			Location:    fields["location"].(string),
+			Shared:      fields["shared"].(bool),
+			ReadOnly:    fields["read-only"].(bool),
+			CountMin:    1,
+			CountMax:    1,
+			MinimumSize: fields["minimum-size"].(uint64),
+		}
+		if multiple, ok := fields["multiple"]; ok {
+			r := multiple.(map[string]interface{})["range"].([2]int)
+			s.CountMin, s.CountMax = r[0], r[1]
+		}
+		stores[name] = s
+	}
+	return stores, nil
+}
+
+// storageRangeC coerces a storage range into a [2]int
+// holding its minimum and maximum, where a maximum of
+// -1 means the range is unbounded.
+type storageRangeC struct{}
+
+func (storageRangeC) Coerce(v interface{}, path []string) (interface{}, error) {
+	if n, err := schema.Int().Coerce(v, path); err == nil {
+		return [2]int{int(n.(int64)), int(n.(int64))}, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%sexpected range, got %T(%#v)", schemaPathPrefix(path), v, v)
+	}
+	bad := fmt.Errorf("%sinvalid range %q", schemaPathPrefix(path), s)
+	min, max := s, s
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		min, max = s[:i], s[i+1:]
+		if s[i] == '+' && max != "" {
+			return nil, bad
+		}
+	}
+	lo, err := strconv.Atoi(min)
+	if err != nil || lo < 0 {
+		return nil, bad
+	}
+	if max == "" {
+		return [2]int{lo, -1}, nil
+	}
+	hi, err := strconv.Atoi(max)
+	if err != nil || hi < 0 {
+		return nil, bad
+	}
+	return [2]int{lo, hi}, nil
+}
+
+// storageSizeC coerces a size given in megabytes,
+// or with a suffix as accepted by ParseConstraints,
+// into a uint64 number of megabytes.
+type storageSizeC struct{}
+
+func (storageSizeC) Coerce(v interface{}, path []string) (interface{}, error) {
+	if n, err := schema.Int().Coerce(v, path); err == nil {
+		if n.(int64) < 0 {
+			return nil, fmt.Errorf("%ssize %v is negative", schemaPathPrefix(path), v)
+		}
+		return uint64(n.(int64)), nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%sexpected size, got %T(%#v)", schemaPathPrefix(path), v, v)
+	}
+	n, err := parseSize(s)
+	if err != nil {
+		return nil, fmt.Errorf("%sinvalid size %q: %v", schemaPathPrefix(path), s, err)
+	}
+	return *n, nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type StorageSuite struct{}
+
+var _ = gc.Suite(&StorageSuite{})
+
+const storageMeta = `
+name: storage
+summary: s
+description: d
+storage:
+  data:
+    type: filesystem
+    description: The data.
+    location: /srv/data
+    minimum-size: 10G
+  logs:
+    type: block
+    shared: true
+    read-only: true
+    multiple:
+      range: 1-3
+  cache:
+    type: block
+    multiple:
+      range: 2+
+    minimum-size: 512
+`
+
+func (s *StorageSuite) TestReadStorage(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(storageMeta))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Storage, jc.DeepEquals, map[string]charm.Storage{
+		"data": {
+			Type:        charm.StorageFilesystem,
+			Description: "The data.",
+			Location:    "/srv/data",
+			CountMin:    1,
+			CountMax:    1,
+			MinimumSize: 10 * 1024,
+		},
+		"logs": {
+			Type:     charm.StorageBlock,
+			Shared:   true,
+			ReadOnly: true,
+			CountMin: 1,
+			CountMax: 3,
+		},
+		"cache": {
+			Type:        charm.StorageBlock,
+			CountMin:    2,
+			CountMax:    -1,
+			MinimumSize: 512,
+		},
+	})
+	c.Assert(meta.UnknownFields, gc.IsNil)
+}
+
+func (s *StorageSuite) TestStorageSaved(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(storageMeta))
+	c.Assert(err, gc.IsNil)
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	dir.SetMeta(meta)
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+	saved, err := charm.ReadCharmDir(dir.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(saved.Meta().Storage, jc.DeepEquals, meta.Storage)
+}
+
+var storageErrorTests = []struct {
+	storage string
+	err     string
+}{{
+	storage: "  Data:\n    type: block\n",
+	err:     `charm "storage" has invalid storage name "Data"`,
+}, {
+	storage: "  data:\n    type: tape\n",
+	err:     `charm "storage" has storage "data" has unknown type "tape"`,
+}, {
+	storage: "  data:\n    type: block\n    location: /srv\n",
+	err:     `charm "storage" has storage "data" has a location but is not a filesystem`,
+}, {
+	storage: "  data:\n    type: block\n    multiple: {range: 3-1}\n",
+	err:     `charm "storage" has storage "data" has invalid range 3-1`,
+}, {
+	storage: "  data:\n    type: block\n    multiple: {range: 0}\n",
+	err:     `charm "storage" has storage "data" has invalid range 0`,
+}, {
+	storage: "  data:\n    type: block\n    multiple: {range: few}\n",
+	err:     `metadata: line .*: storage.data.multiple.range: invalid range "few"`,
+}, {
+	storage: "  data:\n    type: block\n    multiple: {range: 1+2}\n",
+	err:     `metadata: line .*: storage.data.multiple.range: invalid range "1\+2"`,
+}, {
+	storage: "  data:\n    type: block\n    minimum-size: big\n",
+	err:     `metadata: line .*: storage.data.minimum-size: invalid size "big": .*`,
+}, {
+	storage: "  data:\n    type: block\n    minimum-size: Inf\n",
+	err:     `metadata: line .*: storage.data.minimum-size: invalid size "Inf": .*`,
+}, {
+	storage: "  data:\n    type: block\n    minimum-size: 99999999999999999999T\n",
+	err:     `metadata: line .*: storage.data.minimum-size: invalid size "99999999999999999999T": too large`,
+}, {
+	storage: "  data:\n    description: d\n",
+	err:     `metadata: line .*: storage.data.type: expected string, got nothing`,
+}}
+
+func (s *StorageSuite) TestStorageErrors(c *gc.C) {
+	for i, test := range storageErrorTests {
+		c.Logf("test %d: %q", i, test.storage)
+		_, err := charm.ReadMeta(strings.NewReader("name: storage\nsummary: s\ndescription: d\nstorage:\n" + test.storage))
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+var parseStorageConstraintTests = []struct {
+	s      string
+	expect charm.StorageConstraint
+	str    string
+	err    string
+}{{
+	s:      "ebs,10G,2",
+	expect: charm.StorageConstraint{Pool: "ebs", Size: 10 * 1024, Count: 2},
+}, {
+	s:      "ebs-ssd",
+	expect: charm.StorageConstraint{Pool: "ebs-ssd"},
+}, {
+	s:      "3, 512M",
+	expect: charm.StorageConstraint{Size: 512, Count: 3},
+	str:    "512M,3",
+}, {
+	s:      "1.5G",
+	expect: charm.StorageConstraint{Size: 1536},
+	str:    "1536M",
+}, {
+	s:   "",
+	err: "storage constraint is empty",
+}, {
+	s:   "ebs,,2",
+	err: "storage constraint has an empty field",
+}, {
+	s:   "10G,ebs",
+	err: `pool "ebs" must come first`,
+}, {
+	s:   "ebs_ssd",
+	err: `invalid pool "ebs_ssd"`,
+}, {
+	s:   "ebs,2,3",
+	err: "count specified more than once",
+}, {
+	s:   "ebs,0",
+	err: `invalid count "0"`,
+}, {
+	s:   "1G,2G",
+	err: "size specified more than once",
+}, {
+	s:   "10X",
+	err: `invalid size "10X": .*`,
+}, {
+	s:   "0M",
+	err: `invalid size "0M": must be greater than zero`,
+}}
+
+func (s *StorageSuite) TestParseStorageConstraint(c *gc.C) {
+	for i, test := range parseStorageConstraintTests {
+		c.Logf("test %d: %q", i, test.s)
+		cons, err := charm.ParseStorageConstraint(test.s)
+		if test.err != "" {
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(cons, gc.Equals, test.expect)
+		str := test.str
+		if str == "" {
+			str = test.s
+		}
+		c.Assert(cons.String(), gc.Equals, str)
+	}
+}
+
+func (s *StorageSuite) TestCheckConstraint(c *gc.C) {
+	store := charm.Storage{
+		Type:        charm.StorageBlock,
+		CountMin:    2,
+		CountMax:    4,
+		MinimumSize: 1024,
+	}
+	c.Assert(store.CheckConstraint(charm.StorageConstraint{Pool: "ebs"}), gc.IsNil)
+	c.Assert(store.CheckConstraint(charm.StorageConstraint{Size: 2048, Count: 4}), gc.IsNil)
+	err := store.CheckConstraint(charm.StorageConstraint{Count: 1})
+	c.Assert(err, gc.ErrorMatches, "count 1 is less than the minimum of 2")
+	err = store.CheckConstraint(charm.StorageConstraint{Count: 5})
+	c.Assert(err, gc.ErrorMatches, "count 5 is greater than the maximum of 4")
+	err = store.CheckConstraint(charm.StorageConstraint{Size: 512})
+	c.Assert(err, gc.ErrorMatches, "size 512M is less than the minimum of 1G")
+
+	store.CountMax = -1
+	c.Assert(store.CheckConstraint(charm.StorageConstraint{Count: 100}), gc.IsNil)
+}
+
+func (s *StorageSuite) TestVerifyBundleStorage(c *gc.C) {
+	data := `
+services:
+    wordpress:
+        charm: wordpress
+        num_units: 1
+        storage:
+            data: ebs,5G
+            logs: ebs,4
+            cache: "2"
+            backup: ebs
+    mysql:
+        charm: mysql
+        num_units: 1
+        storage:
+            data: ebs,,1
+`
+	meta, err := charm.ReadMeta(strings.NewReader(storageMeta))
+	c.Assert(err, gc.IsNil)
+	wordpress := testCharm("wordpress", "")
+	wordpress.Meta().Storage = meta.Storage
+	charms := map[string]charm.Charm{
+		"wordpress": wordpress,
+		"mysql":     testCharm("mysql", ""),
+	}
+	assertVerifyWithCharmsErrors(c, data, charms, []string{
+		`cannot validate service "wordpress": storage "data": size 5G is less than the minimum of 10G`,
+		`cannot validate service "wordpress": storage "logs": count 4 is greater than the maximum of 3`,
+		`invalid storage constraint "ebs,,1" for "data" in service "mysql": storage constraint has an empty field`,
+		`service "mysql" refers to storage "data" not declared by charm "mysql"`,
+		`service "wordpress" refers to storage "backup" not declared by charm "wordpress"`,
+	})
+}
+
+func (s *StorageSuite) TestBundleStorageMergeAndDiff(c *gc.C) {
+	newBundle := func() *charm.BundleData {
+		return &charm.BundleData{
+			Services: map[string]*charm.ServiceSpec{
+				"wordpress": {
+					Charm:   "wordpress",
+					Storage: map[string]string{"data": "ebs,10G"},
+				},
+			},
+		}
+	}
+	bd := newBundle()
+	err := bd.Merge(&charm.BundleData{
+		Services: map[string]*charm.ServiceSpec{
+			"wordpress": {
+				Storage: map[string]string{"logs": "ebs,2"},
+			},
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(bd.Services["wordpress"].Storage, jc.DeepEquals, map[string]string{
+		"data": "ebs,10G",
+		"logs": "ebs,2",
+	})
+	d := newBundle().Diff(bd)
+	c.Assert(d.Services["wordpress"].Storage, jc.DeepEquals, map[string]charm.StringDiff{
+		"logs": {"", "ebs,2"},
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// WriteCharmTar writes the contents of the given charm, which must be
+// a *CharmDir or a *CharmArchive, to w as a tar stream, so that
+// charms can be embedded in tools that work with tar streams without
+// going through a temporary zip file. The charm can be read back
+// with ReadCharmTar.
+func WriteCharmTar(ch Charm, w io.Writer) error {
+	var zipr *zipReadCloser
+	switch ch := ch.(type) {
+	case *CharmDir:
+		var buf bytes.Buffer
+		if err := writeArchive(&buf, ch.Path, ch.Revision(), ch.Meta().Hooks(), nil); err != nil {
+			return err
+		}
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			return err
+		}
+		zipr = &zipReadCloser{Closer: ioutil.NopCloser(nil), Reader: r}
+	case *CharmArchive:
+		var err error
+		zipr, err = ch.zopen.openZip()
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported charm type %T", ch)
+	}
+	defer zipr.Close()
+	tarw := tar.NewWriter(w)
+	for _, fh := range zipr.File {
+		if err := writeTarEntry(tarw, fh); err != nil {
+			return fmt.Errorf("cannot write %q to tar: %v", fh.Name, err)
+		}
+	}
+	return tarw.Close()
+}
+
+// writeTarEntry writes the given zip file entry to tarw.
+func writeTarEntry(tarw *tar.Writer, fh *zip.File) error {
+	mode := fh.Mode()
+	hdr := &tar.Header{
+		Name:    fh.Name,
+		Mode:    int64(mode.Perm()),
+		ModTime: fh.ModTime(),
+	}
+	var data []byte
+	if mode&os.ModeDir == 0 {
+		var err error
+		if data, err = readZipFile(fh); err != nil {
+			return err
+		}
+	}
+	switch {
+	case mode&os.ModeDir != 0:
+		hdr.Typeflag = tar.TypeDir
+		if !strings.HasSuffix(hdr.Name, "/") {
+			hdr.Name += "/"
+		}
+	case mode&os.ModeSymlink != 0:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = string(data)
+		data = nil
+	case mode&os.ModeType == 0:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(len(data))
+	default:
+		return fmt.Errorf("unsupported file type %v", mode&os.ModeType)
+	}
+	if err := tarw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tarw.Write(data)
+	return err
+}
+
+// ReadCharmTar reads a charm written by WriteCharmTar from r. It
+// reads up to the end of the tar stream, leaving any data after it
+// unread.
+func ReadCharmTar(r io.Reader) (*CharmArchive, error) {
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	tarr := tar.NewReader(r)
+	for {
+		hdr, err := tarr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read charm tar: %v", err)
+		}
+		if err := copyTarEntry(zipw, hdr, tarr); err != nil {
+			return nil, fmt.Errorf("cannot read charm tar: %q: %v", hdr.Name, err)
+		}
+	}
+	if err := zipw.Close(); err != nil {
+		return nil, err
+	}
+	return ReadCharmArchiveBytes(buf.Bytes())
+}
+
+// copyTarEntry writes the tar entry with the
+// given header, read from r, to zipw.
+func copyTarEntry(zipw *zip.Writer, hdr *tar.Header, r io.Reader) error {
+	name := strings.TrimPrefix(hdr.Name, "./")
+	if name == "" || name == "." {
+		return nil
+	}
+	h := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Store,
+	}
+	h.SetModTime(hdr.ModTime)
+	perm := os.FileMode(hdr.Mode).Perm()
+	var data io.Reader
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if !strings.HasSuffix(h.Name, "/") {
+			h.Name += "/"
+		}
+		h.SetMode(os.ModeDir | perm)
+	case tar.TypeSymlink:
+		h.SetMode(os.ModeSymlink | 0777)
+		data = strings.NewReader(hdr.Linkname)
+	case tar.TypeReg, tar.TypeRegA:
+		h.Method = zip.Deflate
+		h.SetMode(perm)
+		data = r
+	default:
+		return fmt.Errorf("unsupported file type %q", hdr.Typeflag)
+	}
+	w, err := zipw.CreateHeader(h)
+	if err != nil || data == nil {
+		return err
+	}
+	_, err = io.Copy(w, data)
+	return err
+}
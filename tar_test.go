@@ -0,0 +1,125 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type TarSuite struct{}
+
+var _ = gc.Suite(&TarSuite{})
+
+func (s *TarSuite) TestCharmDirRoundTrip(c *gc.C) {
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	err := os.Symlink("../src/hello.c", filepath.Join(path, "hooks", "hello-link"))
+	c.Assert(err, gc.IsNil)
+	dir, err := charm.ReadCharmDir(path)
+	c.Assert(err, gc.IsNil)
+	dir.SetRevision(42)
+
+	var buf bytes.Buffer
+	err = charm.WriteCharmTar(dir, &buf)
+	c.Assert(err, gc.IsNil)
+	// Trailing data after the tar stream is left unread.
+	buf.WriteString("trailing")
+
+	archive, err := charm.ReadCharmTar(&buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(buf.String(), gc.Equals, "trailing")
+	c.Assert(archive.Revision(), gc.Equals, 42)
+	c.Assert(archive.Meta(), jc.DeepEquals, dir.Meta())
+	c.Assert(archive.Config(), jc.DeepEquals, dir.Config())
+
+	expandDir := c.MkDir()
+	err = archive.ExpandTo(expandDir)
+	c.Assert(err, gc.IsNil)
+	target, err := os.Readlink(filepath.Join(expandDir, "hooks", "hello-link"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(target, gc.Equals, "../src/hello.c")
+	info, err := os.Stat(filepath.Join(expandDir, "hooks", "install"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode()&0100, gc.Not(gc.Equals), os.FileMode(0))
+	data, err := ioutil.ReadFile(filepath.Join(expandDir, "src", "hello.c"))
+	c.Assert(err, gc.IsNil)
+	orig, err := ioutil.ReadFile(filepath.Join(path, "src", "hello.c"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(data, jc.DeepEquals, orig)
+}
+
+func (s *TarSuite) TestCharmArchiveRoundTrip(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	var buf bytes.Buffer
+	err := charm.WriteCharmTar(archive, &buf)
+	c.Assert(err, gc.IsNil)
+
+	names := make(map[string]bool)
+	tarr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tarr.Next()
+		if err != nil {
+			break
+		}
+		names[hdr.Name] = true
+	}
+	c.Assert(names["metadata.yaml"], jc.IsTrue)
+	c.Assert(names["hooks/"], jc.IsTrue)
+
+	archive2, err := charm.ReadCharmTar(&buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive2.Revision(), gc.Equals, archive.Revision())
+	c.Assert(archive2.Meta(), jc.DeepEquals, archive.Meta())
+	equal, err := charm.Equal(archive, archive2, charm.EqualOptions{CompareRevision: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(equal, jc.IsTrue)
+}
+
+func (s *TarSuite) TestReadCharmTarDotPrefix(c *gc.C) {
+	var buf bytes.Buffer
+	tarw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "./metadata.yaml", Typeflag: tar.TypeReg, Mode: 0644},
+	} {
+		var data []byte
+		if hdr.Typeflag == tar.TypeReg {
+			data = []byte("name: dotted\nsummary: s\ndescription: d\n")
+			hdr.Size = int64(len(data))
+		}
+		c.Assert(tarw.WriteHeader(hdr), gc.IsNil)
+		_, err := tarw.Write(data)
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(tarw.Close(), gc.IsNil)
+
+	archive, err := charm.ReadCharmTar(&buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Meta().Name, gc.Equals, "dotted")
+}
+
+func (s *TarSuite) TestReadCharmTarUnsupportedType(c *gc.C) {
+	var buf bytes.Buffer
+	tarw := tar.NewWriter(&buf)
+	err := tarw.WriteHeader(&tar.Header{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0644})
+	c.Assert(err, gc.IsNil)
+	c.Assert(tarw.Close(), gc.IsNil)
+
+	_, err = charm.ReadCharmTar(&buf)
+	c.Assert(err, gc.ErrorMatches, `cannot read charm tar: "fifo": unsupported file type '6'`)
+}
+
+func (s *TarSuite) TestWriteCharmTarUnsupportedCharm(c *gc.C) {
+	err := charm.WriteCharmTar(nil, ioutil.Discard)
+	c.Assert(err, gc.ErrorMatches, "unsupported charm type <nil>")
+}
@@ -0,0 +1,144 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Templates returns the slash-separated paths, relative to the
+// templates directory, of the files the charm holds there, in
+// alphabetical order.
+func (dir *CharmDir) Templates() ([]string, error) {
+	return conventionalFiles(dir, TemplatesDir)
+}
+
+// Files returns the slash-separated paths, relative to the files
+// directory, of the files the charm holds there, in alphabetical
+// order.
+func (dir *CharmDir) Files() ([]string, error) {
+	return conventionalFiles(dir, FilesDir)
+}
+
+// Templates returns the slash-separated paths, relative to the
+// templates directory, of the files the charm holds there, in
+// alphabetical order.
+func (a *CharmArchive) Templates() ([]string, error) {
+	return conventionalFiles(a, TemplatesDir)
+}
+
+// Files returns the slash-separated paths, relative to the files
+// directory, of the files the charm holds there, in alphabetical
+// order.
+func (a *CharmArchive) Files() ([]string, error) {
+	return conventionalFiles(a, FilesDir)
+}
+
+// conventionalFiles returns the paths, relative to dir, of
+// the files in the given directory of the given charm,
+// which must be a *CharmDir or a *CharmArchive.
+func conventionalFiles(ch Charm, dir string) ([]string, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	names := []string{}
+	for _, fh := range zipr.File {
+		if strings.HasPrefix(fh.Name, dir+"/") && !fh.Mode().IsDir() {
+			names = append(names, strings.TrimPrefix(fh.Name, dir+"/"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// templateReferences holds the patterns recognizing the templates
+// referred to by scripts: paths within the templates directory,
+// either relative or from $CHARM_DIR, and the sources passed to
+// charmhelpers' render function, which are relative to it. The last
+// submatch holds the template's path.
+var templateReferences = []*regexp.Regexp{
+	regexp.MustCompile(`(?:^|[^\w./$-]|\$\{?(?:JUJU_)?CHARM_DIR\}?/)templates/([\w.-]+(?:/[\w.-]+)*)`),
+	regexp.MustCompile(`\brender\(\s*(?:source\s*=\s*)?["']([^"']+)["']`),
+}
+
+// LintTemplates returns the problems found in the use of templates by
+// the given charm, which must be a *CharmDir or a *CharmArchive: the
+// templates referred to by its hooks, actions and dispatch script but
+// missing from its templates directory. Scripts are scanned for
+// string literals, so templates whose names are computed are not
+// found; comment lines are ignored. Hooks that are symbolic links are
+// scanned once, as the file they refer to.
+func LintTemplates(ch Charm) ([]string, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	files := zipFilesByName(zipr.File)
+	scanned := make(map[string]bool)
+	var problems []string
+	for _, fh := range zipr.File {
+		dir := path.Dir(fh.Name)
+		isScript := dir == HooksDir || dir == ActionsDir || fh.Name == DispatchFile
+		if !isScript || fh.Mode().IsDir() {
+			continue
+		}
+		script, err := resolveZipLink(files, fh)
+		if err != nil || !script.Mode().IsRegular() || scanned[script.Name] {
+			// Broken links are reported by LintHookLinks.
+			continue
+		}
+		scanned[script.Name] = true
+		data, err := readZipFile(script)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %q: %v", script.Name, err)
+		}
+		for _, ref := range templateRefs(data) {
+			if _, ok := files[path.Join(TemplatesDir, ref.name)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s:%d: template %q not found in %s", script.Name, ref.line, ref.name, TemplatesDir))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// templateRef holds a reference to a
+// template found in a script.
+type templateRef struct {
+	name string
+	line int
+}
+
+// templateRefs returns the first reference to each
+// template found in the given script.
+func templateRefs(data []byte) []templateRef {
+	var refs []templateRef
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, pattern := range templateReferences {
+			for _, m := range pattern.FindAllStringSubmatch(line, -1) {
+				name := path.Clean(strings.TrimSuffix(m[len(m)-1], "."))
+				if seen[name] || name == "." || strings.HasPrefix(name, "../") {
+					continue
+				}
+				seen[name] = true
+				refs = append(refs, templateRef{name, n})
+			}
+		}
+	}
+	return refs
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type TemplatesSuite struct{}
+
+var _ = gc.Suite(&TemplatesSuite{})
+
+func (s *TemplatesSuite) TestTemplatesAndFiles(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	templates, err := dir.Templates()
+	c.Assert(err, gc.IsNil)
+	c.Assert(templates, gc.HasLen, 0)
+
+	writeCharmFile(c, dir.Path, "templates/nginx.conf", "", 0644)
+	writeCharmFile(c, dir.Path, "templates/sites/default.j2", "", 0644)
+	writeCharmFile(c, dir.Path, "files/logo.png", "", 0644)
+	templates, err = dir.Templates()
+	c.Assert(err, gc.IsNil)
+	c.Assert(templates, jc.DeepEquals, []string{"nginx.conf", "sites/default.j2"})
+	files, err := dir.Files()
+	c.Assert(err, gc.IsNil)
+	c.Assert(files, jc.DeepEquals, []string{"logo.png"})
+
+	archive := archiveDir(c, dir.Path)
+	templates, err = archive.Templates()
+	c.Assert(err, gc.IsNil)
+	c.Assert(templates, jc.DeepEquals, []string{"nginx.conf", "sites/default.j2"})
+	files, err = archive.Files()
+	c.Assert(err, gc.IsNil)
+	c.Assert(files, jc.DeepEquals, []string{"logo.png"})
+}
+
+func (s *TemplatesSuite) TestLintTemplates(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	writeCharmFile(c, dir.Path, "templates/nginx.conf", "", 0644)
+	writeCharmFile(c, dir.Path, "templates/sites/default.j2", "", 0644)
+	writeCharmFile(c, dir.Path, "hooks/install", `#!/bin/sh
+cp $CHARM_DIR/templates/nginx.conf /etc/nginx/nginx.conf
+cp ${CHARM_DIR}/templates/missing.conf /etc/nginx/conf.d
+# cp templates/commented.conf /etc
+cp /etc/templates/absolute.conf /tmp
+cat templates/sites/default.j2 templates/sites/other.j2
+`, 0755)
+	writeCharmFile(c, dir.Path, "src/charm.py", `#!/usr/bin/env python3
+from charmhelpers.core.templating import render
+render('nginx.conf', '/etc/nginx/nginx.conf', {})
+render(source="site.j2", target="/etc/nginx/site", context={})
+render("site.j2", "/etc/nginx/other", {})
+`, 0755)
+	linkHooks(c, dir.Path, "../src/charm.py", "start", "stop")
+
+	problems, err := charm.LintTemplates(dir)
+	c.Assert(err, gc.IsNil)
+	expect := []string{
+		`hooks/install:3: template "missing.conf" not found in templates`,
+		`hooks/install:6: template "sites/other.j2" not found in templates`,
+		`src/charm.py:4: template "site.j2" not found in templates`,
+	}
+	c.Assert(problems, jc.DeepEquals, expect)
+
+	problems, err = charm.LintTemplates(archiveDir(c, dir.Path))
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, expect)
+
+	writeCharmFile(c, dir.Path, "templates/missing.conf", "", 0644)
+	writeCharmFile(c, dir.Path, "templates/sites/other.j2", "", 0644)
+	writeCharmFile(c, dir.Path, "templates/site.j2", "", 0644)
+	problems, err = charm.LintTemplates(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, gc.HasLen, 0)
+}
@@ -5,6 +5,7 @@ package testing
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -40,17 +41,23 @@ func (r *Repo) Path() string {
 
 // init is called once when r.Path() is called for the first time, and
 // it initializes r.path to the location of the local testing
-// repository.
+// repository. When the source of this package is not available,
+// the repository is materialized in a new temporary directory.
 func (r *Repo) init() {
-	// Find the repo directory. This is only OK to do
+	// Find the repo directory. This is usually OK to do
 	// because this is running in a test context
-	// so we know the source is available.
-	_, file, _, ok := runtime.Caller(0)
-	if !ok {
-		panic("cannot get caller")
+	// so the source is available.
+	if _, file, _, ok := runtime.Caller(0); ok {
+		dir := filepath.Join(filepath.Dir(file), "repo")
+		if _, err := os.Stat(dir); err == nil {
+			r.path = dir
+			return
+		}
 	}
-	dir := filepath.Dir(file)
-	r.path = filepath.Join(dir, "repo")
+	dir, err := ioutil.TempDir("", "charm-testing-repo")
+	check(err)
+	check(r.Materialize(dir))
+	r.path = dir
 }
 
 // Charms represents the specific charm repository stored in this package and
@@ -247,11 +254,11 @@ func (s *MockCharmStore) interpret(charmURL *charm.URL) (base string, rev int) {
 // Get implements charm.Repository.Get.
 func (s *MockCharmStore) Get(charmURL *charm.URL) (charm.Charm, error) {
 	base, rev := s.interpret(charmURL)
-	charm, found := s.charms[base][rev]
+	ch, found := s.charms[base][rev]
 	if !found {
-		return nil, fmt.Errorf("charm not found in mock store: %s", charmURL)
+		return nil, charm.NewNotFoundError(fmt.Sprintf("charm not found in mock store: %s", charmURL))
 	}
-	return charm, nil
+	return ch, nil
 }
 
 // Latest implements charm.Repository.Latest.
@@ -261,7 +268,7 @@ func (s *MockCharmStore) Latest(charmURLs ...*charm.URL) ([]charm.CharmRevision,
 		charmURL := curl.WithRevision(-1)
 		base, rev := s.interpret(charmURL)
 		if _, found := s.charms[base][rev]; !found {
-			result[i].Err = fmt.Errorf("charm not found in mock store: %s", charmURL)
+			result[i].Err = charm.NewNotFoundError(fmt.Sprintf("charm not found in mock store: %s", charmURL))
 		} else {
 			result[i].Revision = rev
 		}
@@ -0,0 +1,123 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"embed"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// repoFiles holds the contents of the testing repository, so
+// that it is available without the source of this package.
+//
+//go:embed all:repo
+var repoFiles embed.FS
+
+// executableFiles holds the files in the testing repository
+// that are executable, which is not recorded by repoFiles.
+var executableFiles = map[string]bool{
+	"quantal/dummy/hooks/install":               true,
+	"quantal/varnish-alternative/hooks/install": true,
+}
+
+// symlinks holds the symbolic links in the testing repository,
+// which are not held in repoFiles, and their targets.
+var symlinks = map[string]string{
+	"series/format2/hooks/symlink": "../target",
+}
+
+// FS returns the testing repository as a file system. The
+// repository holds a directory for each series, holding a
+// directory for each charm, and a bundle directory holding
+// a directory for each bundle.
+//
+// The file system does not hold the modes of the files, nor
+// symbolic links; use Materialize to write the repository
+// with those intact.
+func (r *Repo) FS() fs.FS {
+	fsys, err := fs.Sub(repoFiles, "repo")
+	check(err)
+	return fsys
+}
+
+// Materialize writes the testing repository held in r.FS
+// to the directory dst, which is created if necessary.
+func (r *Repo) Materialize(dst string) error {
+	return materialize(r.FS(), ".", dst)
+}
+
+// MaterializeCharmDir writes the charm directory with the given
+// name in the default series to a directory of the same name
+// within dst, and returns the path to it.
+func (r *Repo) MaterializeCharmDir(dst, name string) string {
+	dst = filepath.Join(dst, name)
+	check(materialize(r.FS(), path.Join(DefaultSeries, name), dst))
+	return dst
+}
+
+// MaterializeBundleDir writes the bundle directory with
+// the given name to a directory of the same name within
+// dst, and returns the path to it.
+func (r *Repo) MaterializeBundleDir(dst, name string) string {
+	dst = filepath.Join(dst, name)
+	check(materialize(r.FS(), path.Join("bundle", name), dst))
+	return dst
+}
+
+// materialize writes the contents of the directory root within
+// the testing repository held in fsys to the directory dst.
+func materialize(fsys fs.FS, root, dst string) error {
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(relPath(root, name)))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(0644)
+		if executableFiles[name] {
+			mode = 0755
+		}
+		if err := ioutil.WriteFile(target, data, mode); err != nil {
+			return err
+		}
+		// Make sure the mode is not reduced by the umask.
+		return os.Chmod(target, mode)
+	})
+	if err != nil {
+		return err
+	}
+	for name, link := range symlinks {
+		if root != "." && !strings.HasPrefix(name, root+"/") {
+			continue
+		}
+		target := filepath.Join(dst, filepath.FromSlash(relPath(root, name)))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(link, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relPath returns the slash-separated path of
+// name relative to the directory root.
+func relPath(root, name string) string {
+	if root == "." {
+		return name
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(name, root), "/")
+}
@@ -0,0 +1,217 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+)
+
+// AssertGolden asserts that obtained, typically a *charm.Meta,
+// *charm.Config or *charm.Actions, matches the contents of the
+// golden file at path, as checked by MatchGolden. If it does not,
+// the test fails showing the lines that differ.
+func AssertGolden(c *gc.C, obtained interface{}, path string) {
+	diff, err := MatchGolden(obtained, path)
+	c.Assert(err, gc.IsNil)
+	if diff != "" {
+		c.Fatalf("value does not match golden file %s (run the tests with -update to update it):\n%s", path, diff)
+	}
+}
+
+// MatchGolden reports whether obtained matches the contents of the
+// golden file at path, returning a description of the lines that
+// differ if not. The value is encoded as JSON if path has a ".json"
+// extension and as YAML otherwise. Values with a CanonicalBytes
+// method, such as charm.Meta and charm.Config, are encoded as
+// their canonical form, which holds the fields as named in charm
+// files; other values are encoded as gopkg.in/yaml.v1 encodes them.
+//
+// If the test binary defines a boolean flag named "update", as
+// suites conventionally do with
+//
+//	var update = flag.Bool("update", false, "update golden files")
+//
+// and the flag is set, the golden file is written with the encoded
+// value instead, and no differences are reported.
+func MatchGolden(obtained interface{}, path string) (diff string, err error) {
+	data, err := encodeGolden(obtained, filepath.Ext(path) == ".json")
+	if err != nil {
+		return "", fmt.Errorf("cannot encode value for golden file %s: %v", path, err)
+	}
+	if updateGolden() {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		return "", ioutil.WriteFile(path, data, 0644)
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if bytes.Equal(want, data) {
+		return "", nil
+	}
+	return lineDiff(string(want), string(data)), nil
+}
+
+// updateGolden reports whether the test binary
+// defines an "update" flag and it is set.
+func updateGolden() bool {
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	update, _ := getter.Get().(bool)
+	return update
+}
+
+// canonicalEncoder is implemented by values with
+// a canonical JSON encoding, such as charm.Meta.
+type canonicalEncoder interface {
+	CanonicalBytes() ([]byte, error)
+}
+
+// encodeGolden returns the contents of a golden
+// file holding v, encoded as JSON or YAML.
+func encodeGolden(v interface{}, asJSON bool) ([]byte, error) {
+	var doc interface{}
+	if enc, ok := v.(canonicalEncoder); ok {
+		data, err := enc.CanonicalBytes()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	} else {
+		// Encode the value as YAML and decode it again so that
+		// struct fields are named as in YAML in both formats.
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	}
+	if !asJSON {
+		return yaml.Marshal(doc)
+	}
+	data, err := json.MarshalIndent(jsonValue(doc), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// jsonValue returns v with any maps decoded from
+// YAML converted to maps that can be encoded as JSON.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for key, value := range v {
+			m[key] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = jsonValue(value)
+		}
+		return s
+	}
+	return v
+}
+
+// diffContext holds the number of unchanged
+// lines shown around each change by lineDiff.
+const diffContext = 2
+
+// lineDiff returns the differences between want and got, showing
+// removed lines prefixed with "-", added lines prefixed with "+"
+// and a few unchanged lines around them prefixed with a space.
+func lineDiff(want, got string) string {
+	a := strings.Split(strings.TrimSuffix(want, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	// lcs[i][j] holds the length of the longest common
+	// subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []string
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "-"+a[i])
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			j++
+		}
+	}
+	var buf bytes.Buffer
+	skipped := false
+	for i, line := range lines {
+		if !nearChange(lines, i) {
+			skipped = true
+			continue
+		}
+		if skipped && buf.Len() > 0 {
+			buf.WriteString("...\n")
+		}
+		skipped = false
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// nearChange reports whether the line at index i of
+// a diff is within diffContext lines of a change.
+func nearChange(lines []string, i int) bool {
+	for j := i - diffContext; j <= i+diffContext; j++ {
+		if j >= 0 && j < len(lines) && lines[j][0] != ' ' {
+			return true
+		}
+	}
+	return false
+}
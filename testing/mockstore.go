@@ -10,8 +10,8 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/juju/loggo"
 	"github.com/juju/utils"
@@ -28,6 +28,7 @@ type MockStore struct {
 	listener                net.Listener
 	archiveBytes            []byte
 	archiveSha256           string
+	archiveSha384           string
 	Downloads               []*charm.URL
 	DownloadsNoStats        []*charm.URL
 	Authorizations          []string
@@ -36,6 +37,11 @@ type MockStore struct {
 	InfoRequestCountNoStats int
 	DefaultSeries           string
 
+	// ServeSha384 specifies that charm-info responses
+	// hold the SHA384 digest of charms as well as the
+	// SHA256 digest.
+	ServeSha384 bool
+
 	charms map[string]int
 }
 
@@ -50,6 +56,9 @@ func NewMockStore(c *gc.C, charms map[string]int) *MockStore {
 	c.Assert(err, gc.IsNil)
 	s.archiveBytes = buf.Bytes()
 	c.Assert(err, gc.IsNil)
+	digest, err := charm.NewDigest(charm.SHA384, bytes.NewReader(s.archiveBytes))
+	c.Assert(err, gc.IsNil)
+	s.archiveSha384 = digest.Hex
 	s.mux = http.NewServeMux()
 	s.mux.HandleFunc("/charm-info", s.serveInfo)
 	s.mux.HandleFunc("/charm-event", s.serveEvent)
@@ -125,6 +134,9 @@ func (s *MockStore) serveInfo(w http.ResponseWriter, r *http.Request) {
 					cr.Revision = charmURL.Revision
 				}
 				cr.Sha256 = s.archiveSha256
+				if s.ServeSha384 {
+					cr.Sha384 = s.archiveSha384
+				}
 				cr.CanonicalURL = charmURL.String()
 			} else {
 				cr.Errors = append(cr.Errors, "entry not found")
@@ -204,9 +216,5 @@ func (s *MockStore) serveCharm(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Connection", "close")
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", strconv.Itoa(len(s.archiveBytes)))
-	_, err := w.Write(s.archiveBytes)
-	if err != nil {
-		panic(err)
-	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.archiveBytes))
 }
@@ -0,0 +1,229 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// TransparencyAnnotation holds the annotation key under which
+// LogArchive records the inclusion proof of an archive.
+const TransparencyAnnotation = "transparency-proof"
+
+// ErrNoInclusionProof is returned when a charm archive
+// holds no transparency log inclusion proof.
+var ErrNoInclusionProof = errors.New("charm archive has no inclusion proof")
+
+// TransparencyLog is implemented by append-only logs, such as
+// Certificate Transparency style Merkle tree logs, in which the
+// publication of charm archives can be recorded. Once an archive
+// is logged, anyone can check that the archive they are given is
+// the one that was logged, so that a store cannot serve different
+// contents for a revision to different users, or replace a revision,
+// without it being detected.
+//
+// The log's tree is built as described by RFC 6962: the hash of a
+// leaf is the SHA256 digest of a zero byte followed by the leaf,
+// and the hash of an interior node is the SHA256 digest of a one
+// byte followed by the hashes of its children.
+type TransparencyLog interface {
+	// ID returns an identifier for the log.
+	ID() string
+
+	// Submit appends the given leaf to the log, if it is not
+	// already there, and returns a proof of its inclusion.
+	Submit(leaf []byte) (*InclusionProof, error)
+
+	// RootHash returns the root hash of the log's
+	// tree when it held the given number of leaves.
+	RootHash(treeSize int64) ([]byte, error)
+}
+
+// InclusionProof proves that a leaf is included in a
+// transparency log.
+type InclusionProof struct {
+	// LogID holds the identifier of the log.
+	LogID string `json:"log-id"`
+
+	// LeafIndex holds the index of the leaf in the log.
+	LeafIndex int64 `json:"leaf-index"`
+
+	// TreeSize holds the number of leaves in the
+	// tree the proof applies to.
+	TreeSize int64 `json:"tree-size"`
+
+	// RootHash holds the root hash of that tree.
+	RootHash []byte `json:"root-hash"`
+
+	// AuditPath holds the hashes of the nodes needed to
+	// compute the root hash from the leaf, from the bottom
+	// of the tree up.
+	AuditPath [][]byte `json:"audit-path"`
+}
+
+// Verify checks that the proof shows that the
+// given leaf is included in the tree with the proof's root hash.
+func (p *InclusionProof) Verify(leaf []byte) error {
+	if p.LeafIndex < 0 || p.LeafIndex >= p.TreeSize {
+		return fmt.Errorf("leaf index %d out of range for tree size %d", p.LeafIndex, p.TreeSize)
+	}
+	// This follows the algorithm for verifying inclusion
+	// proofs given in section 2.1.3.2 of RFC 9162.
+	fn, sn := p.LeafIndex, p.TreeSize-1
+	r := leafHash(leaf)
+	for _, h := range p.AuditPath {
+		if sn == 0 {
+			return fmt.Errorf("audit path too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(h, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, h)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return fmt.Errorf("audit path too short")
+	}
+	if !bytes.Equal(r, p.RootHash) {
+		return fmt.Errorf("root hash mismatch")
+	}
+	return nil
+}
+
+func leafHash(leaf []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(leaf)
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// TransparencyLeaf returns the leaf recorded in a transparency log
+// for the given charm, which must be a *CharmDir or a *CharmArchive.
+// It holds the charm's name and revision and a digest of its contents
+// that, like Equal, ignores file times, the order of files and files
+// that may change without changing the charm, such as annotations,
+// so that the leaf is unchanged by the addition of the inclusion
+// proof to the archive.
+func TransparencyLeaf(ch Charm) ([]byte, error) {
+	files, err := charmFileDigests(ch)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%s\x00%o\x00%s\n", path, files[path].mode, files[path].sha256)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "charm-transparency-v1\nname: %s\nrevision: %d\ncontent: sha256:%s\n",
+		ch.Meta().Name, ch.Revision(), hex.EncodeToString(h.Sum(nil)))
+	return buf.Bytes(), nil
+}
+
+// LogArchive submits the given archive to the transparency log and
+// writes a copy of the archive to w with the resulting inclusion
+// proof attached as the annotation TransparencyAnnotation. The proof
+// is verified before it is attached. It returns the proof.
+func LogArchive(a *CharmArchive, log TransparencyLog, w io.Writer) (*InclusionProof, error) {
+	leaf, err := TransparencyLeaf(a)
+	if err != nil {
+		return nil, fmt.Errorf("cannot log archive: %v", err)
+	}
+	proof, err := log.Submit(leaf)
+	if err != nil {
+		return nil, fmt.Errorf("cannot log archive: %v", err)
+	}
+	if err := proof.Verify(leaf); err != nil {
+		return nil, fmt.Errorf("cannot log archive: invalid inclusion proof from log %q: %v", log.ID(), err)
+	}
+	data, err := json.Marshal(proof)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.AddAnnotation(w, TransparencyAnnotation, string(data)); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// InclusionProof returns the transparency log inclusion proof attached
+// to the archive by LogArchive. It returns ErrNoInclusionProof if there
+// is none. The proof is not verified; use VerifyTransparency for that.
+func (a *CharmArchive) InclusionProof() (*InclusionProof, error) {
+	annotations, err := a.Annotations()
+	if err != nil {
+		return nil, err
+	}
+	data, ok := annotations[TransparencyAnnotation]
+	if !ok {
+		return nil, ErrNoInclusionProof
+	}
+	var proof InclusionProof
+	if err := json.Unmarshal([]byte(data), &proof); err != nil {
+		return nil, fmt.Errorf("invalid inclusion proof: %v", err)
+	}
+	return &proof, nil
+}
+
+// VerifyTransparency checks that the inclusion proof attached to the
+// archive proves that the archive, as it is now, was recorded in the
+// given transparency log, and returns the proof. The root hash of the
+// proof is checked against the one held by the log, so that a proof
+// made up by whoever supplied the archive is not accepted.
+//
+// If log is nil, only the consistency of the proof with the archive is
+// checked; the proof's root hash must then be checked against a root
+// hash obtained from a trusted source.
+func VerifyTransparency(a *CharmArchive, log TransparencyLog) (*InclusionProof, error) {
+	proof, err := a.InclusionProof()
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := TransparencyLeaf(a)
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify inclusion proof: %v", err)
+	}
+	if err := proof.Verify(leaf); err != nil {
+		return nil, fmt.Errorf("archive does not match inclusion proof: %v", err)
+	}
+	if log == nil {
+		return proof, nil
+	}
+	if proof.LogID != log.ID() {
+		return nil, fmt.Errorf("inclusion proof is for log %q, not %q", proof.LogID, log.ID())
+	}
+	root, err := log.RootHash(proof.TreeSize)
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify inclusion proof: %v", err)
+	}
+	if !bytes.Equal(root, proof.RootHash) {
+		return nil, fmt.Errorf("inclusion proof root hash does not match log %q at tree size %d", log.ID(), proof.TreeSize)
+	}
+	return proof, nil
+}
@@ -0,0 +1,249 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type TransparencySuite struct{}
+
+var _ = gc.Suite(&TransparencySuite{})
+
+// memoryLog is an in-memory charm.TransparencyLog implementing
+// the Merkle tree of RFC 6962 directly from its definition.
+type memoryLog struct {
+	id     string
+	leaves [][]byte
+}
+
+func (l *memoryLog) ID() string {
+	return l.id
+}
+
+func (l *memoryLog) Submit(leaf []byte) (*charm.InclusionProof, error) {
+	index := -1
+	for i, existing := range l.leaves {
+		if bytes.Equal(existing, leaf) {
+			index = i
+		}
+	}
+	if index < 0 {
+		index = len(l.leaves)
+		l.leaves = append(l.leaves, leaf)
+	}
+	return &charm.InclusionProof{
+		LogID:     l.id,
+		LeafIndex: int64(index),
+		TreeSize:  int64(len(l.leaves)),
+		RootHash:  merkleTreeHash(l.leaves),
+		AuditPath: merklePath(index, l.leaves),
+	}, nil
+}
+
+func (l *memoryLog) RootHash(treeSize int64) ([]byte, error) {
+	if treeSize > int64(len(l.leaves)) {
+		return nil, fmt.Errorf("tree size %d too large", treeSize)
+	}
+	return merkleTreeHash(l.leaves[:treeSize]), nil
+}
+
+func rfc6962Hash(prefix byte, data ...[]byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{prefix})
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// splitPoint returns the largest power of two less than n.
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func merkleTreeHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return rfc6962Hash(0, leaves[0])
+	}
+	k := splitPoint(len(leaves))
+	return rfc6962Hash(1, merkleTreeHash(leaves[:k]), merkleTreeHash(leaves[k:]))
+}
+
+func merklePath(m int, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if m < k {
+		return append(merklePath(m, leaves[:k]), merkleTreeHash(leaves[k:]))
+	}
+	return append(merklePath(m-k, leaves[k:]), merkleTreeHash(leaves[:k]))
+}
+
+// archiveWithRevision returns an archive of the given
+// charm directory with the given revision.
+func archiveWithRevision(c *gc.C, dir *charm.CharmDir, revision int) *charm.CharmArchive {
+	dir.SetRevision(revision)
+	var buf bytes.Buffer
+	err := dir.ArchiveTo(&buf)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	return archive
+}
+
+// logArchive logs the given archive, returning the annotated archive.
+func logArchive(c *gc.C, archive *charm.CharmArchive, log charm.TransparencyLog) (*charm.CharmArchive, *charm.InclusionProof) {
+	var buf bytes.Buffer
+	proof, err := charm.LogArchive(archive, log, &buf)
+	c.Assert(err, gc.IsNil)
+	logged, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	return logged, proof
+}
+
+func (s *TransparencySuite) TestLogAndVerify(c *gc.C) {
+	log := &memoryLog{id: "log.example.com"}
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	var logged []*charm.CharmArchive
+	for rev := 1; rev <= 7; rev++ {
+		archive, proof := logArchive(c, archiveWithRevision(c, dir, rev), log)
+		c.Assert(proof.LeafIndex, gc.Equals, int64(rev-1))
+		c.Assert(proof.TreeSize, gc.Equals, int64(rev))
+		logged = append(logged, archive)
+	}
+	for i, archive := range logged {
+		c.Logf("revision %d", i+1)
+		attached, err := archive.InclusionProof()
+		c.Assert(err, gc.IsNil)
+		proof, err := charm.VerifyTransparency(archive, log)
+		c.Assert(err, gc.IsNil)
+		c.Assert(proof, jc.DeepEquals, attached)
+		_, err = charm.VerifyTransparency(archive, nil)
+		c.Assert(err, gc.IsNil)
+
+		// Proofs for every tree size verify.
+		leaf, err := charm.TransparencyLeaf(archive)
+		c.Assert(err, gc.IsNil)
+		for size := i + 1; size <= len(log.leaves); size++ {
+			proof := &charm.InclusionProof{
+				LeafIndex: int64(i),
+				TreeSize:  int64(size),
+				RootHash:  merkleTreeHash(log.leaves[:size]),
+				AuditPath: merklePath(i, log.leaves[:size]),
+			}
+			c.Assert(proof.Verify(leaf), gc.IsNil)
+		}
+	}
+}
+
+func (s *TransparencySuite) TestTransparencyLeaf(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	archive := archiveWithRevision(c, dir, 3)
+	dirLeaf, err := charm.TransparencyLeaf(dir)
+	c.Assert(err, gc.IsNil)
+	archiveLeaf, err := charm.TransparencyLeaf(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(archiveLeaf), gc.Equals, string(dirLeaf))
+	c.Assert(string(archiveLeaf), gc.Matches, "charm-transparency-v1\nname: dummy\nrevision: 3\ncontent: sha256:[0-9a-f]{64}\n")
+
+	logged, _ := logArchive(c, archive, &memoryLog{id: "log"})
+	loggedLeaf, err := charm.TransparencyLeaf(logged)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(loggedLeaf), gc.Equals, string(archiveLeaf))
+}
+
+func (s *TransparencySuite) TestNoInclusionProof(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	_, err := archive.InclusionProof()
+	c.Assert(err, gc.Equals, charm.ErrNoInclusionProof)
+	_, err = charm.VerifyTransparency(archive, nil)
+	c.Assert(err, gc.Equals, charm.ErrNoInclusionProof)
+}
+
+func (s *TransparencySuite) TestRepublishedRevisionDetected(c *gc.C) {
+	log := &memoryLog{id: "log"}
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	_, proof := logArchive(c, archiveWithRevision(c, dir, 1), log)
+	logArchive(c, archiveWithRevision(c, dir, 2), log)
+
+	// A store republishes revision 1 with different
+	// contents, along with the original proof.
+	writeCharmFile(c, dir.Path, "hooks/install", "#!/bin/sh\necho pwned\n", 0755)
+	tampered := archiveWithRevision(c, dir, 1)
+	data, err := json.Marshal(proof)
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	err = tampered.AddAnnotation(&buf, charm.TransparencyAnnotation, string(data))
+	c.Assert(err, gc.IsNil)
+	tampered, err = charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	_, err = charm.VerifyTransparency(tampered, log)
+	c.Assert(err, gc.ErrorMatches, "archive does not match inclusion proof: root hash mismatch")
+}
+
+func (s *TransparencySuite) TestForgedProofDetected(c *gc.C) {
+	log := &memoryLog{id: "log"}
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	logArchive(c, archiveWithRevision(c, dir, 1), log)
+
+	// The store logs a revision in a private log of its
+	// own with the same identifier, which the public log
+	// does not hold.
+	private := &memoryLog{id: "log", leaves: append([][]byte(nil), log.leaves...)}
+	writeCharmFile(c, dir.Path, "hooks/install", "#!/bin/sh\necho pwned\n", 0755)
+	forged, _ := logArchive(c, archiveWithRevision(c, dir, 2), private)
+	_, err := charm.VerifyTransparency(forged, nil)
+	c.Assert(err, gc.IsNil)
+	_, err = charm.VerifyTransparency(forged, log)
+	c.Assert(err, gc.ErrorMatches, `cannot verify inclusion proof: tree size 2 too large`)
+
+	logArchive(c, archiveWithRevision(c, charmtesting.Charms.ClonedDir(c.MkDir(), "dummy"), 2), log)
+	_, err = charm.VerifyTransparency(forged, log)
+	c.Assert(err, gc.ErrorMatches, `inclusion proof root hash does not match log "log" at tree size 2`)
+
+	_, err = charm.VerifyTransparency(forged, &memoryLog{id: "other"})
+	c.Assert(err, gc.ErrorMatches, `inclusion proof is for log "log", not "other"`)
+}
+
+func (s *TransparencySuite) TestInvalidProofs(c *gc.C) {
+	leaf := []byte("leaf")
+	leaves := [][]byte{[]byte("a"), leaf, []byte("c")}
+	good := charm.InclusionProof{
+		LeafIndex: 1,
+		TreeSize:  3,
+		RootHash:  merkleTreeHash(leaves),
+		AuditPath: merklePath(1, leaves),
+	}
+	c.Assert(good.Verify(leaf), gc.IsNil)
+	c.Assert(good.Verify([]byte("other")), gc.ErrorMatches, "root hash mismatch")
+
+	p := good
+	p.LeafIndex = 3
+	c.Assert(p.Verify(leaf), gc.ErrorMatches, "leaf index 3 out of range for tree size 3")
+	p = good
+	p.AuditPath = p.AuditPath[:1]
+	c.Assert(p.Verify(leaf), gc.ErrorMatches, "audit path too short")
+	p = good
+	p.AuditPath = append(p.AuditPath, p.AuditPath[0])
+	c.Assert(p.Verify(leaf), gc.ErrorMatches, "audit path too long")
+}
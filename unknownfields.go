@@ -0,0 +1,71 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// unknownMetaFields returns the fields of the given unmarshaled
+// metadata that are not known to this version of the package, so
+// that they can be preserved when the metadata is written again.
+// It returns nil if there are none.
+func unknownMetaFields(raw map[interface{}]interface{}) map[string]interface{} {
+	var unknown map[string]interface{}
+	for k, v := range raw {
+		name := fmt.Sprint(k)
+		if _, ok := charmSchemaFields[name]; ok {
+			continue
+		}
+		if unknown == nil {
+			unknown = make(map[string]interface{})
+		}
+		unknown[name] = normalizeYAMLValue(v)
+	}
+	return unknown
+}
+
+// normalizeYAMLValue returns v, as unmarshaled from YAML, with every
+// map converted to a map[string]interface{}, so that it can be
+// marshaled as JSON or BSON as well as YAML.
+func normalizeYAMLValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			m[fmt.Sprint(k)] = normalizeYAMLValue(elem)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, elem := range v {
+			list[i] = normalizeYAMLValue(elem)
+		}
+		return list
+	}
+	return v
+}
+
+// checkUnknownFields checks that none of the given
+// unknown fields is in fact a known field.
+func checkUnknownFields(fields map[string]interface{}) error {
+	for _, name := range sortedUnknownFields(fields) {
+		if _, ok := charmSchemaFields[name]; ok {
+			return fmt.Errorf("known field %q held as an unknown field", name)
+		}
+	}
+	return nil
+}
+
+// sortedUnknownFields returns the names of the
+// given unknown fields in alphabetical order.
+func sortedUnknownFields(fields map[string]interface{}) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
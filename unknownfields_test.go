@@ -0,0 +1,76 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"encoding/json"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type UnknownFieldsSuite struct{}
+
+var _ = gc.Suite(&UnknownFieldsSuite{})
+
+const futureMeta = `
+name: future
+summary: s
+description: d
+containers:
+  web:
+    resource: image
+    mounts: [{storage: data, location: /srv}]
+min-juju-version: "9.0"
+`
+
+var futureFields = map[string]interface{}{
+	"containers": map[string]interface{}{
+		"web": map[string]interface{}{
+			"resource": "image",
+			"mounts": []interface{}{
+				map[string]interface{}{"storage": "data", "location": "/srv"},
+			},
+		},
+	},
+	"min-juju-version": "9.0",
+}
+
+func (s *UnknownFieldsSuite) TestReadUnknownFields(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(futureMeta))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.UnknownFields, jc.DeepEquals, futureFields)
+
+	// The fields can be marshaled as JSON.
+	_, err = json.Marshal(meta.UnknownFields)
+	c.Assert(err, gc.IsNil)
+
+	meta, err = charm.ReadMeta(strings.NewReader("name: present\nsummary: s\ndescription: d\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.UnknownFields, gc.IsNil)
+}
+
+func (s *UnknownFieldsSuite) TestUnknownFieldsSaved(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	meta, err := charm.ReadMeta(strings.NewReader(futureMeta))
+	c.Assert(err, gc.IsNil)
+	dir.SetMeta(meta)
+	err = dir.Save()
+	c.Assert(err, gc.IsNil)
+	saved, err := charm.ReadCharmDir(dir.Path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(saved.Meta().UnknownFields, jc.DeepEquals, futureFields)
+}
+
+func (s *UnknownFieldsSuite) TestKnownFieldAsUnknown(c *gc.C) {
+	meta, err := charm.ReadMeta(strings.NewReader(futureMeta))
+	c.Assert(err, gc.IsNil)
+	meta.UnknownFields["summary"] = "another"
+	err = meta.Check()
+	c.Assert(err, gc.ErrorMatches, `charm "future" has known field "summary" held as an unknown field`)
+}
@@ -0,0 +1,195 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/schema"
+)
+
+// UpgradeNote holds a note that charm authors want users to read
+// before upgrading to one of a range of revisions of the charm,
+// along with any steps that must be taken by hand.
+type UpgradeNote struct {
+	// FromRevision and ToRevision hold the first and last
+	// revision that the note applies to.
+	FromRevision int
+	ToRevision   int
+
+	// Note holds the text of the note.
+	Note string
+
+	// Steps holds the manual steps required, in order.
+	Steps []string `bson:",omitempty"`
+}
+
+// UpgradeNotes holds the notes declared in a charm's
+// upgrade-notes.yaml file.
+type UpgradeNotes struct {
+	// Notes holds the notes ordered by revision.
+	Notes []UpgradeNote
+}
+
+// ReadUpgradeNotes reads upgrade notes in YAML format. The file maps
+// a revision, or a range of revisions in the form "5-7", either to
+// the text of a note or to a map holding the note and the manual
+// steps required:
+//
+//	"3": The default port changed to 8080.
+//	"5-7":
+//	  note: The database schema changed.
+//	  steps:
+//	    - Back up the database.
+//	    - Run the migrate action after upgrading.
+func ReadUpgradeNotes(r io.Reader) (*UpgradeNotes, error) {
+	data, release, err := readYAMLSource(r)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	raw := make(map[interface{}]interface{})
+	if err := yamlUnmarshal(data, raw); err != nil {
+		return nil, err
+	}
+	v, err := upgradeNotesSchema.Coerce(raw, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upgrade notes: %v", err)
+	}
+	notes := &UpgradeNotes{
+		Notes: []UpgradeNote{},
+	}
+	for key, value := range v.(map[string]interface{}) {
+		note, err := parseUpgradeNote(key, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upgrade notes: %v", err)
+		}
+		notes.Notes = append(notes.Notes, note)
+	}
+	sort.Sort(upgradeNotesByRevision(notes.Notes))
+	return notes, nil
+}
+
+var (
+	upgradeNotesSchema = schema.StringMap(schema.Any())
+	upgradeNoteMapC    = schema.FieldMap(
+		schema.Fields{
+			"note":  schema.String(),
+			"steps": schema.List(schema.String()),
+		},
+		schema.Defaults{
+			"steps": schema.Omit,
+		},
+	)
+)
+
+// parseUpgradeNote returns the note held in value for
+// the revisions in the given range.
+func parseUpgradeNote(revisions string, value interface{}) (UpgradeNote, error) {
+	var note UpgradeNote
+	from, to := revisions, revisions
+	if i := strings.Index(revisions, "-"); i >= 0 {
+		from, to = revisions[:i], revisions[i+1:]
+	}
+	var err1, err2 error
+	note.FromRevision, err1 = strconv.Atoi(from)
+	note.ToRevision, err2 = strconv.Atoi(to)
+	if err1 != nil || err2 != nil || note.FromRevision < 0 || note.FromRevision > note.ToRevision {
+		return UpgradeNote{}, fmt.Errorf("invalid revision range %q", revisions)
+	}
+	if s, ok := value.(string); ok {
+		note.Note = s
+		return note, nil
+	}
+	m, err := upgradeNoteMapC.Coerce(value, []string{revisions})
+	if err != nil {
+		return UpgradeNote{}, err
+	}
+	fields := m.(map[string]interface{})
+	note.Note = fields["note"].(string)
+	if steps, ok := fields["steps"]; ok {
+		for _, step := range steps.([]interface{}) {
+			note.Steps = append(note.Steps, step.(string))
+		}
+	}
+	return note, nil
+}
+
+type upgradeNotesByRevision []UpgradeNote
+
+func (n upgradeNotesByRevision) Len() int      { return len(n) }
+func (n upgradeNotesByRevision) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+func (n upgradeNotesByRevision) Less(i, j int) bool {
+	if n[i].FromRevision != n[j].FromRevision {
+		return n[i].FromRevision < n[j].FromRevision
+	}
+	return n[i].ToRevision < n[j].ToRevision
+}
+
+// Between returns the notes that apply when upgrading from revision
+// from to revision to: those for a range holding a revision greater
+// than from and no greater than to. It returns no notes if to is not
+// greater than from.
+func (n *UpgradeNotes) Between(from, to int) []UpgradeNote {
+	notes := []UpgradeNote{}
+	if n == nil {
+		return notes
+	}
+	for _, note := range n.Notes {
+		if note.FromRevision <= to && note.ToRevision > from {
+			notes = append(notes, note)
+		}
+	}
+	return notes
+}
+
+// UpgradeNotes returns the notes, from the charm's upgrade-notes.yaml
+// file, that apply when upgrading from revision from to revision to,
+// so that clients can show them before upgrading. It returns no notes
+// if the charm has no such file.
+func (dir *CharmDir) UpgradeNotes(from, to int) ([]UpgradeNote, error) {
+	f, err := os.Open(dir.join(UpgradeNotesFile))
+	if os.IsNotExist(err) {
+		return []UpgradeNote{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	notes, err := ReadUpgradeNotes(f)
+	if err != nil {
+		return nil, err
+	}
+	return notes.Between(from, to), nil
+}
+
+// UpgradeNotes returns the notes, from the charm's upgrade-notes.yaml
+// file, that apply when upgrading from revision from to revision to,
+// so that clients can show them before upgrading. It returns no notes
+// if the charm has no such file.
+func (a *CharmArchive) UpgradeNotes(from, to int) ([]UpgradeNote, error) {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	r, err := zipOpenFile(zipr, UpgradeNotesFile)
+	if _, ok := err.(*noCharmArchiveFile); ok {
+		return []UpgradeNote{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	notes, err := ReadUpgradeNotes(r)
+	if err != nil {
+		return nil, err
+	}
+	return notes.Between(from, to), nil
+}
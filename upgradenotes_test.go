@@ -0,0 +1,127 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type UpgradeNotesSuite struct{}
+
+var _ = gc.Suite(&UpgradeNotesSuite{})
+
+const upgradeNotesYAML = `
+"10": Dropped support for precise.
+"3": The default port changed to 8080.
+"5-7":
+  note: The database schema changed.
+  steps:
+    - Back up the database.
+    - Run the migrate action after upgrading.
+`
+
+var (
+	portNote   = charm.UpgradeNote{FromRevision: 3, ToRevision: 3, Note: "The default port changed to 8080."}
+	schemaNote = charm.UpgradeNote{
+		FromRevision: 5,
+		ToRevision:   7,
+		Note:         "The database schema changed.",
+		Steps:        []string{"Back up the database.", "Run the migrate action after upgrading."},
+	}
+	preciseNote = charm.UpgradeNote{FromRevision: 10, ToRevision: 10, Note: "Dropped support for precise."}
+)
+
+func (s *UpgradeNotesSuite) TestReadUpgradeNotes(c *gc.C) {
+	notes, err := charm.ReadUpgradeNotes(strings.NewReader(upgradeNotesYAML))
+	c.Assert(err, gc.IsNil)
+	c.Assert(notes.Notes, jc.DeepEquals, []charm.UpgradeNote{portNote, schemaNote, preciseNote})
+}
+
+var betweenTests = []struct {
+	from, to int
+	expect   []charm.UpgradeNote
+}{
+	{1, 2, []charm.UpgradeNote{}},
+	{1, 3, []charm.UpgradeNote{portNote}},
+	{3, 4, []charm.UpgradeNote{}},
+	{2, 6, []charm.UpgradeNote{portNote, schemaNote}},
+	{6, 9, []charm.UpgradeNote{schemaNote}},
+	{7, 9, []charm.UpgradeNote{}},
+	{0, 20, []charm.UpgradeNote{portNote, schemaNote, preciseNote}},
+	{10, 3, []charm.UpgradeNote{}},
+}
+
+func (s *UpgradeNotesSuite) TestBetween(c *gc.C) {
+	notes, err := charm.ReadUpgradeNotes(strings.NewReader(upgradeNotesYAML))
+	c.Assert(err, gc.IsNil)
+	for i, test := range betweenTests {
+		c.Logf("test %d: %d to %d", i, test.from, test.to)
+		c.Assert(notes.Between(test.from, test.to), jc.DeepEquals, test.expect)
+	}
+}
+
+var invalidUpgradeNotesTests = []struct {
+	yaml string
+	err  string
+}{{
+	yaml: `"5": 42`,
+	err:  `invalid upgrade notes: 5: expected map, got int\(42\)`,
+}, {
+	yaml: `latest: Something.`,
+	err:  `invalid upgrade notes: invalid revision range "latest"`,
+}, {
+	yaml: `"7-5": Something.`,
+	err:  `invalid upgrade notes: invalid revision range "7-5"`,
+}, {
+	yaml: `"5": {steps: [Something.]}`,
+	err:  `invalid upgrade notes: 5.note: expected string, got nothing`,
+}}
+
+func (s *UpgradeNotesSuite) TestReadInvalidUpgradeNotes(c *gc.C) {
+	for i, test := range invalidUpgradeNotesTests {
+		c.Logf("test %d: %s", i, test.yaml)
+		_, err := charm.ReadUpgradeNotes(strings.NewReader(test.yaml))
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *UpgradeNotesSuite) TestCharmDirUpgradeNotes(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	notes, err := dir.UpgradeNotes(0, 10)
+	c.Assert(err, gc.IsNil)
+	c.Assert(notes, gc.HasLen, 0)
+
+	err = ioutil.WriteFile(filepath.Join(dir.Path, charm.UpgradeNotesFile), []byte(upgradeNotesYAML), 0644)
+	c.Assert(err, gc.IsNil)
+	notes, err = dir.UpgradeNotes(4, 5)
+	c.Assert(err, gc.IsNil)
+	c.Assert(notes, jc.DeepEquals, []charm.UpgradeNote{schemaNote})
+}
+
+func (s *UpgradeNotesSuite) TestCharmArchiveUpgradeNotes(c *gc.C) {
+	archive, err := charm.ReadCharmArchiveBytes(writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{charm.UpgradeNotesFile, upgradeNotesYAML},
+	))
+	c.Assert(err, gc.IsNil)
+	notes, err := archive.UpgradeNotes(8, 12)
+	c.Assert(err, gc.IsNil)
+	c.Assert(notes, jc.DeepEquals, []charm.UpgradeNote{preciseNote})
+
+	archive, err = charm.ReadCharmArchiveBytes(writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+	))
+	c.Assert(err, gc.IsNil)
+	notes, err = archive.UpgradeNotes(8, 12)
+	c.Assert(err, gc.IsNil)
+	c.Assert(notes, gc.HasLen, 0)
+}
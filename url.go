@@ -6,7 +6,6 @@ package charm
 import (
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -46,21 +45,6 @@ type Reference URL
 
 var ErrUnresolvedUrl error = fmt.Errorf("charm url series is not resolved")
 
-var (
-	validSeries = regexp.MustCompile("^[a-z]+([a-z0-9]+)?$")
-	validName   = regexp.MustCompile("^[a-z][a-z0-9]*(-[a-z0-9]*[a-z][a-z0-9]*)*$")
-)
-
-// IsValidSeries returns whether series is a valid series in charm URLs.
-func IsValidSeries(series string) bool {
-	return validSeries.MatchString(series)
-}
-
-// IsValidName returns whether name is a valid charm name.
-func IsValidName(name string) bool {
-	return validName.MatchString(name)
-}
-
 // WithRevision returns a URL equivalent to url but with Revision set
 // to revision.
 func (url *URL) WithRevision(revision int) *URL {
@@ -0,0 +1,468 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TerraformVariables returns Terraform variable blocks declaring a
+// variable for each of the configuration options, so that modules
+// wrapping the deployment of a charm can take its configuration as
+// typed inputs:
+//
+//	variable "title" {
+//	  type        = string
+//	  description = "A descriptive title used for the service."
+//	  default     = "My Title"
+//	}
+//
+// Options without a default have a null default, so that they may
+// be left unset as in the charm. Options whose names Terraform
+// reserves for module arguments, such as "count", cannot be declared
+// as variables, and cause an error.
+func (c *Config) TerraformVariables() ([]byte, error) {
+	var buf bytes.Buffer
+	for i, name := range sortedOptionNames(c.Options) {
+		option := c.Options[name]
+		if err := checkTerraformVariableName(name); err != nil {
+			return nil, fmt.Errorf("option %q %v", name, err)
+		}
+		typ, ok := optionTerraformTypes[option.Type]
+		if !ok {
+			return nil, fmt.Errorf("option %q has unknown type %q", name, option.Type)
+		}
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "variable %s {\n", hclString(name))
+		fmt.Fprintf(&buf, "  type        = %s\n", typ)
+		if option.Description != "" {
+			fmt.Fprintf(&buf, "  description = %s\n", hclString(option.Description))
+		}
+		def, err := hclValue(option.Default)
+		if err != nil {
+			return nil, fmt.Errorf("option %q has invalid default: %v", name, err)
+		}
+		fmt.Fprintf(&buf, "  default     = %s\n", def)
+		buf.WriteString("}\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// TerraformVariables returns Terraform variable blocks declaring a
+// variable for each of the actions, holding an object with an
+// attribute for each of the action's parameters:
+//
+//	variable "snapshot" {
+//	  description = "Take a snapshot of the database."
+//	  type = object({
+//	    outfile = optional(string, "foo.bz2")
+//	  })
+//	}
+//
+// Parameters the action does not require are optional attributes,
+// with any default they declare. As for configuration options,
+// actions with names Terraform reserves cause an error.
+func (a *Actions) TerraformVariables() ([]byte, error) {
+	var buf bytes.Buffer
+	for i, name := range sortedActionNames(a.ActionSpecs) {
+		spec := a.ActionSpecs[name]
+		if err := checkTerraformVariableName(name); err != nil {
+			return nil, fmt.Errorf("action %q %v", name, err)
+		}
+		typ, err := terraformType(actionParamsSchema(spec.Params), "  ")
+		if err != nil {
+			return nil, fmt.Errorf("action %q: %v", name, err)
+		}
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "variable %s {\n", hclString(name))
+		if spec.Description != "" {
+			fmt.Fprintf(&buf, "  description = %s\n", hclString(spec.Description))
+		}
+		fmt.Fprintf(&buf, "  type = %s\n", typ)
+		buf.WriteString("}\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// OpenAPISchema returns an OpenAPI 3.0 schema object describing the
+// configuration, as an object with a property for each option. It
+// returns an error if an option has a type unknown to this package.
+func (c *Config) OpenAPISchema() (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
+	for _, name := range sortedOptionNames(c.Options) {
+		option := c.Options[name]
+		typ, ok := optionOpenAPITypes[option.Type]
+		if !ok {
+			return nil, fmt.Errorf("option %q has unknown type %q", name, option.Type)
+		}
+		property := map[string]interface{}{
+			"type": typ,
+		}
+		if option.Description != "" {
+			property["description"] = option.Description
+		}
+		if option.Default != nil {
+			property["default"] = option.Default
+		}
+		properties[name] = property
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}, nil
+}
+
+// OpenAPISchemas returns an OpenAPI 3.0 schema object for the
+// parameters of each action, keyed by action name. The schemas
+// hold the parts of the actions' JSON-Schema parameters that
+// OpenAPI supports.
+func (a *Actions) OpenAPISchemas() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	for name, spec := range a.ActionSpecs {
+		schema := openAPISchema(actionParamsSchema(spec.Params))
+		if _, ok := schema["description"]; !ok && spec.Description != "" {
+			schema["description"] = spec.Description
+		}
+		schemas[name] = schema
+	}
+	return schemas
+}
+
+var (
+	optionTerraformTypes = map[string]string{
+		"string":  "string",
+		"int":     "number",
+		"float":   "number",
+		"boolean": "bool",
+	}
+	optionOpenAPITypes = map[string]string{
+		"string":  "string",
+		"int":     "integer",
+		"float":   "number",
+		"boolean": "boolean",
+	}
+)
+
+// validTerraformName matches valid Terraform identifiers.
+var validTerraformName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+// reservedTerraformNames holds the names Terraform does not allow
+// for variables, as they are used for the arguments of module blocks.
+var reservedTerraformNames = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"providers":  true,
+	"count":      true,
+	"for_each":   true,
+	"lifecycle":  true,
+	"depends_on": true,
+	"locals":     true,
+}
+
+// checkTerraformVariableName returns an error, to follow the
+// name in a message, if name cannot name a Terraform variable.
+func checkTerraformVariableName(name string) error {
+	if !validTerraformName.MatchString(name) {
+		return fmt.Errorf("is not a valid Terraform variable name")
+	}
+	if reservedTerraformNames[name] {
+		return fmt.Errorf("is a reserved Terraform variable name")
+	}
+	return nil
+}
+
+// actionParamsSchema returns the JSON-Schema object describing the
+// given action parameters. Parameters are given either as a schema
+// holding properties or, as in older charms, as a map from parameter
+// names to the schemas of the parameters.
+func actionParamsSchema(params map[string]interface{}) map[string]interface{} {
+	if _, ok := params["properties"]; ok {
+		return params
+	}
+	properties := make(map[string]interface{})
+	for name, value := range params {
+		properties[name] = value
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// terraformType returns the Terraform type constraint that best
+// describes values matching the given JSON-Schema object. Object
+// attributes are written on lines of their own, indented by
+// indent and two more spaces.
+func terraformType(schema map[string]interface{}, indent string) (string, error) {
+	typ, _ := schemaType(schema)
+	switch typ {
+	case "string":
+		return "string", nil
+	case "integer", "number":
+		return "number", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		if items == nil {
+			return "list(any)", nil
+		}
+		elem, err := terraformType(items, indent)
+		if err != nil {
+			return "", err
+		}
+		return "list(" + elem + ")", nil
+	case "object":
+		properties, _ := schema["properties"].(map[string]interface{})
+		if len(properties) == 0 {
+			return "map(any)", nil
+		}
+		required := make(map[string]bool)
+		if names, ok := schema["required"].([]interface{}); ok {
+			for _, name := range names {
+				if name, ok := name.(string); ok {
+					required[name] = true
+				}
+			}
+		}
+		var buf bytes.Buffer
+		buf.WriteString("object({\n")
+		for _, name := range sortedKeys(properties) {
+			if !validTerraformName.MatchString(name) {
+				return "", fmt.Errorf("parameter %q is not a valid Terraform attribute name", name)
+			}
+			property, _ := properties[name].(map[string]interface{})
+			typ, err := terraformType(property, indent+"  ")
+			if err != nil {
+				return "", err
+			}
+			if !required[name] {
+				if def, ok := property["default"]; ok {
+					value, err := hclValue(def)
+					if err != nil {
+						return "", fmt.Errorf("parameter %q has invalid default: %v", name, err)
+					}
+					typ = fmt.Sprintf("optional(%s, %s)", typ, value)
+				} else {
+					typ = fmt.Sprintf("optional(%s)", typ)
+				}
+			}
+			fmt.Fprintf(&buf, "%s  %s = %s\n", indent, name, typ)
+		}
+		buf.WriteString(indent + "})")
+		return buf.String(), nil
+	}
+	return "any", nil
+}
+
+// schemaType returns the type of values matching the given
+// JSON-Schema object, or the empty string if it does not
+// declare a single type, and whether it also allows null.
+func schemaType(schema map[string]interface{}) (typ string, nullable bool) {
+	switch t := schema["type"].(type) {
+	case string:
+		return t, false
+	case []interface{}:
+		for _, t := range t {
+			switch t, _ := t.(string); {
+			case t == "null":
+				nullable = true
+			case typ == "":
+				typ = t
+			default:
+				return "", nullable
+			}
+		}
+	}
+	if typ == "" {
+		if _, ok := schema["properties"]; ok {
+			typ = "object"
+		}
+	}
+	return typ, nullable
+}
+
+// openAPIKeywords holds the JSON-Schema keywords that may
+// be used in OpenAPI 3.0 schema objects with the same meaning.
+var openAPIKeywords = map[string]bool{
+	"title":            true,
+	"description":      true,
+	"default":          true,
+	"enum":             true,
+	"format":           true,
+	"multipleOf":       true,
+	"maximum":          true,
+	"exclusiveMaximum": true,
+	"minimum":          true,
+	"exclusiveMinimum": true,
+	"maxLength":        true,
+	"minLength":        true,
+	"pattern":          true,
+	"maxItems":         true,
+	"minItems":         true,
+	"uniqueItems":      true,
+	"maxProperties":    true,
+	"minProperties":    true,
+	"required":         true,
+}
+
+// openAPISchema returns the OpenAPI 3.0 schema object equivalent to
+// the given JSON-Schema object, leaving out unsupported keywords.
+// OpenAPI does not allow lists of types, so a type allowing null is
+// marked as nullable instead.
+func openAPISchema(schema map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, value := range schema {
+		if openAPIKeywords[key] {
+			result[key] = value
+		}
+	}
+	typ, nullable := schemaType(schema)
+	if typ != "" {
+		result["type"] = typ
+	}
+	if nullable {
+		result["nullable"] = true
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		converted := make(map[string]interface{})
+		for name, property := range properties {
+			if property, ok := property.(map[string]interface{}); ok {
+				converted[name] = openAPISchema(property)
+			}
+		}
+		result["properties"] = converted
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		result["items"] = openAPISchema(items)
+	}
+	switch additional := schema["additionalProperties"].(type) {
+	case bool:
+		result["additionalProperties"] = additional
+	case map[string]interface{}:
+		result["additionalProperties"] = openAPISchema(additional)
+	}
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		if schemas, ok := schema[key].([]interface{}); ok {
+			converted := make([]interface{}, 0, len(schemas))
+			for _, s := range schemas {
+				if s, ok := s.(map[string]interface{}); ok {
+					converted = append(converted, openAPISchema(s))
+				}
+			}
+			result[key] = converted
+		}
+	}
+	return result
+}
+
+// hclValue returns the HCL literal for the given value, which
+// must be nil or a value decoded from YAML or JSON.
+func hclValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return hclString(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return "", fmt.Errorf("number %v cannot be represented", v)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case []interface{}:
+		elems := make([]string, len(v))
+		for i, elem := range v {
+			s, err := hclValue(elem)
+			if err != nil {
+				return "", err
+			}
+			elems[i] = s
+		}
+		return "[" + strings.Join(elems, ", ") + "]", nil
+	case map[string]interface{}:
+		attrs := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			s, err := hclValue(v[key])
+			if err != nil {
+				return "", err
+			}
+			attrs = append(attrs, hclString(key)+" = "+s)
+		}
+		return "{" + strings.Join(attrs, ", ") + "}", nil
+	}
+	return "", fmt.Errorf("unsupported value %#v", v)
+}
+
+// hclString returns s as a quoted HCL string. Template sequences
+// are escaped so that the string is taken literally.
+func hclString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\u%04x`, r)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			buf.WriteRune(r)
+			buf.WriteRune(r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func sortedOptionNames(options map[string]Option) []string {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedActionNames(specs map[string]ActionSpec) []string {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,221 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type VarSchemaSuite struct{}
+
+var _ = gc.Suite(&VarSchemaSuite{})
+
+const varSchemaConfig = `
+options:
+  title: {default: "My ${name}", description: "A \"descriptive\" title.", type: string}
+  outlook: {type: string}
+  skill-level: {default: 3, description: A number indicating skill., type: int}
+  ratio: {default: 0.5, type: float}
+  enabled: {default: true, type: boolean}
+`
+
+func (s *VarSchemaSuite) TestConfigTerraformVariables(c *gc.C) {
+	config, err := charm.ReadConfig(strings.NewReader(varSchemaConfig))
+	c.Assert(err, gc.IsNil)
+	data, err := config.TerraformVariables()
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `variable "enabled" {
+  type        = bool
+  default     = true
+}
+
+variable "outlook" {
+  type        = string
+  default     = null
+}
+
+variable "ratio" {
+  type        = number
+  default     = 0.5
+}
+
+variable "skill-level" {
+  type        = number
+  description = "A number indicating skill."
+  default     = 3
+}
+
+variable "title" {
+  type        = string
+  description = "A \"descriptive\" title."
+  default     = "My $${name}"
+}
+`)
+}
+
+func (s *VarSchemaSuite) TestConfigTerraformVariablesInvalidName(c *gc.C) {
+	config, err := charm.ReadConfig(strings.NewReader("options:\n  1st: {type: string}\n"))
+	c.Assert(err, gc.IsNil)
+	_, err = config.TerraformVariables()
+	c.Assert(err, gc.ErrorMatches, `option "1st" is not a valid Terraform variable name`)
+}
+
+func (s *VarSchemaSuite) TestTerraformVariablesReservedName(c *gc.C) {
+	for _, name := range []string{"source", "version", "providers", "count", "for_each", "lifecycle", "depends_on", "locals"} {
+		c.Logf("name %q", name)
+		config, err := charm.ReadConfig(strings.NewReader("options:\n  " + name + ": {type: string}\n"))
+		c.Assert(err, gc.IsNil)
+		_, err = config.TerraformVariables()
+		c.Assert(err, gc.ErrorMatches, `option "`+name+`" is a reserved Terraform variable name`)
+
+		actions := &charm.Actions{
+			ActionSpecs: map[string]charm.ActionSpec{
+				name: {Description: "d"},
+			},
+		}
+		_, err = actions.TerraformVariables()
+		c.Assert(err, gc.ErrorMatches, `action "`+name+`" is a reserved Terraform variable name`)
+	}
+}
+
+func (s *VarSchemaSuite) TestConfigOpenAPISchema(c *gc.C) {
+	config, err := charm.ReadConfig(strings.NewReader(varSchemaConfig))
+	c.Assert(err, gc.IsNil)
+	schema, err := config.OpenAPISchema()
+	c.Assert(err, gc.IsNil)
+	c.Assert(schema, jc.DeepEquals, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": `A "descriptive" title.`,
+				"default":     "My ${name}",
+			},
+			"outlook": map[string]interface{}{
+				"type": "string",
+			},
+			"skill-level": map[string]interface{}{
+				"type":        "integer",
+				"description": "A number indicating skill.",
+				"default":     int64(3),
+			},
+			"ratio": map[string]interface{}{
+				"type":    "number",
+				"default": 0.5,
+			},
+			"enabled": map[string]interface{}{
+				"type":    "boolean",
+				"default": true,
+			},
+		},
+		"additionalProperties": false,
+	})
+}
+
+func (s *VarSchemaSuite) TestConfigOpenAPISchemaUnknownType(c *gc.C) {
+	config := &charm.Config{
+		Options: map[string]charm.Option{
+			"colour": {Type: "colour"},
+		},
+	}
+	_, err := config.OpenAPISchema()
+	c.Assert(err, gc.ErrorMatches, `option "colour" has unknown type "colour"`)
+}
+
+const varSchemaActions = `
+actions:
+  backup:
+    description: Back up the database.
+    params:
+      type: object
+      properties:
+        target:
+          type: string
+        compression:
+          type: object
+          properties:
+            level: {type: integer, default: 6}
+            kind: {type: [string, "null"], enum: [gzip, xz]}
+        tags:
+          type: array
+          items: {type: string}
+          default: [daily]
+      required: [target]
+      additionalProperties: false
+`
+
+func (s *VarSchemaSuite) TestActionsTerraformVariables(c *gc.C) {
+	actions, err := charm.ReadActionsYaml(strings.NewReader(varSchemaActions))
+	c.Assert(err, gc.IsNil)
+	data, err := actions.TerraformVariables()
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `variable "backup" {
+  description = "Back up the database."
+  type = object({
+    compression = optional(object({
+      kind = optional(string)
+      level = optional(number, 6)
+    }))
+    tags = optional(list(string), ["daily"])
+    target = string
+  })
+}
+`)
+}
+
+func (s *VarSchemaSuite) TestActionsTerraformVariablesPropertyMap(c *gc.C) {
+	actions := charmtesting.Charms.CharmDir("dummy").Actions()
+	data, err := actions.TerraformVariables()
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, `variable "snapshot" {
+  description = "Take a snapshot of the database."
+  type = object({
+    outfile = optional(string, "foo.bz2")
+  })
+}
+`)
+}
+
+func (s *VarSchemaSuite) TestActionsOpenAPISchemas(c *gc.C) {
+	actions, err := charm.ReadActionsYaml(strings.NewReader(varSchemaActions))
+	c.Assert(err, gc.IsNil)
+	c.Assert(actions.OpenAPISchemas(), jc.DeepEquals, map[string]interface{}{
+		"backup": map[string]interface{}{
+			"description": "Back up the database.",
+			"type":        "object",
+			"properties": map[string]interface{}{
+				"target": map[string]interface{}{
+					"type": "string",
+				},
+				"compression": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"level": map[string]interface{}{
+							"type":    "integer",
+							"default": 6,
+						},
+						"kind": map[string]interface{}{
+							"type":     "string",
+							"nullable": true,
+							"enum":     []interface{}{"gzip", "xz"},
+						},
+					},
+				},
+				"tags": map[string]interface{}{
+					"type":    "array",
+					"items":   map[string]interface{}{"type": "string"},
+					"default": []interface{}{"daily"},
+				},
+			},
+			"required":             []interface{}{"target"},
+			"additionalProperties": false,
+		},
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrNoVCS is returned by VCSVersion when a charm directory
+// is not within a version control work tree.
+var ErrNoVCS = errors.New("charm directory is not under version control")
+
+// Version describes the version of the source a charm
+// was built from, as recorded by version control.
+type Version struct {
+	// Commit holds the identifier of the commit
+	// checked out, such as a git commit hash.
+	Commit string
+
+	// Dirty holds whether the charm directory holds changes
+	// that have not been committed, including files not
+	// known to version control that are not ignored.
+	Dirty bool
+
+	// Tag holds a tag naming the commit, if any.
+	Tag string
+}
+
+// String returns the version in the form written to the
+// version file: the tag, or the commit abbreviated to 12
+// characters if there is no tag, followed by "-dirty" if the
+// work tree is dirty.
+func (v Version) String() string {
+	s := v.Tag
+	if s == "" {
+		s = v.Commit
+		if len(s) > 12 {
+			s = s[:12]
+		}
+	}
+	if v.Dirty {
+		s += "-dirty"
+	}
+	return s
+}
+
+// VCSVersion returns the version of the charm directory's source as
+// recorded by git. It returns ErrNoVCS if the directory is not within
+// a git work tree, or if git is not installed. If several tags name
+// the commit, the first in alphabetical order is used.
+func (dir *CharmDir) VCSVersion() (*Version, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, ErrNoVCS
+	}
+	inTree, err := dir.git("rev-parse", "--is-inside-work-tree")
+	if err != nil || inTree != "true" {
+		return nil, ErrNoVCS
+	}
+	commit, err := dir.git("rev-parse", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read git commit: %v", err)
+	}
+	// Only changes within the charm directory count, as
+	// it may be one of many in the same repository.
+	status, err := dir.git("status", "--porcelain", "--", ".")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read git status: %v", err)
+	}
+	tags, err := dir.git("tag", "--points-at", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read git tags: %v", err)
+	}
+	v := &Version{
+		Commit: commit,
+		Dirty:  status != "",
+	}
+	if tags != "" {
+		v.Tag = strings.Split(tags, "\n")[0]
+	}
+	return v, nil
+}
+
+// git runs git with the given arguments in the charm directory,
+// returning its output with leading and trailing space removed.
+func (dir *CharmDir) git(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir.Path
+	// Without this, git status refreshes the index, taking a
+	// lock that can make git commands run concurrently in the
+	// same repository, such as by an editor, fail. The variable
+	// is ignored by versions of git that take no optional locks.
+	cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type VCSSuite struct{}
+
+var _ = gc.Suite(&VCSSuite{})
+
+func (s *VCSSuite) SetUpTest(c *gc.C) {
+	if _, err := exec.LookPath("git"); err != nil {
+		c.Skip("git not installed")
+	}
+}
+
+// runGit runs git with the given arguments in dir,
+// returning its output.
+func runGit(c *gc.C, dir string, args ...string) string {
+	args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	c.Assert(err, gc.IsNil, gc.Commentf("git %s: %s", strings.Join(args, " "), out))
+	return strings.TrimSpace(string(out))
+}
+
+// gitCharmDir returns a charm directory at the root of
+// a new git repository holding a single commit.
+func gitCharmDir(c *gc.C) *charm.CharmDir {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	runGit(c, dir.Path, "init", "-q")
+	runGit(c, dir.Path, "add", "-A")
+	runGit(c, dir.Path, "commit", "-q", "-m", "initial")
+	return dir
+}
+
+func (s *VCSSuite) TestVCSVersion(c *gc.C) {
+	dir := gitCharmDir(c)
+	commit := runGit(c, dir.Path, "rev-parse", "HEAD")
+	v, err := dir.VCSVersion()
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, jc.DeepEquals, &charm.Version{Commit: commit})
+	c.Assert(v.String(), gc.Equals, commit[:12])
+
+	runGit(c, dir.Path, "tag", "v1.1")
+	runGit(c, dir.Path, "tag", "v1.0")
+	writeCharmFile(c, dir.Path, "src/new.c", "", 0644)
+	v, err = dir.VCSVersion()
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, jc.DeepEquals, &charm.Version{Commit: commit, Dirty: true, Tag: "v1.0"})
+	c.Assert(v.String(), gc.Equals, "v1.0-dirty")
+}
+
+func (s *VCSSuite) TestVCSVersionLeavesIndex(c *gc.C) {
+	dir := gitCharmDir(c)
+	index := filepath.Join(dir.Path, ".git", "index")
+	before, err := ioutil.ReadFile(index)
+	c.Assert(err, gc.IsNil)
+	// Changing the time of a file leaves the index stale,
+	// which git status would otherwise refresh.
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(filepath.Join(dir.Path, "metadata.yaml"), future, future)
+	c.Assert(err, gc.IsNil)
+	_, err = dir.VCSVersion()
+	c.Assert(err, gc.IsNil)
+	after, err := ioutil.ReadFile(index)
+	c.Assert(err, gc.IsNil)
+	c.Assert(after, gc.DeepEquals, before)
+}
+
+func (s *VCSSuite) TestVCSVersionSubdirectory(c *gc.C) {
+	root := c.MkDir()
+	dir := charmtesting.Charms.ClonedDir(root, "dummy")
+	runGit(c, root, "init", "-q")
+	runGit(c, root, "add", "-A")
+	runGit(c, root, "commit", "-q", "-m", "initial")
+
+	// Changes outside the charm directory do not make it dirty.
+	err := ioutil.WriteFile(filepath.Join(root, "other"), nil, 0644)
+	c.Assert(err, gc.IsNil)
+	v, err := dir.VCSVersion()
+	c.Assert(err, gc.IsNil)
+	c.Assert(v.Dirty, jc.IsFalse)
+}
+
+func (s *VCSSuite) TestVCSVersionNotUnderVCS(c *gc.C) {
+	dir := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	_, err := dir.VCSVersion()
+	c.Assert(err, gc.Equals, charm.ErrNoVCS)
+}
+
+func (s *VCSSuite) TestArchiveWriteVersion(c *gc.C) {
+	dir := gitCharmDir(c)
+	runGit(c, dir.Path, "tag", "v2.0")
+	var buf bytes.Buffer
+	err := dir.ArchiveToWithOptions(&buf, charm.ArchiveOptions{WriteVersion: true})
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	expanded := c.MkDir()
+	err = archive.ExpandTo(expanded)
+	c.Assert(err, gc.IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(expanded, charm.VersionFile))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "v2.0\n")
+
+	// A version file in the directory is replaced.
+	writeCharmFile(c, dir.Path, charm.VersionFile, "stale\n", 0644)
+	buf.Reset()
+	err = dir.ArchiveToWithOptions(&buf, charm.ArchiveOptions{WriteVersion: true})
+	c.Assert(err, gc.IsNil)
+	archive, err = charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	manifest, err := archive.Manifest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(manifest.Contains(charm.VersionFile), jc.IsTrue)
+	err = archive.Verify()
+	c.Assert(err, gc.IsNil)
+	expanded = c.MkDir()
+	err = archive.ExpandTo(expanded)
+	c.Assert(err, gc.IsNil)
+	data, err = ioutil.ReadFile(filepath.Join(expanded, charm.VersionFile))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "v2.0-dirty\n")
+
+	notGit := charmtesting.Charms.ClonedDir(c.MkDir(), "dummy")
+	err = notGit.ArchiveToWithOptions(&buf, charm.ArchiveOptions{WriteVersion: true})
+	c.Assert(err, gc.ErrorMatches, "cannot write version: charm directory is not under version control")
+}
@@ -0,0 +1,145 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// MemberError describes a problem with a file in a charm archive.
+type MemberError struct {
+	// Path holds the path of the file in the archive.
+	Path string
+
+	// Err holds the problem found.
+	Err error
+}
+
+func (e *MemberError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// maxVerifiedFileSize holds the size of the largest file
+// whose contents Verify checks.
+var maxVerifiedFileSize int64 = 1 << 30
+
+// memberDecoders holds the functions used to decode the
+// charm's own files when verifying an archive.
+var memberDecoders = map[string]func(r io.Reader) error{
+	MetadataFile: func(r io.Reader) error {
+		_, err := ReadMeta(r)
+		return err
+	},
+	MetricsFile: func(r io.Reader) error {
+		_, err := ReadMetrics(r)
+		return err
+	},
+	RevisionFile: func(r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err
+	},
+}
+
+// Verify checks the integrity of the archive without expanding it:
+// that the contents of every file match their checksums, that no file
+// is named twice or lies outside the charm, that metadata.yaml exists,
+// and that it and the charm's other files, such as config.yaml,
+// decode. It also checks any statistics recorded in the archive.
+// If problems are found, Verify returns a *VerificationError
+// holding an error for each, each a *MemberError if it concerns
+// a single file.
+func (a *CharmArchive) Verify() (err error) {
+	defer func() {
+		auditVerify(a, err)
+	}()
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return err
+	}
+	defer zipr.Close()
+	var errs []error
+	seen := make(map[string]bool)
+	// The archive decodes its config.yaml and actions.yaml
+	// itself, so that they are read once.
+	loaders := map[string]func() error{
+		ConfigFile: func() error {
+			_, err := a.LoadConfig()
+			return err
+		},
+		ActionsFile: func() error {
+			_, err := a.LoadActions()
+			return err
+		},
+	}
+	sw := newStatsWriter()
+	for _, fh := range zipr.File {
+		name := fh.Name
+		if seen[name] {
+			errs = append(errs, &MemberError{name, fmt.Errorf("duplicate file")})
+			continue
+		}
+		seen[name] = true
+		if clean := path.Clean(name); path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			errs = append(errs, &MemberError{name, fmt.Errorf("path outside charm")})
+			continue
+		}
+		if fh.Mode().IsDir() {
+			continue
+		}
+		r, err := fh.Open()
+		if err != nil {
+			errs = append(errs, &MemberError{name, err})
+			continue
+		}
+		// Only the files that are decoded are kept in memory.
+		var data bytes.Buffer
+		w := sw.addFile(name)
+		decode := memberDecoders[name]
+		if decode != nil {
+			w = io.MultiWriter(w, &data)
+		}
+		// Reading to the end checks the checksum.
+		n, err := io.Copy(w, io.LimitReader(r, maxVerifiedFileSize+1))
+		r.Close()
+		if err == nil && n > maxVerifiedFileSize {
+			err = fmt.Errorf("file larger than %d bytes", maxVerifiedFileSize)
+		}
+		if err != nil {
+			errs = append(errs, &MemberError{name, err})
+			continue
+		}
+		if decode != nil {
+			if err := decode(&data); err != nil {
+				errs = append(errs, &MemberError{name, err})
+			}
+		}
+		if load := loaders[name]; load != nil {
+			if err := load(); err != nil {
+				errs = append(errs, &MemberError{name, err})
+			}
+		}
+	}
+	if !seen[MetadataFile] {
+		errs = append(errs, &MemberError{MetadataFile, fmt.Errorf("file not found")})
+	}
+	if a.stats != nil && len(errs) == 0 {
+		if *a.stats != sw.result() {
+			errs = append(errs, fmt.Errorf("archive statistics do not match its contents"))
+		}
+	}
+	if len(errs) > 0 {
+		return &VerificationError{errs}
+	}
+	return nil
+}
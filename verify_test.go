@@ -0,0 +1,162 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type VerifySuite struct{}
+
+var _ = gc.Suite(&VerifySuite{})
+
+func (s *VerifySuite) TestVerifyIntact(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	c.Assert(archive.Verify(), gc.IsNil)
+}
+
+// writeZip returns a zip archive holding the given files, stored
+// uncompressed so that their contents can be found in the archive.
+func writeZip(c *gc.C, files ...[2]string) []byte {
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zipw.CreateHeader(&zip.FileHeader{Name: f[0], Method: zip.Store})
+		c.Assert(err, gc.IsNil)
+		_, err = w.Write([]byte(f[1]))
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(zipw.Close(), gc.IsNil)
+	return buf.Bytes()
+}
+
+const verifyMeta = "name: verified\nsummary: s\ndescription: d\n"
+
+func (s *VerifySuite) TestVerifyCorruptMember(c *gc.C) {
+	data := writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"hooks/install", "#!/bin/sh\necho installing\n"},
+	)
+	// Corrupt the contents of the hook.
+	i := bytes.Index(data, []byte("installing"))
+	c.Assert(i > 0, jc.IsTrue)
+	data[i] = 'X'
+	archive, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	err = archive.Verify()
+	c.Assert(err, gc.FitsTypeOf, (*charm.VerificationError)(nil))
+	errs := err.(*charm.VerificationError).Errors
+	c.Assert(errs, gc.HasLen, 1)
+	c.Assert(errs[0], gc.FitsTypeOf, (*charm.MemberError)(nil))
+	c.Assert(errs[0].(*charm.MemberError).Path, gc.Equals, "hooks/install")
+	c.Assert(errs[0], gc.ErrorMatches, "hooks/install: zip: checksum error")
+}
+
+func (s *VerifySuite) TestVerifyUndecodableMembers(c *gc.C) {
+	data := writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"config.yaml", "options: {}\n"},
+		[2]string{"revision", "1\n"},
+	)
+	archive, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Verify(), gc.IsNil)
+
+	// An archive holding files that do not decode cannot be read,
+	// so replace the contents of a valid one.
+	data = writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"config.yaml", "options: 42\n"},
+		[2]string{"revision", "one"},
+		[2]string{"../escape", "x"},
+		[2]string{"revision", "1"},
+	)
+	err = verifyBytes(c, data)
+	c.Assert(err, gc.FitsTypeOf, (*charm.VerificationError)(nil))
+	var paths []string
+	for _, e := range err.(*charm.VerificationError).Errors {
+		paths = append(paths, e.(*charm.MemberError).Path)
+	}
+	c.Assert(paths, jc.DeepEquals, []string{"config.yaml", "revision", "../escape", "revision"})
+	c.Assert(err, gc.ErrorMatches, `(?s)config.yaml: .* \(and 3 more errors\)`)
+}
+
+func (s *VerifySuite) TestVerifyInvalidActions(c *gc.C) {
+	// The actions are not validated when the archive is read.
+	data := writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"actions.yaml", "snapshot: [oops\n"},
+	)
+	archive, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	err = archive.Verify()
+	c.Assert(err, gc.FitsTypeOf, (*charm.VerificationError)(nil))
+	c.Assert(err, gc.ErrorMatches, `actions.yaml: .*`)
+}
+
+func (s *VerifySuite) TestVerifyLargeFile(c *gc.C) {
+	defer charm.PatchMaxVerifiedFileSize(100)()
+	data := writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"README", strings.Repeat("x", 100)},
+		[2]string{"hooks/install", strings.Repeat("x", 101)},
+	)
+	archive, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	err = archive.Verify()
+	c.Assert(err, gc.ErrorMatches, "hooks/install: file larger than 100 bytes")
+}
+
+// verifyBytes verifies an archive that cannot be read by
+// ReadCharmArchiveBytes, by reading a valid archive and
+// then replacing its contents on disk.
+func verifyBytes(c *gc.C, data []byte) error {
+	path := filepath.Join(c.MkDir(), "archive.charm")
+	err := ioutil.WriteFile(path, writeZip(c, [2]string{"metadata.yaml", verifyMeta}), 0644)
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchive(path)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(path, data, 0644)
+	c.Assert(err, gc.IsNil)
+	return archive.Verify()
+}
+
+func (s *VerifySuite) TestVerifyMissingMetadata(c *gc.C) {
+	err := verifyBytes(c, writeZip(c, [2]string{"README", "hello"}))
+	c.Assert(err, gc.ErrorMatches, "metadata.yaml: file not found")
+}
+
+func (s *VerifySuite) TestVerifyStats(c *gc.C) {
+	dir := charmtesting.Charms.CharmDir("dummy")
+	var buf bytes.Buffer
+	c.Assert(dir.ArchiveTo(&buf), gc.IsNil)
+	data := buf.Bytes()
+	archive, err := charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Verify(), gc.IsNil)
+
+	// Tamper with the recorded content digest, which unlike the
+	// file count and size is not checked when the archive is read.
+	i := bytes.Index(data, []byte(`"content-sha256":"`))
+	c.Assert(i > 0, jc.IsTrue)
+	i += len(`"content-sha256":"`)
+	if data[i] == '0' {
+		data[i] = '1'
+	} else {
+		data[i] = '0'
+	}
+	archive, err = charm.ReadCharmArchiveBytes(data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(archive.Verify(), gc.ErrorMatches, "archive statistics do not match its contents")
+}
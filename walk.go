@@ -0,0 +1,68 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Entry describes a member of a charm archive.
+type Entry struct {
+	// Path holds the slash-separated path of the
+	// member relative to the charm root.
+	Path string
+
+	// Mode holds the member's mode, including its type.
+	Mode os.FileMode
+
+	// Size holds the uncompressed size of the member.
+	Size int64
+
+	// ModTime holds the modification time of the member.
+	ModTime time.Time
+}
+
+// Walk calls fn for each member of the archive in the order in which
+// the members are stored, passing a reader of the member's contents.
+// Directories are passed an empty reader, and symbolic links a reader
+// of the link's target. The reader is only valid until fn returns.
+// Members are read straight from the archive, so each is decompressed
+// exactly once and nothing is written to disk.
+//
+// If fn returns an error, Walk stops and returns that error.
+func (a *CharmArchive) Walk(fn func(Entry, io.Reader) error) error {
+	zipr, err := a.zopen.openZip()
+	if err != nil {
+		return err
+	}
+	defer zipr.Close()
+	for _, fh := range zipr.File {
+		entry := Entry{
+			Path:    strings.TrimSuffix(fh.Name, "/"),
+			Mode:    fh.Mode(),
+			Size:    int64(fh.UncompressedSize64),
+			ModTime: fh.ModTime(),
+		}
+		if entry.Mode.IsDir() {
+			if err := fn(entry, strings.NewReader("")); err != nil {
+				return err
+			}
+			continue
+		}
+		r, err := fh.Open()
+		if err != nil {
+			return fmt.Errorf("cannot read %q: %v", fh.Name, err)
+		}
+		err = fn(entry, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type WalkSuite struct{}
+
+var _ = gc.Suite(&WalkSuite{})
+
+func (s *WalkSuite) TestWalk(c *gc.C) {
+	archive, err := charm.ReadCharmArchiveBytes(writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"hooks/", ""},
+		[2]string{"hooks/install", "#!/bin/sh\n"},
+		[2]string{"README.md", "Read me."},
+	))
+	c.Assert(err, gc.IsNil)
+	var paths []string
+	contents := make(map[string]string)
+	err = archive.Walk(func(e charm.Entry, r io.Reader) error {
+		paths = append(paths, e.Path)
+		data, err := ioutil.ReadAll(r)
+		c.Assert(err, gc.IsNil)
+		c.Assert(e.Size, gc.Equals, int64(len(data)))
+		contents[e.Path] = string(data)
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(paths, jc.DeepEquals, []string{"metadata.yaml", "hooks", "hooks/install", "README.md"})
+	c.Assert(contents, jc.DeepEquals, map[string]string{
+		"metadata.yaml": verifyMeta,
+		"hooks":         "",
+		"hooks/install": "#!/bin/sh\n",
+		"README.md":     "Read me.",
+	})
+}
+
+func (s *WalkSuite) TestWalkMatchesExpandTo(c *gc.C) {
+	archive := charmtesting.Charms.CharmArchive(c.MkDir(), "dummy")
+	dir := c.MkDir()
+	err := archive.ExpandTo(dir)
+	c.Assert(err, gc.IsNil)
+	count := 0
+	err = archive.Walk(func(e charm.Entry, r io.Reader) error {
+		count++
+		info, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(e.Path)))
+		c.Assert(err, gc.IsNil)
+		c.Assert(info.IsDir(), gc.Equals, e.Mode.IsDir())
+		if e.Mode.IsRegular() {
+			data, err := ioutil.ReadAll(r)
+			c.Assert(err, gc.IsNil)
+			expanded, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(e.Path)))
+			c.Assert(err, gc.IsNil)
+			c.Assert(string(data), gc.Equals, string(expanded))
+		}
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(count > 0, jc.IsTrue)
+}
+
+func (s *WalkSuite) TestWalkStops(c *gc.C) {
+	archive, err := charm.ReadCharmArchiveBytes(writeZip(c,
+		[2]string{"metadata.yaml", verifyMeta},
+		[2]string{"README.md", "Read me."},
+	))
+	c.Assert(err, gc.IsNil)
+	stop := errors.New("stop")
+	var paths []string
+	err = archive.Walk(func(e charm.Entry, r io.Reader) error {
+		paths = append(paths, e.Path)
+		return stop
+	})
+	c.Assert(err, gc.Equals, stop)
+	c.Assert(paths, jc.DeepEquals, []string{"metadata.yaml"})
+}
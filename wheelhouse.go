@@ -0,0 +1,322 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// PythonDependency describes a Python package bundled in a charm,
+// either as a wheel or source distribution in the charm's wheelhouse
+// directory, or installed in its venv directory.
+type PythonDependency struct {
+	// Name and Version hold the name and version of the package.
+	Name    string
+	Version string
+
+	// Path holds the slash-separated path, relative to the root
+	// of the charm, of the file or directory holding the package.
+	Path string
+
+	// Installed holds whether the package is installed in
+	// the venv directory rather than held in the wheelhouse.
+	Installed bool
+
+	// Wheel holds the compatibility tags of the package if
+	// it is a wheel, and is nil otherwise.
+	Wheel *WheelTags
+}
+
+// WheelTags holds the compatibility tags from the name of a wheel,
+// as defined by PEP 425. Each holds one or more dot-separated tags.
+type WheelTags struct {
+	Python   string
+	ABI      string
+	Platform string
+}
+
+// WheelProblem describes a wheel that cannot be installed
+// on the bases or series declared by its charm.
+type WheelProblem struct {
+	// Path holds the slash-separated path of the wheel.
+	Path string
+
+	// Reason describes the problem.
+	Reason string
+}
+
+// basePythonVersions holds the versions of Python, in the form
+// "major.minor", provided by each known base, keyed by the base
+// without its architecture.
+var basePythonVersions = map[string][]string{
+	"ubuntu@12.04": {"2.7", "3.2"},
+	"ubuntu@14.04": {"2.7", "3.4"},
+	"ubuntu@14.10": {"2.7", "3.4"},
+	"ubuntu@15.04": {"2.7", "3.4"},
+}
+
+// PythonDependencies returns the Python packages bundled in the
+// given charm, which must be a *CharmDir or a *CharmArchive, sorted
+// by path.
+func PythonDependencies(ch Charm) ([]PythonDependency, error) {
+	zipr, err := openCharmZip(ch)
+	if err != nil {
+		return nil, err
+	}
+	defer zipr.Close()
+	var deps []PythonDependency
+	seen := make(map[string]bool)
+	for _, fh := range zipr.File {
+		dep, ok := pythonDependency(fh.Name)
+		if ok && !seen[dep.Path] {
+			seen[dep.Path] = true
+			deps = append(deps, dep)
+		}
+	}
+	sort.Sort(dependenciesByPath(deps))
+	return deps, nil
+}
+
+// pythonDependency returns the Python package held in, or
+// installed in a directory containing, the file with the
+// given path, if any.
+func pythonDependency(name string) (PythonDependency, bool) {
+	switch {
+	case strings.HasPrefix(name, "wheelhouse/") && !strings.HasSuffix(name, "/"):
+		base := path.Base(name)
+		if tags, pkgName, version, ok := parseWheelName(base); ok {
+			return PythonDependency{
+				Name:    pkgName,
+				Version: version,
+				Path:    name,
+				Wheel:   tags,
+			}, true
+		}
+		if isSourceDist(name) {
+			pkgName, version := splitNameVersion(trimArchiveSuffix(base))
+			return PythonDependency{
+				Name:    pkgName,
+				Version: version,
+				Path:    name,
+			}, true
+		}
+	case strings.HasPrefix(name, "venv/"):
+		parts := strings.Split(name, "/")
+		for i, part := range parts[:len(parts)-1] {
+			if strings.HasSuffix(part, ".dist-info") || strings.HasSuffix(part, ".egg-info") {
+				pkgName, version := splitNameVersion(strings.TrimSuffix(strings.TrimSuffix(part, ".dist-info"), ".egg-info"))
+				return PythonDependency{
+					Name:      pkgName,
+					Version:   version,
+					Path:      strings.Join(parts[:i+1], "/"),
+					Installed: true,
+				}, true
+			}
+		}
+	}
+	return PythonDependency{}, false
+}
+
+// parseWheelName parses the name of a wheel, of the form
+// name-version(-build)?-python-abi-platform.whl.
+func parseWheelName(base string) (tags *WheelTags, name, version string, ok bool) {
+	if !strings.HasSuffix(base, ".whl") {
+		return nil, "", "", false
+	}
+	parts := strings.Split(strings.TrimSuffix(base, ".whl"), "-")
+	if len(parts) != 5 && len(parts) != 6 {
+		return nil, "", "", false
+	}
+	n := len(parts)
+	return &WheelTags{
+		Python:   parts[n-3],
+		ABI:      parts[n-2],
+		Platform: parts[n-1],
+	}, parts[0], parts[1], true
+}
+
+// CheckWheels returns the wheels in the wheelhouse of the given charm,
+// which must be a *CharmDir or a *CharmArchive, that cannot be
+// installed on the bases or series declared in its metadata: those
+// built for platforms other than Linux, and those built for versions
+// of Python not provided by a known base.
+func CheckWheels(ch Charm) ([]WheelProblem, error) {
+	deps, err := PythonDependencies(ch)
+	if err != nil {
+		return nil, err
+	}
+	var problems []WheelProblem
+	for _, dep := range deps {
+		if dep.Wheel == nil {
+			continue
+		}
+		if reason := wheelProblem(dep.Wheel, ch.Meta().AllBases()); reason != "" {
+			problems = append(problems, WheelProblem{
+				Path:   dep.Path,
+				Reason: reason,
+			})
+		}
+	}
+	return problems, nil
+}
+
+// wheelProblem returns why a wheel with the given tags cannot be
+// installed on one of the given bases, or the empty string if it can
+// be installed on all of them.
+func wheelProblem(tags *WheelTags, bases []Base) string {
+	linux := false
+	for _, platform := range strings.Split(tags.Platform, ".") {
+		if platform == "any" || strings.HasPrefix(platform, "linux_") || strings.HasPrefix(platform, "manylinux") {
+			linux = true
+		}
+	}
+	if !linux {
+		return fmt.Sprintf("platform %q is not Linux", tags.Platform)
+	}
+	for _, b := range bases {
+		b.Arch = ""
+		versions, ok := basePythonVersions[b.String()]
+		if !ok || pythonTagsMatch(tags, versions) {
+			continue
+		}
+		name := fmt.Sprintf("base %q", b)
+		if series := b.Series(); series != "" {
+			name = fmt.Sprintf("series %q", series)
+		}
+		return fmt.Sprintf("python %q is not provided by %s (provides %s)", tags.Python, name, strings.Join(versions, ", "))
+	}
+	return ""
+}
+
+// pythonTagsMatch reports whether a wheel with the given tags can
+// be installed on one of the given versions of Python.
+func pythonTagsMatch(tags *WheelTags, versions []string) bool {
+	for _, tag := range strings.Split(tags.Python, ".") {
+		for _, version := range versions {
+			if pythonTagMatches(tag, tags.ABI, version) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pythonTagMatches reports whether a wheel with the given python tag
+// and ABI tag can be installed on the given version of Python.
+func pythonTagMatches(tag, abi, version string) bool {
+	if len(tag) < 3 {
+		return false
+	}
+	impl, tagVersion := tag[:2], tag[2:]
+	if impl != "py" && impl != "cp" {
+		return false
+	}
+	major, minor := version[:strings.Index(version, ".")], version[strings.Index(version, ".")+1:]
+	switch {
+	case tagVersion == major:
+		// A generic tag such as py3.
+		return impl == "py"
+	case !strings.HasPrefix(tagVersion, major):
+		return false
+	case tagVersion[len(major):] == minor:
+		return true
+	case impl == "py" || abi == "abi3" || abi == "none":
+		// Pure Python and stable ABI wheels work on
+		// later versions with the same major version.
+		return minorAtLeast(minor, tagVersion[len(major):])
+	}
+	return false
+}
+
+func minorAtLeast(minor, want string) bool {
+	var m, w int
+	if _, err := fmt.Sscan(minor, &m); err != nil {
+		return false
+	}
+	if _, err := fmt.Sscan(want, &w); err != nil {
+		return false
+	}
+	return m >= w
+}
+
+// ArchiveOptions holds options for CharmDir.ArchiveToWithOptions.
+type ArchiveOptions struct {
+	// ExcludeIncompatibleWheels specifies that wheels that
+	// CheckWheels reports as unusable are left out of the archive.
+	ExcludeIncompatibleWheels bool
+
+	// Architecture, if set, specifies that the archive is built
+	// for the given architecture, leaving out the files under
+	// arch/ specific to other architectures.
+	Architecture string
+
+	// LinkDuplicates specifies that each file with the same
+	// contents and mode as one already in the archive is stored
+	// as a symlink to that file rather than as a copy of it.
+	LinkDuplicates bool
+
+	// WriteVersion specifies that the version of the charm's
+	// source, as returned by VCSVersion, is written to the
+	// version file in the archive, replacing any version file
+	// in the charm directory.
+	WriteVersion bool
+}
+
+// ArchiveToWithOptions is like ArchiveTo but allows the contents
+// of the archive to be changed with the given options.
+func (dir *CharmDir) ArchiveToWithOptions(w io.Writer, opts ArchiveOptions) error {
+	var excludes []func(string) bool
+	if opts.ExcludeIncompatibleWheels {
+		bases := dir.Meta().AllBases()
+		excludes = append(excludes, func(relpath string) bool {
+			if !strings.HasPrefix(relpath, "wheelhouse/") {
+				return false
+			}
+			tags, _, _, ok := parseWheelName(path.Base(relpath))
+			return ok && wheelProblem(tags, bases) != ""
+		})
+	}
+	if opts.Architecture != "" {
+		if !knownArchitectures[opts.Architecture] {
+			return fmt.Errorf("unknown architecture %q", opts.Architecture)
+		}
+		excludes = append(excludes, archExclude(opts.Architecture))
+	}
+	var exclude func(string) bool
+	if len(excludes) > 0 {
+		exclude = func(relpath string) bool {
+			for _, f := range excludes {
+				if f(relpath) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	var files map[string][]byte
+	if opts.WriteVersion {
+		v, err := dir.VCSVersion()
+		if err != nil {
+			return fmt.Errorf("cannot write version: %v", err)
+		}
+		files = map[string][]byte{
+			VersionFile: []byte(v.String() + "\n"),
+		}
+	}
+	return dir.auditArchiveTo(w, func(w io.Writer) error {
+		return writeArchiveContext(context.Background(), w, dir.Path, dir.revision, dir.Meta().Hooks(), exclude, opts.LinkDuplicates, files)
+	})
+}
+
+type dependenciesByPath []PythonDependency
+
+func (d dependenciesByPath) Len() int           { return len(d) }
+func (d dependenciesByPath) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d dependenciesByPath) Less(i, j int) bool { return d[i].Path < d[j].Path }
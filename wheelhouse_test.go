@@ -0,0 +1,152 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"gopkg.in/juju/charm.v4"
+	charmtesting "gopkg.in/juju/charm.v4/testing"
+)
+
+type WheelhouseSuite struct{}
+
+var _ = gc.Suite(&WheelhouseSuite{})
+
+var wheelhouseFiles = []string{
+	"wheelhouse/six-1.8.0-py2.py3-none-any.whl",
+	"wheelhouse/PyYAML-3.11-cp34-cp34m-linux_x86_64.whl",
+	"wheelhouse/simplejson-3.6.5-cp27-none-linux_x86_64.whl",
+	"wheelhouse/netifaces-0.10.4-cp35-cp35m-manylinux1_x86_64.whl",
+	"wheelhouse/pywin32-219-1-cp34-none-win_amd64.whl",
+	"wheelhouse/charmhelpers-0.2.1.tar.gz",
+	"wheelhouse/README",
+	"venv/lib/python3.4/site-packages/requests-2.4.3.dist-info/METADATA",
+	"venv/lib/python3.4/site-packages/requests-2.4.3.dist-info/RECORD",
+	"venv/lib/python3.4/site-packages/requests/__init__.py",
+}
+
+// wheelhouseCharm returns the path to a copy of the dummy charm for
+// the given series holding a wheelhouse and a virtualenv.
+func wheelhouseCharm(c *gc.C, series string) string {
+	path := charmtesting.Charms.ClonedDirPath(c.MkDir(), "dummy")
+	for _, name := range wheelhouseFiles {
+		file := filepath.Join(path, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(file), 0755)
+		c.Assert(err, gc.IsNil)
+		err = ioutil.WriteFile(file, []byte(name), 0644)
+		c.Assert(err, gc.IsNil)
+	}
+	if series != "" {
+		f, err := os.OpenFile(filepath.Join(path, "metadata.yaml"), os.O_WRONLY|os.O_APPEND, 0644)
+		c.Assert(err, gc.IsNil)
+		_, err = f.WriteString("series: " + series + "\n")
+		c.Assert(err, gc.IsNil)
+		f.Close()
+	}
+	return path
+}
+
+func (s *WheelhouseSuite) TestPythonDependencies(c *gc.C) {
+	dir, err := charm.ReadCharmDir(wheelhouseCharm(c, ""))
+	c.Assert(err, gc.IsNil)
+	deps, err := charm.PythonDependencies(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(deps, jc.DeepEquals, []charm.PythonDependency{{
+		Name:      "requests",
+		Version:   "2.4.3",
+		Path:      "venv/lib/python3.4/site-packages/requests-2.4.3.dist-info",
+		Installed: true,
+	}, {
+		Name:    "PyYAML",
+		Version: "3.11",
+		Path:    "wheelhouse/PyYAML-3.11-cp34-cp34m-linux_x86_64.whl",
+		Wheel:   &charm.WheelTags{Python: "cp34", ABI: "cp34m", Platform: "linux_x86_64"},
+	}, {
+		Name:    "charmhelpers",
+		Version: "0.2.1",
+		Path:    "wheelhouse/charmhelpers-0.2.1.tar.gz",
+	}, {
+		Name:    "netifaces",
+		Version: "0.10.4",
+		Path:    "wheelhouse/netifaces-0.10.4-cp35-cp35m-manylinux1_x86_64.whl",
+		Wheel:   &charm.WheelTags{Python: "cp35", ABI: "cp35m", Platform: "manylinux1_x86_64"},
+	}, {
+		Name:    "pywin32",
+		Version: "219",
+		Path:    "wheelhouse/pywin32-219-1-cp34-none-win_amd64.whl",
+		Wheel:   &charm.WheelTags{Python: "cp34", ABI: "none", Platform: "win_amd64"},
+	}, {
+		Name:    "simplejson",
+		Version: "3.6.5",
+		Path:    "wheelhouse/simplejson-3.6.5-cp27-none-linux_x86_64.whl",
+		Wheel:   &charm.WheelTags{Python: "cp27", ABI: "none", Platform: "linux_x86_64"},
+	}, {
+		Name:    "six",
+		Version: "1.8.0",
+		Path:    "wheelhouse/six-1.8.0-py2.py3-none-any.whl",
+		Wheel:   &charm.WheelTags{Python: "py2.py3", ABI: "none", Platform: "any"},
+	}})
+}
+
+func (s *WheelhouseSuite) TestCheckWheels(c *gc.C) {
+	dir, err := charm.ReadCharmDir(wheelhouseCharm(c, "trusty"))
+	c.Assert(err, gc.IsNil)
+	problems, err := charm.CheckWheels(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, jc.DeepEquals, []charm.WheelProblem{{
+		Path:   "wheelhouse/netifaces-0.10.4-cp35-cp35m-manylinux1_x86_64.whl",
+		Reason: `python "cp35" is not provided by series "trusty" (provides 2.7, 3.4)`,
+	}, {
+		Path:   "wheelhouse/pywin32-219-1-cp34-none-win_amd64.whl",
+		Reason: `platform "win_amd64" is not Linux`,
+	}})
+}
+
+func (s *WheelhouseSuite) TestCheckWheelsUnknownSeries(c *gc.C) {
+	dir, err := charm.ReadCharmDir(wheelhouseCharm(c, ""))
+	c.Assert(err, gc.IsNil)
+	problems, err := charm.CheckWheels(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, gc.HasLen, 1)
+	c.Assert(problems[0].Path, gc.Equals, "wheelhouse/pywin32-219-1-cp34-none-win_amd64.whl")
+}
+
+func (s *WheelhouseSuite) TestArchiveExcludingIncompatibleWheels(c *gc.C) {
+	dir, err := charm.ReadCharmDir(wheelhouseCharm(c, "trusty"))
+	c.Assert(err, gc.IsNil)
+	var buf bytes.Buffer
+	err = dir.ArchiveToWithOptions(&buf, charm.ArchiveOptions{ExcludeIncompatibleWheels: true})
+	c.Assert(err, gc.IsNil)
+	archive, err := charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	manifest, err := archive.Manifest()
+	c.Assert(err, gc.IsNil)
+	c.Assert(manifest.Contains("wheelhouse/six-1.8.0-py2.py3-none-any.whl"), jc.IsTrue)
+	c.Assert(manifest.Contains("wheelhouse/PyYAML-3.11-cp34-cp34m-linux_x86_64.whl"), jc.IsTrue)
+	c.Assert(manifest.Contains("wheelhouse/simplejson-3.6.5-cp27-none-linux_x86_64.whl"), jc.IsTrue)
+	c.Assert(manifest.Contains("wheelhouse/charmhelpers-0.2.1.tar.gz"), jc.IsTrue)
+	c.Assert(manifest.Contains("wheelhouse/netifaces-0.10.4-cp35-cp35m-manylinux1_x86_64.whl"), jc.IsFalse)
+	c.Assert(manifest.Contains("wheelhouse/pywin32-219-1-cp34-none-win_amd64.whl"), jc.IsFalse)
+
+	problems, err := charm.CheckWheels(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, gc.HasLen, 0)
+
+	// Without the option, everything is archived.
+	buf.Reset()
+	err = dir.ArchiveToWithOptions(&buf, charm.ArchiveOptions{})
+	c.Assert(err, gc.IsNil)
+	archive, err = charm.ReadCharmArchiveBytes(buf.Bytes())
+	c.Assert(err, gc.IsNil)
+	problems, err = charm.CheckWheels(archive)
+	c.Assert(err, gc.IsNil)
+	c.Assert(problems, gc.HasLen, 2)
+}
@@ -0,0 +1,750 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ParseError describes an error found when parsing one of the
+// YAML files in a charm, such as metadata.yaml or config.yaml,
+// along with the location of the value at fault.
+type ParseError struct {
+	// Path holds the dot-separated path to the value at
+	// fault, such as "requires.db.interface", or the empty
+	// string if the error does not relate to a particular
+	// value.
+	Path string
+
+	// Line and Column hold the 1-based position in the
+	// file of the value at fault, or of its closest
+	// ancestor that could be found. They are both zero
+	// if the position is not known.
+	Line   int
+	Column int
+
+	// Message describes the error.
+	Message string
+
+	// context holds the text that prefixes the error
+	// message, such as "metadata".
+	context string
+}
+
+func (err *ParseError) Error() string {
+	var prefix string
+	if err.context != "" {
+		prefix = err.context + ": "
+	}
+	if err.Line > 0 {
+		prefix += fmt.Sprintf("line %d, column %d: ", err.Line, err.Column)
+	}
+	return prefix + err.Message
+}
+
+// newParseError returns a *ParseError with the given context and
+// message, located at the value with the given path in the YAML
+// document held in data.
+func newParseError(data []byte, context, path, message string) *ParseError {
+	line, column := yamlPosition(data, path)
+	return &ParseError{
+		Path:    path,
+		Line:    line,
+		Column:  column,
+		Message: message,
+		context: context,
+	}
+}
+
+// yamlDecodeError returns a *ParseError for an error returned by
+// the YAML codec when decoding the document held in data, located
+// at the first line the error mentions. Errors that mention no line,
+// which may be returned by other codecs, are returned unchanged.
+func yamlDecodeError(data []byte, context string, err error) error {
+	msg := err.Error()
+	loc := yamlErrorLine.FindStringSubmatchIndex(msg)
+	if loc == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(msg[loc[2]:loc[3]])
+	// Only the first of several errors is reported.
+	msg = msg[loc[1]:]
+	if i := strings.Index(msg, "\n"); i >= 0 {
+		msg = msg[:i]
+	}
+	return &ParseError{
+		Line:    line,
+		Column:  yamlLineIndent(data, line) + 1,
+		Message: msg,
+		context: context,
+	}
+}
+
+// yamlLineIndent returns the number of blanks that start the
+// given line of the YAML document held in data.
+func yamlLineIndent(data []byte, line int) int {
+	lines := bytes.Split(data, []byte("\n"))
+	if line < 1 || line > len(lines) {
+		return 0
+	}
+	l := lines[line-1]
+	n := 0
+	for n < len(l) && isYAMLBlank(l[n]) {
+		n++
+	}
+	return n
+}
+
+// schemaErrorPath matches the path that prefixes the
+// messages of errors returned by schema checkers.
+var schemaErrorPath = regexp.MustCompile(`^([^ :]+): `)
+
+// schemaParseError returns a *ParseError for an error returned
+// by a schema checker when coercing the YAML document held in
+// data.
+func schemaParseError(data []byte, context string, err error) *ParseError {
+	var path string
+	if m := schemaErrorPath.FindStringSubmatch(err.Error()); m != nil {
+		path = m[1]
+	}
+	return newParseError(data, context, path, err.Error())
+}
+
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+	crlf       = []byte("\r\n")
+)
+
+// normalizeYAML returns the given YAML document with any byte order
+// mark removed, UTF-16 converted to UTF-8 and CRLF line endings
+// converted to LF, as written by many Windows editors. If strict is
+// true, byte order marks and CRLF line endings are rejected instead.
+// Documents that are not valid UTF-8 are rejected in either case,
+// as the YAML decoder's own errors do not say where the problem is.
+func normalizeYAML(data []byte, strict bool) ([]byte, *ParseError) {
+	if bytes.HasPrefix(data, utf8BOM) || bytes.HasPrefix(data, utf16LEBOM) || bytes.HasPrefix(data, utf16BEBOM) {
+		if strict {
+			return nil, &ParseError{
+				Line:    1,
+				Column:  1,
+				Message: "byte order marks are not allowed",
+			}
+		}
+		if bytes.HasPrefix(data, utf8BOM) {
+			data = data[len(utf8BOM):]
+		} else {
+			data = decodeUTF16(data)
+		}
+	}
+	if i := bytes.Index(data, crlf); i >= 0 {
+		if strict {
+			line, column := offsetPosition(data, i)
+			return nil, &ParseError{
+				Line:    line,
+				Column:  column,
+				Message: "CRLF line endings are not allowed",
+			}
+		}
+		data = bytes.Replace(data, crlf, []byte("\n"), -1)
+	}
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			line, column := offsetPosition(data, i)
+			return nil, &ParseError{
+				Line:    line,
+				Column:  column,
+				Message: "invalid UTF-8",
+			}
+		}
+		i += size
+	}
+	return data, nil
+}
+
+// decodeUTF16 returns the UTF-8 encoding of the given UTF-16
+// text, which must start with a byte order mark.
+func decodeUTF16(data []byte) []byte {
+	var order binary.ByteOrder = binary.BigEndian
+	if bytes.HasPrefix(data, utf16LEBOM) {
+		order = binary.LittleEndian
+	}
+	data = data[2:]
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = order.Uint16(data[2*i:])
+	}
+	return []byte(string(utf16.Decode(u)))
+}
+
+// offsetPosition returns the 1-based line and column of the
+// byte at the given offset in data.
+func offsetPosition(data []byte, offset int) (line, column int) {
+	line = bytes.Count(data[:offset], []byte("\n")) + 1
+	column = offset - bytes.LastIndex(data[:offset], []byte("\n"))
+	return line, column
+}
+
+// Charm metadata, config and actions are uploaded by untrusted
+// parties, so we do not allow YAML anchors, aliases or merge keys
+// in them. Aliases can be nested to make a small document expand
+// into an enormous value when decoded (the "billion laughs" attack),
+// and rejecting them before the document reaches the decoder means
+// that no expansion can ever take place. They also make it hard to
+// report the location of errors in the charm files, and no charm is
+// known to use them.
+
+// checkYAMLFeatures returns a *ParseError describing the first
+// anchor, alias or merge key found in the given YAML document,
+// or nil if there are none.
+//
+// It scans the source text rather than the decoded value, so it
+// cannot be fooled by expansion, and it errs on the side of
+// caution in the rare cases it cannot tell whether a character
+// starts a new node. As it must be called before the document is
+// decoded, it then checks the document with checkYAMLAliasNames,
+// which does not depend on the scanner understanding the document,
+// so that no alias can be expanded even if the scanner is wrong.
+func checkYAMLFeatures(data []byte) *ParseError {
+	var sc yamlScanner
+	for i, line := range strings.Split(string(data), "\n") {
+		if err := sc.scanLine(i+1, strings.TrimRight(line, "\r")); err != nil {
+			return err
+		}
+	}
+	return checkYAMLAliasNames(data)
+}
+
+// checkYAMLAliasNames returns a *ParseError describing the first
+// possible alias in the given YAML document that names a possible
+// anchor before it. An alias can only be expanded if an anchor of
+// the same name precedes it, so a document that passes cannot be
+// expanded when decoded, however the decoder interprets it.
+//
+// Any "&" or "*" that starts the document or follows a blank, a
+// line break or a flow indicator, and is followed by a name, is
+// taken to be an anchor or an alias, wherever it appears; text such
+// as "&x ... *x" in a quoted string or block scalar is therefore
+// rejected, but is unlikely to be found in any charm.
+func checkYAMLAliasNames(data []byte) *ParseError {
+	var anchors map[string]bool
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c != '&' && c != '*' {
+			continue
+		}
+		if i > 0 && !isYAMLBlank(data[i-1]) && strings.IndexByte("\r\n[{,", data[i-1]) < 0 {
+			continue
+		}
+		end := i + 1
+		for end < len(data) && isAnchorByte(data[end]) {
+			end++
+		}
+		if end == i+1 {
+			continue
+		}
+		name := string(data[i+1 : end])
+		if c == '&' {
+			if anchors == nil {
+				anchors = make(map[string]bool)
+			}
+			anchors[name] = true
+		} else if anchors[name] {
+			line, column := offsetPosition(data, i)
+			return featureError("aliases", line, column)
+		}
+		i = end - 1
+	}
+	return nil
+}
+
+// checkYAMLExpansion returns a *ParseError if the value v, decoded
+// from the YAML document held in data, holds more collection entries
+// than data has bytes. Every mapping or sequence entry takes at least
+// one byte of the source unless it is repeated by an alias, so this
+// catches any expansion that checkYAMLFeatures fails to prevent, such
+// as one performed by a YAMLCodec that interprets the document
+// differently. Counting stops as soon as the limit is exceeded.
+func checkYAMLExpansion(data []byte, v interface{}) *ParseError {
+	budget := len(data)
+	if !countYAMLEntries(reflect.ValueOf(v), &budget) {
+		return &ParseError{
+			Message: "YAML document expands to more values than it holds",
+		}
+	}
+	return nil
+}
+
+// countYAMLEntries subtracts the number of map and slice entries held
+// in v from *budget, returning false as soon as it becomes negative.
+func countYAMLEntries(v reflect.Value, budget *int) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return true
+		}
+		return countYAMLEntries(v.Elem(), budget)
+	case reflect.Map:
+		if *budget -= v.Len(); *budget < 0 {
+			return false
+		}
+		for _, key := range v.MapKeys() {
+			if !countYAMLEntries(key, budget) || !countYAMLEntries(v.MapIndex(key), budget) {
+				return false
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return true
+		}
+		if *budget -= v.Len(); *budget < 0 {
+			return false
+		}
+		for i := 0; i < v.Len(); i++ {
+			if !countYAMLEntries(v.Index(i), budget) {
+				return false
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !countYAMLEntries(v.Field(i), budget) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// yamlScanner holds the state kept between lines while
+// scanning a YAML document.
+type yamlScanner struct {
+	// quote holds the quote character of a flow scalar
+	// that continues onto the next line, or zero.
+	quote byte
+
+	// flowDepth holds the nesting level of flow
+	// collections ("[...]" and "{...}").
+	flowDepth int
+
+	// inBlock records whether we are within a block
+	// scalar ("|" or ">").
+	inBlock bool
+
+	// blockIndent holds the indentation of the line that
+	// started the current block scalar. Following lines
+	// indented further belong to the scalar.
+	blockIndent int
+}
+
+func (sc *yamlScanner) scanLine(lineNum int, line string) *ParseError {
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if sc.inBlock {
+		if strings.TrimSpace(line) == "" || indent > sc.blockIndent {
+			return nil
+		}
+		sc.inBlock = false
+	}
+	// nodeStart records whether the next non-space character
+	// may start a new node (and so an anchor or alias).
+	nodeStart := sc.quote == 0
+	// keyStart records whether the next non-space character
+	// may start a mapping key (and so a merge key).
+	keyStart := nodeStart
+	start := 0
+	if nodeStart && isDocumentMarker(line) {
+		// A document start or end marker may be followed
+		// on the same line by the document's root node,
+		// as in "--- &a".
+		start = 3
+		sc.flowDepth = 0
+	}
+	for i := start; i < len(line); i++ {
+		c := line[i]
+		if sc.quote != 0 {
+			switch {
+			case c == '\\' && sc.quote == '"':
+				i++
+			case c == '\'' && sc.quote == '\'' && i+1 < len(line) && line[i+1] == '\'':
+				i++
+			case c == sc.quote:
+				sc.quote = 0
+			}
+			continue
+		}
+		if isYAMLBlank(c) {
+			continue
+		}
+		if c == '#' && (i == 0 || isYAMLBlank(line[i-1])) {
+			return nil
+		}
+		atNode, atKey := nodeStart, keyStart
+		nodeStart, keyStart = false, false
+		switch {
+		case atKey && isMergeKey(line[i:]):
+			return featureError("merge keys", lineNum, i+1)
+		case atNode && c == '&' && isAnchorChar(line, i+1):
+			return featureError("anchors", lineNum, i+1)
+		case atNode && c == '*' && isAnchorChar(line, i+1):
+			return featureError("aliases", lineNum, i+1)
+		case atNode && (c == '"' || c == '\''):
+			sc.quote = c
+		case atNode && (c == '|' || c == '>') && sc.flowDepth == 0:
+			sc.inBlock = true
+			sc.blockIndent = indent
+			return nil
+		case c == '-' && atNode && blankFollows(line, i):
+			// A sequence entry.
+			nodeStart, keyStart = true, true
+		case c == '?' && atNode && blankFollows(line, i):
+			// A complex mapping key.
+			nodeStart, keyStart = true, false
+		case c == ':' && (blankFollows(line, i) || sc.flowDepth > 0):
+			nodeStart = true
+		case c == '!' && atNode:
+			// A tag; the node itself follows it.
+			for i+1 < len(line) && !isYAMLBlank(line[i+1]) {
+				i++
+			}
+			nodeStart = true
+		case c == '[' || c == '{':
+			if atNode || sc.flowDepth > 0 {
+				sc.flowDepth++
+				nodeStart, keyStart = true, c == '{'
+			}
+		case c == ']' || c == '}':
+			if sc.flowDepth > 0 {
+				sc.flowDepth--
+			}
+		case c == ',' && sc.flowDepth > 0:
+			nodeStart, keyStart = true, true
+		default:
+			// Part of a plain scalar; skip to the end of the word
+			// so that characters within it are not mistaken for
+			// indicators.
+			for i+1 < len(line) && !sc.endsWord(line, i+1) {
+				i++
+			}
+		}
+	}
+	return nil
+}
+
+func featureError(feature string, line, column int) *ParseError {
+	return &ParseError{
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf("YAML %s are not allowed", feature),
+	}
+}
+
+// endsWord returns whether the byte at index i of line
+// ends a plain scalar word.
+func (sc *yamlScanner) endsWord(line string, i int) bool {
+	switch line[i] {
+	case ' ', '\t':
+		return true
+	case ':':
+		return blankFollows(line, i) || sc.flowDepth > 0
+	case ',', '[', ']', '{', '}':
+		return sc.flowDepth > 0
+	}
+	return false
+}
+
+// isMergeKey returns whether s starts with a merge key ("<<:").
+func isMergeKey(s string) bool {
+	if !strings.HasPrefix(s, "<<") {
+		return false
+	}
+	s = strings.TrimLeft(s[2:], " \t")
+	return strings.HasPrefix(s, ":")
+}
+
+// isYAMLBlank returns whether c is a YAML blank: a space or a tab.
+// Both may separate an indicator from the node that follows it.
+func isYAMLBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// blankFollows returns whether the byte at index i of line
+// ends the line or is followed by a blank.
+func blankFollows(line string, i int) bool {
+	return i+1 == len(line) || isYAMLBlank(line[i+1])
+}
+
+// isDocumentMarker returns whether line starts with a document
+// start ("---") or end ("...") marker.
+func isDocumentMarker(line string) bool {
+	return (strings.HasPrefix(line, "---") || strings.HasPrefix(line, "...")) && blankFollows(line, 2)
+}
+
+// isAnchorChar returns whether the byte at index i of s
+// may be part of an anchor or alias name.
+func isAnchorChar(s string, i int) bool {
+	return i < len(s) && isAnchorByte(s[i])
+}
+
+// isAnchorByte returns whether c may be part
+// of an anchor or alias name.
+func isAnchorByte(c byte) bool {
+	return strings.IndexByte(" \t\r\n,[]{}", c) < 0
+}
+
+// yamlPosition returns the 1-based line and column of the value
+// with the given path in the YAML document held in data. If the
+// value cannot be found, the position of its closest ancestor is
+// returned instead; if none can be found, it returns zeros.
+//
+// Paths are formed as by the schema package: mapping keys are
+// separated by dots and sequence indexes are held in brackets,
+// as in "requires.db.interface" or "tags[1]". Only values in
+// block collections can be found; values inside flow
+// collections are reported at the position of the collection.
+func yamlPosition(data []byte, path string) (line, column int) {
+	positions := yamlPositions(data)
+	for path != "" {
+		if pos, ok := positions[path]; ok {
+			return pos.line, pos.column
+		}
+		if i := strings.LastIndexAny(path, ".["); i >= 0 {
+			path = path[:i]
+		} else {
+			path = ""
+		}
+	}
+	return 0, 0
+}
+
+type yamlPos struct {
+	line, column int
+}
+
+// yamlFrame holds a collection entry that encloses the
+// line being parsed by yamlPositions.
+type yamlFrame struct {
+	column int
+	path   string
+	isItem bool
+	items  int
+}
+
+// yamlPositions returns the positions of all the values in the
+// block collections of the given YAML document, indexed by path.
+func yamlPositions(data []byte) map[string]yamlPos {
+	positions := make(map[string]yamlPos)
+	stack := []*yamlFrame{{column: -1}}
+	// parent pops all the frames that cannot enclose an
+	// entry at the given column and returns the innermost
+	// remaining one. Sequence entries may be indented at the
+	// same level as the key that holds them.
+	parent := func(column int, isItem bool) *yamlFrame {
+		for {
+			top := stack[len(stack)-1]
+			if top.column < column || top.column == column && isItem && !top.isItem {
+				return top
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	inBlock, blockIndent, flowDepth := false, 0, 0
+	for i, text := range strings.Split(string(data), "\n") {
+		lineNum := i + 1
+		text = strings.TrimRight(text, "\r")
+		column := len(text) - len(strings.TrimLeft(text, " "))
+		rest := text[column:]
+		if inBlock {
+			if rest == "" || column > blockIndent {
+				continue
+			}
+			inBlock = false
+		}
+		if flowDepth > 0 {
+			flowDepth = flowNesting(text, flowDepth)
+			continue
+		}
+		if rest == "" || rest[0] == '#' || rest[0] == '%' || strings.HasPrefix(rest, "---") {
+			continue
+		}
+		// Sequence entries, possibly several on one line.
+		for rest == "-" || strings.HasPrefix(rest, "- ") {
+			p := parent(column, true)
+			f := &yamlFrame{
+				column: column,
+				path:   p.path + "[" + strconv.Itoa(p.items) + "]",
+				isItem: true,
+			}
+			p.items++
+			stack = append(stack, f)
+			trimmed := strings.TrimLeft(rest[1:], " ")
+			column += len(rest) - len(trimmed)
+			rest = trimmed
+			positions[f.path] = yamlPos{lineNum, column + 1}
+		}
+		if key, value, ok := splitYAMLKey(rest); ok {
+			p := parent(column, false)
+			f := &yamlFrame{column: column, path: key}
+			if p.path != "" {
+				f.path = p.path + "." + key
+			}
+			stack = append(stack, f)
+			positions[f.path] = yamlPos{lineNum, column + 1}
+			rest = strings.TrimLeft(value, " ")
+		}
+		switch {
+		case rest == "":
+		case rest[0] == '|' || rest[0] == '>':
+			inBlock, blockIndent = true, column
+		case rest[0] == '[' || rest[0] == '{':
+			flowDepth = flowNesting(rest, 0)
+		}
+	}
+	return positions
+}
+
+// splitYAMLKey splits a line of a block mapping, with leading
+// indentation removed, into the key and the rest of the line.
+// It returns false if the line does not start with a key.
+func splitYAMLKey(s string) (key, rest string, ok bool) {
+	if s == "" {
+		return "", "", false
+	}
+	if q := s[0]; q == '"' || q == '\'' {
+		end := strings.IndexByte(s[1:], q)
+		if end < 0 {
+			return "", "", false
+		}
+		key, rest = s[1:end+1], strings.TrimLeft(s[end+2:], " ")
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return key, rest[1:], true
+	}
+	if strings.IndexByte("[{&*!|>#", s[0]) >= 0 {
+		return "", "", false
+	}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == ':' && blankFollows(s, i):
+			return strings.TrimRight(s[:i], " \t"), s[i+1:], true
+		case s[i] == '#' && i > 0 && isYAMLBlank(s[i-1]):
+			return "", "", false
+		}
+	}
+	return "", "", false
+}
+
+// flowNesting returns the nesting level of flow collections
+// at the end of the given text, starting at the given level.
+func flowNesting(text string, depth int) int {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == '#' && i > 0 && isYAMLBlank(text[i-1]):
+			return depth
+		}
+	}
+	return depth
+}
+
+// preserveComments returns newData, a YAML document written to
+// replace oldData, with comments from oldData carried over where
+// possible. A block of comment lines immediately preceding a
+// mapping key or sequence entry in oldData is inserted before
+// the entry with the same path in newData, if there is one, and
+// comments at the start of oldData that are separated from its
+// first entry by a blank line are kept at the start. Other
+// comments, such as those at the end of a line, are lost.
+func preserveComments(oldData, newData []byte) []byte {
+	oldLines := strings.Split(string(oldData), "\n")
+	newLines := strings.Split(string(newData), "\n")
+	oldPositions := yamlPositions(oldData)
+	newPositions := yamlPositions(newData)
+	paths := make([]string, 0, len(oldPositions))
+	for path := range oldPositions {
+		paths = append(paths, path)
+	}
+	// Sorting puts a sequence entry before any key on the
+	// same line, so the comments go before the entry.
+	sort.Strings(paths)
+	comments := make(map[int][]string)
+	used := make(map[int]bool)
+	for _, path := range paths {
+		oldPos := oldPositions[path]
+		newPos, ok := newPositions[path]
+		if !ok || used[oldPos.line] || comments[newPos.line] != nil {
+			continue
+		}
+		used[oldPos.line] = true
+		if block := commentsBefore(oldLines, oldPos.line); len(block) > 0 {
+			comments[newPos.line] = block
+		}
+	}
+	var buf bytes.Buffer
+	header := 0
+	for i, text := range oldLines {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			header = i + 1
+		} else if text[0] != '#' {
+			break
+		}
+	}
+	for _, text := range oldLines[:header] {
+		buf.WriteString(strings.TrimRight(text, "\r"))
+		buf.WriteByte('\n')
+	}
+	for i, text := range newLines {
+		indent := text[:len(text)-len(strings.TrimLeft(text, " "))]
+		for _, comment := range comments[i+1] {
+			buf.WriteString(indent)
+			buf.WriteString(comment)
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(text)
+		if i < len(newLines)-1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// commentsBefore returns the comment lines, with indentation
+// removed, that immediately precede the given 1-based line.
+func commentsBefore(lines []string, line int) []string {
+	start := line - 1
+	for start > 0 {
+		text := strings.TrimSpace(lines[start-1])
+		if text == "" || text[0] != '#' {
+			break
+		}
+		start--
+	}
+	var block []string
+	for _, text := range lines[start : line-1] {
+		block = append(block, strings.TrimSpace(text))
+	}
+	return block
+}
@@ -0,0 +1,345 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	gc "gopkg.in/check.v1"
+)
+
+type YAMLSuite struct{}
+
+var _ = gc.Suite(&YAMLSuite{})
+
+var checkYAMLFeaturesTests = []struct {
+	about  string
+	yaml   string
+	expect string
+}{{
+	about: "plain document",
+	yaml: `
+name: foo
+summary: "a & b * c"
+description: |
+  Use *args and &refs
+  <<: freely.
+tags: [a, b*, "&c"]
+requires:
+  db: {interface: mysql}
+`,
+}, {
+	about: "comments and scalars with indicators",
+	yaml: `
+# &anchor *alias
+key: value # *alias
+other: a*b &c
+list:
+- -1
+- 'it''s *fine'
+`,
+}, {
+	about: "anchor on a mapping value",
+	yaml: `
+base: &base
+  a: 1
+`,
+	expect: `line 2, column 7: YAML anchors are not allowed`,
+}, {
+	about: "alias on a mapping value",
+	yaml: `
+name: foo
+summary: *name
+`,
+	expect: `line 3, column 10: YAML aliases are not allowed`,
+}, {
+	about: "alias in a sequence",
+	yaml: `
+list:
+  - a
+  - *b
+`,
+	expect: `line 4, column 5: YAML aliases are not allowed`,
+}, {
+	about:  "alias in a flow sequence",
+	yaml:   `tags: [a, *b]`,
+	expect: `line 1, column 11: YAML aliases are not allowed`,
+}, {
+	about: "merge key",
+	yaml: `
+options:
+  foo:
+    <<: {type: string}
+`,
+	expect: `line 4, column 5: YAML merge keys are not allowed`,
+}, {
+	about:  "merge key in a flow mapping",
+	yaml:   `foo: {a: 1, <<: x}`,
+	expect: `line 1, column 13: YAML merge keys are not allowed`,
+}, {
+	about: "alias after a block scalar",
+	yaml: `
+description: >
+  *not an alias
+name: *alias
+`,
+	expect: `line 4, column 7: YAML aliases are not allowed`,
+}, {
+	about:  "alias after a tag",
+	yaml:   `name: !!str *alias`,
+	expect: `line 1, column 13: YAML aliases are not allowed`,
+}, {
+	about: "multi-line quoted string",
+	yaml: `
+summary: "first
+  *second"
+name: &x foo
+`,
+	expect: `line 4, column 7: YAML anchors are not allowed`,
+}, {
+	about:  "anchor after a tab",
+	yaml:   "a:\t&x [lol,lol]\nb:\t[*x,*x]\n",
+	expect: `line 1, column 4: YAML anchors are not allowed`,
+}, {
+	about:  "alias after a tab",
+	yaml:   "b:\t[*x,*x]\n",
+	expect: `line 1, column 5: YAML aliases are not allowed`,
+}, {
+	about:  "alias in a sequence entry after a tab",
+	yaml:   "list:\n-\t*x\n",
+	expect: `line 2, column 3: YAML aliases are not allowed`,
+}, {
+	about:  "alias in a complex key after a tab",
+	yaml:   "?\t*x\n: y\n",
+	expect: `line 1, column 3: YAML aliases are not allowed`,
+}, {
+	about:  "alias after a tag and a tab",
+	yaml:   "name: !!str\t*alias\n",
+	expect: `line 1, column 13: YAML aliases are not allowed`,
+}, {
+	about:  "merge key after a tab",
+	yaml:   "base: x\nother:\n  <<\t: y\n",
+	expect: `line 3, column 3: YAML merge keys are not allowed`,
+}, {
+	about:  "merge key value after a tab",
+	yaml:   "other:\n  <<:\t{a: b}\n",
+	expect: `line 2, column 3: YAML merge keys are not allowed`,
+}, {
+	about: "tabs in plain scalars",
+	yaml:  "a:\tb*c\td&e\n",
+}, {
+	about:  "anchor after a document start marker",
+	yaml:   "--- &a [lol, lol]\n",
+	expect: `line 1, column 5: YAML anchors are not allowed`,
+}, {
+	about:  "alias after a document start marker",
+	yaml:   "a: b\n---\tx\n--- *a\n",
+	expect: `line 3, column 5: YAML aliases are not allowed`,
+}, {
+	about: "block scalar after a document start marker",
+	yaml:  "--- |\n  &a *b\n",
+}, {
+	about: "document markers within scalars",
+	yaml:  "a: ---\nb: ... &c\n",
+}, {
+	about:  "possible alias naming a possible anchor in a quoted string",
+	yaml:   "a: '\n&x [lol, lol]\n'\nb: [*x, *x]\n",
+	expect: `line 4, column 5: YAML aliases are not allowed`,
+}, {
+	about: "unrelated anchor and alias names",
+	yaml:  "description: |\n  Use *args and &refs,\n  or f(&x) and *y.\n",
+}}
+
+func (s *YAMLSuite) TestCheckYAMLFeatures(c *gc.C) {
+	for i, test := range checkYAMLFeaturesTests {
+		c.Logf("test %d: %s", i, test.about)
+		err := checkYAMLFeatures([]byte(test.yaml))
+		if test.expect == "" {
+			c.Assert(err, gc.IsNil)
+		} else {
+			c.Assert(err, gc.ErrorMatches, test.expect)
+		}
+	}
+}
+
+var yamlPositionDoc = `
+name: foo
+# A comment.
+description: |
+  not: a key
+requires:
+  db:
+    interface: mysql
+    limit: 1
+  "quoted": {interface: http}
+tags:
+  - one
+  - two
+series:
+- a
+- b:
+    c: d
+  e: f
+`
+
+var yamlPositionTests = []struct {
+	path         string
+	line, column int
+}{
+	{"name", 2, 1},
+	{"description", 4, 1},
+	{"not", 0, 0},
+	{"requires", 6, 1},
+	{"requires.db", 7, 3},
+	{"requires.db.interface", 8, 5},
+	{"requires.db.limit", 9, 5},
+	{"requires.db.optional", 7, 3},
+	{"requires.quoted", 10, 3},
+	{"requires.quoted.interface", 10, 3},
+	{"tags[0]", 12, 5},
+	{"tags[1]", 13, 5},
+	{"tags[2]", 11, 1},
+	{"series[0]", 15, 3},
+	{"series[1]", 16, 3},
+	{"series[1].b", 16, 3},
+	{"series[1].b.c", 17, 5},
+	{"series[1].e", 18, 3},
+	{"unknown", 0, 0},
+	{"", 0, 0},
+}
+
+func (s *YAMLSuite) TestYAMLPosition(c *gc.C) {
+	for i, test := range yamlPositionTests {
+		c.Logf("test %d: %s", i, test.path)
+		line, column := yamlPosition([]byte(yamlPositionDoc), test.path)
+		c.Assert(line, gc.Equals, test.line)
+		c.Assert(column, gc.Equals, test.column)
+	}
+}
+
+var preserveCommentsTests = []struct {
+	about  string
+	old    string
+	new    string
+	expect string
+}{{
+	about:  "no comments",
+	old:    "a: 1\nb: 2\n",
+	new:    "a: 3\n",
+	expect: "a: 3\n",
+}, {
+	about:  "header",
+	old:    "# header\n#\n\n# a comment\na: 1\n",
+	new:    "a: 2\nb: 3\n",
+	expect: "# header\n#\n\n# a comment\na: 2\nb: 3\n",
+}, {
+	about:  "nested comments are reindented",
+	old:    "a:\n    # b comment\n    b: 1\n    # c comment\n    c: 2\n",
+	new:    "a:\n  b: 1\n  d: 4\n",
+	expect: "a:\n  # b comment\n  b: 1\n  d: 4\n",
+}, {
+	about:  "sequence entries",
+	old:    "tags:\n  # first\n  - a\n  # second\n  - b\n",
+	new:    "tags:\n- x\n",
+	expect: "tags:\n# first\n- x\n",
+}, {
+	about:  "comments separated by a blank line are lost",
+	old:    "a: 1\n# lost\n\nb: 2\n",
+	new:    "a: 1\nb: 2\n",
+	expect: "a: 1\nb: 2\n",
+}}
+
+func (s *YAMLSuite) TestPreserveComments(c *gc.C) {
+	for i, test := range preserveCommentsTests {
+		c.Logf("test %d: %s", i, test.about)
+		got := preserveComments([]byte(test.old), []byte(test.new))
+		c.Assert(string(got), gc.Equals, test.expect)
+	}
+}
+
+var normalizeYAMLTests = []struct {
+	about  string
+	data   string
+	strict bool
+	expect string
+	err    string
+}{{
+	about:  "plain document",
+	data:   "name: foo\nsummary: bar\n",
+	expect: "name: foo\nsummary: bar\n",
+}, {
+	about:  "UTF-8 byte order mark",
+	data:   "\xef\xbb\xbfname: foo\n",
+	expect: "name: foo\n",
+}, {
+	about:  "UTF-16LE byte order mark",
+	data:   "\xff\xfen\x00:\x00 \x00\xe9\x00\n\x00",
+	expect: "n: é\n",
+}, {
+	about:  "UTF-16BE byte order mark",
+	data:   "\xfe\xff\x00n\x00:\x00 \x00\xe9\x00\n",
+	expect: "n: é\n",
+}, {
+	about:  "CRLF line endings",
+	data:   "name: foo\r\nsummary: bar\r\n",
+	expect: "name: foo\nsummary: bar\n",
+}, {
+	about:  "byte order mark and CRLF line endings",
+	data:   "\xef\xbb\xbfname: foo\r\n",
+	expect: "name: foo\n",
+}, {
+	about:  "strict plain document",
+	data:   "name: foo\nsummary: bar\n",
+	strict: true,
+	expect: "name: foo\nsummary: bar\n",
+}, {
+	about:  "strict byte order mark",
+	data:   "\xef\xbb\xbfname: foo\n",
+	strict: true,
+	err:    "line 1, column 1: byte order marks are not allowed",
+}, {
+	about:  "strict CRLF line endings",
+	data:   "name: foo\nsummary: bar\r\n",
+	strict: true,
+	err:    "line 2, column 13: CRLF line endings are not allowed",
+}, {
+	about: "invalid UTF-8",
+	data:  "name: foo\nsummary: b\xffr\n",
+	err:   "line 2, column 11: invalid UTF-8",
+}}
+
+func (s *YAMLSuite) TestNormalizeYAML(c *gc.C) {
+	for i, test := range normalizeYAMLTests {
+		c.Logf("test %d: %s", i, test.about)
+		data, err := normalizeYAML([]byte(test.data), test.strict)
+		if test.err != "" {
+			c.Assert(err, gc.NotNil)
+			c.Assert(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(data), gc.Equals, test.expect)
+	}
+}
+
+func (s *YAMLSuite) TestCheckYAMLExpansion(c *gc.C) {
+	data := []byte("a: [x, y]\nb: {c: d}\n")
+	var v interface{}
+	err := yamlUnmarshal(data, &v)
+	c.Assert(err, gc.IsNil)
+	c.Assert(checkYAMLExpansion(data, v), gc.IsNil)
+
+	// A value holding more entries than its source has
+	// bytes can only have been expanded by aliases.
+	laughs := []byte("a: &a [lol, lol, lol, lol]\nb: &b [*a, *a, *a, *a]\nc: [*b, *b, *b, *b]\n")
+	err = yamlUnmarshal(laughs, &v)
+	c.Assert(err, gc.IsNil)
+	c.Assert(checkYAMLExpansion(laughs, v), gc.ErrorMatches, "YAML document expands to more values than it holds")
+
+	type doc struct {
+		A []string
+		B map[string]*doc
+	}
+	expanded := doc{B: map[string]*doc{"x": {A: make([]string, 10)}}}
+	c.Assert(checkYAMLExpansion(make([]byte, 11), expanded), gc.IsNil)
+	c.Assert(checkYAMLExpansion(make([]byte, 10), expanded), gc.NotNil)
+}
@@ -0,0 +1,121 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"gopkg.in/yaml.v1"
+)
+
+// YAMLCodec is implemented by types that encode and decode the YAML
+// files held in charms and bundles. Implementations must behave as
+// gopkg.in/yaml.v1 does: they must honour "yaml" struct tags and decode
+// mappings held in interface{} values as map[interface{}]interface{}.
+// They must also be safe to call concurrently. Unmarshal must not
+// retain data, or any part of it, once it returns, as the buffer
+// holding it is reused; see readYAMLSource.
+type YAMLCodec interface {
+	Unmarshal(data []byte, v interface{}) error
+	Marshal(v interface{}) ([]byte, error)
+}
+
+// goyamlCodec is the default YAMLCodec, which uses gopkg.in/yaml.v1.
+// Metadata and configuration simple enough for decodeSimpleYAML
+// are decoded without it.
+type goyamlCodec struct{}
+
+func (goyamlCodec) Unmarshal(data []byte, v interface{}) error {
+	if decodeSimpleYAMLInto(data, v) {
+		return nil
+	}
+	return yaml.Unmarshal(data, v)
+}
+
+func (goyamlCodec) Marshal(v interface{}) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+var (
+	yamlCodecMu sync.RWMutex
+	yamlCodec   YAMLCodec = goyamlCodec{}
+)
+
+// SetYAMLCodec sets the codec used to encode and decode YAML files,
+// returning the previous one. The default codec is based on
+// gopkg.in/yaml.v1, but decodes the simple metadata and configuration
+// found in most charms itself, several times faster. Services that read
+// many charms, where decoding still dominates, can use SetYAMLCodec to
+// substitute a faster one. If c is nil, the default codec is used.
+func SetYAMLCodec(c YAMLCodec) YAMLCodec {
+	if c == nil {
+		c = goyamlCodec{}
+	}
+	yamlCodecMu.Lock()
+	defer yamlCodecMu.Unlock()
+	old := yamlCodec
+	yamlCodec = c
+	return old
+}
+
+func currentYAMLCodec() YAMLCodec {
+	yamlCodecMu.RLock()
+	defer yamlCodecMu.RUnlock()
+	return yamlCodec
+}
+
+// yamlUnmarshal decodes data into v using the current codec.
+func yamlUnmarshal(data []byte, v interface{}) error {
+	return currentYAMLCodec().Unmarshal(data, v)
+}
+
+// yamlMarshal encodes v using the current codec.
+func yamlMarshal(v interface{}) ([]byte, error) {
+	return currentYAMLCodec().Marshal(v)
+}
+
+// maxPooledBuffer holds the size above which read
+// buffers are not returned to the pool, so that one
+// unusually large file does not pin its memory.
+const maxPooledBuffer = 1 << 20
+
+var readBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// readYAMLSource reads all of r into a pooled buffer, avoiding
+// the allocations made by ioutil.ReadAll as it grows its buffer
+// when many charm files are read in turn. The returned release
+// function must be called once the data is no longer used.
+//
+// Nothing derived from the data may hold a subslice of it once
+// release is called: every step of parsing, including
+// normalizeYAML, yamlSourceMap, the YAML codec and the building
+// of a ParseError, must copy what it keeps, for example by
+// converting it to a string.
+func readYAMLSource(r io.Reader) (data []byte, release func(), err error) {
+	buf := readBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	release = func() {
+		releaseReadBuffer(buf)
+	}
+	if _, err := buf.ReadFrom(r); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return buf.Bytes(), release, nil
+}
+
+// releaseReadBuffer returns a buffer used by readYAMLSource
+// to the pool. It is a variable so that tests can check that
+// no data is retained once the buffer is released.
+var releaseReadBuffer = func(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		readBufferPool.Put(buf)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2014 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package charm_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+
+	"gopkg.in/juju/charm.v4"
+)
+
+type YAMLCodecSuite struct{}
+
+const codecMeta = "name: dummy\nsummary: A dummy charm.\n"
+
+var _ = gc.Suite(&YAMLCodecSuite{})
+
+// countingCodec is a charm.YAMLCodec that counts the
+// documents it decodes and encodes.
+type countingCodec struct {
+	mu        sync.Mutex
+	unmarshal int
+	marshal   int
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	c.mu.Lock()
+	c.unmarshal++
+	c.mu.Unlock()
+	return yaml.Unmarshal(data, v)
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	c.mu.Lock()
+	c.marshal++
+	c.mu.Unlock()
+	return yaml.Marshal(v)
+}
+
+func (s *YAMLCodecSuite) TestSetYAMLCodec(c *gc.C) {
+	codec := &countingCodec{}
+	old := charm.SetYAMLCodec(codec)
+	defer charm.SetYAMLCodec(old)
+
+	meta, err := charm.ReadMeta(strings.NewReader(codecMeta + "description: short\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(meta.Name, gc.Equals, "dummy")
+	_, err = charm.ReadConfig(strings.NewReader("options: {}\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(codec.unmarshal, gc.Equals, 2)
+
+	prev := charm.SetYAMLCodec(nil)
+	c.Assert(prev, gc.Equals, charm.YAMLCodec(codec))
+	_, err = charm.ReadMeta(strings.NewReader(codecMeta + "description: short\n"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(codec.unmarshal, gc.Equals, 2)
+}
+
+func (s *YAMLCodecSuite) TestCodecErrors(c *gc.C) {
+	old := charm.SetYAMLCodec(failingCodec{})
+	defer charm.SetYAMLCodec(old)
+	_, err := charm.ReadMeta(strings.NewReader(codecMeta + "description: short\n"))
+	c.Assert(err, gc.ErrorMatches, "codec failure")
+}
+
+func (s *YAMLCodecSuite) TestReadsReuseBuffers(c *gc.C) {
+	// Reading in turn metadata of different sizes must not
+	// let data from one read leak into the next.
+	long := codecMeta + "description: " + strings.Repeat("x", 4096) + "\n"
+	for i := 0; i < 3; i++ {
+		meta, err := charm.ReadMeta(strings.NewReader(long))
+		c.Assert(err, gc.IsNil)
+		c.Assert(meta.Description, gc.HasLen, 4096)
+		meta, err = charm.ReadMeta(strings.NewReader(codecMeta + "description: short\n"))
+		c.Assert(err, gc.IsNil)
+		c.Assert(meta.Description, gc.Equals, "short")
+	}
+}
+
+// readYAMLFiles reads a variety of YAML files, valid and
+// not, returning what the reads return.
+func readYAMLFiles() []interface{} {
+	var results []interface{}
+	add := func(v interface{}, err error) {
+		errString := ""
+		if err != nil {
+			errString = err.Error()
+		}
+		results = append(results, v, errString)
+	}
+	// Metadata with a byte order mark and CRLF line
+	// endings is normalized before it is decoded.
+	crlf := "\ufeff" + strings.Replace(codecMeta+"description: d\ntags: [web]\n", "\n", "\r\n", -1)
+	meta, m, err := charm.ReadMetaWithSourceMap(strings.NewReader(crlf))
+	add(meta, err)
+	add(m, nil)
+	add(charm.ReadMeta(strings.NewReader(codecMeta + "description: d\nprovides:\n  url: {interface: 42}\n")))
+	add(charm.ReadMeta(strings.NewReader(codecMeta + "description: [unclosed\n")))
+	add(charm.ReadConfig(strings.NewReader("options:\n  title: {type: string, default: My Title, description: t}\n")))
+	add(charm.ReadConfig(strings.NewReader("options:\n  title: {type: colour}\n")))
+	add(charm.ReadActionsYaml(strings.NewReader("snapshot:\n  description: Take a snapshot.\n")))
+	add(charm.ReadMetrics(strings.NewReader("metrics:\n  pings: {type: gauge, description: p}\n")))
+	return results
+}
+
+func (s *YAMLCodecSuite) TestReadsRetainNoBufferData(c *gc.C) {
+	expect := readYAMLFiles()
+	restore := charm.PoisonReadBuffers()
+	defer restore()
+	// Anything holding on to a read buffer after it is
+	// released now sees it overwritten.
+	c.Assert(readYAMLFiles(), jc.DeepEquals, expect)
+}
+
+type failingCodec struct{}
+
+func (failingCodec) Unmarshal(data []byte, v interface{}) error {
+	return fmt.Errorf("codec failure")
+}
+
+func (failingCodec) Marshal(v interface{}) ([]byte, error) {
+	return nil, fmt.Errorf("codec failure")
+}